@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kmrgirish/pprof-adv/internal/annotate"
+	"github.com/kmrgirish/pprof-adv/internal/source"
+)
+
+type AnnotateCmd struct {
+	Profile   string `arg:"positional"   help:"cpu profile to annotate the source with, defaults to --profile or stdin"`
+	SourceDir string `arg:"--source-dir" help:"root of the module the profile was recorded from" default:"."`
+	Out       string `arg:"--out"        help:"directory to write the annotated copies of the --top hot source files to" default:"annotated"`
+}
+
+// run writes copies of the hot files of the source directory with the cpu of
+// every line, as text and as HTML.
+func (cmd *AnnotateCmd) run(root *Cmd) {
+	path := cmd.Profile
+	if path == "" {
+		path = root.Profile
+	}
+
+	f := os.Stdin
+	if path != "" && path != "-" {
+		ff, err := os.Open(path)
+		if err != nil {
+			fail("Error opening file: %s", err)
+		}
+		defer ff.Close()
+		f = ff
+	} else if path == "" && !stdinIsPipe() {
+		fail("annotate needs a cpu profile from an argument, --profile or stdin")
+	}
+
+	profile := root.parseProfile(f, root.Input)
+	sources, err := source.Files(cmd.SourceDir)
+	if err != nil {
+		fail("Error listing source files: %s", err)
+	}
+	files, err := annotate.Analyze(profile, root.analyzeOptions(), sources)
+	if err != nil {
+		fail("Error analyzing profile: %s", err)
+	}
+	if len(files) == 0 {
+		fail("no sample in the files of %s, is it the module the profile was recorded from?", cmd.SourceDir)
+	}
+	if root.Top > 0 && len(files) > root.Top {
+		files = files[:root.Top]
+	}
+
+	written, err := annotate.Export(cmd.SourceDir, cmd.Out, files, root.theme())
+	for _, path := range written {
+		fmt.Println(path)
+	}
+	if err != nil {
+		fail("Error writing annotated sources: %s", err)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+
+	"github.com/kmrgirish/pprof-adv/internal/attraudit"
+)
+
+type AttrAuditCmd struct {
+	Profile string `arg:"positional" help:"profile to audit, defaults to --profile, --apm or stdin"`
+}
+
+// run classifies every function of the profile of the positional argument,
+// --profile, the --apm service or stdin as attributable or user under the
+// attribution policy, with the cpu each classification moves.
+func (cmd *AttrAuditCmd) run(root *Cmd) {
+	profile, _ := root.loadProfile(cmd.Profile, "attr-audit")
+	profile = root.sample(profile)
+	audit, err := attraudit.Analyze(profile, root.analyzeOptions())
+	if err != nil {
+		fail("Error auditing profile: %s", err)
+	}
+	audit.Write(os.Stdout, root.Top, root.style())
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/kmrgirish/pprof-adv/internal/batch"
+	"github.com/kmrgirish/pprof-adv/internal/theme"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+type BatchCmd struct {
+	Dir  string `arg:"--dir,required" help:"directory searched recursively for profiles"`
+	Out  string `arg:"--out"          help:"directory to write one report per profile and an index.html to" default:"reports"`
+	Jobs int    `arg:"--jobs"         help:"number of profiles analyzed in parallel (default: number of cpus)"`
+}
+
+func (cmd *BatchCmd) run(opts pb.AnalyzeOptions, top int, th theme.Theme) {
+	results, err := batch.Run(batch.Options{
+		Dir:     cmd.Dir,
+		Out:     cmd.Out,
+		Jobs:    cmd.Jobs,
+		Top:     top,
+		Analyze: opts,
+		Theme:   th,
+	})
+	if err != nil {
+		fail("Error running batch: %s", err)
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Printf("FAIL\t%s: %s\n", result.Input, result.Err)
+			continue
+		}
+		fmt.Printf("ok\t%s\n", result.Input)
+	}
+	fmt.Printf("Wrote %d reports to %s\n", len(results)-failed, cmd.Out)
+
+	if failed > 0 {
+		fail("%d profiles failed\n", failed)
+	}
+}
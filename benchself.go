@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/bench"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+type BenchSelfCmd struct {
+	Samples int   `arg:"--samples" help:"number of samples of the synthetic profile" default:"1000000"`
+	Stacks  int   `arg:"--stacks"  help:"number of distinct stacks of the synthetic profile" default:"20000"`
+	Seed    int64 `arg:"--seed"    help:"seed of the synthetic profile" default:"1"`
+}
+
+// run reports the throughput of the analyzers on a synthetic profile, to
+// compare builds before and after performance changes.
+func (cmd *BenchSelfCmd) run() {
+	opts := bench.DefaultOptions
+	opts.Samples, opts.Stacks, opts.Seed = cmd.Samples, cmd.Stacks, cmd.Seed
+	if opts.Samples <= 0 || opts.Stacks <= 1 {
+		fail("--samples must be positive and --stacks greater than 1")
+	}
+
+	start := time.Now()
+	profile := bench.Profile(opts)
+	stats := pb.ProfileStats(profile)
+	fmt.Printf("profile\t%d samples, %d distinct stacks, %d functions, %.1f average depth, generated in %s\n\n", stats.Samples, stats.Stacks, stats.Functions, stats.AvgDepth, time.Since(start).Round(time.Millisecond))
+
+	results, err := bench.Run(profile, bench.Cases)
+	if err != nil {
+		fail("Error running benchmarks: %s", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "case\ttime/op\tsamples/s\tallocs/op\tbytes/op")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%.0f\t%d\t%d\n", r.Case, time.Duration(r.NsPerOp()).Round(time.Microsecond), r.SamplesPerSecond(), r.AllocsPerOp(), r.AllocedBytesPerOp())
+	}
+	w.Flush()
+}
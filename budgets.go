@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/kmrgirish/pprof-adv/internal/budget"
+)
+
+type BudgetsCmd struct {
+	SyncDatadog *BudgetsSyncDatadogCmd `arg:"subcommand:sync-datadog" help:"create or update a Datadog monitor for every budget, so breaches alert even when nobody runs pprof-adv"`
+}
+
+type BudgetsSyncDatadogCmd struct {
+	Budgets string `arg:"--budgets" help:"budgets.yaml with the most cores each function of a service may use" default:"budgets.yaml"`
+	DryRun  bool   `arg:"--dry-run" help:"print the monitors that would be created or updated without changing them"`
+}
+
+func (cmd *BudgetsCmd) run(root *Cmd) {
+	if cmd.SyncDatadog == nil {
+		fail("budgets requires a subcommand, e.g. budgets sync-datadog")
+	}
+	cmd.SyncDatadog.run(root)
+}
+
+// run creates the monitors of the budgets that do not exist and updates the
+// ones that changed, finding them by their tag or name so that running it
+// again changes nothing.
+func (cmd *BudgetsSyncDatadogCmd) run(root *Cmd) {
+	f, err := os.Open(cmd.Budgets)
+	if err != nil {
+		fail("Error opening budgets: %s", err)
+	}
+	budgets, err := budget.Parse(f)
+	f.Close()
+	if err != nil {
+		fail("Error parsing %s: %s", cmd.Budgets, err)
+	}
+
+	changes, err := root.newClient().SyncMonitors(context.Background(), budgets.Monitors(), budget.Tag, cmd.DryRun)
+	for _, c := range changes {
+		action := c.Action
+		if cmd.DryRun && action != "unchanged" {
+			action = "would " + action
+		}
+		if c.Monitor.ID != 0 {
+			fmt.Printf("%s\t%s (monitor %d)\n", action, c.Monitor.Name, c.Monitor.ID)
+		} else {
+			fmt.Printf("%s\t%s\n", action, c.Monitor.Name)
+		}
+	}
+	if err != nil {
+		fail("Error syncing monitors: %s", err)
+	}
+}
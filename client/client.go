@@ -0,0 +1,198 @@
+// Package client is a typed client of the HTTP API of pprof-adv serve, whose
+// OpenAPI definition the server serves at /openapi.json.
+//
+// Example:
+//
+//	c, err := client.New("https://pprof.example.com", os.Getenv("PPROF_ADV_TOKEN"))
+//	if err != nil {
+//		// Handle error
+//	}
+//	entries, err := c.Ingest(ctx, "cpu.pprof", map[string]string{"service": "api", "team": "payments"}, data)
+//	report, err := c.Report(ctx, client.Filter{Team: "payments"})
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/version"
+)
+
+// Entry describes a stored profile.
+type Entry struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"` // file name the profile was uploaded as
+	Received time.Time         `json:"received"`
+	Size     int               `json:"size"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	// Fingerprint is the hash of the contents of the profile, the same for
+	// the same profile in any encoding.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// Namespace is a service, env and team that profiles are tagged with, along
+// with the number of stored profiles tagged with them.
+type Namespace struct {
+	Service  string `json:"service,omitempty"`
+	Env      string `json:"env,omitempty"`
+	Team     string `json:"team,omitempty"`
+	Profiles int    `json:"profiles"`
+}
+
+// Filter selects the profiles of a namespace, empty fields match any value.
+type Filter struct {
+	Service string
+	Env     string
+	Team    string
+}
+
+// query returns the filter as query parameters.
+func (f Filter) query() url.Values {
+	values := make(url.Values)
+	for key, value := range map[string]string{"service": f.Service, "env": f.Env, "team": f.Team} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	return values
+}
+
+// Error is the response of a failed request.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Client is a client of a pprof-adv server.
+type Client struct {
+	base  *url.URL
+	token string
+
+	// HTTPClient makes the requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// New creates a client of the server at baseURL. The token authenticates the
+// requests if the server requires it, it may be empty otherwise.
+func New(baseURL, token string) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/")
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("invalid server url %q, expected http or https", baseURL)
+	}
+	return &Client{base: base, token: token}, nil
+}
+
+// Ingest uploads a pprof, possibly gzip compressed, or a zip archive of .pprof
+// files as downloaded from Datadog, tagged with the tags, e.g. service, env
+// and team. It returns the entries of the stored profiles.
+func (c *Client) Ingest(ctx context.Context, name string, tags map[string]string, data []byte) ([]Entry, error) {
+	query := make(url.Values)
+	for key, value := range tags {
+		query.Set(key, value)
+	}
+	if name != "" {
+		query.Set("name", name)
+	}
+	var entries []Entry
+	err := c.do(ctx, http.MethodPost, "ingest", query, data, &entries)
+	return entries, err
+}
+
+// Profiles returns the entries of the stored profiles passing the filter, most
+// recent first.
+func (c *Client) Profiles(ctx context.Context, f Filter) ([]Entry, error) {
+	var entries []Entry
+	err := c.do(ctx, http.MethodGet, "api/profiles", f.query(), nil, &entries)
+	return entries, err
+}
+
+// Namespaces returns the namespaces of the stored profiles passing the filter,
+// by service, env and team.
+func (c *Client) Namespaces(ctx context.Context, f Filter) ([]Namespace, error) {
+	var namespaces []Namespace
+	err := c.do(ctx, http.MethodGet, "api/namespaces", f.query(), nil, &namespaces)
+	return namespaces, err
+}
+
+// Report returns the text report of the attributed cpu of every function of
+// the stored cpu profiles passing the filter.
+func (c *Client) Report(ctx context.Context, f Filter) (string, error) {
+	var report []byte
+	err := c.do(ctx, http.MethodGet, "report", f.query(), nil, &report)
+	return string(report), err
+}
+
+// ProfileReport returns the text report of the stored profile with the id.
+func (c *Client) ProfileReport(ctx context.Context, id string) (string, error) {
+	var report []byte
+	err := c.do(ctx, http.MethodGet, "profiles/"+url.PathEscape(id), nil, nil, &report)
+	return string(report), err
+}
+
+// Profile returns the stored profile with the id as it was uploaded.
+func (c *Client) Profile(ctx context.Context, id string) ([]byte, error) {
+	var data []byte
+	err := c.do(ctx, http.MethodGet, "profiles/"+url.PathEscape(id)+"/raw", nil, nil, &data)
+	return data, err
+}
+
+// do sends a request to the path, relative to the base url, and decodes the
+// response into out, which is either a *[]byte for the raw body or decoded
+// from JSON.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body []byte, out any) error {
+	u := c.base.JoinPath(path)
+	u.RawQuery = query.Encode()
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return &Error{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(data))}
+	}
+
+	if raw, ok := out.(*[]byte); ok {
+		*raw = data
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
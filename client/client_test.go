@@ -0,0 +1,94 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/internal/server"
+	"github.com/kmrgirish/pprof-adv/internal/store"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func testProfile(t *testing.T, name string) []byte {
+	t.Helper()
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: name, FileName: "main.go"}, {Name: "main.main", FileName: "main.go"}}, []int64{100}, nil)
+	var buf bytes.Buffer
+	if err := pb.Write(&buf, b.Profile()); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestClient(t *testing.T) {
+	st, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	analyzer, err := pb.NewAnalyzer(pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := server.New(st, analyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Auth = &server.Auth{Tokens: []string{"secret"}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	ctx := context.Background()
+	c, err := New(ts.URL, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := c.Ingest(ctx, "cpu.pprof", map[string]string{"service": "api", "team": "payments"}, testProfile(t, "main.charge"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name != "cpu.pprof" || entries[0].Tags["team"] != "payments" {
+		t.Fatalf("Expected cpu.pprof of payments, got %+v", entries)
+	}
+	if _, err := c.Ingest(ctx, "", map[string]string{"service": "web", "team": "frontend"}, testProfile(t, "main.render")); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := c.Profiles(ctx, Filter{Team: "payments"})
+	if err != nil || len(profiles) != 1 || profiles[0].ID != entries[0].ID {
+		t.Errorf("Expected the profile of payments, got %+v: %v", profiles, err)
+	}
+	namespaces, err := c.Namespaces(ctx, Filter{})
+	if err != nil || len(namespaces) != 2 || namespaces[0] != (Namespace{Service: "api", Team: "payments", Profiles: 1}) {
+		t.Errorf("Expected the namespaces of api and web, got %+v: %v", namespaces, err)
+	}
+	report, err := c.Report(ctx, Filter{Service: "web"})
+	if err != nil || !strings.Contains(report, "main.render") || strings.Contains(report, "main.charge") {
+		t.Errorf("Expected the report of web, got %q: %v", report, err)
+	}
+	report, err = c.ProfileReport(ctx, entries[0].ID)
+	if err != nil || !strings.Contains(report, "main.charge") {
+		t.Errorf("Expected the report of the profile, got %q: %v", report, err)
+	}
+	data, err := c.Profile(ctx, entries[0].ID)
+	if _, perr := pb.Parse(bytes.NewReader(data)); err != nil || perr != nil {
+		t.Errorf("Expected the raw profile, got %v, %v", err, perr)
+	}
+
+	var apiErr *Error
+	if _, err := c.Profile(ctx, "missing"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 error, got %v", err)
+	}
+	unauthenticated, _ := New(ts.URL+"/", "")
+	if _, err := unauthenticated.Profiles(ctx, Filter{}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected a 401 error, got %v", err)
+	}
+
+	if _, err := New("ftp://example.com", ""); err == nil {
+		t.Error("Expected error for ftp url, got nil")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kmrgirish/pprof-adv/internal/diff"
+)
+
+type CompareEnvsCmd struct {
+	Environments string  `arg:"--environments,required" help:"comma separated environments of the --apm service to compare, the first one is the baseline (e.g. staging,production)"`
+	Threshold    float64 `arg:"--threshold"             help:"flag functions whose share of cpu differs by at least this many percentage points" default:"5"`
+}
+
+// run fetches the profile of the --apm service in every environment and
+// compares the share of cpu of each function to the first environment, as
+// absolute usage depends on the traffic of each environment.
+func (cmd *CompareEnvsCmd) run(root *Cmd) {
+	if root.Service == "" {
+		fail("compare-envs needs the service to fetch profiles of with --apm")
+	}
+	var envs []string
+	for _, env := range strings.Split(cmd.Environments, ",") {
+		if env = strings.TrimSpace(env); env != "" {
+			envs = append(envs, env)
+		}
+	}
+	if len(envs) < 2 {
+		fail("compare-envs needs at least two --environments, got %q", cmd.Environments)
+	}
+
+	baseInfo, r, format := root.download(envs[0])
+	base := root.parseProfile(r, format)
+	style := root.style()
+	var warnings []string
+	for _, env := range envs[1:] {
+		info, r, format := root.download(env)
+		profile := root.parseProfile(r, format)
+		result, err := diff.DiffShares(base, profile, root.analyzeOptions())
+		if err != nil {
+			fail("Error comparing %s to %s: %s", env, envs[0], err)
+		}
+
+		fmt.Printf("== env:%s vs env:%s\n", env, envs[0])
+		fmt.Printf("base\t%s\n", baseInfo)
+		fmt.Printf("new\t%s\n", info)
+		result.Write(os.Stdout, root.Top, style)
+		for _, fn := range result.Divergent(cmd.Threshold) {
+			warnings = append(warnings, fmt.Sprintf("warning: %s is %.2f%% of cpu in %s and %.2f%% in %s\n", style.Name(fn.Name), fn.New, env, fn.Base, envs[0]))
+		}
+	}
+	for _, warning := range warnings {
+		fmt.Print(warning)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/kmrgirish/pprof-adv/internal/deps"
+)
+
+type DepsCmd struct {
+	Profile      string `arg:"positional"      help:"profile to analyze, defaults to --profile, --apm or stdin"`
+	CheckUpdates bool   `arg:"--check-updates" help:"look up newer releases of the reported modules in the module proxy of GOPROXY and report how far behind they are"`
+}
+
+// run ranks the dependencies of the profile of the positional argument,
+// --profile, the --apm service or stdin by the attributed cpu of their
+// functions.
+func (cmd *DepsCmd) run(root *Cmd) {
+	profile, _ := root.loadProfile(cmd.Profile, "deps")
+	profile = root.sample(profile)
+	modules, err := deps.Transform(profile, os.Stdout, root.analyzeOptions(), root.Top, root.style())
+	if err != nil {
+		fail("Error transforming profile: %s", err)
+	}
+	if cmd.CheckUpdates {
+		checkUpdates(modules)
+	}
+}
+
+// checkUpdates reports which of the modules have newer releases in the module
+// proxy.
+func checkUpdates(modules []*deps.Module) {
+	proxy, err := deps.ProxyFromEnv(os.Getenv("GOPROXY"))
+	if err != nil {
+		fail("Error checking for updates: %s", err)
+	}
+	outdated, err := proxy.Updates(context.Background(), modules)
+	if err != nil {
+		fail("Error checking for updates: %s", err)
+	}
+	if len(outdated) == 0 {
+		fmt.Println("\nall hot dependencies are up to date")
+		return
+	}
+	fmt.Println()
+	for _, o := range outdated {
+		fmt.Println(o)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/diff"
+	"github.com/kmrgirish/pprof-adv/internal/input"
+	"github.com/kmrgirish/pprof-adv/internal/kernel"
+	"github.com/kmrgirish/pprof-adv/internal/theme"
+	"github.com/kmrgirish/pprof-adv/pb"
+	"github.com/kmrgirish/pprof-adv/profiler"
+)
+
+type DiffCmd struct {
+	Profiles     []string      `arg:"positional"      help:"profiles to compare, the first one is the baseline, or more than two for the trend of every function across them in the order they were recorded"`
+	Flamegraph   string        `arg:"--flamegraph"    help:"also write a differential flamegraph, red frames grew and blue ones shrank, to this .svg or .html file"`
+	Deploy       bool          `arg:"--deploy"        help:"compare the top profiles of the --apm service before and after its latest Datadog deployment event"`
+	DeployAt     string        `arg:"--deploy-at"     help:"compare the top profiles of the --apm service before and after a deploy at this time, RFC 3339 or unix seconds"`
+	DeployWindow time.Duration `arg:"--deploy-window" help:"how long before and after the deploy to search profiles in" default:"1h"`
+}
+
+// diffSource is one side of a diff.
+type diffSource struct {
+	label   string
+	profile *pb.Profile
+}
+
+// run compares two profiles, which are, in order, the profile of the --apm
+// service, the --profile and the positional profiles. Mixing a remote and a
+// local profile compares e.g. a laptop benchmark to production, with the
+// production profile as the baseline. More profiles are compared as a trend.
+// With --deploy or --deploy-at the profiles of the --apm service before and
+// after the deploy are compared instead.
+func (cmd *DiffCmd) run(root *Cmd) {
+	var sources []diffSource
+	if cmd.Deploy || cmd.DeployAt != "" {
+		sources = cmd.deploySources(root)
+	} else if root.Service != "" {
+		info, r, format := root.download(root.Environment)
+		sources = append(sources, diffSource{fmt.Sprintf("env:%s %s", root.Environment, info), root.parseDownload(info, r, format)})
+	}
+	paths := cmd.Profiles
+	if root.Profile != "" {
+		paths = append([]string{root.Profile}, paths...)
+	}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			fail("Error opening file: %s", err)
+		}
+		sources = append(sources, diffSource{path, root.parseProfile(f, root.Input)})
+		f.Close()
+	}
+	if len(sources) > 2 {
+		cmd.trend(root, sources)
+		return
+	}
+	if len(sources) != 2 {
+		fail("diff needs at least two profiles from --apm, --profile or arguments, got %d", len(sources))
+	}
+
+	base, profile := sources[0], sources[1]
+	result, err := diff.Diff(base.profile, profile.profile, root.analyzeOptions())
+	if err != nil {
+		fail("Error comparing profiles: %s", err)
+	}
+	fmt.Printf("base\t%s (%s)\n", base.label, diff.Duration(base.profile))
+	fmt.Printf("new\t%s (%s)\n", profile.label, diff.Duration(profile.profile))
+	result.Write(os.Stdout, root.Top, root.style())
+
+	if cmd.Flamegraph != "" {
+		writeFlamegraph(cmd.Flamegraph, base, profile, root.analyzeOptions(), root.theme())
+	}
+}
+
+// deploySources returns the top profiles of the --apm service in the
+// --deploy-window before and after the deploy, which is at --deploy-at or the
+// latest deployment event of the service.
+func (cmd *DiffCmd) deploySources(root *Cmd) []diffSource {
+	if root.Service == "" {
+		fail("--deploy and --deploy-at need the --apm service")
+	}
+	if cmd.DeployWindow <= 0 {
+		fail("--deploy-window must be positive, got %s", cmd.DeployWindow)
+	}
+
+	var at time.Time
+	what := "deploy"
+	if cmd.DeployAt != "" {
+		var err error
+		if at, err = parseTimestamp(cmd.DeployAt); err != nil {
+			fail("Error parsing --deploy-at: %s", err)
+		}
+	} else {
+		client := root.newClient()
+		// A week back is plenty to find the latest deploy.
+		now := time.Now()
+		deploys, err := client.DeployEvents(context.Background(), root.Service, root.Environment, now.Add(-7*24*time.Hour), now)
+		if err != nil {
+			fail("Error getting deploy events: %s", err)
+		}
+		if len(deploys) == 0 {
+			fail("no deployment events of service:%s env:%s in the last week, pass --deploy-at", root.Service, root.Environment)
+		}
+		at, what = deploys[0].Time(), fmt.Sprintf("deploy %q", deploys[0].Title)
+	}
+	if time.Since(at) <= 0 {
+		fail("the deploy at %s is in the future", at.UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintf(os.Stderr, "Comparing %s before and after the %s at %s\n", cmd.DeployWindow, what, at.UTC().Format(time.RFC3339))
+
+	var sources []diffSource
+	for _, side := range []struct {
+		label    string
+		from, to time.Time
+	}{
+		{"before", at.Add(-cmd.DeployWindow), at},
+		{"after", at, at.Add(cmd.DeployWindow)},
+	} {
+		info, r, format := root.downloadBetween(root.Environment, side.from, side.to)
+		sources = append(sources, diffSource{fmt.Sprintf("%s %s: env:%s %s", side.label, what, root.Environment, info), root.parseDownload(info, r, format)})
+	}
+	return sources
+}
+
+// parseTimestamp parses an RFC 3339 time or unix seconds.
+func parseTimestamp(s string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// trend writes the trend of every function across the sources, ordered by
+// the time they were recorded when they all tell it.
+func (cmd *DiffCmd) trend(root *Cmd, sources []diffSource) {
+	if cmd.Flamegraph != "" {
+		fail("--flamegraph compares two profiles, got %d", len(sources))
+	}
+	timed := true
+	for _, source := range sources {
+		timed = timed && source.profile.TimeNanos > 0
+	}
+	if timed {
+		sort.SliceStable(sources, func(i, j int) bool { return sources[i].profile.TimeNanos < sources[j].profile.TimeNanos })
+	}
+
+	profiles := make([]*pb.Profile, len(sources))
+	for i, source := range sources {
+		profiles[i] = source.profile
+		fmt.Printf("%d\t%s (%s)\n", i+1, source.label, diff.Duration(source.profile))
+	}
+	trend, err := diff.Trends(profiles, root.analyzeOptions())
+	if err != nil {
+		fail("Error comparing profiles: %s", err)
+	}
+	trend.Write(os.Stdout, root.Top, root.style())
+}
+
+// writeFlamegraph writes the differential flamegraph of the sources to path,
+// as HTML if its extension is .html and as SVG otherwise.
+func writeFlamegraph(path string, base, profile diffSource, opts pb.AnalyzeOptions, th theme.Theme) {
+	flame, err := diff.DiffFlame(base.profile, profile.profile, opts)
+	if err != nil {
+		fail("Error comparing profiles: %s", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		fail("Error creating %s: %s", path, err)
+	}
+	title := fmt.Sprintf("%s -> %s", base.label, profile.label)
+	if strings.EqualFold(filepath.Ext(path), ".html") {
+		err = flame.WriteHTML(f, title, th)
+	} else {
+		err = flame.WriteSVG(f, title, th)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fail("Error writing %s: %s", path, err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+}
+
+// parseProfile parses a profile in the input format, exiting on errors, and
+// applies --trim-paths, --kallsyms and --fold-kernel.
+func (cmd *Cmd) parseProfile(r io.Reader, format string) *pb.Profile {
+	profile, err := input.Parse(r, format)
+	if err != nil {
+		fail("Error parsing file: %s", err)
+	}
+	if cmd.TrimPaths {
+		pb.TrimPaths(profile)
+	}
+	if cmd.Kallsyms != "" {
+		symbols, err := kernel.Load(cmd.Kallsyms)
+		if err != nil {
+			fail("Error reading --kallsyms: %s", err)
+		}
+		pb.SymbolizeKernel(profile, symbols.Lookup)
+	}
+	if cmd.FoldKernel {
+		pb.FoldKernel(profile)
+	}
+	return profile
+}
+
+// parseDownload is parseProfile for a profile downloaded from Datadog, whose
+// duration is that of its search result or event when it records none, so
+// that profiles of different durations compare by rate.
+func (cmd *Cmd) parseDownload(info *profiler.SearchProfile, r io.Reader, format string) *pb.Profile {
+	profile := cmd.parseProfile(r, format)
+	if profile.DurationNanos == 0 {
+		profile.DurationNanos = info.Duration.Nanoseconds()
+	}
+	return profile
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/profiler"
+)
+
+type DoctorCmd struct{}
+
+// run checks the Datadog credentials and site, printing one line per check
+// in the format of selftest and failing if any check fails.
+func (cmd *DoctorCmd) run(apiKey, appKey, configured string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	failed := 0
+	check := func(err error, ok string) {
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL\t%s\n", err)
+			return
+		}
+		fmt.Printf("ok\t%s\n", ok)
+	}
+	defer func() {
+		if failed > 0 {
+			fail("%d checks failed\n", failed)
+		}
+	}()
+
+	if apiKey == "" {
+		check(errors.New("DD_API_KEY is not set"), "")
+		return
+	}
+	site, err := cmd.site(ctx, apiKey, configured)
+	check(err, "the API key belongs to "+site)
+	if err != nil {
+		return
+	}
+
+	if appKey == "" {
+		check(errors.New("DD_APP_KEY is not set, it is needed to search and download profiles"), "")
+		return
+	}
+	client, err := profiler.NewClient(apiKey, appKey, site)
+	if err != nil {
+		check(err, "")
+		return
+	}
+	key, err := client.ApplicationKey(ctx)
+	switch {
+	case err != nil:
+		check(err, "")
+	case key == nil:
+		fmt.Printf("skip\tthe application key is not one of the current user's, its scopes cannot be checked\n")
+	case key.Scopes == nil:
+		check(nil, fmt.Sprintf("the application key %q is not scoped", key.Name))
+	case len(key.MissingScopes()) > 0:
+		check(fmt.Errorf("the application key %q lacks the scopes %s", key.Name, strings.Join(key.MissingScopes(), ", ")), "")
+	default:
+		check(nil, fmt.Sprintf("the application key %q has the scopes %s", key.Name, strings.Join(profiler.ProfileScopes, ", ")))
+	}
+
+	_, err = client.SearchProfiles(ctx, profiler.SearchQuery{
+		Filter: profiler.SearchFilter{
+			From: profiler.JSONTime{Time: time.Now().Add(-time.Hour)},
+			To:   profiler.JSONTime{Time: time.Now()},
+		},
+		Limit: 1,
+	})
+	if errors.Is(err, profiler.ErrNoProfiles) {
+		err = nil
+	}
+	check(err, "profiles can be searched")
+}
+
+// site returns the site the API key belongs to, or an error telling how to
+// set DD_SITE if it is not the configured one, "" for the default site.
+func (cmd *DoctorCmd) site(ctx context.Context, apiKey, configured string) (string, error) {
+	sites, err := profiler.DetectSites(ctx, apiKey)
+	if err != nil {
+		return "", fmt.Errorf("validating the API key: %w", err)
+	}
+	if len(sites) == 0 {
+		return "", fmt.Errorf("the API key is not valid on any of the Datadog sites %s", strings.Join(profiler.Sites, ", "))
+	}
+
+	if configured == "" {
+		configured = profiler.Sites[0]
+	}
+	if slices.Contains(sites, configured) {
+		return configured, nil
+	}
+	return sites[0], fmt.Errorf("the API key belongs to %s, not the configured %s, export DD_SITE=%s or set the site of the --dd-profile", sites[0], configured, sites[0])
+}
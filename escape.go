@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/kmrgirish/pprof-adv/internal/escape"
+)
+
+type EscapeCmd struct {
+	Profile   string `arg:"positional"   help:"heap profile to analyze, defaults to --profile or stdin"`
+	SourceDir string `arg:"--source-dir" help:"root of the module the profile was recorded from, its hot packages are built with -gcflags=-m" default:"."`
+}
+
+// run ranks the heap escapes reported by the compiler for the source
+// directory by the allocations of the profile on their lines.
+func (cmd *EscapeCmd) run(root *Cmd) {
+	path := cmd.Profile
+	if path == "" {
+		path = root.Profile
+	}
+
+	f := os.Stdin
+	if path != "" && path != "-" {
+		ff, err := os.Open(path)
+		if err != nil {
+			fail("Error opening file: %s", err)
+		}
+		defer ff.Close()
+		f = ff
+	} else if path == "" && !stdinIsPipe() {
+		fail("escape needs a heap profile from an argument, --profile or stdin")
+	}
+
+	profile := root.parseProfile(f, root.Input)
+	fixes, err := escape.Analyze(context.Background(), profile, cmd.SourceDir, root.SampleType, root.Top)
+	if err != nil {
+		fail("Error analyzing escapes: %s", err)
+	}
+	if len(fixes) == 0 {
+		fail("no heap escapes reported on the lines of the top %d allocation sites\n", root.Top)
+	}
+	escape.Write(os.Stdout, fixes, root.style())
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/event"
+	"github.com/kmrgirish/pprof-adv/internal/seal"
+	"github.com/kmrgirish/pprof-adv/internal/store"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// eventTop is the number of functions listed by events.
+const eventTop = 10
+
+// postEvent posts a Datadog event summarizing the cpu profile, comparing it to
+// the previous run for the same --apm service or profile path, and saves it
+// as the previous run of the next one.
+func (cmd *Cmd) postEvent(profile *pb.Profile) {
+	nodes, err := pb.AnalyzeCPUProfile(profile, cmd.analyzeOptions())
+	if err != nil {
+		fail("Error analyzing profile: %s", err)
+	}
+
+	source, tags := cmd.source(cmd.Profile)
+	c := cmd.loadCipher()
+	dir := cacheDir("events")
+	prev, err := event.Load(dir, source, c)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: ignoring previous run of %s: %s\n", source, err)
+	}
+	run := event.Summarize(source, nodes, time.Now())
+
+	client := cmd.newClient()
+	if err := client.PostEvent(context.Background(), run.Event(prev, eventTop, tags)); err != nil {
+		fail("Error: %s", err)
+	}
+	if err := run.Save(dir, c); err != nil {
+		fail("Error saving run: %s", err)
+	}
+}
+
+// source names the profile at path, or of the --apm service if path is
+// empty, for comparing runs on it. It also returns the Datadog tags of the
+// service.
+func (cmd *Cmd) source(path string) (string, []string) {
+	switch {
+	case cmd.Service != "" && path == "":
+		return fmt.Sprintf("service:%s env:%s", cmd.Service, cmd.Environment), []string{"service:" + cmd.Service, "env:" + cmd.Environment}
+	case path != "" && path != "-":
+		if source, err := filepath.Abs(path); err == nil {
+			return source, nil
+		}
+		return path, nil
+	default:
+		return "stdin", nil
+	}
+}
+
+// loadCipher returns the cipher of the key of the user, nil if none is
+// configured, exiting on invalid keys. It reads data stored in the clear only
+// with --allow-plaintext.
+func (cmd *Cmd) loadCipher() *seal.Cipher {
+	c, err := seal.Load()
+	if err != nil {
+		fail("Invalid encryption key: %s", err)
+	}
+	if c != nil && cmd.AllowPlaintext {
+		c.AllowPlaintext()
+	}
+	return c
+}
+
+// cacheMaxAge is how long the previous runs in the user's cache are kept
+// without being updated, e.g. the runs of services that no longer exist.
+const cacheMaxAge = 90 * 24 * time.Hour
+
+// cacheDir returns the directory of the user's cache the previous runs of a
+// feature are kept in, pruning the runs older than cacheMaxAge.
+func cacheDir(name string) string {
+	dir := filepath.Join(cacheRoot(), name)
+	if _, err := store.PruneDir(dir, store.Retention{MaxAge: cacheMaxAge}, time.Now(), false); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: pruning %s: %s\n", dir, err)
+	}
+	return dir
+}
+
+// cacheRoot returns the directory of the user's cache of pprof-adv.
+func cacheRoot() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		fail("Error finding cache directory: %s", err)
+	}
+	return filepath.Join(dir, "pprof-adv")
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/event"
+	"github.com/kmrgirish/pprof-adv/internal/issues"
+	"github.com/kmrgirish/pprof-adv/internal/source"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+type ExportIssuesCmd struct {
+	Profile      string  `arg:"positional"                      help:"cpu profile to analyze, defaults to --profile, --apm or stdin"`
+	Tracker      string  `arg:"--tracker"                       help:"issue tracker to file issues in (github)" default:"github"`
+	Repo         string  `arg:"--repo"                          help:"repository to file issues in, e.g. org/repo"`
+	Token        string  `arg:"--github-token,env:GITHUB_TOKEN" help:"GitHub token allowed to create issues in --repo"`
+	APIURL       string  `arg:"--api-url"                       help:"url of the GitHub api, e.g. of a GitHub Enterprise server" default:"https://api.github.com"`
+	DryRun       bool    `arg:"--dry-run"                       help:"print the issues instead of filing them"`
+	SourceDir    string  `arg:"--source-dir"                    help:"root of the repository, whose CODEOWNERS maps hotspots to owners" default:"."`
+	CodeOwners   string  `arg:"--codeowners"                    help:"CODEOWNERS file mapping files to owners (default: CODEOWNERS, .github/CODEOWNERS or docs/CODEOWNERS of --source-dir)"`
+	Cores        float64 `arg:"--cores"                         help:"cpu cores used by the service to estimate the cost of hotspots, defaults to the cores of the --apm profile"`
+	CoreHourCost float64 `arg:"--core-hour-cost"                help:"cost in dollars of a cpu core for an hour to estimate the cost of hotspots" default:"0.05"`
+}
+
+// run files an issue for every function that entered the top --top functions
+// since the previous export of the same source. Hotspots with an open issue
+// are skipped, the previous top is only updated once every issue is filed.
+func (cmd *ExportIssuesCmd) run(root *Cmd) {
+	if cmd.Tracker != "github" {
+		fail("unsupported tracker %q, only github is supported", cmd.Tracker)
+	}
+	if cmd.Repo == "" && !cmd.DryRun {
+		fail("export-issues needs a --repo to file issues in")
+	}
+
+	profile, info := root.loadProfile(cmd.Profile, "export-issues")
+	if info != nil && cmd.Cores == 0 {
+		cmd.Cores = info.CPUCores
+	}
+	nodes, err := pb.AnalyzeCPUProfile(profile, root.analyzeOptions())
+	if err != nil {
+		fail("Error analyzing profile: %s", err)
+	}
+	hotspots := issues.Hotspots(profile, nodes, root.Top)
+	cmd.setOwners(hotspots)
+
+	name, _ := root.source(cmd.Profile)
+	c := root.loadCipher()
+	dir := cacheDir("issues")
+	prev, err := event.Load(dir, name, c)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: ignoring previous export of %s: %s\n", name, err)
+	}
+	run := event.Summarize(name, nodes, time.Now())
+
+	fresh := issues.New(hotspots, prev)
+	if cmd.DryRun {
+		for _, h := range fresh {
+			issue := h.Issue(name, cmd.Cores, cmd.CoreHourCost)
+			fmt.Printf("# %s\n\n%s\n", issue.Title, issue.Body)
+		}
+		fmt.Fprintf(os.Stderr, "%d new hotspots in the top %d, dry run filed no issues\n", len(fresh), root.Top)
+		return
+	}
+
+	ctx := context.Background()
+	github := &issues.GitHub{URL: cmd.APIURL, Repo: cmd.Repo, Token: cmd.Token}
+	open, err := github.OpenTitles(ctx, issues.Label)
+	if err != nil {
+		fail("Error listing issues of %s: %s", cmd.Repo, err)
+	}
+	for _, h := range fresh {
+		issue := h.Issue(name, cmd.Cores, cmd.CoreHourCost)
+		if open[issue.Title] {
+			fmt.Printf("open\t%s\n", issue.Title)
+			continue
+		}
+		url, err := github.Create(ctx, issue)
+		if err != nil {
+			fail("Error filing %q: %s", issue.Title, err)
+		}
+		fmt.Printf("filed\t%s\t%s\n", issue.Title, url)
+	}
+	if err := run.Save(dir, c); err != nil {
+		fail("Error saving run: %s", err)
+	}
+}
+
+// setOwners sets the owners of the hotspots from the CODEOWNERS of the
+// source directory, if any.
+func (cmd *ExportIssuesCmd) setOwners(hotspots []*issues.Hotspot) {
+	path := cmd.CodeOwners
+	if path == "" {
+		for _, candidate := range []string{"CODEOWNERS", ".github/CODEOWNERS", "docs/CODEOWNERS"} {
+			if _, err := os.Stat(filepath.Join(cmd.SourceDir, candidate)); err == nil {
+				path = filepath.Join(cmd.SourceDir, candidate)
+				break
+			}
+		}
+		if path == "" {
+			return
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		fail("Error opening file: %s", err)
+	}
+	defer f.Close()
+	owners, err := issues.ParseCodeOwners(f)
+	if err != nil {
+		fail("Error parsing %s: %s", path, err)
+	}
+	files, err := source.Files(cmd.SourceDir)
+	if err != nil {
+		fail("Error reading %s: %s", cmd.SourceDir, err)
+	}
+	for _, h := range hotspots {
+		if rel := source.Resolve(h.File, files); rel != "" {
+			h.Owners = owners.Owners(rel)
+		}
+	}
+}
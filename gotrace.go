@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+
+	"github.com/kmrgirish/pprof-adv/internal/gotrace"
+	"github.com/kmrgirish/pprof-adv/internal/input"
+)
+
+type TraceCmd struct {
+	Trace string `arg:"positional,required" help:"Go execution trace, e.g. written by runtime/trace or curl -o app.trace 'host:6060/debug/pprof/trace?seconds=5', - reads from stdin"`
+}
+
+// run breaks the running time of the goroutines of a Go execution trace down
+// by goroutine group, then by the functions of each group the cpu is
+// attributed to.
+func (cmd *TraceCmd) run(root *Cmd) {
+	f := os.Stdin
+	if cmd.Trace != "-" {
+		ff, err := os.Open(cmd.Trace)
+		if err != nil {
+			fail("Error opening file: %s", err)
+		}
+		defer ff.Close()
+		f = ff
+	}
+	r, err := input.Decompress(f)
+	if err != nil {
+		fail("Error reading trace: %s", err)
+	}
+	trace, err := gotrace.Read(r)
+	if err != nil {
+		fail("Error parsing trace: %s", err)
+	}
+	if err := gotrace.Write(os.Stdout, trace, root.analyzeOptions(), root.Top, root.style()); err != nil {
+		fail("Error transforming trace: %s", err)
+	}
+}
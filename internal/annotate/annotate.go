@@ -0,0 +1,262 @@
+// Package annotate writes copies of the hot source files of a profile with
+// the cpu of every line in the margin, as text and as HTML shaded by heat,
+// like the source view of kcachegrind.
+package annotate
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/kmrgirish/pprof-adv/internal/source"
+	"github.com/kmrgirish/pprof-adv/internal/theme"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Line is the cpu of a source line in percent of the profile.
+type Line struct {
+	Self  float64 // samples whose innermost frame is the line
+	Total float64 // samples with the line in their stack
+}
+
+// File is a source file of a profile.
+type File struct {
+	Path  string  // slash separated path relative to the source directory
+	Total float64 // percent of the samples with a line of the file in their stack
+	Lines map[int64]*Line
+}
+
+// Analyze returns the source files with samples, by descending total. Files
+// are slash separated paths relative to the source directory, see
+// source.Files. Inlined functions count at their own lines. Only the sample
+// type and the focus and ignore filters of the options apply.
+func Analyze(p *pb.Profile, opts pb.AnalyzeOptions, files []string) ([]*File, error) {
+	idx, err := pb.SampleTypeIndex(p, opts.SampleType)
+	if err != nil {
+		return nil, err
+	}
+
+	functions := make(map[uint64]*pb.Function, len(p.Function))
+	for _, fn := range p.Function {
+		functions[fn.Id] = fn
+	}
+	locations := make(map[uint64]*pb.Location, len(p.Location))
+	for _, loc := range p.Location {
+		locations[loc.Id] = loc
+	}
+	resolved := make(map[string]string)
+	resolve := func(file string) string {
+		if rel, exists := resolved[file]; exists {
+			return rel
+		}
+		rel := source.Resolve(file, files)
+		resolved[file] = rel
+		return rel
+	}
+
+	type key struct {
+		file string
+		line int64
+	}
+	byPath := make(map[string]*File)
+	var total float64
+	for i, frames := range pb.Frames(p) {
+		sample := p.Sample[i]
+		value := float64(sample.Value[idx])
+		total += value
+		if value == 0 || !pb.KeepFrames(frames, opts) {
+			continue
+		}
+
+		leaf := true
+		seen := make(map[key]bool)
+		seenFiles := make(map[string]bool)
+		for _, id := range sample.LocationId {
+			loc := locations[id]
+			if loc == nil {
+				continue
+			}
+			for _, line := range loc.Line {
+				fn := functions[line.FunctionId]
+				if fn == nil {
+					continue
+				}
+				self := leaf
+				leaf = false
+				rel := resolve(p.StringTable[fn.Filename])
+				if rel == "" {
+					continue
+				}
+				file := byPath[rel]
+				if file == nil {
+					file = &File{Path: rel, Lines: make(map[int64]*Line)}
+					byPath[rel] = file
+				}
+				l := file.Lines[line.Line]
+				if l == nil {
+					l = &Line{}
+					file.Lines[line.Line] = l
+				}
+				if self {
+					l.Self += value
+				}
+				if k := (key{rel, line.Line}); !seen[k] {
+					seen[k] = true
+					l.Total += value
+				}
+				if !seenFiles[rel] {
+					seenFiles[rel] = true
+					file.Total += value
+				}
+			}
+		}
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("no CPU time recorded in profile")
+	}
+
+	result := make([]*File, 0, len(byPath))
+	for _, file := range byPath {
+		file.Total = file.Total / total * 100
+		for _, l := range file.Lines {
+			l.Self = l.Self / total * 100
+			l.Total = l.Total / total * 100
+		}
+		result = append(result, file)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Total != result[j].Total {
+			return result[i].Total > result[j].Total
+		}
+		return result[i].Path < result[j].Path
+	})
+	return result, nil
+}
+
+// Export writes the annotated copies of the files of the source directory
+// into the out directory, at their path with a .txt and a .html extension,
+// and returns the paths it wrote.
+func Export(dir, out string, files []*File, th theme.Theme) ([]string, error) {
+	var written []string
+	for _, file := range files {
+		src, err := readLines(filepath.Join(dir, filepath.FromSlash(file.Path)))
+		if err != nil {
+			return written, err
+		}
+		base := filepath.Join(out, filepath.FromSlash(file.Path))
+		if err := os.MkdirAll(filepath.Dir(base), 0o755); err != nil {
+			return written, err
+		}
+		for _, output := range []struct {
+			ext   string
+			write func(io.Writer) error
+		}{
+			{".txt", func(w io.Writer) error { return WriteText(w, file, src) }},
+			{".html", func(w io.Writer) error { return WriteHTML(w, file, src, th) }},
+		} {
+			if err := writeFile(base+output.ext, output.write); err != nil {
+				return written, err
+			}
+			written = append(written, base+output.ext)
+		}
+	}
+	return written, nil
+}
+
+// WriteText writes the lines of the file's source with the self and total
+// cpu of each line in the margin, blank for lines without samples.
+func WriteText(w io.Writer, file *File, src []string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%6s %6s | %s (%.2f%%)\n", "self", "total", file.Path, file.Total)
+	for i, text := range src {
+		self, total := "", ""
+		if l := file.Lines[int64(i+1)]; l != nil {
+			self, total = percent(l.Self), percent(l.Total)
+		}
+		fmt.Fprintf(bw, "%6s %6s | %s\n", self, total, text)
+	}
+	return bw.Flush()
+}
+
+// percent formats a share of a line, blank if none.
+func percent(v float64) string {
+	if v == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
+type htmlLine struct {
+	Number      int
+	Self, Total string
+	Heat        float64
+	Text        string
+}
+
+// annotateHTML is the template of annotated source files.
+//
+//go:embed annotate.html
+var annotateHTML string
+
+var htmlTemplate = template.Must(template.New("annotate").Parse(annotateHTML))
+
+// WriteHTML writes the lines of the file's source in a table with the self
+// and total cpu of each line, shaded by their total relative to the hottest
+// line, styled by the theme.
+func WriteHTML(w io.Writer, file *File, src []string, th theme.Theme) error {
+	var hottest float64
+	for _, l := range file.Lines {
+		hottest = max(hottest, l.Total)
+	}
+
+	lines := make([]htmlLine, len(src))
+	for i, text := range src {
+		lines[i] = htmlLine{Number: i + 1, Text: text}
+		if l := file.Lines[int64(i+1)]; l != nil {
+			lines[i].Self, lines[i].Total = percent(l.Self), percent(l.Total)
+			if hottest > 0 {
+				lines[i].Heat = l.Total / hottest
+			}
+		}
+	}
+	return htmlTemplate.Execute(w, struct {
+		Path  string
+		Total float64
+		Lines []htmlLine
+		Theme theme.Theme
+	}{file.Path, file.Total, lines, th})
+}
+
+// readLines returns the lines of a file.
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// writeFile creates path with the output of write.
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
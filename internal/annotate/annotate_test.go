@@ -0,0 +1,62 @@
+package annotate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/internal/theme"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestAnalyze(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "strings.Index", FileName: "/usr/local/go/src/strings/strings.go", Line: 10}, {Name: "main.find", FileName: "/home/me/shop/main.go", Line: 3}, {Name: "main.main", FileName: "/home/me/shop/main.go", Line: 7}}, []int64{60}, nil)
+	b.AddSample([]pb.Stack{{Name: "main.find", FileName: "/home/me/shop/main.go", Line: 4}, {Name: "main.main", FileName: "/home/me/shop/main.go", Line: 7}}, []int64{40}, nil)
+
+	files, err := Analyze(b.Profile(), pb.AnalyzeOptions{}, []string{"main.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != "main.go" || files[0].Total != 100 {
+		t.Fatalf("Expected main.go at 100%%, got %+v", files)
+	}
+	lines := files[0].Lines
+	if l := lines[3]; l == nil || l.Self != 0 || l.Total != 60 {
+		t.Errorf("Expected line 3 with 0%% self and 60%% total, got %+v", l)
+	}
+	if l := lines[4]; l == nil || l.Self != 40 || l.Total != 40 {
+		t.Errorf("Expected line 4 with 40%% self and total, got %+v", l)
+	}
+	if l := lines[7]; l == nil || l.Self != 0 || l.Total != 100 {
+		t.Errorf("Expected line 7 with 100%% total, got %+v", l)
+	}
+
+	dir, out := t.TempDir(), t.TempDir()
+	src := "package main\n\nfunc find() {\n\tstrings.Index(s, \"<b>\")\n}\n\nfunc main() { find() }\n"
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	written, err := Export(dir, out, files, theme.Light)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 2 {
+		t.Fatalf("Expected a text and an HTML copy, got %v", written)
+	}
+	text, err := os.ReadFile(filepath.Join(out, "main.go.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(text), " 40.00  40.00 | \tstrings.Index") || !strings.Contains(string(text), "              | package main") {
+		t.Errorf("Expected the cpu of the lines in the margin, got\n%s", text)
+	}
+	page, err := os.ReadFile(filepath.Join(out, "main.go.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(page), `<tr id="L7">`) || !strings.Contains(string(page), "&lt;b&gt;") || !strings.Contains(string(page), "rgba(220, 40, 20, 1.000)") {
+		t.Errorf("Expected escaped source lines shaded by heat, got\n%s", page)
+	}
+}
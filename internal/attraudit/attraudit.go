@@ -0,0 +1,131 @@
+// Package attraudit audits the attribution policy, pb.AnalyzeOptions.
+// ShouldAttr: which frames of a profile are attributable, their cpu going to
+// their callers, and which are user functions, with the cpu each
+// classification moves, to validate edits of the policy before trusting the
+// attributed numbers.
+package attraudit
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Frame is the classification of a function of the profile.
+type Frame struct {
+	Name         string
+	FileName     string
+	Attributable bool
+	// Self is the percent of the profile the function is the leaf of, which
+	// goes to its callers when it is attributable.
+	Self float64
+	// Gained is the percent of the profile attributed to the function by its
+	// attributable callees.
+	Gained float64
+}
+
+// Audit is the classification of every function of a profile.
+type Audit struct {
+	Attributable []*Frame // by descending self cpu, then name
+	User         []*Frame // by descending gained cpu, then self cpu, then name
+}
+
+// Analyze classifies the functions of the profile with the ShouldAttr option,
+// attributing cpu even without AttrCPU so that the policy can be audited
+// before it is turned on.
+func Analyze(p *pb.Profile, opts pb.AnalyzeOptions) (*Audit, error) {
+	opts.AttrCPU = true
+	analyzer, err := pb.NewAnalyzer(opts)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := analyzer.AnalyzeCPU(p)
+	if err != nil {
+		return nil, err
+	}
+	shouldAttr := analyzer.Options().ShouldAttr
+
+	a := &Audit{}
+	for _, node := range nodes {
+		frame := &Frame{
+			Name:         node.Name,
+			FileName:     node.FileName,
+			Attributable: shouldAttr(node.Name),
+			Self:         node.SelfCPU,
+			Gained:       node.SelfAttrCPU - node.SelfCPU,
+		}
+		if frame.Attributable {
+			a.Attributable = append(a.Attributable, frame)
+		} else {
+			a.User = append(a.User, frame)
+		}
+	}
+	sort.Slice(a.Attributable, func(i, j int) bool {
+		x, y := a.Attributable[i], a.Attributable[j]
+		if x.Self != y.Self {
+			return x.Self > y.Self
+		}
+		return x.Name < y.Name
+	})
+	sort.Slice(a.User, func(i, j int) bool {
+		x, y := a.User[i], a.User[j]
+		if x.Gained != y.Gained {
+			return x.Gained > y.Gained
+		}
+		if x.Self != y.Self {
+			return x.Self > y.Self
+		}
+		return x.Name < y.Name
+	})
+	return a, nil
+}
+
+// Moved returns the percent of the profile the attributable functions move
+// to their callers.
+func (a *Audit) Moved() float64 {
+	return gained(a.Attributable) + gained(a.User)
+}
+
+// Stranded returns the percent of the profile attributed to attributable
+// callers, which the policy does not carry up to user functions, as only the
+// immediate caller of a leaf is attributed its cpu.
+func (a *Audit) Stranded() float64 {
+	return gained(a.Attributable)
+}
+
+// gained returns the sum of the cpu gained by the frames.
+func gained(frames []*Frame) float64 {
+	sum := 0.0
+	for _, frame := range frames {
+		sum += frame.Gained
+	}
+	return sum
+}
+
+// Write prints the totals of each classification, then the top functions of
+// each, one per line as "self gained function".
+func (a *Audit) Write(w io.Writer, top int, style term.Style) {
+	l := style.Locale
+	fmt.Fprintf(w, "attributable\t%d functions\t%s%% of cpu attributed to their callers\n", len(a.Attributable), l.Format(a.Moved(), 2))
+	fmt.Fprintf(w, "user\t%d functions\t%s%% of cpu attributed from attributable callees\n", len(a.User), l.Format(gained(a.User), 2))
+	if stranded := a.Stranded(); stranded > 0 {
+		fmt.Fprintf(w, "stranded\t\t%s%% of cpu attributed to attributable callers, not reaching user functions\n", l.Format(stranded, 2))
+	}
+
+	style = style.After(2) // self and gained
+	for _, section := range []struct {
+		name   string
+		frames []*Frame
+	}{{"attributable", a.Attributable}, {"user", a.User}} {
+		fmt.Fprintf(w, "\n== %s\nself\tgained\tfunction\n", section.name)
+		for i, frame := range section.frames {
+			if i == top {
+				break
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", style.Percent(frame.Self), style.Percent(frame.Gained), style.Function(frame.Name, frame.FileName))
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package attraudit
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestAudit(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	// main.parse calls the stdlib twice deep, main.render is a leaf.
+	b.AddSample([]pb.Stack{{Name: "runtime.memmove", FileName: "memmove.s"}, {Name: "strings.Clone", FileName: "clone.go"}, {Name: "main.parse", FileName: "main.go"}}, []int64{2e9}, nil)
+	b.AddSample([]pb.Stack{{Name: "encoding/json.Marshal", FileName: "encode.go"}, {Name: "main.parse", FileName: "main.go"}}, []int64{5e9}, nil)
+	b.AddSample([]pb.Stack{{Name: "main.render", FileName: "main.go"}}, []int64{3e9}, nil)
+
+	audit, err := Analyze(b.Profile(), pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(audit.Attributable) != 3 || len(audit.User) != 2 {
+		t.Fatalf("Expected 3 attributable and 2 user functions, got %d and %d", len(audit.Attributable), len(audit.User))
+	}
+	if fn := audit.User[0]; fn.Name != "main.parse" || math.Abs(fn.Gained-50) > 1e-9 {
+		t.Errorf("Expected main.parse to gain 50%%, got %+v", fn)
+	}
+	if moved, stranded := audit.Moved(), audit.Stranded(); math.Abs(moved-70) > 1e-9 || math.Abs(stranded-20) > 1e-9 {
+		t.Errorf("Expected 70%% moved and 20%% stranded, got %v and %v", moved, stranded)
+	}
+
+	var buf bytes.Buffer
+	audit.Write(&buf, 1, term.Style{})
+	want := "attributable\t3 functions\t70.00% of cpu attributed to their callers\n" +
+		"user\t2 functions\t50.00% of cpu attributed from attributable callees\n" +
+		"stranded\t\t20.00% of cpu attributed to attributable callers, not reaching user functions\n" +
+		"\n== attributable\nself\tgained\tfunction\n" +
+		"50.00\t0.00\tencoding/json.Marshal in encode.go\n" +
+		"\n== user\nself\tgained\tfunction\n" +
+		"0.00\t50.00\tmain.parse in main.go\n"
+	if buf.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, buf.String())
+	}
+}
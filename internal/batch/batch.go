@@ -0,0 +1,190 @@
+// Package batch analyzes every profile in a directory tree, for teams that
+// archive profiles, e.g. nightly.
+package batch
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/contention"
+	"github.com/kmrgirish/pprof-adv/internal/cpu"
+	"github.com/kmrgirish/pprof-adv/internal/input"
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/internal/theme"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Extensions are the file extensions of the profiles picked up in a directory.
+var Extensions = []string{".pprof", ".pb.gz", ".pb", ".prof", ".pgo"}
+
+// Options controls a batch run.
+type Options struct {
+	Dir     string // directory searched for profiles
+	Out     string // directory reports are written to
+	Jobs    int    // number of profiles analyzed in parallel, defaults to the number of cpus
+	Top     int    // number of contention sites reported per block or mutex profile
+	Analyze pb.AnalyzeOptions
+	Theme   theme.Theme // styles the index.html
+}
+
+// Result is the outcome of analyzing one profile.
+type Result struct {
+	Input    string // path of the profile relative to Options.Dir
+	Report   string // slash separated path of the report relative to Options.Out
+	Kind     string // "cpu" or "contention"
+	Samples  int
+	Duration time.Duration
+	Top      string // first line of the report
+	Err      error
+}
+
+// Run analyzes every profile under opts.Dir, writing one text report per
+// profile to the same relative path under opts.Out with .txt appended, and
+// an index.html linking all of them. Errors analyzing a profile are recorded
+// in its result rather than stopping the run.
+func Run(opts Options) ([]*Result, error) {
+	var inputs []string
+	err := filepath.WalkDir(opts.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && isProfile(path) {
+			rel, err := filepath.Rel(opts.Dir, path)
+			if err != nil {
+				return err
+			}
+			inputs = append(inputs, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("no profiles found in %s", opts.Dir)
+	}
+
+	jobs := opts.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+
+	results := make([]*Result, len(inputs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(jobs, len(inputs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = analyze(opts, inputs[i])
+			}
+		}()
+	}
+	for i := range inputs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	if err := writeIndex(opts.Out, results, opts.Theme); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// isProfile reports whether the file at path looks like a profile.
+func isProfile(path string) bool {
+	for _, ext := range Extensions {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// analyze writes the report of the profile at the relative path rel.
+func analyze(opts Options, rel string) *Result {
+	result := &Result{Input: rel, Report: filepath.ToSlash(reportPath(rel))}
+
+	profile, err := parse(filepath.Join(opts.Dir, rel))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Samples = len(profile.Sample)
+	result.Duration = time.Duration(profile.DurationNanos)
+
+	var buf bytes.Buffer
+	if pb.IsContentionProfile(profile) {
+		result.Kind = "contention"
+		err = contention.Transform(profile, &buf, opts.Top, term.Style{})
+	} else {
+		result.Kind = "cpu"
+		err = cpu.Transform(profile, &buf, opts.Analyze, term.Style{})
+	}
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Top, _, _ = strings.Cut(buf.String(), "\n")
+
+	out := filepath.Join(opts.Out, filepath.FromSlash(result.Report))
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		result.Err = err
+		return result
+	}
+	result.Err = os.WriteFile(out, buf.Bytes(), 0o644)
+	return result
+}
+
+func parse(path string) (*pb.Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return input.Parse(f, "pprof")
+}
+
+// reportPath returns the path of the report of the profile at rel, the
+// extension is kept so that cpu.pb and cpu.pb.gz don't share a report.
+func reportPath(rel string) string {
+	return rel + ".txt"
+}
+
+// indexHTML is the template of the index of the reports.
+//
+//go:embed index.html
+var indexHTML string
+
+var indexTemplate = template.Must(template.New("index").Parse(indexHTML))
+
+// writeIndex writes an index.html to dir listing the results, styled by the
+// theme.
+func writeIndex(dir string, results []*Result, th theme.Theme) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(dir, "index.html"))
+	if err != nil {
+		return err
+	}
+	if err := indexTemplate.Execute(f, struct {
+		Results []*Result
+		Theme   theme.Theme
+	}{results, th}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,73 @@
+package batch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func writeProfile(t *testing.T, path string, sampleType [2]string, stack ...pb.Stack) {
+	t.Helper()
+	b := pb.NewBuilder(sampleType)
+	b.AddSample(stack, []int64{100}, nil)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := pb.Write(f, b.Profile()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir, out := t.TempDir(), t.TempDir()
+	writeProfile(t, filepath.Join(dir, "2025-01-01", "cpu.pprof"), [2]string{"cpu", "nanoseconds"},
+		pb.Stack{Name: "main.work", FileName: "main.go"}, pb.Stack{Name: "main.main", FileName: "main.go"})
+	writeProfile(t, filepath.Join(dir, "2025-01-01", "mutex.pb.gz"), [2]string{"delay", "nanoseconds"},
+		pb.Stack{Name: "sync.(*Mutex).Lock"}, pb.Stack{Name: "main.handler", FileName: "main.go"})
+	if err := os.WriteFile(filepath.Join(dir, "broken.pprof"), []byte("not a profile"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("skipped"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := Run(Options{Dir: dir, Out: out, Jobs: 2, Top: 10, Analyze: pb.AnalyzeOptions{ShouldAttr: func(string) bool { return false }}})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+
+	byInput := make(map[string]*Result)
+	for _, result := range results {
+		byInput[filepath.ToSlash(result.Input)] = result
+	}
+	if result := byInput["broken.pprof"]; result.Err == nil {
+		t.Error("Expected error for broken profile, got nil")
+	}
+	if result := byInput["2025-01-01/cpu.pprof"]; result.Err != nil || result.Kind != "cpu" || result.Top != "100.00\tmain.work in main.go" {
+		t.Errorf("Unexpected cpu result %+v", result)
+	}
+	if result := byInput["2025-01-01/mutex.pb.gz"]; result.Err != nil || result.Kind != "contention" {
+		t.Errorf("Unexpected contention result %+v", result)
+	}
+
+	report, err := os.ReadFile(filepath.Join(out, "2025-01-01", "mutex.pb.gz.txt"))
+	if err != nil || !strings.Contains(string(report), "main.handler") {
+		t.Errorf("Expected contention report for main.handler, got %q (%v)", report, err)
+	}
+	index, err := os.ReadFile(filepath.Join(out, "index.html"))
+	if err != nil || !strings.Contains(string(index), `href="2025-01-01/cpu.pprof.txt"`) {
+		t.Errorf("Expected index linking the cpu report, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+// Package bench measures the throughput of the analyzers on synthetic
+// profiles, so that performance oriented changes can be validated, see the
+// bench-self command and the benchmarks of this package.
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Options describes a synthetic profile.
+type Options struct {
+	Samples   int   // number of samples
+	Stacks    int   // number of distinct stacks the samples are drawn from
+	Functions int   // number of distinct user functions in the stacks
+	Seed      int64 // seed of the generator, the same options give the same profile
+}
+
+// DefaultOptions are a profile the size of a large merged production profile.
+var DefaultOptions = Options{Samples: 1_000_000, Stacks: 20_000, Functions: 5_000, Seed: 1}
+
+// runtimeFrames are the stdlib leaves of the stacks, whose cpu is attributed
+// to their callers.
+var runtimeFrames = []pb.Stack{
+	{Name: "runtime.mallocgc", FileName: "runtime/malloc.go"},
+	{Name: "runtime.mapaccess2_faststr", FileName: "runtime/map_faststr.go"},
+	{Name: "encoding/json.(*decodeState).object", FileName: "encoding/json/decode.go"},
+	{Name: "strconv.ParseInt", FileName: "strconv/atoi.go"},
+	{Name: "sync.(*Mutex).Lock", FileName: "sync/mutex.go"},
+}
+
+// Profile generates a cpu profile. Stacks are 5 to 40 user frames deep, a
+// quarter of them ending in a stdlib frame, and drawn with a skewed
+// distribution so that, as in real profiles, a few stacks make up most of the
+// samples.
+func Profile(opts Options) *pb.Profile {
+	rng := rand.New(rand.NewSource(opts.Seed))
+	b := pb.NewBuilder([2]string{"samples", "count"}, [2]string{"cpu", "nanoseconds"})
+
+	functions := make([]pb.Stack, opts.Functions)
+	for i := range functions {
+		pkg := fmt.Sprintf("github.com/example/app/internal/pkg%d", i%100)
+		functions[i] = pb.Stack{Name: fmt.Sprintf("%s.Func%d", pkg, i), FileName: fmt.Sprintf("%s/file%d.go", pkg, i%7)}
+	}
+
+	// The builder interns the frames of one sample per stack, the others
+	// share its locations.
+	for range opts.Stacks {
+		stack := make([]pb.Stack, 0, 41)
+		if rng.Intn(4) == 0 {
+			stack = append(stack, runtimeFrames[rng.Intn(len(runtimeFrames))])
+		}
+		for depth := 5 + rng.Intn(36); depth > 0; depth-- {
+			frame := functions[rng.Intn(len(functions))]
+			frame.Line = int64(10 + rng.Intn(5))
+			stack = append(stack, frame)
+		}
+		stack = append(stack, pb.Stack{Name: "main.main", FileName: "main.go", Line: 1})
+		b.AddSample(stack, []int64{1, 10_000_000}, nil)
+	}
+	profile := b.Profile()
+	stacks := make([][]uint64, len(profile.Sample))
+	for i, sample := range profile.Sample {
+		stacks[i] = sample.LocationId
+	}
+
+	zipf := rand.NewZipf(rng, 1.1, 1, uint64(len(stacks)-1))
+	samples := make([]*pb.Sample, opts.Samples)
+	for i := range samples {
+		samples[i] = &pb.Sample{LocationId: stacks[zipf.Uint64()], Value: []int64{1, 10_000_000}}
+	}
+	profile.Sample = samples
+	profile.DurationNanos = int64(time.Minute)
+	profile.PeriodType = &pb.ValueType{Type: b.String("cpu"), Unit: b.String("nanoseconds")}
+	profile.Period = 10_000_000
+	return profile
+}
+
+// Case is an analysis whose throughput is measured.
+type Case struct {
+	Name string
+	Run  func(p *pb.Profile) error
+}
+
+func analyze(opts pb.AnalyzeOptions) func(p *pb.Profile) error {
+	return func(p *pb.Profile) error {
+		_, err := pb.AnalyzeCPUProfile(p, opts)
+		return err
+	}
+}
+
+// Cases are the analyses measured by Run.
+var Cases = []Case{
+	{"cpu", analyze(pb.AnalyzeOptions{})},
+	{"cpu attr", analyze(pb.AnalyzeOptions{AttrCPU: true})},
+	{"cpu line", analyze(pb.AnalyzeOptions{Granularity: pb.GranularityLine})},
+	{"cpu hide runtime", analyze(pb.AnalyzeOptions{HideRuntime: true})},
+	{"cpu focus", analyze(pb.AnalyzeOptions{Focus: regexp.MustCompile(`pkg1\.`)})},
+	{"stats", func(p *pb.Profile) error {
+		pb.ProfileStats(p)
+		return nil
+	}},
+}
+
+// Result is the measured throughput of a case.
+type Result struct {
+	Case    string
+	Samples int
+	testing.BenchmarkResult
+}
+
+// SamplesPerSecond returns the number of samples analyzed per second.
+func (r Result) SamplesPerSecond() float64 {
+	if r.NsPerOp() == 0 {
+		return 0
+	}
+	return float64(r.Samples) / (float64(r.NsPerOp()) / float64(time.Second))
+}
+
+// Run measures the cases on the profile. Every case runs once before being
+// measured, so that one-time costs such as loading the list of stdlib
+// packages are not measured.
+func Run(p *pb.Profile, cases []Case) ([]Result, error) {
+	results := make([]Result, 0, len(cases))
+	for _, c := range cases {
+		if err := c.Run(p); err != nil {
+			return nil, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		result := testing.Benchmark(func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				c.Run(p)
+			}
+		})
+		results = append(results, Result{Case: c.Name, Samples: len(p.Sample), BenchmarkResult: result})
+	}
+	return results, nil
+}
@@ -0,0 +1,58 @@
+package bench
+
+import (
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestProfile(t *testing.T) {
+	opts := Options{Samples: 1000, Stacks: 100, Functions: 50, Seed: 1}
+	p := Profile(opts)
+	if err := pb.Validate(p); err != nil {
+		t.Fatal(err)
+	}
+	stats := pb.ProfileStats(p)
+	if stats.Samples != 1000 || stats.Stacks > 100 || stats.Stacks < 10 {
+		t.Errorf("Expected 1000 samples of at most 100 stacks, got %+v", stats)
+	}
+	if again := pb.ProfileStats(Profile(opts)); again != stats {
+		t.Errorf("Expected the same profile for the same options, got %+v and %+v", stats, again)
+	}
+	if _, err := pb.AnalyzeCPUProfile(p, pb.AnalyzeOptions{}); err != nil {
+		t.Error(err)
+	}
+}
+
+// benchProfile is the profile of the benchmarks, generated once.
+var benchProfile *pb.Profile
+
+func benchmark(b *testing.B, opts pb.AnalyzeOptions) {
+	if benchProfile == nil {
+		benchProfile = Profile(DefaultOptions)
+	}
+	analyzer, err := pb.NewAnalyzer(opts)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		if _, err := analyzer.AnalyzeCPU(benchProfile); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(benchProfile.Sample))*float64(b.N)/b.Elapsed().Seconds(), "samples/s")
+}
+
+func BenchmarkAnalyzeCPUProfile(b *testing.B) {
+	benchmark(b, pb.AnalyzeOptions{})
+}
+
+func BenchmarkAnalyzeCPUProfileLine(b *testing.B) {
+	benchmark(b, pb.AnalyzeOptions{Granularity: pb.GranularityLine})
+}
+
+func BenchmarkAnalyzeCPUProfileAttr(b *testing.B) {
+	benchmark(b, pb.AnalyzeOptions{AttrCPU: true})
+}
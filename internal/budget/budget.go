@@ -0,0 +1,255 @@
+// Package budget reads the cpu budgets of the functions of services and turns
+// them into Datadog monitors, so that a function outgrowing its budget alerts
+// even when nobody runs the CLI.
+package budget
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/profiler"
+)
+
+// Tag is the tag of the monitors of the budgets, the ones sync-datadog
+// creates and updates.
+const Tag = "managed-by:pprof-adv-budgets"
+
+// File is the budgets of a budgets.yaml file such as:
+//
+//	metric: profiling.function.cpu_cores
+//	window: 1h
+//	notify: "@slack-perf"
+//	budgets:
+//	  - service: checkout
+//	    env: prod
+//	    function: encoding/json.Marshal
+//	    max_cores: 0.5
+//	  - service: checkout
+//	    env: prod
+//	    function: compress/flate.NewWriter
+//	    max_cores: 0.2
+//	    window: 15m
+//
+// The metric is the Datadog metric of the cpu cores used by each function,
+// tagged by service, env and function, e.g. one generated from the profiles
+// of the services.
+type File struct {
+	Metric  string        // Datadog metric of the cores of the functions
+	Window  time.Duration // default window the cores are averaged over
+	Notify  string        // default handles notified of breaches, e.g. "@slack-perf"
+	Budgets []Budget      // the "budgets" list
+}
+
+// Budget is the most cores a function of a service may use.
+type Budget struct {
+	Service  string
+	Env      string
+	Function string
+	MaxCores float64
+	Window   time.Duration
+	Notify   string
+	Name     string // name of the monitor, derived from the function by default
+}
+
+// Parse reads a budgets.yaml file. Only the subset of YAML used by the format
+// is supported: scalar keys and a list of mappings under "budgets".
+func Parse(r io.Reader) (*File, error) {
+	f := &File{Window: time.Hour}
+
+	var (
+		inBudgets bool
+		budget    *Budget
+		lineNo    int
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNo++
+		line := stripComment(scanner.Text())
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indented := line[0] == ' ' || line[0] == '\t'
+		line = strings.TrimSpace(line)
+
+		if !indented {
+			budget, inBudgets = nil, false
+			key, value, err := splitKey(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			if key == "budgets" {
+				if value != "" {
+					return nil, fmt.Errorf("line %d: budgets must be a list", lineNo)
+				}
+				inBudgets = true
+				continue
+			}
+			if err := f.set(key, value); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			continue
+		}
+
+		if !inBudgets {
+			return nil, fmt.Errorf("line %d: unexpected indentation", lineNo)
+		}
+		if rest, ok := strings.CutPrefix(line, "-"); ok {
+			f.Budgets = append(f.Budgets, Budget{})
+			budget = &f.Budgets[len(f.Budgets)-1]
+			line = strings.TrimSpace(rest)
+			if line == "" {
+				continue
+			}
+		}
+		if budget == nil {
+			return nil, fmt.Errorf("line %d: expected a list item", lineNo)
+		}
+		key, value, err := splitKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if err := budget.set(key, value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if f.Metric == "" {
+		return nil, fmt.Errorf("metric is required")
+	}
+	if len(f.Budgets) == 0 {
+		return nil, fmt.Errorf("no budgets configured")
+	}
+	names := make(map[string]int)
+	for i := range f.Budgets {
+		b := &f.Budgets[i]
+		if b.Service == "" || b.Env == "" || b.Function == "" {
+			return nil, fmt.Errorf("budget %d: service, env and function are required", i+1)
+		}
+		if strings.ContainsAny(b.Function, " ,{}") {
+			return nil, fmt.Errorf("budget %d: function %q cannot be a tag value", i+1, b.Function)
+		}
+		if b.MaxCores <= 0 {
+			return nil, fmt.Errorf("budget %d: max_cores must be positive", i+1)
+		}
+		if b.Window == 0 {
+			b.Window = f.Window
+		}
+		if b.Window < time.Minute || b.Window%time.Minute != 0 {
+			return nil, fmt.Errorf("budget %d: window must be whole minutes", i+1)
+		}
+		if b.Notify == "" {
+			b.Notify = f.Notify
+		}
+		if b.Name == "" {
+			b.Name = fmt.Sprintf("%s cpu budget of %s in %s", b.Function, b.Service, b.Env)
+		}
+		if j, exists := names[b.Name]; exists {
+			return nil, fmt.Errorf("budget %d: same monitor name as budget %d", i+1, j)
+		}
+		names[b.Name] = i + 1
+	}
+	return f, nil
+}
+
+func (f *File) set(key, value string) (err error) {
+	switch key {
+	case "metric":
+		f.Metric = value
+	case "window":
+		f.Window, err = time.ParseDuration(value)
+	case "notify":
+		f.Notify = value
+	default:
+		return fmt.Errorf("unknown key %q", key)
+	}
+	return err
+}
+
+func (b *Budget) set(key, value string) (err error) {
+	switch key {
+	case "service":
+		b.Service = value
+	case "env":
+		b.Env = value
+	case "function":
+		b.Function = value
+	case "max_cores":
+		b.MaxCores, err = strconv.ParseFloat(value, 64)
+	case "window":
+		b.Window, err = time.ParseDuration(value)
+	case "notify":
+		b.Notify = value
+	case "name":
+		b.Name = value
+	default:
+		return fmt.Errorf("unknown budget key %q", key)
+	}
+	return err
+}
+
+// Monitors returns the monitors of the budgets, tagged with Tag so that
+// sync-datadog finds them again.
+func (f *File) Monitors() []*profiler.Monitor {
+	monitors := make([]*profiler.Monitor, 0, len(f.Budgets))
+	for _, b := range f.Budgets {
+		limit := strconv.FormatFloat(b.MaxCores, 'g', -1, 64)
+		window := fmt.Sprintf("%dm", int(b.Window/time.Minute))
+		message := fmt.Sprintf("%s of %s in %s uses more than its budget of %s cores over the last %s.", b.Function, b.Service, b.Env, limit, window)
+		if b.Notify != "" {
+			message += " " + b.Notify
+		}
+		monitors = append(monitors, &profiler.Monitor{
+			Name:    b.Name,
+			Type:    "query alert",
+			Query:   fmt.Sprintf("avg(last_%s):sum:%s{service:%s,env:%s,function:%s} > %s", window, f.Metric, b.Service, b.Env, b.Function, limit),
+			Message: message,
+			Tags:    []string{Tag, "service:" + b.Service, "env:" + b.Env},
+			Options: profiler.MonitorOptions{Thresholds: profiler.MonitorThresholds{Critical: b.MaxCores}},
+		})
+	}
+	return monitors
+}
+
+// splitKey splits a "key: value" line, unquoting the value.
+func splitKey(line string) (key, value string, err error) {
+	key, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", "", fmt.Errorf("expected key: value, got %q", line)
+	}
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		if value[0] == '"' {
+			if value, err = strconv.Unquote(value); err != nil {
+				return "", "", err
+			}
+		} else {
+			value = strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+		}
+	}
+	return key, value, nil
+}
+
+// stripComment removes a trailing # comment that is not inside quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return line
+}
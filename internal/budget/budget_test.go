@@ -0,0 +1,92 @@
+package budget
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/profiler"
+)
+
+const budgets = `# cpu budgets of checkout
+metric: profiling.function.cpu_cores
+notify: "@slack-perf"
+
+budgets:
+  - service: checkout
+    env: prod
+    function: encoding/json.Marshal
+    max_cores: 0.5
+  - service: checkout
+    env: prod
+    function: compress/flate.NewWriter
+    max_cores: 0.25 # flate is already tuned
+    window: 15m
+    notify: '@pagerduty-checkout'
+    name: flate budget
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse(strings.NewReader(budgets))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if f.Metric != "profiling.function.cpu_cores" || f.Window != time.Hour || len(f.Budgets) != 2 {
+		t.Fatalf("Unexpected budgets %+v", f)
+	}
+
+	json, flate := f.Budgets[0], f.Budgets[1]
+	if json.Window != time.Hour || json.Notify != "@slack-perf" || json.Name != "encoding/json.Marshal cpu budget of checkout in prod" {
+		t.Errorf("Expected file defaults, got %+v", json)
+	}
+	if flate.MaxCores != 0.25 || flate.Window != 15*time.Minute || flate.Notify != "@pagerduty-checkout" || flate.Name != "flate budget" {
+		t.Errorf("Unexpected second budget %+v", flate)
+	}
+}
+
+func TestMonitors(t *testing.T) {
+	f, err := Parse(strings.NewReader(budgets))
+	if err != nil {
+		t.Fatal(err)
+	}
+	monitors := f.Monitors()
+	if len(monitors) != 2 {
+		t.Fatalf("Expected 2 monitors, got %d", len(monitors))
+	}
+
+	m := monitors[1]
+	want := profiler.Monitor{
+		Name:    "flate budget",
+		Type:    "query alert",
+		Query:   "avg(last_15m):sum:profiling.function.cpu_cores{service:checkout,env:prod,function:compress/flate.NewWriter} > 0.25",
+		Message: "compress/flate.NewWriter of checkout in prod uses more than its budget of 0.25 cores over the last 15m. @pagerduty-checkout",
+		Options: profiler.MonitorOptions{Thresholds: profiler.MonitorThresholds{Critical: 0.25}},
+	}
+	if m.Name != want.Name || m.Type != want.Type || m.Query != want.Query || m.Message != want.Message || m.Options != want.Options {
+		t.Errorf("Expected monitor\n%+v\ngot\n%+v", want, *m)
+	}
+	if len(m.Tags) != 3 || m.Tags[0] != Tag {
+		t.Errorf("Expected the monitor tagged %s, service and env, got %q", Tag, m.Tags)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	const budget = "  - service: a\n    env: prod\n    function: f\n    max_cores: 1\n"
+	tests := map[string]string{
+		"no metric":      "budgets:\n" + budget,
+		"no budgets":     "metric: m\n",
+		"no function":    "metric: m\nbudgets:\n  - service: a\n    env: prod\n    max_cores: 1\n",
+		"no max":         "metric: m\nbudgets:\n  - service: a\n    env: prod\n    function: f\n",
+		"unknown key":    "metric: m\nbudgets:\n" + budget + "    max_core: 2\n",
+		"seconds window": "metric: m\nwindow: 90s\nbudgets:\n" + budget,
+		"bad tag value":  "metric: m\nbudgets:\n  - service: a\n    env: prod\n    function: f g\n    max_cores: 1\n",
+		"same name":      "metric: m\nbudgets:\n" + budget + budget,
+		"not a list":     "metric: m\nbudgets: a\n",
+		"stray indent":   "  metric: m\n",
+	}
+	for name, budgets := range tests {
+		if _, err := Parse(strings.NewReader(budgets)); err == nil {
+			t.Errorf("%s: Expected error, got nil", name)
+		}
+	}
+}
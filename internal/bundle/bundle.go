@@ -0,0 +1,303 @@
+// Package bundle exports the profiles, reports and cached previous runs
+// collected on one machine into a tar archive, and imports them on another,
+// e.g. into the store of a shared serve instance.
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/kmrgirish/pprof-adv/internal/seal"
+	"github.com/kmrgirish/pprof-adv/internal/store"
+)
+
+// The directories of the archive. Profiles are kept as
+// "profiles/<id>.pprof" along with their entry "profiles/<id>.json" and
+// reports "profiles/<id>/<name>", the cache as its files relative to the
+// cache directory.
+const (
+	profilesDir = "profiles/"
+	cacheDir    = "cache/"
+)
+
+// Stats counts what was exported or imported.
+type Stats struct {
+	Profiles int
+	Reports  int
+	Cached   int // files of the cache, e.g. the previous runs of post-dd-event
+	Skipped  int // profiles already in the store and cached files older than the ones there
+}
+
+// Export writes the profiles and reports of the store and the files of the
+// cache directory, if any, to w as a tar archive. Everything is decrypted
+// with the cipher, so that the recipient can read it with or without a key
+// of their own.
+func Export(w io.Writer, st *store.Store, cache string, c *seal.Cipher) (Stats, error) {
+	var stats Stats
+	tw := tar.NewWriter(w)
+
+	entries, err := st.List()
+	if err != nil {
+		return stats, err
+	}
+	for _, entry := range entries {
+		_, data, err := st.Get(entry.ID)
+		if err != nil {
+			return stats, fmt.Errorf("%s: %w", entry.ID, err)
+		}
+		meta, err := json.MarshalIndent(entry, "", "  ")
+		if err != nil {
+			return stats, err
+		}
+		if err := writeFile(tw, profilesDir+entry.ID+".pprof", data, entry.Received); err != nil {
+			return stats, err
+		}
+		if err := writeFile(tw, profilesDir+entry.ID+".json", meta, entry.Received); err != nil {
+			return stats, err
+		}
+		stats.Profiles++
+
+		names, err := st.Reports(entry.ID)
+		if err != nil {
+			return stats, fmt.Errorf("%s: %w", entry.ID, err)
+		}
+		for _, name := range names {
+			report, err := st.GetReport(entry.ID, name)
+			if err != nil {
+				return stats, fmt.Errorf("%s: %w", entry.ID, err)
+			}
+			if err := writeFile(tw, profilesDir+entry.ID+"/"+name, report, entry.Received); err != nil {
+				return stats, err
+			}
+			stats.Reports++
+		}
+	}
+
+	if cache != "" {
+		err := filepath.WalkDir(cache, func(file string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) && file == cache {
+				return filepath.SkipDir
+			} else if err != nil || d.IsDir() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			if data, err = c.Open(d.Name(), data); err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+			rel, err := filepath.Rel(cache, file)
+			if err != nil {
+				return err
+			}
+			stats.Cached++
+			return writeFile(tw, cacheDir+filepath.ToSlash(rel), data, info.ModTime())
+		})
+		if err != nil {
+			return stats, err
+		}
+	}
+	return stats, tw.Close()
+}
+
+func writeFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: modTime, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// Import reads an archive written by Export from r into the store and the
+// cache directory, which is skipped if empty. Profiles keep their ids, so
+// importing twice stores them once, and cached files replace the ones there
+// only if they are newer. Cached files are encrypted with the cipher unless
+// it is nil.
+func Import(r io.Reader, st store.Storage, cache string, c *seal.Cipher) (Stats, error) {
+	var stats Stats
+	existing := make(map[string]bool)
+	entries, err := st.List()
+	if err != nil {
+		return stats, err
+	}
+	for _, entry := range entries {
+		existing[entry.ID] = true
+	}
+
+	// The data of a profile precedes its entry in the archive.
+	profiles := make(map[string][]byte)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return stats, nil
+		} else if err != nil {
+			return stats, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return stats, err
+		}
+
+		switch name := path.Clean(header.Name); {
+		case strings.HasPrefix(name, profilesDir):
+			rel := strings.TrimPrefix(name, profilesDir)
+			if id, report, ok := strings.Cut(rel, "/"); ok {
+				if existing[id] {
+					continue
+				}
+				if err := st.PutReport(id, report, data); err != nil {
+					return stats, err
+				}
+				stats.Reports++
+			} else if id, ok := strings.CutSuffix(rel, ".pprof"); ok {
+				profiles[id] = data
+			} else if id, ok := strings.CutSuffix(rel, ".json"); ok {
+				if existing[id] {
+					stats.Skipped++
+					continue
+				}
+				if err := importProfile(st, id, data, profiles[id]); err != nil {
+					return stats, err
+				}
+				delete(profiles, id)
+				stats.Profiles++
+			}
+		case strings.HasPrefix(name, cacheDir) && cache != "":
+			rel := strings.TrimPrefix(name, cacheDir)
+			if rel == "" || strings.HasPrefix(rel, "../") {
+				return stats, fmt.Errorf("invalid cache file %s in archive", header.Name)
+			}
+			imported, err := importCached(filepath.Join(cache, filepath.FromSlash(rel)), data, header.ModTime, c)
+			if err != nil {
+				return stats, err
+			}
+			if imported {
+				stats.Cached++
+			} else {
+				stats.Skipped++
+			}
+		}
+	}
+}
+
+// importProfile stores the profile of an entry of the archive, under the same
+// id as it was exported with.
+func importProfile(st store.Storage, id string, meta, data []byte) error {
+	if data == nil {
+		return fmt.Errorf("%s: missing profile in archive", id)
+	}
+	var entry store.Entry
+	if err := json.Unmarshal(meta, &entry); err != nil {
+		return fmt.Errorf("%s: %w", id, err)
+	}
+	stored, err := st.Put(entry.Name, entry.Tags, data, entry.Fingerprint, entry.Received)
+	if err != nil {
+		return fmt.Errorf("%s: %w", id, err)
+	}
+	if stored.ID != id {
+		return fmt.Errorf("%s: stored as %s, the archive is corrupt", id, stored.ID)
+	}
+	return nil
+}
+
+// importCached writes a cached file unless the one there is as recent.
+func importCached(file string, data []byte, modTime time.Time, c *seal.Cipher) (bool, error) {
+	if info, err := os.Stat(file); err == nil && !info.ModTime().Before(modTime) {
+		return false, nil
+	}
+	data, err := c.Seal(filepath.Base(file), data)
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		return false, err
+	}
+	return true, os.Chtimes(file, modTime, modTime)
+}
+
+// Create creates an archive file compressed by the extension of its name:
+// zstd for .zst, gzip for .gz and .tgz, and none for .tar.
+func Create(name string) (io.WriteCloser, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasSuffix(name, ".zst"):
+		zw, err := zstd.NewWriter(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &stream{Writer: zw, closers: []func() error{zw.Close, f.Close}}, nil
+	case strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".tgz"):
+		zw := gzip.NewWriter(f)
+		return &stream{Writer: zw, closers: []func() error{zw.Close, f.Close}}, nil
+	}
+	return f, nil
+}
+
+// Open opens an archive file written with Create.
+func Open(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasSuffix(name, ".zst"):
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &stream{Reader: zr, closers: []func() error{zr.IOReadCloser().Close, f.Close}}, nil
+	case strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".tgz"):
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &stream{Reader: zr, closers: []func() error{zr.Close, f.Close}}, nil
+	}
+	return f, nil
+}
+
+// stream is a compressed file, closed by its closers in order.
+type stream struct {
+	io.Reader
+	io.Writer
+	closers []func() error
+}
+
+func (s *stream) Close() error {
+	var errs []error
+	for _, close := range s.closers {
+		errs = append(errs, close())
+	}
+	return errors.Join(errs...)
+}
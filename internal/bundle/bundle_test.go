@@ -0,0 +1,88 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/store"
+)
+
+func TestExportImport(t *testing.T) {
+	for _, name := range []string{"bundle.tar", "bundle.tar.gz", "bundle.tar.zst"} {
+		t.Run(name, func(t *testing.T) {
+			testExportImport(t, filepath.Join(t.TempDir(), name))
+		})
+	}
+}
+
+func testExportImport(t *testing.T, bundle string) {
+	src, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	entry, err := src.Put("cpu.pprof", map[string]string{"team": "payments"}, []byte("profile"), "0123456789abcdef", received)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.PutReport(entry.ID, "report.txt", []byte("report")); err != nil {
+		t.Fatal(err)
+	}
+	srcCache := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(srcCache, "events"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcCache, "events", "api.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := Create(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := Export(w, src, srcCache, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if stats != (Stats{Profiles: 1, Reports: 1, Cached: 1}) {
+		t.Errorf("Expected 1 profile, report and cached run exported, got %+v", stats)
+	}
+
+	dst, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstCache := t.TempDir()
+	for i, want := range []Stats{{Profiles: 1, Reports: 1, Cached: 1}, {Skipped: 2}} {
+		r, err := Open(bundle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats, err := Import(r, dst, dstCache, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if stats != want {
+			t.Errorf("Import %d: expected %+v, got %+v", i+1, want, stats)
+		}
+	}
+
+	got, data, err := dst.Get(entry.ID)
+	if err != nil || string(data) != "profile" || got.Tags["team"] != "payments" || !got.Received.Equal(received) || got.Fingerprint != entry.Fingerprint {
+		t.Errorf("Expected the profile of payments received at %s with its fingerprint, got %+v %q: %v", received, got, data, err)
+	}
+	if report, err := dst.GetReport(entry.ID, "report.txt"); err != nil || string(report) != "report" {
+		t.Errorf("Expected report, got %q: %v", report, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dstCache, "events", "api.json")); err != nil || string(data) != "{}" {
+		t.Errorf("Expected the cached run, got %q: %v", data, err)
+	}
+}
@@ -0,0 +1,171 @@
+// Package cgroup reports the cpu limit of the container a profile was recorded
+// in against the cpu it used, and whether it was throttled, as the hot spots
+// of a throttled service are read differently: its cpu is capped by the
+// quota, and latency comes from waiting for the next period as much as from
+// the functions using the cpu.
+package cgroup
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// minThrottledShare is the share of throttled periods above which the
+// service counts as throttled.
+const minThrottledShare = 0.01
+
+// Limits are the cpu limit of a container and how much it was throttled
+// during a profile, zero where unknown.
+type Limits struct {
+	Cores         float64 // cpu limit
+	HostCores     float64 // cores of the host, e.g. GOMAXPROCS
+	Periods       float64 // CFS periods elapsed
+	Throttled     float64 // CFS periods in which the quota ran out
+	ThrottledTime time.Duration
+}
+
+// FromMetrics returns the limits in metrics, e.g. of the metrics.json of a
+// Datadog download, named after the cgroup cpu.stat and cpu.max fields, in
+// any case and optionally prefixed, e.g. container_cpu_limit:
+//
+//   - cpu_limit or cpu_limit_cores: limit in cores
+//   - cpu_quota or cfs_quota_us, and cpu_period or cfs_period_us: limit as
+//     a quota per period
+//   - nr_periods, and nr_throttled or throttled_periods: CFS periods
+//   - throttled_time in nanoseconds, or throttled_usec
+//   - gomaxprocs, num_cpu or host_cores: cores of the host
+func FromMetrics(metrics map[string]float64) Limits {
+	var l Limits
+	var quota, period float64
+	for name, value := range metrics {
+		name = strings.NewReplacer(".", "_", "-", "_").Replace(strings.ToLower(name))
+		switch {
+		case hasSuffix(name, "cpu_limit", "cpu_limit_cores"):
+			l.Cores = value
+		case hasSuffix(name, "cpu_quota", "cfs_quota_us"):
+			quota = value
+		case hasSuffix(name, "cpu_period", "cfs_period_us"):
+			period = value
+		case hasSuffix(name, "nr_periods"):
+			l.Periods = value
+		case hasSuffix(name, "nr_throttled", "throttled_periods"):
+			l.Throttled = value
+		case hasSuffix(name, "throttled_time", "throttled_time_ns"):
+			l.ThrottledTime = time.Duration(value)
+		case hasSuffix(name, "throttled_usec"):
+			l.ThrottledTime = time.Duration(value * float64(time.Microsecond))
+		case hasSuffix(name, "gomaxprocs", "num_cpu", "host_cores"):
+			l.HostCores = value
+		}
+	}
+	if l.Cores == 0 && quota > 0 && period > 0 {
+		l.Cores = quota / period
+	}
+	return l
+}
+
+func hasSuffix(name string, suffixes ...string) bool {
+	for _, suffix := range suffixes {
+		if name == suffix || strings.HasSuffix(name, "_"+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromLabels returns the limits in the labels of the samples of a profile,
+// with the names of FromMetrics and numeric values, the largest value of
+// every label.
+func FromLabels(p *pb.Profile) Limits {
+	metrics := make(map[string]float64)
+	for _, sample := range p.Sample {
+		for _, label := range sample.Label {
+			value := float64(label.Num)
+			if label.Str != 0 {
+				v, err := strconv.ParseFloat(p.StringTable[label.Str], 64)
+				if err != nil {
+					continue
+				}
+				value = v
+			}
+			key := p.StringTable[label.Key]
+			if current, exists := metrics[key]; !exists || value > current {
+				metrics[key] = value
+			}
+		}
+	}
+	return FromMetrics(metrics)
+}
+
+// Known reports whether the limits tell anything about the container.
+func (l Limits) Known() bool {
+	return l.Cores > 0 || l.Periods > 0 || l.ThrottledTime > 0
+}
+
+// Capacity returns the cores available to the service, its cpu limit or else
+// the cores of its host, 0 if unknown.
+func (l Limits) Capacity() float64 {
+	if l.Cores > 0 {
+		return l.Cores
+	}
+	return l.HostCores
+}
+
+// ThrottledShare returns the share of the periods in which the container was
+// throttled, 0 if unknown.
+func (l Limits) ThrottledShare() float64 {
+	if l.Periods <= 0 {
+		return 0
+	}
+	return l.Throttled / l.Periods
+}
+
+// IsThrottled reports whether the container was throttled in more than 1% of
+// the periods, or for any time if the periods are unknown.
+func (l Limits) IsThrottled() bool {
+	if l.Periods > 0 {
+		return l.ThrottledShare() > minThrottledShare
+	}
+	return l.ThrottledTime > 0
+}
+
+// Usage returns the cores the profile used on average, the cpu of its
+// samples over its duration, or 0 if it has no cpu samples or duration.
+func Usage(p *pb.Profile) float64 {
+	if p.DurationNanos <= 0 {
+		return 0
+	}
+	return float64(pb.TotalCPU(p)) / float64(p.DurationNanos)
+}
+
+// Write reports the limit against the usage, in cores, 0 if unknown, and
+// warns when the container was throttled. It writes nothing if the limits
+// are unknown.
+func (l Limits) Write(w io.Writer, usage float64) {
+	if !l.Known() {
+		return
+	}
+	switch {
+	case l.Cores > 0 && usage > 0:
+		fmt.Fprintf(w, "Container cpu limit %.2f cores, used %.2f cores (%.0f%% of the limit)\n", l.Cores, usage, 100*usage/l.Cores)
+	case l.Cores > 0:
+		fmt.Fprintf(w, "Container cpu limit %.2f cores\n", l.Cores)
+	}
+	if !l.IsThrottled() {
+		return
+	}
+	var parts []string
+	if l.Periods > 0 {
+		parts = append(parts, fmt.Sprintf("in %.0f of %.0f periods (%.1f%%)", l.Throttled, l.Periods, 100*l.ThrottledShare()))
+	}
+	if l.ThrottledTime > 0 {
+		parts = append(parts, fmt.Sprintf("for %s", l.ThrottledTime.Round(time.Millisecond)))
+	}
+	fmt.Fprintf(w, "WARNING: the container was throttled %s during the profile\n", strings.Join(parts, " "))
+	fmt.Fprintf(w, "WARNING: percentages are of the cpu the quota allowed, the service wanted more; latency includes waiting for the next period\n")
+}
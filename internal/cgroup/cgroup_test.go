@@ -0,0 +1,74 @@
+package cgroup
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestFromMetrics(t *testing.T) {
+	l := FromMetrics(map[string]float64{
+		"go_gcs_per_sec":         2,
+		"container.cpu.quota":    200000,
+		"container.cpu.period":   100000,
+		"cgroup_nr_periods":      600,
+		"cgroup_nr_throttled":    120,
+		"cgroup_throttled_usec":  3.2e6,
+		"go_alloc_bytes_per_sec": 1e6,
+	})
+	want := Limits{Cores: 2, Periods: 600, Throttled: 120, ThrottledTime: 3200 * time.Millisecond}
+	if l != want {
+		t.Errorf("Expected %+v, got %+v", want, l)
+	}
+	if !l.IsThrottled() || l.ThrottledShare() != 0.2 {
+		t.Errorf("Expected throttled in 20%% of the periods, got %v", l.ThrottledShare())
+	}
+
+	var buf bytes.Buffer
+	l.Write(&buf, 1.5)
+	for _, want := range []string{"limit 2.00 cores, used 1.50 cores (75% of the limit)", "throttled in 120 of 600 periods (20.0%) for 3.2s"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected %q in the report, got %q", want, buf.String())
+		}
+	}
+
+	if l := FromMetrics(map[string]float64{"cpu_limit": 4, "nr_periods": 1000, "nr_throttled": 5}); l.IsThrottled() {
+		t.Errorf("Expected 0.5%% of throttled periods to be tolerated, got %+v", l)
+	}
+	buf.Reset()
+	FromMetrics(map[string]float64{"go_gcs_per_sec": 2}).Write(&buf, 1)
+	if buf.Len() != 0 {
+		t.Errorf("Expected no report without limits, got %q", buf.String())
+	}
+}
+
+func TestFromLabels(t *testing.T) {
+	p := &pb.Profile{
+		StringTable:   []string{"", "cpu", "nanoseconds", "cpu_limit_cores", "nr_periods", "nr_throttled", "2"},
+		SampleType:    []*pb.ValueType{{Type: 1, Unit: 2}},
+		DurationNanos: int64(10 * time.Second),
+		Sample: []*pb.Sample{
+			{Value: []int64{int64(5 * time.Second)}, Label: []*pb.Label{{Key: 3, Str: 6}, {Key: 4, Num: 100}, {Key: 5, Num: 10}}},
+			{Value: []int64{int64(10 * time.Second)}, Label: []*pb.Label{{Key: 4, Num: 90}}},
+		},
+	}
+	l := FromLabels(p)
+	if l.Cores != 2 || l.Periods != 100 || l.Throttled != 10 {
+		t.Errorf("Expected 2 cores throttled in 10 of 100 periods, got %+v", l)
+	}
+	if usage := Usage(p); usage != 1.5 {
+		t.Errorf("Expected usage of 1.5 cores, got %v", usage)
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	if c := FromMetrics(map[string]float64{"go_gomaxprocs": 64}).Capacity(); c != 64 {
+		t.Errorf("Expected the 64 cores of the host, got %v", c)
+	}
+	if c := FromMetrics(map[string]float64{"go_gomaxprocs": 64, "cpu_limit": 2}).Capacity(); c != 2 {
+		t.Errorf("Expected the limit of 2 cores, got %v", c)
+	}
+}
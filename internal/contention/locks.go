@@ -0,0 +1,76 @@
+package contention
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Lock is a critical section: a site of a mutex profile, where Go records the
+// wait of the goroutines blocked on a lock when it is unlocked, along with
+// the cpu of the function holding the lock there.
+type Lock struct {
+	Site  *pb.ContentionSite
+	CPU   float64 // cpu % of the site's function including callees
+	Wait  float64 // % of the delay of the mutex profile
+	Score float64 // CPU × Wait / 100, high for long held, contended locks
+}
+
+// RankLocks ranks the critical sections of the mutex profile by the cpu their
+// functions use in the cpu profile times the wait for them, pointing at the
+// locks worth splitting or holding shorter, e.g. by moving work out of them.
+func RankLocks(cpuProfile, mutex *pb.Profile, opts pb.AnalyzeOptions) ([]*Lock, error) {
+	nodes, err := pb.AnalyzeCPUProfile(cpuProfile, opts)
+	if err != nil {
+		return nil, fmt.Errorf("cpu profile: %w", err)
+	}
+	sites, err := pb.AnalyzeContentionProfile(mutex)
+	if err != nil {
+		return nil, fmt.Errorf("mutex profile: %w", err)
+	}
+
+	var delay int64
+	for _, site := range sites {
+		delay += site.Delay
+	}
+	locks := make([]*Lock, 0, len(sites))
+	for _, site := range sites {
+		lock := &Lock{Site: site}
+		if node := nodes[site.Name]; node != nil {
+			lock.CPU = node.TotalCPU
+		}
+		if delay > 0 {
+			lock.Wait = float64(site.Delay) / float64(delay) * 100
+		}
+		lock.Score = lock.CPU * lock.Wait / 100
+		locks = append(locks, lock)
+	}
+	sort.SliceStable(locks, func(i, j int) bool {
+		if locks[i].Score != locks[j].Score {
+			return locks[i].Score > locks[j].Score
+		}
+		return locks[i].Wait > locks[j].Wait
+	})
+	return locks, nil
+}
+
+// TransformLocks writes the top critical sections of RankLocks, one per line as "score cpu wait delay contentions function in file:line", function names are formatted by the style
+func TransformLocks(cpuProfile, mutex *pb.Profile, w io.Writer, opts pb.AnalyzeOptions, top int, style term.Style) error {
+	locks, err := RankLocks(cpuProfile, mutex, opts)
+	if err != nil {
+		return err
+	}
+
+	if top > 0 && len(locks) > top {
+		locks = locks[:top]
+	}
+	for _, lock := range locks {
+		site := lock.Site
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s in %s:%d\n", style.Locale.Format(lock.Score, 2), style.Percent(lock.CPU), style.Locale.Format(lock.Wait, 2), time.Duration(site.Delay), style.Locale.FormatInt(int(site.Contentions)), style.Name(site.Name), site.FileName, site.Line)
+	}
+	return nil
+}
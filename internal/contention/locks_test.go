@@ -0,0 +1,49 @@
+package contention
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestRankLocks(t *testing.T) {
+	cpu := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	cpu.AddSample([]pb.Stack{{Name: "main.(*Cache).Set"}, {Name: "main.main"}}, []int64{50}, nil)
+	cpu.AddSample([]pb.Stack{{Name: "main.(*Cache).Get"}, {Name: "main.main"}}, []int64{10}, nil)
+	cpu.AddSample([]pb.Stack{{Name: "main.main"}}, []int64{40}, nil)
+
+	// Set holds its lock for longer but Get waits more often
+	mutex := pb.NewBuilder([2]string{"contentions", "count"}, [2]string{"delay", "nanoseconds"})
+	unlock := pb.Stack{Name: "sync.(*Mutex).Unlock"}
+	mutex.AddSample([]pb.Stack{unlock, {Name: "main.(*Cache).Set", FileName: "cache.go", Line: 12}, {Name: "main.main"}}, []int64{4, 400}, nil)
+	mutex.AddSample([]pb.Stack{unlock, {Name: "main.(*Cache).Get", FileName: "cache.go", Line: 20}, {Name: "main.main"}}, []int64{12, 600}, nil)
+
+	locks, err := RankLocks(cpu.Profile(), mutex.Profile(), pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locks) != 2 {
+		t.Fatalf("Expected 2 locks, got %d", len(locks))
+	}
+	if set := locks[0]; set.Site.Name != "main.(*Cache).Set" || set.CPU != 50 || set.Wait != 40 || set.Score != 20 {
+		t.Errorf("Expected Set first with 50%% cpu × 40%% wait, got %+v", set)
+	}
+	if get := locks[1]; get.Site.Name != "main.(*Cache).Get" || get.Score != 6 {
+		t.Errorf("Expected Get second with a score of 6, got %+v", get)
+	}
+
+	var buf bytes.Buffer
+	if err := TransformLocks(cpu.Profile(), mutex.Profile(), &buf, pb.AnalyzeOptions{}, 1, term.Style{}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "20.00\t50.00\t40.00\t400ns\t4\tmain.(*Cache).Set in cache.go:12\n"; buf.String() != want {
+		t.Errorf("Expected %q, got %q", want, buf.String())
+	}
+
+	if _, err := RankLocks(mutex.Profile(), mutex.Profile(), pb.AnalyzeOptions{}); err == nil || !strings.Contains(err.Error(), "cpu profile") {
+		t.Errorf("Expected error for a missing cpu profile, got %v", err)
+	}
+}
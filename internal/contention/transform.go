@@ -0,0 +1,44 @@
+package contention
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// maxStacks is the number of contending stacks printed under each site.
+const maxStacks = 3
+
+// Transform converts a block or mutex pprof into a raw text report of the top contended call sites, each followed by the goroutine stacks that waited there, function names are formatted by the style
+func Transform(pprof *pb.Profile, w io.Writer, top int, style term.Style) error {
+	sites, err := pb.AnalyzeContentionProfile(pprof)
+	if err != nil {
+		return err
+	}
+
+	if top > 0 && len(sites) > top {
+		sites = sites[:top]
+	}
+
+	for _, site := range sites {
+		fmt.Fprintf(w, "%s\t%d\t%s in %s:%d\n", time.Duration(site.Delay), site.Contentions, style.Name(site.Name), site.FileName, site.Line)
+
+		stacks := site.Stacks
+		if len(stacks) > maxStacks {
+			stacks = stacks[:maxStacks]
+		}
+		for _, stack := range stacks {
+			names := make([]string, len(stack.Frames))
+			for i, frame := range stack.Frames {
+				names[i] = style.Name(frame.Name)
+			}
+			fmt.Fprintf(w, "\t%s\t%d\t%s\n", time.Duration(stack.Delay), stack.Contentions, strings.Join(names, " <- "))
+		}
+	}
+
+	return nil
+}
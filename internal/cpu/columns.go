@@ -0,0 +1,118 @@
+package cpu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Column is a column of the text format, one line per function.
+type Column struct {
+	Name   string
+	Help   string
+	format func(node *pb.FunctionNode, style term.Style) string
+}
+
+// Columns are the columns the text format can be made of, see term.Style.Columns.
+var Columns = []Column{
+	{"attr", "attributed self cpu %, self cpu plus the cpu of attributed callees", func(node *pb.FunctionNode, style term.Style) string { return style.Percent(node.SelfAttrCPU) }},
+	{"self", "self cpu %", func(node *pb.FunctionNode, style term.Style) string { return style.Percent(node.SelfCPU) }},
+	{"total", "cpu % including callees", func(node *pb.FunctionNode, style term.Style) string { return style.Percent(node.TotalCPU) }},
+	{"cores", "attributed cpu in cores, needs the duration of the profile", func(node *pb.FunctionNode, style term.Style) string {
+		if style.UsedCores == 0 {
+			return "-"
+		}
+		return style.Locale.Format(node.SelfAttrCPU/100*style.UsedCores, 3)
+	}},
+	{"host", "attributed cpu % of the cores of the host or the cpu limit of the container, see --host-cores", func(node *pb.FunctionNode, style term.Style) string {
+		if style.UsedCores == 0 || style.HostCores == 0 {
+			return "-"
+		}
+		return style.Percent(node.SelfAttrCPU * style.UsedCores / style.HostCores)
+	}},
+	{"samples", "number of samples the function appears in", func(node *pb.FunctionNode, style term.Style) string { return style.Locale.FormatInt(node.Samples) }},
+	{"stacks", "number of distinct stacks the function appears in", func(node *pb.FunctionNode, style term.Style) string { return style.Locale.FormatInt(node.Stacks) }},
+	{"callers", "number of distinct callers of the function", func(node *pb.FunctionNode, style term.Style) string { return style.Locale.FormatInt(node.Callers) }},
+	{"depth", "mean depth of the function in its samples, 1 for entry points", func(node *pb.FunctionNode, style term.Style) string {
+		return style.Locale.Format(node.Depth, 1)
+	}},
+	{"priority", "optimization priority score of the function, see --priority", func(node *pb.FunctionNode, style term.Style) string {
+		return style.Locale.Format(priority(style.Priority)(node), 2)
+	}},
+	{"name", "function name", func(node *pb.FunctionNode, style term.Style) string { return style.Name(node.Name) }},
+	{"file", "source file of the function", func(node *pb.FunctionNode, style term.Style) string { return node.FileName }},
+	{"function", `"name in file", truncated to the terminal width when last`, func(node *pb.FunctionNode, style term.Style) string { return style.Function(node.Name, node.FileName) }},
+}
+
+// DefaultColumns are the columns of the text format unless the style sets
+// others.
+var DefaultColumns = []string{"attr", "function"}
+
+// hostColumns are the columns of the text format when the style knows the
+// cores of the profile and its host.
+var hostColumns = []string{"attr", "cores", "host", "function"}
+
+// countColumns are the columns of the text format when the style sets Counts.
+var countColumns = []string{"attr", "samples", "stacks", "callers", "function"}
+
+// columnsByName indexes Columns.
+var columnsByName = func() map[string]Column {
+	byName := make(map[string]Column, len(Columns))
+	for _, column := range Columns {
+		byName[column.Name] = column
+	}
+	return byName
+}()
+
+// ParseColumns returns the names of a comma separated list of columns, or an
+// error naming the available columns if one is unknown.
+func ParseColumns(list string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if _, exists := columnsByName[name]; !exists {
+			available := make([]string, len(Columns))
+			for i, column := range Columns {
+				available[i] = column.Name
+			}
+			return nil, fmt.Errorf("unknown column %q, available columns are %s", name, strings.Join(available, ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// formatColumns returns the line of a function made of the style's columns.
+func formatColumns(node *pb.FunctionNode, style term.Style) string {
+	names := style.Columns
+	if len(names) == 0 {
+		names = DefaultColumns
+		if style.UsedCores > 0 && style.HostCores > 0 {
+			names = hostColumns
+		}
+		if style.Counts {
+			names = countColumns
+		}
+		if style.RankByPriority {
+			names = append([]string{"priority"}, names...)
+		}
+	}
+
+	// The columns before the function take up at least a tab stop each.
+	style = style.After(len(names) - 1)
+	// Margins of error take up another tab stop after each percentage.
+	if style.Width > 0 && style.SampleSize > 0 {
+		for _, name := range names {
+			if name == "attr" || name == "self" || name == "total" || name == "host" {
+				style.Width -= 8
+			}
+		}
+	}
+	fields := make([]string, len(names))
+	for i, name := range names {
+		fields[i] = columnsByName[name].format(node, style)
+	}
+	return strings.Join(fields, "\t")
+}
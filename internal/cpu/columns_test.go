@@ -0,0 +1,48 @@
+package cpu
+
+import (
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestColumns(t *testing.T) {
+	node := &pb.FunctionNode{
+		Name:        "github.com/org/repo/store.Get",
+		FileName:    "store.go",
+		SelfAttrCPU: 12.5,
+		SelfCPU:     10,
+		TotalCPU:    40,
+		Samples:     7,
+		Stacks:      3,
+		Callers:     2,
+	}
+
+	columns, err := ParseColumns("self, total,samples,name,file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		style term.Style
+		want  string
+	}{
+		{term.Style{}, "12.50\tgithub.com/org/repo/store.Get in store.go"},
+		{term.Style{Counts: true}, "12.50\t7\t3\t2\tgithub.com/org/repo/store.Get in store.go"},
+		{term.Style{Columns: columns, ShortNames: true}, "10.00\t40.00\t7\tstore.Get\tstore.go"},
+		// 12.5% of 1.6 cores is 0.2 cores, 10% of a 2 core pod and 0.31% of
+		// a 64 core host.
+		{term.Style{UsedCores: 1.6, HostCores: 2, ShortNames: true}, "12.50\t0.200\t10.00\tstore.Get in store.go"},
+		{term.Style{UsedCores: 1.6, HostCores: 64, ShortNames: true}, "12.50\t0.200\t0.31\tstore.Get in store.go"},
+		{term.Style{Columns: []string{"cores", "host"}}, "-\t-"},
+	}
+	for _, tt := range tests {
+		if got := formatColumns(node, tt.style); got != tt.want {
+			t.Errorf("Expected %q, got %q", tt.want, got)
+		}
+	}
+
+	if _, err := ParseColumns("attr,owner"); err == nil {
+		t.Error("Expected error for unknown column owner")
+	}
+}
@@ -0,0 +1,97 @@
+package cpu
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/kmrgirish/pprof-adv/internal/theme"
+)
+
+// Layout of flamegraphs, in pixels, the same as of the differential ones of
+// internal/diff.
+const (
+	flameWidth       = 1200
+	flameFrameHeight = 16
+	flameMargin      = 10
+	flameHeader      = 40
+	flameCharWidth   = 7 // approximate width of a character of the 12px font
+	flameMinWidth    = 0.1
+)
+
+// Flamegraph is the Formatter of the flamegraph of the call tree of a
+// profile, an SVG image styled by the theme with the root at the bottom and
+// frames as wide as their share of the total. Like the HTML call tree, it only
+// applies the sample type, the focus and ignore filters, the max depth and the
+// trim of the options.
+type Flamegraph struct {
+	Title string
+	Theme theme.Theme
+}
+
+// Format writes the flamegraph of the profile of the analysis.
+func (f Flamegraph) Format(a *Analysis, w io.Writer) error {
+	tree, err := callTree(a.Profile, a.Options, false, minTreeShare)
+	if err != nil {
+		return err
+	}
+	height := flameHeader + (tree.depth()+1)*flameFrameHeight + 2*flameMargin
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="Verdana, sans-serif" font-size="12">`+"\n", flameWidth, height, flameWidth, height)
+	b.WriteString(f.Theme.Style())
+	fmt.Fprintf(&b, `<rect class="background" width="100%%" height="100%%" fill="#fafafa"/>`+"\n")
+	fmt.Fprintf(&b, `<text x="%d" y="24" text-anchor="middle" font-size="16">%s</text>`+"\n", flameWidth/2, html.EscapeString(f.Title))
+
+	scale := float64(flameWidth-2*flameMargin) / tree.Value
+	writeFlameFrames(&b, tree, flameMargin, height-flameMargin-flameFrameHeight, scale, f.Theme.Dark)
+	b.WriteString("</svg>\n")
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// depth returns the number of levels of the tree below n.
+func (n *htmlNode) depth() int {
+	d := 0
+	for _, child := range n.Children {
+		d = max(d, child.depth()+1)
+	}
+	return d
+}
+
+// writeFlameFrames writes the frame of n at x, y and its children above it.
+func writeFlameFrames(b *strings.Builder, n *htmlNode, x float64, y int, scale float64, dark bool) {
+	width := n.Value * scale
+	if width < flameMinWidth {
+		return
+	}
+	tooltip := fmt.Sprintf("%s\n%.2f%%", n.Name, n.Value)
+	fmt.Fprintf(b, `<g><title>%s</title><rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s" stroke="#fff" stroke-width="0.5"/>`, html.EscapeString(tooltip), x, y, width, flameFrameHeight-1, flameFrameColor(n.Name, dark))
+	if chars := int(width-6) / flameCharWidth; chars >= 3 {
+		label := n.Name
+		if len(label) > chars {
+			label = label[:chars-2] + ".."
+		}
+		fmt.Fprintf(b, `<text x="%.1f" y="%d">%s</text>`, x+3, y+flameFrameHeight-4, html.EscapeString(label))
+	}
+	b.WriteString("</g>\n")
+
+	for _, child := range n.Children {
+		writeFlameFrames(b, child, x, y-flameFrameHeight, scale, dark)
+		x += child.Value * scale
+	}
+}
+
+// flameFrameColor returns the warm color of a frame, derived from its name so
+// that a function has the same color wherever it appears.
+func flameFrameColor(name string, dark bool) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	v := h.Sum32()
+	red, green, blue := 205+int(v%50), 80+int(v/50%150), 40+int(v/7500%40)
+	if dark {
+		red, green, blue = red*3/5, green*3/5, blue*3/5
+	}
+	return fmt.Sprintf("rgb(%d,%d,%d)", red, green, blue)
+}
@@ -0,0 +1,34 @@
+package cpu
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/internal/theme"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestFlamegraph(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "store.Get"}, {Name: "main.main"}}, []int64{75}, nil)
+	b.AddSample([]pb.Stack{{Name: "main.main"}}, []int64{25}, nil)
+	a, err := Analyze(b.Profile(), pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := (Flamegraph{Title: "cpu <profile>", Theme: theme.Light}).Format(a, &buf); err != nil {
+		t.Fatal(err)
+	}
+	svg := buf.String()
+	for _, want := range []string{"<svg ", "cpu &lt;profile&gt;", "main.main\n100.00%", "store.Get\n75.00%", "</svg>\n"} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("Expected %q in the flamegraph, got\n%s", want, svg)
+		}
+	}
+	if flameFrameColor("main.main", false) != flameFrameColor("main.main", false) || flameFrameColor("main.main", false) == flameFrameColor("main.main", true) {
+		t.Error("Expected a stable color per function, darker on dark themes")
+	}
+}
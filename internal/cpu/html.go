@@ -0,0 +1,200 @@
+package cpu
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/internal/theme"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// minTreeShare is the share of the total, in percent, below which call paths
+// are left out of the call tree of HTML reports to bound their size.
+const minTreeShare = 0.01
+
+// htmlReport is the report embedded as JSON in HTML reports, rendered by the
+// script of the page.
+type htmlReport struct {
+	Title     string         `json:"title"`
+	Locale    string         `json:"locale,omitempty"` // BCP 47 tag numbers are formatted in, "" for none
+	Functions []htmlFunction `json:"functions"`        // by descending attributed cpu
+	Tree      *htmlNode      `json:"tree"`
+	Warnings  []string       `json:"warnings,omitempty"` // data quality issues, shown in the footer
+	// Fingerprint is the hash of the contents of the profile, see
+	// pb.Fingerprint, telling whether two reports are of the same profile.
+	Fingerprint string `json:"fingerprint"`
+	// Index maps the lower case words of the names and files of the functions
+	// to their ascending indexes in Functions, for the search of the page.
+	Index map[string][]int `json:"index"`
+}
+
+// htmlFunction is a function of an HTML report, usages are in percent.
+type htmlFunction struct {
+	Name    string  `json:"name"`
+	Anchor  string  `json:"anchor"`
+	File    string  `json:"file,omitempty"`
+	Package string  `json:"package"`
+	AttrCPU float64 `json:"attr"`
+	SelfCPU float64 `json:"self"`
+	Total   float64 `json:"total"`
+}
+
+// htmlNode is a call path of the call tree of an HTML report, its value is
+// its share of the total in percent.
+type htmlNode struct {
+	Name     string      `json:"name"`
+	Value    float64     `json:"value"`
+	Children []*htmlNode `json:"children,omitempty"`
+
+	index map[string]*htmlNode
+}
+
+// HTML is the Formatter of TransformHTML.
+type HTML struct {
+	Title  string
+	Theme  theme.Theme
+	Locale term.Locale
+}
+
+// TransformHTML writes an HTML report of the profile with the table of functions by attributed cpu, paginated and searched as you type with an index embedded in the page, and, selectable via tabs, an icicle chart and a sunburst of the call tree and a treemap of the attributed cpu by package, all rendered from the report embedded in the page as JSON, styled by the theme and with numbers written in the locale, and the warnings of the analysis and the fingerprint of the profile in a footer. The call tree only applies the sample type, the focus and ignore filters, the max depth and the trim of the options
+func TransformHTML(pprof *pb.Profile, w io.Writer, opts pb.AnalyzeOptions, title string, th theme.Theme, locale term.Locale) error {
+	return transform(pprof, w, opts, HTML{title, th, locale})
+}
+
+// Format writes the analysis like TransformHTML.
+func (f HTML) Format(a *Analysis, w io.Writer) error {
+	pprof, ingested := a.Profile, a.Report
+	tree, err := callTree(pprof, a.Options, false, minTreeShare)
+	if err != nil {
+		return err
+	}
+
+	report := htmlReport{Title: f.Title, Locale: f.Locale.Tag, Tree: tree, Warnings: ingested.Warnings(), Fingerprint: pb.Fingerprint(pprof), Index: make(map[string][]int)}
+	for i, node := range sortedNodes(a.Nodes()) {
+		for _, word := range searchWords(node.Name + " " + node.FileName) {
+			if postings := report.Index[word]; len(postings) == 0 || postings[len(postings)-1] != i {
+				report.Index[word] = append(postings, i)
+			}
+		}
+		pkg := pb.FuncPackage(node.Name)
+		if pkg == "" {
+			pkg = "(other)"
+		}
+		report.Functions = append(report.Functions, htmlFunction{
+			Name:    node.Name,
+			Anchor:  anchor(node.Name),
+			File:    node.FileName,
+			Package: pkg,
+			AttrCPU: node.SelfAttrCPU,
+			SelfCPU: node.SelfCPU,
+			Total:   node.TotalCPU,
+		})
+	}
+	return htmlTemplate.Execute(w, struct {
+		Report htmlReport
+		Theme  theme.Theme
+	}{report, f.Theme})
+}
+
+// callTree returns the call tree of the profile valued in percent of the
+// total of the sample type, without the call paths below min percent, or the
+// TrimBelow of the options, and with paths truncated to its MaxDepth. The
+// tree is rooted at the leaves of the stacks, branching by callers, when
+// bottomUp is set.
+func callTree(pprof *pb.Profile, opts pb.AnalyzeOptions, bottomUp bool, min float64) (*htmlNode, error) {
+	idx, err := pb.SampleTypeIndex(pprof, opts.SampleType)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &htmlNode{Name: "root"}
+	for i, frames := range pb.Frames(pprof) {
+		if !pb.KeepFrames(frames, opts) {
+			continue
+		}
+		value := float64(pprof.Sample[i].Value[idx])
+		root.Value += value
+		if bottomUp {
+			frames = slices.Clone(frames)
+			slices.Reverse(frames)
+		}
+		frames = pb.TrimFrames(frames, opts)
+		node := root
+		for _, name := range frames {
+			child := node.index[name]
+			if child == nil {
+				if node.index == nil {
+					node.index = make(map[string]*htmlNode)
+				}
+				child = &htmlNode{Name: name}
+				node.index[name] = child
+				node.Children = append(node.Children, child)
+			}
+			child.Value += value
+			node = child
+		}
+	}
+	if root.Value == 0 {
+		return nil, fmt.Errorf("no CPU time recorded in profile")
+	}
+	if opts.TrimBelow > 0 {
+		min = opts.TrimBelow
+	}
+	root.scale(100/root.Value, min)
+	return root, nil
+}
+
+// scale multiplies the values of the tree by factor, dropping the nodes below
+// min after scaling, and orders children by descending value.
+func (n *htmlNode) scale(factor, min float64) {
+	n.Value *= factor
+	kept := n.Children[:0]
+	for _, child := range n.Children {
+		if child.Value*factor >= min {
+			child.scale(factor, min)
+			kept = append(kept, child)
+		}
+	}
+	n.Children = kept
+	sort.Slice(n.Children, func(i, j int) bool {
+		if n.Children[i].Value != n.Children[j].Value {
+			return n.Children[i].Value > n.Children[j].Value
+		}
+		return n.Children[i].Name < n.Children[j].Name
+	})
+}
+
+// searchWords splits text into the lower case words the search of HTML
+// reports matches the prefixes of, e.g. "encoding/json.(*Encoder).Encode"
+// into encoding, json, encoder and encode.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
+
+// anchor returns the id of the element of a function in HTML reports, which
+// links such as report.html#github.com/org/pkg.Func point to. It only depends
+// on the name so that links stay valid when the report is regenerated.
+func anchor(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// reportHTML is the template of HTML reports, see TransformHTML.
+//
+//go:embed report.html
+var reportHTML string
+
+var htmlTemplate = template.Must(template.New("report").Parse(reportHTML))
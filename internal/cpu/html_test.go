@@ -0,0 +1,120 @@
+package cpu
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/internal/theme"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestTransformHTML(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "github.com/org/repo/store.Get", FileName: "store.go"}, {Name: "main.main", FileName: "main.go"}}, []int64{75}, nil)
+	b.AddSample([]pb.Stack{{Name: "main.main", FileName: "main.go"}}, []int64{25}, nil)
+
+	var buf bytes.Buffer
+	if err := TransformHTML(b.Profile(), &buf, pb.AnalyzeOptions{}, "cpu.pprof", theme.Light, term.Locale{}); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	for _, tab := range []string{"table", "icicle", "sunburst", "treemap"} {
+		if !strings.Contains(page, `data-tab="`+tab+`"`) {
+			t.Errorf("Expected a %s tab, got %s", tab, page)
+		}
+	}
+
+	match := regexp.MustCompile(`const report = (.*);`).FindStringSubmatch(page)
+	if match == nil {
+		t.Fatalf("Expected the report embedded as JSON, got %s", page)
+	}
+	var report htmlReport
+	if err := json.Unmarshal([]byte(match[1]), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Title != "cpu.pprof" || len(report.Functions) != 2 {
+		t.Fatalf("Expected 2 functions of cpu.pprof, got %+v", report)
+	}
+	if fn := report.Functions[0]; fn.Name != "github.com/org/repo/store.Get" || fn.Anchor != fn.Name || fn.Package != "github.com/org/repo/store" || fn.AttrCPU != 75 {
+		t.Errorf("Expected store.Get first with 75%% in github.com/org/repo/store, got %+v", fn)
+	}
+
+	if got := report.Index["store"]; len(got) != 1 || got[0] != 0 {
+		t.Errorf("Expected store to index store.Get, got %v", got)
+	}
+	if got := report.Index["main"]; len(got) != 1 || got[0] != 1 {
+		t.Errorf("Expected main to index main.main once, got %v", got)
+	}
+	if got := report.Index["go"]; len(got) != 2 {
+		t.Errorf("Expected go to index the files of both functions, got %v", got)
+	}
+
+	tree := report.Tree
+	if tree.Value != 100 || len(tree.Children) != 1 || tree.Children[0].Name != "main.main" || tree.Children[0].Value != 100 {
+		t.Fatalf("Expected root -> main.main at 100%%, got %+v", tree)
+	}
+	if children := tree.Children[0].Children; len(children) != 1 || children[0].Name != "github.com/org/repo/store.Get" || children[0].Value != 75 {
+		t.Errorf("Expected main.main -> store.Get at 75%%, got %+v", children)
+	}
+}
+
+func TestTransformHTMLTheme(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "main.main", FileName: "main.go"}}, []int64{100}, nil)
+
+	var buf bytes.Buffer
+	if err := TransformHTML(b.Profile(), &buf, pb.AnalyzeOptions{}, "cpu.pprof", theme.Dark, term.Locale{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), string(theme.Dark.CSS)+"</style>") {
+		t.Errorf("Expected the dark stylesheet after the report's, got %s", buf.String())
+	}
+}
+
+func TestAnchors(t *testing.T) {
+	if got := anchor("main.go:12 main.main"); got != "main.go:12_main.main" {
+		t.Errorf("Expected whitespace replaced in anchors, got %q", got)
+	}
+
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "github.com/org/repo/store.Get", FileName: "store.go"}, {Name: "main.main", FileName: "main.go"}}, []int64{100}, map[string]string{"route": "/items"})
+
+	var buf bytes.Buffer
+	if err := TransformPivot(b.Profile(), &buf, pb.AnalyzeOptions{}, "route", "html", term.Style{ShortNames: true}, theme.Light); err != nil {
+		t.Fatal(err)
+	}
+	// rows are anchored by the full name even when short names are shown
+	if want := `<tr id="github.com/org/repo/store.Get"><td class="fn" title="store.go"><a href="#github.com/org/repo/store.Get">store.Get</a>`; !strings.Contains(buf.String(), want) {
+		t.Errorf("Expected the row %s, got %s", want, buf.String())
+	}
+}
+
+func TestPivotLocale(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "main.work", FileName: "main.go"}}, []int64{1}, map[string]string{"route": "/a"})
+	b.AddSample([]pb.Stack{{Name: "main.work", FileName: "main.go"}}, []int64{2}, map[string]string{"route": "/b"})
+	de, err := term.ParseLocale("de-DE")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := TransformPivot(b.Profile(), &buf, pb.AnalyzeOptions{}, "route", "csv", term.Style{Locale: de}, theme.Light); err != nil {
+		t.Fatal(err)
+	}
+	if want := "function;file;/b;/a\nmain.work;main.go;66,67;33,33\n"; buf.String() != want {
+		t.Errorf("Expected %q, got %q", want, buf.String())
+	}
+
+	buf.Reset()
+	if err := TransformHTML(b.Profile(), &buf, pb.AnalyzeOptions{}, "cpu.pprof", theme.Light, de); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"locale":"de-DE"`) {
+		t.Errorf("Expected the locale in the embedded report, got %s", buf.String())
+	}
+}
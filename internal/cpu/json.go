@@ -0,0 +1,122 @@
+package cpu
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+	"github.com/kmrgirish/pprof-adv/report"
+)
+
+// JSON is the Formatter of TransformJSON for profiles of the type.
+type JSON struct {
+	Type string
+}
+
+// Format writes the analysis like TransformJSON.
+func (f JSON) Format(a *Analysis, w io.Writer) error {
+	out, nodes, err := reportOf(a, f.Type)
+	if err != nil {
+		return err
+	}
+	out.Functions = make([]report.Function, 0, len(nodes))
+	for _, node := range nodes {
+		out.Functions = append(out.Functions, reportFunction(node))
+	}
+	return out.Encode(w)
+}
+
+// TransformJSON writes the usage of every function of the profile of the given type as a versioned report.Report, the machine-readable counterpart of Transform for dashboards
+func TransformJSON(pprof *pb.Profile, w io.Writer, opts pb.AnalyzeOptions, typ string) error {
+	return transform(pprof, w, opts, JSON{typ})
+}
+
+// NDJSON is the Formatter of TransformNDJSON for profiles of the type.
+type NDJSON struct {
+	Type string
+}
+
+// Format writes the analysis like TransformNDJSON.
+func (f NDJSON) Format(a *Analysis, w io.Writer) error {
+	header, err := reportHeader(a, f.Type)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	enc := report.NewRowEncoder(bw, header)
+	err = a.Each(func(node *pb.FunctionNode) error {
+		return enc.Encode(reportFunction(node))
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// TransformNDJSON writes the usage of every function of the profile of the given type as one report.Row per line, which is written as soon as it is formatted rather than after the whole document, for piping very large reports into jq or loading them into BigQuery
+func TransformNDJSON(pprof *pb.Profile, w io.Writer, opts pb.AnalyzeOptions, typ string) error {
+	return transform(pprof, w, opts, NDJSON{typ})
+}
+
+// TransformRows calls write with the report.Row of every function of the profile of the given type, in the order of the report, e.g. to load them into a data warehouse
+func TransformRows(pprof *pb.Profile, opts pb.AnalyzeOptions, typ string, write func(report.Row) error) error {
+	a, err := Analyze(pprof, opts)
+	if err != nil {
+		return err
+	}
+	header, err := reportHeader(a, typ)
+	if err != nil {
+		return err
+	}
+	rank := 0
+	return a.Each(func(node *pb.FunctionNode) error {
+		rank++
+		return write(report.NewRow(header, rank, reportFunction(node)))
+	})
+}
+
+// reportOf returns the report of the analysis without its functions and the
+// nodes of the functions, sorted as reports list them.
+func reportOf(a *Analysis, typ string) (*report.Report, []*pb.FunctionNode, error) {
+	out, err := reportHeader(a, typ)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, sortedNodes(a.Nodes()), nil
+}
+
+// reportHeader returns the report of the analysis without its functions.
+func reportHeader(a *Analysis, typ string) (*report.Report, error) {
+	pprof, ingested := a.Profile, a.Report
+	idx, err := pb.SampleTypeIndex(pprof, a.Options.SampleType)
+	if err != nil {
+		return nil, err
+	}
+	sampleType := pprof.SampleType[idx]
+
+	return &report.Report{
+		Type:          typ,
+		SampleType:    pprof.StringTable[sampleType.Type],
+		Unit:          pprof.StringTable[sampleType.Unit],
+		Total:         ingested.Total(),
+		DurationNanos: pprof.DurationNanos,
+		Fingerprint:   pb.Fingerprint(pprof),
+		Warnings:      ingested.Warnings(),
+	}, nil
+}
+
+// reportFunction returns the report.Function of a node.
+func reportFunction(node *pb.FunctionNode) report.Function {
+	return report.Function{
+		Name:         node.Name,
+		File:         node.FileName,
+		Module:       node.Module,
+		Version:      node.Version,
+		AttrPercent:  node.SelfAttrCPU,
+		SelfPercent:  node.SelfCPU,
+		TotalPercent: node.TotalCPU,
+		Samples:      node.Samples,
+		Stacks:       node.Stacks,
+		Callers:      node.Callers,
+	}
+}
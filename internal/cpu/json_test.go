@@ -0,0 +1,72 @@
+package cpu
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+	"github.com/kmrgirish/pprof-adv/report"
+)
+
+func TestTransformJSON(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "github.com/org/repo/store.Get", FileName: "store.go"}, {Name: "main.main", FileName: "main.go"}}, []int64{75}, nil)
+	b.AddSample([]pb.Stack{{Name: "main.main", FileName: "main.go"}}, []int64{25}, nil)
+
+	var buf bytes.Buffer
+	if err := TransformJSON(b.Profile(), &buf, pb.AnalyzeOptions{}, "cpu"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := report.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.SchemaVersion != report.SchemaVersion || got.Type != "cpu" || got.SampleType != "cpu" || got.Unit != "nanoseconds" || got.Total != 100 {
+		t.Errorf("Expected a cpu report of 100 nanoseconds, got %+v", got)
+	}
+	if got.Fingerprint != pb.Fingerprint(b.Profile()) {
+		t.Errorf("Expected the fingerprint of the profile, got %q", got.Fingerprint)
+	}
+	want := []report.Function{
+		{Name: "github.com/org/repo/store.Get", File: "store.go", AttrPercent: 75, SelfPercent: 75, TotalPercent: 75, Samples: 1, Stacks: 1, Callers: 1},
+		{Name: "main.main", File: "main.go", AttrPercent: 25, SelfPercent: 25, TotalPercent: 100, Samples: 2, Stacks: 2},
+	}
+	if len(got.Functions) != len(want) {
+		t.Fatalf("Expected %d functions, got %+v", len(want), got.Functions)
+	}
+	for i := range want {
+		if got.Functions[i] != want[i] {
+			t.Errorf("Expected %+v, got %+v", want[i], got.Functions[i])
+		}
+	}
+	if len(got.Warnings) != 1 || got.Warnings[0] != "the profile has no duration, so its cores and rates are unknown" {
+		t.Errorf("Expected a warning about the missing duration, got %q", got.Warnings)
+	}
+}
+
+func TestTransformNDJSON(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "github.com/org/repo/store.Get", FileName: "store.go"}, {Name: "main.main", FileName: "main.go"}}, []int64{75}, nil)
+	b.AddSample([]pb.Stack{{Name: "main.main", FileName: "main.go"}}, []int64{25}, nil)
+
+	var buf bytes.Buffer
+	if err := TransformNDJSON(b.Profile(), &buf, pb.AnalyzeOptions{}, "cpu"); err != nil {
+		t.Fatal(err)
+	}
+	dec := json.NewDecoder(&buf)
+	var rows []report.Row
+	for dec.More() {
+		var row report.Row
+		if err := dec.Decode(&row); err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %+v", rows)
+	}
+	if rows[0].Rank != 1 || rows[0].Name != "github.com/org/repo/store.Get" || rows[0].Total != 100 || rows[1].Rank != 2 || rows[1].TotalPercent != 100 {
+		t.Errorf("Expected store.Get then main.main of a 100 nanoseconds report, got %+v", rows)
+	}
+}
@@ -0,0 +1,135 @@
+package cpu
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"html/template"
+	"io"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/internal/theme"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// TransformPivot writes the attributed cpu of every function broken down by the values of the label key, as CSV or, when format is "html", as an HTML heatmap styled by the theme, function names are formatted by the style
+func TransformPivot(pprof *pb.Profile, w io.Writer, opts pb.AnalyzeOptions, key, format string, style term.Style, th theme.Theme) error {
+	pivot, err := pb.AnalyzeCPUByLabel(pprof, opts, key)
+	if err != nil {
+		return err
+	}
+
+	var counts map[string]*pb.FunctionNode
+	if style.Counts {
+		if counts, err = pb.AnalyzeCPUProfile(pprof, opts); err != nil {
+			return err
+		}
+	}
+
+	if format == "html" {
+		return writePivotHTML(w, pivot, counts, style, th)
+	}
+	return writePivotCSV(w, pivot, counts, style)
+}
+
+// countFields returns the sample, stack and caller counts of the function,
+// which may be missing from counts when it was aggregated differently.
+func countFields(counts map[string]*pb.FunctionNode, fn string, locale term.Locale) []string {
+	node := counts[fn]
+	if node == nil {
+		return []string{"", "", ""}
+	}
+	return []string{locale.FormatInt(node.Samples), locale.FormatInt(node.Stacks), locale.FormatInt(node.Callers)}
+}
+
+// writePivotCSV writes one row per function and one column per label value,
+// preceded by the columns of the function's counts if there are any. Fields
+// are separated by semicolons in locales with a decimal comma.
+func writePivotCSV(w io.Writer, pivot *pb.LabelPivot, counts map[string]*pb.FunctionNode, style term.Style) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = style.Locale.CSVComma()
+
+	header := []string{"function", "file"}
+	if counts != nil {
+		header = append(header, "samples", "stacks", "callers")
+	}
+	if err := cw.Write(append(header, pivot.Values...)); err != nil {
+		return err
+	}
+
+	for _, fn := range pivot.Functions {
+		row := []string{style.Name(fn), pivot.FileNames[fn]}
+		if counts != nil {
+			row = append(row, countFields(counts, fn, style.Locale)...)
+		}
+		for _, value := range pivot.Values {
+			row = append(row, style.Locale.Format(pivot.CPU[fn][value], 2))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// pivotCell is a heatmap cell, Heat is the cell's cpu relative to the hottest
+// cell in [0, 1] and Text its cpu as written in the locale, "" for none.
+type pivotCell struct {
+	CPU  float64
+	Heat float64
+	Text string
+}
+
+type pivotRow struct {
+	Anchor   string
+	Link     template.URL // fragment linking to the row, unescaped to stay readable
+	Function string
+	FileName string
+	Counts   []string
+	Cells    []pivotCell
+}
+
+// pivotHTML is the template of pivot tables.
+//
+//go:embed pivot.html
+var pivotHTML string
+
+var pivotTemplate = template.Must(template.New("pivot").Parse(pivotHTML))
+
+// writePivotHTML writes the pivot as a table whose cells are shaded by cpu.
+func writePivotHTML(w io.Writer, pivot *pb.LabelPivot, counts map[string]*pb.FunctionNode, style term.Style, th theme.Theme) error {
+	var hottest float64
+	for _, values := range pivot.CPU {
+		for _, cpu := range values {
+			hottest = max(hottest, cpu)
+		}
+	}
+
+	rows := make([]pivotRow, 0, len(pivot.Functions))
+	for _, fn := range pivot.Functions {
+		row := pivotRow{Anchor: anchor(fn), Link: template.URL("#" + anchor(fn)), Function: style.Name(fn), FileName: pivot.FileNames[fn]}
+		if counts != nil {
+			row.Counts = countFields(counts, fn, style.Locale)
+		}
+		for _, value := range pivot.Values {
+			cell := pivotCell{CPU: pivot.CPU[fn][value]}
+			if cell.CPU != 0 {
+				cell.Text = style.Locale.Format(cell.CPU, 2)
+			}
+			if hottest > 0 {
+				cell.Heat = cell.CPU / hottest
+			}
+			row.Cells = append(row.Cells, cell)
+		}
+		rows = append(rows, row)
+	}
+
+	return pivotTemplate.Execute(w, struct {
+		Key    string
+		Counts bool
+		Values []string
+		Rows   []pivotRow
+		Theme  theme.Theme
+	}{pivot.Key, counts != nil, pivot.Values, rows, th})
+}
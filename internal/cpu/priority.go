@@ -0,0 +1,181 @@
+package cpu
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// DefaultPriority is the optimization priority of functions unless the style
+// sets another formula: the cpu they use themselves, times how many callers
+// benefit from optimizing them, times a factor growing with their depth, as
+// deep functions are the shared building blocks of the program.
+const DefaultPriority = "attr * callers * log2(1 + depth)"
+
+// priorityVariables are the values of a function a priority formula can use.
+var priorityVariables = map[string]func(node *pb.FunctionNode) float64{
+	"attr":    func(node *pb.FunctionNode) float64 { return node.SelfAttrCPU },
+	"self":    func(node *pb.FunctionNode) float64 { return node.SelfCPU },
+	"total":   func(node *pb.FunctionNode) float64 { return node.TotalCPU },
+	"samples": func(node *pb.FunctionNode) float64 { return float64(node.Samples) },
+	"stacks":  func(node *pb.FunctionNode) float64 { return float64(node.Stacks) },
+	"callers": func(node *pb.FunctionNode) float64 { return float64(node.Callers) },
+	"depth":   func(node *pb.FunctionNode) float64 { return node.Depth },
+}
+
+// priorityFunctions are the functions a priority formula can call.
+var priorityFunctions = map[string]func(args ...float64) float64{
+	"log":  func(args ...float64) float64 { return math.Log(args[0]) },
+	"log2": func(args ...float64) float64 { return math.Log2(args[0]) },
+	"sqrt": func(args ...float64) float64 { return math.Sqrt(args[0]) },
+	"pow":  func(args ...float64) float64 { return math.Pow(args[0], args[1]) },
+	"min":  func(args ...float64) float64 { return math.Min(args[0], args[1]) },
+	"max":  func(args ...float64) float64 { return math.Max(args[0], args[1]) },
+}
+
+// Priority is a parsed priority formula, it returns the score of a function.
+type Priority func(node *pb.FunctionNode) float64
+
+// ParsePriority parses a priority formula, a Go expression of numbers, + - * /,
+// the variables attr, self, total, samples, stacks, callers and depth of
+// functions (see Columns) and the functions log, log2, sqrt, pow, min and max,
+// e.g. DefaultPriority.
+func ParsePriority(formula string) (Priority, error) {
+	expr, err := parser.ParseExpr(formula)
+	if err != nil {
+		return nil, fmt.Errorf("invalid formula %q: %w", formula, err)
+	}
+	return compilePriority(expr)
+}
+
+// compilePriority returns the function evaluating expr.
+func compilePriority(expr ast.Expr) (Priority, error) {
+	switch e := expr.(type) {
+	case *ast.ParenExpr:
+		return compilePriority(e.X)
+	case *ast.BasicLit:
+		if e.Kind != token.INT && e.Kind != token.FLOAT {
+			return nil, fmt.Errorf("unexpected %s in formula", e.Value)
+		}
+		v, err := strconv.ParseFloat(e.Value, 64)
+		if err != nil {
+			return nil, err
+		}
+		return func(*pb.FunctionNode) float64 { return v }, nil
+	case *ast.Ident:
+		variable, exists := priorityVariables[e.Name]
+		if !exists {
+			return nil, fmt.Errorf("unknown variable %q in formula, available variables are %s", e.Name, strings.Join(priorityNames(), ", "))
+		}
+		return variable, nil
+	case *ast.UnaryExpr:
+		x, err := compilePriority(e.X)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Op {
+		case token.SUB:
+			return func(node *pb.FunctionNode) float64 { return -x(node) }, nil
+		case token.ADD:
+			return x, nil
+		}
+		return nil, fmt.Errorf("unexpected operator %s in formula", e.Op)
+	case *ast.BinaryExpr:
+		x, err := compilePriority(e.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := compilePriority(e.Y)
+		if err != nil {
+			return nil, err
+		}
+		switch e.Op {
+		case token.ADD:
+			return func(node *pb.FunctionNode) float64 { return x(node) + y(node) }, nil
+		case token.SUB:
+			return func(node *pb.FunctionNode) float64 { return x(node) - y(node) }, nil
+		case token.MUL:
+			return func(node *pb.FunctionNode) float64 { return x(node) * y(node) }, nil
+		case token.QUO:
+			return func(node *pb.FunctionNode) float64 { return x(node) / y(node) }, nil
+		}
+		return nil, fmt.Errorf("unexpected operator %s in formula", e.Op)
+	case *ast.CallExpr:
+		name, _ := e.Fun.(*ast.Ident)
+		if name == nil || priorityFunctions[name.Name] == nil {
+			return nil, fmt.Errorf("unknown function in formula, available functions are log, log2, sqrt, pow, min and max")
+		}
+		fn := priorityFunctions[name.Name]
+		arity := 1
+		if name.Name == "pow" || name.Name == "min" || name.Name == "max" {
+			arity = 2
+		}
+		if len(e.Args) != arity {
+			return nil, fmt.Errorf("%s takes %d arguments, got %d", name.Name, arity, len(e.Args))
+		}
+		args := make([]Priority, len(e.Args))
+		for i, arg := range e.Args {
+			var err error
+			if args[i], err = compilePriority(arg); err != nil {
+				return nil, err
+			}
+		}
+		return func(node *pb.FunctionNode) float64 {
+			values := make([]float64, len(args))
+			for i, arg := range args {
+				values[i] = arg(node)
+			}
+			return fn(values...)
+		}, nil
+	}
+	return nil, fmt.Errorf("unexpected expression in formula")
+}
+
+// priorityNames returns the sorted names of the variables of formulas.
+func priorityNames() []string {
+	names := make([]string, 0, len(priorityVariables))
+	for name := range priorityVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// priority returns a formula, DefaultPriority if it is empty or invalid,
+// which ParsePriority reports before reports are written.
+func priority(formula string) Priority {
+	if formula != "" {
+		if p, err := ParsePriority(formula); err == nil {
+			return p
+		}
+	}
+	p, _ := ParsePriority(DefaultPriority)
+	return p
+}
+
+// rankedNodes returns the nodes by descending priority when the style ranks
+// by it, by descending attributed cpu otherwise, see sortedNodes. NaN scores,
+// e.g. of log(0), rank last.
+func rankedNodes(profile map[string]*pb.FunctionNode, style term.Style) []*pb.FunctionNode {
+	nodes := sortedNodes(profile)
+	if !style.RankByPriority {
+		return nodes
+	}
+	score := priority(style.Priority)
+	scores := make(map[*pb.FunctionNode]float64, len(nodes))
+	for _, node := range nodes {
+		if scores[node] = score(node); math.IsNaN(scores[node]) {
+			scores[node] = math.Inf(-1)
+		}
+	}
+	sort.SliceStable(nodes, func(i, j int) bool { return scores[nodes[i]] > scores[nodes[j]] })
+	return nodes
+}
@@ -0,0 +1,66 @@
+package cpu
+
+import (
+	"math"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestParsePriority(t *testing.T) {
+	node := &pb.FunctionNode{SelfAttrCPU: 10, SelfCPU: 4, TotalCPU: 20, Callers: 3, Depth: 7}
+	tests := []struct {
+		formula string
+		want    float64
+	}{
+		{DefaultPriority, 90},
+		{"self + total/4 - -1", 10},
+		{"pow(callers, 2) * max(attr, self)", 90},
+		{"sqrt(min(total, 16)) * (depth - 6.5)", 2},
+	}
+	for _, tt := range tests {
+		p, err := ParsePriority(tt.formula)
+		if err != nil {
+			t.Errorf("ParsePriority(%q) failed: %v", tt.formula, err)
+			continue
+		}
+		if got := p(node); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Expected %q to score %v, got %v", tt.formula, tt.want, got)
+		}
+	}
+
+	for _, formula := range []string{"attr *", "attr * owners", "exp(attr)", "log2(attr, 2)", `attr * "2"`, "attr % 2", "attr.x"} {
+		if _, err := ParsePriority(formula); err == nil {
+			t.Errorf("Expected error for formula %q, got nil", formula)
+		}
+	}
+}
+
+func TestRankedNodes(t *testing.T) {
+	profile := map[string]*pb.FunctionNode{
+		"main.hot":    {Name: "main.hot", SelfAttrCPU: 30, Callers: 1, Depth: 1},
+		"main.shared": {Name: "main.shared", SelfAttrCPU: 10, Callers: 4, Depth: 7},
+		"main.root":   {Name: "main.root", SelfAttrCPU: 5, Callers: 0, Depth: 0},
+	}
+
+	nodes := rankedNodes(profile, term.Style{})
+	if nodes[0].Name != "main.hot" {
+		t.Errorf("Expected main.hot first by attributed cpu, got %s", nodes[0].Name)
+	}
+
+	style := term.Style{RankByPriority: true}
+	nodes = rankedNodes(profile, style)
+	if nodes[0].Name != "main.shared" || nodes[1].Name != "main.hot" || nodes[2].Name != "main.root" {
+		t.Errorf("Expected main.shared, main.hot then main.root by priority, got %s, %s, %s", nodes[0].Name, nodes[1].Name, nodes[2].Name)
+	}
+	if got := formatColumns(nodes[0], style); got != "120.00\t10.00\tmain.shared in " {
+		t.Errorf("Expected the priority before the default columns, got %q", got)
+	}
+
+	// NaN scores rank last
+	style.Priority = "log(attr - 10)"
+	if nodes = rankedNodes(profile, style); nodes[2].Name != "main.root" {
+		t.Errorf("Expected main.root last, got %s", nodes[2].Name)
+	}
+}
@@ -0,0 +1,374 @@
+package cpu
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Query is a parsed query, it reports whether a function is kept in reports.
+type Query func(node *pb.FunctionNode) bool
+
+// queryStrings are the text values of a function a query can use, along
+// with the numbers of priority formulas.
+var queryStrings = map[string]func(node *pb.FunctionNode) string{
+	"name":    func(node *pb.FunctionNode) string { return node.Name },
+	"file":    func(node *pb.FunctionNode) string { return node.FileName },
+	"package": func(node *pb.FunctionNode) string { return pb.FuncPackage(node.Name) },
+	"module":  func(node *pb.FunctionNode) string { return node.Module },
+	"version": func(node *pb.FunctionNode) string { return node.Version },
+}
+
+// ParseQuery parses a query, a boolean expression over the variables of
+// priority formulas, the strings name, file, package, module and version of
+// functions, and string and number literals, combined with && || ! == != < <=
+// > >= + - * / and parentheses, where =~ and !~ match a string against the
+// regexp of a string literal, e.g. 'total > 5 && file =~ "internal/"'.
+func ParseQuery(text string) (Query, error) {
+	tokens, err := lexQuery(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query %q: %w", text, err)
+	}
+	p := &queryParser{tokens: tokens}
+	e, err := p.or()
+	if err == nil && p.peek().kind != queryEOF {
+		err = fmt.Errorf("unexpected %s", p.peek())
+	}
+	if err == nil && e.kind != boolExpr {
+		err = fmt.Errorf("the query is a %s, not a condition", e.kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid query %q: %w", text, err)
+	}
+	return e.bool, nil
+}
+
+// queryTokenKind is the kind of a token of a query.
+type queryTokenKind int
+
+const (
+	queryEOF queryTokenKind = iota
+	queryNumber
+	queryString
+	queryIdent
+	queryOp
+)
+
+// queryToken is a token of a query, the value of strings unquoted.
+type queryToken struct {
+	kind  queryTokenKind
+	text  string
+	value float64
+}
+
+func (t queryToken) String() string {
+	if t.kind == queryEOF {
+		return "end of query"
+	}
+	return strconv.Quote(t.text)
+}
+
+// queryOps are the operators of queries, longest first so that e.g. <= is not
+// read as <.
+var queryOps = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "+", "-", "*", "/", "(", ")"}
+
+// lexQuery splits a query into tokens.
+func lexQuery(text string) ([]queryToken, error) {
+	var tokens []queryToken
+	for i := 0; i < len(text); {
+		c := rune(text[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(text) && text[end] != '"' {
+				if text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(text) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			s, err := strconv.Unquote(text[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", text[i:end+1])
+			}
+			tokens = append(tokens, queryToken{kind: queryString, text: s})
+			i = end + 1
+		case unicode.IsDigit(c) || c == '.':
+			end := i
+			for end < len(text) && (unicode.IsDigit(rune(text[end])) || text[end] == '.') {
+				end++
+			}
+			v, err := strconv.ParseFloat(text[i:end], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %s", text[i:end])
+			}
+			tokens = append(tokens, queryToken{kind: queryNumber, text: text[i:end], value: v})
+			i = end
+		case unicode.IsLetter(c) || c == '_':
+			end := i
+			for end < len(text) && (unicode.IsLetter(rune(text[end])) || unicode.IsDigit(rune(text[end])) || text[end] == '_') {
+				end++
+			}
+			tokens = append(tokens, queryToken{kind: queryIdent, text: text[i:end]})
+			i = end
+		default:
+			op := ""
+			for _, candidate := range queryOps {
+				if strings.HasPrefix(text[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q", c)
+			}
+			tokens = append(tokens, queryToken{kind: queryOp, text: op})
+			i += len(op)
+		}
+	}
+	return append(tokens, queryToken{kind: queryEOF}), nil
+}
+
+// queryExprKind is the type of the value of a query expression.
+type queryExprKind string
+
+const (
+	numberExpr queryExprKind = "number"
+	stringExpr queryExprKind = "string"
+	boolExpr   queryExprKind = "condition"
+)
+
+// queryExpr is a compiled query expression, whose func of its kind evaluates
+// it for a function. literal is set for string literals, the regexps of =~.
+type queryExpr struct {
+	kind    queryExprKind
+	number  func(node *pb.FunctionNode) float64
+	str     func(node *pb.FunctionNode) string
+	bool    func(node *pb.FunctionNode) bool
+	literal *string
+}
+
+// queryParser compiles the tokens of a query by recursive descent, from the
+// loosest binding operator, ||, to the tightest, the unary ones.
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken { return p.tokens[p.pos] }
+
+// accept consumes the next token if it is one of the operators.
+func (p *queryParser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != queryOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// want checks that the operands of op are of the kind.
+func want(op string, kind queryExprKind, operands ...queryExpr) error {
+	for _, e := range operands {
+		if e.kind != kind {
+			return fmt.Errorf("%s needs %ss, got a %s", op, kind, e.kind)
+		}
+	}
+	return nil
+}
+
+func (p *queryParser) or() (queryExpr, error) {
+	x, err := p.and()
+	for err == nil {
+		if _, ok := p.accept("||"); !ok {
+			break
+		}
+		var y queryExpr
+		if y, err = p.and(); err == nil {
+			err = want("||", boolExpr, x, y)
+		}
+		if err == nil {
+			a, b := x.bool, y.bool
+			x = queryExpr{kind: boolExpr, bool: func(n *pb.FunctionNode) bool { return a(n) || b(n) }}
+		}
+	}
+	return x, err
+}
+
+func (p *queryParser) and() (queryExpr, error) {
+	x, err := p.comparison()
+	for err == nil {
+		if _, ok := p.accept("&&"); !ok {
+			break
+		}
+		var y queryExpr
+		if y, err = p.comparison(); err == nil {
+			err = want("&&", boolExpr, x, y)
+		}
+		if err == nil {
+			a, b := x.bool, y.bool
+			x = queryExpr{kind: boolExpr, bool: func(n *pb.FunctionNode) bool { return a(n) && b(n) }}
+		}
+	}
+	return x, err
+}
+
+func (p *queryParser) comparison() (queryExpr, error) {
+	x, err := p.sum()
+	if err != nil {
+		return x, err
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "=~", "!~")
+	if !ok {
+		return x, nil
+	}
+	y, err := p.sum()
+	if err != nil {
+		return y, err
+	}
+
+	if op == "=~" || op == "!~" {
+		if err := want(op, stringExpr, x, y); err != nil {
+			return x, err
+		}
+		if y.literal == nil {
+			return x, fmt.Errorf("%s needs a regexp string literal on its right", op)
+		}
+		re, err := regexp.Compile(*y.literal)
+		if err != nil {
+			return x, err
+		}
+		s, negate := x.str, op == "!~"
+		return queryExpr{kind: boolExpr, bool: func(n *pb.FunctionNode) bool { return re.MatchString(s(n)) != negate }}, nil
+	}
+	if x.kind == stringExpr && (op == "==" || op == "!=") {
+		if err := want(op, stringExpr, y); err != nil {
+			return x, err
+		}
+		a, b, negate := x.str, y.str, op == "!="
+		return queryExpr{kind: boolExpr, bool: func(n *pb.FunctionNode) bool { return (a(n) == b(n)) != negate }}, nil
+	}
+	if err := want(op, numberExpr, x, y); err != nil {
+		return x, err
+	}
+	a, b := x.number, y.number
+	compare := map[string]func(a, b float64) bool{
+		"==": func(a, b float64) bool { return a == b },
+		"!=": func(a, b float64) bool { return a != b },
+		"<":  func(a, b float64) bool { return a < b },
+		"<=": func(a, b float64) bool { return a <= b },
+		">":  func(a, b float64) bool { return a > b },
+		">=": func(a, b float64) bool { return a >= b },
+	}[op]
+	return queryExpr{kind: boolExpr, bool: func(n *pb.FunctionNode) bool { return compare(a(n), b(n)) }}, nil
+}
+
+func (p *queryParser) sum() (queryExpr, error) {
+	return p.arithmetic(p.product, "+", "-")
+}
+
+func (p *queryParser) product() (queryExpr, error) {
+	return p.arithmetic(p.unary, "*", "/")
+}
+
+// arithmetic parses the operands of next joined by the operators.
+func (p *queryParser) arithmetic(next func() (queryExpr, error), ops ...string) (queryExpr, error) {
+	x, err := next()
+	for err == nil {
+		op, ok := p.accept(ops...)
+		if !ok {
+			break
+		}
+		var y queryExpr
+		if y, err = next(); err == nil {
+			err = want(op, numberExpr, x, y)
+		}
+		if err != nil {
+			break
+		}
+		a, b := x.number, y.number
+		var f func(n *pb.FunctionNode) float64
+		switch op {
+		case "+":
+			f = func(n *pb.FunctionNode) float64 { return a(n) + b(n) }
+		case "-":
+			f = func(n *pb.FunctionNode) float64 { return a(n) - b(n) }
+		case "*":
+			f = func(n *pb.FunctionNode) float64 { return a(n) * b(n) }
+		case "/":
+			f = func(n *pb.FunctionNode) float64 { return a(n) / b(n) }
+		}
+		x = queryExpr{kind: numberExpr, number: f}
+	}
+	return x, err
+}
+
+func (p *queryParser) unary() (queryExpr, error) {
+	if op, ok := p.accept("!", "-"); ok {
+		x, err := p.unary()
+		if err != nil {
+			return x, err
+		}
+		if op == "!" {
+			if err := want(op, boolExpr, x); err != nil {
+				return x, err
+			}
+			a := x.bool
+			return queryExpr{kind: boolExpr, bool: func(n *pb.FunctionNode) bool { return !a(n) }}, nil
+		}
+		if err := want(op, numberExpr, x); err != nil {
+			return x, err
+		}
+		a := x.number
+		return queryExpr{kind: numberExpr, number: func(n *pb.FunctionNode) float64 { return -a(n) }}, nil
+	}
+	return p.primary()
+}
+
+func (p *queryParser) primary() (queryExpr, error) {
+	t := p.peek()
+	if t.kind != queryEOF {
+		p.pos++
+	}
+	switch t.kind {
+	case queryNumber:
+		v := t.value
+		return queryExpr{kind: numberExpr, number: func(*pb.FunctionNode) float64 { return v }}, nil
+	case queryString:
+		s := t.text
+		return queryExpr{kind: stringExpr, str: func(*pb.FunctionNode) string { return s }, literal: &s}, nil
+	case queryIdent:
+		if f, ok := priorityVariables[t.text]; ok {
+			return queryExpr{kind: numberExpr, number: f}, nil
+		}
+		if f, ok := queryStrings[t.text]; ok {
+			return queryExpr{kind: stringExpr, str: f}, nil
+		}
+		return queryExpr{}, fmt.Errorf("unknown variable %q, available variables are %s, name, file, package, module and version", t.text, strings.Join(priorityNames(), ", "))
+	case queryOp:
+		if t.text == "(" {
+			x, err := p.or()
+			if err != nil {
+				return x, err
+			}
+			if _, ok := p.accept(")"); !ok {
+				return x, fmt.Errorf("expected ) instead of %s", p.peek())
+			}
+			return x, nil
+		}
+	}
+	return queryExpr{}, fmt.Errorf("unexpected %s", t)
+}
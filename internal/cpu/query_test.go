@@ -0,0 +1,96 @@
+package cpu
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestParseQuery(t *testing.T) {
+	node := &pb.FunctionNode{Name: "github.com/org/repo/internal/store.Get", FileName: "internal/store/store.go", SelfAttrCPU: 4, TotalCPU: 10, Callers: 3}
+	for query, want := range map[string]bool{
+		`total > 5 && file =~ "internal/"`:       true,
+		`total > 5 && file !~ "internal/"`:       false,
+		`attr * callers >= 12`:                   true,
+		`-attr < -5 || package == "store"`:       false,
+		`!(total - attr <= 6) || name =~ "Get$"`: true,
+		`package != "store" || version == ""`:    true,
+		`total / 2 == 5 && samples == 0`:         true,
+	} {
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Errorf("%s: %v", query, err)
+			continue
+		}
+		if got := q(node); got != want {
+			t.Errorf("%s: expected %v, got %v", query, want, got)
+		}
+	}
+
+	for query, want := range map[string]string{
+		`total >`:              "unexpected end of query",
+		`total > 5 &&`:         "unexpected end of query",
+		`total + 1`:            "not a condition",
+		`name > 5`:             "> needs numbers",
+		`file =~ name`:         "regexp string literal",
+		`file =~ "("`:          "missing closing )",
+		`cores > 1`:            `unknown variable "cores"`,
+		`(total > 1`:           "expected )",
+		`total > 1 total`:      `unexpected "total"`,
+		`name == "unfinished`:  "unterminated string",
+		`total > 1 & self > 1`: `unexpected '&'`,
+	} {
+		if _, err := ParseQuery(query); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected an error containing %q, got %v", query, want, err)
+		}
+	}
+}
+
+func TestAnalysisQuery(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "github.com/org/repo/store.Get", FileName: "store.go"}, {Name: "main.main", FileName: "main.go"}}, []int64{75}, nil)
+	b.AddSample([]pb.Stack{{Name: "main.main", FileName: "main.go"}}, []int64{25}, nil)
+	a, err := Analyze(b.Profile(), pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Query, err = ParseQuery(`file == "store.go"`); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := (Text{term.Style{}}).Format(a, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.Contains(got, "store.Get") || strings.Contains(got, "main.main") {
+		t.Errorf("Expected only store.Get, got\n%s", got)
+	}
+}
+
+func TestSlicesQuery(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "github.com/org/repo/store.Get", FileName: "store.go"}, {Name: "main.main", FileName: "main.go"}}, []int64{75}, nil)
+	b.AddSample([]pb.Stack{{Name: "main.main", FileName: "main.go"}}, []int64{25}, nil)
+	p := b.Profile()
+	p.StringTable = append(p.StringTable, "end_timestamp_ns")
+	for _, sample := range p.Sample {
+		sample.Label = []*pb.Label{{Key: int64(len(p.StringTable) - 1), Num: int64(time.Second)}}
+	}
+	a, err := Analyze(p, pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Query, err = ParseQuery(`file == "store.go"`); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := (Slices{Width: 10 * time.Second, Top: 10}).Format(a, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.Contains(got, "store.Get") || strings.Contains(got, "main.main") {
+		t.Errorf("Expected only store.Get in the slice, got\n%s", got)
+	}
+}
@@ -0,0 +1,51 @@
+package cpu
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// templateFuncs are the functions available to templates in addition to the
+// builtin ones.
+var templateFuncs = template.FuncMap{
+	"short": term.ShortName,
+	"pct":   func(v float64) string { return fmt.Sprintf("%.2f", v) },
+}
+
+// ParseTemplate parses a template executed for every function of a report, see TransformTemplate
+func ParseTemplate(text string) (*template.Template, error) {
+	return template.New("function").Funcs(templateFuncs).Parse(text)
+}
+
+// TransformTemplate executes the template for every function of the profile, ordered as by Transform, with the function's pb.FunctionNode as data, e.g. '{{.Name}} {{pct .SelfAttrCPU}}', so that scripts get the fields they need in any format; a newline follows every function unless the template ends with one
+func TransformTemplate(pprof *pb.Profile, w io.Writer, opts pb.AnalyzeOptions, tmpl *template.Template) error {
+	return transform(pprof, w, opts, Template{tmpl})
+}
+
+// Template is the Formatter of TransformTemplate.
+type Template struct {
+	Template *template.Template
+}
+
+// Format writes the analysis like TransformTemplate.
+func (f Template) Format(a *Analysis, w io.Writer) error {
+	var buf bytes.Buffer
+	for _, node := range sortedNodes(a.Nodes()) {
+		buf.Reset()
+		if err := f.Template.Execute(&buf, node); err != nil {
+			return err
+		}
+		if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package cpu
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestTransformTemplate(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "github.com/org/repo/store.Get", FileName: "store.go"}, {Name: "main.main", FileName: "main.go"}}, []int64{75}, nil)
+	b.AddSample([]pb.Stack{{Name: "main.main", FileName: "main.go"}}, []int64{25}, nil)
+
+	tmpl, err := ParseTemplate(`{{short .Name}},{{pct .SelfAttrCPU}},{{.Samples}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := TransformTemplate(b.Profile(), &buf, pb.AnalyzeOptions{}, tmpl); err != nil {
+		t.Fatal(err)
+	}
+	if want := "store.Get,75.00,1\nmain.main,25.00,2\n"; buf.String() != want {
+		t.Errorf("Expected %q, got %q", want, buf.String())
+	}
+
+	if _, err := ParseTemplate("{{.Name"); err == nil {
+		t.Error("Expected error for invalid template")
+	}
+}
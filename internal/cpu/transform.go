@@ -3,19 +3,209 @@ package cpu
 import (
 	"fmt"
 	"io"
+	"sort"
+	"time"
 
+	"github.com/kmrgirish/pprof-adv/internal/term"
 	"github.com/kmrgirish/pprof-adv/pb"
 )
 
-// Transform converts the pprof format into a raw text format where real cpu% usages is attributed to a function instead of it's childs
-func Transform(pprof *pb.Profile, w io.Writer, attrCPU bool) error {
-	profile, err := pb.AnalyzeCPUProfile(pprof, attrCPU)
+// Analysis is a profile analyzed once with its options, which formatters
+// write in their format.
+type Analysis struct {
+	Profile *pb.Profile
+	Options pb.AnalyzeOptions
+	Report  *pb.Report
+	// Query selects the functions listed by the formatters of the report,
+	// all of them if nil. Call trees and flamegraphs are not filtered.
+	Query Query
+}
+
+// Nodes returns the functions of the report selected by the query.
+func (a *Analysis) Nodes() map[string]*pb.FunctionNode {
+	nodes := a.Report.Nodes()
+	if a.Query != nil {
+		for name, node := range nodes {
+			if !a.Query(node) {
+				delete(nodes, name)
+			}
+		}
+	}
+	return nodes
+}
+
+// Each calls fn with every function of the report selected by the query, in
+// the order of the reports, one at a time rather than from a snapshot of
+// the whole call tree like Nodes.
+func (a *Analysis) Each(fn func(*pb.FunctionNode) error) error {
+	return a.Report.Each(func(node *pb.FunctionNode) error {
+		if a.Query != nil && !a.Query(node) {
+			return nil
+		}
+		return fn(node)
+	})
+}
+
+// Analyze ingests the profile into a report with the options.
+func Analyze(pprof *pb.Profile, opts pb.AnalyzeOptions) (*Analysis, error) {
+	analyzer, err := pb.NewAnalyzer(opts)
+	if err != nil {
+		return nil, err
+	}
+	report := analyzer.NewReport()
+	if err := analyzer.Ingest(report, pprof); err != nil {
+		return nil, err
+	}
+	if report.Total() == 0 {
+		return nil, fmt.Errorf("no CPU time recorded in profile")
+	}
+	return &Analysis{Profile: pprof, Options: opts, Report: report}, nil
+}
+
+// Formatter writes an analysis in an output format, so that a profile
+// analyzed once can be written in several formats and to any writer.
+type Formatter interface {
+	Format(a *Analysis, w io.Writer) error
+}
+
+// transform analyzes the profile and writes it with the formatter.
+func transform(pprof *pb.Profile, w io.Writer, opts pb.AnalyzeOptions, f Formatter) error {
+	a, err := Analyze(pprof, opts)
+	if err != nil {
+		return err
+	}
+	return f.Format(a, w)
+}
+
+// Text is the Formatter of Transform.
+type Text struct {
+	Style term.Style
+}
+
+// Format writes the analysis like Transform.
+func (f Text) Format(a *Analysis, w io.Writer) error {
+	writeReport(w, a.Nodes(), a.Report.Warnings(), f.Style)
+	return nil
+}
+
+// Transform converts the pprof format into a raw text format where real cpu% usages is attributed to a function instead of it's childs, followed by the warnings of the analysis, the style decides whether it is colored and truncated for a terminal
+func Transform(pprof *pb.Profile, w io.Writer, opts pb.AnalyzeOptions, style term.Style) error {
+	return transform(pprof, w, opts, Text{style})
+}
+
+// TransformReport writes the attributed cpu of every function of the profiles ingested into the report so far, in the same format as Transform
+func TransformReport(report *pb.Report, w io.Writer, style term.Style) error {
+	if report.Total() == 0 {
+		return fmt.Errorf("no CPU time recorded in report")
+	}
+
+	writeReport(w, report.Nodes(), report.Warnings(), style)
+	return nil
+}
+
+// writeReport writes the nodes in the text format, followed by the warnings.
+func writeReport(w io.Writer, nodes map[string]*pb.FunctionNode, warnings []string, style term.Style) {
+	for _, node := range rankedNodes(nodes, style) {
+		writeNode(w, node, style)
+	}
+	writeWarnings(w, warnings)
+}
+
+// writeWarnings writes the warnings of an analysis as a footer, one per line.
+func writeWarnings(w io.Writer, warnings []string) {
+	for _, warning := range warnings {
+		fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+}
+
+// writeNode writes a function as one line of the text format, made of the columns of the style, by default its attributed cpu followed by its name and file
+func writeNode(w io.Writer, node *pb.FunctionNode, style term.Style) {
+	fmt.Fprintln(w, formatColumns(node, style))
+}
+
+// sortedNodes returns the nodes by descending attributed cpu, ties broken by
+// name so that output is stable across runs.
+func sortedNodes(profile map[string]*pb.FunctionNode) []*pb.FunctionNode {
+	nodes := make([]*pb.FunctionNode, 0, len(profile))
+	for _, node := range profile {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].SelfAttrCPU != nodes[j].SelfAttrCPU {
+			return nodes[i].SelfAttrCPU > nodes[j].SelfAttrCPU
+		}
+		return nodes[i].Name < nodes[j].Name
+	})
+	return nodes
+}
+
+// Slices is the Formatter of TransformSlices, which analyzes every slice of
+// the profile on its own.
+type Slices struct {
+	Width time.Duration
+	Top   int
+	Style term.Style
+}
+
+// Format writes the profile of the analysis like TransformSlices, listing
+// the functions of each slice selected by the query of the analysis.
+func (f Slices) Format(a *Analysis, w io.Writer) error {
+	return transformSlices(a.Profile, w, a.Options, f.Width, f.Top, f.Style, a.Query)
+}
+
+// TransformSlices splits the pprof into time buckets of the given width and writes the top attributed functions of each bucket, along with the bucket's share of the profile's cpu time, so that transient spikes are not averaged away
+func TransformSlices(pprof *pb.Profile, w io.Writer, opts pb.AnalyzeOptions, width time.Duration, top int, style term.Style) error {
+	return transformSlices(pprof, w, opts, width, top, style, nil)
+}
+
+// transformSlices is TransformSlices listing the functions selected by the
+// query, all of them if nil, before keeping the top ones of each slice.
+func transformSlices(pprof *pb.Profile, w io.Writer, opts pb.AnalyzeOptions, width time.Duration, top int, style term.Style, query Query) error {
+	analyzer, err := pb.NewAnalyzer(opts)
+	if err != nil {
+		return err
+	}
+
+	slices, err := pb.SliceProfile(pprof, width)
 	if err != nil {
 		return err
 	}
 
-	for fn, node := range profile {
-		fmt.Fprintf(w, "%.2f\t%s in %s\n", node.SelfAttrCPU, fn, node.FileName)
+	cpuTimes := make([]int64, len(slices))
+	var totalCPU int64
+	for i, slice := range slices {
+		cpuTimes[i] = pb.TotalCPU(slice.Profile)
+		totalCPU += cpuTimes[i]
+	}
+
+	for i, slice := range slices {
+		share := 0.0
+		if totalCPU > 0 {
+			share = float64(cpuTimes[i]) / float64(totalCPU) * 100
+		}
+		fmt.Fprintf(w, "== %s - %s (%.2f%% of cpu)\n", slice.Start.Format(time.RFC3339), slice.End.Format(time.RFC3339), share)
+
+		profile, err := analyzer.AnalyzeCPU(slice.Profile)
+		if err != nil {
+			fmt.Fprintf(w, "\t%s\n", err)
+			continue
+		}
+		if query != nil {
+			for name, node := range profile {
+				if !query(node) {
+					delete(profile, name)
+				}
+			}
+		}
+
+		nodes := rankedNodes(profile, style)
+		if top > 0 && len(nodes) > top {
+			nodes = nodes[:top]
+		}
+
+		for _, node := range nodes {
+			writeNode(w, node, style)
+		}
 	}
 
 	return nil
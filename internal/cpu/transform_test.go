@@ -0,0 +1,46 @@
+package cpu
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestFormatters(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "github.com/org/repo/store.Get", FileName: "store.go"}, {Name: "main.main", FileName: "main.go"}}, []int64{75}, nil)
+	b.AddSample([]pb.Stack{{Name: "main.main", FileName: "main.go"}}, []int64{25}, nil)
+	profile := b.Profile()
+	var opts pb.AnalyzeOptions
+
+	a, err := Analyze(profile, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		formatter Formatter
+		transform func(w *bytes.Buffer) error
+	}{
+		{Text{}, func(w *bytes.Buffer) error { return Transform(profile, w, opts, term.Style{}) }},
+		{JSON{Type: "cpu"}, func(w *bytes.Buffer) error { return TransformJSON(profile, w, opts, "cpu") }},
+		{NDJSON{Type: "cpu"}, func(w *bytes.Buffer) error { return TransformNDJSON(profile, w, opts, "cpu") }},
+		{Tree{}, func(w *bytes.Buffer) error { return TransformTree(profile, w, opts, TopDown, term.Style{}) }},
+	} {
+		var got, want bytes.Buffer
+		if err := tc.formatter.Format(a, &got); err != nil {
+			t.Fatal(err)
+		}
+		if err := tc.transform(&want); err != nil {
+			t.Fatal(err)
+		}
+		if got.Len() == 0 || got.String() != want.String() {
+			t.Errorf("%T: expected the output of its transform\n%s, got\n%s", tc.formatter, want.String(), got.String())
+		}
+	}
+
+	if _, err := Analyze(pb.NewBuilder([2]string{"cpu", "nanoseconds"}).Profile(), pb.AnalyzeOptions{}); err == nil {
+		t.Error("Expected an error for a profile without cpu time")
+	}
+}
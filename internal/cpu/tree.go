@@ -0,0 +1,58 @@
+package cpu
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Direction is the way the call tree of TransformTree is rooted.
+type Direction string
+
+const (
+	// TopDown roots the tree at the entry points, branching by callees.
+	TopDown Direction = "topdown"
+	// BottomUp roots the tree at the leaf hotspots, branching by callers.
+	BottomUp Direction = "bottomup"
+)
+
+// minTextTreeShare is the share of the total, in percent, below which call
+// paths are left out of text trees to keep them readable.
+const minTextTreeShare = 1
+
+// Tree is the Formatter of TransformTree.
+type Tree struct {
+	Direction Direction
+	Style     term.Style
+}
+
+// Format writes the profile of the analysis like TransformTree.
+func (f Tree) Format(a *Analysis, w io.Writer) error {
+	return TransformTree(a.Profile, w, a.Options, f.Direction, f.Style)
+}
+
+// TransformTree writes the call tree of the profile in the direction, one call path per line as "total function" with the function indented by its depth, dropping the call paths below 1% of the total or the TrimBelow of the options, bottom-up answers which callers an expensive leaf is reached from. Function names are formatted by the style, the tree only applies the sample type, the focus and ignore filters, the max depth and the trim of the options
+func TransformTree(pprof *pb.Profile, w io.Writer, opts pb.AnalyzeOptions, direction Direction, style term.Style) error {
+	switch direction {
+	case "", TopDown, BottomUp:
+	default:
+		return fmt.Errorf("unknown direction %q", direction)
+	}
+	tree, err := callTree(pprof, opts, direction == BottomUp, minTextTreeShare)
+	if err != nil {
+		return err
+	}
+
+	var write func(node *htmlNode, depth int)
+	write = func(node *htmlNode, depth int) {
+		for _, child := range node.Children {
+			fmt.Fprintf(w, "%s\t%s%s\n", style.Percent(child.Value), strings.Repeat("  ", depth), style.Name(child.Name))
+			write(child, depth+1)
+		}
+	}
+	write(tree, 0)
+	return nil
+}
@@ -0,0 +1,52 @@
+package cpu
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestTransformTree(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "main.alloc"}, {Name: "main.a"}, {Name: "main.main"}}, []int64{60}, nil)
+	b.AddSample([]pb.Stack{{Name: "main.alloc"}, {Name: "main.b"}, {Name: "main.main"}}, []int64{30}, nil)
+	b.AddSample([]pb.Stack{{Name: "main.b"}, {Name: "main.main"}}, []int64{10}, nil)
+	profile := b.Profile()
+
+	for _, tc := range []struct {
+		direction Direction
+		want      string
+	}{
+		{TopDown, "100.00\tmain.main\n60.00\t  main.a\n60.00\t    main.alloc\n40.00\t  main.b\n30.00\t    main.alloc\n"},
+		{BottomUp, "90.00\tmain.alloc\n60.00\t  main.a\n60.00\t    main.main\n30.00\t  main.b\n30.00\t    main.main\n10.00\tmain.b\n10.00\t  main.main\n"},
+	} {
+		var buf bytes.Buffer
+		if err := TransformTree(profile, &buf, pb.AnalyzeOptions{}, tc.direction, term.Style{}); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tc.want {
+			t.Errorf("Expected %s tree\n%s, got\n%s", tc.direction, tc.want, buf.String())
+		}
+	}
+
+	if err := TransformTree(profile, &bytes.Buffer{}, pb.AnalyzeOptions{}, "sideways", term.Style{}); err == nil {
+		t.Error("Expected error for unknown direction, got nil")
+	}
+}
+
+func TestTransformTreeTrim(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "main.parse"}, {Name: "main.parse"}, {Name: "main.parse"}, {Name: "main.main"}}, []int64{70}, nil)
+	b.AddSample([]pb.Stack{{Name: "main.render"}, {Name: "main.main"}}, []int64{30}, nil)
+
+	var buf bytes.Buffer
+	if err := TransformTree(b.Profile(), &buf, pb.AnalyzeOptions{MaxDepth: 2, TrimBelow: 50}, TopDown, term.Style{}); err != nil {
+		t.Fatal(err)
+	}
+	want := "100.00\tmain.main\n70.00\t  main.parse\n"
+	if buf.String() != want {
+		t.Errorf("Expected tree\n%s, got\n%s", want, buf.String())
+	}
+}
@@ -0,0 +1,126 @@
+// Package credentials reads the named Datadog credentials of the config file
+// of pprof-adv, letting users of several Datadog organizations switch between
+// them with --dd-profile instead of exporting other keys.
+package credentials
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileEnv is the environment variable overriding the path of the file, see
+// Path.
+const FileEnv = "PPROF_ADV_CREDENTIALS"
+
+// Credentials are the keys of a Datadog organization and the site it is on.
+type Credentials struct {
+	APIKey string
+	AppKey string
+	Site   string // e.g. datadoghq.eu, "" for the default site
+}
+
+// Path returns the path of the credentials file, $PPROF_ADV_CREDENTIALS or
+// pprof-adv/credentials in the config directory of the user, e.g.
+// ~/.config/pprof-adv/credentials on Linux.
+func Path() (string, error) {
+	if path := os.Getenv(FileEnv); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pprof-adv", "credentials"), nil
+}
+
+// Parse reads the credentials of a file of named sections of keys, such as:
+//
+//	[staging-org]
+//	api_key = 0123456789abcdef0123456789abcdef
+//	app_key = 0123456789abcdef0123456789abcdef01234567
+//	site = datadoghq.eu
+//
+// Lines starting with # or ; are comments.
+func Parse(r io.Reader) (map[string]Credentials, error) {
+	profiles := make(map[string]Credentials)
+	var name string
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name = strings.TrimSpace(line[1 : len(line)-1])
+			if name == "" {
+				return nil, fmt.Errorf("line %d: empty profile name", lineNo)
+			}
+			if _, exists := profiles[name]; exists {
+				return nil, fmt.Errorf("line %d: duplicate profile %s", lineNo, name)
+			}
+			profiles[name] = Credentials{}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("line %d: %s outside of a [profile]", lineNo, strings.TrimSpace(key))
+		}
+		creds := profiles[name]
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "api_key":
+			creds.APIKey = value
+		case "app_key":
+			creds.AppKey = value
+		case "site":
+			creds.Site = value
+		default:
+			return nil, fmt.Errorf("line %d: unknown key %s, expected api_key, app_key or site", lineNo, strings.TrimSpace(key))
+		}
+		profiles[name] = creds
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// Load returns the credentials of the named profile of the credentials file.
+func Load(name string) (Credentials, error) {
+	path, err := Path()
+	if err != nil {
+		return Credentials{}, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Credentials{}, fmt.Errorf("no credentials file %s for profile %s", path, name)
+	} else if err != nil {
+		return Credentials{}, err
+	}
+	defer f.Close()
+
+	profiles, err := Parse(f)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("%s: %w", path, err)
+	}
+	creds, ok := profiles[name]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return Credentials{}, fmt.Errorf("no profile %s in %s, it has %s", name, path, strings.Join(names, ", "))
+	}
+	return creds, nil
+}
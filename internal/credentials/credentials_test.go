@@ -0,0 +1,54 @@
+package credentials
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testFile = `# Datadog organizations
+[prod-org]
+api_key = prod-api
+app_key = prod-app
+
+[staging-org]
+api_key=staging-api
+app_key = staging-app
+site = datadoghq.eu
+`
+
+func TestParse(t *testing.T) {
+	profiles, err := Parse(strings.NewReader(testFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := profiles["staging-org"], (Credentials{APIKey: "staging-api", AppKey: "staging-app", Site: "datadoghq.eu"}); got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+	if got, want := profiles["prod-org"], (Credentials{APIKey: "prod-api", AppKey: "prod-app"}); got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	for _, bad := range []string{"api_key = x", "[a]\ntoken = x", "[a]\napi_key", "[a]\n[a]"} {
+		if _, err := Parse(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected error for %q, got nil", bad)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(path, []byte(testFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(FileEnv, path)
+
+	creds, err := Load("staging-org")
+	if err != nil || creds.Site != "datadoghq.eu" {
+		t.Errorf("Expected the credentials of staging-org, got %+v: %v", creds, err)
+	}
+	if _, err := Load("dev-org"); err == nil || !strings.Contains(err.Error(), "prod-org, staging-org") {
+		t.Errorf("Expected error listing the profiles, got %v", err)
+	}
+}
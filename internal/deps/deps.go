@@ -0,0 +1,81 @@
+// Package deps ranks the third-party modules of a profile by the attributed
+// cpu of their functions, answering which dependency costs the most.
+package deps
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Module is the usage of one version of a dependency.
+type Module struct {
+	Path        string
+	Version     string
+	SelfAttrCPU float64 // sum of the attributed cpu of its functions, including the stdlib calls they make
+	SelfCPU     float64
+	Functions   int
+	Top         string // function with the most attributed cpu
+	topCPU      float64
+}
+
+// Analyze groups the nodes of the functions of dependencies by module and
+// returns the modules by descending attributed cpu, ties broken by path.
+func Analyze(nodes map[string]*pb.FunctionNode) []*Module {
+	modules := make(map[string]*Module)
+	for _, node := range nodes {
+		if node.Module == "" {
+			continue
+		}
+		key := node.Module + "@" + node.Version
+		module, exists := modules[key]
+		if !exists {
+			module = &Module{Path: node.Module, Version: node.Version}
+			modules[key] = module
+		}
+		module.SelfAttrCPU += node.SelfAttrCPU
+		module.SelfCPU += node.SelfCPU
+		module.Functions++
+		if node.SelfAttrCPU > module.topCPU || node.SelfAttrCPU == module.topCPU && (module.Top == "" || node.Name < module.Top) {
+			module.Top, module.topCPU = node.Name, node.SelfAttrCPU
+		}
+	}
+
+	result := make([]*Module, 0, len(modules))
+	for _, module := range modules {
+		result = append(result, module)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].SelfAttrCPU != result[j].SelfAttrCPU {
+			return result[i].SelfAttrCPU > result[j].SelfAttrCPU
+		}
+		if result[i].Path != result[j].Path {
+			return result[i].Path < result[j].Path
+		}
+		return result[i].Version < result[j].Version
+	})
+	return result
+}
+
+// Transform writes the top modules of the profile by attributed cpu, one per line as "attributed self functions module@version top-function", function names are formatted by the style. It returns the written modules.
+func Transform(pprof *pb.Profile, w io.Writer, opts pb.AnalyzeOptions, top int, style term.Style) ([]*Module, error) {
+	nodes, err := pb.AnalyzeCPUProfile(pprof, opts)
+	if err != nil {
+		return nil, err
+	}
+	modules := Analyze(nodes)
+	if len(modules) == 0 {
+		return nil, fmt.Errorf("no functions of dependencies in the module cache found in profile, the files of functions do not name module versions")
+	}
+
+	if top > 0 && len(modules) > top {
+		modules = modules[:top]
+	}
+	for _, module := range modules {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s@%s\t%s\n", style.Percent(module.SelfAttrCPU), style.Percent(module.SelfCPU), module.Functions, module.Path, module.Version, style.Name(module.Top))
+	}
+	return modules, nil
+}
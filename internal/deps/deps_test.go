@@ -0,0 +1,51 @@
+package deps
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestTransform(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	main := pb.Stack{Name: "main.main", FileName: "/app/main.go"}
+	decode := pb.Stack{Name: "github.com/BurntSushi/toml.Decode", FileName: "/go/pkg/mod/github.com/!burnt!sushi/toml@v1.3.2/decode.go"}
+	unify := pb.Stack{Name: "github.com/BurntSushi/toml.(*decoder).unify", FileName: "/go/pkg/mod/github.com/!burnt!sushi/toml@v1.3.2/decode.go"}
+	query := pb.Stack{Name: "github.com/lib/pq.(*conn).query", FileName: "github.com/lib/pq@v1.10.9/conn.go"}
+	b.AddSample([]pb.Stack{unify, decode, main}, []int64{30}, nil)
+	b.AddSample([]pb.Stack{decode, main}, []int64{10}, nil)
+	b.AddSample([]pb.Stack{query, main}, []int64{20}, nil)
+	b.AddSample([]pb.Stack{main}, []int64{40}, nil)
+
+	var buf bytes.Buffer
+	if _, err := Transform(b.Profile(), &buf, pb.AnalyzeOptions{}, 10, term.Style{}); err != nil {
+		t.Fatal(err)
+	}
+	want := "40.00\t40.00\t2\tgithub.com/BurntSushi/toml@v1.3.2\tgithub.com/BurntSushi/toml.(*decoder).unify\n" +
+		"20.00\t20.00\t1\tgithub.com/lib/pq@v1.10.9\tgithub.com/lib/pq.(*conn).query\n"
+	if buf.String() != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, buf.String())
+	}
+}
+
+func TestModuleVersion(t *testing.T) {
+	tests := []struct {
+		file, module, version string
+		ok                    bool
+	}{
+		{"/root/go/pkg/mod/github.com/!burnt!sushi/toml@v1.3.2/decode.go", "github.com/BurntSushi/toml", "v1.3.2", true},
+		{"C:/Users/me/go/pkg/mod/golang.org/x/net@v0.0.0-20240101000000-abcdef123456/http2/frame.go", "golang.org/x/net", "v0.0.0-20240101000000-abcdef123456", true},
+		{"github.com/lib/pq@v1.10.9/conn.go", "github.com/lib/pq", "v1.10.9", true},
+		{"/go/pkg/mod/golang.org/toolchain@v0.0.1-go1.23.0.linux-amd64/src/runtime/proc.go", "", "", false},
+		{"/usr/local/go/src/runtime/proc.go", "", "", false},
+		{"/home/me@work/app/main.go", "", "", false},
+	}
+	for _, tt := range tests {
+		module, version, ok := pb.ModuleVersion(tt.file)
+		if module != tt.module || version != tt.version || ok != tt.ok {
+			t.Errorf("ModuleVersion(%q): expected %q %q %v, got %q %q %v", tt.file, tt.module, tt.version, tt.ok, module, version, ok)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package deps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// defaultProxy is the module proxy of the go command when GOPROXY is unset.
+const defaultProxy = "https://proxy.golang.org"
+
+// Proxy is a client of a Go module proxy, see https://go.dev/ref/mod#goproxy-protocol.
+type Proxy struct {
+	URL string
+}
+
+// ProxyFromEnv returns the first proxy of a GOPROXY list, or the default
+// proxy if it is empty. It returns an error if the list names no proxy to
+// query, e.g. "direct" or "off".
+func ProxyFromEnv(goproxy string) (*Proxy, error) {
+	if goproxy == "" {
+		return &Proxy{URL: defaultProxy}, nil
+	}
+	for _, entry := range strings.FieldsFunc(goproxy, func(r rune) bool { return r == ',' || r == '|' }) {
+		switch entry = strings.TrimSpace(entry); entry {
+		case "", "direct":
+			continue
+		case "off":
+			return nil, errors.New("GOPROXY=off disables the module proxy")
+		}
+		return &Proxy{URL: strings.TrimSuffix(entry, "/")}, nil
+	}
+	return nil, fmt.Errorf("GOPROXY=%s names no module proxy", goproxy)
+}
+
+// Versions returns the released versions of a module, without pre-releases
+// and +incompatible versions, in ascending order.
+func (p *Proxy) Versions(ctx context.Context, module string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.URL+"/"+escapeModulePath(module)+"/@v/list", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s: %s", module, res.Status)
+	}
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, v := range strings.Fields(string(data)) {
+		if parsed, ok := parseVersion(v); ok && parsed.release {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		a, _ := parseVersion(versions[i])
+		b, _ := parseVersion(versions[j])
+		return a.less(b)
+	})
+	return versions, nil
+}
+
+// Outdated describes how far the version of a module in a profile is behind
+// its latest release.
+type Outdated struct {
+	Module  *Module
+	Latest  string
+	Minors  int // newer minor releases of the major version
+	Patches int // newer patch releases of the minor version
+}
+
+func (o Outdated) String() string {
+	behind := fmt.Sprintf("%d minor versions", o.Minors)
+	switch {
+	case o.Minors == 1:
+		behind = "1 minor version"
+	case o.Minors == 0 && o.Patches == 1:
+		behind = "1 patch version"
+	case o.Minors == 0:
+		behind = fmt.Sprintf("%d patch versions", o.Patches)
+	}
+	return fmt.Sprintf("hot dependency %s is %s behind (%s, latest %s)", o.Module.Path, behind, o.Module.Version, o.Latest)
+}
+
+// Behind compares the version of the module to the released versions of its
+// major version and reports whether it is outdated. Pseudo-versions count as
+// the release they are based on.
+func Behind(module *Module, versions []string) (Outdated, bool) {
+	current, ok := parseVersion(module.Version)
+	if !ok {
+		return Outdated{}, false
+	}
+	if !current.release && current.patch > 0 {
+		// pseudo-versions like v1.2.4-0.2024... are built on top of v1.2.3
+		current.patch--
+	}
+
+	result := Outdated{Module: module}
+	minors := make(map[int]bool)
+	var latest version
+	for _, v := range versions {
+		parsed, ok := parseVersion(v)
+		if !ok || parsed.major != current.major || !current.less(parsed) {
+			continue
+		}
+		if parsed.minor > current.minor {
+			minors[parsed.minor] = true
+		} else if parsed.minor == current.minor && parsed.patch > current.patch {
+			result.Patches++
+		}
+		if latest.raw == "" || latest.less(parsed) {
+			latest = parsed
+		}
+	}
+	if latest.raw == "" {
+		return Outdated{}, false
+	}
+	result.Minors = len(minors)
+	result.Latest = latest.raw
+	return result, true
+}
+
+// version is a parsed semantic version, e.g. v1.2.3 or v0.0.0-20240101000000-abcdef123456.
+type version struct {
+	raw                 string
+	major, minor, patch int
+	release             bool // no pre-release or +incompatible suffix
+}
+
+func parseVersion(v string) (version, bool) {
+	rest, ok := strings.CutPrefix(v, "v")
+	if !ok {
+		return version{}, false
+	}
+	parsed := version{raw: v, release: !strings.ContainsAny(rest, "-+")}
+	if i := strings.IndexAny(rest, "-+"); i >= 0 {
+		rest = rest[:i]
+	}
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return version{}, false
+	}
+	numbers := [3]*int{&parsed.major, &parsed.minor, &parsed.patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return version{}, false
+		}
+		*numbers[i] = n
+	}
+	return parsed, true
+}
+
+// less orders versions by their numbers, pre-releases before their release.
+func (v version) less(w version) bool {
+	if v.major != w.major {
+		return v.major < w.major
+	}
+	if v.minor != w.minor {
+		return v.minor < w.minor
+	}
+	if v.patch != w.patch {
+		return v.patch < w.patch
+	}
+	return !v.release && w.release
+}
+
+// escapeModulePath escapes the upper case letters of a module path for the
+// module proxy, e.g. github.com/BurntSushi/toml -> github.com/!burnt!sushi/toml.
+func escapeModulePath(module string) string {
+	var b strings.Builder
+	for _, r := range module {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Updates looks up the released versions of the modules with the proxy and
+// returns the outdated ones, in the order of the modules. Modules the proxy
+// does not know, e.g. private ones, are skipped.
+func (p *Proxy) Updates(ctx context.Context, modules []*Module) ([]Outdated, error) {
+	var outdated []Outdated
+	var errs []error
+	for _, module := range modules {
+		versions, err := p.Versions(ctx, module.Path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if o, ok := Behind(module, versions); ok {
+			outdated = append(outdated, o)
+		}
+	}
+	if len(errs) == len(modules) && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return outdated, nil
+}
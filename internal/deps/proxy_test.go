@@ -0,0 +1,94 @@
+package deps
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxyVersions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/github.com/!burnt!sushi/toml/@v/list" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("v1.3.2\nv1.10.0\nv1.4.0-rc.1\nv1.4.0\nv2.0.0+incompatible\nv1.3.10\n"))
+	}))
+	defer server.Close()
+
+	proxy, err := ProxyFromEnv(server.URL + "/,direct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := proxy.Versions(context.Background(), "github.com/BurntSushi/toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"v1.3.2", "v1.3.10", "v1.4.0", "v1.10.0"}
+	if len(versions) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, versions)
+	}
+	for i := range want {
+		if versions[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, versions)
+		}
+	}
+
+	if _, err := proxy.Versions(context.Background(), "github.com/lib/pq"); err == nil {
+		t.Errorf("Expected an error for an unknown module")
+	}
+}
+
+func TestProxyFromEnv(t *testing.T) {
+	tests := []struct {
+		goproxy, url string
+		err          bool
+	}{
+		{"", defaultProxy, false},
+		{"direct,https://goproxy.io|https://proxy.golang.org", "https://goproxy.io", false},
+		{"direct", "", true},
+		{"off", "", true},
+	}
+	for _, tt := range tests {
+		proxy, err := ProxyFromEnv(tt.goproxy)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ProxyFromEnv(%q): expected an error, got %s", tt.goproxy, proxy.URL)
+			}
+			continue
+		}
+		if err != nil || proxy.URL != tt.url {
+			t.Errorf("ProxyFromEnv(%q): expected %s, got %v %v", tt.goproxy, tt.url, proxy, err)
+		}
+	}
+}
+
+func TestBehind(t *testing.T) {
+	versions := []string{"v1.2.0", "v1.3.2", "v1.3.4", "v1.3.5", "v1.4.0", "v1.5.0", "v1.6.1", "v1.7.0"}
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"v1.3.2", "hot dependency m is 4 minor versions behind (v1.3.2, latest v1.7.0)"},
+		{"v1.6.1", "hot dependency m is 1 minor version behind (v1.6.1, latest v1.7.0)"},
+		{"v1.3.4-0.20240101000000-abcdef123456", "hot dependency m is 4 minor versions behind (v1.3.4-0.20240101000000-abcdef123456, latest v1.7.0)"},
+		{"v1.7.0", ""},
+		{"v2.0.0", ""},
+	}
+	for _, tt := range tests {
+		outdated, ok := Behind(&Module{Path: "m", Version: tt.version}, versions)
+		got := ""
+		if ok {
+			got = outdated.String()
+		}
+		if got != tt.want {
+			t.Errorf("Behind(%s): expected %q, got %q", tt.version, tt.want, got)
+		}
+	}
+
+	outdated, _ := Behind(&Module{Path: "m", Version: "v1.7.0"}, append(versions, "v1.7.1", "v1.7.2"))
+	if got, want := outdated.String(), "hot dependency m is 2 patch versions behind (v1.7.0, latest v1.7.2)"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
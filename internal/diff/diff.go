@@ -0,0 +1,166 @@
+// Package diff compares the attributed cpu of functions between two profiles,
+// e.g. a local benchmark and a production profile.
+package diff
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Function is the usage of a function in the base and new profile.
+type Function struct {
+	Name     string
+	FileName string
+	Base     float64
+	New      float64
+}
+
+// Delta returns the change in usage from the base to the new profile.
+func (f *Function) Delta() float64 {
+	return f.New - f.Base
+}
+
+// Result is the comparison of two profiles. Usages are in cores, cpu seconds
+// per second of the profile's duration, so that profiles of different
+// durations compare, or per second of the analyzed sample type if it is not
+// cpu. If a profile has no duration they are percentages of each profile's
+// total instead.
+type Result struct {
+	Unit      string // "cores", "<sample type>/s" or "%"
+	Base      float64
+	New       float64
+	Functions []*Function // by descending absolute delta, ties broken by name
+}
+
+// Diff compares the attributed cpu of every function of profile to base.
+func Diff(base, profile *pb.Profile, opts pb.AnalyzeOptions) (*Result, error) {
+	return diff(base, profile, opts, false)
+}
+
+// DiffShares compares the share of the attributed cpu of every function of
+// profile to base in percent, for profiles of services under different load,
+// such as the same service in different environments.
+func DiffShares(base, profile *pb.Profile, opts pb.AnalyzeOptions) (*Result, error) {
+	return diff(base, profile, opts, true)
+}
+
+func diff(base, profile *pb.Profile, opts pb.AnalyzeOptions, shares bool) (*Result, error) {
+	analyzer, err := pb.NewAnalyzer(opts)
+	if err != nil {
+		return nil, err
+	}
+	baseNodes, baseScale, err := analyze(analyzer, base)
+	if err != nil {
+		return nil, fmt.Errorf("base: %w", err)
+	}
+	nodes, scale, err := analyze(analyzer, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Unit: "cores", Base: 100 * baseScale, New: 100 * scale}
+	if opts.SampleType != "" {
+		result.Unit = opts.SampleType + "/s"
+		result.Base, result.New = result.Base*1e9, result.New*1e9
+		baseScale, scale = baseScale*1e9, scale*1e9
+	}
+	if shares || base.DurationNanos <= 0 || profile.DurationNanos <= 0 {
+		result.Unit, result.Base, result.New = "%", 100, 100
+		baseScale, scale = 1, 1
+	}
+
+	functions := make(map[string]*Function)
+	function := func(node *pb.FunctionNode) *Function {
+		fn, exists := functions[node.Name]
+		if !exists {
+			fn = &Function{Name: node.Name, FileName: node.FileName}
+			functions[node.Name] = fn
+		}
+		return fn
+	}
+	for _, node := range baseNodes {
+		function(node).Base = node.SelfAttrCPU * baseScale
+	}
+	for _, node := range nodes {
+		function(node).New = node.SelfAttrCPU * scale
+	}
+
+	for _, fn := range functions {
+		result.Functions = append(result.Functions, fn)
+	}
+	sort.Slice(result.Functions, func(i, j int) bool {
+		a, b := result.Functions[i], result.Functions[j]
+		if da, db := math.Abs(a.Delta()), math.Abs(b.Delta()); da != db {
+			return da > db
+		}
+		return a.Name < b.Name
+	})
+	return result, nil
+}
+
+// analyze returns the nodes of the profile, valued in percent, and the factor
+// converting percentages to sample values per nanosecond, i.e. cores for cpu.
+func analyze(analyzer *pb.Analyzer, p *pb.Profile) (map[string]*pb.FunctionNode, float64, error) {
+	report := analyzer.NewReport()
+	if err := analyzer.Ingest(report, p); err != nil {
+		return nil, 0, err
+	}
+	if report.Total() == 0 {
+		return nil, 0, fmt.Errorf("no CPU time recorded in profile")
+	}
+	scale := 0.0
+	if p.DurationNanos > 0 {
+		scale = float64(report.Total()) / float64(p.DurationNanos) / 100
+	}
+	return report.Nodes(), scale, nil
+}
+
+// Divergent returns the functions whose usage changed by at least threshold,
+// in the unit of the result, by descending absolute change.
+func (r *Result) Divergent(threshold float64) []*Function {
+	var divergent []*Function
+	for _, fn := range r.Functions {
+		if math.Abs(fn.Delta()) < threshold {
+			break
+		}
+		divergent = append(divergent, fn)
+	}
+	return divergent
+}
+
+// Write prints the totals and the top functions by absolute change, one per
+// line as "delta base new function".
+func (r *Result) Write(w io.Writer, top int, style term.Style) {
+	l := style.Locale
+	fmt.Fprintf(w, "total\t%s -> %s %s (%s)\n", l.Format(r.Base, 3), l.Format(r.New, 3), r.Unit, change(r.Base, r.New, l))
+
+	style = style.After(3) // delta, base and new
+	for i, fn := range r.Functions {
+		if i == top || fn.Delta() == 0 {
+			break
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", style.Delta(fn.Delta()), l.Format(fn.Base, 3), l.Format(fn.New, 3), style.Function(fn.Name, fn.FileName))
+	}
+}
+
+// change formats the relative change from base to v in the locale.
+func change(base, v float64, l term.Locale) string {
+	if base == 0 {
+		return "new"
+	}
+	return l.FormatSigned((v-base)/base*100, 1) + "%"
+}
+
+// Duration returns the duration of a profile for display, or "unknown".
+func Duration(p *pb.Profile) string {
+	if p.DurationNanos <= 0 {
+		return "unknown"
+	}
+	return time.Duration(p.DurationNanos).Round(time.Millisecond).String()
+}
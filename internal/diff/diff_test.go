@@ -0,0 +1,107 @@
+package diff
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func almostEqual(a, b, eps float64) bool {
+	return math.Abs(a-b) < eps
+}
+
+// testProfile returns a cpu profile of the duration with the cpu time in
+// seconds of each function, called by main.main.
+func testProfile(duration time.Duration, cpu map[string]float64) *pb.Profile {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	for name, seconds := range cpu {
+		stack := []pb.Stack{{Name: name, FileName: "main.go"}, {Name: "main.main", FileName: "main.go"}}
+		b.AddSample(stack, []int64{int64(seconds * 1e9)}, nil)
+	}
+	p := b.Profile()
+	p.DurationNanos = int64(duration)
+	return p
+}
+
+func TestDiff(t *testing.T) {
+	// the base ran 60s on 1 core, the new profile 10s on 0.5 cores with
+	// main.parse twice as expensive.
+	base := testProfile(60*time.Second, map[string]float64{"main.parse": 30, "main.render": 30})
+	profile := testProfile(10*time.Second, map[string]float64{"main.parse": 3.75, "main.render": 1.25})
+
+	result, err := Diff(base, profile, pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Unit != "cores" || !almostEqual(result.Base, 1, 1e-9) || !almostEqual(result.New, 0.5, 1e-9) {
+		t.Errorf("Expected 1 -> 0.5 cores, got %v -> %v %s", result.Base, result.New, result.Unit)
+	}
+	if len(result.Functions) != 3 {
+		t.Fatalf("Expected 3 functions, got %d", len(result.Functions))
+	}
+	render := result.Functions[0]
+	if render.Name != "main.render" || !almostEqual(render.Base, 0.5, 1e-9) || !almostEqual(render.New, 0.125, 1e-9) {
+		t.Errorf("Expected main.render 0.5 -> 0.125, got %+v", render)
+	}
+
+	var buf bytes.Buffer
+	result.Write(&buf, 10, term.Style{})
+	want := "total\t1.000 -> 0.500 cores (-50.0%)\n" +
+		"-0.375\t0.500\t0.125\tmain.render in main.go\n" +
+		"-0.125\t0.500\t0.375\tmain.parse in main.go\n"
+	if buf.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, buf.String())
+	}
+}
+
+func TestDiffWithoutDuration(t *testing.T) {
+	base := testProfile(0, map[string]float64{"main.parse": 1, "main.render": 3})
+	profile := testProfile(10*time.Second, map[string]float64{"main.parse": 1, "main.render": 1})
+
+	result, err := Diff(base, profile, pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Unit != "%" {
+		t.Errorf("Expected percentages, got %s", result.Unit)
+	}
+
+	var buf bytes.Buffer
+	result.Write(&buf, 1, term.Style{})
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 2 || lines[1] != "+25.000\t25.000\t50.000\tmain.parse in main.go" {
+		t.Errorf("Expected main.parse to grow from 25%% to 50%%, got:\n%s", buf.String())
+	}
+}
+
+func TestDiffShares(t *testing.T) {
+	// staging has little traffic, so debug logging is a large share of it.
+	base := testProfile(60*time.Second, map[string]float64{"main.handle": 2, "main.debugLog": 2})
+	profile := testProfile(60*time.Second, map[string]float64{"main.handle": 60, "main.debugLog": 0.5})
+
+	result, err := DiffShares(base, profile, pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Unit != "%" {
+		t.Errorf("Expected percentages, got %s", result.Unit)
+	}
+
+	divergent := make(map[string]*Function)
+	for _, fn := range result.Divergent(5) {
+		divergent[fn.Name] = fn
+	}
+	if len(divergent) != 2 || divergent["main.debugLog"] == nil || divergent["main.handle"] == nil {
+		t.Fatalf("Expected main.debugLog and main.handle to diverge, got %v", divergent)
+	}
+	if fn := divergent["main.debugLog"]; !almostEqual(fn.Base, 50, 1e-9) || !almostEqual(fn.New, 100*0.5/60.5, 1e-9) {
+		t.Errorf("Expected main.debugLog 50%% -> 0.83%%, got %+v", fn)
+	}
+	if divergent := result.Divergent(60); len(divergent) != 0 {
+		t.Errorf("Expected nothing to diverge by 60%%, got %+v", divergent)
+	}
+}
@@ -0,0 +1,217 @@
+package diff
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/internal/theme"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Layout of flamegraphs, in pixels.
+const (
+	flameWidth       = 1200
+	flameFrameHeight = 16
+	flameMargin      = 10
+	flameHeader      = 40
+	flameCharWidth   = 7 // approximate width of a character of the 12px font
+	flameMinWidth    = 0.1
+)
+
+// FlameNode is a frame of a differential flamegraph, the usage of a call path
+// in the base and new profile, in the unit of the flamegraph.
+type FlameNode struct {
+	Name     string
+	Base     float64
+	New      float64
+	Children []*FlameNode // by name
+}
+
+// Flame is a differential flamegraph of two profiles. Frames are as wide as
+// their usage in the new profile and colored by their change since the base:
+// red if they grew, blue if they shrank.
+type Flame struct {
+	Unit string // "cores", "<sample type>/s" or "%", see Result
+	Root *FlameNode
+}
+
+// DiffFlame merges the call trees of the profiles into a differential
+// flamegraph. Only the sample type, the focus and ignore filters and the max
+// depth of the options apply, frames are functions including the inlined
+// ones.
+func DiffFlame(base, profile *pb.Profile, opts pb.AnalyzeOptions) (*Flame, error) {
+	baseIdx, err := pb.SampleTypeIndex(base, opts.SampleType)
+	if err != nil {
+		return nil, fmt.Errorf("base: %w", err)
+	}
+	idx, err := pb.SampleTypeIndex(profile, opts.SampleType)
+	if err != nil {
+		return nil, err
+	}
+
+	flame := &Flame{Unit: "cores", Root: &FlameNode{Name: "root"}}
+	baseScale, scale := 1/float64(base.DurationNanos), 1/float64(profile.DurationNanos)
+	if opts.SampleType != "" {
+		flame.Unit = opts.SampleType + "/s"
+		baseScale, scale = baseScale*1e9, scale*1e9
+	}
+	if base.DurationNanos <= 0 || profile.DurationNanos <= 0 {
+		baseTotal, total := flameTotal(base, baseIdx), flameTotal(profile, idx)
+		if baseTotal == 0 || total == 0 {
+			return nil, fmt.Errorf("no samples in profiles")
+		}
+		flame.Unit = "%"
+		baseScale, scale = 100/float64(baseTotal), 100/float64(total)
+	}
+
+	index := make(map[*FlameNode]map[string]*FlameNode)
+	add := func(p *pb.Profile, idx int, scale float64, isBase bool) {
+		stacks := pb.Frames(p)
+		for i, sample := range p.Sample {
+			frames := stacks[i]
+			if !pb.KeepFrames(frames, opts) {
+				continue
+			}
+			value := float64(sample.Value[idx]) * scale
+			node := flame.Root
+			for _, name := range pb.TrimFrames(frames, opts) {
+				if index[node] == nil {
+					index[node] = make(map[string]*FlameNode)
+				}
+				child := index[node][name]
+				if child == nil {
+					child = &FlameNode{Name: name}
+					index[node][name] = child
+					node.Children = append(node.Children, child)
+				}
+				node = child
+				if isBase {
+					node.Base += value
+				} else {
+					node.New += value
+				}
+			}
+			if isBase {
+				flame.Root.Base += value
+			} else {
+				flame.Root.New += value
+			}
+		}
+	}
+	add(base, baseIdx, baseScale, true)
+	add(profile, idx, scale, false)
+	if flame.Root.New == 0 {
+		return nil, fmt.Errorf("no samples in profile")
+	}
+	flame.Root.sort()
+	return flame, nil
+}
+
+// sort orders the children of the tree by name.
+func (n *FlameNode) sort() {
+	sort.Slice(n.Children, func(i, j int) bool { return n.Children[i].Name < n.Children[j].Name })
+	for _, child := range n.Children {
+		child.sort()
+	}
+}
+
+// flameTotal returns the sum of the values of the sample type.
+func flameTotal(p *pb.Profile, idx int) int64 {
+	var total int64
+	for _, sample := range p.Sample {
+		total += sample.Value[idx]
+	}
+	return total
+}
+
+// depth returns the number of levels of the tree below n.
+func (n *FlameNode) depth() int {
+	d := 0
+	for _, child := range n.Children {
+		d = max(d, child.depth()+1)
+	}
+	return d
+}
+
+// WriteSVG renders the flamegraph as an SVG image styled by the theme, with the
+// root at the bottom. Frames have a tooltip with their usage in both profiles.
+func (f *Flame) WriteSVG(w io.Writer, title string, th theme.Theme) error {
+	height := flameHeader + (f.Root.depth()+1)*flameFrameHeight + 2*flameMargin
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="Verdana, sans-serif" font-size="12">`+"\n", flameWidth, height, flameWidth, height)
+	b.WriteString(th.Style())
+	fmt.Fprintf(&b, `<rect class="background" width="100%%" height="100%%" fill="#fafafa"/>`+"\n")
+	fmt.Fprintf(&b, `<text x="%d" y="24" text-anchor="middle" font-size="16">%s</text>`+"\n", flameWidth/2, html.EscapeString(title))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" fill="#555">red frames grew, blue frames shrank, widths are the new usage of %.3f %s</text>`+"\n", flameMargin, flameHeader-4, f.Root.New, f.Unit)
+
+	scale := float64(flameWidth-2*flameMargin) / f.Root.New
+	f.writeFrames(&b, f.Root, flameMargin, height-flameMargin-flameFrameHeight, scale, th.Dark)
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeFrames writes the frame of n at x, y and its children above it.
+func (f *Flame) writeFrames(b *strings.Builder, n *FlameNode, x float64, y int, scale float64, dark bool) {
+	width := n.New * scale
+	if width < flameMinWidth {
+		return
+	}
+	tooltip := fmt.Sprintf("%s\n%.3f -> %.3f %s (%s)", n.Name, n.Base, n.New, f.Unit, change(n.Base, n.New, term.Locale{}))
+	fmt.Fprintf(b, `<g><title>%s</title><rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s" stroke="#fff" stroke-width="0.5"/>`, html.EscapeString(tooltip), x, y, width, flameFrameHeight-1, flameColor(n.Base, n.New, dark))
+	if chars := int(width-6) / flameCharWidth; chars >= 3 {
+		label := n.Name
+		if len(label) > chars {
+			label = label[:chars-2] + ".."
+		}
+		fmt.Fprintf(b, `<text x="%.1f" y="%d">%s</text>`, x+3, y+flameFrameHeight-4, html.EscapeString(label))
+	}
+	b.WriteString("</g>\n")
+
+	for _, child := range n.Children {
+		f.writeFrames(b, child, x, y-flameFrameHeight, scale, dark)
+		x += child.New * scale
+	}
+}
+
+// flameColor returns the color of a frame, white if unchanged, shading to red
+// as it grew and to blue as it shrank relative to its larger usage. On a dark
+// background unchanged frames are dark grey instead.
+func flameColor(base, new float64, dark bool) string {
+	larger := math.Max(base, new)
+	shade := 0
+	if larger > 0 {
+		shade = int(math.Round(200 * math.Abs(new-base) / larger))
+	}
+	if dark {
+		if new >= base {
+			return fmt.Sprintf("rgb(%d,48,48)", 48+shade)
+		}
+		return fmt.Sprintf("rgb(48,48,%d)", 48+shade)
+	}
+	if larger == 0 {
+		return "rgb(255,255,255)"
+	}
+	if new >= base {
+		return fmt.Sprintf("rgb(255,%d,%d)", 255-shade, 255-shade)
+	}
+	return fmt.Sprintf("rgb(%d,%d,255)", 255-shade, 255-shade)
+}
+
+// WriteHTML renders the flamegraph as an HTML page embedding the SVG image,
+// whose theme styles the page as well.
+func (f *Flame) WriteHTML(w io.Writer, title string, th theme.Theme) error {
+	if _, err := fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n", html.EscapeString(title)); err != nil {
+		return err
+	}
+	if err := f.WriteSVG(w, title, th); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "</body>\n</html>\n")
+	return err
+}
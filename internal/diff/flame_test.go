@@ -0,0 +1,75 @@
+package diff
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/theme"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestDiffFlame(t *testing.T) {
+	base := testProfile(60*time.Second, map[string]float64{"main.parse": 30, "main.render": 30})
+	profile := testProfile(10*time.Second, map[string]float64{"main.parse": 3.75, "main.render": 1.25})
+
+	flame, err := DiffFlame(base, profile, pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flame.Unit != "cores" || !almostEqual(flame.Root.Base, 1, 1e-9) || !almostEqual(flame.Root.New, 0.5, 1e-9) {
+		t.Fatalf("Expected 1 -> 0.5 cores, got %.3f -> %.3f %s", flame.Root.Base, flame.Root.New, flame.Unit)
+	}
+	main := flame.Root.Children[0]
+	if len(flame.Root.Children) != 1 || main.Name != "main.main" || len(main.Children) != 2 {
+		t.Fatalf("Expected main.main calling two functions, got %+v", flame.Root.Children)
+	}
+	parse, render := main.Children[0], main.Children[1]
+	if parse.Name != "main.parse" || !almostEqual(parse.Base, 0.5, 1e-9) || !almostEqual(parse.New, 0.375, 1e-9) {
+		t.Errorf("Expected main.parse 0.5 -> 0.375 cores, got %+v", parse)
+	}
+	if render.Name != "main.render" || !almostEqual(render.New, 0.125, 1e-9) {
+		t.Errorf("Expected main.render 0.5 -> 0.125 cores, got %+v", render)
+	}
+
+	var buf bytes.Buffer
+	if err := flame.WriteHTML(&buf, "base.pprof -> new.pprof", theme.Light); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"<title>base.pprof -&gt; new.pprof</title>",
+		"main.parse\n0.500 -&gt; 0.375 cores (-25.0%)",
+		`fill="rgb(205,205,255)"`, // main.parse shrank by a quarter
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected the flamegraph to contain %q, got\n%s", want, out)
+		}
+	}
+	// frames are as wide as their new usage: main.parse 3 times main.render
+	widths := regexp.MustCompile(`<title>main\.(parse|render)\n[^<]*</title><rect x="[0-9.]+" y="[0-9]+" width="([0-9.]+)"`).FindAllStringSubmatch(out, -1)
+	if len(widths) != 2 || widths[0][2] != "885.0" || widths[1][2] != "295.0" {
+		t.Errorf("Expected widths 885 and 295, got %v", widths)
+	}
+}
+
+func TestDiffFlameShares(t *testing.T) {
+	base := testProfile(0, map[string]float64{"main.parse": 1})
+	profile := testProfile(0, map[string]float64{"main.parse": 1, "main.render": 3})
+	flame, err := DiffFlame(base, profile, pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	render := flame.Root.Children[0].Children[1]
+	if flame.Unit != "%" || render.Name != "main.render" || render.Base != 0 || render.New != 75 {
+		t.Errorf("Expected main.render to be new with 75%%, got %+v in %s", render, flame.Unit)
+	}
+	if got := flameColor(render.Base, render.New, false); got != "rgb(255,55,55)" {
+		t.Errorf("Expected a new frame to be red, got %s", got)
+	}
+	if got := flameColor(render.Base, render.New, true); got != "rgb(248,48,48)" {
+		t.Errorf("Expected a new frame to be red on a dark background, got %s", got)
+	}
+}
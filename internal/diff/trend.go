@@ -0,0 +1,151 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// minSteadyFit is the coefficient of determination of the linear fit of a
+// series above which a trend is steady rather than noise.
+const minSteadyFit = 0.8
+
+// Series is the usage of a function in a sequence of profiles.
+type Series struct {
+	Name     string
+	FileName string
+	Values   []float64
+	// Slope is the change of the usage per profile of the least squares line
+	// through the values, and Fit the share of their variance it explains.
+	Slope float64
+	Fit   float64
+}
+
+// Growing reports whether the usage grows steadily, by a line that fits the
+// values well, even if no two successive profiles differ by much.
+func (s *Series) Growing() bool {
+	return s.Slope > 0 && s.Fit >= minSteadyFit
+}
+
+// Trend is the comparison of a sequence of profiles, in the units of Result.
+type Trend struct {
+	Unit      string
+	Totals    []float64
+	Functions []*Series // by descending slope, ties broken by name
+}
+
+// Trends compares the attributed cpu of every function across the profiles,
+// in the order they were recorded.
+func Trends(profiles []*pb.Profile, opts pb.AnalyzeOptions) (*Trend, error) {
+	analyzer, err := pb.NewAnalyzer(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	trend := &Trend{Unit: "cores"}
+	if opts.SampleType != "" {
+		trend.Unit = opts.SampleType + "/s"
+	}
+	for _, p := range profiles {
+		if p.DurationNanos <= 0 {
+			trend.Unit = "%"
+		}
+	}
+
+	functions := make(map[string]*Series)
+	for i, p := range profiles {
+		nodes, scale, err := analyze(analyzer, p)
+		if err != nil {
+			return nil, fmt.Errorf("profile %d: %w", i+1, err)
+		}
+		switch {
+		case trend.Unit == "%":
+			scale = 1
+		case opts.SampleType != "":
+			scale *= 1e9
+		}
+		trend.Totals = append(trend.Totals, 100*scale)
+		for _, node := range nodes {
+			fn, exists := functions[node.Name]
+			if !exists {
+				fn = &Series{Name: node.Name, FileName: node.FileName, Values: make([]float64, len(profiles))}
+				functions[node.Name] = fn
+			}
+			fn.Values[i] = node.SelfAttrCPU * scale
+		}
+	}
+
+	for _, fn := range functions {
+		fn.Slope, fn.Fit = linearFit(fn.Values)
+		trend.Functions = append(trend.Functions, fn)
+	}
+	sort.Slice(trend.Functions, func(i, j int) bool {
+		a, b := trend.Functions[i], trend.Functions[j]
+		if a.Slope != b.Slope {
+			return a.Slope > b.Slope
+		}
+		return a.Name < b.Name
+	})
+	return trend, nil
+}
+
+// linearFit returns the slope of the least squares line through the values at
+// x = 0, 1, 2... and its coefficient of determination, 0 for constant values.
+func linearFit(values []float64) (slope, fit float64) {
+	n := float64(len(values))
+	var meanX, meanY float64
+	for i, y := range values {
+		meanX += float64(i)
+		meanY += y
+	}
+	meanX, meanY = meanX/n, meanY/n
+
+	var sxy, sxx, syy float64
+	for i, y := range values {
+		dx, dy := float64(i)-meanX, y-meanY
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0, 0
+	}
+	slope = sxy / sxx
+	return slope, sxy * sxy / (sxx * syy)
+}
+
+// Write prints the totals and the top functions by growth, one per line as
+// "slope fit values function", with "growing" before the function of the
+// steadily growing ones.
+func (t *Trend) Write(w io.Writer, top int, style term.Style) {
+	fmt.Fprintf(w, "total\t%s %s\n", series(t.Totals, style.Locale), t.Unit)
+
+	// The values of a function are about as wide as the totals.
+	style = style.After(3)
+	if style.Width > 0 {
+		style.Width -= len(series(t.Totals, style.Locale)) + 1
+	}
+	for i, fn := range t.Functions {
+		if i == top || fn.Slope <= 0 {
+			break
+		}
+		mark := ""
+		if fn.Growing() {
+			mark = "growing "
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s%s\n", style.Delta(fn.Slope), style.Locale.Format(fn.Fit, 2), series(fn.Values, style.Locale), mark, style.Function(fn.Name, fn.FileName))
+	}
+}
+
+// series formats values in the locale separated by arrows.
+func series(values []float64, l term.Locale) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = l.Format(v, 3)
+	}
+	return strings.Join(parts, " -> ")
+}
@@ -0,0 +1,43 @@
+package diff
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestTrends(t *testing.T) {
+	// main.parse grows by 0.05 cores per profile, never by more than the
+	// noise of main.render between two profiles.
+	var profiles []*pb.Profile
+	for i, render := range []float64{3, 1, 3, 1} {
+		profiles = append(profiles, testProfile(10*time.Second, map[string]float64{"main.parse": 1 + 0.5*float64(i), "main.render": render}))
+	}
+
+	trend, err := Trends(profiles, pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trend.Unit != "cores" || len(trend.Totals) != 4 || !almostEqual(trend.Totals[0], 0.4, 1e-9) {
+		t.Errorf("Expected 4 totals in cores from 0.4, got %v %s", trend.Totals, trend.Unit)
+	}
+	parse := trend.Functions[0]
+	if parse.Name != "main.parse" || !almostEqual(parse.Slope, 0.05, 1e-9) || !almostEqual(parse.Fit, 1, 1e-9) || !parse.Growing() {
+		t.Errorf("Expected main.parse growing steadily by 0.05, got %+v", parse)
+	}
+	render := trend.Functions[2]
+	if render.Name != "main.render" || render.Slope >= 0 || render.Growing() {
+		t.Errorf("Expected main.render not growing, got %+v", render)
+	}
+
+	var buf bytes.Buffer
+	trend.Write(&buf, 10, term.Style{})
+	want := "total\t0.400 -> 0.250 -> 0.500 -> 0.350 cores\n" +
+		"+0.050\t1.00\t0.100 -> 0.150 -> 0.200 -> 0.250\tgrowing main.parse in main.go\n"
+	if buf.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, buf.String())
+	}
+}
@@ -0,0 +1,280 @@
+// Package escape correlates the escape analysis diagnostics of the compiler
+// with the hot allocation sites of heap profiles, ranking the heap escapes
+// worth fixing by the memory they allocate.
+package escape
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kmrgirish/pprof-adv/internal/source"
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Diagnostic is an escape analysis diagnostic of go build -gcflags=-m.
+type Diagnostic struct {
+	File    string // slash separated path relative to the source directory
+	Line    int64
+	Column  int
+	Message string
+}
+
+// ParseDiagnostics reads the heap escapes reported by go build -gcflags=-m,
+// e.g. "./store/store.go:42:13: &Item{...} escapes to heap", ignoring the
+// other diagnostics.
+func ParseDiagnostics(r io.Reader) ([]Diagnostic, error) {
+	var diagnostics []Diagnostic
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.Contains(line, "escapes to heap") && !strings.Contains(line, "moved to heap:") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 4)
+		if len(parts) != 4 {
+			continue
+		}
+		lineNo, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		column, err := strconv.Atoi(parts[2])
+		if err != nil {
+			continue
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			File:    path.Clean(filepath.ToSlash(parts[0])),
+			Line:    lineNo,
+			Column:  column,
+			Message: strings.TrimSpace(parts[3]),
+		})
+	}
+	return diagnostics, scanner.Err()
+}
+
+// Site is a source line allocating memory.
+type Site struct {
+	File     string // slash separated path relative to the source directory
+	Line     int64
+	Function string
+	Value    int64
+}
+
+// Fix is a hot allocation site with the heap escapes reported on its line.
+type Fix struct {
+	Site
+	Percent     float64 // share of the allocations of the profile
+	Diagnostics []Diagnostic
+}
+
+// Sites returns the allocation sites of the profile in the source files,
+// which are slash separated paths relative to the source directory, by
+// descending value of the sample type. The site of a sample is its innermost
+// frame in the source files, allocations in the stdlib and dependencies are
+// thereby attributed to the line of the source calling them. It also returns
+// the total value of the samples.
+func Sites(p *pb.Profile, sampleType string, files []string) ([]Site, int64, error) {
+	idx, err := sampleIndex(p, sampleType)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	functions := make(map[uint64]*pb.Function, len(p.Function))
+	for _, fn := range p.Function {
+		functions[fn.Id] = fn
+	}
+	locations := make(map[uint64]*pb.Location, len(p.Location))
+	for _, loc := range p.Location {
+		locations[loc.Id] = loc
+	}
+	resolved := make(map[string]string)
+	resolve := func(file string) string {
+		if rel, exists := resolved[file]; exists {
+			return rel
+		}
+		rel := source.Resolve(file, files)
+		resolved[file] = rel
+		return rel
+	}
+
+	type key struct {
+		file string
+		line int64
+	}
+	sites := make(map[key]*Site)
+	var total int64
+	for _, sample := range p.Sample {
+		value := sample.Value[idx]
+		total += value
+	frames:
+		for _, id := range sample.LocationId {
+			loc := locations[id]
+			if loc == nil {
+				continue
+			}
+			for _, line := range loc.Line {
+				fn := functions[line.FunctionId]
+				if fn == nil {
+					continue
+				}
+				rel := resolve(p.StringTable[fn.Filename])
+				if rel == "" {
+					continue
+				}
+				k := key{rel, line.Line}
+				if sites[k] == nil {
+					sites[k] = &Site{File: rel, Line: line.Line, Function: p.StringTable[fn.Name]}
+				}
+				sites[k].Value += value
+				break frames
+			}
+		}
+	}
+
+	result := make([]Site, 0, len(sites))
+	for _, site := range sites {
+		if site.Value > 0 {
+			result = append(result, *site)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Value != result[j].Value {
+			return result[i].Value > result[j].Value
+		}
+		if result[i].File != result[j].File {
+			return result[i].File < result[j].File
+		}
+		return result[i].Line < result[j].Line
+	})
+	return result, total, nil
+}
+
+// sampleIndex returns the index of the sample type, which defaults to
+// alloc_space as escapes cost allocations whether or not the memory is
+// retained.
+func sampleIndex(p *pb.Profile, sampleType string) (int, error) {
+	names := []string{sampleType}
+	if sampleType == "" {
+		names = []string{"alloc_space", pb.TypeSampleType(p, pb.TypeHeap)}
+	}
+	for _, name := range names {
+		for i, st := range p.SampleType {
+			if name != "" && st.Type < int64(len(p.StringTable)) && p.StringTable[st.Type] == name {
+				return i, nil
+			}
+		}
+	}
+	if sampleType == "" {
+		return -1, fmt.Errorf("no heap samples found in profile")
+	}
+	return -1, fmt.Errorf("no %s samples found in profile", sampleType)
+}
+
+// Correlate returns the sites with heap escapes on their line, in the order
+// of the sites, with the share of total they allocate.
+func Correlate(sites []Site, total int64, diagnostics []Diagnostic) []Fix {
+	type key struct {
+		file string
+		line int64
+	}
+	byLine := make(map[key][]Diagnostic)
+	for _, d := range diagnostics {
+		k := key{d.File, d.Line}
+		byLine[k] = append(byLine[k], d)
+	}
+
+	var fixes []Fix
+	for _, site := range sites {
+		diagnostics := byLine[key{site.File, site.Line}]
+		if len(diagnostics) == 0 {
+			continue
+		}
+		sort.Slice(diagnostics, func(i, j int) bool { return diagnostics[i].Column < diagnostics[j].Column })
+		fix := Fix{Site: site, Diagnostics: diagnostics}
+		if total > 0 {
+			fix.Percent = float64(site.Value) / float64(total) * 100
+		}
+		fixes = append(fixes, fix)
+	}
+	return fixes
+}
+
+// Analyze builds the packages of the hot allocation sites of the profile in
+// the source directory with escape analysis diagnostics and returns the sites
+// with heap escapes, the hottest first. Only the packages of the top sites
+// are built, all of them if top is 0.
+func Analyze(ctx context.Context, p *pb.Profile, dir, sampleType string, top int) ([]Fix, error) {
+	files, err := source.Files(dir)
+	if err != nil {
+		return nil, err
+	}
+	sites, total, err := Sites(p, sampleType, files)
+	if err != nil {
+		return nil, err
+	}
+	if len(sites) == 0 {
+		return nil, fmt.Errorf("no allocations of the profile are in the go files of %s", dir)
+	}
+	if top > 0 && len(sites) > top {
+		sites = sites[:top]
+	}
+
+	var packages []string
+	seen := make(map[string]bool)
+	for _, site := range sites {
+		pkg := "./" + path.Dir(site.File)
+		if !seen[pkg] {
+			seen[pkg] = true
+			packages = append(packages, pkg)
+		}
+	}
+	diagnostics, err := build(ctx, dir, packages)
+	if err != nil {
+		return nil, err
+	}
+	return Correlate(sites, total, diagnostics), nil
+}
+
+// build compiles the packages of the directory with escape analysis
+// diagnostics, discarding the binaries, and returns their heap escapes.
+func build(ctx context.Context, dir string, packages []string) ([]Diagnostic, error) {
+	out, err := os.MkdirTemp("", "pprof-adv-escape")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(out)
+
+	args := append([]string{"build", "-gcflags=-m", "-o", out + string(filepath.Separator)}, packages...)
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("go build: %w\n%s", err, stderr.String())
+	}
+	return ParseDiagnostics(&stderr)
+}
+
+// Write prints the fixes, one per line as "allocations file:line function
+// diagnostics", diagnostics separated by "; ". Function names are formatted
+// by the style.
+func Write(w io.Writer, fixes []Fix, style term.Style) {
+	for _, fix := range fixes {
+		messages := make([]string, len(fix.Diagnostics))
+		for i, d := range fix.Diagnostics {
+			messages[i] = d.Message
+		}
+		fmt.Fprintf(w, "%s\t%s:%d\t%s\t%s\n", style.Percent(fix.Percent), fix.File, fix.Line, style.Name(fix.Function), strings.Join(messages, "; "))
+	}
+}
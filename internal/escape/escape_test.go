@@ -0,0 +1,70 @@
+package escape
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	output := `# example.com/shop/store
+./store/store.go:12:6: can inline newItem
+./store/store.go:13:9: &Item{...} escapes to heap
+./store/store.go:20:2: moved to heap: buf
+./store/store.go:21:14: leaking param: key
+./store/store.go:22:15: key does not escape
+`
+	diagnostics, err := ParseDiagnostics(strings.NewReader(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Diagnostic{
+		{File: "store/store.go", Line: 13, Column: 9, Message: "&Item{...} escapes to heap"},
+		{File: "store/store.go", Line: 20, Column: 2, Message: "moved to heap: buf"},
+	}
+	if len(diagnostics) != len(want) {
+		t.Fatalf("Expected %+v, got %+v", want, diagnostics)
+	}
+	for i := range want {
+		if diagnostics[i] != want[i] {
+			t.Errorf("Expected %+v, got %+v", want[i], diagnostics[i])
+		}
+	}
+}
+
+func TestCorrelate(t *testing.T) {
+	b := pb.NewBuilder([2]string{"alloc_objects", "count"}, [2]string{"alloc_space", "bytes"})
+	main := pb.Stack{Name: "main.main", FileName: "/src/shop/main.go", Line: 8}
+	newItem := pb.Stack{Name: "example.com/shop/store.newItem", FileName: "/src/shop/store/store.go", Line: 13}
+	get := pb.Stack{Name: "example.com/shop/store.Get", FileName: "/src/shop/store/store.go", Line: 20}
+	grow := pb.Stack{Name: "strings.(*Builder).grow", FileName: "/usr/local/go/src/strings/builder.go", Line: 68}
+	b.AddSample([]pb.Stack{newItem, main}, []int64{1, 600}, nil)
+	b.AddSample([]pb.Stack{grow, get, main}, []int64{1, 300}, nil)
+	b.AddSample([]pb.Stack{main}, []int64{1, 100}, nil)
+
+	files := []string{"main.go", "store/store.go", "store/item.go"}
+	sites, total, err := Sites(b.Profile(), "", files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1000 || len(sites) != 3 {
+		t.Fatalf("Expected 3 sites of 1000 bytes, got %+v of %d", sites, total)
+	}
+
+	diagnostics := []Diagnostic{
+		{File: "store/store.go", Line: 20, Column: 2, Message: "moved to heap: buf"},
+		{File: "store/store.go", Line: 13, Column: 9, Message: "&Item{...} escapes to heap"},
+		{File: "store/store.go", Line: 13, Column: 20, Message: "name escapes to heap"},
+		{File: "store/item.go", Line: 13, Column: 9, Message: "... argument escapes to heap"},
+	}
+	var buf bytes.Buffer
+	Write(&buf, Correlate(sites, total, diagnostics), term.Style{})
+	want := "60.00\tstore/store.go:13\texample.com/shop/store.newItem\t&Item{...} escapes to heap; name escapes to heap\n" +
+		"30.00\tstore/store.go:20\texample.com/shop/store.Get\tmoved to heap: buf\n"
+	if buf.String() != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, buf.String())
+	}
+}
@@ -0,0 +1,194 @@
+// Package event summarizes an analysis as a Datadog event, e.g. to annotate
+// dashboards during deploys, along with the regressions since the previous
+// run for the same profile source.
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/seal"
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+	"github.com/kmrgirish/pprof-adv/profiler"
+)
+
+// RegressionThreshold is the increase of a function's attributed cpu, in
+// percentage points, reported as a regression.
+const RegressionThreshold = 2.0
+
+// keptFunctions is the number of functions kept for comparing to the next
+// run, more than are shown so that functions entering the top are compared.
+const keptFunctions = 100
+
+// Run is the summary of an analysis.
+type Run struct {
+	Source    string             `json:"source"` // e.g. "service:api env:prod" or the profile's path
+	Time      time.Time          `json:"time"`
+	Functions map[string]float64 `json:"functions"` // attributed cpu % of the hottest functions
+}
+
+// Regression is a function whose attributed cpu grew since the previous run.
+type Regression struct {
+	Name     string
+	Previous float64
+	Current  float64
+}
+
+// Summarize returns the summary of the analyzed nodes of a source.
+func Summarize(source string, nodes map[string]*pb.FunctionNode, now time.Time) *Run {
+	run := &Run{Source: source, Time: now, Functions: make(map[string]float64)}
+	for _, node := range byAttrCPU(nodes) {
+		if len(run.Functions) == keptFunctions || node.SelfAttrCPU == 0 {
+			break
+		}
+		run.Functions[node.Name] = node.SelfAttrCPU
+	}
+	return run
+}
+
+// Regressions returns the functions whose attributed cpu grew by at least
+// RegressionThreshold since the previous run, by descending growth.
+func (r *Run) Regressions(prev *Run) []Regression {
+	if prev == nil {
+		return nil
+	}
+	var regressions []Regression
+	for name, cpu := range r.Functions {
+		if cpu-prev.Functions[name] >= RegressionThreshold {
+			regressions = append(regressions, Regression{Name: name, Previous: prev.Functions[name], Current: cpu})
+		}
+	}
+	sort.Slice(regressions, func(i, j int) bool {
+		di := regressions[i].Current - regressions[i].Previous
+		dj := regressions[j].Current - regressions[j].Previous
+		if di != dj {
+			return di > dj
+		}
+		return regressions[i].Name < regressions[j].Name
+	})
+	return regressions
+}
+
+// Event returns the Datadog event of the run, listing its top functions and
+// the regressions since the previous run, which may be nil.
+func (r *Run) Event(prev *Run, top int, tags []string) *profiler.Event {
+	names := make([]string, 0, len(r.Functions))
+	for name := range r.Functions {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if r.Functions[names[i]] != r.Functions[names[j]] {
+			return r.Functions[names[i]] > r.Functions[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > top {
+		names = names[:top]
+	}
+
+	var text strings.Builder
+	text.WriteString("%%% \n")
+	fmt.Fprintf(&text, "**Top %d functions by attributed cpu**\n\n", len(names))
+	for _, name := range names {
+		fmt.Fprintf(&text, "- %.2f%% `%s`\n", r.Functions[name], term.ShortName(name))
+	}
+
+	regressions := r.Regressions(prev)
+	if prev != nil {
+		fmt.Fprintf(&text, "\n**Regressions since %s**\n\n", prev.Time.UTC().Format(time.RFC3339))
+		if len(regressions) == 0 {
+			text.WriteString("none\n")
+		}
+		for _, reg := range regressions {
+			fmt.Fprintf(&text, "- `%s` %.2f%% -> %.2f%%\n", term.ShortName(reg.Name), reg.Previous, reg.Current)
+		}
+	}
+	text.WriteString("\n %%%")
+
+	event := &profiler.Event{
+		Title:          "pprof-adv analysis of " + r.Source,
+		Text:           text.String(),
+		Tags:           append([]string{"source:pprof-adv"}, tags...),
+		AlertType:      "info",
+		SourceTypeName: "pprof-adv",
+	}
+	if len(names) > 0 {
+		event.Title += fmt.Sprintf(": %s %.2f%%", term.ShortName(names[0]), r.Functions[names[0]])
+	}
+	if len(regressions) > 0 {
+		event.AlertType = "warning"
+		event.Title += fmt.Sprintf(", %d regressions", len(regressions))
+	}
+	return event
+}
+
+// Load returns the last run of the source saved in dir, decrypted with the
+// cipher, or nil if there is none.
+func Load(dir, source string, c *seal.Cipher) (*Run, error) {
+	file := path(dir, source)
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if data, err = c.Open(filepath.Base(file), data); err != nil {
+		return nil, err
+	}
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// Save saves the run as the last run of its source in dir, encrypted with the
+// cipher unless it is nil.
+func (r *Run) Save(dir string, c *seal.Cipher) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	file := path(dir, r.Source)
+	if data, err = c.Seal(filepath.Base(file), data); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0o644)
+}
+
+// path returns the file the last run of source is saved to.
+func path(dir, source string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, source)
+	return filepath.Join(dir, name+".json")
+}
+
+// byAttrCPU returns the nodes by descending attributed cpu, ties broken by
+// name.
+func byAttrCPU(nodes map[string]*pb.FunctionNode) []*pb.FunctionNode {
+	sorted := make([]*pb.FunctionNode, 0, len(nodes))
+	for _, node := range nodes {
+		sorted = append(sorted, node)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].SelfAttrCPU != sorted[j].SelfAttrCPU {
+			return sorted[i].SelfAttrCPU > sorted[j].SelfAttrCPU
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
@@ -0,0 +1,56 @@
+package event
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func nodes(cpu map[string]float64) map[string]*pb.FunctionNode {
+	nodes := make(map[string]*pb.FunctionNode)
+	for name, v := range cpu {
+		nodes[name] = &pb.FunctionNode{Name: name, SelfAttrCPU: v}
+	}
+	return nodes
+}
+
+func TestEvent(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	prev, err := Load(dir, "service:api env:prod", nil)
+	if err != nil || prev != nil {
+		t.Fatalf("Expected no previous run, got %v, %v", prev, err)
+	}
+	first := Summarize("service:api env:prod", nodes(map[string]float64{"main.parse": 40, "main.render": 10}), start)
+	if event := first.Event(prev, 10, nil); event.AlertType != "info" || strings.Contains(event.Text, "Regressions") {
+		t.Errorf("Expected info event without regressions, got %+v", event)
+	}
+	if err := first.Save(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	prev, err = Load(dir, "service:api env:prod", nil)
+	if err != nil || prev == nil || prev.Functions["main.parse"] != 40 {
+		t.Fatalf("Expected the first run, got %+v, %v", prev, err)
+	}
+	second := Summarize("service:api env:prod", nodes(map[string]float64{"main.parse": 30, "main.render": 15, "main.log": 1}), start.Add(time.Hour))
+
+	regressions := second.Regressions(prev)
+	if len(regressions) != 1 || regressions[0].Name != "main.render" {
+		t.Errorf("Expected main.render to regress, got %+v", regressions)
+	}
+
+	event := second.Event(prev, 2, []string{"service:api"})
+	if event.AlertType != "warning" || event.Title != "pprof-adv analysis of service:api env:prod: main.parse 30.00%, 1 regressions" {
+		t.Errorf("Expected warning titled with the top function, got %+v", event)
+	}
+	if !strings.Contains(event.Text, "`main.render` 10.00% -> 15.00%") || strings.Contains(event.Text, "main.log") {
+		t.Errorf("Expected top 2 functions and the regression of main.render, got:\n%s", event.Text)
+	}
+	if len(event.Tags) != 2 || event.Tags[1] != "service:api" {
+		t.Errorf("Expected tags source:pprof-adv and service:api, got %v", event.Tags)
+	}
+}
@@ -0,0 +1,158 @@
+// Package exe reads the metadata of executables that profiles are matched
+// against.
+package exe
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/gosym"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// File is an executable.
+type File struct {
+	Path string
+	// BuildID is the hex encoded GNU build id of an ELF file or the LC_UUID
+	// of a Mach-O file, as recorded in the mappings of profiles. It is empty
+	// if the executable has none.
+	BuildID string
+	// Symbols holds the names of the functions of the executable, read from
+	// the go pclntab when present so that stripped go binaries work too.
+	Symbols map[string]bool
+	// Sizes holds the size in bytes of the machine code of the functions, for
+	// the functions of the pclntab or ELF symbol table.
+	Sizes map[string]int
+}
+
+// Open reads an ELF, Mach-O or PE executable.
+func Open(path string) (*File, error) {
+	f := &File{Path: path, Symbols: make(map[string]bool), Sizes: make(map[string]int)}
+
+	if ef, err := elf.Open(path); err == nil {
+		defer ef.Close()
+		return f, f.readELF(ef)
+	}
+	if mf, err := macho.Open(path); err == nil {
+		defer mf.Close()
+		return f, f.readMachO(mf)
+	}
+	if pf, err := pe.Open(path); err == nil {
+		defer pf.Close()
+		return f, f.readPE(pf)
+	}
+	return nil, fmt.Errorf("%s: not an ELF, Mach-O or PE executable", path)
+}
+
+func (f *File) readELF(ef *elf.File) error {
+	for _, sec := range ef.Sections {
+		if sec.Type != elf.SHT_NOTE {
+			continue
+		}
+		data, err := sec.Data()
+		if err != nil {
+			return err
+		}
+		if id := gnuBuildID(data, ef.ByteOrder); id != "" {
+			f.BuildID = id
+		}
+	}
+
+	if pcln, text := ef.Section(".gopclntab"), ef.Section(".text"); pcln != nil && text != nil {
+		data, err := pcln.Data()
+		if err != nil {
+			return err
+		}
+		return f.readPclntab(data, text.Addr)
+	}
+
+	syms, err := ef.Symbols()
+	if err != nil && !errors.Is(err, elf.ErrNoSymbols) {
+		return err
+	}
+	for _, sym := range syms {
+		if elf.ST_TYPE(sym.Info) == elf.STT_FUNC {
+			f.Symbols[sym.Name] = true
+			f.Sizes[sym.Name] = int(sym.Size)
+		}
+	}
+	return nil
+}
+
+func (f *File) readMachO(mf *macho.File) error {
+	const lcUUID = 0x1b
+	for _, load := range mf.Loads {
+		raw := load.Raw()
+		if len(raw) >= 24 && mf.ByteOrder.Uint32(raw) == lcUUID {
+			f.BuildID = hex.EncodeToString(raw[8:24])
+		}
+	}
+
+	if pcln, text := mf.Section("__gopclntab"), mf.Section("__text"); pcln != nil && text != nil {
+		data, err := pcln.Data()
+		if err != nil {
+			return err
+		}
+		return f.readPclntab(data, text.Addr)
+	}
+
+	if mf.Symtab != nil {
+		for _, sym := range mf.Symtab.Syms {
+			f.Symbols[sym.Name] = true
+		}
+	}
+	return nil
+}
+
+func (f *File) readPE(pf *pe.File) error {
+	for _, sym := range pf.Symbols {
+		f.Symbols[sym.Name] = true
+	}
+	return nil
+}
+
+// gnuBuildID returns the hex encoded NT_GNU_BUILD_ID note of an ELF note
+// section, or "" if there is none.
+func gnuBuildID(data []byte, order binary.ByteOrder) string {
+	const ntGNUBuildID = 3
+	for len(data) >= 12 {
+		nameSize := int(order.Uint32(data[0:4]))
+		descSize := int(order.Uint32(data[4:8]))
+		noteType := order.Uint32(data[8:12])
+		data = data[12:]
+
+		nameEnd := align4(nameSize)
+		descEnd := nameEnd + align4(descSize)
+		if nameEnd > len(data) || descEnd > len(data) {
+			return ""
+		}
+		name := bytes.TrimRight(data[:nameSize], "\x00")
+		if noteType == ntGNUBuildID && string(name) == "GNU" {
+			return hex.EncodeToString(data[nameEnd : nameEnd+descSize])
+		}
+		data = data[descEnd:]
+	}
+	return ""
+}
+
+func align4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// readPclntab adds the functions listed in a go pclntab along with their
+// sizes.
+func (f *File) readPclntab(data []byte, textAddr uint64) error {
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(data, textAddr))
+	if err != nil {
+		return err
+	}
+	for _, fn := range table.Funcs {
+		f.Symbols[fn.Name] = true
+		f.Sizes[fn.Name] = int(fn.End - fn.Entry)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package exe
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestGNUBuildID(t *testing.T) {
+	note := func(name string, noteType uint32, desc []byte) []byte {
+		var data []byte
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(name)+1))
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(desc)))
+		data = binary.LittleEndian.AppendUint32(data, noteType)
+		data = append(data, name...)
+		data = append(data, make([]byte, align4(len(name)+1)-len(name))...)
+		data = append(data, desc...)
+		return append(data, make([]byte, align4(len(desc))-len(desc))...)
+	}
+
+	data := append(note("Go", 4, []byte("abc/def")), note("GNU", 3, []byte{0xde, 0xad, 0xbe, 0xef, 0x01})...)
+	if id := gnuBuildID(data, binary.LittleEndian); id != "deadbeef01" {
+		t.Errorf("Expected build id deadbeef01, got %q", id)
+	}
+	if id := gnuBuildID(data[:20], binary.LittleEndian); id != "" {
+		t.Errorf("Expected no build id in truncated notes, got %q", id)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	path, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	f, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if !f.Symbols["github.com/kmrgirish/pprof-adv/internal/exe.TestMatch"] {
+		t.Fatalf("Expected the test binary to have the TestMatch symbol")
+	}
+
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "github.com/kmrgirish/pprof-adv/internal/exe.TestMatch"}}, []int64{1}, nil)
+	p := b.Profile()
+	p.Mapping = []*pb.Mapping{{Id: 1, Filename: b.String("/bin/app"), BuildId: b.String(f.BuildID)}}
+
+	if err := f.Match(p); err != nil {
+		t.Errorf("Expected profile to match, got %v", err)
+	}
+
+	if f.BuildID != "" {
+		p.Mapping[0].BuildId = b.String("0123")
+		if err := f.Match(p); err == nil {
+			t.Error("Expected build id mismatch, got nil")
+		}
+	}
+
+	p.Mapping = nil
+	b.AddSample([]pb.Stack{{Name: "main.notInTheBinary"}}, []int64{1}, nil)
+	b.AddSample([]pb.Stack{{Name: "main.norThis"}}, []int64{1}, nil)
+	if err := f.Match(p); err == nil {
+		t.Error("Expected symbol mismatch, got nil")
+	}
+}
@@ -0,0 +1,68 @@
+package exe
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// minSymbolMatch is the share of the functions of a profile without build ids
+// that must be symbols of the executable for it to be considered a match.
+const minSymbolMatch = 0.5
+
+// Match checks that the profile was recorded from the executable. It compares
+// the build id of the executable's mapping in the profile when both have one,
+// and otherwise falls back to checking that the functions of the profile are
+// symbols of the executable. It returns an error describing a mismatch.
+func (f *File) Match(p *pb.Profile) error {
+	if err := pb.Validate(p); err != nil {
+		return err
+	}
+
+	if mapping := mainMapping(p, f.Path); mapping != nil {
+		id := p.StringTable[mapping.BuildId]
+		if id != "" && f.BuildID != "" {
+			if id != f.BuildID {
+				return fmt.Errorf("build id of %s is %s but the profile was recorded from %s with build id %s",
+					f.Path, f.BuildID, p.StringTable[mapping.Filename], id)
+			}
+			return nil
+		}
+	}
+
+	if len(f.Symbols) == 0 {
+		return fmt.Errorf("%s has no build id nor symbols to match the profile against", f.Path)
+	}
+	var total, found int
+	for _, fn := range p.Function {
+		name := p.StringTable[fn.Name]
+		if name == "" {
+			continue
+		}
+		total++
+		if f.Symbols[name] {
+			found++
+		}
+	}
+	if total > 0 && float64(found)/float64(total) < minSymbolMatch {
+		return fmt.Errorf("only %d of the %d functions of the profile are symbols of %s", found, total, f.Path)
+	}
+	return nil
+}
+
+// mainMapping returns the mapping of the executable at path, preferring the
+// mapping with the same base name and falling back to the first mapping, which
+// runtime/pprof and perf use for the main executable.
+func mainMapping(p *pb.Profile, path string) *pb.Mapping {
+	base := filepath.Base(path)
+	for _, mapping := range p.Mapping {
+		if filepath.Base(p.StringTable[mapping.Filename]) == base {
+			return mapping
+		}
+	}
+	if len(p.Mapping) > 0 {
+		return p.Mapping[0]
+	}
+	return nil
+}
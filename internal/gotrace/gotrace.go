@@ -0,0 +1,335 @@
+// Package gotrace converts Go execution traces, as written by runtime/trace or
+// the /debug/pprof/trace endpoint, into cpu profiles of the time goroutines
+// spent running, so the attribution of the analyzers applies to traces when
+// sampling profiles are too coarse, e.g. for short or bursty work.
+package gotrace
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"golang.org/x/exp/trace"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// GroupLabel is the label holding the goroutine group of the samples, e.g. for
+// --pivot.
+const GroupLabel = "goroutine group"
+
+// unknownGroup is the group of the goroutines whose start function the trace
+// does not tell, e.g. ones that never ran or blocked while it was recorded.
+const unknownGroup = "[unknown]"
+
+// Group is the goroutines of a trace started by the same function.
+type Group struct {
+	Name       string        // Start function of the goroutines
+	Goroutines int           // Number of goroutines that ran
+	Running    time.Duration // Time the goroutines spent running
+}
+
+// Trace is the on-cpu time of an execution trace.
+type Trace struct {
+	// Profile has one sample per distinct stack and group, valued in samples
+	// and nanoseconds of running time, with the GroupLabel label.
+	Profile *pb.Profile
+	// Groups are the goroutine groups that ran, by descending running time.
+	Groups []Group
+}
+
+// goroutine is the state of a goroutine while reading a trace.
+type goroutine struct {
+	group   string
+	running bool
+	since   trace.Time
+	samples []trace.Stack // cpu samples taken since the goroutine started running
+}
+
+// key identifies the running time of a goroutine in a stack, which is
+// trace.NoStack for the time only known to be spent in the goroutine.
+type key struct {
+	stack trace.Stack
+	id    trace.GoID
+}
+
+// value is the running time of a key.
+type value struct {
+	samples int64
+	nanos   int64
+}
+
+// Parse converts a Go execution trace into a cpu profile of the time its
+// goroutines spent running, see Read.
+func Parse(r io.Reader) (*pb.Profile, error) {
+	t, err := Read(r)
+	if err != nil {
+		return nil, err
+	}
+	return t.Profile, nil
+}
+
+// Read reads a Go execution trace of Go 1.11 or later, up to the format of Go
+// 1.25, and breaks the time its goroutines spent running down by goroutine
+// group and by stack. The group of a goroutine is its start function.
+//
+// Running time is exact, its stacks are not: a running interval is split
+// evenly over the cpu samples taken during it when cpu profiling was on while
+// tracing, and charged to the stack the goroutine stopped running at
+// otherwise, or only to its group when it exited or was still running at the
+// end of the trace.
+func Read(r io.Reader) (*Trace, error) {
+	tr, err := trace.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	goroutines := make(map[trace.GoID]*goroutine)
+	values := make(map[key]*value)
+	add := func(k key, nanos int64) {
+		if values[k] == nil {
+			values[k] = &value{}
+		}
+		values[k].samples++
+		values[k].nanos += nanos
+	}
+	// spend charges the running interval of the goroutine ending at end.
+	spend := func(id trace.GoID, g *goroutine, end trace.Time, stop trace.Stack) {
+		g.running = false
+		nanos := int64(end.Sub(g.since))
+		if nanos <= 0 {
+			return
+		}
+		if len(g.samples) == 0 {
+			add(key{stack: stop, id: id}, nanos)
+			return
+		}
+		share := nanos / int64(len(g.samples))
+		for i, stack := range g.samples {
+			if i == 0 {
+				add(key{stack: stack, id: id}, nanos-share*int64(len(g.samples)-1))
+			} else {
+				add(key{stack: stack, id: id}, share)
+			}
+		}
+	}
+
+	var start, end trace.Time
+	for first := true; ; first = false {
+		ev, err := tr.ReadEvent()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			start = ev.Time()
+		}
+		end = ev.Time()
+
+		switch ev.Kind() {
+		case trace.EventStackSample:
+			if g, exists := goroutines[ev.Goroutine()]; exists && g.running {
+				g.samples = append(g.samples, ev.Stack())
+			}
+		case trace.EventStateTransition:
+			st := ev.StateTransition()
+			if st.Resource.Kind != trace.ResourceGoroutine {
+				continue
+			}
+			id := st.Resource.Goroutine()
+			g, exists := goroutines[id]
+			if !exists {
+				g = &goroutine{}
+				goroutines[id] = g
+			}
+			if g.group == "" {
+				g.group = startFunction(st.Stack)
+			}
+
+			from, to := st.Goroutine()
+			if from == trace.GoRunning && g.running {
+				spend(id, g, ev.Time(), st.Stack)
+			}
+			if to == trace.GoRunning {
+				g.running, g.since, g.samples = true, ev.Time(), nil
+			}
+		}
+	}
+	for id, g := range goroutines {
+		if g.running {
+			spend(id, g, end, trace.NoStack)
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, errors.New("no goroutine ran while the trace was recorded")
+	}
+
+	// Goroutine ids may be reused once they exit, which at worst merges the
+	// groups of both.
+	groupOf := func(id trace.GoID) string {
+		if g := goroutines[id]; g != nil && g.group != "" {
+			return g.group
+		}
+		return unknownGroup
+	}
+	return &Trace{
+		Profile: buildProfile(values, groupOf, int64(end.Sub(start))),
+		Groups:  groups(values, groupOf),
+	}, nil
+}
+
+// startFunction returns the outermost function of the stack, which is the
+// start function of the goroutine for the stacks of its transitions, or "" if
+// the stack is empty.
+func startFunction(stack trace.Stack) string {
+	var name string
+	for frame := range stack.Frames() {
+		if frame.Func != "runtime.goexit" {
+			name = frame.Func
+		}
+	}
+	return name
+}
+
+// sample is a sample of the profile: the running time of a group in a stack.
+type sample struct {
+	stack trace.Stack
+	group string
+}
+
+// buildProfile returns the profile of the running time of the keys, with one
+// sample per stack and group.
+func buildProfile(values map[key]*value, groupOf func(trace.GoID) string, durationNanos int64) *pb.Profile {
+	merged := make(map[sample]*value)
+	for k, v := range values {
+		s := sample{stack: k.stack, group: groupOf(k.id)}
+		if merged[s] == nil {
+			merged[s] = &value{}
+		}
+		merged[s].samples += v.samples
+		merged[s].nanos += v.nanos
+	}
+
+	type entry struct {
+		stack []pb.Stack
+		group string
+		value *value
+	}
+	entries := make([]entry, 0, len(merged))
+	for s, v := range merged {
+		var stack []pb.Stack
+		for frame := range s.stack.Frames() {
+			stack = append(stack, pb.Stack{Name: frame.Func, FileName: frame.File, Line: int64(frame.Line)})
+		}
+		if len(stack) == 0 {
+			stack = []pb.Stack{{Name: s.group}}
+		}
+		entries = append(entries, entry{stack: stack, group: s.group, value: v})
+	}
+	// Order the samples so that the profiles of a trace are the same
+	sort.Slice(entries, func(i, j int) bool {
+		if vi, vj := entries[i].value.nanos, entries[j].value.nanos; vi != vj {
+			return vi > vj
+		}
+		return fmt.Sprint(entries[i].group, entries[i].stack) < fmt.Sprint(entries[j].group, entries[j].stack)
+	})
+
+	b := pb.NewBuilder([2]string{"samples", "count"}, [2]string{"cpu", "nanoseconds"})
+	for _, e := range entries {
+		b.AddSample(e.stack, []int64{e.value.samples, e.value.nanos}, map[string]string{GroupLabel: e.group})
+	}
+	p := b.Profile()
+	p.DurationNanos = durationNanos
+	return p
+}
+
+// groups returns the goroutine groups of the keys, by descending running time
+// and then by name.
+func groups(values map[key]*value, groupOf func(trace.GoID) string) []Group {
+	byName := make(map[string]*Group)
+	counted := make(map[trace.GoID]bool)
+	for k, v := range values {
+		name := groupOf(k.id)
+		g := byName[name]
+		if g == nil {
+			g = &Group{Name: name}
+			byName[name] = g
+		}
+		g.Running += time.Duration(v.nanos)
+		if !counted[k.id] {
+			counted[k.id] = true
+			g.Goroutines++
+		}
+	}
+
+	out := make([]Group, 0, len(byName))
+	for _, g := range byName {
+		out = append(out, *g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Running != out[j].Running {
+			return out[i].Running > out[j].Running
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// Write writes the running time of every goroutine group of the trace, then
+// the top functions of each group by the cpu attributed to them with opts, as
+// percentages of the running time of the whole trace.
+func Write(w io.Writer, t *Trace, opts pb.AnalyzeOptions, top int, style term.Style) error {
+	pivot, err := pb.AnalyzeCPUByLabel(t.Profile, opts, GroupLabel)
+	if err != nil {
+		return err
+	}
+
+	var total time.Duration
+	goroutines := 0
+	for _, g := range t.Groups {
+		total += g.Running
+		goroutines += g.Goroutines
+	}
+	for _, g := range t.Groups {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", g.Running.Round(time.Microsecond), style.Percent(pivot.ValueCPU[g.Name]), plural(g.Goroutines, "goroutine"), style.Name(g.Name))
+	}
+	fmt.Fprintf(w, "%s\t\t%s\ttotal running\n", total.Round(time.Microsecond), plural(goroutines, "goroutine"))
+
+	style = style.After(2) // running and share
+	for _, g := range t.Groups {
+		functions := make([]string, 0, len(pivot.Functions))
+		for _, name := range pivot.Functions {
+			if pivot.CPU[name][g.Name] > 0 {
+				functions = append(functions, name)
+			}
+		}
+		sort.SliceStable(functions, func(i, j int) bool {
+			return pivot.CPU[functions[i]][g.Name] > pivot.CPU[functions[j]][g.Name]
+		})
+
+		fmt.Fprintf(w, "\n== %s (%s)\n", style.Name(g.Name), g.Running.Round(time.Microsecond))
+		for i, name := range functions {
+			if i == top {
+				break
+			}
+			share := pivot.CPU[name][g.Name]
+			running := time.Duration(share / 100 * float64(total))
+			fmt.Fprintf(w, "%s\t%s\t%s\n", running.Round(time.Microsecond), style.Percent(share), style.Function(name, pivot.FileNames[name]))
+		}
+	}
+	return nil
+}
+
+// plural returns n followed by the noun, pluralized unless n is 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
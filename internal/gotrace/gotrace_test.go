@@ -0,0 +1,122 @@
+package gotrace
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// workers.trace is a Go 1.23 trace of main.main (goroutine 1) running 1ms
+// before blocking, while two main.worker goroutines run: goroutine 2 for 3ms
+// until preempted in main.hash, then for 4ms with cpu samples in main.hash and
+// main.parse until it exits, and goroutine 3 for 2ms until it blocks in
+// main.compress.
+func readWorkers(t *testing.T) *Trace {
+	t.Helper()
+	data, err := os.ReadFile("testdata/workers.trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	return tr
+}
+
+func TestReadGroups(t *testing.T) {
+	tr := readWorkers(t)
+
+	want := []Group{
+		{Name: "main.worker", Goroutines: 2, Running: 9 * time.Millisecond},
+		{Name: "main.main", Goroutines: 1, Running: time.Millisecond - time.Nanosecond},
+	}
+	if len(tr.Groups) != len(want) {
+		t.Fatalf("Expected groups %+v, got %+v", want, tr.Groups)
+	}
+	for i := range want {
+		if tr.Groups[i] != want[i] {
+			t.Errorf("Expected group %+v, got %+v", want[i], tr.Groups[i])
+		}
+	}
+}
+
+func TestReadProfile(t *testing.T) {
+	tr := readWorkers(t)
+	if err := pb.Validate(tr.Profile); err != nil {
+		t.Fatalf("Invalid profile: %v", err)
+	}
+
+	nodes, err := pb.AnalyzeCPUProfile(tr.Profile, pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+	total := float64(10*time.Millisecond - time.Nanosecond)
+	tests := map[string]time.Duration{
+		// 3ms stopped in main.hash, and half of the 4ms with cpu samples
+		"main.hash":     5 * time.Millisecond,
+		"main.parse":    2 * time.Millisecond,
+		"main.compress": 2 * time.Millisecond,
+		"main.main":     time.Millisecond - time.Nanosecond,
+	}
+	for name, running := range tests {
+		node := nodes[name]
+		if node == nil {
+			t.Errorf("%s not found", name)
+			continue
+		}
+		if want := float64(running) / total * 100; !almostEqual(node.SelfCPU, want) {
+			t.Errorf("Expected %s self cpu %.2f%%, got %.2f%%", name, want, node.SelfCPU)
+		}
+	}
+	if worker := nodes["main.worker"]; worker == nil || !almostEqual(worker.TotalCPU, 9e6/total*100) {
+		t.Errorf("Expected main.worker total cpu %.2f%%, got %+v", 9e6/total*100, worker)
+	}
+
+	pivot, err := pb.AnalyzeCPUByLabel(tr.Profile, pb.AnalyzeOptions{}, GroupLabel)
+	if err != nil {
+		t.Fatalf("AnalyzeCPUByLabel failed: %v", err)
+	}
+	if got := pivot.ValueCPU["main.worker"]; !almostEqual(got, 9e6/total*100) {
+		t.Errorf("Expected main.worker group cpu %.2f%%, got %.2f%%", 9e6/total*100, got)
+	}
+}
+
+func TestReadNotATrace(t *testing.T) {
+	if _, err := Read(bytes.NewReader([]byte("not a trace"))); err == nil {
+		t.Error("Expected error for input that is not a trace, got nil")
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	d := a - b
+	return d < 0.01 && d > -0.01
+}
+
+func TestWrite(t *testing.T) {
+	tr := readWorkers(t)
+
+	var buf bytes.Buffer
+	if err := Write(&buf, tr, pb.AnalyzeOptions{}, 10, term.Style{}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	want := `9ms	90.00	2 goroutines	main.worker
+1ms	10.00	1 goroutine	main.main
+10ms		3 goroutines	total running
+
+== main.worker (9ms)
+5ms	50.00	main.hash in hash.go
+2ms	20.00	main.compress in compress.go
+2ms	20.00	main.parse in parse.go
+
+== main.main (1ms)
+1ms	10.00	main.main in main.go
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, got)
+	}
+}
@@ -0,0 +1,163 @@
+package input
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/kmrgirish/pprof-adv/internal/gotrace"
+	"github.com/kmrgirish/pprof-adv/internal/jfr"
+	"github.com/kmrgirish/pprof-adv/internal/perf"
+	"github.com/kmrgirish/pprof-adv/internal/v8"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Formats are the supported input formats.
+var Formats = []string{"pprof", "perf", "jfr", "cpuprofile", "gotrace"}
+
+// Parse decodes a profile in the given input format and normalizes it for the
+// analyzers.
+func Parse(r io.Reader, format string) (*pb.Profile, error) {
+	r, err := Decompress(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile *pb.Profile
+	switch format {
+	case "pprof":
+		profile, err = pb.Parse(r)
+	case "perf":
+		profile, err = perf.Parse(r)
+	case "jfr":
+		profile, err = jfr.Parse(r)
+	case "cpuprofile":
+		profile, err = v8.Parse(r)
+	case "gotrace":
+		profile, err = gotrace.Parse(r)
+	default:
+		return nil, fmt.Errorf("unsupported input format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := pb.Validate(profile); err != nil {
+		return nil, err
+	}
+
+	pb.Normalize(profile)
+	return profile, nil
+}
+
+// Decompress returns a reader for the uncompressed contents of r, which may be
+// a gzip stream or a zip archive holding a single profile. Since r may be a
+// pipe the format is detected by peeking at the first bytes, only zip archives
+// are buffered in memory as they need random access.
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		var files []*zip.File
+		for _, file := range zr.File {
+			if !file.FileInfo().IsDir() {
+				files = append(files, file)
+			}
+		}
+		if len(files) != 1 {
+			return nil, fmt.Errorf("zip archive must contain exactly one profile, found %d files", len(files))
+		}
+		rc, err := files[0].Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		data, err = io.ReadAll(rc)
+		if err != nil {
+			return nil, err
+		}
+		// The archived file may itself be gzip compressed.
+		return Decompress(bytes.NewReader(data))
+	}
+	return br, nil
+}
+
+// Profiles returns the pprof files of a zip archive, such as a Datadog
+// download, by base name, or the contents of r as a single file named
+// "profile" if it is not a zip archive.
+func Profiles(r io.Reader) (map[string][]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return map[string][]byte{"profile": data}, nil
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	for _, file := range zr.File {
+		if file.FileInfo().IsDir() || path.Ext(file.Name) != ".pprof" {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[path.Base(file.Name)] = data
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .pprof files in zip archive")
+	}
+	return files, nil
+}
+
+// ArchiveFile returns the file of a zip archive, such as a Datadog download,
+// with the base name, or nil if data is not a zip archive or has no such file.
+func ArchiveFile(data []byte, name string) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return nil, nil
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range zr.File {
+		if file.FileInfo().IsDir() || path.Base(file.Name) != name {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return nil, nil
+}
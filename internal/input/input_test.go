@@ -0,0 +1,87 @@
+package input
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+func TestDecompress(t *testing.T) {
+	const content = "profile data"
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(content))
+	gw.Close()
+
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	zw.Create("profiles/")
+	fw, _ := zw.Create("profiles/cpu.pprof")
+	fw.Write(gz.Bytes())
+	zw.Close()
+
+	tests := map[string][]byte{
+		"plain": []byte(content),
+		"gzip":  gz.Bytes(),
+		"zip":   zipped.Bytes(),
+	}
+	for name, data := range tests {
+		r, err := Decompress(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: Decompress failed: %v", name, err)
+			continue
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Errorf("%s: read failed: %v", name, err)
+			continue
+		}
+		if string(got) != content {
+			t.Errorf("%s: Expected %q, got %q", name, content, string(got))
+		}
+	}
+
+	if r, err := Decompress(bytes.NewReader(nil)); err != nil {
+		t.Errorf("Expected empty input to pass through, got %v", err)
+	} else if data, _ := io.ReadAll(r); len(data) != 0 {
+		t.Errorf("Expected no data, got %q", data)
+	}
+}
+
+func TestDecompressZipWithSeveralFiles(t *testing.T) {
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	zw.Create("a.pprof")
+	zw.Create("b.pprof")
+	zw.Close()
+
+	if _, err := Decompress(&zipped); err == nil {
+		t.Error("Expected error for zip with several files, got nil")
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	for name, content := range map[string]string{"cpu.pprof": "cpu", "delta-heap.pprof": "heap", "metrics.json": "{}"} {
+		f, _ := zw.Create("profiles/" + name)
+		f.Write([]byte(content))
+	}
+	zw.Close()
+
+	files, err := Profiles(&zipped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || string(files["cpu.pprof"]) != "cpu" || string(files["delta-heap.pprof"]) != "heap" {
+		t.Errorf("Expected cpu.pprof and delta-heap.pprof, got %v", files)
+	}
+
+	files, err = Profiles(bytes.NewReader([]byte("profile data")))
+	if err != nil || string(files["profile"]) != "profile data" {
+		t.Errorf("Expected a single profile, got %v, %v", files, err)
+	}
+}
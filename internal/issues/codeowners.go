@@ -0,0 +1,82 @@
+package issues
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// CodeOwners maps files to their owners, see
+// https://docs.github.com/en/repositories/managing-your-repositorys-settings-and-features/customizing-your-repository/about-code-owners.
+type CodeOwners struct {
+	rules []ownerRule
+}
+
+type ownerRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// ParseCodeOwners reads a CODEOWNERS file.
+func ParseCodeOwners(r io.Reader) (*CodeOwners, error) {
+	c := &CodeOwners{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		c.rules = append(c.rules, ownerRule{pattern: ownerPattern(fields[0]), owners: fields[1:]})
+	}
+	return c, scanner.Err()
+}
+
+// Owners returns the owners of a slash separated path relative to the root
+// of the repository, the ones of the last matching rule.
+func (c *CodeOwners) Owners(file string) []string {
+	for i := len(c.rules) - 1; i >= 0; i-- {
+		if c.rules[i].pattern.MatchString(file) {
+			return c.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// ownerPattern compiles a gitignore style pattern. Patterns with a slash
+// other than at their end are relative to the root, others match at any
+// depth, and patterns matching a directory match the files below it.
+func ownerPattern(pattern string) *regexp.Regexp {
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.Trim(pattern, "/")
+
+	var re strings.Builder
+	if anchored {
+		re.WriteString("^")
+	} else {
+		re.WriteString("(^|/)")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			// matches zero or more directories
+			re.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("(/|$)")
+	return regexp.MustCompile(re.String())
+}
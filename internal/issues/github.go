@@ -0,0 +1,89 @@
+package issues
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/kmrgirish/pprof-adv/internal/version"
+)
+
+// GitHub files issues in a GitHub repository.
+type GitHub struct {
+	URL   string // base url of the api, e.g. https://api.github.com
+	Repo  string // owner/name of the repository
+	Token string
+}
+
+// OpenTitles returns the titles of the open issues with the label.
+func (g *GitHub) OpenTitles(ctx context.Context, label string) (map[string]bool, error) {
+	titles := make(map[string]bool)
+	for page := 1; ; page++ {
+		var issues []struct {
+			Title string `json:"title"`
+		}
+		query := url.Values{"state": {"open"}, "labels": {label}, "per_page": {"100"}, "page": {fmt.Sprint(page)}}
+		if err := g.do(ctx, "GET", "/repos/"+g.Repo+"/issues?"+query.Encode(), nil, &issues); err != nil {
+			return nil, err
+		}
+		for _, issue := range issues {
+			titles[issue.Title] = true
+		}
+		if len(issues) < 100 {
+			return titles, nil
+		}
+	}
+}
+
+// Create files the issue and returns its url.
+func (g *GitHub) Create(ctx context.Context, issue Issue) (string, error) {
+	var created struct {
+		URL string `json:"html_url"`
+	}
+	if err := g.do(ctx, "POST", "/repos/"+g.Repo+"/issues", issue, &created); err != nil {
+		return "", err
+	}
+	return created.URL, nil
+}
+
+// do sends a request to the api and decodes its json response into result.
+func (g *GitHub) do(ctx context.Context, method, path string, payload, result any) error {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, g.URL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", version.UserAgent())
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s", method, path, res.Status)
+	}
+	return json.Unmarshal(data, result)
+}
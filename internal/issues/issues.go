@@ -0,0 +1,223 @@
+// Package issues turns the hotspots of a profile into issues of a tracker,
+// with the call path, owners and cost of every hotspot as evidence.
+package issues
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kmrgirish/pprof-adv/internal/event"
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Label is the label of the issues filed for hotspots, open issues with it
+// are not filed again.
+const Label = "pprof-adv"
+
+// hoursPerMonth is the average number of hours in a month.
+const hoursPerMonth = 730
+
+// Hotspot is a function among the top functions by attributed cpu.
+type Hotspot struct {
+	Name    string
+	File    string
+	AttrCPU float64 // attributed cpu, in percent
+
+	// Path is the call path of the samples of the function with the most
+	// cpu, from the root to the function.
+	Path []string
+	// PathCPU is the share of the function's samples on Path, in percent.
+	PathCPU float64
+
+	Owners []string
+}
+
+// Hotspots returns the top functions of the analyzed nodes of the profile by
+// attributed cpu, with their hottest call path.
+func Hotspots(p *pb.Profile, nodes map[string]*pb.FunctionNode, top int) []*Hotspot {
+	sorted := make([]*pb.FunctionNode, 0, len(nodes))
+	for _, node := range nodes {
+		if node.SelfAttrCPU > 0 {
+			sorted = append(sorted, node)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].SelfAttrCPU != sorted[j].SelfAttrCPU {
+			return sorted[i].SelfAttrCPU > sorted[j].SelfAttrCPU
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	if len(sorted) > top {
+		sorted = sorted[:top]
+	}
+
+	wanted := make(map[string]bool, len(sorted))
+	for _, node := range sorted {
+		wanted[node.Name] = true
+	}
+	paths := hottestPaths(p, wanted)
+	hotspots := make([]*Hotspot, len(sorted))
+	for i, node := range sorted {
+		hotspots[i] = &Hotspot{Name: node.Name, File: node.FileName, AttrCPU: node.SelfAttrCPU}
+		if path, exists := paths[node.Name]; exists {
+			hotspots[i].Path, hotspots[i].PathCPU = path.frames, path.share
+		}
+	}
+	return hotspots
+}
+
+// callPath is the hottest call path to a function.
+type callPath struct {
+	frames []string
+	share  float64 // share of the samples of the function on the path, in percent
+}
+
+// hottestPaths returns the call path with the most cpu of the functions, from
+// the root to their innermost call. Inlined functions are frames of their own.
+func hottestPaths(p *pb.Profile, functions map[string]bool) map[string]callPath {
+	idx := pb.CPUSampleIndex(p)
+	if idx == -1 {
+		return nil
+	}
+	names := make(map[uint64]string, len(p.Function))
+	for _, fn := range p.Function {
+		names[fn.Id] = p.StringTable[fn.Name]
+	}
+	locations := make(map[uint64]*pb.Location, len(p.Location))
+	for _, loc := range p.Location {
+		locations[loc.Id] = loc
+	}
+
+	type weighted struct {
+		frames []string
+		value  int64
+	}
+	byFunction := make(map[string]map[string]*weighted)
+	totals := make(map[string]int64)
+	for _, sample := range p.Sample {
+		value := sample.Value[idx]
+		var frames []string
+		for i := len(sample.LocationId) - 1; i >= 0; i-- {
+			loc := locations[sample.LocationId[i]]
+			if loc == nil {
+				continue
+			}
+			for j := len(loc.Line) - 1; j >= 0; j-- {
+				frames = append(frames, names[loc.Line[j].FunctionId])
+			}
+		}
+
+		// The path of every function ends at its innermost call, so that
+		// recursive functions count the sample once
+		seen := make(map[string]bool, len(frames))
+		for i := len(frames) - 1; i >= 0; i-- {
+			name := frames[i]
+			if !functions[name] || seen[name] {
+				continue
+			}
+			seen[name] = true
+			totals[name] += value
+			key := strings.Join(frames[:i+1], "\n")
+			if byFunction[name] == nil {
+				byFunction[name] = make(map[string]*weighted)
+			}
+			if byFunction[name][key] == nil {
+				byFunction[name][key] = &weighted{frames: frames[:i+1]}
+			}
+			byFunction[name][key].value += value
+		}
+	}
+
+	paths := make(map[string]callPath, len(byFunction))
+	for name, candidates := range byFunction {
+		var best *weighted
+		var bestKey string
+		for key, candidate := range candidates {
+			if best == nil || candidate.value > best.value || candidate.value == best.value && key < bestKey {
+				best, bestKey = candidate, key
+			}
+		}
+		path := callPath{frames: best.frames}
+		if totals[name] > 0 {
+			path.share = float64(best.value) / float64(totals[name]) * 100
+		}
+		paths[name] = path
+	}
+	return paths
+}
+
+// New returns the hotspots that were not among the top functions of the
+// previous run, which may be nil.
+func New(hotspots []*Hotspot, prev *event.Run) []*Hotspot {
+	if prev == nil {
+		return hotspots
+	}
+	names := make([]string, 0, len(prev.Functions))
+	for name := range prev.Functions {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if prev.Functions[names[i]] != prev.Functions[names[j]] {
+			return prev.Functions[names[i]] > prev.Functions[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > len(hotspots) {
+		names = names[:len(hotspots)]
+	}
+	top := make(map[string]bool, len(names))
+	for _, name := range names {
+		top[name] = true
+	}
+
+	var result []*Hotspot
+	for _, h := range hotspots {
+		if !top[h.Name] {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+// Issue is an issue to file.
+type Issue struct {
+	Title  string   `json:"title"`
+	Body   string   `json:"body"`
+	Labels []string `json:"labels,omitempty"`
+}
+
+// Title returns the title of the issue of the hotspot, which identifies it
+// across runs.
+func (h *Hotspot) Title() string {
+	return "Hotspot: " + term.ShortName(h.Name)
+}
+
+// Issue returns the issue of the hotspot in source, estimating its monthly
+// cost from the cpu cores of the service and the cost of a core hour when
+// both are known.
+func (h *Hotspot) Issue(source string, cores, coreHourCost float64) Issue {
+	var body strings.Builder
+	fmt.Fprintf(&body, "`%s` is a new top function of %s with **%.2f%%** of the attributed cpu.\n\n", h.Name, source, h.AttrCPU)
+	if h.File != "" {
+		fmt.Fprintf(&body, "File: `%s`\n\n", h.File)
+	}
+	if len(h.Owners) > 0 {
+		fmt.Fprintf(&body, "Owners: %s\n\n", strings.Join(h.Owners, " "))
+	}
+	if cores > 0 && coreHourCost > 0 {
+		spent := cores * h.AttrCPU / 100
+		fmt.Fprintf(&body, "Estimated cost: %.2f cores, about $%.2f per month at $%.4f per core hour.\n\n", spent, spent*coreHourCost*hoursPerMonth, coreHourCost)
+	}
+	if len(h.Path) > 0 {
+		fmt.Fprintf(&body, "Hottest call path, %.2f%% of its samples:\n\n```\n", h.PathCPU)
+		for i, frame := range h.Path {
+			fmt.Fprintf(&body, "%s%s\n", strings.Repeat("  ", i), frame)
+		}
+		body.WriteString("```\n\n")
+	}
+	body.WriteString("Filed by pprof-adv export-issues.\n")
+
+	return Issue{Title: h.Title(), Body: body.String(), Labels: []string{Label}}
+}
@@ -0,0 +1,140 @@
+package issues
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/internal/event"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestHotspots(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	main := pb.Stack{Name: "main.main", FileName: "/src/shop/main.go"}
+	serve := pb.Stack{Name: "main.serve", FileName: "/src/shop/main.go"}
+	batch := pb.Stack{Name: "main.batch", FileName: "/src/shop/main.go"}
+	hash := pb.Stack{Name: "example.com/shop/store.Checksum", FileName: "/src/shop/store/hash.go"}
+	b.AddSample([]pb.Stack{hash, serve, main}, []int64{50}, nil)
+	b.AddSample([]pb.Stack{hash, batch, main}, []int64{20}, nil)
+	b.AddSample([]pb.Stack{serve, main}, []int64{30}, nil)
+
+	nodes, err := pb.AnalyzeCPUProfile(b.Profile(), pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hotspots := Hotspots(b.Profile(), nodes, 1)
+	if len(hotspots) != 1 || hotspots[0].Name != "example.com/shop/store.Checksum" {
+		t.Fatalf("Expected Checksum to be the hotspot, got %+v", hotspots)
+	}
+	h := hotspots[0]
+	if strings.Join(h.Path, " ") != "main.main main.serve example.com/shop/store.Checksum" || h.PathCPU < 71.42 || h.PathCPU > 71.43 {
+		t.Errorf("Expected the path through main.serve with 71.43%% of the samples, got %v %.2f", h.Path, h.PathCPU)
+	}
+
+	h.Owners = []string{"@org/storage"}
+	issue := h.Issue("service:shop env:prod", 8, 0.05)
+	want := "`example.com/shop/store.Checksum` is a new top function of service:shop env:prod with **70.00%** of the attributed cpu.\n\n" +
+		"File: `/src/shop/store/hash.go`\n\n" +
+		"Owners: @org/storage\n\n" +
+		"Estimated cost: 5.60 cores, about $204.40 per month at $0.0500 per core hour.\n\n" +
+		"Hottest call path, 71.43% of its samples:\n\n```\nmain.main\n  main.serve\n    example.com/shop/store.Checksum\n```\n\n" +
+		"Filed by pprof-adv export-issues.\n"
+	if issue.Title != "Hotspot: store.Checksum" || issue.Body != want {
+		t.Errorf("Expected\n%s\ngot %s\n%s", want, issue.Title, issue.Body)
+	}
+}
+
+func TestNew(t *testing.T) {
+	hotspots := []*Hotspot{{Name: "a"}, {Name: "b"}}
+	if got := New(hotspots, nil); len(got) != 2 {
+		t.Errorf("Expected every hotspot to be new without a previous run, got %d", len(got))
+	}
+	prev := &event.Run{Functions: map[string]float64{"c": 30, "a": 20, "b": 10}}
+	got := New(hotspots, prev)
+	if len(got) != 1 || got[0].Name != "b" {
+		t.Errorf("Expected b to be new as it was not in the previous top 2, got %+v", got)
+	}
+}
+
+func TestCodeOwners(t *testing.T) {
+	c, err := ParseCodeOwners(strings.NewReader(`# owners
+*                 @org/everyone
+*.pb.go           @org/api
+store/            @org/storage
+/cmd/             @org/cli  # anchored
+docs/**/guide.md  @org/docs
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ file, want string }{
+		{"main.go", "@org/everyone"},
+		{"api/v1/api.pb.go", "@org/api"},
+		{"store/hash.go", "@org/storage"},
+		{"internal/store/hash.go", "@org/storage"},
+		{"cmd/shop/main.go", "@org/cli"},
+		{"tools/cmd/main.go", "@org/everyone"},
+		{"docs/guide.md", "@org/docs"},
+		{"docs/a/b/guide.md", "@org/docs"},
+		{"docs/xguide.md", "@org/everyone"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(c.Owners(tt.file), " "); got != tt.want {
+			t.Errorf("Owners(%q): expected %q, got %q", tt.file, tt.want, got)
+		}
+	}
+}
+
+func TestGitHub(t *testing.T) {
+	var created []Issue
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/repos/org/shop/issues":
+			if r.URL.Query().Get("labels") != Label || r.URL.Query().Get("state") != "open" {
+				t.Errorf("Expected open issues labeled %s to be listed, got %s", Label, r.URL.RawQuery)
+			}
+			w.Write([]byte(`[{"title":"Hotspot: store.Checksum"}]`))
+		case r.Method == "POST" && r.URL.Path == "/repos/org/shop/issues":
+			var issue Issue
+			if err := json.NewDecoder(r.Body).Decode(&issue); err != nil {
+				t.Error(err)
+			}
+			created = append(created, issue)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"html_url":"https://github.com/org/shop/issues/7"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	g := &GitHub{URL: server.URL, Repo: "org/shop", Token: "secret"}
+	titles, err := g.OpenTitles(context.Background(), Label)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !titles["Hotspot: store.Checksum"] || len(titles) != 1 {
+		t.Errorf("Expected the open hotspot issue, got %v", titles)
+	}
+
+	url, err := g.Create(context.Background(), Issue{Title: "Hotspot: main.serve", Body: "body", Labels: []string{Label}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "https://github.com/org/shop/issues/7" || len(created) != 1 || created[0].Title != "Hotspot: main.serve" {
+		t.Errorf("Expected the issue to be created, got %s %+v", url, created)
+	}
+
+	g.Token = "wrong"
+	if _, err := g.Create(context.Background(), Issue{Title: "x"}); err == nil {
+		t.Errorf("Expected an error for a rejected token")
+	}
+}
@@ -0,0 +1,510 @@
+package jfr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Magic is the magic number at the start of every JFR chunk.
+var Magic = []byte("FLR\x00")
+
+// chunkHeaderSize is the size of the fixed JFR chunk header.
+const chunkHeaderSize = 68
+
+// checkpointEventType is the event type id of constant pool events.
+const checkpointEventType = 1
+
+// maxValueDepth is how deeply values may nest, as classes may have fields of
+// their own type.
+const maxValueDepth = 32
+
+// valuesPerByte bounds the values decoded from a chunk by its size, as values
+// of classes without fields take no bytes at all.
+const valuesPerByte = 64
+
+// Parse converts the execution samples of a Java Flight Recorder recording into
+// a pprof profile with a single "cpu" sample type counting samples. Both
+// jdk.ExecutionSample and the datadog.ExecutionSample events written by the
+// Datadog Java profiler are understood.
+func Parse(r io.Reader) (*pb.Profile, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := pb.NewBuilder([2]string{"cpu", "samples"})
+	samples := 0
+	for offset := 0; offset < len(data); {
+		c, err := parseChunk(data[offset:])
+		if err != nil {
+			return nil, fmt.Errorf("chunk at offset %d: %w", offset, err)
+		}
+		samples += c.addSamples(b)
+		offset += int(c.size)
+	}
+
+	if samples == 0 {
+		return nil, errors.New("no execution samples found in recording")
+	}
+
+	return b.Profile(), nil
+}
+
+// class is a type described by the chunk metadata.
+type class struct {
+	id     int64
+	name   string
+	fields []field
+}
+
+// field is a field of a class described by the chunk metadata.
+type field struct {
+	name         string
+	typeID       int64
+	constantPool bool
+	array        bool
+}
+
+// object is a decoded instance of a class with fields.
+type object map[string]any
+
+// poolRef is a reference to an entry of a constant pool.
+type poolRef struct {
+	typeID int64
+	key    int64
+}
+
+// chunk is a single decoded JFR chunk.
+type chunk struct {
+	size       int64
+	compressed bool
+	classes    map[int64]*class
+	pools      map[int64]map[int64]any
+	samples    []object
+	values     int64 // Number of values left to decode, see valuesPerByte
+}
+
+// parseChunk decodes the chunk at the start of data.
+func parseChunk(data []byte) (*chunk, error) {
+	if len(data) < chunkHeaderSize || !bytes.Equal(data[:4], Magic) {
+		return nil, errors.New("not a JFR chunk")
+	}
+
+	c := &chunk{
+		size:       int64(binary.BigEndian.Uint64(data[8:])),
+		compressed: binary.BigEndian.Uint32(data[64:])&1 == 1,
+		classes:    make(map[int64]*class),
+		pools:      make(map[int64]map[int64]any),
+	}
+	metadataOffset := int64(binary.BigEndian.Uint64(data[24:]))
+	if c.size < chunkHeaderSize || c.size > int64(len(data)) || metadataOffset < chunkHeaderSize || metadataOffset >= c.size {
+		return nil, errors.New("truncated chunk")
+	}
+	data = data[:c.size]
+	c.values = c.size * valuesPerByte
+
+	if err := c.parseMetadata(&reader{data: data, pos: int(metadataOffset), compressed: c.compressed}); err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+
+	for pos := chunkHeaderSize; pos < len(data); {
+		r := &reader{data: data, pos: pos, compressed: c.compressed}
+		size := r.int()
+		typeID := r.long()
+		if r.err != nil || size <= 0 {
+			return nil, fmt.Errorf("malformed event at offset %d", pos)
+		}
+
+		switch cls := c.classes[typeID]; {
+		case typeID == checkpointEventType:
+			if err := c.parseCheckpoint(r); err != nil {
+				return nil, fmt.Errorf("constant pool at offset %d: %w", pos, err)
+			}
+		case cls != nil && strings.HasSuffix(cls.name, ".ExecutionSample"):
+			v := c.readValue(r, cls.id, false, false, 0)
+			if r.err != nil {
+				return nil, fmt.Errorf("event at offset %d: %w", pos, r.err)
+			}
+			if obj, ok := v.(object); ok {
+				c.samples = append(c.samples, obj)
+			}
+		}
+
+		pos += int(size)
+	}
+
+	return c, nil
+}
+
+// element is a node of the metadata element tree.
+type element struct {
+	name       string
+	attributes map[string]string
+	children   []*element
+}
+
+// parseMetadata decodes the class descriptions of the metadata event.
+func (c *chunk) parseMetadata(r *reader) error {
+	r.int()  // size
+	r.long() // type id
+	r.long() // start time
+	r.long() // duration
+	r.long() // metadata id
+
+	n := r.int()
+	if n < 0 || int(n) > len(r.data)-r.pos {
+		return fmt.Errorf("invalid string count %d", n)
+	}
+	strs := make([]string, n)
+	for i := range strs {
+		strs[i] = r.string(nil)
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	root := readElement(r, strs, 0)
+	if r.err != nil {
+		return r.err
+	}
+
+	for _, child := range root.children {
+		if child.name != "metadata" {
+			continue
+		}
+		for _, el := range child.children {
+			if el.name != "class" {
+				continue
+			}
+			id, _ := strconv.ParseInt(el.attributes["id"], 10, 64)
+			cls := &class{id: id, name: el.attributes["name"]}
+			for _, f := range el.children {
+				if f.name != "field" {
+					continue
+				}
+				typeID, _ := strconv.ParseInt(f.attributes["class"], 10, 64)
+				cls.fields = append(cls.fields, field{
+					name:         f.attributes["name"],
+					typeID:       typeID,
+					constantPool: f.attributes["constantPool"] == "true",
+					array:        f.attributes["dimension"] == "1",
+				})
+			}
+			c.classes[cls.id] = cls
+		}
+	}
+
+	return nil
+}
+
+// readElement decodes a metadata element and its children.
+func readElement(r *reader, strs []string, depth int) *element {
+	if depth > 32 {
+		r.fail(errors.New("metadata nested too deeply"))
+		return &element{}
+	}
+
+	lookup := func(idx int64) string {
+		if idx < 0 || idx >= int64(len(strs)) {
+			r.fail(fmt.Errorf("string index %d out of range", idx))
+			return ""
+		}
+		return strs[idx]
+	}
+
+	el := &element{name: lookup(r.int()), attributes: make(map[string]string)}
+	for n := r.int(); n > 0 && r.err == nil; n-- {
+		key := lookup(r.int())
+		el.attributes[key] = lookup(r.int())
+	}
+	for n := r.int(); n > 0 && r.err == nil; n-- {
+		el.children = append(el.children, readElement(r, strs, depth+1))
+	}
+	return el
+}
+
+// parseCheckpoint decodes the constant pools of a checkpoint event.
+func (c *chunk) parseCheckpoint(r *reader) error {
+	r.long() // start time
+	r.long() // duration
+	r.long() // delta to the previous checkpoint
+	r.byte() // checkpoint type
+
+	for pools := r.int(); pools > 0 && r.err == nil; pools-- {
+		typeID := r.long()
+		pool := c.pools[typeID]
+		if pool == nil {
+			pool = make(map[int64]any)
+			c.pools[typeID] = pool
+		}
+		for n := r.int(); n > 0 && r.err == nil; n-- {
+			key := r.long()
+			pool[key] = c.readValue(r, typeID, false, false, 0)
+		}
+	}
+
+	return r.err
+}
+
+// readValue decodes a value of the given type, nested depth values deep.
+func (c *chunk) readValue(r *reader, typeID int64, constantPool, array bool, depth int) any {
+	if depth > maxValueDepth {
+		r.fail(errors.New("value nested too deeply"))
+		return nil
+	}
+	if c.values--; c.values < 0 {
+		r.fail(errors.New("too many values for the size of the chunk"))
+		return nil
+	}
+	if array {
+		n := r.int()
+		if n < 0 || int(n) > len(r.data)-r.pos {
+			r.fail(fmt.Errorf("invalid array length %d", n))
+			return nil
+		}
+		values := make([]any, 0, n)
+		for ; n > 0 && r.err == nil; n-- {
+			values = append(values, c.readValue(r, typeID, constantPool, false, depth+1))
+		}
+		return values
+	}
+	if constantPool {
+		return poolRef{typeID: typeID, key: r.long()}
+	}
+
+	cls := c.classes[typeID]
+	if cls == nil {
+		r.fail(fmt.Errorf("unknown type id %d", typeID))
+		return nil
+	}
+
+	switch cls.name {
+	case "boolean":
+		return r.byte() != 0
+	case "byte":
+		return int64(int8(r.byte()))
+	case "char", "short":
+		if !r.compressed {
+			return int64(int16(r.fixed(2)))
+		}
+		return r.int()
+	case "int":
+		return r.int()
+	case "long":
+		return r.long()
+	case "float":
+		return float64(math.Float32frombits(uint32(r.fixed(4))))
+	case "double":
+		return math.Float64frombits(r.fixed(8))
+	case "java.lang.String":
+		return r.string(c)
+	}
+
+	obj := make(object, len(cls.fields))
+	for _, f := range cls.fields {
+		obj[f.name] = c.readValue(r, f.typeID, f.constantPool, f.array, depth+1)
+		if r.err != nil {
+			return nil
+		}
+	}
+	return obj
+}
+
+// resolve follows constant pool references until it reaches a value.
+func (c *chunk) resolve(v any) any {
+	for i := 0; i < 8; i++ {
+		ref, ok := v.(poolRef)
+		if !ok {
+			return v
+		}
+		v = c.pools[ref.typeID][ref.key]
+	}
+	return nil
+}
+
+// field resolves the named field of the object held by v.
+func (c *chunk) field(v any, name string) any {
+	obj, _ := c.resolve(v).(object)
+	return c.resolve(obj[name])
+}
+
+// symbol resolves the string held by the symbol or string value v.
+func (c *chunk) symbol(v any) string {
+	v = c.resolve(v)
+	if obj, ok := v.(object); ok {
+		v = c.resolve(obj["string"])
+	}
+	s, _ := v.(string)
+	return s
+}
+
+// addSamples adds the execution samples of the chunk to b and returns how many
+// were added.
+func (c *chunk) addSamples(b *pb.Builder) int {
+	added := 0
+	for _, sample := range c.samples {
+		stackTrace, _ := c.field(sample, "stackTrace").(object)
+		frames, _ := stackTrace["frames"].([]any)
+		stack := make([]pb.Stack, 0, len(frames))
+		for _, frame := range frames {
+			method := c.field(frame, "method")
+			className := strings.ReplaceAll(c.symbol(c.field(c.field(method, "type"), "name")), "/", ".")
+			methodName := c.symbol(c.field(method, "name"))
+			line, _ := c.field(frame, "lineNumber").(int64)
+
+			name := methodName
+			if className != "" {
+				name = className + "." + methodName
+			}
+			stack = append(stack, pb.Stack{Name: name, FileName: className, Line: line})
+		}
+		if len(stack) == 0 {
+			continue
+		}
+
+		var labels map[string]string
+		if thread := c.field(sample, "sampledThread"); thread != nil {
+			if name := c.symbol(c.field(thread, "javaName")); name != "" {
+				labels = map[string]string{"thread": name}
+			}
+		}
+
+		b.AddSample(stack, []int64{1}, labels)
+		added++
+	}
+	return added
+}
+
+// reader decodes the primitive encodings of a JFR chunk. The first error is
+// sticky and turns every subsequent read into a no-op returning zero.
+type reader struct {
+	data       []byte
+	pos        int
+	compressed bool
+	err        error
+}
+
+func (r *reader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if r.pos >= len(r.data) {
+		r.fail(io.ErrUnexpectedEOF)
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+// fixed reads an n byte big-endian integer.
+func (r *reader) fixed(n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		v = v<<8 | uint64(r.byte())
+	}
+	return v
+}
+
+// varint reads a JFR compressed integer: 7 bits per byte, little-endian, with
+// the ninth byte contributing all 8 bits.
+func (r *reader) varint() uint64 {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		b := r.byte()
+		v |= uint64(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+	return v | uint64(r.byte())<<56
+}
+
+func (r *reader) int() int64 {
+	if r.compressed {
+		return int64(int32(r.varint()))
+	}
+	return int64(int32(r.fixed(4)))
+}
+
+func (r *reader) long() int64 {
+	if r.compressed {
+		return int64(r.varint())
+	}
+	return int64(r.fixed(8))
+}
+
+// String encodings.
+const (
+	stringNull = iota
+	stringEmpty
+	stringConstantPool
+	stringUTF8
+	stringCharArray
+	stringLatin1
+)
+
+// string reads an encoded string. Constant pool references are resolved
+// against c, which may be nil while reading metadata.
+func (r *reader) string(c *chunk) string {
+	switch enc := r.byte(); enc {
+	case stringNull, stringEmpty:
+		return ""
+	case stringConstantPool:
+		key := r.long()
+		if c == nil {
+			return ""
+		}
+		for id, cls := range c.classes {
+			if cls.name == "java.lang.String" {
+				s, _ := c.pools[id][key].(string)
+				return s
+			}
+		}
+		return ""
+	case stringUTF8, stringLatin1:
+		n := int(r.int())
+		if n < 0 || r.pos+n > len(r.data) {
+			r.fail(fmt.Errorf("invalid string length %d", n))
+			return ""
+		}
+		raw := r.data[r.pos : r.pos+n]
+		r.pos += n
+		if enc == stringUTF8 {
+			return string(raw)
+		}
+		runes := make([]rune, n)
+		for i, b := range raw {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	case stringCharArray:
+		n := int(r.int())
+		if n < 0 || n > len(r.data)-r.pos {
+			r.fail(fmt.Errorf("invalid string length %d", n))
+			return ""
+		}
+		runes := make([]rune, n)
+		for i := range runes {
+			runes[i] = rune(r.int())
+		}
+		return string(runes)
+	default:
+		r.fail(fmt.Errorf("unknown string encoding %d", enc))
+		return ""
+	}
+}
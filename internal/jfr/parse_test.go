@@ -0,0 +1,216 @@
+package jfr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// recording writes a minimal compressed JFR chunk.
+type recording struct {
+	strings []string
+	index   map[string]int
+	classes [][]byte // Metadata of further classes
+	pools   [][]byte // Further constant pools
+}
+
+func varint(v uint64) []byte {
+	var b []byte
+	for i := 0; i < 8; i++ {
+		if v < 0x80 {
+			return append(b, byte(v))
+		}
+		b = append(b, byte(v&0x7f|0x80))
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func utf8String(s string) []byte {
+	return append(append([]byte{stringUTF8}, varint(uint64(len(s)))...), s...)
+}
+
+func event(typeID uint64, body []byte) []byte {
+	payload := append(varint(typeID), body...)
+	for n := 1; ; n++ {
+		if size := varint(uint64(len(payload) + n)); len(size) == n {
+			return append(size, payload...)
+		}
+	}
+}
+
+func (r *recording) str(s string) []byte {
+	if r.index == nil {
+		r.index = make(map[string]int)
+	}
+	if _, exists := r.index[s]; !exists {
+		r.index[s] = len(r.strings)
+		r.strings = append(r.strings, s)
+	}
+	return varint(uint64(r.index[s]))
+}
+
+// elem encodes a metadata element with attributes given as key, value pairs.
+func (r *recording) elem(name string, attrs []string, children ...[]byte) []byte {
+	b := r.str(name)
+	b = append(b, varint(uint64(len(attrs)/2))...)
+	for i := 0; i < len(attrs); i += 2 {
+		b = append(b, r.str(attrs[i])...)
+		b = append(b, r.str(attrs[i+1])...)
+	}
+	b = append(b, varint(uint64(len(children)))...)
+	for _, child := range children {
+		b = append(b, child...)
+	}
+	return b
+}
+
+func (r *recording) class(id, name string, fields ...[]byte) []byte {
+	return r.elem("class", []string{"id", id, "name", name}, fields...)
+}
+
+func (r *recording) field(name, class string, extra ...string) []byte {
+	return r.elem("field", append([]string{"name", name, "class", class}, extra...))
+}
+
+func (r *recording) chunk() []byte {
+	classes := append([][]byte{
+		r.class("20", "long"),
+		r.class("21", "int"),
+		r.class("22", "java.lang.String"),
+		r.class("23", "boolean"),
+		r.class("30", "java.lang.Class", r.field("name", "31", "constantPool", "true")),
+		r.class("31", "jdk.types.Symbol", r.field("string", "22")),
+		r.class("32", "jdk.types.Method", r.field("type", "30", "constantPool", "true"), r.field("name", "31", "constantPool", "true")),
+		r.class("33", "jdk.types.StackFrame", r.field("method", "32", "constantPool", "true"), r.field("lineNumber", "21")),
+		r.class("34", "jdk.types.StackTrace", r.field("truncated", "23"), r.field("frames", "33", "dimension", "1")),
+		r.class("35", "java.lang.Thread", r.field("javaName", "22")),
+		r.class("100", "jdk.ExecutionSample",
+			r.field("startTime", "20"),
+			r.field("sampledThread", "35", "constantPool", "true"),
+			r.field("stackTrace", "34", "constantPool", "true")),
+	}, r.classes...)
+	root := r.elem("root", nil, r.elem("metadata", nil, classes...))
+	metadata := varint(0)          // start time
+	metadata = append(metadata, 0) // duration
+	metadata = append(metadata, 0) // metadata id
+	metadata = append(metadata, varint(uint64(len(r.strings)))...)
+	for _, s := range r.strings {
+		metadata = append(metadata, utf8String(s)...)
+	}
+	metadata = append(metadata, root...)
+
+	pool := func(typeID uint64, entries ...[]byte) []byte {
+		b := append(varint(typeID), varint(uint64(len(entries)))...)
+		for _, entry := range entries {
+			b = append(b, entry...)
+		}
+		return b
+	}
+	entry := func(key uint64, value ...byte) []byte { return append(varint(key), value...) }
+
+	checkpoint := []byte{0, 0, 0, 0} // start time, duration, delta, type
+	checkpoint = append(checkpoint, varint(uint64(6+len(r.pools)))...)
+	checkpoint = append(checkpoint, pool(31,
+		entry(1, utf8String("com/example/Handler")...),
+		entry(2, utf8String("handle")...),
+		entry(3, utf8String("hash")...),
+	)...)
+	checkpoint = append(checkpoint, pool(30, entry(1, 1))...)
+	checkpoint = append(checkpoint, pool(32, entry(1, 1, 2), entry(2, 1, 3))...)
+	checkpoint = append(checkpoint, pool(34,
+		entry(1, 0, 2, 2, 17, 1, 9), // hash:17 <- handle:9
+		entry(2, 0, 1, 1, 9),        // handle:9
+	)...)
+	checkpoint = append(checkpoint, pool(35, entry(1, utf8String("worker-1")...))...)
+	checkpoint = append(checkpoint, pool(22)...)
+	for _, p := range r.pools {
+		checkpoint = append(checkpoint, p...)
+	}
+
+	var body []byte
+	body = append(body, event(checkpointEventType, checkpoint)...)
+	body = append(body, event(100, []byte{0, 1, 1})...)
+	body = append(body, event(100, []byte{0, 1, 1})...)
+	body = append(body, event(100, []byte{0, 1, 2})...)
+	metadataOffset := chunkHeaderSize + len(body)
+	body = append(body, event(0, metadata)...)
+
+	header := make([]byte, chunkHeaderSize)
+	copy(header, Magic)
+	binary.BigEndian.PutUint16(header[4:], 2)
+	binary.BigEndian.PutUint64(header[8:], uint64(chunkHeaderSize+len(body)))
+	binary.BigEndian.PutUint64(header[24:], uint64(metadataOffset))
+	binary.BigEndian.PutUint32(header[64:], 1)
+	return append(header, body...)
+}
+
+func TestParse(t *testing.T) {
+	r := &recording{}
+	data := r.chunk()
+
+	// Two chunks back to back, as JFR files written by a long recording are.
+	p, err := Parse(bytes.NewReader(append(data, data...)))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(p.Sample) != 6 {
+		t.Fatalf("Expected 6 samples, got %d", len(p.Sample))
+	}
+
+	sample := p.Sample[0]
+	if len(sample.LocationId) != 2 {
+		t.Fatalf("Expected 2 frames, got %d", len(sample.LocationId))
+	}
+	leaf := p.Location[sample.LocationId[0]-1].Line[0]
+	if name := p.StringTable[p.Function[leaf.FunctionId-1].Name]; name != "com.example.Handler.hash" {
+		t.Errorf("Expected leaf com.example.Handler.hash, got %s", name)
+	}
+	if leaf.Line != 17 {
+		t.Errorf("Expected leaf line 17, got %d", leaf.Line)
+	}
+	if thread := p.StringTable[sample.Label[0].Str]; thread != "worker-1" {
+		t.Errorf("Expected thread label worker-1, got %s", thread)
+	}
+}
+
+func TestParseNotJFR(t *testing.T) {
+	_, err := Parse(bytes.NewReader([]byte("not a recording at all, definitely not one")))
+	if err == nil {
+		t.Error("Expected error for non JFR input, got nil")
+	}
+}
+
+func TestParseSelfReferentialClass(t *testing.T) {
+	// A class with a field of its own type outside of the constant pools, as
+	// in a corrupt or hostile recording, must not recurse without end.
+	r := &recording{}
+	r.classes = [][]byte{r.class("40", "com.example.Node", r.field("next", "40"))}
+	r.pools = [][]byte{append(varint(40), 1, 1)} // one com.example.Node with key 1
+
+	if _, err := Parse(bytes.NewReader(r.chunk())); err == nil || !strings.Contains(err.Error(), "nested too deeply") {
+		t.Errorf("Expected an error for values nested too deeply, got %v", err)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	r := &recording{}
+	f.Add(r.chunk())
+	nodes := &recording{}
+	nodes.classes = [][]byte{nodes.class("40", "com.example.Node", nodes.field("next", "40"), nodes.field("children", "40", "dimension", "1"))}
+	nodes.pools = [][]byte{append(varint(40), 1, 1)}
+	f.Add(nodes.chunk())
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p, err := Parse(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if err := pb.Validate(p); err != nil {
+			t.Errorf("Parse returned an invalid profile: %v", err)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+// Package k8s collects profiles from the net/http/pprof endpoint of
+// Kubernetes pods through the pod proxy of the API server, with the
+// credentials and context of kubectl, so that no port has to be forwarded.
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	"github.com/kmrgirish/pprof-adv/internal/remote"
+)
+
+// Target is the pprof endpoint of a pod.
+type Target struct {
+	Namespace string // namespace of the kubectl context if empty
+	Pod       string
+	Port      int
+}
+
+// ParseTarget returns the target of a pod reference, "pod/name" or "name".
+func ParseTarget(ref, namespace string, port int) (Target, error) {
+	kind, name, found := strings.Cut(ref, "/")
+	if !found {
+		kind, name = "pod", ref
+	}
+	if kind != "pod" && kind != "pods" && kind != "po" {
+		return Target{}, fmt.Errorf("unsupported resource %q, expected pod/<name>", ref)
+	}
+	if name == "" {
+		return Target{}, fmt.Errorf("missing pod name in %q", ref)
+	}
+	if port <= 0 || port > 65535 {
+		return Target{}, fmt.Errorf("invalid port %d", port)
+	}
+	return Target{Namespace: namespace, Pod: name, Port: port}, nil
+}
+
+// Path returns the path of the API server proxying to the pprof endpoint of
+// the profile type, cpu by default, which is recorded for seconds.
+func (t Target) Path(profileType string, seconds int) (string, error) {
+	path, err := remote.PprofPath(profileType, seconds)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("/api/v1/namespaces/%s/pods/%s:%d/proxy%s", url.PathEscape(t.Namespace), url.PathEscape(t.Pod), t.Port, path), nil
+}
+
+// Fetch collects a profile of the type from the target with kubectl, which
+// takes seconds for cpu profiles. It needs the get permission on the
+// pods/proxy resource of the namespace.
+func Fetch(ctx context.Context, t Target, profileType string, seconds int) ([]byte, error) {
+	if t.Namespace == "" {
+		namespace, err := kubectl(ctx, "config", "view", "--minify", "-o", "jsonpath={..namespace}")
+		if err != nil {
+			return nil, err
+		}
+		t.Namespace = strings.TrimSpace(string(namespace))
+		if t.Namespace == "" {
+			t.Namespace = "default"
+		}
+	}
+	path, err := t.Path(profileType, seconds)
+	if err != nil {
+		return nil, err
+	}
+	return kubectl(ctx, "get", "--raw", path)
+}
+
+// kubectl runs kubectl with the args and returns its output.
+func kubectl(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "kubectl", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("kubectl %s: %w\n%s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,35 @@
+package k8s
+
+import "testing"
+
+func TestTargetPath(t *testing.T) {
+	target, err := ParseTarget("pod/api-7d9f", "shop", 6060)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ profileType, want string }{
+		{"", "/api/v1/namespaces/shop/pods/api-7d9f:6060/proxy/debug/pprof/profile?seconds=15"},
+		{"heap", "/api/v1/namespaces/shop/pods/api-7d9f:6060/proxy/debug/pprof/heap"},
+		{"mutex", "/api/v1/namespaces/shop/pods/api-7d9f:6060/proxy/debug/pprof/mutex"},
+	}
+	for _, tt := range tests {
+		if got, err := target.Path(tt.profileType, 15); err != nil || got != tt.want {
+			t.Errorf("Path(%q): expected %q, got %q: %v", tt.profileType, tt.want, got, err)
+		}
+	}
+	if _, err := target.Path("wall", 15); err == nil {
+		t.Error("Expected error for wall profiles, got nil")
+	}
+
+	if target, err := ParseTarget("api-7d9f", "", 8080); err != nil || target.Pod != "api-7d9f" || target.Port != 8080 {
+		t.Errorf("Expected pod api-7d9f on 8080, got %+v: %v", target, err)
+	}
+	for _, ref := range []string{"deployment/api", "pod/", ""} {
+		if _, err := ParseTarget(ref, "", 6060); err == nil {
+			t.Errorf("Expected error for %q, got nil", ref)
+		}
+	}
+	if _, err := ParseTarget("pod/api", "", 0); err == nil {
+		t.Error("Expected error for port 0, got nil")
+	}
+}
@@ -0,0 +1,93 @@
+// Package kernel resolves the addresses of kernel frames of perf and eBPF
+// profiles with the symbols of /proc/kallsyms.
+package kernel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Symbol is a kernel function.
+type Symbol struct {
+	Address uint64
+	Name    string
+	Module  string // empty for the kernel image
+}
+
+// Symbols are the kernel functions by ascending address.
+type Symbols []Symbol
+
+// Load reads the symbols of a kallsyms file, such as a copy of /proc/kallsyms
+// taken on the host the profile was recorded on.
+func Load(path string) (Symbols, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseKallsyms(f)
+}
+
+// ParseKallsyms parses the text symbols of the /proc/kallsyms format, lines of
+// address, type, name and an optional [module], e.g.
+//
+//	ffffffff81c00000 T entry_SYSCALL_64
+//	ffffffffc0a01230 t nf_conntrack_in	[nf_conntrack]
+func ParseKallsyms(r io.Reader) (Symbols, error) {
+	var symbols Symbols
+	scanner := bufio.NewScanner(r)
+	lineNo, hidden := 0, 0
+	for scanner.Scan() {
+		lineNo++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 3 || len(fields[1]) != 1 {
+			return nil, fmt.Errorf("line %d: malformed kallsyms line %q", lineNo, scanner.Text())
+		}
+		if !strings.Contains("tTwW", fields[1]) {
+			continue
+		}
+		addr, err := strconv.ParseUint(fields[0], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address %q", lineNo, fields[0])
+		}
+		if addr == 0 {
+			hidden++
+			continue
+		}
+		symbol := Symbol{Address: addr, Name: fields[2]}
+		if len(fields) > 3 {
+			symbol.Module = strings.Trim(fields[3], "[]")
+		}
+		symbols = append(symbols, symbol)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(symbols) == 0 {
+		if hidden > 0 {
+			return nil, fmt.Errorf("kallsyms addresses are hidden, copy /proc/kallsyms as root or with kernel.kptr_restrict=0")
+		}
+		return nil, fmt.Errorf("no text symbols found in kallsyms")
+	}
+
+	sort.SliceStable(symbols, func(i, j int) bool { return symbols[i].Address < symbols[j].Address })
+	return symbols, nil
+}
+
+// Lookup returns the function containing addr, the last one starting at or
+// below it.
+func (s Symbols) Lookup(addr uint64) (name, module string, ok bool) {
+	i := sort.Search(len(s), func(i int) bool { return s[i].Address > addr })
+	if i == 0 {
+		return "", "", false
+	}
+	return s[i-1].Name, s[i-1].Module, true
+}
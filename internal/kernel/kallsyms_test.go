@@ -0,0 +1,46 @@
+package kernel
+
+import (
+	"strings"
+	"testing"
+)
+
+const kallsyms = `ffffffff81000000 T _stext
+ffffffff81c00000 T entry_SYSCALL_64
+ffffffff81a2b000 t do_syscall_64
+ffffffff82600000 D jiffies
+ffffffffc0a01230 t nf_conntrack_in	[nf_conntrack]
+`
+
+func TestParseKallsyms(t *testing.T) {
+	symbols, err := ParseKallsyms(strings.NewReader(kallsyms))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(symbols) != 4 {
+		t.Fatalf("Expected 4 text symbols, got %+v", symbols)
+	}
+
+	for _, tc := range []struct {
+		addr         uint64
+		name, module string
+		ok           bool
+	}{
+		{0xffffffff81a2b010, "do_syscall_64", "", true},
+		{0xffffffff81c00000, "entry_SYSCALL_64", "", true},
+		{0xffffffffc0a01300, "nf_conntrack_in", "nf_conntrack", true},
+		{0xffffffff80000000, "", "", false},
+	} {
+		name, module, ok := symbols.Lookup(tc.addr)
+		if name != tc.name || module != tc.module || ok != tc.ok {
+			t.Errorf("Expected %x to be %s [%s] %v, got %s [%s] %v", tc.addr, tc.name, tc.module, tc.ok, name, module, ok)
+		}
+	}
+
+	if _, err := ParseKallsyms(strings.NewReader("0000000000000000 T _stext\n0000000000000000 T do_syscall_64\n")); err == nil || !strings.Contains(err.Error(), "kptr_restrict") {
+		t.Errorf("Expected error for hidden addresses, got %v", err)
+	}
+	if _, err := ParseKallsyms(strings.NewReader("not kallsyms\n")); err == nil {
+		t.Error("Expected error for malformed kallsyms")
+	}
+}
@@ -0,0 +1,155 @@
+// Package latency aligns the cpu of the endpoints of a service, from the
+// trace endpoint labels of its cpu profile, with their latency from APM
+// trace metrics, to tell the endpoints whose latency is spent on cpu, which
+// profiling can speed up, from the ones waiting on I/O, locks or other
+// services.
+package latency
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+	"github.com/kmrgirish/pprof-adv/profiler"
+)
+
+// EndpointLabel is the label the Datadog profilers set to the resource of the
+// root span of the trace a sample was recorded in.
+const EndpointLabel = "trace endpoint"
+
+// minCPUBound is the share of the latency spent on cpu above which an
+// endpoint is cpu bound.
+const minCPUBound = 0.5
+
+// Endpoint is the cpu and latency of an endpoint.
+type Endpoint struct {
+	Name    string
+	CPU     float64       // share of the cpu of the profile, in %
+	Rate    float64       // requests per second
+	Latency time.Duration // mean latency
+	// PerRequest is the cpu of a request, the cpu the endpoint used per
+	// second of the profile over its requests per second.
+	PerRequest time.Duration
+}
+
+// Share returns the share of the latency spent on cpu, which may exceed 1 if
+// requests use several cores or the hits of the traces miss some requests.
+func (e *Endpoint) Share() float64 {
+	if e.Latency <= 0 {
+		return 0
+	}
+	return float64(e.PerRequest) / float64(e.Latency)
+}
+
+// CPUBound reports whether most of the latency of the endpoint is spent on
+// cpu.
+func (e *Endpoint) CPUBound() bool {
+	return e.Share() >= minCPUBound
+}
+
+// Align returns the endpoints of the stats that the profile has cpu samples
+// of, the trace metrics over window, ranked by the time their requests spend
+// on cpu in total, the share of their latency spent on cpu times their rate,
+// so that cpu bound endpoints serving many requests come first.
+func Align(p *pb.Profile, stats []*profiler.EndpointStats, window time.Duration) ([]*Endpoint, error) {
+	idx := pb.CPUSampleIndex(p)
+	if idx == -1 {
+		return nil, fmt.Errorf("not a cpu profile")
+	}
+	if p.DurationNanos <= 0 {
+		return nil, fmt.Errorf("the profile has no duration to compute cpu per second from")
+	}
+	total := pb.TotalCPU(p)
+	if total == 0 {
+		return nil, fmt.Errorf("no CPU time recorded in profile")
+	}
+
+	cpu := make(map[string]int64)
+	names := make(map[string]string)
+	for _, sample := range p.Sample {
+		name, ok := pb.SampleLabel(p, sample, EndpointLabel)
+		if !ok || idx >= len(sample.Value) {
+			continue
+		}
+		tag := NormalizeTag(name)
+		cpu[tag] += sample.Value[idx]
+		names[tag] = name
+	}
+	if len(cpu) == 0 {
+		return nil, fmt.Errorf("no samples with a %q label, enable endpoint profiling in the profiler", EndpointLabel)
+	}
+
+	var endpoints []*Endpoint
+	for _, s := range stats {
+		tag := NormalizeTag(s.Resource)
+		if cpu[tag] == 0 || s.Hits <= 0 {
+			continue
+		}
+		e := &Endpoint{
+			Name:    names[tag],
+			CPU:     100 * float64(cpu[tag]) / float64(total),
+			Rate:    s.Hits / window.Seconds(),
+			Latency: s.Latency(),
+		}
+		cpuPerSecond := float64(cpu[tag]) / float64(p.DurationNanos)
+		e.PerRequest = time.Duration(cpuPerSecond / e.Rate * float64(time.Second))
+		endpoints = append(endpoints, e)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		a, b := endpoints[i].Share()*endpoints[i].Rate, endpoints[j].Share()*endpoints[j].Rate
+		if a != b {
+			return a > b
+		}
+		return endpoints[i].Name < endpoints[j].Name
+	})
+	return endpoints, nil
+}
+
+// NormalizeTag normalizes a resource name like Datadog normalizes tag values,
+// e.g. "GET /users/{id}" to "get_/users/_id", so that trace endpoint labels
+// match the resource_name tags of trace metrics.
+func NormalizeTag(s string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-:./", r) {
+			b.WriteRune(r)
+			underscore = false
+		} else if !underscore {
+			b.WriteByte('_')
+			underscore = true
+		}
+	}
+	return strings.TrimRight(b.String(), "_")
+}
+
+// Write prints the top endpoints, one per line as "cpu% cpu/request latency
+// cpu-share requests/s endpoint", with "cpu-bound" before the ones spending
+// most of their latency on cpu.
+func Write(w io.Writer, endpoints []*Endpoint, top int, style term.Style) {
+	for i, e := range endpoints {
+		if i == top {
+			break
+		}
+		mark := ""
+		if e.CPUBound() {
+			mark = "cpu-bound "
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.0f%%\t%.1f/s\t%s%s\n", style.Percent(e.CPU), round(e.PerRequest), round(e.Latency), 100*e.Share(), e.Rate, mark, e.Name)
+	}
+}
+
+// round rounds a duration to 3 significant digits for display.
+func round(d time.Duration) time.Duration {
+	for unit := time.Nanosecond; unit < time.Hour; unit *= 10 {
+		if d < 1000*unit {
+			return d.Round(unit)
+		}
+	}
+	return d
+}
@@ -0,0 +1,72 @@
+package latency
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+	"github.com/kmrgirish/pprof-adv/profiler"
+)
+
+func TestAlign(t *testing.T) {
+	p := &pb.Profile{
+		StringTable:   []string{"", "cpu", "nanoseconds", EndpointLabel, "GET /users/{id}", "POST /upload"},
+		SampleType:    []*pb.ValueType{{Type: 1, Unit: 2}},
+		DurationNanos: int64(60 * time.Second),
+		Sample: []*pb.Sample{
+			{Value: []int64{int64(30 * time.Second)}, Label: []*pb.Label{{Key: 3, Str: 4}}},
+			{Value: []int64{int64(6 * time.Second)}, Label: []*pb.Label{{Key: 3, Str: 5}}},
+			{Value: []int64{int64(24 * time.Second)}},
+		},
+	}
+	stats := []*profiler.EndpointStats{
+		// 100 requests/s of 10ms, of which the 0.5 cores spend 5ms on cpu.
+		{Resource: "get_/users/_id", Hits: 6000, Duration: 60 * time.Second},
+		// 1 request/s of 2s, of which 100ms on cpu.
+		{Resource: "post_/upload", Hits: 60, Duration: 120 * time.Second},
+		{Resource: "get_/health", Hits: 600, Duration: time.Second},
+	}
+	endpoints, err := Align(p, stats, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 2 {
+		t.Fatalf("Expected the 2 endpoints with cpu samples, got %d", len(endpoints))
+	}
+	users, upload := endpoints[0], endpoints[1]
+	if users.Name != "GET /users/{id}" || users.PerRequest != 5*time.Millisecond || users.Latency != 10*time.Millisecond || users.CPU != 50 {
+		t.Errorf("Expected GET /users/{id} with 5ms of 10ms on cpu, got %+v", users)
+	}
+	if !users.CPUBound() {
+		t.Errorf("Expected GET /users/{id} to be cpu bound, got share %v", users.Share())
+	}
+	if upload.Name != "POST /upload" || upload.PerRequest != 100*time.Millisecond || upload.CPUBound() {
+		t.Errorf("Expected POST /upload with 100ms of 2s on cpu, got %+v", upload)
+	}
+
+	var buf bytes.Buffer
+	Write(&buf, endpoints, 10, term.Style{})
+	if want := "50.00\t5ms\t10ms\t50%\t100.0/s\tcpu-bound GET /users/{id}\n"; !strings.HasPrefix(buf.String(), want) {
+		t.Errorf("Expected %q first, got %q", want, buf.String())
+	}
+
+	p.Sample = p.Sample[2:]
+	if _, err := Align(p, stats, time.Minute); err == nil {
+		t.Error("Expected error for a profile without endpoint labels, got nil")
+	}
+}
+
+func TestNormalizeTag(t *testing.T) {
+	for in, want := range map[string]string{
+		"GET /users/{id}":    "get_/users/_id",
+		"Handler.Serve":      "handler.serve",
+		"POST  /api/v1/ok!!": "post_/api/v1/ok",
+	} {
+		if got := NormalizeTag(in); got != want {
+			t.Errorf("NormalizeTag(%q): expected %q, got %q", in, want, got)
+		}
+	}
+}
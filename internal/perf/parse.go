@@ -0,0 +1,161 @@
+package perf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Parse converts the output of `perf script` into a pprof profile with samples
+// and cpu sample types. The cpu value of a sample is its period when perf
+// reports one (nanoseconds for cpu-clock/task-clock, event counts otherwise),
+// and the process name and pid are attached as the "comm" and "pid" labels.
+//
+// Example:
+//
+//	perf record -F 99 -g -a -- sleep 30
+//	perf script > out.perf
+//	pprof-adv --profile out.perf --input perf
+func Parse(r io.Reader) (*pb.Profile, error) {
+	b := pb.NewBuilder([2]string{"samples", "count"}, [2]string{"cpu", "nanoseconds"})
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var (
+		header  *sampleHeader
+		stack   []pb.Stack
+		samples int
+		lineNo  int
+	)
+	flush := func() {
+		if header != nil && len(stack) > 0 {
+			b.AddSample(stack, []int64{1, header.period}, map[string]string{
+				"comm": header.comm,
+				"pid":  header.pid,
+			})
+			samples++
+		}
+		header, stack = nil, nil
+	}
+
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case strings.HasPrefix(line, "#"):
+			// perf script header comments
+		case line[0] == ' ' || line[0] == '\t':
+			if header == nil {
+				return nil, fmt.Errorf("line %d: stack frame without sample header", lineNo)
+			}
+			stack = append(stack, parseFrame(strings.TrimSpace(line)))
+		default:
+			flush()
+			h, err := parseHeader(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			header = h
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	if samples == 0 {
+		return nil, fmt.Errorf("no samples with call stacks found, was perf record run with -g?")
+	}
+
+	return b.Profile(), nil
+}
+
+// sampleHeader is the first line of a perf script sample, e.g.
+//
+//	myapp  1234/1240 [002] 5312.881239:   10101010 cpu-clock:pppH:
+type sampleHeader struct {
+	comm   string
+	pid    string
+	period int64
+}
+
+// parseHeader parses a sample header line. The comm may contain spaces, so the
+// line is split around the first "pid/tid" or numeric pid field.
+func parseHeader(line string) (*sampleHeader, error) {
+	fields := strings.Fields(line)
+	pidIdx := -1
+	for i, field := range fields {
+		if i == 0 {
+			continue
+		}
+		pid, _, _ := strings.Cut(field, "/")
+		if _, err := strconv.Atoi(pid); err == nil {
+			pidIdx = i
+			break
+		}
+	}
+	if pidIdx == -1 {
+		return nil, fmt.Errorf("malformed sample header %q", line)
+	}
+
+	h := &sampleHeader{
+		comm:   strings.Join(fields[:pidIdx], " "),
+		period: 1,
+	}
+	h.pid, _, _ = strings.Cut(fields[pidIdx], "/")
+
+	// The period, when present, is the first integer after the timestamp.
+	for i := pidIdx + 1; i < len(fields)-1; i++ {
+		if !strings.HasSuffix(fields[i], ":") {
+			continue
+		}
+		if period, err := strconv.ParseInt(fields[i+1], 10, 64); err == nil && period > 0 {
+			h.period = period
+		}
+		break
+	}
+
+	return h, nil
+}
+
+// parseFrame parses a stack line such as
+//
+//	7f3a2b1c40 runtime.mallocgc+0x3c (/usr/local/bin/myapp)
+//
+// Unknown kernel frames are [kernel] frames at their address.
+func parseFrame(line string) pb.Stack {
+	address, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+
+	var dso string
+	if i := strings.LastIndex(rest, " ("); i >= 0 && strings.HasSuffix(rest, ")") {
+		dso = rest[i+2 : len(rest)-1]
+		rest = rest[:i]
+	}
+
+	name := rest
+	if i := strings.LastIndex(name, "+0x"); i > 0 {
+		name = name[:i]
+	}
+	if name == "" || name == "[unknown]" {
+		name = "[unknown]"
+		if pb.IsKernelFile(dso) {
+			// kept by address for pb.SymbolizeKernel
+			addr, _ := strconv.ParseUint(address, 16, 64)
+			return pb.Stack{Name: pb.KernelFrame, FileName: dso, Address: addr}
+		}
+		if dso != "" {
+			name = fmt.Sprintf("[%s]", filepath.Base(dso))
+		}
+	}
+
+	return pb.Stack{Name: name, FileName: dso}
+}
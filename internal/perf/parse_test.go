@@ -0,0 +1,68 @@
+package perf
+
+import (
+	"strings"
+	"testing"
+)
+
+const script = `# ========
+# captured on: Thu Jan  1 00:00:00 2025
+# ========
+myapp  1234/1240 [002] 5312.881239:   10101010 cpu-clock:pppH:
+	          46a1c0 runtime.mallocgc+0x3c (/usr/local/bin/myapp)
+	          4b2f10 main.handler+0x10 (/usr/local/bin/myapp)
+	          4b3000 main.main+0x20 (/usr/local/bin/myapp)
+
+python3 99 [000] 5312.891239:   20202020 cpu-clock:pppH:
+	    7f3a2b1c40 [unknown] (/usr/lib/libpython3.so)
+	    7f3a2b1d40 _PyEval_EvalFrameDefault+0x100 (/usr/lib/libpython3.so)
+
+myapp  1234/1241 [003] 5312.901239:   10101010 cpu-clock:pppH:
+	ffffffff81a2b010 [unknown] ([kernel.kallsyms])
+	ffffffff81c00010 entry_SYSCALL_64_after_hwframe+0x44 ([kernel.kallsyms])
+	          46b000 syscall.Syscall+0x20 (/usr/local/bin/myapp)
+`
+
+func TestParse(t *testing.T) {
+	p, err := Parse(strings.NewReader(script))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(p.Sample) != 3 {
+		t.Fatalf("Expected 3 samples, got %d", len(p.Sample))
+	}
+
+	first := p.Sample[0]
+	if first.Value[1] != 10101010 {
+		t.Errorf("Expected period 10101010, got %d", first.Value[1])
+	}
+	if len(first.LocationId) != 3 {
+		t.Fatalf("Expected 3 frames, got %d", len(first.LocationId))
+	}
+	leaf := p.Function[p.Location[first.LocationId[0]-1].Line[0].FunctionId-1]
+	if name := p.StringTable[leaf.Name]; name != "runtime.mallocgc" {
+		t.Errorf("Expected leaf runtime.mallocgc, got %s", name)
+	}
+
+	second := p.Sample[1]
+	leaf = p.Function[p.Location[second.LocationId[0]-1].Line[0].FunctionId-1]
+	if name := p.StringTable[leaf.Name]; name != "[libpython3.so]" {
+		t.Errorf("Expected unknown frame named after dso, got %s", name)
+	}
+	if comm := p.StringTable[second.Label[0].Str]; comm != "python3" {
+		t.Errorf("Expected comm label python3, got %s", comm)
+	}
+
+	third := p.Location[p.Sample[2].LocationId[0]-1]
+	leaf = p.Function[third.Line[0].FunctionId-1]
+	if name := p.StringTable[leaf.Name]; name != "[kernel]" || third.Address != 0xffffffff81a2b010 {
+		t.Errorf("Expected unknown kernel frame as [kernel] at ffffffff81a2b010, got %s at %x", name, third.Address)
+	}
+}
+
+func TestParseWithoutCallGraph(t *testing.T) {
+	_, err := Parse(strings.NewReader("myapp 1234 5312.881239: 1 cpu-clock:\n"))
+	if err == nil {
+		t.Error("Expected error for perf script without stacks, got nil")
+	}
+}
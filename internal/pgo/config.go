@@ -0,0 +1,192 @@
+package pgo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config describes the profiles to merge into a PGO profile. It is read from a
+// pgo.yaml file such as:
+//
+//	output: default.pgo
+//	window: 72h
+//	limit: 5
+//	profiles:
+//	  - service: checkout
+//	    env: prod
+//	    weight: 2
+//	  - service: checkout
+//	    env: staging
+//	    query: version:1.4.0
+//	    window: 24h
+type Config struct {
+	Output  string        // path the merged profile is written to
+	Window  time.Duration // default time window to search profiles in
+	Limit   int           // default number of profiles to download per source
+	Sources []Source      // the "profiles" list
+}
+
+// Source is one query for profiles whose merged samples are scaled by Weight
+// before being merged with the other sources.
+type Source struct {
+	Service string
+	Env     string
+	Query   string // additional query terms, e.g. "version:1.4.0"
+	Window  time.Duration
+	Limit   int
+	Weight  float64
+}
+
+// ParseConfig reads a pgo.yaml file. Only the subset of YAML used by the
+// format is supported: scalar keys and a list of mappings under "profiles".
+func ParseConfig(r io.Reader) (*Config, error) {
+	cfg := &Config{Output: "default.pgo", Window: 72 * time.Hour, Limit: 5}
+
+	var (
+		inProfiles bool
+		source     *Source
+		lineNo     int
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNo++
+		line := stripComment(scanner.Text())
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indented := line[0] == ' ' || line[0] == '\t'
+		line = strings.TrimSpace(line)
+
+		if !indented {
+			source, inProfiles = nil, false
+			key, value, err := splitKey(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			if key == "profiles" {
+				if value != "" {
+					return nil, fmt.Errorf("line %d: profiles must be a list", lineNo)
+				}
+				inProfiles = true
+				continue
+			}
+			if err := cfg.set(key, value); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			continue
+		}
+
+		if !inProfiles {
+			return nil, fmt.Errorf("line %d: unexpected indentation", lineNo)
+		}
+		if rest, ok := strings.CutPrefix(line, "-"); ok {
+			cfg.Sources = append(cfg.Sources, Source{Weight: 1})
+			source = &cfg.Sources[len(cfg.Sources)-1]
+			line = strings.TrimSpace(rest)
+			if line == "" {
+				continue
+			}
+		}
+		if source == nil {
+			return nil, fmt.Errorf("line %d: expected a list item", lineNo)
+		}
+		key, value, err := splitKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if err := source.set(key, value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Sources) == 0 {
+		return nil, fmt.Errorf("no profiles configured")
+	}
+	for i, source := range cfg.Sources {
+		if source.Service == "" {
+			return nil, fmt.Errorf("profile %d: service is required", i+1)
+		}
+		if source.Weight < 0 {
+			return nil, fmt.Errorf("profile %d: weight must not be negative", i+1)
+		}
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) set(key, value string) (err error) {
+	switch key {
+	case "output":
+		cfg.Output = value
+	case "window":
+		cfg.Window, err = time.ParseDuration(value)
+	case "limit":
+		cfg.Limit, err = strconv.Atoi(value)
+	default:
+		return fmt.Errorf("unknown key %q", key)
+	}
+	return err
+}
+
+func (s *Source) set(key, value string) (err error) {
+	switch key {
+	case "service":
+		s.Service = value
+	case "env":
+		s.Env = value
+	case "query":
+		s.Query = value
+	case "window":
+		s.Window, err = time.ParseDuration(value)
+	case "limit":
+		s.Limit, err = strconv.Atoi(value)
+	case "weight":
+		s.Weight, err = strconv.ParseFloat(value, 64)
+	default:
+		return fmt.Errorf("unknown profile key %q", key)
+	}
+	return err
+}
+
+// splitKey splits a "key: value" line, unquoting the value.
+func splitKey(line string) (key, value string, err error) {
+	key, value, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", "", fmt.Errorf("expected key: value, got %q", line)
+	}
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		if value[0] == '"' {
+			if value, err = strconv.Unquote(value); err != nil {
+				return "", "", err
+			}
+		} else {
+			value = strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+		}
+	}
+	return key, value, nil
+}
+
+// stripComment removes a trailing # comment that is not inside quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return line
+}
@@ -0,0 +1,72 @@
+package pgo
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const config = `# weekly pgo profile
+output: "build/default.pgo"
+window: 48h
+
+profiles:
+  - service: checkout
+    env: prod
+    weight: 2 # prod traffic matters most
+  - service: checkout
+    env: staging
+    query: 'version:1.4.0'
+    window: 24h
+    limit: 3
+`
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("ParseConfig failed: %v", err)
+	}
+	if cfg.Output != "build/default.pgo" || cfg.Window != 48*time.Hour || cfg.Limit != 5 {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+	if len(cfg.Sources) != 2 {
+		t.Fatalf("Expected 2 sources, got %d", len(cfg.Sources))
+	}
+
+	prod, staging := cfg.Sources[0], cfg.Sources[1]
+	if prod.Service != "checkout" || prod.Env != "prod" || prod.Weight != 2 {
+		t.Errorf("Unexpected first source %+v", prod)
+	}
+	if staging.Query != "version:1.4.0" || staging.Window != 24*time.Hour || staging.Limit != 3 || staging.Weight != 1 {
+		t.Errorf("Unexpected second source %+v", staging)
+	}
+
+	now := time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)
+	query := staging.SearchQuery(cfg, now)
+	if query.Filter.Query != "service:checkout env:staging version:1.4.0" {
+		t.Errorf("Unexpected query %q", query.Filter.Query)
+	}
+	if query.Filter.From.Time != now.Add(-24*time.Hour) || query.Limit != 3 {
+		t.Errorf("Unexpected window or limit in %+v", query)
+	}
+	if query := prod.SearchQuery(cfg, now); query.Filter.From.Time != now.Add(-48*time.Hour) || query.Limit != 5 {
+		t.Errorf("Expected config defaults, got %+v", query)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := map[string]string{
+		"no profiles":  "output: x.pgo\n",
+		"no service":   "profiles:\n  - env: prod\n",
+		"unknown key":  "profiles:\n  - service: a\n    wieght: 2\n",
+		"bad window":   "window: soon\nprofiles:\n  - service: a\n",
+		"not a list":   "profiles: a\n",
+		"stray indent": "  output: x.pgo\n",
+		"negative":     "profiles:\n  - service: a\n    weight: -1\n",
+	}
+	for name, config := range tests {
+		if _, err := ParseConfig(strings.NewReader(config)); err == nil {
+			t.Errorf("%s: Expected error, got nil", name)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package pgo
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+const (
+	// DefaultMaxBytes is the size of the machine code of functions up to
+	// which they are reported as inlining candidates. The compiler inlines
+	// functions up to a cost of 80 without a profile and raises the budget to
+	// 2000 for hot call sites with -pgo, so functions well under a kilobyte are
+	// the ones pgo is likely to inline.
+	DefaultMaxBytes = 1024
+	// DefaultMaxLines is the span of source lines up to which functions are
+	// reported as inlining candidates when their size is unknown.
+	DefaultMaxLines = 30
+)
+
+// InlineOptions selects the functions of an inlining report.
+type InlineOptions struct {
+	// Sizes holds the size in bytes of the functions of the binary, see
+	// exe.File. Without sizes, the size of functions is estimated from the
+	// span of the source lines of their samples, which underestimates
+	// functions whose lines are not all sampled.
+	Sizes map[string]int
+	// MaxSize is the size of the largest reported function, in bytes with
+	// Sizes and in lines without, it defaults to DefaultMaxBytes or
+	// DefaultMaxLines.
+	MaxSize int
+	// Top is the number of reported functions, all of them if 0.
+	Top int
+}
+
+// InlineReport lists hot small functions that are called rather than inlined,
+// the candidates for pgo driven inlining.
+type InlineReport struct {
+	Candidates []InlineCandidate
+	// CPU is the share of the profile's cpu, in percent, spent in calls to the
+	// candidates.
+	CPU float64
+	// Bytes reports whether sizes are in bytes of machine code, rather than
+	// source lines.
+	Bytes bool
+}
+
+// InlineCandidate is a small function with samples of calls to it.
+type InlineCandidate struct {
+	Name string
+	// CPU is the share of the profile's cpu, in percent, spent in calls to
+	// the function that were not inlined.
+	CPU  float64
+	Size int
+	// Partially reports whether the function is inlined at some of its call
+	// sites already.
+	Partially bool
+}
+
+// Inlining reports the small functions of the profile that are not inlined
+// into their callers, by descending cpu spent in calls to them. A function is
+// inlined where a location lists it before the outermost function, the
+// compiler records inlined calls that way.
+func Inlining(profile *pb.Profile, opts InlineOptions) (*InlineReport, error) {
+	idx := pb.CPUSampleIndex(profile)
+	if idx == -1 {
+		return nil, fmt.Errorf("no CPU samples found in profile")
+	}
+	if opts.MaxSize == 0 {
+		opts.MaxSize = DefaultMaxLines
+		if opts.Sizes != nil {
+			opts.MaxSize = DefaultMaxBytes
+		}
+	}
+
+	names := make(map[uint64]string, len(profile.Function))
+	startLines := make(map[string]int64, len(profile.Function))
+	for _, fn := range profile.Function {
+		name := profile.StringTable[fn.Name]
+		names[fn.Id] = name
+		if fn.StartLine > 0 {
+			startLines[name] = fn.StartLine
+		}
+	}
+
+	// Find the called function of every location and the functions inlined
+	// anywhere, along with the span of the sampled lines of every function
+	outermost := make(map[uint64]string, len(profile.Location))
+	inlined := make(map[string]bool)
+	first, last := make(map[string]int64), make(map[string]int64)
+	for _, loc := range profile.Location {
+		for i, line := range loc.Line {
+			name := names[line.FunctionId]
+			if i == len(loc.Line)-1 {
+				outermost[loc.Id] = name
+			} else {
+				inlined[name] = true
+			}
+			if line.Line <= 0 {
+				continue
+			}
+			if l, exists := first[name]; !exists || line.Line < l {
+				first[name] = line.Line
+			}
+			if line.Line > last[name] {
+				last[name] = line.Line
+			}
+		}
+	}
+
+	// Sum the cpu of the calls to every function, the outermost frame of a
+	// stack is the entry point and is not called
+	calls := make(map[string]int64)
+	var total int64
+	for _, sample := range profile.Sample {
+		value := sample.Value[idx]
+		total += value
+		seen := make(map[string]bool, len(sample.LocationId))
+		for _, id := range sample.LocationId[:max(len(sample.LocationId)-1, 0)] {
+			name, exists := outermost[id]
+			if exists && !seen[name] {
+				seen[name] = true
+				calls[name] += value
+			}
+		}
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("no CPU time recorded in profile")
+	}
+
+	report := &InlineReport{Bytes: opts.Sizes != nil}
+	candidates := make(map[string]bool)
+	for name, value := range calls {
+		size := 0
+		if opts.Sizes != nil {
+			size = opts.Sizes[name]
+		} else if _, exists := first[name]; exists {
+			start := first[name]
+			if s, exists := startLines[name]; exists && s < start {
+				start = s
+			}
+			size = int(last[name]-start) + 1
+		}
+		if size <= 0 || size > opts.MaxSize || value == 0 {
+			continue
+		}
+		candidates[name] = true
+		report.Candidates = append(report.Candidates, InlineCandidate{
+			Name:      name,
+			CPU:       float64(value) / float64(total) * 100,
+			Size:      size,
+			Partially: inlined[name],
+		})
+	}
+
+	// Count the samples calling several candidates once
+	var cpu int64
+	for _, sample := range profile.Sample {
+		for _, id := range sample.LocationId[:max(len(sample.LocationId)-1, 0)] {
+			if candidates[outermost[id]] {
+				cpu += sample.Value[idx]
+				break
+			}
+		}
+	}
+	report.CPU = float64(cpu) / float64(total) * 100
+
+	sort.Slice(report.Candidates, func(i, j int) bool {
+		a, b := report.Candidates[i], report.Candidates[j]
+		if a.CPU != b.CPU {
+			return a.CPU > b.CPU
+		}
+		return a.Name < b.Name
+	})
+	if opts.Top > 0 && len(report.Candidates) > opts.Top {
+		report.Candidates = report.Candidates[:opts.Top]
+	}
+	return report, nil
+}
+
+// Write prints the candidates, one per line as "cpu size function", followed
+// by the cpu spent in calls to all of them.
+func (r *InlineReport) Write(w io.Writer) {
+	for _, c := range r.Candidates {
+		unit := "lines"
+		switch {
+		case r.Bytes:
+			unit = "bytes"
+		case c.Size == 1:
+			unit = "line"
+		}
+		note := ""
+		if c.Partially {
+			note = " (inlined at other call sites)"
+		}
+		fmt.Fprintf(w, "%.2f%%\t%d %s\t%s%s\n", c.CPU, c.Size, unit, c.Name, note)
+	}
+	fmt.Fprintf(w, "cpu in calls to small functions that are not inlined\t%.2f%%\n", r.CPU)
+}
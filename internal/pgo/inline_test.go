@@ -0,0 +1,51 @@
+package pgo
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestInlining(t *testing.T) {
+	main := pb.Stack{Name: "main.main", Line: 10}
+	small := pb.Stack{Name: "main.small", Line: 22}
+	smallEnd := pb.Stack{Name: "main.small", Line: 24}
+	large := pb.Stack{Name: "main.large", Line: 100}
+	largeEnd := pb.Stack{Name: "main.large", Line: 180}
+	inline := pb.Stack{Name: "main.inline", Line: 40}
+	profile := verifyTestProfile(
+		[]pb.Stack{small, main},
+		[]pb.Stack{smallEnd, main},
+		[]pb.Stack{smallEnd, large, main},
+		[]pb.Stack{large, main},
+		[]pb.Stack{largeEnd, main},
+		[]pb.Stack{inline, main},
+	)
+	// main.inline is inlined into main.main, so its sample has a single
+	// location listing both functions
+	sample := profile.Sample[len(profile.Sample)-1]
+	inlineLoc, mainLoc := profile.Location[sample.LocationId[0]-1], profile.Location[sample.LocationId[1]-1]
+	inlineLoc.Line = append(inlineLoc.Line, &pb.Line{FunctionId: mainLoc.Line[0].FunctionId, Line: 11})
+	sample.LocationId = sample.LocationId[:1]
+
+	report, err := Inlining(profile, InlineOptions{})
+	if err != nil {
+		t.Fatalf("Inlining failed: %v", err)
+	}
+	var buf bytes.Buffer
+	report.Write(&buf)
+	want := "50.00%\t3 lines\tmain.small\n" +
+		"cpu in calls to small functions that are not inlined\t50.00%\n"
+	if buf.String() != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, buf.String())
+	}
+
+	report, err = Inlining(profile, InlineOptions{Sizes: map[string]int{"main.small": 2000, "main.large": 600}})
+	if err != nil {
+		t.Fatalf("Inlining failed: %v", err)
+	}
+	if len(report.Candidates) != 1 || report.Candidates[0].Name != "main.large" || !almostEqual(report.Candidates[0].CPU, 50) {
+		t.Errorf("Expected main.large to be the only candidate, got %+v", report.Candidates)
+	}
+}
@@ -0,0 +1,103 @@
+// Package pgo builds profile-guided optimization profiles for the go toolchain
+// out of the cpu profiles of several Datadog services, environments and time
+// windows.
+package pgo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+	"github.com/kmrgirish/pprof-adv/profiler"
+)
+
+// SearchQuery returns the profile search query of the source, using the
+// defaults of the config for unset fields.
+func (s Source) SearchQuery(cfg *Config, now time.Time) profiler.SearchQuery {
+	terms := []string{"service:" + s.Service}
+	if s.Env != "" {
+		terms = append(terms, "env:"+s.Env)
+	}
+	if s.Query != "" {
+		terms = append(terms, s.Query)
+	}
+
+	window, limit := s.Window, s.Limit
+	if window == 0 {
+		window = cfg.Window
+	}
+	if limit == 0 {
+		limit = cfg.Limit
+	}
+
+	return profiler.SearchQuery{
+		Filter: profiler.SearchFilter{
+			From:  profiler.JSONTime{Time: now.Add(-window)},
+			To:    profiler.JSONTime{Time: now},
+			Query: strings.Join(terms, " "),
+		},
+		Sort: profiler.SearchSort{
+			Order: "desc",
+			Field: "@metrics.core_cpu_cores",
+		},
+		Limit: limit,
+	}
+}
+
+// Generate downloads the profiles of every source of the config and merges
+// them into one profile, scaling the samples of each source by its weight. It
+// also returns the unweighted profile of each source, for verification.
+func Generate(ctx context.Context, client *profiler.Client, cfg *Config) (*pb.Profile, []*pb.Profile, error) {
+	now := time.Now()
+	merged := make([]*pb.Profile, len(cfg.Sources))
+	errs := make([]error, len(cfg.Sources))
+
+	var wg sync.WaitGroup
+	for i, source := range cfg.Sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			query := source.SearchQuery(cfg, now)
+			merged[i], errs[i] = fetch(ctx, client, query)
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("%s: %w", query.Filter.Query, errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	weights := make([]float64, len(cfg.Sources))
+	for i, err := range errs {
+		if err != nil {
+			return nil, nil, err
+		}
+		weights[i] = cfg.Sources[i].Weight
+	}
+
+	profile, err := pb.Merge(merged, weights)
+	return profile, merged, err
+}
+
+// fetch downloads the profiles matching the query and merges them.
+func fetch(ctx context.Context, client *profiler.Client, query profiler.SearchQuery) (*pb.Profile, error) {
+	download, err := client.SearchAndDownloadProfiles(ctx, []profiler.SearchQuery{query})
+	if err != nil {
+		return nil, err
+	}
+	files, err := download.ExtractCPUProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make([]*pb.Profile, len(files))
+	for i, data := range files {
+		if profiles[i], err = pb.Parse(bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+	}
+	return pb.Merge(profiles, nil)
+}
@@ -0,0 +1,191 @@
+package pgo
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// maxUnresolved is the number of unresolved functions listed by a report.
+const maxUnresolved = 10
+
+// Report describes how well a PGO profile covers the profiles it was built
+// from and the binary it is meant for.
+type Report struct {
+	Samples   int
+	Functions int
+	Edges     int // distinct caller to callee edges, which drive inlining and devirtualization
+
+	// Hot are the hottest functions of the inputs by self cpu, along with
+	// whether the profile has samples for them.
+	Hot []HotFunction
+	// Coverage is the share of the inputs' cpu, in percent, spent in functions
+	// the profile has samples for.
+	Coverage float64
+
+	// Unresolved lists the hottest functions of the profile that are not
+	// symbols of the binary, samples in them can't be matched by the compiler.
+	Unresolved []string
+	// UnresolvedCPU is the share of the profile's cpu, in percent, spent in
+	// functions that are not symbols of the binary.
+	UnresolvedCPU float64
+	// Binary reports whether symbols of a binary were checked.
+	Binary bool
+}
+
+// HotFunction is a hot function of the input profiles.
+type HotFunction struct {
+	Name    string
+	CPU     float64
+	Covered bool
+}
+
+// Verify checks the profile against the hottest top functions of the inputs,
+// which may be empty, and against the symbols of the binary, which may be nil.
+func Verify(profile *pb.Profile, inputs []*pb.Profile, top int, symbols map[string]bool) (*Report, error) {
+	nodes, err := pb.AnalyzeCPUProfile(profile, pb.AnalyzeOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Samples:   len(profile.Sample),
+		Functions: len(profile.Function),
+		Binary:    symbols != nil,
+	}
+	for _, node := range nodes {
+		report.Edges += len(node.Children)
+	}
+
+	if len(inputs) > 0 {
+		merged, err := pb.Merge(inputs, nil)
+		if err != nil {
+			return nil, fmt.Errorf("inputs: %w", err)
+		}
+		inputNodes, err := pb.AnalyzeCPUProfile(merged, pb.AnalyzeOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("inputs: %w", err)
+		}
+
+		for _, node := range bySelfCPU(inputNodes) {
+			covered := nodes[node.Name] != nil && nodes[node.Name].TotalCPU > 0
+			if covered {
+				report.Coverage += node.SelfCPU
+			}
+			if node.SelfCPU > 0 && len(report.Hot) < top {
+				report.Hot = append(report.Hot, HotFunction{Name: node.Name, CPU: node.SelfCPU, Covered: covered})
+			}
+		}
+	}
+
+	if symbols != nil {
+		report.Unresolved, report.UnresolvedCPU = unresolved(profile, symbols)
+	}
+
+	return report, nil
+}
+
+// Missing returns the hot functions the profile has no samples for.
+func (r *Report) Missing() []HotFunction {
+	var missing []HotFunction
+	for _, fn := range r.Hot {
+		if !fn.Covered {
+			missing = append(missing, fn)
+		}
+	}
+	return missing
+}
+
+// Write prints the report, with warnings for hot functions missing from the
+// profile and for functions missing from the binary.
+func (r *Report) Write(w io.Writer) {
+	fmt.Fprintf(w, "samples\t%d\n", r.Samples)
+	fmt.Fprintf(w, "functions\t%d\n", r.Functions)
+	fmt.Fprintf(w, "call edges\t%d\n", r.Edges)
+	if len(r.Hot) > 0 {
+		fmt.Fprintf(w, "input cpu covered\t%.2f%%\n", r.Coverage)
+		fmt.Fprintf(w, "top %d hot functions covered\t%d\n", len(r.Hot), len(r.Hot)-len(r.Missing()))
+	}
+	if r.Binary {
+		fmt.Fprintf(w, "cpu matching binary symbols\t%.2f%%\n", 100-r.UnresolvedCPU)
+	}
+
+	for _, fn := range r.Missing() {
+		fmt.Fprintf(w, "warning: hot function %s (%.2f%% of input cpu) has no samples in the profile\n", fn.Name, fn.CPU)
+	}
+	for _, name := range r.Unresolved {
+		fmt.Fprintf(w, "warning: %s is not a symbol of the binary, it may have been renamed, removed or always inlined\n", name)
+	}
+}
+
+// unresolved returns the hottest functions of the profile that are not symbols
+// of the binary and the share of cpu spent in them. Only the outermost function
+// of every location is checked, the ones inlined into it have no symbol.
+func unresolved(profile *pb.Profile, symbols map[string]bool) ([]string, float64) {
+	names := make(map[uint64]string, len(profile.Function))
+	for _, fn := range profile.Function {
+		names[fn.Id] = profile.StringTable[fn.Name]
+	}
+	outermost := make(map[uint64]string, len(profile.Location))
+	for _, loc := range profile.Location {
+		if len(loc.Line) > 0 {
+			outermost[loc.Id] = names[loc.Line[len(loc.Line)-1].FunctionId]
+		}
+	}
+
+	idx := pb.CPUSampleIndex(profile)
+	cpu := make(map[string]int64)
+	var total, missing int64
+	for _, sample := range profile.Sample {
+		if idx == -1 || len(sample.LocationId) == 0 {
+			continue
+		}
+		total += sample.Value[idx]
+		name, exists := outermost[sample.LocationId[0]]
+		if exists && !symbols[name] {
+			cpu[name] += sample.Value[idx]
+			missing += sample.Value[idx]
+		}
+	}
+	for _, name := range outermost {
+		if _, exists := cpu[name]; !exists && !symbols[name] {
+			cpu[name] = 0
+		}
+	}
+
+	sorted := make([]string, 0, len(cpu))
+	for name := range cpu {
+		sorted = append(sorted, name)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if cpu[sorted[i]] != cpu[sorted[j]] {
+			return cpu[sorted[i]] > cpu[sorted[j]]
+		}
+		return sorted[i] < sorted[j]
+	})
+	if len(sorted) > maxUnresolved {
+		sorted = sorted[:maxUnresolved]
+	}
+
+	if total == 0 {
+		return sorted, 0
+	}
+	return sorted, float64(missing) / float64(total) * 100
+}
+
+// bySelfCPU returns the nodes by descending self cpu, ties broken by name.
+func bySelfCPU(nodes map[string]*pb.FunctionNode) []*pb.FunctionNode {
+	sorted := make([]*pb.FunctionNode, 0, len(nodes))
+	for _, node := range nodes {
+		sorted = append(sorted, node)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].SelfCPU != sorted[j].SelfCPU {
+			return sorted[i].SelfCPU > sorted[j].SelfCPU
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
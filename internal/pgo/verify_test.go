@@ -0,0 +1,52 @@
+package pgo
+
+import (
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func verifyTestProfile(stacks ...[]pb.Stack) *pb.Profile {
+	b := pb.NewBuilder([2]string{"samples", "count"}, [2]string{"cpu", "nanoseconds"})
+	for _, stack := range stacks {
+		b.AddSample(stack, []int64{1, 10}, nil)
+	}
+	return b.Profile()
+}
+
+func TestVerify(t *testing.T) {
+	hot := []pb.Stack{{Name: "main.hot"}, {Name: "main.main"}}
+	warm := []pb.Stack{{Name: "main.warm"}, {Name: "main.main"}}
+	cold := []pb.Stack{{Name: "main.cold"}, {Name: "main.main"}}
+
+	input := verifyTestProfile(hot, hot, hot, warm, cold)
+	profile := verifyTestProfile(hot, warm)
+	symbols := map[string]bool{"main.main": true, "main.hot": true}
+
+	report, err := Verify(profile, []*pb.Profile{input}, 3, symbols)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if report.Samples != 2 || report.Edges != 2 {
+		t.Errorf("Expected 2 samples and 2 edges, got %d and %d", report.Samples, report.Edges)
+	}
+	if !almostEqual(report.Coverage, 80) {
+		t.Errorf("Expected 80%% coverage, got %.2f", report.Coverage)
+	}
+
+	missing := report.Missing()
+	if len(report.Hot) != 3 || len(missing) != 1 || missing[0].Name != "main.cold" {
+		t.Errorf("Expected main.cold to be the missing hot function, got %+v", report.Hot)
+	}
+
+	if len(report.Unresolved) != 1 || report.Unresolved[0] != "main.warm" {
+		t.Errorf("Expected main.warm to be unresolved, got %v", report.Unresolved)
+	}
+	if !almostEqual(report.UnresolvedCPU, 50) {
+		t.Errorf("Expected 50%% unresolved cpu, got %.2f", report.UnresolvedCPU)
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return a-b < 0.01 && b-a < 0.01
+}
@@ -0,0 +1,171 @@
+// Package pipeline composes the processing of a profile out of a source
+// reading it, transforms rewriting it and sinks writing it out, e.g. as
+// reports, so that new inputs, processing steps and outputs plug in as stages
+// rather than as branches of one function.
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Source reads the raw profile processed by a pipeline, e.g. a file, a URL or
+// the top profile of a Datadog service.
+type Source interface {
+	Open(ctx context.Context) (io.ReadCloser, error)
+}
+
+// Transform rewrites the profile before it is written, e.g. sampling it. It
+// may return the profile it was passed.
+type Transform interface {
+	Apply(ctx context.Context, p *pb.Profile) (*pb.Profile, error)
+}
+
+// Sink writes the profile out, e.g. as a report of its format.
+type Sink interface {
+	Write(ctx context.Context, p *pb.Profile) error
+}
+
+// SourceFunc is a Source of a function.
+type SourceFunc func(ctx context.Context) (io.ReadCloser, error)
+
+// Open calls f.
+func (f SourceFunc) Open(ctx context.Context) (io.ReadCloser, error) { return f(ctx) }
+
+// TransformFunc is a Transform of a function.
+type TransformFunc func(ctx context.Context, p *pb.Profile) (*pb.Profile, error)
+
+// Apply calls f.
+func (f TransformFunc) Apply(ctx context.Context, p *pb.Profile) (*pb.Profile, error) {
+	return f(ctx, p)
+}
+
+// SinkFunc is a Sink of a function.
+type SinkFunc func(ctx context.Context, p *pb.Profile) error
+
+// Write calls f.
+func (f SinkFunc) Write(ctx context.Context, p *pb.Profile) error { return f(ctx, p) }
+
+// Part is one of the profiles of a source holding several, e.g. a file of a
+// zip archive.
+type Part struct {
+	Name string
+	Data []byte
+}
+
+type partKey struct{}
+
+// PartOf returns the part of a split source the stages run on.
+func PartOf(ctx context.Context) (Part, bool) {
+	part, ok := ctx.Value(partKey{}).(Part)
+	return part, ok
+}
+
+// Pipeline reads the profile of its source, parses it, applies its transforms
+// in order and writes the result to each of its sinks in order.
+type Pipeline struct {
+	Source Source
+	// Split, if set, splits what the source reads into several profiles, each
+	// parsed, transformed and written in turn with the context of its Part.
+	Split func(data []byte) ([]Part, error)
+	// PartFailed, if set, is called with the error of a part of a split
+	// source, the pipeline going on with the next part unless it returns an
+	// error.
+	PartFailed func(ctx context.Context, err error) error
+	Parse      func(r io.Reader) (*pb.Profile, error)
+	Transforms []Transform
+	Sinks      []Sink
+}
+
+// Run runs the pipeline, stopping at the first error.
+func (p *Pipeline) Run(ctx context.Context) error {
+	r, err := p.Source.Open(ctx)
+	if err != nil {
+		return err
+	}
+	if p.Split == nil {
+		err := p.run(ctx, r)
+		if cerr := r.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+
+	data, err := io.ReadAll(r)
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("reading profiles: %w", err)
+	}
+	parts, err := p.Split(data)
+	if err != nil {
+		return fmt.Errorf("reading profiles: %w", err)
+	}
+	for _, part := range parts {
+		ctx := context.WithValue(ctx, partKey{}, part)
+		if err := p.run(ctx, bytes.NewReader(part.Data)); err != nil {
+			if p.PartFailed == nil {
+				return fmt.Errorf("%s: %w", part.Name, err)
+			}
+			if err := p.PartFailed(ctx, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// run parses the profile of r, transforms it and writes it to the sinks.
+func (p *Pipeline) run(ctx context.Context, r io.Reader) error {
+	profile, err := p.Parse(r)
+	if err != nil {
+		return fmt.Errorf("parsing profile: %w", err)
+	}
+	for _, t := range p.Transforms {
+		if profile, err = t.Apply(ctx, profile); err != nil {
+			return err
+		}
+	}
+	for _, s := range p.Sinks {
+		if err := s.Write(ctx, profile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Registry holds named stages, or constructors of stages, in the order they
+// were registered, which is the order pipelines are built in.
+type Registry[T any] struct {
+	names  []string
+	stages map[string]T
+}
+
+// Register adds the stage under name, panicking if the name is taken as that
+// is a programming error.
+func (r *Registry[T]) Register(name string, stage T) {
+	if _, ok := r.stages[name]; ok {
+		panic(fmt.Sprintf("pipeline: %s registered twice", name))
+	}
+	if r.stages == nil {
+		r.stages = make(map[string]T)
+	}
+	r.names = append(r.names, name)
+	r.stages[name] = stage
+}
+
+// Get returns the stage registered under name.
+func (r *Registry[T]) Get(name string) (T, bool) {
+	stage, ok := r.stages[name]
+	return stage, ok
+}
+
+// Names returns the names of the stages in the order they were registered.
+func (r *Registry[T]) Names() []string {
+	return append([]string(nil), r.names...)
+}
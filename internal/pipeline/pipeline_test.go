@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestRun(t *testing.T) {
+	var steps []string
+	p := &Pipeline{
+		Source: SourceFunc(func(ctx context.Context) (io.ReadCloser, error) {
+			steps = append(steps, "source")
+			return io.NopCloser(strings.NewReader("profile")), nil
+		}),
+		Parse: func(r io.Reader) (*pb.Profile, error) {
+			data, err := io.ReadAll(r)
+			steps = append(steps, "parse "+string(data))
+			return &pb.Profile{}, err
+		},
+		Transforms: []Transform{TransformFunc(func(ctx context.Context, p *pb.Profile) (*pb.Profile, error) {
+			steps = append(steps, "transform")
+			return &pb.Profile{DurationNanos: 1}, nil
+		})},
+		Sinks: []Sink{
+			SinkFunc(func(ctx context.Context, p *pb.Profile) error {
+				if p.DurationNanos != 1 {
+					t.Errorf("Expected the transformed profile, got %v", p)
+				}
+				steps = append(steps, "sink 1")
+				return nil
+			}),
+			SinkFunc(func(ctx context.Context, p *pb.Profile) error {
+				steps = append(steps, "sink 2")
+				return errors.New("disk full")
+			}),
+		},
+	}
+	if err := p.Run(context.Background()); err == nil || err.Error() != "disk full" {
+		t.Errorf("Expected the error of the second sink, got %v", err)
+	}
+	if got := strings.Join(steps, ", "); got != "source, parse profile, transform, sink 1, sink 2" {
+		t.Errorf("Expected the stages in order, got %s", got)
+	}
+}
+
+func TestRunSplit(t *testing.T) {
+	var written, failed []string
+	p := &Pipeline{
+		Source: SourceFunc(func(ctx context.Context) (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("a,bad,b")), nil
+		}),
+		Split: func(data []byte) ([]Part, error) {
+			var parts []Part
+			for _, name := range strings.Split(string(data), ",") {
+				parts = append(parts, Part{Name: name, Data: []byte(name)})
+			}
+			return parts, nil
+		},
+		PartFailed: func(ctx context.Context, err error) error {
+			part, _ := PartOf(ctx)
+			failed = append(failed, part.Name+": "+err.Error())
+			return nil
+		},
+		Parse: func(r io.Reader) (*pb.Profile, error) {
+			data, _ := io.ReadAll(r)
+			if string(data) == "bad" {
+				return nil, errors.New("not a profile")
+			}
+			return &pb.Profile{}, nil
+		},
+		Sinks: []Sink{SinkFunc(func(ctx context.Context, p *pb.Profile) error {
+			part, ok := PartOf(ctx)
+			if !ok {
+				t.Error("Expected the part in the context of the sink")
+			}
+			written = append(written, part.Name)
+			return nil
+		})},
+	}
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if got := strings.Join(written, ", "); got != "a, b" {
+		t.Errorf("Expected parts a and b written, got %s", got)
+	}
+	if len(failed) != 1 || failed[0] != "bad: parsing profile: not a profile" {
+		t.Errorf("Expected the bad part to fail, got %q", failed)
+	}
+
+	p.PartFailed = nil
+	if err := p.Run(context.Background()); err == nil || err.Error() != "bad: parsing profile: not a profile" {
+		t.Errorf("Expected the error of the bad part without PartFailed, got %v", err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	var r Registry[int]
+	r.Register("b", 2)
+	r.Register("a", 1)
+	if got := r.Names(); len(got) != 2 || got[0] != "b" || got[1] != "a" {
+		t.Errorf("Expected the names in registration order, got %q", got)
+	}
+	if stage, ok := r.Get("a"); !ok || stage != 1 {
+		t.Errorf("Expected stage a, got %d %v", stage, ok)
+	}
+	if _, ok := r.Get("c"); ok {
+		t.Error("Expected no stage c")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a name twice to panic")
+		}
+	}()
+	r.Register("a", 3)
+}
@@ -0,0 +1,90 @@
+// Package polyglot is the capacity view of polyglot services, whose processes
+// run different languages under one service, e.g. a go API and its python
+// workers: the cores used by each runtime, then by its functions.
+package polyglot
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Runtime is the cpu used by the processes of one language of a service.
+type Runtime struct {
+	Language  string
+	Cores     float64 // cores used by all the processes of the language
+	Profile   string  // description of the profile the functions come from
+	Functions []Function
+}
+
+// Function is the share of the cores of its runtime used by a function.
+type Function struct {
+	Name     string
+	FileName string
+	Cores    float64
+}
+
+// Analyze sets the functions of the runtime from a profile of one of its
+// processes, analyzed with the runtime functions of the language, sharing
+// the cores of the runtime among them by their attributed cpu, hottest first.
+func (r *Runtime) Analyze(profile *pb.Profile, opts pb.AnalyzeOptions) error {
+	if fn := pb.RuntimeFn(r.Language); fn != nil {
+		opts.ShouldAttr, opts.IsRuntime = fn, fn
+	}
+	nodes, err := pb.AnalyzeCPUProfile(profile, opts)
+	if err != nil {
+		return fmt.Errorf("%s: %w", r.Language, err)
+	}
+	r.Functions = r.Functions[:0]
+	for _, node := range nodes {
+		if node.SelfAttrCPU > 0 {
+			r.Functions = append(r.Functions, Function{node.Name, node.FileName, node.SelfAttrCPU / 100 * r.Cores})
+		}
+	}
+	sort.Slice(r.Functions, func(i, j int) bool {
+		a, b := r.Functions[i], r.Functions[j]
+		if a.Cores != b.Cores {
+			return a.Cores > b.Cores
+		}
+		return a.Name < b.Name
+	})
+	return nil
+}
+
+// Write prints the cores of each runtime and its share of the total, then the
+// top functions of each runtime, one per line as "cores %total function".
+func Write(w io.Writer, runtimes []*Runtime, top int, style term.Style) {
+	l := style.Locale
+	total := 0.0
+	for _, r := range runtimes {
+		total += r.Cores
+	}
+	share := func(cores float64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return cores / total * 100
+	}
+
+	for _, r := range runtimes {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", l.Format(r.Cores, 3), style.Percent(share(r.Cores)), r.Language)
+	}
+	fmt.Fprintf(w, "%s\t\ttotal cores\n", l.Format(total, 3))
+
+	style = style.After(2) // cores and share
+	for _, r := range runtimes {
+		fmt.Fprintf(w, "\n== %s (%s cores)\n", r.Language, l.Format(r.Cores, 3))
+		if r.Profile != "" {
+			fmt.Fprintf(w, "%s\n", r.Profile)
+		}
+		for i, fn := range r.Functions {
+			if i == top {
+				break
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", l.Format(fn.Cores, 3), style.Percent(share(fn.Cores)), style.Function(fn.Name, fn.FileName))
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package polyglot
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestRuntimes(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "java.util.HashMap.get", FileName: "java.util.HashMap"}, {Name: "com.example.Handler.hash", FileName: "com.example.Handler"}}, []int64{3e9}, nil)
+	b.AddSample([]pb.Stack{{Name: "com.example.Handler.run", FileName: "com.example.Handler"}}, []int64{1e9}, nil)
+	jvm := &Runtime{Language: "jvm", Cores: 2}
+	if err := jvm.Analyze(b.Profile(), pb.AnalyzeOptions{AttrCPU: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(jvm.Functions) != 3 {
+		t.Fatalf("Expected 3 jvm functions, got %+v", jvm.Functions)
+	}
+	if fn := jvm.Functions[0]; fn.Name != "com.example.Handler.hash" || math.Abs(fn.Cores-1.5) > 1e-9 {
+		t.Errorf("Expected com.example.Handler.hash to be attributed the 1.5 cores of java.util, got %+v", fn)
+	}
+
+	b = pb.NewBuilder([2]string{"cpu-time", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "dumps", FileName: "json/encoder.py"}}, []int64{1e9}, nil)
+	python := &Runtime{Language: "python", Cores: 6, Profile: "profile p1"}
+	if err := python.Analyze(b.Profile(), pb.AnalyzeOptions{AttrCPU: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	Write(&buf, []*Runtime{python, jvm}, 1, term.Style{})
+	want := "6.000\t75.00\tpython\n" +
+		"2.000\t25.00\tjvm\n" +
+		"8.000\t\ttotal cores\n" +
+		"\n== python (6.000 cores)\n" +
+		"profile p1\n" +
+		"6.000\t75.00\tdumps in json/encoder.py\n" +
+		"\n== jvm (2.000 cores)\n" +
+		"1.500\t18.75\tcom.example.Handler.hash in com.example.Handler\n"
+	if buf.String() != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, buf.String())
+	}
+}
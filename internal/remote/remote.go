@@ -0,0 +1,129 @@
+// Package remote collects profiles from hosts without a public profiling
+// endpoint, over SSH.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// endpoints are the net/http/pprof endpoints of the profile types.
+var endpoints = map[string]string{
+	"":          "profile",
+	"cpu":       "profile",
+	"heap":      "heap",
+	"goroutine": "goroutine",
+	"block":     "block",
+	"mutex":     "mutex",
+}
+
+// PprofPath returns the path of the net/http/pprof endpoint of the profile
+// type, cpu by default, which is recorded for seconds.
+func PprofPath(profileType string, seconds int) (string, error) {
+	endpoint, ok := endpoints[profileType]
+	if !ok {
+		return "", fmt.Errorf("no pprof endpoint for %s profiles", profileType)
+	}
+	path := "/debug/pprof/" + endpoint
+	if endpoint == "profile" {
+		path += "?seconds=" + strconv.Itoa(seconds)
+	}
+	return path, nil
+}
+
+// tunnelTimeout is how long the SSH tunnel has to accept connections.
+const tunnelTimeout = 30 * time.Second
+
+// FetchSSH collects a profile of the type from the net/http/pprof endpoint
+// listening on port of the SSH host, e.g. user@host, through a tunnel of the
+// ssh command, which uses the keys, agent and config of the user.
+func FetchSSH(ctx context.Context, host string, port int, profileType string, seconds int) ([]byte, error) {
+	path, err := PprofPath(profileType, seconds)
+	if err != nil {
+		return nil, err
+	}
+	local, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "ssh", "-N", "-o", "ExitOnForwardFailure=yes", "-L", fmt.Sprintf("127.0.0.1:%d:localhost:%d", local, port), "--", host)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("ssh: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(local))
+	deadline := time.Now().Add(tunnelTimeout)
+	for {
+		if conn, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+			conn.Close()
+			break
+		}
+		select {
+		case err := <-exited:
+			return nil, fmt.Errorf("ssh %s: %v\n%s", host, err, strings.TrimSpace(stderr.String()))
+		case <-time.After(100 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("ssh %s: no tunnel after %s", host, tunnelTimeout)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s on %s: %w", path, host, err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s on %s: %s: %s", path, host, res.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// CopySSH returns the content of the file at path on the SSH host.
+func CopySSH(ctx context.Context, host, path string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "ssh", "--", host, "cat -- "+shellQuote(path))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ssh %s: %w\n%s", host, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// shellQuote quotes s for the POSIX shell running remote commands.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// freePort returns a local TCP port that is not in use.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
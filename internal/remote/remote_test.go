@@ -0,0 +1,32 @@
+package remote
+
+import "testing"
+
+func TestPprofPath(t *testing.T) {
+	tests := []struct{ profileType, want string }{
+		{"", "/debug/pprof/profile?seconds=10"},
+		{"cpu", "/debug/pprof/profile?seconds=10"},
+		{"goroutine", "/debug/pprof/goroutine"},
+	}
+	for _, tt := range tests {
+		if got, err := PprofPath(tt.profileType, 10); err != nil || got != tt.want {
+			t.Errorf("PprofPath(%q): expected %q, got %q: %v", tt.profileType, tt.want, got, err)
+		}
+	}
+	if _, err := PprofPath("wall", 10); err == nil {
+		t.Error("Expected error for wall profiles, got nil")
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"/tmp/cpu.pprof", `'/tmp/cpu.pprof'`},
+		{"it's", `'it'\''s'`},
+		{"$(rm -rf /)", `'$(rm -rf /)'`},
+	}
+	for _, tt := range tests {
+		if got := shellQuote(tt.in); got != tt.want {
+			t.Errorf("shellQuote(%q): expected %s, got %s", tt.in, tt.want, got)
+		}
+	}
+}
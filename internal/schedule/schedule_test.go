@@ -0,0 +1,64 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// a wednesday
+	now := time.Date(2024, 5, 15, 10, 30, 45, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"0 9 * * MON", "2024-05-20 09:00"},
+		{"*/15 * * * *", "2024-05-15 10:45"},
+		{"30 10 * * *", "2024-05-16 10:30"},
+		{"0 0 1 * *", "2024-06-01 00:00"},
+		{"0 9 * * mon-fri", "2024-05-16 09:00"},
+		{"0 9 * * 0", "2024-05-19 09:00"},
+		{"0 9 * * 7", "2024-05-19 09:00"},
+		{"0 12 1,20 * FRI", "2024-05-17 12:00"},
+		{"0 0 29 FEB *", "2028-02-29 00:00"},
+		{"5-10/5 * * * *", "2024-05-15 11:05"},
+		{"@weekly", "2024-05-19 00:00"},
+		{"@hourly", "2024-05-15 11:00"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(now).Format("2006-01-02 15:04"); got != tt.want {
+			t.Errorf("Next(%q): expected %s, got %s", tt.expr, tt.want, got)
+		}
+	}
+
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := s.Next(now); !next.IsZero() {
+		t.Errorf("Expected february 30 to never fire, got %s", next)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"0 9 * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * MONDAY",
+		"*/0 * * * *",
+		"10-5 * * * *",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): expected an error", expr)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Package seal encrypts the profiles, reports and previous runs pprof-adv
+// keeps at rest with AES-GCM, as profiles reveal the structure of proprietary
+// code and their labels sometimes hold personal data.
+package seal
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// KeyEnv is the environment variable holding the key, 16, 24 or 32 bytes
+// encoded in hex or base64, e.g. the output of "openssl rand -base64 32".
+const KeyEnv = "PPROF_ADV_KEY"
+
+// KeyringService is the service the key is looked up under in the keyring of
+// the user when KeyEnv is not set: with secret-tool on Linux, e.g. stored by
+// "secret-tool store --label=pprof-adv service pprof-adv", and with security
+// on macOS, e.g. "security add-generic-password -s pprof-adv -a $USER -w".
+const KeyringService = "pprof-adv"
+
+// magic starts sealed data, which tells it apart from data written before a
+// key was configured.
+var magic = []byte("pprof-adv:sealed:1\n")
+
+// ErrNoKey is returned for sealed data when no key is configured.
+var ErrNoKey = errors.New("data is encrypted, set " + KeyEnv + " or store the key in the keyring")
+
+// ErrPlaintext is returned for data that is not sealed when a key is
+// configured, unless the cipher allows plaintext.
+var ErrPlaintext = errors.New("data is not encrypted, although a key is configured")
+
+// Cipher seals and opens data with a key. A nil Cipher leaves data in the
+// clear.
+type Cipher struct {
+	aead      cipher.AEAD
+	plaintext bool
+}
+
+// New returns the cipher of an AES key of 16, 24 or 32 bytes.
+func New(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// ParseKey decodes a key encoded in hex or base64.
+func ParseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if key, err := hex.DecodeString(s); err == nil {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("key is neither hex nor base64")
+}
+
+// Load returns the cipher of the key in KeyEnv or else in the keyring of the
+// user, nil if neither has one.
+func Load() (*Cipher, error) {
+	encoded := os.Getenv(KeyEnv)
+	source := KeyEnv
+	if encoded == "" {
+		encoded, source = keyring(), "keyring"
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := ParseKey(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	c, err := New(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	return c, nil
+}
+
+// keyring returns the key of KeyringService in the keyring of the user, empty
+// if there is no keyring tool or no key.
+func keyring() string {
+	for _, args := range [][]string{
+		{"secret-tool", "lookup", "service", KeyringService},
+		{"security", "find-generic-password", "-s", KeyringService, "-w"},
+	} {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		if out, err := exec.Command(args[0], args[1:]...).Output(); err == nil {
+			return strings.TrimSpace(string(out))
+		}
+	}
+	return ""
+}
+
+// AllowPlaintext makes Open return data that is not sealed as is, e.g. to read
+// a store written before the key was configured, rather than failing with
+// ErrPlaintext.
+func (c *Cipher) AllowPlaintext() {
+	c.plaintext = true
+}
+
+// Seal encrypts the data stored under name, which is authenticated along
+// with it so that sealed objects cannot be swapped for one another.
+func (c *Cipher) Seal(name string, data []byte) ([]byte, error) {
+	if c == nil {
+		return data, nil
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(magic)+len(nonce)+len(data)+c.aead.Overhead())
+	out = append(append(out, magic...), nonce...)
+	return c.aead.Seal(out, nonce, data, []byte(name)), nil
+}
+
+// Open decrypts the data stored under name. Data that is not sealed fails
+// with ErrPlaintext, as anyone able to write to the storage could have
+// swapped it for the sealed data, unless the cipher allows plaintext or is
+// nil.
+func (c *Cipher) Open(name string, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, magic) {
+		if c != nil && !c.plaintext {
+			return nil, fmt.Errorf("%s: %w", name, ErrPlaintext)
+		}
+		return data, nil
+	}
+	if c == nil {
+		return nil, ErrNoKey
+	}
+	data = data[len(magic):]
+	if len(data) < c.aead.NonceSize() {
+		return nil, fmt.Errorf("%s: truncated encrypted data", name)
+	}
+	nonce, sealed := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, sealed, []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("%s: decrypting with the configured key: %w", name, err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,63 @@
+package seal
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSeal(t *testing.T) {
+	key, err := ParseKey("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := c.Seal("a.pprof", []byte("profile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("profile")) {
+		t.Errorf("Expected encrypted data, got %q", sealed)
+	}
+	if plain, err := c.Open("a.pprof", sealed); err != nil || string(plain) != "profile" {
+		t.Errorf("Expected profile, got %q: %v", plain, err)
+	}
+	if _, err := c.Open("b.pprof", sealed); err == nil {
+		t.Error("Expected error opening data sealed under another name, got nil")
+	}
+	if _, err := (*Cipher)(nil).Open("a.pprof", sealed); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Expected ErrNoKey without a cipher, got %v", err)
+	}
+
+	if plain, err := (*Cipher)(nil).Open("a.pprof", []byte("clear")); err != nil || string(plain) != "clear" {
+		t.Errorf("Expected clear without a cipher, got %q: %v", plain, err)
+	}
+
+	// Data in the clear is refused once a key is configured, unless allowed,
+	// e.g. for data written before the key was configured.
+	if _, err := c.Open("a.pprof", []byte("clear")); !errors.Is(err, ErrPlaintext) {
+		t.Errorf("Expected ErrPlaintext, got %v", err)
+	}
+	c.AllowPlaintext()
+	if plain, err := c.Open("a.pprof", []byte("clear")); err != nil || string(plain) != "clear" {
+		t.Errorf("Expected clear with plaintext allowed, got %q: %v", plain, err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	for _, encoded := range []string{"AAECAwQFBgcICQoLDA0ODw==", "000102030405060708090a0b0c0d0e0f\n"} {
+		if key, err := ParseKey(encoded); err != nil || len(key) != 16 || key[15] != 15 {
+			t.Errorf("ParseKey(%q): expected 16 bytes, got %v: %v", encoded, key, err)
+		}
+	}
+	if _, err := ParseKey("not a key!"); err == nil {
+		t.Error("Expected error for invalid key, got nil")
+	}
+	if _, err := New([]byte("short")); err == nil {
+		t.Error("Expected error for a 5 byte key, got nil")
+	}
+}
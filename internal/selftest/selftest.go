@@ -0,0 +1,237 @@
+package selftest
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/cgroup"
+	"github.com/kmrgirish/pprof-adv/internal/contention"
+	"github.com/kmrgirish/pprof-adv/internal/cpu"
+	"github.com/kmrgirish/pprof-adv/internal/input"
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/internal/theme"
+	"github.com/kmrgirish/pprof-adv/internal/warehouse"
+	"github.com/kmrgirish/pprof-adv/pb"
+	"github.com/kmrgirish/pprof-adv/profiler"
+	"github.com/kmrgirish/pprof-adv/report"
+)
+
+// testdata holds the fixture profiles and the golden output of every report.
+//
+//go:embed testdata
+var testdata embed.FS
+
+// fixture is a report run against a profile of the corpus.
+type fixture struct {
+	name   string // Name of the golden file, without the .golden extension
+	file   string
+	input  string
+	report func(p *pb.Profile, w io.Writer) error
+	// archive, if set, reports the whole zip archive of the file, such as a
+	// Datadog download, instead of a profile parsed as the input.
+	archive func(data []byte, w io.Writer) error
+}
+
+func cpuReport(p *pb.Profile, w io.Writer) error {
+	return cpu.Transform(p, w, pb.AnalyzeOptions{AttrCPU: true}, term.Style{})
+}
+
+func contentionReport(p *pb.Profile, w io.Writer) error {
+	return contention.Transform(p, w, 10, term.Style{})
+}
+
+// formatReport returns the report of the cpu formatter of a --format.
+func formatReport(f cpu.Formatter) func(p *pb.Profile, w io.Writer) error {
+	return func(p *pb.Profile, w io.Writer) error {
+		a, err := cpu.Analyze(p, pb.AnalyzeOptions{AttrCPU: true})
+		if err != nil {
+			return err
+		}
+		return f.Format(a, w)
+	}
+}
+
+// warehouseReport returns the report of the SQL of the warehouse of a
+// --format, stamped with the time the profile was recorded.
+func warehouseReport(d warehouse.Dialect) func(p *pb.Profile, w io.Writer) error {
+	return func(p *pb.Profile, w io.Writer) error {
+		ww, err := warehouse.NewWriter(w, d, "functions")
+		if err != nil {
+			return err
+		}
+		recorded := time.Unix(0, p.TimeNanos).UTC()
+		err = cpu.TransformRows(p, pb.AnalyzeOptions{AttrCPU: true}, "cpu", func(row report.Row) error {
+			return ww.Write(&warehouse.Record{Recorded: recorded, Source: "go-cpu.pb.gz", Row: row})
+		})
+		if cerr := ww.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+}
+
+// archiveReport reports every profile of a Datadog download as its detected
+// type, with the container limits of its metrics.json, like the report of a
+// zip archive.
+func archiveReport(data []byte, w io.Writer) error {
+	files, err := input.Profiles(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	metrics, err := input.ArchiveFile(data, "metrics.json")
+	if err != nil {
+		return err
+	}
+	values, err := profiler.ParseMetrics(metrics)
+	if err != nil {
+		return err
+	}
+	limits := cgroup.FromMetrics(values)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		profile, err := input.Parse(bytes.NewReader(files[name]), "pprof")
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", name, err)
+		}
+		types := pb.DetectTypes(profile)
+		if len(types) == 0 {
+			return fmt.Errorf("%s: unknown profile type", name)
+		}
+		typ := types[0]
+		if typ == pb.TypeBlock && strings.Contains(name, "mutex") {
+			typ = pb.TypeMutex
+		}
+
+		fmt.Fprintf(w, "== %s (%s)\n", typ, name)
+		if typ == pb.TypeBlock || typ == pb.TypeMutex {
+			err = contentionReport(profile, w)
+		} else {
+			opts := pb.AnalyzeOptions{AttrCPU: true, SampleType: pb.TypeSampleType(profile, typ)}
+			style := term.Style{}
+			if typ == pb.TypeCPU {
+				style.UsedCores = cgroup.Usage(profile)
+				limits.Write(w, style.UsedCores)
+			}
+			err = cpu.Transform(profile, w, opts, style)
+		}
+		if err != nil {
+			return fmt.Errorf("report %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+var fixtures = []fixture{
+	{name: "go-cpu", file: "go-cpu.pb.gz", input: "pprof", report: cpuReport},
+	{name: "go-cpu-uncompressed", file: "go-cpu.pb", input: "pprof", report: cpuReport},
+	{name: "go-cpu-lines", file: "go-cpu.pb.gz", input: "pprof", report: func(p *pb.Profile, w io.Writer) error {
+		return cpu.Transform(p, w, pb.AnalyzeOptions{AttrCPU: true, Granularity: pb.GranularityLine}, term.Style{})
+	}},
+	{name: "go-cpu-by-endpoint", file: "go-cpu.pb.gz", input: "pprof", report: func(p *pb.Profile, w io.Writer) error {
+		return cpu.TransformPivot(p, w, pb.AnalyzeOptions{AttrCPU: true}, "trace endpoint", "csv", term.Style{}, theme.Light)
+	}},
+	{name: "go-cpu-json", file: "go-cpu.pb.gz", input: "pprof", report: formatReport(cpu.JSON{Type: "cpu"})},
+	{name: "go-cpu-ndjson", file: "go-cpu.pb.gz", input: "pprof", report: formatReport(cpu.NDJSON{Type: "cpu"})},
+	{name: "go-cpu-tree", file: "go-cpu.pb.gz", input: "pprof", report: formatReport(cpu.Tree{Direction: cpu.TopDown})},
+	{name: "go-cpu-tree-bottomup", file: "go-cpu.pb.gz", input: "pprof", report: formatReport(cpu.Tree{Direction: cpu.BottomUp})},
+	{name: "go-cpu-html", file: "go-cpu.pb.gz", input: "pprof", report: formatReport(cpu.HTML{Title: "go-cpu.pb.gz", Theme: theme.Light})},
+	{name: "go-cpu-flamegraph", file: "go-cpu.pb.gz", input: "pprof", report: formatReport(cpu.Flamegraph{Title: "go-cpu.pb.gz", Theme: theme.Light})},
+	{name: "go-cpu-template", file: "go-cpu.pb.gz", input: "pprof", report: formatReport(cpu.Template{Template: template.Must(cpu.ParseTemplate("{{short .Name}} {{pct .SelfAttrCPU}}"))})},
+	{name: "go-cpu-clickhouse", file: "go-cpu.pb.gz", input: "pprof", report: warehouseReport(warehouse.ClickHouse)},
+	{name: "go-cpu-bq", file: "go-cpu.pb.gz", input: "pprof", report: warehouseReport(warehouse.BigQuery)},
+	{name: "go-inlined", file: "go-inlined.pb.gz", input: "pprof", report: cpuReport},
+	{name: "go-block", file: "go-block.pb.gz", input: "pprof", report: contentionReport},
+	{name: "go-mutex", file: "go-mutex.pb.gz", input: "pprof", report: contentionReport},
+	{name: "node-cpu", file: "node.cpuprofile", input: "cpuprofile", report: cpuReport},
+	{name: "perf-cpu", file: "perf.txt", input: "perf", report: cpuReport},
+	{name: "java-cpu", file: "java.jfr", input: "jfr", report: cpuReport},
+	{name: "datadog", file: "datadog.zip", archive: archiveReport},
+}
+
+// Result is the outcome of checking one fixture against its golden output.
+type Result struct {
+	Name string
+	Err  error
+}
+
+// Run renders every fixture and compares it with its golden output.
+func Run() []Result {
+	results := make([]Result, 0, len(fixtures))
+	for _, f := range fixtures {
+		results = append(results, Result{Name: f.name, Err: check(f)})
+	}
+	return results
+}
+
+// check renders the fixture and compares it with its golden output.
+func check(f fixture) error {
+	got, err := render(f)
+	if err != nil {
+		return err
+	}
+	want, err := testdata.ReadFile(path.Join("testdata", f.name+".golden"))
+	if err != nil {
+		return err
+	}
+	return diff(got, want)
+}
+
+// render runs the report of the fixture.
+func render(f fixture) ([]byte, error) {
+	data, err := testdata.ReadFile(path.Join("testdata", f.file))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if f.archive != nil {
+		if err := f.archive(data, &buf); err != nil {
+			return nil, fmt.Errorf("report %s: %w", f.file, err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	profile, err := input.Parse(bytes.NewReader(data), f.input)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", f.file, err)
+	}
+
+	if err := f.report(profile, &buf); err != nil {
+		return nil, fmt.Errorf("report %s: %w", f.file, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// diff returns an error describing the first line that differs.
+func diff(got, want []byte) error {
+	if bytes.Equal(got, want) {
+		return nil
+	}
+
+	gotLines := strings.Split(string(got), "\n")
+	wantLines := strings.Split(string(want), "\n")
+	for i := 0; i < max(len(gotLines), len(wantLines)); i++ {
+		var g, w string
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if g != w {
+			return fmt.Errorf("line %d differs:\n\tgot:  %q\n\twant: %q", i+1, g, w)
+		}
+	}
+	return fmt.Errorf("output differs")
+}
@@ -0,0 +1,31 @@
+package selftest
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+func TestGolden(t *testing.T) {
+	for _, f := range fixtures {
+		t.Run(f.name, func(t *testing.T) {
+			if *update {
+				got, err := render(f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join("testdata", f.name+".golden"), got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			if err := check(f); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Auth authenticates requests to the server. A request is allowed if it
+// carries one of the tokens, or an ID token issued by the OIDC provider.
+type Auth struct {
+	// Tokens are the accepted API tokens, sent as "Authorization: Bearer
+	// <token>" or, by Datadog profilers, as the DD-API-KEY header.
+	Tokens []string
+	// OIDC, if set, verifies bearer tokens that are not API tokens as ID
+	// tokens.
+	OIDC *OIDCVerifier
+	// Scopes restrict credentials to the profiles of some namespaces, see
+	// ParseScope. They are keyed by API token, or by email:<address> and
+	// group:<name> for the ID tokens of a verified email or of the members
+	// of a group. API tokens without scopes access every namespace, and so do ID
+	// tokens unless an email or group has scopes, when ID tokens without any
+	// are denied.
+	Scopes map[string][]Scope
+}
+
+var errUnauthenticated = errors.New("missing credentials")
+
+// authenticate returns the namespaces the request may access, or an error if
+// the request is not allowed.
+func (a *Auth) authenticate(r *http.Request) (access, error) {
+	token := r.Header.Get("DD-API-KEY")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = strings.TrimSpace(bearer)
+	}
+	if token == "" {
+		return access{}, errUnauthenticated
+	}
+
+	for _, t := range a.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			scopes := a.Scopes[t]
+			return access{all: len(scopes) == 0, scopes: scopes}, nil
+		}
+	}
+	if a.OIDC != nil && strings.Count(token, ".") == 2 {
+		claims, err := a.OIDC.Verify(r.Context(), token)
+		if err != nil {
+			return access{}, err
+		}
+		return a.claimsAccess(claims)
+	}
+	return access{}, errors.New("invalid token")
+}
+
+// claimsAccess returns the namespaces the verified claims of an ID token may
+// access: the scopes of its email, if the provider verified it, and of its
+// groups. Anyone can sign up to some providers with an email they do not own.
+func (a *Auth) claimsAccess(claims *Claims) (access, error) {
+	var scopes []Scope
+	if claims.Email != "" && claims.EmailVerified {
+		scopes = append(scopes, a.Scopes["email:"+claims.Email]...)
+	}
+	for _, group := range claims.Groups {
+		scopes = append(scopes, a.Scopes["group:"+group]...)
+	}
+	if len(scopes) > 0 {
+		return access{scopes: scopes}, nil
+	}
+	for credential := range a.Scopes {
+		if strings.HasPrefix(credential, "email:") || strings.HasPrefix(credential, "group:") {
+			return access{}, fmt.Errorf("no scope granted to the ID token of %q", claims.Subject)
+		}
+	}
+	return access{all: true}, nil
+}
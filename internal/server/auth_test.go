@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthTokens(t *testing.T) {
+	s := newTestServer(t)
+	s.Auth = &Auth{Tokens: []string{"secret"}}
+
+	for _, tt := range []struct {
+		header, value string
+		code          int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"Authorization", "Bearer wrong", http.StatusUnauthorized},
+		{"Authorization", "Bearer secret", http.StatusOK},
+		{"DD-API-KEY", "secret", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("Expected status %d with %s %q, got %d", tt.code, tt.header, tt.value, rec.Code)
+		}
+	}
+}
+
+func TestAuthOIDC(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var issuer string
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/keys"})
+		case "/keys":
+			json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key-1",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer provider.Close()
+	issuer = provider.URL
+
+	verifier, err := NewOIDCVerifier(context.Background(), issuer, "pprof-adv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t)
+	s.Auth = &Auth{OIDC: verifier}
+
+	sign := func(kid string, claims map[string]any) string {
+		header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid})
+		payload, _ := json.Marshal(claims)
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+		digest := sha256.Sum256([]byte(signed))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	for _, tt := range []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{"valid", sign("key-1", map[string]any{"iss": issuer, "aud": "pprof-adv", "exp": exp}), http.StatusOK},
+		{"audience list", sign("key-1", map[string]any{"iss": issuer, "aud": []string{"other", "pprof-adv"}, "exp": exp}), http.StatusOK},
+		{"other audience", sign("key-1", map[string]any{"iss": issuer, "aud": "other", "exp": exp}), http.StatusUnauthorized},
+		{"other issuer", sign("key-1", map[string]any{"iss": "https://example.com", "aud": "pprof-adv", "exp": exp}), http.StatusUnauthorized},
+		{"expired", sign("key-1", map[string]any{"iss": issuer, "aud": "pprof-adv", "exp": time.Now().Add(-time.Hour).Unix()}), http.StatusUnauthorized},
+		{"unknown key", sign("key-2", map[string]any{"iss": issuer, "aud": "pprof-adv", "exp": exp}), http.StatusUnauthorized},
+		{"tampered", sign("key-1", map[string]any{"iss": issuer, "aud": "pprof-adv", "exp": exp}) + "x", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("%s: Expected status %d, got %d: %s", tt.name, tt.code, rec.Code, rec.Body)
+		}
+	}
+}
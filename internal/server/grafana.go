@@ -0,0 +1,368 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/cpu"
+	"github.com/kmrgirish/pprof-adv/internal/input"
+	"github.com/kmrgirish/pprof-adv/internal/store"
+	"github.com/kmrgirish/pprof-adv/pb"
+	"github.com/kmrgirish/pprof-adv/report"
+)
+
+// The /grafana endpoints implement the API of the Grafana simple JSON
+// datasource, see https://github.com/simPod/GrafanaJsonDatasource, whose
+// targets are function names or "top" for the hottest functions of the time
+// range, valued by the attributed cpu % of every stored cpu profile, and
+// /grafana/series the same series as rows for the Infinity datasource.
+
+// grafanaTop is the number of functions of the "top" target, "top:N" sets
+// another.
+const grafanaTop = 10
+
+// grafanaSearchLimit is the number of function names /grafana/search offers.
+const grafanaSearchLimit = 100
+
+// functionsName is the name the report.Report of a profile is cached under.
+const functionsName = "functions.json"
+
+// grafanaSeries is a time series of the response of /grafana/query, its
+// datapoints are [value, unix milliseconds] pairs.
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// grafanaQuery is the request of /grafana/query.
+type grafanaQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Targets []struct {
+		Target string `json:"target"`
+	} `json:"targets"`
+	AdhocFilters []struct {
+		Key      string `json:"key"`
+		Operator string `json:"operator"`
+		Value    string `json:"value"`
+	} `json:"adhocFilters"`
+}
+
+// grafanaText is an item of the responses of /grafana/tag-keys and
+// /grafana/tag-values.
+type grafanaText struct {
+	Type string `json:"type,omitempty"`
+	Text string `json:"text"`
+}
+
+// handleGrafanaHealth answers the connection test of the datasource.
+func (s *Server) handleGrafanaHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("OK\n"))
+}
+
+// handleGrafanaSearch responds with the targets matching the searched text:
+// top and the hottest functions of the stored cpu profiles the request can
+// access.
+func (s *Server) handleGrafanaSearch(w http.ResponseWriter, r *http.Request) {
+	var search struct {
+		Target string `json:"target"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&search); err != nil {
+			http.Error(w, "invalid search: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	nodes := s.filteredReport(r).Nodes()
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		if strings.Contains(name, search.Target) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := nodes[names[i]], nodes[names[j]]
+		if a.SelfAttrCPU != b.SelfAttrCPU {
+			return a.SelfAttrCPU > b.SelfAttrCPU
+		}
+		return a.Name < b.Name
+	})
+	if len(names) > grafanaSearchLimit {
+		names = names[:grafanaSearchLimit]
+	}
+	writeJSON(w, append([]string{"top"}, names...))
+}
+
+// handleGrafanaQuery responds with the series of the targets over the stored
+// cpu profiles of the range passing the ad hoc filters.
+func (s *Server) handleGrafanaQuery(w http.ResponseWriter, r *http.Request) {
+	var query grafanaQuery
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	f := make(Filter)
+	for _, filter := range query.AdhocFilters {
+		if filter.Operator != "=" {
+			http.Error(w, fmt.Sprintf("unsupported operator %q of the filter of %s, only = is", filter.Operator, filter.Key), http.StatusBadRequest)
+			return
+		}
+		f[filter.Key] = filter.Value
+	}
+	targets := make([]string, len(query.Targets))
+	for i, target := range query.Targets {
+		targets[i] = target.Target
+	}
+
+	series, err := s.series(f, accessOf(r), query.Range.From, query.Range.To, targets)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, series)
+}
+
+// handleGrafanaTagKeys responds with the tags the ad hoc filters can use.
+func (s *Server) handleGrafanaTagKeys(w http.ResponseWriter, r *http.Request) {
+	keys := make([]grafanaText, len(NamespaceTags))
+	for i, key := range NamespaceTags {
+		keys[i] = grafanaText{Type: "string", Text: key}
+	}
+	writeJSON(w, keys)
+}
+
+// handleGrafanaTagValues responds with the values of a tag of the stored
+// profiles.
+func (s *Server) handleGrafanaTagValues(w http.ResponseWriter, r *http.Request) {
+	var tag struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&tag); err != nil {
+		http.Error(w, "invalid tag: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	entries, ok := s.list(w, r)
+	if !ok {
+		return
+	}
+	seen := make(map[string]bool)
+	values := []grafanaText{}
+	for _, entry := range entries {
+		if value := entry.Tags[tag.Key]; value != "" && !seen[value] {
+			seen[value] = true
+			values = append(values, grafanaText{Text: value})
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Text < values[j].Text })
+	writeJSON(w, values)
+}
+
+// handleGrafanaSeries responds with the series of the target query parameter,
+// top by default, as rows of time, function and attributed cpu %, for the
+// Infinity datasource. The from and to parameters are unix milliseconds, as
+// in Grafana's ${__from} and ${__to}, or RFC 3339 times.
+func (s *Server) handleGrafanaSeries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var from, to time.Time
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		value := query.Get(p.name)
+		if value == "" {
+			continue
+		}
+		t, err := parseGrafanaTime(value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid %s: %s", p.name, err), http.StatusBadRequest)
+			return
+		}
+		*p.t = t
+	}
+	target := query.Get("target")
+	if target == "" {
+		target = "top"
+	}
+
+	series, err := s.series(filterOf(query), accessOf(r), from, to, []string{target})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	type row struct {
+		Time        time.Time `json:"time"`
+		Function    string    `json:"function"`
+		AttrPercent float64   `json:"attr_percent"`
+	}
+	rows := []row{}
+	for _, serie := range series {
+		for _, point := range serie.Datapoints {
+			rows = append(rows, row{time.UnixMilli(int64(point[1])).UTC(), serie.Target, point[0]})
+		}
+	}
+	writeJSON(w, rows)
+}
+
+// parseGrafanaTime parses unix milliseconds or an RFC 3339 time.
+func parseGrafanaTime(value string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// series returns the series of the targets over the stored cpu profiles
+// received between from and to, a zero to being now, whose tags pass the
+// filter and can be accessed. A target is a function name, valued 0 in the profiles it is not in,
+// or top or top:N for the series of the N functions with the most attributed
+// cpu over the profiles.
+func (s *Server) series(f Filter, a access, from, to time.Time, targets []string) ([]grafanaSeries, error) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+	entries, err := s.store.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Received.Before(entries[j].Received) })
+
+	var reports []*report.Report
+	var times []float64
+	for _, entry := range entries {
+		if entry.Received.Before(from) || entry.Received.After(to) || !f.match(entry.Tags) || !a.allows(entry.Tags) {
+			continue
+		}
+		rep, err := s.functions(entry)
+		if err != nil {
+			log.Printf("analyzing %s for grafana: %s", entry.ID, err)
+			continue
+		}
+		if len(rep.Functions) > 0 {
+			reports = append(reports, rep)
+			times = append(times, float64(entry.Received.UnixMilli()))
+		}
+	}
+
+	var names []string
+	for _, target := range targets {
+		n, isTop, err := parseTop(target)
+		if err != nil {
+			return nil, err
+		}
+		if isTop {
+			names = append(names, topFunctions(reports, n)...)
+		} else if target != "" {
+			names = append(names, target)
+		}
+	}
+
+	series := make([]grafanaSeries, 0, len(names))
+	for _, name := range names {
+		serie := grafanaSeries{Target: name, Datapoints: make([][2]float64, len(reports))}
+		for i, rep := range reports {
+			serie.Datapoints[i] = [2]float64{attrPercent(rep, name), times[i]}
+		}
+		series = append(series, serie)
+	}
+	return series, nil
+}
+
+// parseTop parses a top or top:N target.
+func parseTop(target string) (n int, ok bool, err error) {
+	if target == "top" {
+		return grafanaTop, true, nil
+	}
+	count, found := strings.CutPrefix(target, "top:")
+	if !found {
+		return 0, false, nil
+	}
+	if n, err = strconv.Atoi(count); err != nil || n <= 0 {
+		return 0, false, fmt.Errorf("invalid target %q, expected top:N with N a positive number", target)
+	}
+	return n, true, nil
+}
+
+// topFunctions returns the n functions with the most attributed cpu summed
+// over the reports.
+func topFunctions(reports []*report.Report, n int) []string {
+	sums := make(map[string]float64)
+	for _, rep := range reports {
+		for _, fn := range rep.Functions {
+			sums[fn.Name] += fn.AttrPercent
+		}
+	}
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if sums[names[i]] != sums[names[j]] {
+			return sums[names[i]] > sums[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > n {
+		names = names[:n]
+	}
+	return names
+}
+
+// attrPercent returns the attributed cpu % of the function in the report.
+func attrPercent(rep *report.Report, name string) float64 {
+	for _, fn := range rep.Functions {
+		if fn.Name == name {
+			return fn.AttrPercent
+		}
+	}
+	return 0
+}
+
+// functions returns the report.Report of the stored profile, cached in the
+// store, which has no functions for contention profiles.
+func (s *Server) functions(entry *store.Entry) (*report.Report, error) {
+	if data, err := s.store.GetReport(entry.ID, functionsName); err == nil {
+		return report.Decode(bytes.NewReader(data))
+	} else if !errors.Is(err, store.ErrNotFound) {
+		log.Printf("reading functions: %s", err)
+	}
+
+	_, data, err := s.store.Get(entry.ID)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := input.Parse(bytes.NewReader(data), "pprof")
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if pb.IsContentionProfile(profile) {
+		err = (&report.Report{Type: "contention", Functions: []report.Function{}}).Encode(&buf)
+	} else {
+		err = cpu.TransformJSON(profile, &buf, s.analyzer.Options(), "cpu")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.PutReport(entry.ID, functionsName, buf.Bytes()); err != nil {
+		log.Printf("caching functions: %s", err)
+	}
+	return report.Decode(&buf)
+}
+
+// writeJSON responds with v as JSON.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
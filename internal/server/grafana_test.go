@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/store"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// newGrafanaServer returns a server of a cpu profile of main.hot of the api
+// service received at t0 and one of main.cold of the web service an hour
+// later.
+func newGrafanaServer(t *testing.T, t0 time.Time) *Server {
+	t.Helper()
+	st, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Put("a.pprof", map[string]string{"service": "api"}, testProfile(t, [2]string{"cpu", "nanoseconds"}, "main.hot"), "", t0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Put("b.pprof", map[string]string{"service": "web"}, testProfile(t, [2]string{"cpu", "nanoseconds"}, "main.cold"), "", t0.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	analyzer, err := pb.NewAnalyzer(pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(st, analyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestGrafanaQuery(t *testing.T) {
+	t0 := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	s := newGrafanaServer(t, t0)
+
+	if rec := do(t, s, http.MethodGet, "/grafana/", "", nil); rec.Code != http.StatusOK {
+		t.Errorf("Expected the health check to pass, got %d", rec.Code)
+	}
+
+	rec := do(t, s, http.MethodPost, "/grafana/search", "application/json", []byte(`{"target": "main.h"}`))
+	var targets []string
+	if err := json.Unmarshal(rec.Body.Bytes(), &targets); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(targets, ",") != "top,main.hot" {
+		t.Errorf("Expected top and main.hot, got %q", targets)
+	}
+
+	query := fmt.Sprintf(`{"range": {"from": %q, "to": %q}, "targets": [{"target": "main.hot"}, {"target": "top:1"}]}`,
+		t0.Add(-time.Minute).Format(time.RFC3339), t0.Add(2*time.Hour).Format(time.RFC3339))
+	rec = do(t, s, http.MethodPost, "/grafana/query", "application/json", []byte(query))
+	var series []grafanaSeries
+	if err := json.Unmarshal(rec.Body.Bytes(), &series); err != nil {
+		t.Fatalf("%s: %s", err, rec.Body.String())
+	}
+	ms := float64(t0.UnixMilli())
+	if len(series) != 2 || series[0].Target != "main.hot" || len(series[0].Datapoints) != 2 {
+		t.Fatalf("Expected main.hot and the top function over 2 profiles, got %+v", series)
+	}
+	if got := series[0].Datapoints; got[0] != [2]float64{100, ms} || got[1] != [2]float64{0, ms + 3600e3} {
+		t.Errorf("Expected main.hot at 100%% then 0%%, got %v", got)
+	}
+	// Both functions used 100% of one profile, ties are broken by name.
+	if series[1].Target != "main.cold" {
+		t.Errorf("Expected main.cold as top:1, got %s", series[1].Target)
+	}
+
+	// The ad hoc filters select the profiles of the web service.
+	query = `{"targets": [{"target": "main.cold"}], "adhocFilters": [{"key": "service", "operator": "=", "value": "web"}]}`
+	rec = do(t, s, http.MethodPost, "/grafana/query", "application/json", []byte(query))
+	series = nil
+	if err := json.Unmarshal(rec.Body.Bytes(), &series); err != nil {
+		t.Fatal(err)
+	}
+	if len(series) != 1 || len(series[0].Datapoints) != 1 || series[0].Datapoints[0][0] != 100 {
+		t.Errorf("Expected main.cold at 100%% in the web profile, got %+v", series)
+	}
+
+	rec = do(t, s, http.MethodPost, "/grafana/query", "application/json", []byte(`{"targets": [{"target": "top:x"}]}`))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid top target, got %d", rec.Code)
+	}
+}
+
+func TestGrafanaTags(t *testing.T) {
+	s := newGrafanaServer(t, time.Now())
+
+	rec := do(t, s, http.MethodPost, "/grafana/tag-keys", "application/json", nil)
+	if !strings.Contains(rec.Body.String(), `{"type":"string","text":"service"}`) {
+		t.Errorf("Expected the service tag key, got %s", rec.Body.String())
+	}
+	rec = do(t, s, http.MethodPost, "/grafana/tag-values", "application/json", []byte(`{"key": "service"}`))
+	if got := strings.TrimSpace(rec.Body.String()); got != `[{"text":"api"},{"text":"web"}]` {
+		t.Errorf("Expected the services api and web, got %s", got)
+	}
+}
+
+func TestGrafanaSeries(t *testing.T) {
+	t0 := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	s := newGrafanaServer(t, t0)
+
+	rec := do(t, s, http.MethodGet, fmt.Sprintf("/grafana/series?target=main.hot&service=api&from=%d", t0.Add(-time.Minute).UnixMilli()), "", nil)
+	if got, want := strings.TrimSpace(rec.Body.String()), `[{"time":"2026-01-02T03:00:00Z","function":"main.hot","attr_percent":100}]`; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	entries, err := s.store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.store.GetReport(entries[1].ID, functionsName); err != nil {
+		t.Errorf("Expected the functions of the api profile cached, got %s", err)
+	}
+}
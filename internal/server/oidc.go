@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwksRefreshInterval is the minimum interval between fetches of the keys of
+// the provider, which are refetched when a token is signed by an unknown key.
+const jwksRefreshInterval = time.Minute
+
+// clockSkew is the leeway given to the expiry and not before times of tokens.
+const clockSkew = time.Minute
+
+// OIDCVerifier verifies ID tokens issued by an OpenID Connect provider for an
+// audience, e.g. the tokens of an authenticating proxy or of
+// "gcloud auth print-identity-token". Only RS256 signed tokens are supported,
+// which all major providers issue.
+type OIDCVerifier struct {
+	issuer   string
+	audience string
+	jwksURI  string
+	client   *http.Client
+	now      func() time.Time
+
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+}
+
+// Claims are the verified claims of an ID token.
+type Claims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	Expiry    int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	Email     string   `json:"email"`
+	// EmailVerified is whether the provider verified that the subject owns
+	// the email, which only then grants the scopes of the email.
+	EmailVerified verified `json:"email_verified"`
+	Groups        []string `json:"groups"`
+}
+
+// verified is the email_verified claim, a boolean that some providers, e.g.
+// Amazon Cognito, send as a string.
+type verified bool
+
+func (v *verified) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*v = s == "true"
+		return nil
+	}
+	return json.Unmarshal(data, (*bool)(v))
+}
+
+// audience is the aud claim, which is either a string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// NewOIDCVerifier creates a verifier of tokens of the issuer for the audience,
+// usually the client id, discovering the keys of the issuer from its
+// /.well-known/openid-configuration.
+func NewOIDCVerifier(ctx context.Context, issuer, audience string) (*OIDCVerifier, error) {
+	v := &OIDCVerifier{
+		issuer:   issuer,
+		audience: audience,
+		client:   http.DefaultClient,
+		now:      time.Now,
+	}
+
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := v.get(ctx, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("discovering %s: %w", issuer, err)
+	}
+	if discovery.Issuer != issuer {
+		return nil, fmt.Errorf("discovering %s: provider reports issuer %q", issuer, discovery.Issuer)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("discovering %s: no jwks_uri", issuer)
+	}
+	v.jwksURI = discovery.JWKSURI
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Verify verifies the signature, issuer, audience and validity period of the
+// token and returns its claims.
+func (v *OIDCVerifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("token header: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("token signature: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, errors.New("invalid token signature")
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("token claims: %w", err)
+	}
+	now := v.now()
+	switch {
+	case claims.Issuer != v.issuer:
+		return nil, fmt.Errorf("token issued by %q", claims.Issuer)
+	case !claims.Audience.contains(v.audience):
+		return nil, fmt.Errorf("token not issued for %q", v.audience)
+	case now.After(time.Unix(claims.Expiry, 0).Add(clockSkew)):
+		return nil, errors.New("token expired")
+	case claims.NotBefore != 0 && now.Add(clockSkew).Before(time.Unix(claims.NotBefore, 0)):
+		return nil, errors.New("token not yet valid")
+	}
+	return &claims, nil
+}
+
+func (a audience) contains(aud string) bool {
+	for _, s := range a {
+		if s == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// key returns the key with the id, refetching the keys of the provider if it
+// is unknown, as providers rotate them.
+func (v *OIDCVerifier) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	if v.now().Sub(v.fetched) >= jwksRefreshInterval {
+		if err := v.refresh(ctx); err != nil {
+			return nil, err
+		}
+		if key, ok := v.keys[kid]; ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("token signed by unknown key %q", kid)
+}
+
+// refresh fetches the keys of the provider, v.mu must be held.
+func (v *OIDCVerifier) refresh(ctx context.Context) error {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := v.get(ctx, v.jwksURI, &jwks); err != nil {
+		return fmt.Errorf("fetching keys of %s: %w", v.issuer, err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", jwk.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	v.keys = keys
+	v.fetched = v.now()
+	return nil
+}
+
+func (v *OIDCVerifier) get(ctx context.Context, url string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a token.
+func decodeSegment(segment string, result any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
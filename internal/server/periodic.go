@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/cpu"
+	"github.com/kmrgirish/pprof-adv/internal/diff"
+	"github.com/kmrgirish/pprof-adv/internal/event"
+	"github.com/kmrgirish/pprof-adv/internal/input"
+	"github.com/kmrgirish/pprof-adv/internal/schedule"
+	"github.com/kmrgirish/pprof-adv/internal/store"
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+	"github.com/kmrgirish/pprof-adv/profiler"
+)
+
+// periodicTimeout is the timeout of fetching, analyzing and reporting a
+// profile of a periodic report.
+const periodicTimeout = 5 * time.Minute
+
+// scheduleTag is the tag of profiles stored by a periodic report, its value
+// is the source of the report.
+const scheduleTag = "schedule"
+
+// Periodic describes a report of a profile fetched on a schedule, compared to
+// the profile of the previous period.
+type Periodic struct {
+	Schedule *schedule.Schedule
+	// Source names the profiled service, e.g. "service:api env:prod".
+	Source string
+	// Tags are stored along with the profiles.
+	Tags map[string]string
+	// Fetch returns a pprof profile of the service.
+	Fetch func(ctx context.Context) ([]byte, error)
+	// Top is the number of changed functions reported.
+	Top int
+	// PostEvent, if set, posts a Datadog event summarizing every report.
+	PostEvent func(ctx context.Context, event *profiler.Event) error
+}
+
+// RunPeriodic runs the periodic report on its schedule until the context is
+// done. Failures are logged and the report is retried at the next time.
+func (s *Server) RunPeriodic(ctx context.Context, p *Periodic) {
+	for {
+		next := p.Schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Printf("schedule %q never fires", p.Schedule)
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case now := <-timer.C:
+			runCtx, cancel := context.WithTimeout(ctx, periodicTimeout)
+			entry, err := s.periodic(runCtx, p, now)
+			cancel()
+			if err != nil {
+				log.Printf("periodic report of %s: %s", p.Source, err)
+				continue
+			}
+			log.Printf("periodic report of %s: /profiles/%s", p.Source, entry.ID)
+		}
+	}
+}
+
+// periodic fetches and stores a profile and caches its report, along with the
+// changes since the last profile of the source, as the report of the stored
+// profile.
+func (s *Server) periodic(ctx context.Context, p *Periodic, now time.Time) (*store.Entry, error) {
+	data, err := p.Fetch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching profile: %w", err)
+	}
+	profile, err := input.Parse(bytes.NewReader(data), "pprof")
+	if err != nil {
+		return nil, fmt.Errorf("parsing profile: %w", err)
+	}
+	prevEntry, prev, err := s.lastPeriodic(p.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	var report bytes.Buffer
+	fmt.Fprintf(&report, "periodic report of %s at %s\n\n", p.Source, now.UTC().Format(time.RFC3339))
+	if err := cpu.Transform(profile, &report, s.analyzer.Options(), term.Style{}); err != nil {
+		return nil, fmt.Errorf("analyzing profile: %w", err)
+	}
+	if prev != nil {
+		result, err := diff.Diff(prev, profile, s.analyzer.Options())
+		if err != nil {
+			return nil, fmt.Errorf("comparing to %s: %w", prevEntry.ID, err)
+		}
+		fmt.Fprintf(&report, "\nchanges since %s (profiles/%s)\n", prevEntry.Received.UTC().Format(time.RFC3339), prevEntry.ID)
+		result.Write(&report, p.Top, term.Style{})
+	}
+
+	tags := map[string]string{scheduleTag: p.Source}
+	for key, value := range p.Tags {
+		tags[key] = value
+	}
+	entry, err := s.store.Put("periodic.pprof", tags, data, pb.Fingerprint(profile), now)
+	if err != nil {
+		return nil, fmt.Errorf("storing profile: %w", err)
+	}
+	s.aggregate(profile, tags)
+	if err := s.store.PutReport(entry.ID, reportName, report.Bytes()); err != nil {
+		return nil, fmt.Errorf("storing report: %w", err)
+	}
+
+	if p.PostEvent != nil {
+		if err := s.postPeriodic(ctx, p, profile, prevEntry, prev, now); err != nil {
+			return entry, fmt.Errorf("posting event: %w", err)
+		}
+	}
+	return entry, nil
+}
+
+// lastPeriodic returns the entry and profile of the last profile stored by
+// the periodic report of source, or nils if there is none.
+func (s *Server) lastPeriodic(source string) (*store.Entry, *pb.Profile, error) {
+	entries, err := s.store.List()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		if entry.Tags[scheduleTag] != source {
+			continue
+		}
+		_, data, err := s.store.Get(entry.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		profile, err := input.Parse(bytes.NewReader(data), "pprof")
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing previous profile %s: %w", entry.ID, err)
+		}
+		return entry, profile, nil
+	}
+	return nil, nil, nil
+}
+
+// postPeriodic posts the event of a periodic report, listing the regressions
+// since the previous profile if any.
+func (s *Server) postPeriodic(ctx context.Context, p *Periodic, profile *pb.Profile, prevEntry *store.Entry, prev *pb.Profile, now time.Time) error {
+	nodes, err := s.analyzer.AnalyzeCPU(profile)
+	if err != nil {
+		return err
+	}
+	var prevRun *event.Run
+	if prev != nil {
+		prevNodes, err := s.analyzer.AnalyzeCPU(prev)
+		if err != nil {
+			return err
+		}
+		prevRun = event.Summarize(p.Source, prevNodes, prevEntry.Received)
+	}
+
+	var tags []string
+	for key, value := range p.Tags {
+		tags = append(tags, key+":"+value)
+	}
+	sort.Strings(tags)
+	return p.PostEvent(ctx, event.Summarize(p.Source, nodes, now).Event(prevRun, p.Top, tags))
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/profiler"
+)
+
+func TestPeriodic(t *testing.T) {
+	s := newTestServer(t)
+	profiles := [][]byte{
+		testProfile(t, [2]string{"cpu", "nanoseconds"}, "main.old"),
+		testProfile(t, [2]string{"cpu", "nanoseconds"}, "main.new"),
+	}
+	var events []*profiler.Event
+	p := &Periodic{
+		Source: "service:api env:prod",
+		Tags:   map[string]string{"service": "api", "env": "prod"},
+		Fetch: func(ctx context.Context) ([]byte, error) {
+			data := profiles[0]
+			profiles = profiles[1:]
+			return data, nil
+		},
+		Top: 10,
+		PostEvent: func(ctx context.Context, e *profiler.Event) error {
+			events = append(events, e)
+			return nil
+		},
+	}
+
+	week := time.Date(2024, 5, 13, 9, 0, 0, 0, time.UTC)
+	first, err := s.periodic(context.Background(), p, week)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := s.store.GetReport(first.ID, reportName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(report), "periodic report of service:api env:prod at 2024-05-13T09:00:00Z") || strings.Contains(string(report), "changes since") {
+		t.Errorf("Expected a report without changes for the first period, got\n%s", report)
+	}
+	if first.Tags[scheduleTag] != p.Source || first.Tags["service"] != "api" {
+		t.Errorf("Expected the profile to be tagged with its source, got %v", first.Tags)
+	}
+
+	second, err := s.periodic(context.Background(), p, week.AddDate(0, 0, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = s.store.GetReport(second.ID, reportName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(report), "changes since 2024-05-13T09:00:00Z (profiles/"+first.ID+")") || !strings.Contains(string(report), "main.new") {
+		t.Errorf("Expected the changes since the first period, got\n%s", report)
+	}
+
+	if len(events) != 2 || !strings.Contains(events[1].Text, "Regressions since 2024-05-13T09:00:00Z") || !strings.Contains(events[1].Text, "main.new") {
+		t.Errorf("Expected the second event to report main.new as a regression, got %+v", events)
+	}
+	if got := strings.Join(events[1].Tags, ","); got != "source:pprof-adv,env:prod,service:api" {
+		t.Errorf("Expected the tags of the service, got %s", got)
+	}
+	if s.report.Profiles() != 2 {
+		t.Errorf("Expected both profiles to be aggregated, got %d", s.report.Profiles())
+	}
+}
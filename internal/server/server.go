@@ -0,0 +1,345 @@
+// Package server is a minimal self-hosted continuous profiling receiver: it
+// accepts profile uploads from agents or CI, keeps them in a store and serves
+// reports of them.
+package server
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/contention"
+	"github.com/kmrgirish/pprof-adv/internal/cpu"
+	"github.com/kmrgirish/pprof-adv/internal/input"
+	"github.com/kmrgirish/pprof-adv/internal/store"
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/internal/theme"
+	"github.com/kmrgirish/pprof-adv/pb"
+	"github.com/kmrgirish/pprof-adv/profiler"
+)
+
+// maxUploadSize is the maximum size of an upload request.
+const maxUploadSize = 64 << 20
+
+// forwardTimeout is the timeout of forwarding an upload to the intake.
+const forwardTimeout = 30 * time.Second
+
+// OpenAPI is the OpenAPI definition of the HTTP API of Server, which the
+// client package implements.
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+// contentionTop is the number of sites in the report of block and mutex
+// profiles.
+const contentionTop = 20
+
+// Server serves the HTTP API:
+//
+//	POST /ingest              upload pprof, gzip, Datadog zip or multipart profiles
+//	POST /profiling/v1/input  same as /ingest, the path Datadog profilers upload to
+//	GET  /                    list of stored profiles
+//	GET  /report              cpu report of all stored cpu profiles
+//	GET  /profiles/{id}       report of one profile, cached in the store
+//	GET  /profiles/{id}/raw   the profile as uploaded
+//	GET  /api/profiles        JSON list of stored profiles
+//	GET  /api/namespaces      JSON list of the namespaces of stored profiles
+//	GET  /openapi.json        OpenAPI definition of the API
+//	GET  /grafana/            health check of the Grafana simple JSON datasource
+//	POST /grafana/search      function names the datasource can chart
+//	POST /grafana/query       attributed cpu series of functions over time
+//	POST /grafana/tag-keys    tags of the ad hoc filters of the datasource
+//	POST /grafana/tag-values  values of a tag
+//	GET  /grafana/series      the series of /grafana/query as rows, for the Infinity datasource
+//
+// The lists and the cpu report only cover the profiles of the namespace of
+// the service, env and team query parameters, e.g. /report?team=payments,
+// see NamespaceTags. Every endpoint is further restricted to the namespaces
+// the credentials of the request are scoped to, see Auth.Scopes.
+type Server struct {
+	store    store.Storage
+	analyzer *pb.Analyzer
+	mux      *http.ServeMux
+
+	// mu guards the reports, replaced by Reload.
+	mu         sync.RWMutex
+	report     *pb.Report
+	namespaces *namespaces
+
+	// Forward, if set, receives a copy of every upload, for use as a bridge
+	// to the Datadog profiling intake.
+	Forward *profiler.Client
+
+	// Auth, if set, authenticates every request, as profiles reveal the
+	// structure of the code they were taken of.
+	Auth *Auth
+
+	// Theme styles the HTML pages.
+	Theme theme.Theme
+}
+
+// New creates a server for the store, ingesting the cpu profiles already in
+// it into the aggregate report.
+func New(st store.Storage, analyzer *pb.Analyzer) (*Server, error) {
+	s := &Server{
+		store:    st,
+		analyzer: analyzer,
+		mux:      http.NewServeMux(),
+	}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	s.mux.HandleFunc("POST /ingest", s.handleIngest)
+	s.mux.HandleFunc("POST /profiling/v1/input", s.handleIngest)
+	s.mux.HandleFunc("GET /{$}", s.handleIndex)
+	s.mux.HandleFunc("GET /report", s.handleReport)
+	s.mux.HandleFunc("GET /profiles/{id}", s.handleProfile)
+	s.mux.HandleFunc("GET /profiles/{id}/raw", s.handleRaw)
+	s.mux.HandleFunc("GET /api/profiles", s.handleProfiles)
+	s.mux.HandleFunc("GET /api/namespaces", s.handleNamespaces)
+	s.mux.HandleFunc("GET /openapi.json", s.handleOpenAPI)
+	s.mux.HandleFunc("GET /grafana/{$}", s.handleGrafanaHealth)
+	s.mux.HandleFunc("POST /grafana/search", s.handleGrafanaSearch)
+	s.mux.HandleFunc("POST /grafana/query", s.handleGrafanaQuery)
+	s.mux.HandleFunc("POST /grafana/tag-keys", s.handleGrafanaTagKeys)
+	s.mux.HandleFunc("POST /grafana/tag-values", s.handleGrafanaTagValues)
+	s.mux.HandleFunc("GET /grafana/series", s.handleGrafanaSeries)
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Auth != nil {
+		a, err := s.Auth.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="pprof-adv"`)
+			http.Error(w, "unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), accessKey{}, a))
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Reload rebuilds the aggregate reports from the profiles of the store, e.g.
+// after profiles were deleted from it past the retention.
+func (s *Server) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.store.List()
+	if err != nil {
+		return err
+	}
+	s.report, s.namespaces = s.analyzer.NewReport(), &namespaces{}
+	for _, entry := range entries {
+		_, data, err := s.store.Get(entry.ID)
+		if err != nil {
+			return err
+		}
+		if profile, err := input.Parse(bytes.NewReader(data), "pprof"); err == nil {
+			s.ingest(profile, entry.Tags)
+		}
+	}
+	return nil
+}
+
+// aggregate adds a cpu profile to the aggregate report and to the one of the
+// namespace of its tags, other profiles are only stored.
+func (s *Server) aggregate(profile *pb.Profile, tags map[string]string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.ingest(profile, tags)
+}
+
+// ingest is aggregate with s.mu held.
+func (s *Server) ingest(profile *pb.Profile, tags map[string]string) {
+	if !pb.IsContentionProfile(profile) {
+		s.analyzer.Ingest(s.report, profile)
+		s.analyzer.Ingest(s.namespaces.report(namespaceOf(tags), s.analyzer), profile)
+	}
+}
+
+// filteredReport returns the aggregate report of the cpu profiles passing the
+// filter of the request's query that the request can access.
+func (s *Server) filteredReport(r *http.Request) *pb.Report {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f, a := filterOf(r.URL.Query()), accessOf(r)
+	if len(f) == 0 && a.all {
+		return s.report
+	}
+	return s.namespaces.filtered(f, a, s.analyzer)
+}
+
+// handleIngest stores the uploaded profiles and responds with their entries.
+func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	in, err := readIngest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if in.tags, err = accessOf(r).admit(in.tags); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	profiles := make([]*pb.Profile, len(in.uploads))
+	for i, upload := range in.uploads {
+		if profiles[i], err = input.Parse(bytes.NewReader(upload.data), "pprof"); err != nil {
+			http.Error(w, fmt.Sprintf("%s: %s", upload.name, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	now := time.Now()
+	entries := make([]*store.Entry, 0, len(in.uploads))
+	for i, upload := range in.uploads {
+		entry, err := s.store.Put(upload.name, in.tags, upload.data, pb.Fingerprint(profiles[i]), now)
+		if err != nil {
+			log.Printf("storing %s: %s", upload.name, err)
+			http.Error(w, "failed to store profile", http.StatusInternalServerError)
+			return
+		}
+		s.aggregate(profiles[i], in.tags)
+		entries = append(entries, entry)
+	}
+	if s.Forward != nil {
+		go s.forward(in, profiles, now)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// forward uploads the profiles of an ingest request to the intake of the
+// Forward client. Failures are only logged, the profiles are already stored.
+func (s *Server) forward(in *ingest, profiles []*pb.Profile, received time.Time) {
+	upload := &profiler.Upload{Family: in.family, Tags: in.tags, Files: make(map[string][]byte, len(in.uploads))}
+	for _, u := range in.uploads {
+		upload.Files[u.name] = u.data
+	}
+	var ok bool
+	if upload.Start, upload.End, ok = pb.Period(profiles); !ok {
+		upload.Start, upload.End = received.Add(-time.Minute), received
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), forwardTimeout)
+	defer cancel()
+	if err := s.Forward.Upload(ctx, upload); err != nil {
+		log.Printf("forwarding %d profiles: %s", len(upload.Files), err)
+	}
+}
+
+// indexHTML is the template of the index page.
+//
+//go:embed index.html
+var indexHTML string
+
+var indexTemplate = template.Must(template.New("index").Parse(indexHTML))
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	entries, ok := s.list(w, r)
+	if !ok {
+		return
+	}
+
+	f := filterOf(r.URL.Query())
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	indexTemplate.Execute(w, struct {
+		Filter   Filter
+		Query    template.URL
+		Profiles int
+		Entries  []*store.Entry
+		Theme    theme.Theme
+	}{f, template.URL(f.query()), s.filteredReport(r).Profiles(), entries, s.Theme})
+}
+
+func (s *Server) handleReport(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+	if err := cpu.TransformReport(s.filteredReport(r), &buf, term.Style{}); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// reportName is the name the report of a profile is cached under.
+const reportName = "report.txt"
+
+func (s *Server) handleProfile(w http.ResponseWriter, r *http.Request) {
+	entry, data, ok := s.get(w, r)
+	if !ok {
+		return
+	}
+	if report, err := s.store.GetReport(entry.ID, reportName); err == nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(report)
+		return
+	} else if !errors.Is(err, store.ErrNotFound) {
+		log.Printf("reading report: %s", err)
+	}
+
+	profile, err := input.Parse(bytes.NewReader(data), "pprof")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if pb.IsContentionProfile(profile) {
+		err = contention.Transform(profile, &buf, contentionTop, term.Style{})
+	} else {
+		err = cpu.Transform(profile, &buf, s.analyzer.Options(), term.Style{})
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err := s.store.PutReport(entry.ID, reportName, buf.Bytes()); err != nil {
+		log.Printf("caching report: %s", err)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(OpenAPI)
+}
+
+func (s *Server) handleRaw(w http.ResponseWriter, r *http.Request) {
+	entry, data, ok := s.get(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", entry.ID+".pprof"))
+	w.Write(data)
+}
+
+// get returns the stored profile of the request's id, writing an error
+// response if there is none or the request cannot access it, which are not
+// told apart so that ids do not reveal the profiles of other namespaces.
+func (s *Server) get(w http.ResponseWriter, r *http.Request) (*store.Entry, []byte, bool) {
+	entry, data, err := s.store.Get(r.PathValue("id"))
+	if errors.Is(err, store.ErrNotFound) || err == nil && !accessOf(r).allows(entry.Tags) {
+		http.NotFound(w, r)
+		return nil, nil, false
+	} else if err != nil {
+		log.Printf("reading profile: %s", err)
+		http.Error(w, "failed to read profile", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return entry, data, true
+}
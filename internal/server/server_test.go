@@ -0,0 +1,225 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/store"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func testProfile(t *testing.T, sampleType [2]string, name string) []byte {
+	t.Helper()
+	b := pb.NewBuilder(sampleType)
+	b.AddSample([]pb.Stack{{Name: name, FileName: "main.go"}, {Name: "main.main", FileName: "main.go"}}, []int64{100}, nil)
+
+	var buf bytes.Buffer
+	if err := pb.Write(&buf, b.Profile()); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	st, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	analyzer, err := pb.NewAnalyzer(pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(st, analyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func do(t *testing.T, s *Server, method, target, contentType string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func post(t *testing.T, s *Server, target, contentType string, body []byte) []store.Entry {
+	t.Helper()
+	rec := do(t, s, http.MethodPost, target, contentType, body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var entries []store.Entry
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestIngest(t *testing.T) {
+	s := newTestServer(t)
+	cpu := testProfile(t, [2]string{"cpu", "nanoseconds"}, "main.work")
+
+	entries := post(t, s, "/ingest?name=cpu.pprof&service=api", "application/octet-stream", cpu)
+	if len(entries) != 1 || entries[0].Name != "cpu.pprof" || entries[0].Tags["service"] != "api" {
+		t.Errorf("Expected cpu.pprof tagged service:api, got %+v", entries)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	event, _ := mw.CreateFormFile("event", "event.json")
+	event.Write([]byte(`{"tags_profiler":"service:web,env:prod"}`))
+	file, _ := mw.CreateFormFile("auto.pprof", "auto.pprof")
+	file.Write(testProfile(t, [2]string{"cpu", "nanoseconds"}, "main.serve"))
+	mutex, _ := mw.CreateFormFile("mutex.pprof", "mutex.pprof")
+	mutex.Write(testProfile(t, [2]string{"delay", "nanoseconds"}, "sync.(*Mutex).Lock"))
+	mw.Close()
+
+	entries = post(t, s, "/profiling/v1/input", mw.FormDataContentType(), body.Bytes())
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %+v", entries)
+	}
+	for _, entry := range entries {
+		if entry.Tags["service"] != "web" || entry.Tags["env"] != "prod" {
+			t.Errorf("Expected tags service:web env:prod, got %v", entry.Tags)
+		}
+	}
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	f, _ := zw.Create("profiles/cpu.pprof")
+	f.Write(cpu)
+	zw.Close()
+
+	entries = post(t, s, "/ingest", "application/zip", archive.Bytes())
+	if len(entries) != 1 || entries[0].Name != "cpu.pprof" {
+		t.Errorf("Expected cpu.pprof from zip, got %+v", entries)
+	}
+
+	if s.report.Profiles() != 3 {
+		t.Errorf("Expected 3 cpu profiles in the report, got %d", s.report.Profiles())
+	}
+
+	if rec := do(t, s, http.MethodPost, "/ingest", "", []byte("not a profile")); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid profile, got %d", rec.Code)
+	}
+}
+
+func TestReports(t *testing.T) {
+	s := newTestServer(t)
+	entries := post(t, s, "/ingest", "", testProfile(t, [2]string{"cpu", "nanoseconds"}, "main.work"))
+	id := entries[0].ID
+
+	rec := do(t, s, http.MethodGet, "/", "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), id) {
+		t.Errorf("Expected index listing %s, got %d: %s", id, rec.Code, rec.Body)
+	}
+
+	for _, target := range []string{"/report", "/profiles/" + id} {
+		rec := do(t, s, http.MethodGet, target, "", nil)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "main.work") {
+			t.Errorf("Expected %s to report main.work, got %d: %s", target, rec.Code, rec.Body)
+		}
+	}
+
+	if report, err := s.store.GetReport(id, reportName); err != nil || !strings.Contains(string(report), "main.work") {
+		t.Errorf("Expected cached report of main.work, got %q: %v", report, err)
+	}
+
+	rec = do(t, s, http.MethodGet, "/profiles/"+id+"/raw", "", nil)
+	if _, err := pb.Parse(rec.Body); rec.Code != http.StatusOK || err != nil {
+		t.Errorf("Expected raw profile, got %d: %v", rec.Code, err)
+	}
+
+	if rec := do(t, s, http.MethodGet, "/profiles/missing", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+
+	// Profiles already in the store are reported after a restart.
+	restarted, err := New(s.store, s.analyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restarted.report.Profiles() != 1 {
+		t.Errorf("Expected 1 profile after restart, got %d", restarted.report.Profiles())
+	}
+}
+
+func TestReloadDropsPrunedProfiles(t *testing.T) {
+	st, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	tags := map[string]string{"service": "api"}
+	for i, received := range []time.Time{now.Add(-48 * time.Hour), now} {
+		data := testProfile(t, [2]string{"cpu", "nanoseconds"}, fmt.Sprintf("main.handler%d", i))
+		if _, err := st.Put("cpu.pprof", tags, data, fmt.Sprint(i), received); err != nil {
+			t.Fatal(err)
+		}
+	}
+	analyzer, err := pb.NewAnalyzer(pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(st, analyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.report.Profiles() != 2 {
+		t.Fatalf("Expected 2 profiles before pruning, got %d", s.report.Profiles())
+	}
+
+	if _, err := st.Prune(store.Retention{MaxAge: 24 * time.Hour}, now, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if s.report.Profiles() != 1 {
+		t.Errorf("Expected 1 profile after pruning, got %d", s.report.Profiles())
+	}
+	if profiles := s.namespaces.filtered(Filter{"service": "api"}, fullAccess, s.analyzer).Profiles(); profiles != 1 {
+		t.Errorf("Expected 1 profile of the api namespace after pruning, got %d", profiles)
+	}
+	if _, ok := s.report.Nodes()["main.handler0"]; ok {
+		t.Error("Expected the functions of the pruned profile to be dropped")
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	s := newTestServer(t)
+	rec := do(t, s, http.MethodGet, "/openapi.json", "", nil)
+	var spec struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Paths) == 0 {
+		t.Fatal("Expected paths in the OpenAPI definition")
+	}
+
+	// Every operation of the definition is routed.
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			req := httptest.NewRequest(strings.ToUpper(method), strings.ReplaceAll(path, "{id}", "missing"), nil)
+			if _, pattern := s.mux.Handler(req); pattern == "" {
+				t.Errorf("Expected a route for %s %s", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
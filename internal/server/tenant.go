@@ -0,0 +1,295 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kmrgirish/pprof-adv/internal/store"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// NamespaceTags are the tags profiles are namespaced by, so that the teams
+// sharing a server list and report their own profiles only.
+var NamespaceTags = []string{"service", "env", "team"}
+
+// Namespace is the values of the NamespaceTags of profiles, empty for the
+// tags they were uploaded without.
+type Namespace struct {
+	Service string `json:"service,omitempty"`
+	Env     string `json:"env,omitempty"`
+	Team    string `json:"team,omitempty"`
+}
+
+// namespaceOf returns the namespace of the tags of a profile.
+func namespaceOf(tags map[string]string) Namespace {
+	return Namespace{Service: tags["service"], Env: tags["env"], Team: tags["team"]}
+}
+
+// Filter selects the profiles whose tags have the values of its
+// NamespaceTags, e.g. the profiles of one team.
+type Filter map[string]string
+
+// filterOf returns the filter of the query parameters named after
+// NamespaceTags, e.g. /report?team=payments&env=prod.
+func filterOf(query url.Values) Filter {
+	f := make(Filter)
+	for _, key := range NamespaceTags {
+		if value := query.Get(key); value != "" {
+			f[key] = value
+		}
+	}
+	return f
+}
+
+// match reports whether the tags of a profile pass the filter.
+func (f Filter) match(tags map[string]string) bool {
+	for key, value := range f {
+		if tags[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// matchNamespace reports whether the profiles of a namespace pass the filter.
+func (f Filter) matchNamespace(ns Namespace) bool {
+	return f.match(map[string]string{"service": ns.Service, "env": ns.Env, "team": ns.Team})
+}
+
+// query returns the filter as query parameters.
+func (f Filter) query() string {
+	values := make(url.Values)
+	for key, value := range f {
+		values.Set(key, value)
+	}
+	return values.Encode()
+}
+
+// Scope is the values of the NamespaceTags a credential may read and upload
+// the profiles of, e.g. {"team": {"payments"}, "env": {"prod", "staging"}}. A
+// tag without values is not restricted.
+type Scope map[string][]string
+
+// ParseScope parses a credential followed by the tag:value pairs of its scope,
+// separated by spaces, the values of a tag separated by |, e.g.
+// "email:alice@example.com team:payments env:prod|staging", see Auth.Scopes.
+func ParseScope(s string) (credential string, scope Scope, err error) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 {
+		return "", nil, fmt.Errorf("expected a credential followed by tag:value pairs, got %q", s)
+	}
+	scope = make(Scope)
+	for _, field := range fields[1:] {
+		key, values, ok := strings.Cut(field, ":")
+		if !ok || values == "" {
+			return "", nil, fmt.Errorf("expected tag:value, got %q", field)
+		}
+		if !slices.Contains(NamespaceTags, key) {
+			return "", nil, fmt.Errorf("unknown tag %q, expected one of %s", key, strings.Join(NamespaceTags, ", "))
+		}
+		scope[key] = append(scope[key], strings.Split(values, "|")...)
+	}
+	return fields[0], scope, nil
+}
+
+// allows reports whether the tags of a profile are in the scope.
+func (sc Scope) allows(tags map[string]string) bool {
+	for key, values := range sc {
+		if len(values) > 0 && !slices.Contains(values, tags[key]) {
+			return false
+		}
+	}
+	return true
+}
+
+// access is the namespaces a request may read and upload profiles to: every
+// namespace if all, or those of any of the scopes.
+type access struct {
+	all    bool
+	scopes []Scope
+}
+
+// fullAccess is the access of requests to a server without Auth.
+var fullAccess = access{all: true}
+
+// accessKey is the context key of the access of a request.
+type accessKey struct{}
+
+// accessOf returns the access of an authenticated request.
+func accessOf(r *http.Request) access {
+	if a, ok := r.Context().Value(accessKey{}).(access); ok {
+		return a
+	}
+	return fullAccess
+}
+
+// allows reports whether the profile of the tags can be accessed.
+func (a access) allows(tags map[string]string) bool {
+	if a.all {
+		return true
+	}
+	for _, scope := range a.scopes {
+		if scope.allows(tags) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsNamespace reports whether the profiles of a namespace can be accessed.
+func (a access) allowsNamespace(ns Namespace) bool {
+	return a.allows(map[string]string{"service": ns.Service, "env": ns.Env, "team": ns.Team})
+}
+
+// admit returns the tags an upload is stored with, or an error if they are out
+// of the scopes. The tags a scope restricts to one value default to it, so
+// that agents scoped to a team need not tag their uploads with it.
+func (a access) admit(tags map[string]string) (map[string]string, error) {
+	if a.all {
+		return tags, nil
+	}
+	for _, scope := range a.scopes {
+		completed := make(map[string]string, len(tags))
+		maps.Copy(completed, tags)
+		for key, values := range scope {
+			if len(values) == 1 && completed[key] == "" {
+				completed[key] = values[0]
+			}
+		}
+		if scope.allows(completed) {
+			return completed, nil
+		}
+	}
+	return nil, fmt.Errorf("not allowed to upload profiles of %s", namespaceOf(tags))
+}
+
+// String returns the tags of the namespace, e.g. "service:api env:prod".
+func (ns Namespace) String() string {
+	var tags []string
+	for i, value := range []string{ns.Service, ns.Env, ns.Team} {
+		if value != "" {
+			tags = append(tags, NamespaceTags[i]+":"+value)
+		}
+	}
+	if len(tags) == 0 {
+		return "no namespace"
+	}
+	return strings.Join(tags, " ")
+}
+
+// namespaces are the aggregate reports of the cpu profiles of every
+// namespace.
+type namespaces struct {
+	mu      sync.Mutex
+	reports map[Namespace]*pb.Report
+}
+
+// report returns the aggregate report of the namespace, creating it with the
+// analyzer if needed.
+func (n *namespaces) report(ns Namespace, analyzer *pb.Analyzer) *pb.Report {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.reports == nil {
+		n.reports = make(map[Namespace]*pb.Report)
+	}
+	report := n.reports[ns]
+	if report == nil {
+		report = analyzer.NewReport()
+		n.reports[ns] = report
+	}
+	return report
+}
+
+// filtered returns the reports of the namespaces passing the filter that can
+// be accessed merged into one report.
+func (n *namespaces) filtered(f Filter, a access, analyzer *pb.Analyzer) *pb.Report {
+	n.mu.Lock()
+	var reports []*pb.Report
+	for ns, report := range n.reports {
+		if f.matchNamespace(ns) && a.allowsNamespace(ns) {
+			reports = append(reports, report)
+		}
+	}
+	n.mu.Unlock()
+
+	merged := analyzer.NewReport()
+	for _, report := range reports {
+		merged.Merge(report)
+	}
+	return merged
+}
+
+// namespaceInfo is a namespace in the response of /api/namespaces.
+type namespaceInfo struct {
+	Namespace
+	Profiles int `json:"profiles"`
+}
+
+// handleNamespaces responds with the namespaces of the stored profiles passing
+// the filter of the query, with their number of profiles.
+func (s *Server) handleNamespaces(w http.ResponseWriter, r *http.Request) {
+	entries, ok := s.list(w, r)
+	if !ok {
+		return
+	}
+	counts := make(map[Namespace]int)
+	for _, entry := range entries {
+		counts[namespaceOf(entry.Tags)]++
+	}
+	infos := make([]namespaceInfo, 0, len(counts))
+	for ns, count := range counts {
+		infos = append(infos, namespaceInfo{ns, count})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		a, b := infos[i].Namespace, infos[j].Namespace
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		if a.Env != b.Env {
+			return a.Env < b.Env
+		}
+		return a.Team < b.Team
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(infos)
+}
+
+// handleProfiles responds with the entries of the stored profiles passing the
+// filter of the query, most recent first.
+func (s *Server) handleProfiles(w http.ResponseWriter, r *http.Request) {
+	entries, ok := s.list(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// list returns the entries of the stored profiles passing the filter of the
+// request's query that the request can access, writing an error response if
+// they cannot be listed.
+func (s *Server) list(w http.ResponseWriter, r *http.Request) ([]*store.Entry, bool) {
+	entries, err := s.store.List()
+	if err != nil {
+		log.Printf("listing profiles: %s", err)
+		http.Error(w, "failed to list profiles", http.StatusInternalServerError)
+		return nil, false
+	}
+	f, a := filterOf(r.URL.Query()), accessOf(r)
+	filtered := make([]*store.Entry, 0, len(entries))
+	for _, entry := range entries {
+		if f.match(entry.Tags) && a.allows(entry.Tags) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered, true
+}
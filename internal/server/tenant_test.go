@@ -0,0 +1,205 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/internal/store"
+)
+
+func TestNamespaces(t *testing.T) {
+	s := newTestServer(t)
+	post(t, s, "/ingest?service=api&env=prod&team=payments", "", testProfile(t, [2]string{"cpu", "nanoseconds"}, "main.charge"))
+	post(t, s, "/ingest?service=api&env=staging&team=payments", "", testProfile(t, [2]string{"cpu", "nanoseconds"}, "main.refund"))
+	post(t, s, "/ingest?service=web&env=prod&team=frontend", "", testProfile(t, [2]string{"cpu", "nanoseconds"}, "main.render"))
+
+	rec := do(t, s, http.MethodGet, "/report?team=payments", "", nil)
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "main.charge") || !strings.Contains(body, "main.refund") || strings.Contains(body, "main.render") {
+		t.Errorf("Expected the report of the payments team only, got %d: %s", rec.Code, body)
+	}
+	rec = do(t, s, http.MethodGet, "/report?team=payments&env=prod", "", nil)
+	if body := rec.Body.String(); !strings.Contains(body, "main.charge") || strings.Contains(body, "main.refund") {
+		t.Errorf("Expected the report of payments in prod only, got %s", body)
+	}
+	if rec := do(t, s, http.MethodGet, "/report?team=search", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a team without profiles, got %d", rec.Code)
+	}
+	if s.report.Profiles() != 3 {
+		t.Errorf("Expected 3 profiles in the unfiltered report, got %d", s.report.Profiles())
+	}
+
+	rec = do(t, s, http.MethodGet, "/api/profiles?env=prod", "", nil)
+	var entries []store.Entry
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Tags["env"] != "prod" || entries[1].Tags["env"] != "prod" {
+		t.Errorf("Expected the 2 profiles of prod, got %+v", entries)
+	}
+
+	rec = do(t, s, http.MethodGet, "/api/namespaces?service=api", "", nil)
+	var namespaces []namespaceInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &namespaces); err != nil {
+		t.Fatal(err)
+	}
+	want := []namespaceInfo{{Namespace{"api", "prod", "payments"}, 1}, {Namespace{"api", "staging", "payments"}, 1}}
+	if len(namespaces) != len(want) || namespaces[0] != want[0] || namespaces[1] != want[1] {
+		t.Errorf("Expected namespaces %+v, got %+v", want, namespaces)
+	}
+
+	rec = do(t, s, http.MethodGet, "/?team=frontend", "", nil)
+	if body := rec.Body.String(); !strings.Contains(body, `href="report?team=frontend"`) || !strings.Contains(body, "cpu report of all 1 cpu profiles") || strings.Contains(body, "payments") {
+		t.Errorf("Expected the index of the frontend team, got %s", body)
+	}
+
+	// Namespaces are restored from the store after a restart.
+	restarted, err := New(s.store, s.analyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profiles := restarted.namespaces.filtered(Filter{"service": "api"}, fullAccess, restarted.analyzer).Profiles(); profiles != 2 {
+		t.Errorf("Expected 2 profiles of api after restart, got %d", profiles)
+	}
+}
+
+// doAs sends a request authenticated with the token.
+func doAs(t *testing.T, s *Server, token, method, target string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestScopes(t *testing.T) {
+	s := newTestServer(t)
+	s.Auth = &Auth{
+		Tokens: []string{"admin", "payments", "frontend"},
+		Scopes: map[string][]Scope{
+			"payments": {{"team": {"payments"}}},
+			"frontend": {{"team": {"frontend"}, "env": {"prod", "staging"}}},
+		},
+	}
+	cpu := func(name string) []byte { return testProfile(t, [2]string{"cpu", "nanoseconds"}, name) }
+
+	// The team of a token restricted to one defaults to it.
+	rec := doAs(t, s, "payments", http.MethodPost, "/ingest?service=api&env=prod", cpu("main.charge"))
+	var entries []store.Entry
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); rec.Code != http.StatusOK || err != nil {
+		t.Fatalf("Expected the upload of payments to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+	if len(entries) != 1 || entries[0].Tags["team"] != "payments" {
+		t.Errorf("Expected the upload tagged team:payments, got %+v", entries)
+	}
+	payments := entries[0].ID
+
+	if rec := doAs(t, s, "frontend", http.MethodPost, "/ingest?service=web&env=prod", cpu("main.render")); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the upload of frontend to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+	for _, tt := range []struct{ token, target string }{
+		{"payments", "/ingest?service=api&team=frontend"},
+		{"frontend", "/ingest?service=web&env=dev"},
+		{"frontend", "/ingest?service=web"}, // env is not defaulted among two
+	} {
+		if rec := doAs(t, s, tt.token, http.MethodPost, tt.target, cpu("main.sneak")); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403 for %s uploading to %s, got %d: %s", tt.token, tt.target, rec.Code, rec.Body)
+		}
+	}
+	if s.report.Profiles() != 2 {
+		t.Fatalf("Expected 2 profiles stored, got %d", s.report.Profiles())
+	}
+
+	// The profiles of the other team are denied by every read.
+	for _, target := range []string{"/profiles/" + payments, "/profiles/" + payments + "/raw"} {
+		if rec := doAs(t, s, "frontend", http.MethodGet, target, nil); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 for frontend reading %s, got %d", target, rec.Code)
+		}
+		if rec := doAs(t, s, "payments", http.MethodGet, target, nil); rec.Code != http.StatusOK {
+			t.Errorf("Expected status 200 for payments reading %s, got %d", target, rec.Code)
+		}
+	}
+	for _, tt := range []struct{ method, target, body string }{
+		{http.MethodGet, "/", ""},
+		{http.MethodGet, "/report", ""},
+		{http.MethodGet, "/report?team=payments", ""},
+		{http.MethodGet, "/api/profiles", ""},
+		{http.MethodGet, "/api/namespaces", ""},
+		{http.MethodGet, "/grafana/series?target=top", ""},
+		{http.MethodPost, "/grafana/search", `{"target": "main."}`},
+		{http.MethodPost, "/grafana/query", `{"targets": [{"target": "top"}]}`},
+		{http.MethodPost, "/grafana/tag-values", `{"key": "team"}`},
+	} {
+		rec := doAs(t, s, "frontend", tt.method, tt.target, []byte(tt.body))
+		if body := rec.Body.String(); strings.Contains(body, "payments") || strings.Contains(body, "main.charge") || strings.Contains(body, payments) {
+			t.Errorf("Expected %s %s to hide the profiles of payments from frontend, got %d: %s", tt.method, tt.target, rec.Code, body)
+		}
+	}
+	rec = doAs(t, s, "frontend", http.MethodGet, "/grafana/series?target=main.charge", nil)
+	if body := rec.Body.String(); strings.Count(body, "attr_percent") != 1 || !strings.Contains(body, `"attr_percent":0}`) {
+		t.Errorf("Expected main.charge at 0 in the one profile of frontend, got %d: %s", rec.Code, body)
+	}
+	if rec := doAs(t, s, "frontend", http.MethodGet, "/report", nil); !strings.Contains(rec.Body.String(), "main.render") {
+		t.Errorf("Expected the report of frontend to have main.render, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// A token without scopes reads every namespace.
+	rec = doAs(t, s, "admin", http.MethodGet, "/report", nil)
+	if body := rec.Body.String(); !strings.Contains(body, "main.charge") || !strings.Contains(body, "main.render") {
+		t.Errorf("Expected the report of admin to have every team, got %d: %s", rec.Code, body)
+	}
+}
+
+func TestClaimsAccess(t *testing.T) {
+	a := &Auth{Scopes: map[string][]Scope{
+		"email:alice@example.com": {{"team": {"payments"}}},
+		"group:perf":              {{"service": {"checkout"}}},
+	}}
+	alice, err := a.claimsAccess(&Claims{Email: "alice@example.com", EmailVerified: true, Groups: []string{"perf"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for tags, want := range map[[2]string]bool{
+		{"api", "payments"}:    true,
+		{"checkout", "search"}: true,
+		{"web", "frontend"}:    false,
+	} {
+		if got := alice.allows(map[string]string{"service": tags[0], "team": tags[1]}); got != want {
+			t.Errorf("Expected alice allowed %v to service %s of team %s, got %v", want, tags[0], tags[1], got)
+		}
+	}
+	if _, err := a.claimsAccess(&Claims{Subject: "bob", Email: "bob@example.com", EmailVerified: true}); err == nil {
+		t.Error("Expected an ID token without scope denied when emails and groups have scopes, got nil")
+	}
+	if _, err := a.claimsAccess(&Claims{Subject: "mallory", Email: "alice@example.com"}); err == nil {
+		t.Error("Expected the scopes of an unverified email denied, got nil")
+	}
+	for data, want := range map[string]verified{`true`: true, `"true"`: true, `false`: false, `"false"`: false} {
+		var got verified
+		if err := json.Unmarshal([]byte(data), &got); err != nil || got != want {
+			t.Errorf("Expected email_verified %s to be %v, got %v: %v", data, want, got, err)
+		}
+	}
+	if access, err := (&Auth{}).claimsAccess(&Claims{Email: "bob@example.com"}); err != nil || !access.all {
+		t.Errorf("Expected ID tokens to access every namespace without scopes, got %+v, %v", access, err)
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	credential, scope, err := ParseScope("email:alice@example.com team:payments env:prod|staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential != "email:alice@example.com" || strings.Join(scope["team"], ",") != "payments" || strings.Join(scope["env"], ",") != "prod,staging" {
+		t.Errorf("Unexpected scope %q of %q", scope, credential)
+	}
+	for _, s := range []string{"token", "token team", "token team:", "token host:a"} {
+		if _, _, err := ParseScope(s); err == nil {
+			t.Errorf("Expected error for %q, got nil", s)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// upload is a profile file of an ingest request.
+type upload struct {
+	name string
+	data []byte
+}
+
+// ingest is the content of an ingest request.
+type ingest struct {
+	uploads []upload
+	tags    map[string]string
+	family  string // runtime the profiles were recorded from, go unless the event says otherwise
+}
+
+// readIngest returns the profiles of an ingest request and the tags they were
+// uploaded with. The body is either a pprof, possibly gzip compressed, a zip
+// archive as downloaded from Datadog, or a multipart form as uploaded by the
+// Datadog profilers, whose event.json provides the tags and family. Query
+// parameters are added as tags, e.g. /ingest?service=api&env=prod.
+func readIngest(r *http.Request) (*ingest, error) {
+	in := &ingest{tags: make(map[string]string), family: "go"}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return nil, err
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			data, err := io.ReadAll(part)
+			if err != nil {
+				return nil, err
+			}
+
+			switch name := part.FileName(); {
+			case part.FormName() == "event" || name == "event.json":
+				if err := in.readEvent(data); err != nil {
+					return nil, fmt.Errorf("event.json: %w", err)
+				}
+			case part.FormName() == "tags[]":
+				addTags(string(data), in.tags)
+			case strings.HasSuffix(name, ".pprof"):
+				in.uploads = append(in.uploads, upload{name: path.Base(name), data: data})
+			}
+		}
+	} else {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+			if in.uploads, err = zipUploads(data); err != nil {
+				return nil, err
+			}
+		} else {
+			name := r.URL.Query().Get("name")
+			if name == "" {
+				name = "profile.pprof"
+			}
+			in.uploads = append(in.uploads, upload{name: path.Base(name), data: data})
+		}
+	}
+
+	for key, values := range r.URL.Query() {
+		if key != "name" && len(values) > 0 {
+			in.tags[key] = values[0]
+		}
+	}
+
+	if len(in.uploads) == 0 {
+		return nil, errors.New("no .pprof files in upload")
+	}
+	return in, nil
+}
+
+// zipUploads returns the .pprof files of a zip archive.
+func zipUploads(data []byte) ([]upload, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	var uploads []upload
+	for _, f := range zr.File {
+		if !strings.HasSuffix(f.Name, ".pprof") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, upload{name: path.Base(f.Name), data: data})
+	}
+	return uploads, nil
+}
+
+// readEvent adds the tags and family of a Datadog profiler event.json.
+func (in *ingest) readEvent(data []byte) error {
+	var event struct {
+		Tags   string `json:"tags_profiler"`
+		Family string `json:"family"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+	addTags(event.Tags, in.tags)
+	if event.Family != "" {
+		in.family = event.Family
+	}
+	return nil
+}
+
+// addTags adds the tags of a comma separated list of key:value pairs.
+func addTags(list string, tags map[string]string) {
+	for _, tag := range strings.Split(list, ",") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(tag), ":"); ok && key != "" {
+			tags[key] = value
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Package source resolves the files named by profiles to the files of a
+// source tree.
+package source
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// Files returns the go files of the directory tree, skipping test, vendored
+// and testdata files, as slash separated relative paths.
+func Files(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if p != dir && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Resolve returns the longest of the source files that the file of a profile
+// ends with, or "" if it is none of them. Profiles name files by their
+// absolute path on the machine they were built on or by their import path
+// with -trimpath, both end with the path relative to the module root.
+// Windows paths are matched too, whatever the system.
+func Resolve(file string, files []string) string {
+	file = strings.ReplaceAll(file, `\`, "/")
+	best := ""
+	for _, rel := range files {
+		if (file == rel || strings.HasSuffix(file, "/"+rel)) && len(rel) > len(best) {
+			best = rel
+		}
+	}
+	return best
+}
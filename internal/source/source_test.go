@@ -0,0 +1,19 @@
+package source
+
+import "testing"
+
+func TestResolve(t *testing.T) {
+	files := []string{"main.go", "cmd/shop/main.go", "store/store.go"}
+	tests := []struct{ file, want string }{
+		{"/home/me/shop/cmd/shop/main.go", "cmd/shop/main.go"},
+		{"example.com/shop/main.go", "main.go"},
+		{`C:\shop\store\store.go`, "store/store.go"},
+		{"/usr/local/go/src/strings/builder.go", ""},
+		{"/home/me/shop/xstore/store.go", ""},
+	}
+	for _, tt := range tests {
+		if got := Resolve(tt.file, files); got != tt.want {
+			t.Errorf("Resolve(%q): expected %q, got %q", tt.file, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Package sqlite loads the functions, call edges and samples of an analyzed
+// profile into SQLite tables, for ad-hoc SQL over reports. Queries run in
+// process in an in-memory database of the pure Go modernc.org/sqlite driver,
+// so no sqlite3 command or cgo is needed.
+package sqlite
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/kmrgirish/pprof-adv/internal/cpu"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Schema creates the tables, whose percentages are of the total of the
+// sample type of the report like its columns.
+const Schema = `CREATE TABLE functions (
+	name TEXT, package TEXT, file TEXT, module TEXT, version TEXT,
+	self_attr REAL, self REAL, total REAL,
+	samples INTEGER, stacks INTEGER, callers INTEGER, depth REAL
+);
+CREATE TABLE edges (caller TEXT, callee TEXT, total REAL);
+CREATE TABLE samples (id INTEGER, value REAL, leaf TEXT, stack TEXT);
+`
+
+// batchSize is the number of rows per INSERT statement.
+const batchSize = 500
+
+// Script writes the SQL creating the tables of Schema and inserting the
+// functions of the analysis, the edges between the callers and callees of its
+// samples and the samples, with their stack from the root to the leaf joined
+// by semicolons. Samples dropped by the focus and ignore filters are left out.
+func Script(w io.Writer, a *cpu.Analysis) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "BEGIN;\n%s", Schema)
+
+	nodes := a.Nodes()
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rows := make([]string, len(names))
+	for i, name := range names {
+		n := nodes[name]
+		rows[i] = values(n.Name, pb.FuncPackage(n.Name), n.FileName, n.Module, n.Version, n.SelfAttrCPU, n.SelfCPU, n.TotalCPU, n.Samples, n.Stacks, n.Callers, n.Depth)
+	}
+	insert(bw, "functions", rows)
+
+	idx, err := pb.SampleTypeIndex(a.Profile, a.Options.SampleType)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, sample := range a.Profile.Sample {
+		total += sample.Value[idx]
+	}
+	scale := 0.0
+	if total != 0 {
+		scale = 100 / float64(total)
+	}
+
+	type edge struct{ caller, callee string }
+	edges := make(map[edge]float64)
+	rows = rows[:0]
+	for i, frames := range pb.Frames(a.Profile) {
+		if !pb.KeepFrames(frames, a.Options) {
+			continue
+		}
+		frames = pb.TrimFrames(frames, a.Options)
+		value := float64(a.Profile.Sample[i].Value[idx]) * scale
+		// Recursive calls count once per sample
+		seen := make(map[edge]bool)
+		for j := 1; j < len(frames); j++ {
+			e := edge{frames[j-1], frames[j]}
+			if !seen[e] {
+				seen[e] = true
+				edges[e] += value
+			}
+		}
+		leaf := ""
+		if len(frames) > 0 {
+			leaf = frames[len(frames)-1]
+		}
+		rows = append(rows, values(i+1, value, leaf, strings.Join(frames, ";")))
+	}
+	insert(bw, "samples", rows)
+
+	keys := make([]edge, 0, len(edges))
+	for e := range edges {
+		keys = append(keys, e)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].caller != keys[j].caller {
+			return keys[i].caller < keys[j].caller
+		}
+		return keys[i].callee < keys[j].callee
+	})
+	rows = rows[:0]
+	for _, e := range keys {
+		rows = append(rows, values(e.caller, e.callee, edges[e]))
+	}
+	insert(bw, "edges", rows)
+
+	bw.WriteString("COMMIT;\n")
+	return bw.Flush()
+}
+
+// insert writes the INSERT statements of the rows into the table.
+func insert(w *bufio.Writer, table string, rows []string) {
+	for len(rows) > 0 {
+		n := min(len(rows), batchSize)
+		fmt.Fprintf(w, "INSERT INTO %s VALUES\n%s;\n", table, strings.Join(rows[:n], ",\n"))
+		rows = rows[n:]
+	}
+}
+
+// values returns the SQL tuple of the values.
+func values(vs ...any) string {
+	literals := make([]string, len(vs))
+	for i, v := range vs {
+		switch v := v.(type) {
+		case string:
+			literals[i] = "'" + strings.ReplaceAll(v, "'", "''") + "'"
+		case int:
+			literals[i] = strconv.Itoa(v)
+		case float64:
+			literals[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		default:
+			panic(fmt.Sprintf("sqlite: unexpected value %T", v))
+		}
+	}
+	return "(" + strings.Join(literals, ", ") + ")"
+}
+
+// Query runs the query over an in-memory database loaded with the script,
+// writing its result to w as tab separated columns following a header, like
+// the tabs mode of the sqlite3 command: NULL is empty and whole REAL values
+// keep a trailing .0.
+func Query(ctx context.Context, script []byte, query string, w io.Writer) error {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	// Every connection has its own in-memory database
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.ExecContext(ctx, string(script)); err != nil {
+		return fmt.Errorf("loading tables: %w", err)
+	}
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString(strings.Join(columns, "\t") + "\n")
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	fields := make([]string, len(columns))
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			fields[i] = format(v)
+		}
+		bw.WriteString(strings.Join(fields, "\t") + "\n")
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// format returns the text of a value of a query result.
+func format(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case float64:
+		s := strconv.FormatFloat(v, 'g', 15, 64)
+		if v == math.Trunc(v) && !strings.ContainsAny(s, ".eIN") {
+			s += ".0"
+		}
+		return s
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,46 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/internal/cpu"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestQuery(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]pb.Stack{{Name: "github.com/org/repo/store.Get", FileName: "store.go"}, {Name: "main.main", FileName: "main.go"}}, []int64{75}, nil)
+	b.AddSample([]pb.Stack{{Name: "main.it's", FileName: "main.go"}, {Name: "main.main", FileName: "main.go"}}, []int64{25}, nil)
+	a, err := cpu.Analyze(b.Profile(), pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var script bytes.Buffer
+	if err := Script(&script, a); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"('github.com/org/repo/store.Get', 'github.com/org/repo/store', 'store.go', '', '', 75, 75, 75, 1, 1, 1, 2)",
+		"('main.it''s', 'main'",
+		"('main.main', 'github.com/org/repo/store.Get', 75)",
+		"(1, 75, 'github.com/org/repo/store.Get', 'main.main;github.com/org/repo/store.Get')",
+	} {
+		if !strings.Contains(script.String(), want) {
+			t.Errorf("Expected %s in the script, got\n%s", want, script.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := Query(context.Background(), script.Bytes(), "SELECT package, sum(self_attr) FROM functions GROUP BY package ORDER BY 2 DESC", &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "package\tsum(self_attr)\ngithub.com/org/repo/store\t75.0\nmain\t25.0\n" {
+		t.Errorf("Expected the attributed cpu by package, got %q", got)
+	}
+	if err := Query(context.Background(), script.Bytes(), "SELECT * FROM missing", &out); err == nil || !strings.Contains(err.Error(), "no such table: missing") {
+		t.Errorf("Expected an error for a missing table, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// dir is a driver keeping objects as files in a local directory.
+type dir struct {
+	path string
+	mu   sync.Mutex
+}
+
+// OpenDir opens the store in a local directory, creating it if needed.
+func OpenDir(path string) (*Store, error) {
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, err
+	}
+	return &Store{driver: &dir{path: path}}, nil
+}
+
+func (d *dir) read(key string) ([]byte, error) {
+	data, err := os.ReadFile(d.file(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// write writes the file atomically, so that readers never see partial
+// profiles.
+func (d *dir) write(key string, data []byte) error {
+	path := d.file(key)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (d *dir) list(suffix string) ([]string, error) {
+	files, err := os.ReadDir(d.path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), suffix) && !strings.HasPrefix(file.Name(), ".") {
+			keys = append(keys, file.Name())
+		}
+	}
+	return keys, nil
+}
+
+func (d *dir) remove(prefix string) error {
+	if prefix == "" {
+		return errors.New("refusing to remove every object of the store")
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	parent, base := path.Split(prefix)
+	files, err := os.ReadDir(d.file(parent))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), base) {
+			if err := os.RemoveAll(filepath.Join(d.file(parent), file.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	if base == "" {
+		return os.Remove(d.file(parent))
+	}
+	return nil
+}
+
+func (d *dir) keys(prefix string) ([]string, error) {
+	root := d.file(path.Dir(prefix))
+	var keys []string
+	err := filepath.WalkDir(root, func(file string, entry os.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && file == root {
+			return filepath.SkipDir
+		} else if err != nil || entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			return err
+		}
+		rel, err := filepath.Rel(d.path, file)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+func (d *dir) file(key string) string {
+	return filepath.Join(d.path, filepath.FromSlash(key))
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retention bounds what a store or cache keeps, zero fields bound nothing.
+type Retention struct {
+	MaxAge  time.Duration // age of the oldest profile kept
+	MaxSize int64         // bytes the profiles kept take in total
+}
+
+// Delete deletes the profile with the id, with its metadata and reports.
+func (s *Store) Delete(id string) error {
+	if !validID(id) {
+		return ErrNotFound
+	}
+	// The metadata is removed first, as it is what List finds.
+	if err := s.driver.remove(id + ".json"); err != nil {
+		return err
+	}
+	if err := s.driver.remove(id + ".pprof"); err != nil {
+		return err
+	}
+	return s.driver.remove(reportsPrefix + id + "/")
+}
+
+// Prune deletes the profiles received before now minus the max age, then the
+// oldest ones until the rest fit in the max size, and returns their entries.
+// With dryRun it only returns them.
+func (s *Store) Prune(r Retention, now time.Time, dryRun bool) ([]*Entry, error) {
+	entries, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	sizes := make([]int64, len(entries))
+	for i, entry := range entries {
+		sizes[i] = int64(entry.Size)
+	}
+
+	var pruned []*Entry
+	for _, i := range expired(r, now, sizes, func(i int) time.Time { return entries[i].Received }) {
+		if !dryRun {
+			if err := s.Delete(entries[i].ID); err != nil {
+				return pruned, fmt.Errorf("deleting %s: %w", entries[i].ID, err)
+			}
+		}
+		pruned = append(pruned, entries[i])
+	}
+	return pruned, nil
+}
+
+// PruneDir deletes the files of a cache directory, e.g. the previous runs of
+// export-issues, modified before now minus the max age, then the oldest ones
+// until the rest fit in the max size, and returns their paths. With dryRun it
+// only returns them. A missing directory has nothing to prune.
+func PruneDir(dir string, r Retention, now time.Time, dryRun bool) ([]string, error) {
+	var paths []string
+	var times []time.Time
+	var sizes []int64
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if os.IsNotExist(err) && path == dir {
+			return filepath.SkipDir
+		} else if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		times = append(times, info.ModTime())
+		sizes = append(sizes, info.Size())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []string
+	for _, i := range expired(r, now, sizes, func(i int) time.Time { return times[i] }) {
+		if !dryRun {
+			if err := os.Remove(paths[i]); err != nil {
+				return pruned, err
+			}
+		}
+		pruned = append(pruned, paths[i])
+	}
+	return pruned, nil
+}
+
+// expired returns the indexes of the items of the sizes and times the
+// retention does not keep, oldest first.
+func expired(r Retention, now time.Time, sizes []int64, at func(i int) time.Time) []int {
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return at(order[a]).Before(at(order[b])) })
+
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+	var out []int
+	for _, i := range order {
+		tooOld := r.MaxAge > 0 && now.Sub(at(i)) > r.MaxAge
+		tooBig := r.MaxSize > 0 && total > r.MaxSize
+		if !tooOld && !tooBig {
+			break
+		}
+		out = append(out, i)
+		total -= sizes[i]
+	}
+	return out
+}
+
+// sizeUnits are the multipliers of the units of ParseSize.
+var sizeUnits = map[string]int64{
+	"":    1,
+	"B":   1,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"KIB": 1 << 10,
+	"MIB": 1 << 20,
+	"GIB": 1 << 30,
+	"TIB": 1 << 40,
+}
+
+// ParseSize parses a size in bytes with an optional decimal or binary unit,
+// e.g. "500MB" or "2GiB".
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+	unit, ok := sizeUnits[strings.ToUpper(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 500MB or 2GiB", s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 500MB or 2GiB", s)
+	}
+	return int64(n * float64(unit)), nil
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	st, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	var ids []string
+	for i, age := range []time.Duration{60 * 24 * time.Hour, 20 * 24 * time.Hour, 10 * 24 * time.Hour, time.Hour} {
+		entry, err := st.Put("cpu.pprof", nil, make([]byte, 100+i), "", now.Add(-age))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := st.PutReport(entry.ID, "report.txt", []byte("report")); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, entry.ID)
+	}
+
+	// The profile older than 30 days, then the next oldest to fit in 250
+	// bytes.
+	r := Retention{MaxAge: 30 * 24 * time.Hour, MaxSize: 250}
+	pruned, err := st.Prune(r, now, true)
+	if err != nil || len(pruned) != 2 || pruned[0].ID != ids[0] || pruned[1].ID != ids[1] {
+		t.Fatalf("Expected %s and %s to be pruned, got %+v: %v", ids[0], ids[1], pruned, err)
+	}
+	if entries, _ := st.List(); len(entries) != 4 {
+		t.Errorf("Expected a dry run to keep 4 profiles, got %d", len(entries))
+	}
+
+	if _, err := st.Prune(r, now, false); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := st.List()
+	if err != nil || len(entries) != 2 || entries[0].ID != ids[3] || entries[1].ID != ids[2] {
+		t.Errorf("Expected %s and %s to be kept, got %+v: %v", ids[3], ids[2], entries, err)
+	}
+	if _, err := st.GetReport(ids[0], "report.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the report of a pruned profile to be deleted, got %v", err)
+	}
+}
+
+func TestPruneDir(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for name, age := range map[string]time.Duration{"old.json": 100 * 24 * time.Hour, "new.json": time.Hour} {
+		path := filepath.Join(dir, "events", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruned, err := PruneDir(dir, Retention{MaxAge: 90 * 24 * time.Hour}, now, false)
+	if err != nil || len(pruned) != 1 || filepath.Base(pruned[0]) != "old.json" {
+		t.Errorf("Expected old.json to be pruned, got %v: %v", pruned, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "events", "new.json")); err != nil {
+		t.Errorf("Expected new.json to be kept, got %v", err)
+	}
+	if pruned, err := PruneDir(filepath.Join(dir, "missing"), Retention{MaxAge: time.Hour}, now, false); err != nil || len(pruned) != 0 {
+		t.Errorf("Expected nothing to prune in a missing directory, got %v: %v", pruned, err)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"1024", 1024},
+		{"500MB", 500e6},
+		{"2GiB", 2 << 30},
+		{"1.5 kb", 1500},
+	}
+	for _, tt := range tests {
+		if got, err := ParseSize(tt.in); err != nil || got != tt.want {
+			t.Errorf("ParseSize(%q): expected %d, got %d: %v", tt.in, tt.want, got, err)
+		}
+	}
+	for _, in := range []string{"", "MB", "10 parsecs", "-1"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("Expected error for %q, got nil", in)
+		}
+	}
+}
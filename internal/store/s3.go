@@ -0,0 +1,289 @@
+package store
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3 is a driver keeping objects in an S3 bucket, or any service implementing
+// its API, under a prefix. Requests are signed with AWS signature version 4.
+type s3 struct {
+	endpoint string // url of the bucket
+	prefix   string
+	region   string
+
+	accessKey    string
+	secretKey    string
+	sessionToken string
+
+	client *http.Client
+	now    func() time.Time
+}
+
+// OpenS3 opens the store at a url "s3://bucket/prefix". The region is taken
+// from the region query parameter or AWS_REGION, credentials from
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN. The endpoint
+// query parameter selects an S3 compatible service such as MinIO, with path
+// style urls, e.g. "s3://profiles?endpoint=http://localhost:9000".
+func OpenS3(u *url.URL) (*Store, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("%s: missing bucket", u)
+	}
+	d := &s3{
+		prefix:       strings.Trim(u.Path, "/"),
+		region:       u.Query().Get("region"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		client:       http.DefaultClient,
+		now:          time.Now,
+	}
+	if d.prefix != "" {
+		d.prefix += "/"
+	}
+	if d.region == "" {
+		d.region = os.Getenv("AWS_REGION")
+	}
+	if d.region == "" {
+		d.region = "us-east-1"
+	}
+	if d.accessKey == "" || d.secretKey == "" {
+		return nil, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for s3 stores")
+	}
+
+	if endpoint := u.Query().Get("endpoint"); endpoint != "" {
+		d.endpoint = strings.TrimSuffix(endpoint, "/") + "/" + u.Host
+	} else {
+		d.endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", u.Host, d.region)
+	}
+	return &Store{driver: d}, nil
+}
+
+func (d *s3) read(key string) ([]byte, error) {
+	return d.do("GET", d.prefix+key, nil, nil)
+}
+
+func (d *s3) write(key string, data []byte) error {
+	_, err := d.do("PUT", d.prefix+key, nil, data)
+	return err
+}
+
+// listResult is the response of ListObjectsV2.
+type listResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (d *s3) list(suffix string) ([]string, error) {
+	objects, err := d.objects(d.prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, key := range objects {
+		if strings.HasSuffix(key, suffix) {
+			keys = append(keys, strings.TrimPrefix(key, d.prefix))
+		}
+	}
+	return keys, nil
+}
+
+func (d *s3) remove(prefix string) error {
+	keys, err := d.objects(d.prefix+prefix, "")
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if _, err := d.do("DELETE", key, nil, nil); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *s3) keys(prefix string) ([]string, error) {
+	objects, err := d.objects(d.prefix+prefix, "")
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(objects))
+	for i, key := range objects {
+		keys[i] = strings.TrimPrefix(key, d.prefix)
+	}
+	return keys, nil
+}
+
+// objects returns the keys of the objects with the prefix, only the ones not
+// containing the delimiter after it if it is not empty.
+func (d *s3) objects(prefix, delimiter string) ([]string, error) {
+	var keys []string
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+	for {
+		data, err := d.do("GET", "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listResult
+		if err := xml.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !result.IsTruncated {
+			return keys, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+// do sends a signed request for the object with the key, or for the bucket if
+// the key is empty, and returns the response body.
+func (d *s3) do(method, key string, query url.Values, body []byte) ([]byte, error) {
+	u, err := url.Parse(d.endpoint + "/" + escapePath(key))
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	d.sign(req, body)
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case res.StatusCode == http.StatusNotFound && key != "":
+		return nil, ErrNotFound
+	case res.StatusCode < 200 || res.StatusCode >= 300:
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", method, u.Path, res.Status, bytes.TrimSpace(data))
+	}
+	return data, nil
+}
+
+// sign adds the headers of AWS signature version 4 to the request, signing
+// its host and all headers set on it, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html.
+func (d *s3) sign(req *http.Request, body []byte) {
+	now := d.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if d.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", d.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + d.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+d.secretKey), date)
+	key = hmacSHA256(key, d.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", d.accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes the query sorted by key, with the encoding of
+// signature version 4.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// escapePath encodes an object key for the path of a url.
+func escapePath(key string) string {
+	return uriEncode(key, false)
+}
+
+// uriEncode encodes all but the unreserved characters of s, and slashes unless
+// encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,34 @@
+package store
+
+import "github.com/kmrgirish/pprof-adv/internal/seal"
+
+// sealed is a driver encrypting the objects of another driver.
+type sealed struct {
+	driver
+	cipher *seal.Cipher
+}
+
+// Encrypt encrypts the profiles, metadata and reports the store writes from
+// now on with the cipher, and reading objects written in the clear fails with
+// seal.ErrPlaintext unless the cipher allows plaintext. With a nil cipher
+// objects are written in the clear and reading encrypted ones fails with
+// seal.ErrNoKey.
+func (s *Store) Encrypt(c *seal.Cipher) {
+	s.driver = &sealed{driver: s.driver, cipher: c}
+}
+
+func (d *sealed) read(key string) ([]byte, error) {
+	data, err := d.driver.read(key)
+	if err != nil {
+		return nil, err
+	}
+	return d.cipher.Open(key, data)
+}
+
+func (d *sealed) write(key string, data []byte) error {
+	data, err := d.cipher.Seal(key, data)
+	if err != nil {
+		return err
+	}
+	return d.driver.write(key, data)
+}
@@ -0,0 +1,227 @@
+// Package store keeps uploaded profiles, the metadata they were uploaded with
+// and reports of them, on the local disk or in S3.
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned for ids that are not in the store.
+var ErrNotFound = errors.New("profile not found")
+
+// Entry describes a stored profile.
+type Entry struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"` // file name the profile was uploaded as
+	Received time.Time         `json:"received"`
+	Size     int               `json:"size"`
+	Tags     map[string]string `json:"tags,omitempty"` // e.g. service and env
+	// Fingerprint is the hash of the contents of the profile, see
+	// pb.Fingerprint, telling the same profile uploaded in other encodings
+	// or at other times apart from different ones, "" if unknown.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// Storage keeps profiles along with reports of them. Implementations are safe
+// for concurrent use by multiple goroutines.
+type Storage interface {
+	// Put stores a profile with the fingerprint of its contents.
+	Put(name string, tags map[string]string, data []byte, fingerprint string, received time.Time) (*Entry, error)
+	// Get returns the entry and data of the profile with the id, or
+	// ErrNotFound.
+	Get(id string) (*Entry, []byte, error)
+	// List returns the entries of all stored profiles, most recent first.
+	List() ([]*Entry, error)
+
+	// PutReport stores a report of the profile with the id under a name,
+	// e.g. "report.txt".
+	PutReport(id, name string, data []byte) error
+	// GetReport returns the report of the profile with the id stored under
+	// the name, or ErrNotFound.
+	GetReport(id, name string) ([]byte, error)
+}
+
+// driver is a flat namespace of objects that profiles and reports are kept in.
+type driver interface {
+	// read returns the object with the key, or ErrNotFound.
+	read(key string) ([]byte, error)
+	// write replaces the object with the key atomically.
+	write(key string, data []byte) error
+	// list returns the keys of the objects with the suffix, not including
+	// the reports.
+	list(suffix string) ([]string, error)
+	// remove deletes the objects whose keys start with the prefix.
+	remove(prefix string) error
+	// keys returns the keys of all objects starting with the prefix,
+	// including the reports.
+	keys(prefix string) ([]string, error)
+}
+
+// Store is a Storage keeping a data object, a metadata object and the reports
+// of every profile in a driver.
+type Store struct {
+	driver driver
+}
+
+var _ Storage = (*Store)(nil)
+
+// Open opens the store at a location, which is either "s3://bucket/prefix",
+// see OpenS3, or a local directory, see OpenDir.
+func Open(location string) (*Store, error) {
+	if strings.HasPrefix(location, "s3://") {
+		u, err := url.Parse(location)
+		if err != nil {
+			return nil, err
+		}
+		return OpenS3(u)
+	}
+	return OpenDir(location)
+}
+
+// Put stores a profile. The id is derived from the time and contents, so the
+// same profile uploaded twice at the same time is stored once.
+func (s *Store) Put(name string, tags map[string]string, data []byte, fingerprint string, received time.Time) (*Entry, error) {
+	sum := sha256.Sum256(data)
+	entry := &Entry{
+		ID:          received.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(sum[:4]),
+		Name:        name,
+		Received:    received,
+		Size:        len(data),
+		Tags:        tags,
+		Fingerprint: fingerprint,
+	}
+	meta, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	// The metadata is written last, as it is what List finds.
+	if err := s.driver.write(entry.ID+".pprof", data); err != nil {
+		return nil, err
+	}
+	if err := s.driver.write(entry.ID+".json", meta); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Get returns the entry and data of the profile with the id.
+func (s *Store) Get(id string) (*Entry, []byte, error) {
+	if !validID(id) {
+		return nil, nil, ErrNotFound
+	}
+	entry, err := s.entry(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := s.driver.read(id + ".pprof")
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry, data, nil
+}
+
+// List returns the entries of all stored profiles, most recent first.
+func (s *Store) List() ([]*Entry, error) {
+	keys, err := s.driver.list(".json")
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*Entry, 0, len(keys))
+	for _, key := range keys {
+		entry, err := s.entry(strings.TrimSuffix(key, ".json"))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID > entries[j].ID
+	})
+	return entries, nil
+}
+
+// PutReport stores a report of the profile with the id.
+func (s *Store) PutReport(id, name string, data []byte) error {
+	if !validID(id) || !validName(name) {
+		return fmt.Errorf("invalid report %s of %s", name, id)
+	}
+	return s.driver.write(reportKey(id, name), data)
+}
+
+// GetReport returns a report of the profile with the id.
+func (s *Store) GetReport(id, name string) ([]byte, error) {
+	if !validID(id) || !validName(name) {
+		return nil, ErrNotFound
+	}
+	return s.driver.read(reportKey(id, name))
+}
+
+// Reports returns the sorted names of the reports of the profile with the id.
+func (s *Store) Reports(id string) ([]string, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	prefix := reportsPrefix + id + "/"
+	keys, err := s.driver.keys(prefix)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if name := strings.TrimPrefix(key, prefix); validName(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *Store) entry(id string) (*Entry, error) {
+	data, err := s.driver.read(id + ".json")
+	if err != nil {
+		return nil, err
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("%s: %w", id, err)
+	}
+	return &entry, nil
+}
+
+// reportsPrefix is the prefix of the keys of reports, which keeps them out of
+// listings of profiles.
+const reportsPrefix = "reports/"
+
+func reportKey(id, name string) string {
+	return reportsPrefix + id + "/" + name
+}
+
+// validID reports whether id can be a store id, which keeps ids from the
+// network from escaping the store directory.
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// validName reports whether name can be the name of a report.
+func validName(name string) bool {
+	return name != "" && name[0] != '.' && !strings.ContainsAny(name, `/\`)
+}
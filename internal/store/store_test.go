@@ -0,0 +1,143 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/seal"
+)
+
+func TestStore(t *testing.T) {
+	st, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	a, err := st.Put("cpu.pprof", map[string]string{"service": "api"}, []byte("first"), "", first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := st.Put("mutex.pprof", nil, []byte("second"), "", first.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry, data, err := st.Get(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "first" {
+		t.Errorf("Expected data first, got %q", data)
+	}
+	if entry.Name != "cpu.pprof" || entry.Tags["service"] != "api" || entry.Size != 5 {
+		t.Errorf("Expected entry of cpu.pprof with service:api and size 5, got %+v", entry)
+	}
+
+	entries, err := st.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != b.ID || entries[1].ID != a.ID {
+		t.Errorf("Expected entries %s, %s, got %+v", b.ID, a.ID, entries)
+	}
+
+	for _, id := range []string{"missing", "../" + a.ID, ""} {
+		if _, _, err := st.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for %q, got %v", id, err)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	st, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := st.Put("cpu.pprof", nil, []byte("profile"), "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.GetReport(entry.ID, "report.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound before PutReport, got %v", err)
+	}
+	if err := st.PutReport(entry.ID, "report.txt", []byte("report")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := st.GetReport(entry.ID, "report.txt"); err != nil || string(data) != "report" {
+		t.Errorf("Expected report, got %q: %v", data, err)
+	}
+	if err := st.PutReport(entry.ID, "../escape", nil); err == nil {
+		t.Error("Expected error for report name ../escape")
+	}
+
+	// Reports are not listed as profiles.
+	if entries, err := st.List(); err != nil || len(entries) != 1 {
+		t.Errorf("Expected 1 entry, got %d: %v", len(entries), err)
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	dir := t.TempDir()
+	st, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := seal.New(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Encrypt(c)
+
+	entry, err := st.Put("cpu.pprof", map[string]string{"team": "payments"}, []byte("profile"), "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.PutReport(entry.ID, "report.txt", []byte("report")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{entry.ID + ".pprof", entry.ID + ".json", "reports/" + entry.ID + "/report.txt"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("profile")) || bytes.Contains(data, []byte("payments")) || bytes.Contains(data, []byte("report")) {
+			t.Errorf("Expected %s to be encrypted, got %q", name, data)
+		}
+	}
+
+	if got, data, err := st.Get(entry.ID); err != nil || string(data) != "profile" || got.Tags["team"] != "payments" {
+		t.Errorf("Expected the profile of payments, got %+v %q: %v", got, data, err)
+	}
+	if data, err := st.GetReport(entry.ID, "report.txt"); err != nil || string(data) != "report" {
+		t.Errorf("Expected report, got %q: %v", data, err)
+	}
+
+	// Without the key the store fails rather than serving ciphertext.
+	plain, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain.Encrypt(nil)
+	if _, _, err := plain.Get(entry.ID); !errors.Is(err, seal.ErrNoKey) {
+		t.Errorf("Expected ErrNoKey, got %v", err)
+	}
+
+	// With the key profiles stored in the clear are refused unless allowed.
+	cleared, err := plain.Put("cpu.pprof", nil, []byte("clear"), "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := st.Get(cleared.ID); !errors.Is(err, seal.ErrPlaintext) {
+		t.Errorf("Expected ErrPlaintext, got %v", err)
+	}
+	c.AllowPlaintext()
+	if _, data, err := st.Get(cleared.ID); err != nil || string(data) != "clear" {
+		t.Errorf("Expected clear with plaintext allowed, got %q: %v", data, err)
+	}
+}
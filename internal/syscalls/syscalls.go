@@ -0,0 +1,195 @@
+// Package syscalls breaks the samples of user functions down into time spent
+// in syscalls, cgo calls, the network poller and compute, telling I/O bound
+// functions from cpu bound ones.
+package syscalls
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// Category is what a sample is spent on, by the runtime frames it is in.
+type Category string
+
+const (
+	Syscall Category = "syscall"
+	Cgo     Category = "cgo"
+	Netpoll Category = "netpoll"
+	Compute Category = "compute"
+)
+
+// Categories are the categories in the order they are reported.
+var Categories = []Category{Syscall, Cgo, Netpoll, Compute}
+
+// prefixes classifies frames by the prefix of their name, the first match
+// wins.
+var prefixes = []struct {
+	prefix   string
+	category Category
+}{
+	{"syscall.Syscall", Syscall},
+	{"syscall.RawSyscall", Syscall},
+	{"syscall.syscall", Syscall},
+	{"syscall.rawSyscall", Syscall},
+	{"syscall.rawVforkSyscall", Syscall},
+	{"internal/runtime/syscall.", Syscall},
+	{"runtime/internal/syscall.", Syscall},
+	{"internal/syscall/unix.", Syscall},
+	{"golang.org/x/sys/unix.Syscall", Syscall},
+	{"golang.org/x/sys/unix.RawSyscall", Syscall},
+	{"golang.org/x/sys/unix.syscall", Syscall},
+	{"runtime.entersyscall", Syscall},
+	{"runtime.exitsyscall", Syscall},
+	{"runtime.cgocall", Cgo},
+	{"runtime.asmcgocall", Cgo},
+	{"runtime.cgocallback", Cgo},
+	{"runtime.netpoll", Netpoll},
+	{"internal/poll.runtime_poll", Netpoll},
+}
+
+// Classify returns the category of the samples in a frame, or "" if the frame
+// doesn't tell. Kernel frames are syscalls.
+func Classify(name string) Category {
+	if name == pb.KernelFrame {
+		return Syscall
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(name, p.prefix) {
+			return p.category
+		}
+	}
+	return ""
+}
+
+// Function is the breakdown of the samples of a user function, including its
+// callees.
+type Function struct {
+	Name  string
+	Total float64 // percent of the profile
+	// Shares are the percentages of Total by category.
+	Shares map[Category]float64
+}
+
+// IO returns the percentage of the function's samples not spent on compute.
+func (f *Function) IO() float64 {
+	return 100 - f.Shares[Compute]
+}
+
+// Breakdown is the breakdown of a profile.
+type Breakdown struct {
+	// Shares are the percentages of the profile by category.
+	Shares    map[Category]float64
+	Functions []*Function // by descending I/O time, then total, then name
+}
+
+// Analyze classifies every sample by its leaf-most frame with a category,
+// compute if none, and adds it to the user functions of its stack. User
+// functions are the functions of packages whose cpu is not attributed to their
+// callers, see pb.AnalyzeOptions.ShouldAttr.
+func Analyze(p *pb.Profile, opts pb.AnalyzeOptions) (*Breakdown, error) {
+	analyzer, err := pb.NewAnalyzer(opts)
+	if err != nil {
+		return nil, err
+	}
+	opts = analyzer.Options()
+	idx, err := pb.SampleTypeIndex(p, opts.SampleType)
+	if err != nil {
+		return nil, err
+	}
+
+	var total float64
+	totals := make(map[Category]float64)
+	functions := make(map[string]*Function)
+	for i, frames := range pb.Frames(p) {
+		value := float64(p.Sample[i].Value[idx])
+		if value == 0 || !pb.KeepFrames(frames, opts) {
+			continue
+		}
+		category := Compute
+		for j := len(frames) - 1; j >= 0; j-- {
+			if c := Classify(frames[j]); c != "" {
+				category = c
+				break
+			}
+		}
+		total += value
+		totals[category] += value
+
+		seen := make(map[string]bool)
+		for _, name := range frames {
+			if seen[name] || pb.FuncPackage(name) == "" || opts.ShouldAttr(name) || Classify(name) != "" {
+				continue
+			}
+			seen[name] = true
+			fn := functions[name]
+			if fn == nil {
+				fn = &Function{Name: name, Shares: make(map[Category]float64)}
+				functions[name] = fn
+			}
+			fn.Total += value
+			fn.Shares[category] += value
+		}
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("no CPU time recorded in profile")
+	}
+
+	b := &Breakdown{Shares: make(map[Category]float64)}
+	for category, value := range totals {
+		b.Shares[category] = value / total * 100
+	}
+	for _, fn := range functions {
+		for category, value := range fn.Shares {
+			fn.Shares[category] = value / fn.Total * 100
+		}
+		fn.Total = fn.Total / total * 100
+		b.Functions = append(b.Functions, fn)
+	}
+	sort.Slice(b.Functions, func(i, j int) bool {
+		a, c := b.Functions[i], b.Functions[j]
+		if ia, ic := a.Total*a.IO(), c.Total*c.IO(); ia != ic {
+			return ia > ic
+		}
+		if a.Total != c.Total {
+			return a.Total > c.Total
+		}
+		return a.Name < c.Name
+	})
+	return b, nil
+}
+
+// Transform writes the breakdown of the profile, the shares of the whole
+// profile followed by the top user functions by I/O time, one per line as
+// "total shares function", e.g. "12.00% 60.0% syscall, 40.0% compute
+// main.handler". Function names are formatted by the style.
+func Transform(pprof *pb.Profile, w io.Writer, opts pb.AnalyzeOptions, top int, style term.Style) error {
+	b, err := Analyze(pprof, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "total\t%s\n", shares(b.Shares))
+	for i, fn := range b.Functions {
+		if i == top {
+			break
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", style.Percent(fn.Total), shares(fn.Shares), style.Name(fn.Name))
+	}
+	return nil
+}
+
+// shares formats the non-zero shares of the categories.
+func shares(shares map[Category]float64) string {
+	var parts []string
+	for _, category := range Categories {
+		if shares[category] > 0 {
+			parts = append(parts, fmt.Sprintf("%.1f%% %s", shares[category], category))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,66 @@
+package syscalls
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/kmrgirish/pprof-adv/internal/term"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+func TestTransform(t *testing.T) {
+	b := pb.NewBuilder([2]string{"cpu", "nanoseconds"})
+	stack := func(names ...string) []pb.Stack {
+		var stack []pb.Stack
+		for _, name := range names {
+			stack = append(stack, pb.Stack{Name: name})
+		}
+		return stack
+	}
+	// main.handle writes a response in a syscall 60% of the time
+	b.AddSample(stack("syscall.Syscall", "os.(*File).Write", "main.handle", "main.main"), []int64{60}, nil)
+	b.AddSample(stack("main.render", "main.handle", "main.main"), []int64{30}, nil)
+	b.AddSample(stack("runtime.cgocall", "main.resize", "main.handle", "main.main"), []int64{10}, nil)
+
+	breakdown, err := Analyze(b.Profile(), pb.AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if breakdown.Shares[Syscall] != 60 || breakdown.Shares[Cgo] != 10 || breakdown.Shares[Compute] != 30 {
+		t.Errorf("Expected 60%% syscall, 10%% cgo and 30%% compute, got %v", breakdown.Shares)
+	}
+	handle := breakdown.Functions[0]
+	if handle.Name != "main.handle" || handle.Total != 100 || handle.Shares[Syscall] != 60 || handle.IO() != 70 {
+		t.Errorf("Expected main.handle 60%% in syscalls, got %+v", handle)
+	}
+
+	var buf bytes.Buffer
+	if err := Transform(b.Profile(), &buf, pb.AnalyzeOptions{}, 3, term.Style{}); err != nil {
+		t.Fatal(err)
+	}
+	want := "total\t60.0% syscall, 10.0% cgo, 30.0% compute\n" +
+		"100.00\t60.0% syscall, 10.0% cgo, 30.0% compute\tmain.handle\n" +
+		"100.00\t60.0% syscall, 10.0% cgo, 30.0% compute\tmain.main\n" +
+		"10.00\t100.0% cgo\tmain.resize\n"
+	if buf.String() != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, buf.String())
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for name, want := range map[string]Category{
+		"syscall.Syscall6":                  Syscall,
+		"internal/runtime/syscall.Syscall6": Syscall,
+		"golang.org/x/sys/unix.Syscall":     Syscall,
+		pb.KernelFrame:                      Syscall,
+		"runtime.cgocall":                   Cgo,
+		"internal/poll.runtime_pollWait":    Netpoll,
+		"runtime.netpoll":                   Netpoll,
+		"main.handle":                       "",
+		"syscall.(*RawConn).Read":           "",
+	} {
+		if got := Classify(name); got != want {
+			t.Errorf("Expected %s to be %q, got %q", name, want, got)
+		}
+	}
+}
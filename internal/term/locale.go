@@ -0,0 +1,117 @@
+package term
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Locale is how numbers are written in reports. The zero Locale writes them
+// as Go does, with a decimal point and no grouping, which other tools parse.
+type Locale struct {
+	Tag     string // BCP 47 language tag, e.g. "de-DE", "" for the zero Locale
+	Decimal string // decimal separator
+	Group   string // separator of the groups of three digits of the integer part
+}
+
+// separators are the decimal and group separators of languages, and of
+// regions whose conventions differ from the ones of their language. Groups
+// separated by spaces use no-break spaces, which spreadsheets parse.
+var separators = map[string][2]string{
+	"en": {".", ","}, "ja": {".", ","}, "zh": {".", ","}, "ko": {".", ","}, "he": {".", ","}, "th": {".", ","},
+	"de": {",", "."}, "es": {",", "."}, "it": {",", "."}, "nl": {",", "."}, "pt": {",", "."}, "da": {",", "."},
+	"id": {",", "."}, "tr": {",", "."}, "el": {",", "."}, "ro": {",", "."}, "hr": {",", "."}, "sl": {",", "."},
+	"fr": {",", "\u00a0"}, "ru": {",", "\u00a0"}, "pl": {",", "\u00a0"}, "sv": {",", "\u00a0"}, "fi": {",", "\u00a0"},
+	"nb": {",", "\u00a0"}, "no": {",", "\u00a0"}, "cs": {",", "\u00a0"}, "sk": {",", "\u00a0"}, "uk": {",", "\u00a0"},
+	"hu": {",", "\u00a0"}, "bg": {",", "\u00a0"},
+	"de-CH": {".", "\u2019"}, "it-CH": {".", "\u2019"}, "es-MX": {".", ","}, "es-US": {".", ","},
+}
+
+// ParseLocale returns the locale named by a language tag, e.g. de-DE, de_DE
+// or de_DE.UTF-8, "" or C for the zero Locale and auto for the locale of the
+// LC_ALL, LC_NUMERIC or LANG environment variables.
+func ParseLocale(name string) (Locale, error) {
+	if name == "auto" {
+		name = ""
+		for _, env := range []string{"LC_ALL", "LC_NUMERIC", "LANG"} {
+			if name = os.Getenv(env); name != "" {
+				break
+			}
+		}
+	}
+	// Drop the codeset and modifier of POSIX locale names, e.g. .UTF-8.
+	if i := strings.IndexAny(name, ".@"); i >= 0 {
+		name = name[:i]
+	}
+	if name == "" || name == "C" || name == "POSIX" {
+		return Locale{}, nil
+	}
+
+	lang, region, _ := strings.Cut(strings.ReplaceAll(name, "_", "-"), "-")
+	tag := strings.ToLower(lang)
+	if region != "" {
+		tag += "-" + strings.ToUpper(region)
+	}
+	seps, ok := separators[tag]
+	if !ok {
+		if seps, ok = separators[strings.ToLower(lang)]; !ok {
+			return Locale{}, fmt.Errorf("unknown locale %q", name)
+		}
+	}
+	return Locale{Tag: tag, Decimal: seps[0], Group: seps[1]}, nil
+}
+
+// Format formats v with prec decimals.
+func (l Locale) Format(v float64, prec int) string {
+	return l.localize(strconv.FormatFloat(v, 'f', prec, 64))
+}
+
+// FormatSigned is Format with the sign of positive numbers, e.g. for changes.
+func (l Locale) FormatSigned(v float64, prec int) string {
+	return l.localize(fmt.Sprintf("%+.*f", prec, v))
+}
+
+// FormatInt formats an integer, e.g. a count of samples.
+func (l Locale) FormatInt(v int) string {
+	return l.localize(strconv.Itoa(v))
+}
+
+// CSVComma returns the field separator of CSVs, a semicolon where the
+// decimal separator is a comma, as spreadsheets of such locales expect.
+func (l Locale) CSVComma() rune {
+	if l.Decimal == "," {
+		return ';'
+	}
+	return ','
+}
+
+// localize rewrites a number formatted by Go, optionally signed, with the
+// separators of the locale.
+func (l Locale) localize(s string) string {
+	if l.Tag == "" {
+		return s
+	}
+	sign := ""
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		sign, s = s[:1], s[1:]
+	}
+	integer, frac, hasFrac := strings.Cut(s, ".")
+	if strings.ContainsFunc(integer, func(r rune) bool { return r < '0' || r > '9' }) {
+		return sign + s // NaN or Inf
+	}
+
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(l.Group)
+		}
+		b.WriteRune(digit)
+	}
+	if hasFrac {
+		b.WriteString(l.Decimal)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
@@ -0,0 +1,59 @@
+package term
+
+import "testing"
+
+func TestParseLocale(t *testing.T) {
+	tests := []struct {
+		name string
+		want Locale
+	}{
+		{"", Locale{}},
+		{"C.UTF-8", Locale{}},
+		{"en_US.UTF-8", Locale{Tag: "en-US", Decimal: ".", Group: ","}},
+		{"de-DE", Locale{Tag: "de-DE", Decimal: ",", Group: "."}},
+		{"de_CH", Locale{Tag: "de-CH", Decimal: ".", Group: "\u2019"}},
+		{"fr", Locale{Tag: "fr", Decimal: ",", Group: "\u00a0"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseLocale(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseLocale(%q): expected %+v, got %+v", tt.name, tt.want, got)
+		}
+	}
+
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_NUMERIC", "pt_BR.UTF-8")
+	if got, err := ParseLocale("auto"); err != nil || got.Tag != "pt-BR" {
+		t.Errorf("Expected pt-BR from LC_NUMERIC, got %+v, %v", got, err)
+	}
+	if _, err := ParseLocale("xx-YY"); err == nil {
+		t.Error("Expected error for unknown locale xx-YY")
+	}
+}
+
+func TestLocaleFormat(t *testing.T) {
+	de, _ := ParseLocale("de-DE")
+	tests := []struct {
+		got, want string
+	}{
+		{Locale{}.Format(1234.5, 2), "1234.50"},
+		{de.Format(1234567.891, 2), "1.234.567,89"},
+		{de.Format(-999.5, 1), "-999,5"},
+		{de.Format(-1000, 0), "-1.000"},
+		{de.FormatSigned(12.25, 3), "+12,250"},
+		{de.FormatInt(12345), "12.345"},
+		{Style{Locale: de, SampleSize: 10000}.Percent(50), "50,00 ±0,98"},
+		{Style{Locale: de}.Delta(-1234), "-1.234,000"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("Expected %q, got %q", tt.want, tt.got)
+		}
+	}
+	if de.CSVComma() != ';' || (Locale{}).CSVComma() != ',' {
+		t.Error("Expected semicolon separated CSVs with a decimal comma only")
+	}
+}
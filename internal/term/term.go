@@ -0,0 +1,232 @@
+// Package term styles text reports for display on a terminal.
+package term
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ANSI escape sequences used for heat coloring.
+const (
+	reset  = "\x1b[0m"
+	red    = "\x1b[31m"
+	yellow = "\x1b[33m"
+	green  = "\x1b[32m"
+	dim    = "\x1b[2m"
+)
+
+// percentWidth is the column width percentages are right aligned to, followed
+// by a tab they take up one tab stop.
+const (
+	percentWidth = 6
+	tabWidth     = 8
+)
+
+// Style controls how reports are rendered, the zero Style writes the plain
+// tab separated format meant for other tools.
+type Style struct {
+	Color bool // heat color percentages with ANSI escapes
+	Align bool // right align percentages into a fixed width column
+	Width int  // truncate lines to this many columns, 0 disables truncation
+
+	ShortNames bool // trim the import path of packages from function names
+	Counts     bool // add the number of samples, distinct stacks and distinct callers of functions
+
+	// SampleSize is the number of samples percentages are estimated from
+	// when only a fraction of a profile was analyzed, which adds their 95%
+	// margin of error to them.
+	SampleSize int
+
+	// Columns are the names of the columns of function lines, see
+	// cpu.Columns, nil is the attributed cpu followed by the function.
+	Columns []string
+	// Priority is the formula of the optimization priority of functions, see
+	// cpu.ParsePriority, "" is cpu.DefaultPriority. RankByPriority ranks
+	// functions by it instead of by attributed cpu.
+	Priority       string
+	RankByPriority bool
+
+	// UsedCores is the cores the profile used on average, which turns
+	// percentages of its cpu into cores, and HostCores the cores of its host
+	// or the cpu limit of its container, which turns cores into a share of
+	// the capacity. Both are 0 when unknown.
+	UsedCores float64
+	HostCores float64
+
+	// Locale is how numbers are written, the zero Locale writes them as Go
+	// does.
+	Locale Locale
+}
+
+// Detect returns the style for writing to f: aligned, truncated to the
+// terminal width and with short function names when f is a terminal, colored unless noColor is set or the
+// NO_COLOR environment variable is non-empty (https://no-color.org).
+func Detect(f *os.File, noColor bool) Style {
+	fi, err := f.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return Style{}
+	}
+
+	return Style{
+		Color: !noColor && os.Getenv("NO_COLOR") == "",
+		Align: true,
+		Width: width(f),
+
+		ShortNames: true,
+	}
+}
+
+// width returns the number of columns of the terminal, preferring $COLUMNS.
+func width(f *os.File) int {
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		return cols
+	}
+	return windowWidth(f)
+}
+
+// Percent formats a percentage, colored by how hot it is, followed by its
+// margin of error if the style has a SampleSize.
+func (s Style) Percent(v float64) string {
+	text := s.Locale.Format(v, 2)
+	if s.Align {
+		text = fmt.Sprintf("%*s", percentWidth, text)
+	}
+	if s.Color {
+		switch {
+		case v >= 10:
+			text = red + text + reset
+		case v >= 5:
+			text = yellow + text + reset
+		case v >= 1:
+			text = green + text + reset
+		default:
+			text = dim + text + reset
+		}
+	}
+	if s.SampleSize > 0 {
+		text += " ±" + s.Locale.Format(MarginOfError(v, s.SampleSize), 2)
+	}
+	return text
+}
+
+// MarginOfError returns the half width of the 95% confidence interval of a
+// percentage estimated from n samples, approximating the samples as equally
+// weighted.
+func MarginOfError(percent float64, n int) float64 {
+	p := min(max(percent/100, 0), 1)
+	return 1.96 * math.Sqrt(p*(1-p)/float64(n)) * 100
+}
+
+// Delta formats a signed change with three decimals, red when it grew and
+// green when it shrank.
+func (s Style) Delta(v float64) string {
+	text := s.Locale.FormatSigned(v, 3)
+	if s.Align {
+		text = fmt.Sprintf("%*s", percentWidth, text)
+	}
+	switch {
+	case !s.Color || v == 0:
+		return text
+	case v > 0:
+		return red + text + reset
+	default:
+		return green + text + reset
+	}
+}
+
+// Name formats a function name for display, all reports print function names
+// through it so that they are shortened consistently.
+func (s Style) Name(name string) string {
+	if s.ShortNames {
+		return ShortName(name)
+	}
+	return name
+}
+
+// importPathRe matches the leading directories of import paths.
+var importPathRe = regexp.MustCompile(`(?:[\w.~-]+/)+`)
+
+// ShortName trims the directories of the import paths in a function name,
+// including the ones of type arguments, e.g.
+// "github.com/org/repo/internal/foo.(*Cache[github.com/org/repo/model.Item]).Get"
+// becomes "foo.(*Cache[model.Item]).Get".
+func ShortName(name string) string {
+	return importPathRe.ReplaceAllString(name, "")
+}
+
+// Function formats "name in file" so that, following a tab terminated
+// percentage column, the line fits the style's width. Type arguments of
+// generic functions are elided first, then the directories of the file, and
+// only then is the name shortened in the middle.
+func (s Style) Function(name, file string) string {
+	name = s.Name(name)
+	if s.Width <= 0 {
+		return name + " in " + file
+	}
+
+	const sep = " in "
+	avail := s.Width - tabWidth - len(sep)
+	if runes(name)+runes(file) > avail {
+		name = ElideTypeArgs(name)
+	}
+	if runes(name)+runes(file) > avail {
+		base := file[strings.LastIndex(file, "/")+1:]
+		if keep := max(avail-runes(name), runes(base)+2); runes(file) > keep {
+			file = "…" + string([]rune(file)[runes(file)-keep+1:])
+		}
+	}
+	if n := runes(name); n+runes(file) > avail {
+		keep := avail - runes(file)
+		if keep > 1 {
+			head := (keep - 1) / 2
+			tail := keep - 1 - head
+			name = string([]rune(name)[:head]) + "…" + string([]rune(name)[n-tail:])
+		}
+	}
+	return name + sep + file
+}
+
+// After returns the style of function names following n columns rather than
+// the one Function expects, its width narrowed by a tab stop for each other
+// column.
+func (s Style) After(n int) Style {
+	if s.Width > 0 && n > 1 {
+		s.Width -= (n - 1) * tabWidth
+	}
+	return s
+}
+
+// runes returns the number of columns s takes up.
+func runes(s string) int {
+	return utf8.RuneCountInString(s)
+}
+
+// ElideTypeArgs replaces the type arguments of generic functions and methods
+// with "...", e.g. "pkg.Map[go.shape.string,go.shape.int].Get" becomes
+// "pkg.Map[...].Get".
+func ElideTypeArgs(name string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range name {
+		switch {
+		case r == '[':
+			if depth == 0 {
+				b.WriteString("[...")
+			}
+			depth++
+		case r == ']' && depth > 0:
+			depth--
+			if depth == 0 {
+				b.WriteRune(r)
+			}
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
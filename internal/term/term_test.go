@@ -0,0 +1,110 @@
+package term
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		style Style
+		value float64
+		want  string
+	}{
+		{Style{}, 3.5, "3.50"},
+		{Style{Align: true}, 3.5, "  3.50"},
+		{Style{Color: true}, 12, red + "12.00" + reset},
+		{Style{Color: true}, 0.5, dim + "0.50" + reset},
+		{Style{SampleSize: 10000}, 50, "50.00 ±0.98"},
+	}
+	for _, tt := range tests {
+		if got := tt.style.Percent(tt.value); got != tt.want {
+			t.Errorf("Percent(%v) with %+v: expected %q, got %q", tt.value, tt.style, tt.want, got)
+		}
+	}
+}
+
+func TestDelta(t *testing.T) {
+	tests := []struct {
+		style Style
+		value float64
+		want  string
+	}{
+		{Style{}, 0.25, "+0.250"},
+		{Style{Align: true}, -1, "-1.000"},
+		{Style{Color: true}, 0.5, red + "+0.500" + reset},
+		{Style{Color: true}, -0.5, green + "-0.500" + reset},
+		{Style{Color: true}, 0, "+0.000"},
+	}
+	for _, tt := range tests {
+		if got := tt.style.Delta(tt.value); got != tt.want {
+			t.Errorf("Delta(%v) with %+v: expected %q, got %q", tt.value, tt.style, tt.want, got)
+		}
+	}
+}
+
+func TestElideTypeArgs(t *testing.T) {
+	got := ElideTypeArgs("pkg.Map[go.shape.string,go.shape.[]int].Get")
+	if want := "pkg.Map[...].Get"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestFunction(t *testing.T) {
+	name := "example.com/shop/cache.(*LRU[go.shape.string,go.shape.struct { Price int; Name string }]).Get"
+	file := "cache.go"
+
+	if got := (Style{}).Function(name, file); got != name+" in "+file {
+		t.Errorf("Expected untruncated line, got %q", got)
+	}
+
+	got := Style{Width: 60}.Function(name, file)
+	if want := "example.com/shop/cache.(*LRU[...]).Get in cache.go"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	got = Style{Width: 60}.Function(name, "/home/user/go/src/example.com/shop/cache/cache.go")
+	if want := "example.com/shop/cache.(*LRU[...]).Get in …/cache.go"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	got = Style{Width: 40}.Function(name, file)
+	if n := utf8.RuneCountInString(got); n != 40-tabWidth {
+		t.Errorf("Expected %d columns, got %d: %q", 40-tabWidth, n, got)
+	}
+	if !strings.Contains(got, "…") || !strings.HasSuffix(got, ".Get in cache.go") {
+		t.Errorf("Expected name shortened in the middle, got %q", got)
+	}
+}
+
+func TestAfter(t *testing.T) {
+	if got := (Style{Width: 80}).After(3).Width; got != 64 {
+		t.Errorf("Expected width 64 after 3 columns, got %d", got)
+	}
+	if got := (Style{Width: 80}).After(1).Width; got != 80 {
+		t.Errorf("Expected width 80 after 1 column, got %d", got)
+	}
+	if got := (Style{}).After(3).Width; got != 0 {
+		t.Errorf("Expected no truncation to stay disabled, got width %d", got)
+	}
+}
+
+func TestShortName(t *testing.T) {
+	tests := map[string]string{
+		"github.com/org/repo/internal/foo.Bar":                                          "foo.Bar",
+		"github.com/org/repo/internal/foo.(*Cache[github.com/org/repo/model.Item]).Get": "foo.(*Cache[model.Item]).Get",
+		"runtime.mallocgc":         "runtime.mallocgc",
+		"internal/poll.(*FD).Read": "poll.(*FD).Read",
+		"java.util.HashMap.get":    "java.util.HashMap.get",
+	}
+	for name, want := range tests {
+		if got := ShortName(name); got != want {
+			t.Errorf("ShortName(%q): expected %q, got %q", name, want, got)
+		}
+	}
+
+	if got := (Style{ShortNames: true}).Function("example.com/shop.Checkout", "shop.go"); got != "shop.Checkout in shop.go" {
+		t.Errorf("Expected short name in line, got %q", got)
+	}
+}
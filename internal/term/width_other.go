@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package term
+
+import "os"
+
+// windowWidth is not supported on this platform, lines are not truncated
+// unless $COLUMNS is set.
+func windowWidth(f *os.File) int {
+	return 0
+}
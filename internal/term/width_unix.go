@@ -0,0 +1,21 @@
+//go:build linux || darwin
+
+package term
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// windowWidth asks the terminal for its number of columns, 0 if unknown.
+func windowWidth(f *os.File) int {
+	var ws struct {
+		Row, Col, Xpixel, Ypixel uint16
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0
+	}
+	return int(ws.Col)
+}
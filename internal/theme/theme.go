@@ -0,0 +1,57 @@
+// Package theme styles the HTML and SVG reports, e.g. in dark mode so that
+// they are readable when embedded in dark portals.
+package theme
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"os"
+	"strings"
+)
+
+// Theme is the styling of a report, the zero Theme is the default light one.
+type Theme struct {
+	Name string
+	// Dark tells whether the background is dark, for the colors that are
+	// computed by reports rather than styled, such as flamegraph frames.
+	Dark bool
+	// CSS is appended to the stylesheet of reports, overriding their rules.
+	CSS template.CSS
+}
+
+// Light is the default theme of reports.
+var Light = Theme{Name: "light"}
+
+// Dark has light text on a dark background.
+var Dark = Theme{Name: "dark", Dark: true, CSS: template.CSS(darkCSS)}
+
+//go:embed dark.css
+var darkCSS string
+
+// Load returns the theme named light or dark, or the light theme with the
+// stylesheet at path appended if name ends in .css.
+func Load(name string) (Theme, error) {
+	switch {
+	case name == "" || name == Light.Name:
+		return Light, nil
+	case name == Dark.Name:
+		return Dark, nil
+	case strings.HasSuffix(name, ".css"):
+		css, err := os.ReadFile(name)
+		if err != nil {
+			return Theme{}, err
+		}
+		return Theme{Name: name, CSS: template.CSS(css)}, nil
+	}
+	return Theme{}, fmt.Errorf("unknown theme %q, expected light, dark or a .css file", name)
+}
+
+// Style returns the theme's CSS as a <style> element for outputs that are
+// not rendered from a stylesheet of their own, such as SVG images.
+func (t Theme) Style() string {
+	if t.CSS == "" {
+		return ""
+	}
+	return "<style>\n" + string(t.CSS) + "</style>\n"
+}
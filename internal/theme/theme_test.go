@@ -0,0 +1,41 @@
+package theme
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	for name, want := range map[string]Theme{"": Light, "light": Light, "dark": Dark} {
+		if got, err := Load(name); err != nil || got.Name != want.Name {
+			t.Errorf("Expected theme %s for %q, got %s: %v", want.Name, name, got.Name, err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "portal.css")
+	if err := os.WriteFile(path, []byte("body { background: #000; }\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	custom, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if custom.Dark || custom.CSS != "body { background: #000; }\n" {
+		t.Errorf("Expected the stylesheet over the light theme, got %+v", custom)
+	}
+	if style := custom.Style(); !strings.HasPrefix(style, "<style>\n") || !strings.HasSuffix(style, "</style>\n") {
+		t.Errorf("Expected a style element, got %q", style)
+	}
+	if Light.Style() != "" {
+		t.Errorf("Expected no style element for the light theme, got %q", Light.Style())
+	}
+
+	if _, err := Load("solarized"); err == nil {
+		t.Error("Expected error for unknown theme")
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.css")); err == nil {
+		t.Error("Expected error for missing stylesheet")
+	}
+}
@@ -0,0 +1,104 @@
+package update
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed semantic version, see https://semver.org.
+type semver struct {
+	core       [3]int
+	prerelease []string // dot separated identifiers after -, none for releases
+}
+
+// parseSemver parses a version such as v1.2.3, 1.2.3-rc.1 or a Go
+// pseudo-version, ignoring the build metadata after +.
+func parseSemver(v string) (semver, error) {
+	s := strings.TrimPrefix(v, "v")
+	s, _, _ = strings.Cut(s, "+")
+	core, prerelease, hasPrerelease := strings.Cut(s, "-")
+
+	var sv semver
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return semver{}, fmt.Errorf("invalid version %q, expected MAJOR.MINOR.PATCH", v)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || len(part) > 1 && part[0] == '0' {
+			return semver{}, fmt.Errorf("invalid version %q", v)
+		}
+		sv.core[i] = n
+	}
+	if hasPrerelease {
+		sv.prerelease = strings.Split(prerelease, ".")
+		for _, id := range sv.prerelease {
+			if id == "" {
+				return semver{}, fmt.Errorf("invalid version %q", v)
+			}
+		}
+	}
+	return sv, nil
+}
+
+// CompareVersions returns -1, 0 or 1 if the version a is older than, the same
+// as or newer than b by semantic versioning, e.g. v1.10.0 is newer than v1.9.2
+// and v1.0.0-rc.1 is older than v1.0.0.
+func CompareVersions(a, b string) (int, error) {
+	va, err := parseSemver(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := parseSemver(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := range va.core {
+		if c := compareInts(va.core[i], vb.core[i]); c != 0 {
+			return c, nil
+		}
+	}
+
+	// A release is newer than its prereleases.
+	switch {
+	case len(va.prerelease) == 0 && len(vb.prerelease) == 0:
+		return 0, nil
+	case len(va.prerelease) == 0:
+		return 1, nil
+	case len(vb.prerelease) == 0:
+		return -1, nil
+	}
+	for i := 0; i < len(va.prerelease) && i < len(vb.prerelease); i++ {
+		if c := compareIdentifiers(va.prerelease[i], vb.prerelease[i]); c != 0 {
+			return c, nil
+		}
+	}
+	return compareInts(len(va.prerelease), len(vb.prerelease)), nil
+}
+
+// compareIdentifiers compares prerelease identifiers: numerically if both are
+// numbers, numbers before others, and lexically otherwise.
+func compareIdentifiers(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return compareInts(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
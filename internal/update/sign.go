@@ -0,0 +1,39 @@
+package update
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// ParseSigningKey parses the PEM encoded PKCS #8 ed25519 private key releases
+// are signed with, e.g. generated by `openssl genpkey -algorithm ed25519`.
+func ParseSigningKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM encoded signing key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %w", err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key is a %T, not an ed25519 key", key)
+	}
+	return privateKey, nil
+}
+
+// PublicKey returns the base64 public key of the private key, the signingKey
+// of builds verifying the releases it signs.
+func PublicKey(key ed25519.PrivateKey) string {
+	return base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+}
+
+// Sign returns the signatureAsset of the checksums of a release.
+func Sign(key ed25519.PrivateKey, checksums []byte) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, checksums)) + "\n")
+}
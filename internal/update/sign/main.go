@@ -0,0 +1,50 @@
+// Command sign signs the checksums of a release for `pprof-adv update`, see
+// the release target of the Makefile.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alexflint/go-arg"
+
+	"github.com/kmrgirish/pprof-adv/internal/update"
+)
+
+type Cmd struct {
+	Key       string `arg:"--key,required" help:"PEM file of the ed25519 private key releases are signed with"`
+	Public    bool   `arg:"--public"       help:"print the base64 public key of --key, to build pprof-adv with, instead of signing"`
+	Checksums string `arg:"positional"     help:"checksums.txt of the release, its signature is written to stdout"`
+}
+
+func main() {
+	var cmd Cmd
+	arg.MustParse(&cmd)
+
+	data, err := os.ReadFile(cmd.Key)
+	if err != nil {
+		fail("Error reading signing key: %s", err)
+	}
+	key, err := update.ParseSigningKey(data)
+	if err != nil {
+		fail("Error parsing %s: %s", cmd.Key, err)
+	}
+	if cmd.Public {
+		fmt.Println(update.PublicKey(key))
+		return
+	}
+
+	if cmd.Checksums == "" {
+		fail("sign needs the checksums.txt to sign")
+	}
+	checksums, err := os.ReadFile(cmd.Checksums)
+	if err != nil {
+		fail("Error reading checksums: %s", err)
+	}
+	os.Stdout.Write(update.Sign(key, checksums))
+}
+
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
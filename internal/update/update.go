@@ -0,0 +1,224 @@
+package update
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// repo is the GitHub repository releases are published to.
+const repo = "kmrgirish/pprof-adv"
+
+// checksumsAsset is the release asset holding the sha256 of every binary, in
+// the `sha256sum` output format.
+const checksumsAsset = "checksums.txt"
+
+// signatureAsset is the release asset holding the base64 ed25519 signature of
+// the checksumsAsset.
+const signatureAsset = checksumsAsset + ".sig"
+
+// signingKey is the base64 ed25519 public key the checksums of releases are
+// signed with, injected by release builds like the version, see the release
+// target of the Makefile, e.g.
+//
+//	go build -ldflags "-X github.com/kmrgirish/pprof-adv/internal/update.signingKey=$(go run ./internal/update/sign --key release.pem --public)"
+//
+// Builds without it only verify the checksum of the binary, which guards the
+// download against corruption but not against a tampered release, as whoever
+// can replace the binary of a release can replace its checksums too.
+var signingKey string
+
+// Signed reports whether Apply verifies the signature of releases, see
+// signingKey.
+func Signed() bool {
+	return signingKey != ""
+}
+
+// Release is a GitHub release.
+type Release struct {
+	TagName string  `json:"tag_name"`
+	Assets  []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a GitHub release.
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Latest returns the latest published release.
+func Latest(ctx context.Context) (*Release, error) {
+	data, err := get(ctx, fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", repo))
+	if err != nil {
+		return nil, err
+	}
+
+	var release Release
+	if err := json.Unmarshal(data, &release); err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// AssetName returns the name of the release binary for the running platform.
+func AssetName() string {
+	name := fmt.Sprintf("pprof-adv_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Apply downloads the binary for the running platform from the release,
+// verifies it against the release checksums, and the checksums against their
+// signature if the build has a signing key, and replaces the running
+// executable with it.
+func Apply(ctx context.Context, release *Release) error {
+	binaryURL, checksumsURL, signatureURL := "", "", ""
+	for _, asset := range release.Assets {
+		switch asset.Name {
+		case AssetName():
+			binaryURL = asset.URL
+		case checksumsAsset:
+			checksumsURL = asset.URL
+		case signatureAsset:
+			signatureURL = asset.URL
+		}
+	}
+	if binaryURL == "" {
+		return fmt.Errorf("release %s has no binary %s", release.TagName, AssetName())
+	}
+	if checksumsURL == "" {
+		return fmt.Errorf("release %s has no %s, refusing to install an unverified binary", release.TagName, checksumsAsset)
+	}
+
+	checksums, err := get(ctx, checksumsURL)
+	if err != nil {
+		return fmt.Errorf("download checksums: %w", err)
+	}
+	if Signed() {
+		if signatureURL == "" {
+			return fmt.Errorf("release %s has no %s, refusing to install an unsigned binary", release.TagName, signatureAsset)
+		}
+		signature, err := get(ctx, signatureURL)
+		if err != nil {
+			return fmt.Errorf("download signature: %w", err)
+		}
+		if err := verifySignature(signingKey, checksums, signature); err != nil {
+			return fmt.Errorf("release %s: %w", release.TagName, err)
+		}
+	}
+	want, err := findChecksum(checksums, AssetName())
+	if err != nil {
+		return err
+	}
+
+	binary, err := get(ctx, binaryURL)
+	if err != nil {
+		return fmt.Errorf("download binary: %w", err)
+	}
+	sum := sha256.Sum256(binary)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", AssetName(), got, want)
+	}
+
+	return replaceExecutable(binary)
+}
+
+// verifySignature verifies the base64 ed25519 signature of the checksums
+// against the base64 public key.
+func verifySignature(key string, checksums, signature []byte) error {
+	publicKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return errors.New("invalid signing key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", signatureAsset, err)
+	}
+	if !ed25519.Verify(publicKey, checksums, sig) {
+		return fmt.Errorf("%s does not match the signing key", signatureAsset)
+	}
+	return nil
+}
+
+// findChecksum returns the sha256 of name in a `sha256sum` formatted file.
+func findChecksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no checksum for %s in %s", name, checksumsAsset)
+}
+
+// replaceExecutable atomically replaces the running executable with binary.
+func replaceExecutable(binary []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".pprof-adv-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+
+	// Windows cannot overwrite a running executable, but it can rename it.
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), exe)
+}
+
+// get downloads url.
+func get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, errors.New(res.Status)
+	}
+	return io.ReadAll(res.Body)
+}
@@ -0,0 +1,126 @@
+package update
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+)
+
+func TestFindChecksum(t *testing.T) {
+	checksums := []byte(`3a7bd3e2360a3d29eea436fcfb7e44c735d117c42d1c1835420b6b9942dd4f1b  pprof-adv_linux_amd64
+B94D27B9934D3E08A52E52D7DA7DABFAC484EFE37A5380EE9088F7ACE2EFCDE9 *pprof-adv_windows_amd64.exe
+`)
+
+	sum, err := findChecksum(checksums, "pprof-adv_windows_amd64.exe")
+	if err != nil {
+		t.Fatalf("findChecksum failed: %v", err)
+	}
+	if sum != "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" {
+		t.Errorf("Unexpected checksum %s", sum)
+	}
+
+	if _, err := findChecksum(checksums, "pprof-adv_darwin_arm64"); err == nil {
+		t.Error("Expected error for missing asset, got nil")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "v1.2.3", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"v1.10.0", "v1.9.2", 1},
+		{"v1.9.2", "v1.10.0", -1},
+		{"v2.0.0", "v1.99.99", 1},
+		{"v1.0.0-rc.1", "v1.0.0", -1},
+		{"v1.0.0-rc.2", "v1.0.0-rc.10", -1},
+		{"v1.0.0-alpha", "v1.0.0-alpha.1", -1},
+		{"v1.0.0-1", "v1.0.0-alpha", -1},
+		{"v1.0.0+build.5", "v1.0.0", 0},
+		{"v0.0.0-20260101000000-abcdef123456", "v0.1.0", -1},
+	} {
+		got, err := CompareVersions(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("CompareVersions(%s, %s) failed: %v", tt.a, tt.b, err)
+		} else if got != tt.want {
+			t.Errorf("Expected CompareVersions(%s, %s) = %d, got %d", tt.a, tt.b, tt.want, got)
+		}
+	}
+
+	for _, v := range []string{"dev", "v1.2", "v1.02.3", "v1.2.3-", "v1.2.x"} {
+		if _, err := CompareVersions(v, "v1.0.0"); err == nil {
+			t.Errorf("Expected error for %q, got nil", v)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := base64.StdEncoding.EncodeToString(publicKey)
+	checksums := []byte("3a7bd3e2360a3d29eea436fcfb7e44c735d117c42d1c1835420b6b9942dd4f1b  pprof-adv_linux_amd64\n")
+	signature := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, checksums)) + "\n")
+
+	if err := verifySignature(key, checksums, signature); err != nil {
+		t.Errorf("Expected the signature to verify, got %v", err)
+	}
+
+	tampered := []byte("0000000000000000000000000000000000000000000000000000000000000000  pprof-adv_linux_amd64\n")
+	if err := verifySignature(key, tampered, signature); err == nil {
+		t.Error("Expected error for tampered checksums, got nil")
+	}
+	otherKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	if err := verifySignature(base64.StdEncoding.EncodeToString(otherKey), checksums, signature); err == nil {
+		t.Error("Expected error for another signing key, got nil")
+	}
+	if err := verifySignature(key, checksums, []byte("not base64!")); err == nil {
+		t.Error("Expected error for a malformed signature, got nil")
+	}
+}
+
+func TestSign(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("ParseSigningKey failed: %v", err)
+	}
+
+	checksums := []byte("3a7bd3e2360a3d29eea436fcfb7e44c735d117c42d1c1835420b6b9942dd4f1b  pprof-adv_linux_amd64\n")
+	if err := verifySignature(PublicKey(key), checksums, Sign(key, checksums)); err != nil {
+		t.Errorf("Expected the signature to verify against the public key, got %v", err)
+	}
+}
+
+func TestParseSigningKeyErrors(t *testing.T) {
+	if _, err := ParseSigningKey(nil); err == nil {
+		t.Error("Expected error for an empty signing key, got nil")
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})); err == nil {
+		t.Error("Expected error for an ecdsa signing key, got nil")
+	}
+}
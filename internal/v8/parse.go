@@ -0,0 +1,136 @@
+package v8
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// cpuProfile is the .cpuprofile JSON document written by the V8 profiler, e.g.
+// `node --cpu-prof` or the Chrome DevTools performance panel.
+type cpuProfile struct {
+	Nodes      []node  `json:"nodes"`
+	StartTime  int64   `json:"startTime"`
+	EndTime    int64   `json:"endTime"`
+	Samples    []int64 `json:"samples"`
+	TimeDeltas []int64 `json:"timeDeltas"`
+}
+
+type node struct {
+	ID        int64     `json:"id"`
+	CallFrame callFrame `json:"callFrame"`
+	HitCount  int64     `json:"hitCount"`
+	Children  []int64   `json:"children"`
+}
+
+type callFrame struct {
+	FunctionName string `json:"functionName"`
+	URL          string `json:"url"`
+	LineNumber   int64  `json:"lineNumber"`
+}
+
+// Parse converts a V8 .cpuprofile into a pprof profile with samples and cpu
+// sample types. Each sample is weighted by the time until the next sample, and
+// idle samples are dropped since they are not cpu time.
+func Parse(r io.Reader) (*pb.Profile, error) {
+	var cp cpuProfile
+	if err := json.NewDecoder(r).Decode(&cp); err != nil {
+		return nil, err
+	}
+	if len(cp.Nodes) == 0 {
+		return nil, errors.New("no nodes found in cpuprofile")
+	}
+
+	nodes := make(map[int64]*node, len(cp.Nodes))
+	parents := make(map[int64]int64, len(cp.Nodes))
+	for i := range cp.Nodes {
+		n := &cp.Nodes[i]
+		nodes[n.ID] = n
+		for _, child := range n.Children {
+			parents[child] = n.ID
+		}
+	}
+
+	b := pb.NewBuilder([2]string{"samples", "count"}, [2]string{"cpu", "nanoseconds"})
+	stacks := make(map[int64][]pb.Stack)
+	add := func(id, count, nanos int64) {
+		n, exists := nodes[id]
+		if !exists || n.CallFrame.FunctionName == "(idle)" {
+			return
+		}
+		stack, exists := stacks[id]
+		if !exists {
+			stack = buildStack(nodes, parents, id)
+			stacks[id] = stack
+		}
+		if len(stack) > 0 {
+			b.AddSample(stack, []int64{count, nanos}, nil)
+		}
+	}
+
+	if len(cp.Samples) > 0 {
+		// timeDeltas[i] is the time between sample i-1 and sample i, so the
+		// weight of a sample is the delta of the one after it.
+		for i, id := range cp.Samples {
+			var micros int64
+			if i+1 < len(cp.TimeDeltas) {
+				micros = cp.TimeDeltas[i+1]
+			} else if i > 0 {
+				micros = (cp.EndTime - cp.StartTime) / int64(len(cp.Samples))
+			}
+			add(id, 1, max(micros, 0)*1000)
+		}
+	} else {
+		// Older profiles only record hit counts per node.
+		var hits int64
+		for _, n := range cp.Nodes {
+			hits += n.HitCount
+		}
+		if hits == 0 {
+			return nil, errors.New("no samples found in cpuprofile")
+		}
+		interval := (cp.EndTime - cp.StartTime) * 1000 / hits
+		for _, n := range cp.Nodes {
+			if n.HitCount > 0 {
+				add(n.ID, n.HitCount, n.HitCount*interval)
+			}
+		}
+	}
+
+	if len(b.Profile().Sample) == 0 {
+		return nil, errors.New("no samples found in cpuprofile")
+	}
+
+	return b.Profile(), nil
+}
+
+// buildStack returns the stack of node id, leaf first, without the synthetic
+// (root) node.
+func buildStack(nodes map[int64]*node, parents map[int64]int64, id int64) []pb.Stack {
+	var stack []pb.Stack
+	for depth := 0; depth < len(nodes); depth++ {
+		n, exists := nodes[id]
+		if !exists || n.CallFrame.FunctionName == "(root)" {
+			break
+		}
+
+		name := n.CallFrame.FunctionName
+		if name == "" {
+			name = "(anonymous)"
+		}
+		stack = append(stack, pb.Stack{
+			Name:     name,
+			FileName: n.CallFrame.URL,
+			Line:     n.CallFrame.LineNumber + 1, // V8 line numbers are 0-based
+		})
+
+		parent, exists := parents[id]
+		if !exists {
+			break
+		}
+		id = parent
+	}
+	return stack
+}
@@ -0,0 +1,54 @@
+package v8
+
+import (
+	"strings"
+	"testing"
+)
+
+const cpuprofile = `{
+  "nodes": [
+    {"id": 1, "callFrame": {"functionName": "(root)", "url": "", "lineNumber": -1}, "children": [2, 3, 5]},
+    {"id": 2, "callFrame": {"functionName": "(idle)", "url": "", "lineNumber": -1}},
+    {"id": 3, "callFrame": {"functionName": "", "url": "file:///app/server.js", "lineNumber": 0}, "children": [4]},
+    {"id": 4, "callFrame": {"functionName": "render", "url": "file:///app/view.js", "lineNumber": 41}},
+    {"id": 5, "callFrame": {"functionName": "(garbage collector)", "url": "", "lineNumber": -1}}
+  ],
+  "startTime": 0,
+  "endTime": 4000,
+  "samples": [4, 4, 2, 5, 4],
+  "timeDeltas": [0, 1000, 1000, 500, 500]
+}`
+
+func TestParse(t *testing.T) {
+	p, err := Parse(strings.NewReader(cpuprofile))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	// The idle sample is dropped.
+	if len(p.Sample) != 4 {
+		t.Fatalf("Expected 4 samples, got %d", len(p.Sample))
+	}
+
+	first := p.Sample[0]
+	if first.Value[1] != 1000000 {
+		t.Errorf("Expected first sample weight 1ms, got %dns", first.Value[1])
+	}
+	if len(first.LocationId) != 2 {
+		t.Fatalf("Expected render <- (anonymous), got %d frames", len(first.LocationId))
+	}
+	leaf := p.Location[first.LocationId[0]-1].Line[0]
+	if name := p.StringTable[p.Function[leaf.FunctionId-1].Name]; name != "render" || leaf.Line != 42 {
+		t.Errorf("Expected leaf render:42, got %s:%d", name, leaf.Line)
+	}
+	caller := p.Location[first.LocationId[1]-1].Line[0]
+	if name := p.StringTable[p.Function[caller.FunctionId-1].Name]; name != "(anonymous)" {
+		t.Errorf("Expected caller (anonymous), got %s", name)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	if _, err := Parse(strings.NewReader(`{"nodes": []}`)); err == nil {
+		t.Error("Expected error for empty cpuprofile, got nil")
+	}
+}
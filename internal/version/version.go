@@ -0,0 +1,113 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Build metadata injected by release builds, e.g.
+//
+//	go build -ldflags "-X github.com/kmrgirish/pprof-adv/internal/version.version=v1.2.0 \
+//	  -X github.com/kmrgirish/pprof-adv/internal/version.commit=$(git rev-parse HEAD) \
+//	  -X github.com/kmrgirish/pprof-adv/internal/version.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// When unset they fall back to the build information recorded by the go
+// toolchain, which covers `go install` and builds from a git checkout.
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// Info is the build metadata of the running binary.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// Get returns the build metadata of the running binary.
+func Get() Info {
+	info := Info{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+}
+
+// Version returns the version of the binary, or "dev" for builds from a source
+// checkout.
+func Version() string {
+	return Get().Version
+}
+
+// UserAgent returns the User-Agent sent with HTTP requests.
+func UserAgent() string {
+	info := Get()
+	ua := "pprof-adv/" + info.Version
+	if info.Commit != "" {
+		ua += fmt.Sprintf(" (%s; %s)", shortCommit(info.Commit), info.Platform)
+	}
+	return ua
+}
+
+// String returns the version along with the build metadata, for --version
+// output.
+func String() string {
+	info := Get()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "pprof-adv %s\n", info.Version)
+	if info.Commit != "" {
+		modified := ""
+		if info.Modified {
+			modified = " (modified)"
+		}
+		fmt.Fprintf(&sb, "commit: %s%s\n", info.Commit, modified)
+	}
+	if info.Date != "" {
+		fmt.Fprintf(&sb, "built: %s\n", info.Date)
+	}
+	fmt.Fprintf(&sb, "go: %s %s", info.GoVersion, info.Platform)
+	return sb.String()
+}
+
+// shortCommit abbreviates a git commit hash.
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
@@ -0,0 +1,207 @@
+// Package warehouse loads the per-function rows of reports into data
+// warehouses, as SQL statements for ClickHouse or BigQuery, or inserted into
+// ClickHouse over its HTTP interface, so that nightly runs can be analyzed
+// over the long term.
+package warehouse
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/report"
+)
+
+// batchSize is the number of rows per INSERT statement, which keeps
+// statements below the size limits of the warehouses.
+const batchSize = 500
+
+// kind is the type of a column.
+type kind int
+
+const (
+	kindTime kind = iota
+	kindString
+	kindInt
+	kindFloat
+)
+
+// column is a column of the table and its value in a Record.
+type column struct {
+	name  string
+	kind  kind
+	value func(r *Record) any
+}
+
+// columns are the columns of the table, the Record fields followed by the
+// ones of report.Row.
+var columns = []column{
+	{"recorded_at", kindTime, func(r *Record) any { return r.Recorded }},
+	{"source", kindString, func(r *Record) any { return r.Source }},
+	{"schema_version", kindInt, func(r *Record) any { return int64(r.SchemaVersion) }},
+	{"type", kindString, func(r *Record) any { return r.Type }},
+	{"sample_type", kindString, func(r *Record) any { return r.SampleType }},
+	{"unit", kindString, func(r *Record) any { return r.Unit }},
+	{"total", kindInt, func(r *Record) any { return r.Total }},
+	{"duration_nanos", kindInt, func(r *Record) any { return r.DurationNanos }},
+	{"rank", kindInt, func(r *Record) any { return int64(r.Rank) }},
+	{"name", kindString, func(r *Record) any { return r.Name }},
+	{"file", kindString, func(r *Record) any { return r.File }},
+	{"module", kindString, func(r *Record) any { return r.Module }},
+	{"version", kindString, func(r *Record) any { return r.Version }},
+	{"attr_percent", kindFloat, func(r *Record) any { return r.AttrPercent }},
+	{"self_percent", kindFloat, func(r *Record) any { return r.SelfPercent }},
+	{"total_percent", kindFloat, func(r *Record) any { return r.TotalPercent }},
+	{"samples", kindInt, func(r *Record) any { return int64(r.Samples) }},
+	{"stacks", kindInt, func(r *Record) any { return int64(r.Stacks) }},
+	{"callers", kindInt, func(r *Record) any { return int64(r.Callers) }},
+}
+
+// Record is a row of a report along with when and what it was recorded from,
+// which tell the rows of different runs apart.
+type Record struct {
+	Recorded time.Time
+	Source   string // e.g. the profile file or the service it was downloaded from
+	report.Row
+}
+
+// Dialect is the SQL dialect of a warehouse.
+type Dialect struct {
+	Name  string
+	types map[kind]string
+	// engine follows the columns of CREATE TABLE.
+	engine string
+	// timestamp formats a time as a literal.
+	timestamp func(t time.Time) string
+}
+
+// ClickHouse is the dialect of ClickHouse, whose table is ordered for
+// queries of the history of functions.
+var ClickHouse = Dialect{
+	Name:   "clickhouse",
+	types:  map[kind]string{kindTime: "DateTime64(3, 'UTC')", kindString: "String", kindInt: "Int64", kindFloat: "Float64"},
+	engine: " ENGINE = MergeTree ORDER BY (name, recorded_at)",
+	timestamp: func(t time.Time) string {
+		return quote(t.UTC().Format(clickHouseTime))
+	},
+}
+
+// BigQuery is the dialect of BigQuery, whose table is partitioned by day.
+var BigQuery = Dialect{
+	Name:   "bq",
+	types:  map[kind]string{kindTime: "TIMESTAMP", kindString: "STRING", kindInt: "INT64", kindFloat: "FLOAT64"},
+	engine: " PARTITION BY DATE(recorded_at) CLUSTER BY name",
+	timestamp: func(t time.Time) string {
+		return "TIMESTAMP " + quote(t.UTC().Format("2006-01-02 15:04:05.000")+" UTC")
+	},
+}
+
+// clickHouseTime is the layout of DateTime64(3) values.
+const clickHouseTime = "2006-01-02 15:04:05.000"
+
+// ParseDialect returns the dialect named clickhouse or bq.
+func ParseDialect(name string) (Dialect, error) {
+	switch name {
+	case ClickHouse.Name:
+		return ClickHouse, nil
+	case BigQuery.Name, "bigquery":
+		return BigQuery, nil
+	}
+	return Dialect{}, fmt.Errorf("unknown warehouse %q, expected clickhouse or bq", name)
+}
+
+// CreateTable returns the statement creating the table if it does not exist.
+func (d Dialect) CreateTable(table string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE TABLE IF NOT EXISTS %s (\n", table)
+	for i, c := range columns {
+		sep := ","
+		if i == len(columns)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(&b, "  %s %s%s\n", c.name, d.types[c.kind], sep)
+	}
+	b.WriteString(")" + d.engine + ";\n")
+	return b.String()
+}
+
+// values returns the tuple of values of the record.
+func (d Dialect) values(r *Record) string {
+	fields := make([]string, len(columns))
+	for i, c := range columns {
+		switch v := c.value(r).(type) {
+		case time.Time:
+			fields[i] = d.timestamp(v)
+		case string:
+			fields[i] = quote(v)
+		case int64:
+			fields[i] = strconv.FormatInt(v, 10)
+		case float64:
+			fields[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		}
+	}
+	return "(" + strings.Join(fields, ", ") + ")"
+}
+
+// quote returns s as a string literal, which both dialects escape with
+// backslashes.
+func quote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`).Replace(s) + "'"
+}
+
+// columnNames returns the comma separated names of the columns.
+func columnNames() string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// Writer writes the statement creating a table followed by INSERT statements
+// of batches of records.
+type Writer struct {
+	w       *bufio.Writer
+	dialect Dialect
+	table   string
+	batch   []string
+}
+
+// NewWriter writes the statement creating the table to w and returns a
+// writer of the records to insert into it.
+func NewWriter(w io.Writer, d Dialect, table string) (*Writer, error) {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(d.CreateTable(table)); err != nil {
+		return nil, err
+	}
+	return &Writer{w: bw, dialect: d, table: table}, nil
+}
+
+// Write adds the record to the current batch, writing it once full.
+func (w *Writer) Write(r *Record) error {
+	w.batch = append(w.batch, w.dialect.values(r))
+	if len(w.batch) < batchSize {
+		return nil
+	}
+	return w.flush()
+}
+
+// Close writes the last batch.
+func (w *Writer) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+func (w *Writer) flush() error {
+	if len(w.batch) == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(w.w, "INSERT INTO %s (%s) VALUES\n%s;\n", w.table, columnNames(), strings.Join(w.batch, ",\n"))
+	w.batch = w.batch[:0]
+	return err
+}
@@ -0,0 +1,119 @@
+package warehouse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/report"
+)
+
+var record = &Record{
+	Recorded: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	Source:   "it's.pprof",
+	Row:      report.NewRow(&report.Report{Type: "cpu", SampleType: "cpu", Unit: "nanoseconds", Total: 100}, 1, report.Function{Name: "main.main", AttrPercent: 12.5, Samples: 3}),
+}
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		want    []string
+	}{
+		{ClickHouse, []string{
+			"CREATE TABLE IF NOT EXISTS t (\n  recorded_at DateTime64(3, 'UTC'),\n  source String,",
+			"  callers Int64\n) ENGINE = MergeTree ORDER BY (name, recorded_at);\n",
+			"INSERT INTO t (recorded_at, source, schema_version, type,",
+			"VALUES\n('2026-01-02 03:04:05.000', 'it\\'s.pprof', 1, 'cpu', 'cpu', 'nanoseconds', 100, 0, 1, 'main.main', '', '', '', 12.5, 0, 0, 3, 0, 0);\n",
+		}},
+		{BigQuery, []string{
+			"  recorded_at TIMESTAMP,\n",
+			") PARTITION BY DATE(recorded_at) CLUSTER BY name;\n",
+			"(TIMESTAMP '2026-01-02 03:04:05.000 UTC', 'it\\'s.pprof', 1,",
+		}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, tt.dialect, "t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("Expected %s SQL to contain %q, got\n%s", tt.dialect.Name, want, buf.String())
+			}
+		}
+	}
+}
+
+func TestWriterBatches(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, ClickHouse, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range batchSize + 1 {
+		if err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(buf.String(), "INSERT INTO"); got != 2 {
+		t.Errorf("Expected 2 INSERT statements, got %d", got)
+	}
+}
+
+func TestInserter(t *testing.T) {
+	var queries []string
+	var rows []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, _ := r.BasicAuth(); user != "u" || password != "p" || r.URL.Query().Get("database") != "profiles" {
+			t.Errorf("Expected the credentials and database of the DSN, got %s:%s %s", user, password, r.URL)
+		}
+		queries = append(queries, r.URL.Query().Get("query"))
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var row map[string]any
+			if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+				t.Error(err)
+			}
+			rows = append(rows, row)
+		}
+	}))
+	defer srv.Close()
+
+	ins, err := NewInserter(context.Background(), strings.Replace(srv.URL, "http://", "http://u:p@", 1)+"/?database=profiles", "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ins.Write(record); err != nil {
+		t.Fatal(err)
+	}
+	if err := ins.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(queries) != 2 || !strings.HasPrefix(queries[0], "CREATE TABLE IF NOT EXISTS t (") || queries[1] != "INSERT INTO t FORMAT JSONEachRow" {
+		t.Errorf("Expected the table created and rows inserted, got %q", queries)
+	}
+	if len(rows) != 1 || rows[0]["name"] != "main.main" || rows[0]["recorded_at"] != "2026-01-02 03:04:05.000" || rows[0]["attr_percent"] != 12.5 {
+		t.Errorf("Expected the row of main.main, got %+v", rows)
+	}
+
+	if _, err := NewInserter(context.Background(), "clickhouse://host:9000", "t"); err == nil {
+		t.Error("Expected error for a DSN that is not an HTTP URL")
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/latency"
+)
+
+type LatencyCmd struct {
+	Profile   string `arg:"positional"  help:"cpu profile of the --apm service with trace endpoint labels, defaults to --profile, the top profile of the --apm service or stdin"`
+	Operation string `arg:"--operation" help:"operation of the root spans of the endpoints, whose trace metrics are compared" default:"http.request"`
+}
+
+// run ranks the endpoints of the --apm service by how much of their latency
+// is spent on cpu, from the trace metrics of the window of the profile.
+func (cmd *LatencyCmd) run(root *Cmd) {
+	if root.Service == "" {
+		fail("latency needs the --apm service to fetch the trace metrics of")
+	}
+	profile, info := root.loadProfile(cmd.Profile, "latency")
+
+	// The trace metrics of the host and window of a downloaded profile, or
+	// of every host over the window of a local one.
+	var host string
+	from := time.Unix(0, profile.TimeNanos)
+	window := time.Duration(profile.DurationNanos)
+	if info != nil {
+		host, from, window = info.Host, info.Timestamp, info.Duration
+	}
+	if profile.TimeNanos == 0 && info == nil {
+		fail("The profile has no start time to fetch trace metrics for")
+	}
+	if window < time.Minute {
+		// Trace metrics are not resolved finer than minutes.
+		window = time.Minute
+	}
+
+	client := root.newClient()
+	stats, err := client.TraceStats(context.Background(), root.Service, root.Environment, host, cmd.Operation, from, from.Add(window))
+	if err != nil {
+		fail("Error: %s", err)
+	}
+	endpoints, err := latency.Align(profile, stats, window)
+	if err != nil {
+		fail("Error aligning endpoints: %s", err)
+	}
+	if len(endpoints) == 0 {
+		fail("No endpoint of the traces has cpu samples in the profile")
+	}
+	if host == "" {
+		fmt.Fprintln(os.Stderr, "WARNING: the requests of every host are compared with the cpu of one, the cpu per request is underestimated")
+	}
+	latency.Write(os.Stdout, endpoints, root.Top, root.style())
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+
+	"github.com/kmrgirish/pprof-adv/internal/contention"
+	"github.com/kmrgirish/pprof-adv/internal/input"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+type LocksCmd struct {
+	Profiles []string `arg:"positional" help:"a Datadog download holding cpu and mutex profiles, or a cpu and a mutex profile in any order, defaults to --profile or stdin"`
+}
+
+// run ranks the critical sections of the mutex profile by the cpu of their
+// functions in the cpu profile times the wait for them.
+func (cmd *LocksCmd) run(root *Cmd) {
+	paths := cmd.Profiles
+	if len(paths) == 0 {
+		if root.Profile == "" && !stdinIsPipe() {
+			fail("locks needs profiles from arguments, --profile or stdin")
+		}
+		paths = []string{root.Profile}
+	}
+
+	var cpuProfile, mutex *pb.Profile
+	for _, path := range paths {
+		f := os.Stdin
+		if path != "" && path != "-" {
+			var err error
+			if f, err = os.Open(path); err != nil {
+				fail("Error opening file: %s", err)
+			}
+		}
+		files, err := input.Profiles(f)
+		f.Close()
+		if err != nil {
+			fail("Error reading profiles: %s", err)
+		}
+		for name, data := range files {
+			profile, err := input.Parse(bytes.NewReader(data), root.Input)
+			if err != nil {
+				continue
+			}
+			if root.TrimPaths {
+				pb.TrimPaths(profile)
+			}
+			switch {
+			case pb.IsContentionProfile(profile):
+				// block and mutex profiles share sample types, only their
+				// names tell them apart
+				if !strings.Contains(path+"/"+name, "block") {
+					mutex = profile
+				}
+			case pb.CPUSampleIndex(profile) != -1 && cpuProfile == nil:
+				cpuProfile = profile
+			}
+		}
+	}
+	if cpuProfile == nil || mutex == nil {
+		fail("locks needs a cpu and a mutex profile, e.g. a Datadog download or two profiles")
+	}
+
+	if err := contention.TransformLocks(cpuProfile, mutex, os.Stdout, root.analyzeOptions(), root.Top, root.style()); err != nil {
+		fail("Error transforming profiles: %s", err)
+	}
+}
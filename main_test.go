@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alexflint/go-arg"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+// TestMain runs the CLI instead of the tests when re-executed by runCLI.
+func TestMain(m *testing.M) {
+	if os.Getenv("PPROF_ADV_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCLI runs pprof-adv with the arguments and returns its output and exit
+// code.
+func runCLI(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "PPROF_ADV_TEST_MAIN=1", "NO_COLOR=1")
+	out, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(out), exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("running the CLI: %v", err)
+	}
+	return string(out), 0
+}
+
+// writeUnsymbolizedProfile writes a cpu profile of main calling into libc,
+// where the libc frames, 90% of the cpu, have no function information as in
+// eBPF agent exports, and returns its path.
+func writeUnsymbolizedProfile(t *testing.T) string {
+	t.Helper()
+	p := &pb.Profile{
+		StringTable:   []string{"", "cpu", "nanoseconds", "main.main", "main.go", "/usr/lib/libc.so.6"},
+		SampleType:    []*pb.ValueType{{Type: 1, Unit: 2}},
+		DurationNanos: 1e9,
+		Mapping:       []*pb.Mapping{{Id: 1, MemoryStart: 0x1000, MemoryLimit: 0x9000, Filename: 5}},
+		Function:      []*pb.Function{{Id: 1, Name: 3, Filename: 4}},
+		Location: []*pb.Location{
+			{Id: 1, Line: []*pb.Line{{FunctionId: 1, Line: 10}}},
+			{Id: 2, MappingId: 1, Address: 0x1234},
+		},
+		Sample: []*pb.Sample{
+			{LocationId: []uint64{2, 1}, Value: []int64{9e8}},
+			{LocationId: []uint64{1}, Value: []int64{1e8}},
+		},
+	}
+	data, err := proto.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cpu.pprof")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestStrictFailsOnUnsymbolizedProfile(t *testing.T) {
+	path := writeUnsymbolizedProfile(t)
+
+	if out, code := runCLI(t, "--profile", path, "--type", "cpu", "--format", "text"); code != 0 {
+		t.Fatalf("Expected the report to succeed without --strict, got exit code %d: %s", code, out)
+	}
+	out, code := runCLI(t, "--profile", path, "--type", "cpu", "--format", "text", "--strict")
+	if code == 0 {
+		t.Errorf("Expected a non-zero exit code with --strict, got 0: %s", out)
+	}
+	if !strings.Contains(out, "without function information") {
+		t.Errorf("Expected the strict error to name the unsymbolized frames, got %q", out)
+	}
+}
+
+func TestJSONWarnsOfUnsymbolizedProfile(t *testing.T) {
+	out, code := runCLI(t, "--profile", writeUnsymbolizedProfile(t), "--type", "cpu", "--format", "json")
+	if code != 0 {
+		t.Fatalf("Expected the report to succeed, got exit code %d: %s", code, out)
+	}
+
+	var report struct {
+		Warnings []string `json:"warnings"`
+	}
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("Expected a JSON report, got %v: %s", err, out)
+	}
+	want := "1 locations have no function information and are named after their mapping and address, symbolize the profile to see their functions"
+	if !slices.Contains(report.Warnings, want) {
+		t.Errorf("Expected warning %q, got %q", want, report.Warnings)
+	}
+}
+
+func TestOutDirWritesEachFormat(t *testing.T) {
+	dir := t.TempDir()
+	out, code := runCLI(t, "--profile", writeUnsymbolizedProfile(t), "--type", "cpu", "--format", "text,csv,tree,json", "--out-dir", dir)
+	if code != 0 {
+		t.Fatalf("Expected the reports to succeed, got exit code %d: %s", code, out)
+	}
+
+	for _, name := range []string{"report.txt", "report.csv", "report.tree.txt", "report.json"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("Expected %s to be written: %v", name, err)
+		} else if !strings.Contains(string(data), "main.main") {
+			t.Errorf("Expected main.main in %s, got %s", name, data)
+		}
+	}
+}
+
+func TestFormatDefaultsToText(t *testing.T) {
+	dir := t.TempDir()
+	out, code := runCLI(t, "--profile", writeUnsymbolizedProfile(t), "--type", "cpu", "--out-dir", dir)
+	if code != 0 {
+		t.Fatalf("Expected the report to succeed, got exit code %d: %s", code, out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "report.txt")); err != nil {
+		t.Errorf("Expected the text report without --format: %v", err)
+	}
+}
+
+func TestSliceRejectsOtherFormats(t *testing.T) {
+	dir := t.TempDir()
+	out, code := runCLI(t, "--profile", writeUnsymbolizedProfile(t), "--type", "cpu", "--slice", "10s", "--format", "text,json", "--out-dir", dir)
+	if code == 0 {
+		t.Fatalf("Expected --slice with --format json to fail, got exit code 0: %s", out)
+	}
+	if !strings.Contains(out, "can't be combined with --format json") {
+		t.Errorf("Expected the --slice error, got %s", out)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected nothing written, got %v", entries)
+	}
+}
+
+func TestOutputsMustNotCollide(t *testing.T) {
+	dir := t.TempDir()
+	out, code := runCLI(t, "--profile", writeUnsymbolizedProfile(t), "--type", "cpu", "--format", "text,text", "--out-dir", dir)
+	if code == 0 {
+		t.Fatalf("Expected colliding formats to fail, got exit code 0: %s", out)
+	}
+	if !strings.Contains(out, "would both be written to") {
+		t.Errorf("Expected a collision error, got %s", out)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected nothing written, got %v", entries)
+	}
+}
+
+func TestTypeAllReportsEachProfileOfTheArchive(t *testing.T) {
+	out, code := runCLI(t, "--profile", filepath.Join("internal", "selftest", "testdata", "datadog.zip"), "--type", "all")
+	if code != 0 {
+		t.Fatalf("Expected the report to succeed, got exit code %d: %s", code, out)
+	}
+	for _, section := range []string{"== cpu (cpu.pprof)\n", "== mutex (delta-mutex.pprof)\n"} {
+		if !strings.Contains(out, section) {
+			t.Errorf("Expected section %q, got %s", section, out)
+		}
+	}
+	if !strings.Contains(out, "Container cpu limit 2.00 cores") {
+		t.Errorf("Expected the cpu limit of the metrics of the archive, got %s", out)
+	}
+}
+
+func TestPortIsADeprecatedAliasOfPprofPort(t *testing.T) {
+	var cmd Cmd
+	p, err := arg.NewParser(arg.Config{}, &cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Parse([]string{"--k8s", "pod/api", "--port", "7070"}); err != nil {
+		t.Fatal(err)
+	}
+	cmd.deprecatedFlags()
+	if cmd.PprofPort != 7070 {
+		t.Errorf("Expected --port 7070 to set --pprof-port, got %d", cmd.PprofPort)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// formatExtensions are the file extensions of the output formats, text for
+// the others.
+var formatExtensions = map[string]string{
+	"text":       ".txt",
+	"csv":        ".csv",
+	"tree":       ".tree.txt",
+	"template":   ".out",
+	"json":       ".json",
+	"ndjson":     ".ndjson",
+	"html":       ".html",
+	"flamegraph": ".svg",
+	"clickhouse": ".sql",
+	"bq":         ".sql",
+}
+
+// output returns the writer the report in the format goes to, stdout, the
+// --out file or report.<ext> in the --out-dir, also stdout with --tee, and a
+// func closing it. With several formats, each is written to the --out file
+// with the extension of its format instead. It exits on errors.
+func (cmd *Cmd) output(format string, several bool) (io.Writer, func()) {
+	if cmd.Out != "" && cmd.OutDir != "" {
+		fail("--out and --out-dir are exclusive")
+	}
+	if cmd.Out == "" && cmd.OutDir == "" {
+		if cmd.Tee {
+			fail("--tee needs the --out file or --out-dir to write the report to")
+		}
+		if several {
+			fail("--format %s needs the --out file or --out-dir to write each format to", cmd.Format)
+		}
+		return os.Stdout, func() {}
+	}
+
+	if cmd.OutDir != "" {
+		if err := os.MkdirAll(cmd.OutDir, 0o755); err != nil {
+			fail("Error creating %s: %s", cmd.OutDir, err)
+		}
+	}
+	path := cmd.outputPath(format, several)
+	f, err := os.Create(path)
+	if err != nil {
+		fail("Error creating %s: %s", path, err)
+	}
+	var w io.Writer = f
+	if cmd.Tee {
+		w = io.MultiWriter(os.Stdout, f)
+	}
+	return w, func() {
+		if err := f.Close(); err != nil {
+			fail("Error writing %s: %s", path, err)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+	}
+}
+
+// outputPath returns the file the report in the format is written to by
+// output.
+func (cmd *Cmd) outputPath(format string, several bool) string {
+	ext, ok := formatExtensions[format]
+	if !ok {
+		ext = ".txt"
+	}
+	switch {
+	case cmd.OutDir != "":
+		return filepath.Join(cmd.OutDir, "report"+ext)
+	case several:
+		return strings.TrimSuffix(cmd.Out, filepath.Ext(cmd.Out)) + ext
+	}
+	return cmd.Out
+}
+
+// checkOutputs exits if two of the formats would be written to the same file,
+// the later overwriting the earlier.
+func (cmd *Cmd) checkOutputs(formats []string) {
+	if cmd.Out == "" && cmd.OutDir == "" {
+		return
+	}
+	written := make(map[string]string, len(formats))
+	for _, format := range formats {
+		path := cmd.outputPath(format, len(formats) > 1)
+		if prev, ok := written[path]; ok {
+			fail("--format %s and %s would both be written to %s", prev, format, path)
+		}
+		written[path] = format
+	}
+}
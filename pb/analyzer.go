@@ -0,0 +1,431 @@
+package pb
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Granularity is the level at which samples are aggregated into nodes.
+type Granularity string
+
+const (
+	// GranularityFunction aggregates samples per function, this is the default.
+	GranularityFunction Granularity = "function"
+	// GranularityLine aggregates samples per source line, nodes are named
+	// "function:line".
+	GranularityLine Granularity = "line"
+	// GranularityFile aggregates samples per source file, nodes are named after
+	// the file.
+	GranularityFile Granularity = "file"
+)
+
+// AnalyzeOptions controls how a profile is analyzed. The zero value analyzes
+// the cpu sample type per function without attribution.
+type AnalyzeOptions struct {
+	// AttrCPU attributes the cpu usage of leaf functions selected by ShouldAttr
+	// to their caller, in addition to their own self cpu.
+	AttrCPU bool
+	// ShouldAttr reports whether the cpu of a function is attributed to its
+	// caller. It defaults to stdlib functions.
+	ShouldAttr func(funcName string) bool
+
+	// Focus, if set, only keeps samples with a frame matching it.
+	Focus *regexp.Regexp
+	// Ignore, if set, drops samples with a frame matching it.
+	Ignore *regexp.Regexp
+	// SampleFilter, if set, only keeps the samples it returns true for, e.g. to
+	// select samples by label, by value or by a predicate on their stack. The
+	// stack goes from the root to the leaf at the analysis granularity, before
+	// Focus, Ignore and HideRuntime apply. Like with Focus and Ignore, the
+	// dropped samples still count in the total percentages are relative to.
+	SampleFilter func(sample *Sample, stack []Stack) bool
+
+	// Granularity is the level at which samples are aggregated, it defaults to
+	// GranularityFunction.
+	Granularity Granularity
+
+	// SampleType is the name of the sample type to analyze, e.g. "cpu" or
+	// "alloc_space". It defaults to the first sample type containing "cpu".
+	SampleType string
+
+	// HideRuntime drops the frames selected by IsRuntime from the stacks, so
+	// that their cpu counts as self cpu of the closest remaining caller. This
+	// is independent of AttrCPU, which keeps the frames as nodes.
+	HideRuntime bool
+	// IsRuntime reports whether a function is part of the runtime or stdlib.
+	// It defaults to stdlib functions.
+	IsRuntime func(funcName string) bool
+
+	// BlameLibraries does the opposite of AttrCPU: the attributed cpu of a
+	// sample goes to the library function, selected by ShouldAttr or of a
+	// dependency in the module cache, called by its innermost user function,
+	// along with the cpu of the libraries it calls, for a per-library cost
+	// view. Samples whose leaf is a user function keep its attributed cpu.
+	BlameLibraries bool
+
+	// MaxDepth, if set, truncates the stacks deeper than it to their MaxDepth
+	// outermost frames, the cpu of the dropped frames counting as self cpu of
+	// the last kept one, e.g. to keep the trees of recursive parsers
+	// tractable. It applies after HideRuntime.
+	MaxDepth int
+	// TrimBelow, if set, leaves the call paths below this percent of the total
+	// out of the call trees of reports, instead of the default of each report.
+	TrimBelow float64
+
+	// Strict fails the analysis of profiles whose numbers are questionable
+	// instead of warning about them, e.g. for CI pipelines gating on them:
+	// profiles without a duration, and profiles whose samples with frames
+	// without function information exceed MaxUnsymbolized percent of the
+	// total. The other warnings, e.g. negative values, stay warnings.
+	Strict bool
+	// MaxUnsymbolized is the percent of the total in samples with frames
+	// without function information that Strict tolerates.
+	MaxUnsymbolized float64
+}
+
+// Analyzer analyzes profiles with a fixed set of options. It holds no state
+// between analyses and is safe for concurrent use by multiple goroutines.
+type Analyzer struct {
+	opts AnalyzeOptions
+}
+
+// NewAnalyzer creates an Analyzer. It returns an error if the options are
+// invalid.
+func NewAnalyzer(opts AnalyzeOptions) (*Analyzer, error) {
+	switch opts.Granularity {
+	case "":
+		opts.Granularity = GranularityFunction
+	case GranularityFunction, GranularityLine, GranularityFile:
+	default:
+		return nil, fmt.Errorf("unknown granularity %q", opts.Granularity)
+	}
+	if opts.MaxDepth < 0 {
+		return nil, fmt.Errorf("negative max depth %d", opts.MaxDepth)
+	}
+	if opts.TrimBelow < 0 || opts.TrimBelow >= 100 {
+		return nil, fmt.Errorf("trim below %v%% is not within [0, 100)", opts.TrimBelow)
+	}
+	if opts.MaxUnsymbolized < 0 || opts.MaxUnsymbolized > 100 {
+		return nil, fmt.Errorf("max unsymbolized %v%% is not within [0, 100]", opts.MaxUnsymbolized)
+	}
+	if opts.ShouldAttr == nil {
+		opts.ShouldAttr = shouldAttrFn
+	}
+	if opts.IsRuntime == nil {
+		opts.IsRuntime = shouldAttrFn
+	}
+
+	return &Analyzer{opts: opts}, nil
+}
+
+// Options returns the options of the analyzer.
+func (a *Analyzer) Options() AnalyzeOptions {
+	return a.opts
+}
+
+// AnalyzeCPU analyzes a profile and returns the usage percentage of the
+// selected sample type per node, see AnalyzeCPUProfile.
+func (a *Analyzer) AnalyzeCPU(p *Profile) (map[string]*FunctionNode, error) {
+	report := a.NewReport()
+	if err := a.Ingest(report, p); err != nil {
+		return nil, err
+	}
+	if report.Total() == 0 {
+		return nil, fmt.Errorf("no CPU time recorded in profile")
+	}
+	return report.Nodes(), nil
+}
+
+// Ingest adds the samples of a profile to the report. The profile is analyzed
+// on its own before being merged into the report, so ingesting is cheap
+// relative to reanalyzing all profiles and may run concurrently with other
+// ingests and reads of the report.
+func (a *Analyzer) Ingest(r *Report, p *Profile) error {
+	if err := Validate(p); err != nil {
+		return err
+	}
+
+	// Build function info map first
+	funcInfoMap := buildFunctionInfoMap(p)
+	locations := buildLocationMap(p)
+
+	// Find sample type index
+	valueIdx, err := a.sampleIndex(p)
+	if err != nil {
+		return err
+	}
+
+	// Create function call tree, valued in the unit of the sample type until
+	// the report converts them to percentages
+	functionNodes := make(map[string]*FunctionNode)
+	var total int64
+
+	// Odd data is analyzed as well as it can be, and reported as warnings.
+	// Locations Normalize gave a synthetic function stay in the stacks but
+	// still count as unsymbolized.
+	unsymbolized := make(map[uint64]bool)
+	synthesized := make(map[uint64]bool)
+	synthesizedFuncs := synthesizedFunctions(p)
+	var skippedSamples, negativeStacks int
+	var skippedValue, unsymbolizedValue int64
+
+	samples := p.Sample
+	if a.opts.SampleFilter != nil {
+		samples, total = a.filterSamples(samples, valueIdx, locations, funcInfoMap)
+	}
+
+	// Process each distinct stack once, production profiles repeat the same
+	// stacks many times
+	for _, unique := range dedupStacks(samples, valueIdx) {
+		total += unique.value
+		stack := make([]Stack, 0, len(unique.locations))
+		attributable := make([]bool, 0, len(unique.locations))
+		var hidden []bool
+		var partial bool
+
+		// Build stack trace
+		for i := len(unique.locations) - 1; i >= 0; i-- {
+			loc := locations[unique.locations[i]]
+			if loc == nil || len(loc.Line) == 0 {
+				unsymbolized[unique.locations[i]] = true
+				partial = true
+				continue
+			}
+
+			// The functions inlined at the location are frames of their
+			// own, the last line being the outermost caller
+			for j := len(loc.Line) - 1; j >= 0; j-- {
+				line := loc.Line[j]
+				if synthesizedFuncs[line.FunctionId] {
+					synthesized[unique.locations[i]] = true
+					partial = true
+				}
+
+				if info, exists := funcInfoMap[line.FunctionId]; exists {
+					stack = append(stack, a.node(info, line.Line))
+					if a.opts.BlameLibraries {
+						attributable = append(attributable, a.isLibrary(info))
+					} else {
+						attributable = append(attributable, a.opts.AttrCPU && a.opts.ShouldAttr(info.Name))
+					}
+					if a.opts.HideRuntime {
+						hidden = append(hidden, a.opts.IsRuntime(info.Name))
+					}
+				}
+			}
+		}
+
+		if partial {
+			unsymbolizedValue += unique.value
+		}
+		if len(stack) == 0 {
+			skippedSamples += unique.samples
+			skippedValue += unique.value
+		}
+		if unique.value < 0 {
+			negativeStacks++
+		}
+
+		if !a.keep(stack) {
+			continue
+		}
+		if a.opts.HideRuntime {
+			stack, attributable = hideFrames(stack, attributable, hidden)
+		}
+		if a.opts.MaxDepth > 0 && len(stack) > a.opts.MaxDepth {
+			stack, attributable = stack[:a.opts.MaxDepth], attributable[:a.opts.MaxDepth]
+		}
+
+		// Update function nodes with the samples of this stack
+		if len(stack) > 0 {
+			blamed := -1
+			if a.opts.BlameLibraries {
+				blamed = blamedFrame(attributable)
+			}
+			updateFunctionNodes(functionNodes, stack, attributable, blamed, float64(unique.value), unique.samples)
+		}
+	}
+
+	if a.opts.Strict {
+		if err := a.checkStrict(p, unsymbolizedValue, total); err != nil {
+			return err
+		}
+	}
+
+	var warnings []string
+	if p.DurationNanos <= 0 {
+		warnings = append(warnings, "the profile has no duration, so its cores and rates are unknown")
+	}
+	if len(unsymbolized) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d locations have no function information and are left out of the stacks, symbolize the profile to see them", len(unsymbolized)))
+	}
+	if len(synthesized) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d locations have no function information and are named after their mapping and address, symbolize the profile to see their functions", len(synthesized)))
+	}
+	if skippedSamples > 0 {
+		share := 0.0
+		if total != 0 {
+			share = float64(skippedValue) / float64(total) * 100
+		}
+		warnings = append(warnings, fmt.Sprintf("%d samples with %.2f%% of the total have no function information and only count in the total", skippedSamples, share))
+	}
+	if negativeStacks > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d stacks have negative values, e.g. of a diff profile, so percentages may exceed 100%%", negativeStacks))
+	}
+
+	r.merge(functionNodes, total)
+	r.warn(warnings)
+	return nil
+}
+
+// checkStrict returns an error if the profile has the data quality issues
+// failing the Strict option, given the value of its samples with frames
+// without function information and its total.
+func (a *Analyzer) checkStrict(p *Profile, unsymbolized, total int64) error {
+	if p.DurationNanos <= 0 {
+		return fmt.Errorf("strict: the profile has no duration")
+	}
+	if unsymbolized > 0 {
+		share := 100.0
+		if total != 0 {
+			share = float64(unsymbolized) / float64(total) * 100
+		}
+		if share > a.opts.MaxUnsymbolized {
+			return fmt.Errorf("strict: samples with %.2f%% of the total have frames without function information, more than %v%%", share, a.opts.MaxUnsymbolized)
+		}
+	}
+	return nil
+}
+
+// synthesizedFunctions returns the ids of the functions of the profile that
+// Normalize synthesized for unsymbolized locations.
+func synthesizedFunctions(p *Profile) map[uint64]bool {
+	ids := make(map[uint64]bool)
+	for _, fn := range p.Function {
+		if IsSynthesized(p, fn) {
+			ids[fn.Id] = true
+		}
+	}
+	return ids
+}
+
+// filterSamples returns the samples kept by the SampleFilter option, along with
+// the value of the dropped ones.
+func (a *Analyzer) filterSamples(samples []*Sample, valueIdx int, locations map[uint64]*Location, funcInfoMap map[uint64]FunctionInfo) ([]*Sample, int64) {
+	kept := make([]*Sample, 0, len(samples))
+	var dropped int64
+	for _, sample := range samples {
+		stack := make([]Stack, 0, len(sample.LocationId))
+		for i := len(sample.LocationId) - 1; i >= 0; i-- {
+			loc := locations[sample.LocationId[i]]
+			if loc == nil {
+				continue
+			}
+			for j := len(loc.Line) - 1; j >= 0; j-- {
+				if info, exists := funcInfoMap[loc.Line[j].FunctionId]; exists {
+					stack = append(stack, a.node(info, loc.Line[j].Line))
+				}
+			}
+		}
+		if a.opts.SampleFilter(sample, stack) {
+			kept = append(kept, sample)
+		} else if valueIdx < len(sample.Value) {
+			dropped += sample.Value[valueIdx]
+		}
+	}
+	return kept, dropped
+}
+
+// isLibrary reports whether the function is a library function for
+// BlameLibraries.
+func (a *Analyzer) isLibrary(info FunctionInfo) bool {
+	if a.opts.ShouldAttr(info.Name) {
+		return true
+	}
+	_, _, ok := ModuleVersion(info.FileName)
+	return ok
+}
+
+// blamedFrame returns the index of the frame blamed for the cpu of a stack by
+// BlameLibraries, given which frames are library functions: the outermost of
+// the library frames ending the stack, or the leaf if it is a user function.
+func blamedFrame(library []bool) int {
+	i := len(library) - 1
+	if !library[i] {
+		return i
+	}
+	for i > 0 && library[i-1] {
+		i--
+	}
+	return i
+}
+
+// hideFrames removes the frames marked in hidden from a stack, along with their
+// entries in attributable.
+func hideFrames(stack []Stack, attributable, hidden []bool) ([]Stack, []bool) {
+	n := 0
+	for i, entry := range stack {
+		if hidden[i] {
+			continue
+		}
+		stack[n], attributable[n] = entry, attributable[i]
+		n++
+	}
+	return stack[:n], attributable[:n]
+}
+
+// sampleIndex returns the index of the sample type to analyze.
+func (a *Analyzer) sampleIndex(p *Profile) (int, error) {
+	return SampleTypeIndex(p, a.opts.SampleType)
+}
+
+// SampleTypeIndex returns the index of the named sample type of the profile,
+// or of the cpu sample type if name is empty.
+func SampleTypeIndex(p *Profile, name string) (int, error) {
+	if name == "" {
+		if idx := CPUSampleIndex(p); idx != -1 {
+			return idx, nil
+		}
+		return -1, fmt.Errorf("no CPU samples found in profile")
+	}
+
+	for i, st := range p.SampleType {
+		if st.Type < int64(len(p.StringTable)) && p.StringTable[st.Type] == name {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("no %s samples found in profile", name)
+}
+
+// node returns the stack entry for a frame at the configured granularity.
+func (a *Analyzer) node(info FunctionInfo, line int64) Stack {
+	entry := Stack{Name: info.Name, FileName: info.FileName, Line: line}
+	switch a.opts.Granularity {
+	case GranularityLine:
+		entry.Name = fmt.Sprintf("%s:%d", info.Name, line)
+	case GranularityFile:
+		if info.FileName != "" {
+			entry.Name = info.FileName
+		}
+	}
+	return entry
+}
+
+// keep reports whether a sample with the stack passes the focus and ignore
+// filters.
+func (a *Analyzer) keep(stack []Stack) bool {
+	if a.opts.Focus == nil && a.opts.Ignore == nil {
+		return true
+	}
+
+	focused := a.opts.Focus == nil
+	for _, entry := range stack {
+		if a.opts.Ignore != nil && a.opts.Ignore.MatchString(entry.Name) {
+			return false
+		}
+		if a.opts.Focus != nil && a.opts.Focus.MatchString(entry.Name) {
+			focused = true
+		}
+	}
+	return focused
+}
@@ -0,0 +1,478 @@
+package pb
+
+import (
+	"cmp"
+	"errors"
+	"regexp"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func analyzerTestProfile() *Profile {
+	return &Profile{
+		StringTable: []string{"", "cpu", "nanoseconds", "main", "foo", "bar", "main.go", "foo.go"},
+		SampleType: []*ValueType{
+			{Type: 1, Unit: 2}, // cpu, nanoseconds
+		},
+		Function: []*Function{
+			{Id: 1, Name: 3, Filename: 6}, // main
+			{Id: 2, Name: 4, Filename: 7}, // foo
+			{Id: 3, Name: 5, Filename: 7}, // bar
+		},
+		Location: []*Location{
+			{Id: 1, Line: []*Line{{FunctionId: 1, Line: 10}}},
+			{Id: 2, Line: []*Line{{FunctionId: 2, Line: 20}}},
+			{Id: 3, Line: []*Line{{FunctionId: 2, Line: 21}}},
+			{Id: 4, Line: []*Line{{FunctionId: 3, Line: 30}}},
+		},
+		Sample: []*Sample{
+			{LocationId: []uint64{2, 1}, Value: []int64{30}}, // main->foo:20
+			{LocationId: []uint64{3, 1}, Value: []int64{20}}, // main->foo:21
+			{LocationId: []uint64{4, 1}, Value: []int64{50}}, // main->bar
+		},
+	}
+}
+
+func TestAnalyzerGranularity(t *testing.T) {
+	nodes, err := AnalyzeCPUProfile(analyzerTestProfile(), AnalyzeOptions{Granularity: GranularityLine})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+	if node := nodes["foo:20"]; node == nil || !almostEqual(node.SelfCPU, 30, 0.01) {
+		t.Errorf("Expected foo:20 self CPU 30%%, got %+v", node)
+	}
+
+	nodes, err = AnalyzeCPUProfile(analyzerTestProfile(), AnalyzeOptions{Granularity: GranularityFile})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+	if node := nodes["foo.go"]; node == nil || !almostEqual(node.SelfCPU, 100, 0.01) {
+		t.Errorf("Expected foo.go self CPU 100%%, got %+v", node)
+	}
+
+	if _, err := NewAnalyzer(AnalyzeOptions{Granularity: "package"}); err == nil {
+		t.Error("Expected error for unknown granularity, got nil")
+	}
+}
+
+func TestAnalyzerFilters(t *testing.T) {
+	nodes, err := AnalyzeCPUProfile(analyzerTestProfile(), AnalyzeOptions{
+		Focus: regexp.MustCompile("^foo$"),
+	})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+	if nodes["bar"] != nil {
+		t.Error("Expected bar to be filtered out by focus")
+	}
+	if main := nodes["main"]; main == nil || !almostEqual(main.TotalCPU, 50, 0.01) {
+		t.Errorf("Expected main total CPU 50%% of the profile, got %+v", main)
+	}
+
+	nodes, err = AnalyzeCPUProfile(analyzerTestProfile(), AnalyzeOptions{
+		Ignore: regexp.MustCompile("^foo$"),
+	})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+	if nodes["foo"] != nil {
+		t.Error("Expected foo to be filtered out by ignore")
+	}
+}
+
+func TestAnalyzerSampleFilter(t *testing.T) {
+	// by value
+	nodes, err := AnalyzeCPUProfile(analyzerTestProfile(), AnalyzeOptions{
+		SampleFilter: func(sample *Sample, _ []Stack) bool { return sample.Value[0] >= 30 },
+	})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+	if foo := nodes["foo"]; foo == nil || !almostEqual(foo.SelfCPU, 30, 0.01) {
+		t.Errorf("Expected foo self CPU 30%% of the profile, got %+v", foo)
+	}
+	if main := nodes["main"]; main == nil || !almostEqual(main.TotalCPU, 80, 0.01) {
+		t.Errorf("Expected main total CPU 80%%, got %+v", main)
+	}
+
+	// by stack, from the root to the leaf at the analysis granularity
+	var stacks [][]Stack
+	nodes, err = AnalyzeCPUProfile(analyzerTestProfile(), AnalyzeOptions{
+		Granularity: GranularityLine,
+		SampleFilter: func(_ *Sample, stack []Stack) bool {
+			stacks = append(stacks, stack)
+			return stack[len(stack)-1].Name == "foo:21"
+		},
+	})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+	if len(stacks) != 3 || stacks[0][0].Name != "main:10" || stacks[0][1].Name != "foo:20" {
+		t.Errorf("Expected stacks from root to leaf, got %+v", stacks)
+	}
+	if len(nodes) != 2 || nodes["foo:21"] == nil || !almostEqual(nodes["foo:21"].SelfCPU, 20, 0.01) {
+		t.Errorf("Expected only main:10 and foo:21, got %+v", nodes)
+	}
+}
+
+func TestAnalyzerAttribution(t *testing.T) {
+	nodes, err := AnalyzeCPUProfile(analyzerTestProfile(), AnalyzeOptions{
+		AttrCPU:    true,
+		ShouldAttr: func(name string) bool { return name == "bar" },
+	})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+	if main := nodes["main"]; !almostEqual(main.SelfAttrCPU, 50, 0.01) {
+		t.Errorf("Expected bar attributed to main, got main self attr CPU %.2f%%", main.SelfAttrCPU)
+	}
+}
+
+func TestAnalyzerInlinedFrames(t *testing.T) {
+	// bar inlined into foo at location 4, so foo is bar's caller
+	p := analyzerTestProfile()
+	p.Location[3].Line = []*Line{{FunctionId: 3, Line: 30}, {FunctionId: 2, Line: 22}}
+
+	nodes, err := AnalyzeCPUProfile(p, AnalyzeOptions{
+		AttrCPU:    true,
+		ShouldAttr: func(name string) bool { return name == "bar" },
+	})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+	if bar := nodes["bar"]; bar == nil || !almostEqual(bar.SelfCPU, 50, 0.01) {
+		t.Errorf("Expected bar self CPU 50%%, got %+v", bar)
+	}
+	if foo := nodes["foo"]; foo == nil || !almostEqual(foo.TotalCPU, 100, 0.01) || !almostEqual(foo.SelfAttrCPU, 100, 0.01) {
+		t.Errorf("Expected foo total CPU 100%% with bar attributed to it, got %+v", foo)
+	}
+	if main := nodes["main"]; !almostEqual(main.SelfAttrCPU, 0, 0.01) {
+		t.Errorf("Expected nothing attributed to main, got main self attr CPU %.2f%%", main.SelfAttrCPU)
+	}
+}
+
+func TestAnalyzerBlameLibraries(t *testing.T) {
+	b := NewBuilder([2]string{"cpu", "nanoseconds"})
+	lib := "/root/go/pkg/mod/github.com/lib/x@v1.0.0/x.go"
+	b.AddSample([]Stack{{Name: "runtime.mallocgc"}, {Name: "encoding/json.Marshal"}, {Name: "github.com/lib/x.Do", FileName: lib}, {Name: "main.handler"}}, []int64{60}, nil)
+	b.AddSample([]Stack{{Name: "main.handler"}}, []int64{20}, nil)
+	b.AddSample([]Stack{{Name: "strings.Clone"}, {Name: "main.handler"}}, []int64{20}, nil)
+
+	nodes, err := AnalyzeCPUProfile(b.Profile(), AnalyzeOptions{AttrCPU: true, BlameLibraries: true})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+	for name, want := range map[string]float64{"github.com/lib/x.Do": 60, "main.handler": 20, "strings.Clone": 20, "runtime.mallocgc": 0, "encoding/json.Marshal": 0} {
+		if node := nodes[name]; node == nil || !almostEqual(node.SelfAttrCPU, want, 0.01) {
+			t.Errorf("Expected %s self attr CPU %v%%, got %+v", name, want, node)
+		}
+	}
+	if node := nodes["runtime.mallocgc"]; !almostEqual(node.SelfCPU, 60, 0.01) {
+		t.Errorf("Expected runtime.mallocgc to keep its self CPU, got %.2f%%", node.SelfCPU)
+	}
+}
+
+func TestAnalyzerMaxDepth(t *testing.T) {
+	nodes, err := AnalyzeCPUProfile(analyzerTestProfile(), AnalyzeOptions{MaxDepth: 1})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+	if len(nodes) != 1 || !almostEqual(nodes["main"].SelfCPU, 100, 0.01) {
+		t.Errorf("Expected only main with all the self CPU, got %+v", nodes)
+	}
+
+	if _, err := NewAnalyzer(AnalyzeOptions{MaxDepth: -1}); err == nil {
+		t.Error("Expected error for negative max depth, got nil")
+	}
+	if _, err := NewAnalyzer(AnalyzeOptions{TrimBelow: 100}); err == nil {
+		t.Error("Expected error for trimming everything, got nil")
+	}
+}
+
+func TestAnalyzerHideRuntime(t *testing.T) {
+	isRuntime := func(name string) bool { return name == "foo" }
+
+	nodes, err := AnalyzeCPUProfile(analyzerTestProfile(), AnalyzeOptions{HideRuntime: true, IsRuntime: isRuntime})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+	if _, exists := nodes["foo"]; exists {
+		t.Error("Expected foo to be hidden")
+	}
+	if node := nodes["main"]; node == nil || !almostEqual(node.SelfCPU, 50, 0.01) || !almostEqual(node.TotalCPU, 100, 0.01) {
+		t.Errorf("Expected main self CPU 50%% and total 100%%, got %+v", node)
+	}
+
+	// Filters see the hidden frames.
+	nodes, err = AnalyzeCPUProfile(analyzerTestProfile(), AnalyzeOptions{
+		HideRuntime: true,
+		IsRuntime:   isRuntime,
+		Focus:       regexp.MustCompile("^foo$"),
+	})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+	if node := nodes["main"]; node == nil || !almostEqual(node.SelfCPU, 50, 0.01) {
+		t.Errorf("Expected main self CPU 50%%, got %+v", node)
+	}
+	if _, exists := nodes["bar"]; exists {
+		t.Error("Expected bar to be filtered out")
+	}
+}
+
+func TestAnalyzerConcurrentUse(t *testing.T) {
+	analyzer, err := NewAnalyzer(AnalyzeOptions{AttrCPU: true, ShouldAttr: func(string) bool { return false }})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nodes, err := analyzer.AnalyzeCPU(analyzerTestProfile())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !almostEqual(nodes["main"].TotalCPU, 100, 0.01) {
+				t.Errorf("Expected main total CPU 100%%, got %.2f%%", nodes["main"].TotalCPU)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestAnalyzerIngest(t *testing.T) {
+	a, err := NewAnalyzer(AnalyzeOptions{})
+	if err != nil {
+		t.Fatalf("NewAnalyzer failed: %v", err)
+	}
+
+	other := analyzerTestProfile()
+	other.Sample = other.Sample[2:] // main->bar only
+
+	report := a.NewReport()
+	var wg sync.WaitGroup
+	for _, p := range []*Profile{analyzerTestProfile(), other} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.Ingest(report, p); err != nil {
+				t.Errorf("Ingest failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if report.Profiles() != 2 || report.Total() != 150 {
+		t.Errorf("Expected 2 profiles with total 150, got %d and %d", report.Profiles(), report.Total())
+	}
+
+	nodes := report.Nodes()
+	if node := nodes["bar"]; node == nil || !almostEqual(node.SelfCPU, 100.0/150*100, 0.01) {
+		t.Errorf("Expected bar self CPU 66.67%%, got %+v", node)
+	}
+	if node := nodes["main"]; node == nil || !almostEqual(node.TotalCPU, 100, 0.01) || node.Children["bar"] != nodes["bar"] {
+		t.Errorf("Expected main total CPU 100%% with child bar, got %+v", node)
+	}
+
+	// Snapshots are not affected by later ingests.
+	if err := a.Ingest(report, other); err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	if !almostEqual(nodes["bar"].SelfCPU, 100.0/150*100, 0.01) {
+		t.Errorf("Expected snapshot to be unchanged, got %+v", nodes["bar"])
+	}
+}
+
+func TestReportMerge(t *testing.T) {
+	a, err := NewAnalyzer(AnalyzeOptions{})
+	if err != nil {
+		t.Fatalf("NewAnalyzer failed: %v", err)
+	}
+	other := analyzerTestProfile()
+	other.Sample = other.Sample[2:] // main->bar only
+
+	api, web := a.NewReport(), a.NewReport()
+	if err := a.Ingest(api, analyzerTestProfile()); err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	for range 2 {
+		if err := a.Ingest(web, other); err != nil {
+			t.Fatalf("Ingest failed: %v", err)
+		}
+	}
+
+	merged := a.NewReport()
+	merged.Merge(api)
+	merged.Merge(web)
+	if merged.Profiles() != 3 || merged.Total() != 200 {
+		t.Errorf("Expected 3 profiles with total 200, got %d and %d", merged.Profiles(), merged.Total())
+	}
+	nodes := merged.Nodes()
+	if node := nodes["bar"]; node == nil || !almostEqual(node.SelfCPU, 75, 0.01) || node.Samples != 3 || node.Callers != 1 {
+		t.Errorf("Expected bar self CPU 75%% in 3 samples, got %+v", node)
+	}
+	if node := nodes["main"]; node == nil || node.Children["foo"] != nodes["foo"] {
+		t.Errorf("Expected main with child foo, got %+v", node)
+	}
+
+	// Merging leaves the merged reports unchanged.
+	if web.Profiles() != 2 || web.Total() != 100 {
+		t.Errorf("Expected 2 profiles with total 100 in web, got %d and %d", web.Profiles(), web.Total())
+	}
+}
+
+func TestReportEach(t *testing.T) {
+	a, err := NewAnalyzer(AnalyzeOptions{})
+	if err != nil {
+		t.Fatalf("NewAnalyzer failed: %v", err)
+	}
+	r := a.NewReport()
+	if err := a.Ingest(r, analyzerTestProfile()); err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+
+	nodes := r.Nodes()
+	var names []string
+	err = r.Each(func(node *FunctionNode) error {
+		want := nodes[node.Name]
+		if node.SelfAttrCPU != want.SelfAttrCPU || node.Samples != want.Samples || node.Callers != want.Callers || node.Children != nil {
+			t.Errorf("Expected %s like Nodes without children, got %+v", node.Name, node)
+		}
+		names = append(names, node.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Each failed: %v", err)
+	}
+	if len(names) != len(nodes) || !slices.IsSortedFunc(names, func(a, b string) int {
+		return cmp.Compare(nodes[b].SelfAttrCPU, nodes[a].SelfAttrCPU)
+	}) {
+		t.Errorf("Expected every node by descending attributed cpu, got %v", names)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = r.Each(func(*FunctionNode) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("Expected Each to stop at the first error, got %v after %d calls", err, calls)
+	}
+}
+
+func TestAnalyzerCounts(t *testing.T) {
+	p := analyzerTestProfile()
+	p.Sample = append(p.Sample, &Sample{LocationId: []uint64{3, 2, 1}, Value: []int64{10}}) // main->foo->foo
+
+	nodes, err := AnalyzeCPUProfile(p, AnalyzeOptions{})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+
+	tests := []struct {
+		name                     string
+		samples, stacks, callers int
+		depth                    float64
+	}{
+		{"main", 4, 3, 0, 1},
+		{"foo", 3, 2, 2, 7.0 / 3}, // the two lines of main->foo are one stack, foo calls itself
+		{"bar", 1, 1, 1, 2},
+	}
+	for _, tt := range tests {
+		node := nodes[tt.name]
+		if node == nil || node.Samples != tt.samples || node.Stacks != tt.stacks || node.Callers != tt.callers || !almostEqual(node.Depth, tt.depth, 0.01) {
+			t.Errorf("Expected %s in %d samples, %d stacks with %d callers at depth %.2f, got %+v", tt.name, tt.samples, tt.stacks, tt.callers, tt.depth, node)
+		}
+	}
+
+	// Counts of the same stacks in several profiles add up samples only.
+	a, err := NewAnalyzer(AnalyzeOptions{})
+	if err != nil {
+		t.Fatalf("NewAnalyzer failed: %v", err)
+	}
+	report := a.NewReport()
+	for range 2 {
+		if err := a.Ingest(report, p); err != nil {
+			t.Fatalf("Ingest failed: %v", err)
+		}
+	}
+	if node := report.Nodes()["foo"]; node.Samples != 6 || node.Stacks != 2 || node.Callers != 2 {
+		t.Errorf("Expected foo in 6 samples, 2 stacks with 2 callers, got %+v", node)
+	}
+}
+
+func TestAnalyzerWarnings(t *testing.T) {
+	a, err := NewAnalyzer(AnalyzeOptions{})
+	if err != nil {
+		t.Fatalf("NewAnalyzer failed: %v", err)
+	}
+
+	p := analyzerTestProfile()
+	p.DurationNanos = 1e9
+	report := a.NewReport()
+	if err := a.Ingest(report, p); err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	if warnings := report.Warnings(); len(warnings) != 0 {
+		t.Errorf("Expected no warnings, got %q", warnings)
+	}
+
+	p.DurationNanos = 0
+	p.Location = append(p.Location, &Location{Id: 5})
+	p.Sample = append(p.Sample, &Sample{LocationId: []uint64{5}, Value: []int64{100}})
+	for range 2 {
+		if err := a.Ingest(report, p); err != nil {
+			t.Fatalf("Ingest failed: %v", err)
+		}
+	}
+	want := []string{
+		"the profile has no duration, so its cores and rates are unknown",
+		"1 locations have no function information and are left out of the stacks, symbolize the profile to see them",
+		"1 samples with 50.00% of the total have no function information and only count in the total",
+	}
+	if got := report.Warnings(); !slices.Equal(got, want) {
+		t.Errorf("Expected warnings %q once each, got %q", want, got)
+	}
+}
+
+func TestAnalyzerStrict(t *testing.T) {
+	a, err := NewAnalyzer(AnalyzeOptions{Strict: true, MaxUnsymbolized: 1})
+	if err != nil {
+		t.Fatalf("NewAnalyzer failed: %v", err)
+	}
+
+	p := analyzerTestProfile()
+	if err := a.Ingest(a.NewReport(), p); err == nil {
+		t.Error("Expected error for a profile without duration, got nil")
+	}
+
+	p.DurationNanos = 1e9
+	if err := a.Ingest(a.NewReport(), p); err != nil {
+		t.Errorf("Ingest failed: %v", err)
+	}
+
+	// main->? where the caller of main has no function information.
+	p.Location = append(p.Location, &Location{Id: 5})
+	p.Sample = append(p.Sample, &Sample{LocationId: []uint64{1, 5}, Value: []int64{1}})
+	if err := a.Ingest(a.NewReport(), p); err != nil {
+		t.Errorf("Expected 0.99%% of unsymbolized samples to be tolerated, got %v", err)
+	}
+	p.Sample[len(p.Sample)-1].Value[0] = 2
+	report := a.NewReport()
+	if err := a.Ingest(report, p); err == nil {
+		t.Error("Expected error for 1.96% of unsymbolized samples, got nil")
+	}
+	if report.Profiles() != 0 {
+		t.Errorf("Expected the failed profile to be left out of the report, got %d profiles", report.Profiles())
+	}
+
+	if _, err := NewAnalyzer(AnalyzeOptions{MaxUnsymbolized: 101}); err == nil {
+		t.Error("Expected error for max unsymbolized above 100%, got nil")
+	}
+}
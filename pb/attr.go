@@ -0,0 +1,32 @@
+package pb
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// AttrAlso returns a ShouldAttr option attributing the functions of
+// shouldAttr, stdlib functions if nil, and also the functions whose name
+// matches one of the patterns, where * matches any characters, e.g. the thin
+// wrappers of github.com/org/pkg/loggingwrapper.* so that their cpu is
+// collapsed into their callers like the one of stdlib functions.
+func AttrAlso(shouldAttr func(funcName string) bool, patterns []string) (func(funcName string) bool, error) {
+	if shouldAttr == nil {
+		shouldAttr = shouldAttrFn
+	}
+	var alternatives []string
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return nil, fmt.Errorf("empty attribution pattern")
+		}
+		alternatives = append(alternatives, strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*"))
+	}
+	if len(alternatives) == 0 {
+		return shouldAttr, nil
+	}
+	re := regexp.MustCompile("^(?:" + strings.Join(alternatives, "|") + ")$")
+	return func(funcName string) bool {
+		return shouldAttr(funcName) || re.MatchString(funcName)
+	}, nil
+}
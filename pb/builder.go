@@ -0,0 +1,97 @@
+package pb
+
+import "sort"
+
+// Builder incrementally assembles a Profile from stacks decoded out of other
+// profile formats, interning strings, functions and locations as it goes.
+type Builder struct {
+	profile   *Profile
+	strings   map[string]int64
+	functions map[Stack]uint64
+	locations map[Stack]uint64
+}
+
+// NewBuilder creates a Builder for a profile with the given sample types, each
+// given as a {type, unit} pair.
+func NewBuilder(sampleTypes ...[2]string) *Builder {
+	b := &Builder{
+		profile:   &Profile{StringTable: []string{""}},
+		strings:   map[string]int64{"": 0},
+		functions: make(map[Stack]uint64),
+		locations: make(map[Stack]uint64),
+	}
+	for _, st := range sampleTypes {
+		b.profile.SampleType = append(b.profile.SampleType, &ValueType{
+			Type: b.String(st[0]),
+			Unit: b.String(st[1]),
+		})
+	}
+	return b
+}
+
+// String interns s in the string table and returns its index.
+func (b *Builder) String(s string) int64 {
+	if idx, exists := b.strings[s]; exists {
+		return idx
+	}
+	idx := int64(len(b.profile.StringTable))
+	b.profile.StringTable = append(b.profile.StringTable, s)
+	b.strings[s] = idx
+	return idx
+}
+
+// location returns the id of the location for frame, creating it along with
+// its function if needed.
+func (b *Builder) location(frame Stack) uint64 {
+	if id, exists := b.locations[frame]; exists {
+		return id
+	}
+
+	fn := Stack{Name: frame.Name, FileName: frame.FileName}
+	funcID, exists := b.functions[fn]
+	if !exists {
+		funcID = uint64(len(b.profile.Function) + 1)
+		b.profile.Function = append(b.profile.Function, &Function{
+			Id:         funcID,
+			Name:       b.String(frame.Name),
+			SystemName: b.String(frame.Name),
+			Filename:   b.String(frame.FileName),
+		})
+		b.functions[fn] = funcID
+	}
+
+	id := uint64(len(b.profile.Location) + 1)
+	b.profile.Location = append(b.profile.Location, &Location{
+		Id:      id,
+		Address: frame.Address,
+		Line:    []*Line{{FunctionId: funcID, Line: frame.Line}},
+	})
+	b.locations[frame] = id
+	return id
+}
+
+// AddSample adds a sample for the stack, given leaf first, with one value per
+// sample type. Labels are attached as string labels.
+func (b *Builder) AddSample(stack []Stack, values []int64, labels map[string]string) {
+	sample := &Sample{
+		LocationId: make([]uint64, len(stack)),
+		Value:      values,
+	}
+	for i, frame := range stack {
+		sample.LocationId[i] = b.location(frame)
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sample.Label = append(sample.Label, &Label{Key: b.String(key), Str: b.String(labels[key])})
+	}
+	b.profile.Sample = append(b.profile.Sample, sample)
+}
+
+// Profile returns the assembled profile.
+func (b *Builder) Profile() *Profile {
+	return b.profile
+}
@@ -0,0 +1,186 @@
+package pb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ContentionSite is a call site in user code where goroutines blocked on a
+// lock or channel, aggregated over every sample that waited there.
+type ContentionSite struct {
+	Name        string
+	FileName    string
+	Line        int64
+	Contentions int64 // Number of times goroutines blocked at this site
+	Delay       int64 // Total wait time in nanoseconds
+	Stacks      []*ContentionStack
+}
+
+// ContentionStack is one distinct goroutine stack that contended at a site,
+// ordered from the lock site up to the goroutine entry point.
+type ContentionStack struct {
+	Frames      []Stack
+	Contentions int64
+	Delay       int64
+}
+
+// syncFramePrefixes are the frames that implement blocking itself, the lock site
+// is the first frame from the leaf that is not one of these.
+var syncFramePrefixes = []string{
+	"runtime.",
+	"sync.",
+	"internal/sync.",
+	"internal/poll.",
+}
+
+// AnalyzeContentionProfile clusters the samples of a block or mutex profile by
+// the call site that waited and returns the sites ordered by total wait time.
+//
+// Example:
+//
+//	sites, err := pb.AnalyzeContentionProfile(profile)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	for _, site := range sites {
+//	    fmt.Printf("%s:%d waited %dns\n", site.Name, site.Line, site.Delay)
+//	}
+func AnalyzeContentionProfile(p *Profile) ([]*ContentionSite, error) {
+	if err := Validate(p); err != nil {
+		return nil, err
+	}
+
+	countIdx, delayIdx := -1, -1
+	for i, st := range p.SampleType {
+		switch p.StringTable[st.Type] {
+		case "contentions":
+			countIdx = i
+		case "delay":
+			delayIdx = i
+		}
+	}
+	if delayIdx == -1 {
+		return nil, fmt.Errorf("no delay samples found in profile")
+	}
+
+	funcInfoMap := buildFunctionInfoMap(p)
+	locations := buildLocationMap(p)
+	sites := make(map[string]*ContentionSite)
+	stacks := make(map[string]*ContentionStack)
+
+	for _, sample := range p.Sample {
+		if len(sample.Value) <= delayIdx {
+			continue
+		}
+
+		var count int64
+		if countIdx != -1 && len(sample.Value) > countIdx {
+			count = sample.Value[countIdx]
+		}
+		delay := sample.Value[delayIdx]
+
+		// Build stack trace from leaf to root, skipping the blocking machinery
+		frames := make([]Stack, 0, len(sample.LocationId))
+		var siteLine int64
+		for _, id := range sample.LocationId {
+			loc := locations[id]
+			if loc == nil {
+				continue
+			}
+
+			// The functions inlined at the location come first, the site
+			// may be one of them
+			for _, line := range loc.Line {
+				info, exists := funcInfoMap[line.FunctionId]
+				if !exists {
+					continue
+				}
+				if len(frames) == 0 && isSyncFrame(info.Name) {
+					continue
+				}
+				if len(frames) == 0 {
+					siteLine = line.Line
+				}
+				frames = append(frames, Stack{Name: info.Name, FileName: info.FileName})
+			}
+		}
+		if len(frames) == 0 {
+			continue
+		}
+
+		siteKey := fmt.Sprintf("%s:%d", frames[0].Name, siteLine)
+		site, exists := sites[siteKey]
+		if !exists {
+			site = &ContentionSite{
+				Name:     frames[0].Name,
+				FileName: frames[0].FileName,
+				Line:     siteLine,
+			}
+			sites[siteKey] = site
+		}
+		site.Contentions += count
+		site.Delay += delay
+
+		key := siteKey + "|" + stackKey(frames)
+		stack, exists := stacks[key]
+		if !exists {
+			stack = &ContentionStack{Frames: frames}
+			stacks[key] = stack
+			site.Stacks = append(site.Stacks, stack)
+		}
+		stack.Contentions += count
+		stack.Delay += delay
+	}
+
+	if len(sites) == 0 {
+		return nil, fmt.Errorf("no contention recorded in profile")
+	}
+
+	result := make([]*ContentionSite, 0, len(sites))
+	for _, site := range sites {
+		sort.Slice(site.Stacks, func(i, j int) bool {
+			return site.Stacks[i].Delay > site.Stacks[j].Delay
+		})
+		result = append(result, site)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Delay != result[j].Delay {
+			return result[i].Delay > result[j].Delay
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// IsContentionProfile reports whether the profile is a block or mutex profile,
+// which record the delay goroutines waited for.
+func IsContentionProfile(p *Profile) bool {
+	for _, st := range p.SampleType {
+		if st.Type >= 0 && st.Type < int64(len(p.StringTable)) && p.StringTable[st.Type] == "delay" {
+			return true
+		}
+	}
+	return false
+}
+
+// isSyncFrame reports whether the function is part of the runtime or sync
+// machinery that implements blocking rather than the code that blocked.
+func isSyncFrame(funcName string) bool {
+	for _, prefix := range syncFramePrefixes {
+		if strings.HasPrefix(funcName, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// stackKey returns a key identifying the sequence of functions in frames.
+func stackKey(frames []Stack) string {
+	names := make([]string, len(frames))
+	for i, frame := range frames {
+		names[i] = frame.Name
+	}
+	return strings.Join(names, ";")
+}
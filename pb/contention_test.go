@@ -0,0 +1,91 @@
+package pb
+
+import "testing"
+
+func contentionTestProfile() *Profile {
+	return &Profile{
+		StringTable: []string{"", "contentions", "count", "delay", "nanoseconds",
+			"sync.(*Mutex).Lock", "main.(*Cache).Get", "main.handler", "main.worker"},
+		SampleType: []*ValueType{
+			{Type: 1, Unit: 2}, // contentions, count
+			{Type: 3, Unit: 4}, // delay, nanoseconds
+		},
+		Function: []*Function{
+			{Id: 1, Name: 5}, // sync.(*Mutex).Lock
+			{Id: 2, Name: 6}, // main.(*Cache).Get
+			{Id: 3, Name: 7}, // main.handler
+			{Id: 4, Name: 8}, // main.worker
+		},
+		Location: []*Location{
+			{Id: 1, Line: []*Line{{FunctionId: 1, Line: 10}}},
+			{Id: 2, Line: []*Line{{FunctionId: 2, Line: 42}}},
+			{Id: 3, Line: []*Line{{FunctionId: 3, Line: 7}}},
+			{Id: 4, Line: []*Line{{FunctionId: 4, Line: 3}}},
+		},
+		Sample: []*Sample{
+			{LocationId: []uint64{1, 2, 3}, Value: []int64{3, 300}}, // Lock <- Get <- handler
+			{LocationId: []uint64{1, 2, 4}, Value: []int64{1, 500}}, // Lock <- Get <- worker
+			{LocationId: []uint64{1, 3}, Value: []int64{2, 100}},    // Lock <- handler
+		},
+	}
+}
+
+func TestAnalyzeContentionProfile(t *testing.T) {
+	profile := contentionTestProfile()
+
+	sites, err := AnalyzeContentionProfile(profile)
+	if err != nil {
+		t.Fatalf("AnalyzeContentionProfile failed: %v", err)
+	}
+	if len(sites) != 2 {
+		t.Fatalf("Expected 2 contention sites, got %d", len(sites))
+	}
+
+	get := sites[0]
+	if get.Name != "main.(*Cache).Get" || get.Line != 42 {
+		t.Errorf("Expected top site main.(*Cache).Get:42, got %s:%d", get.Name, get.Line)
+	}
+	if get.Delay != 800 || get.Contentions != 4 {
+		t.Errorf("Expected delay 800 and 4 contentions, got %d and %d", get.Delay, get.Contentions)
+	}
+	if len(get.Stacks) != 2 || get.Stacks[0].Frames[1].Name != "main.worker" {
+		t.Errorf("Expected worker stack first, got %+v", get.Stacks)
+	}
+}
+
+func TestAnalyzeContentionProfileInlinedSite(t *testing.T) {
+	// Get inlined into handler at location 2, so the site is Get
+	profile := contentionTestProfile()
+	profile.Location[1].Line = []*Line{{FunctionId: 2, Line: 42}, {FunctionId: 3, Line: 8}}
+	profile.Sample = []*Sample{
+		{LocationId: []uint64{1, 2}, Value: []int64{2, 200}}, // Lock <- Get <- handler
+	}
+
+	sites, err := AnalyzeContentionProfile(profile)
+	if err != nil {
+		t.Fatalf("AnalyzeContentionProfile failed: %v", err)
+	}
+	if len(sites) != 1 {
+		t.Fatalf("Expected 1 contention site, got %d", len(sites))
+	}
+	if get := sites[0]; get.Name != "main.(*Cache).Get" || get.Line != 42 {
+		t.Errorf("Expected site main.(*Cache).Get:42, got %s:%d", get.Name, get.Line)
+	}
+	if frames := sites[0].Stacks[0].Frames; len(frames) != 2 || frames[1].Name != "main.handler" {
+		t.Errorf("Expected handler as the caller of the site, got %+v", frames)
+	}
+}
+
+func TestAnalyzeContentionProfileWithCPUProfile(t *testing.T) {
+	profile := &Profile{
+		StringTable: []string{"", "cpu", "nanoseconds"},
+		SampleType: []*ValueType{
+			{Type: 1, Unit: 2}, // cpu, nanoseconds
+		},
+	}
+
+	_, err := AnalyzeContentionProfile(profile)
+	if err == nil {
+		t.Error("Expected error for non-contention profile, got nil")
+	}
+}
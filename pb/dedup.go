@@ -0,0 +1,39 @@
+package pb
+
+import "encoding/binary"
+
+// uniqueStack is a sequence of locations along with the summed value and the
+// number of the samples that share it.
+type uniqueStack struct {
+	locations []uint64
+	value     int64
+	samples   int
+}
+
+// dedupStacks aggregates the samples with identical location sequences, so
+// that each distinct stack is resolved and analyzed once however many samples
+// recorded it. The stacks are returned in the order of their first sample.
+func dedupStacks(samples []*Sample, valueIdx int) []*uniqueStack {
+	index := make(map[string]*uniqueStack, len(samples)/4)
+	stacks := make([]*uniqueStack, 0, len(samples)/4)
+	key := make([]byte, 0, 256)
+	for _, sample := range samples {
+		if len(sample.Value) <= valueIdx {
+			continue
+		}
+
+		key = key[:0]
+		for _, id := range sample.LocationId {
+			key = binary.LittleEndian.AppendUint64(key, id)
+		}
+		stack, exists := index[string(key)]
+		if !exists {
+			stack = &uniqueStack{locations: sample.LocationId}
+			index[string(key)] = stack
+			stacks = append(stacks, stack)
+		}
+		stack.value += sample.Value[valueIdx]
+		stack.samples++
+	}
+	return stacks
+}
@@ -0,0 +1,45 @@
+package pb
+
+import "testing"
+
+func TestDedupStacks(t *testing.T) {
+	samples := []*Sample{
+		{LocationId: []uint64{2, 1}, Value: []int64{30}},
+		{LocationId: []uint64{4, 1}, Value: []int64{50}},
+		{LocationId: []uint64{2, 1}, Value: []int64{10}},
+		{LocationId: []uint64{1, 2}, Value: []int64{5}}, // same locations, other order
+		{LocationId: []uint64{4, 1}},                    // no value of the sample type
+	}
+
+	stacks := dedupStacks(samples, 0)
+	if len(stacks) != 3 {
+		t.Fatalf("Expected 3 stacks, got %d", len(stacks))
+	}
+	if s := stacks[0]; s.value != 40 || s.samples != 2 {
+		t.Errorf("Expected main->foo with value 40 in 2 samples, got %+v", s)
+	}
+	if s := stacks[1]; s.value != 50 || s.samples != 1 {
+		t.Errorf("Expected main->bar with value 50 in 1 sample, got %+v", s)
+	}
+}
+
+func TestAnalyzerDedup(t *testing.T) {
+	// Repeating every sample gives the same percentages and twice the counts.
+	p := analyzerTestProfile()
+	want, err := AnalyzeCPUProfile(p, AnalyzeOptions{})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+	p.Sample = append(p.Sample, analyzerTestProfile().Sample...)
+	got, err := AnalyzeCPUProfile(p, AnalyzeOptions{})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+
+	for name, w := range want {
+		g := got[name]
+		if g == nil || !almostEqual(g.SelfCPU, w.SelfCPU, 0.001) || !almostEqual(g.TotalCPU, w.TotalCPU, 0.001) || g.Samples != 2*w.Samples || g.ParentCount != 2*w.ParentCount || g.Stacks != w.Stacks {
+			t.Errorf("Expected %s like %+v with twice the samples, got %+v", name, w, g)
+		}
+	}
+}
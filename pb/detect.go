@@ -0,0 +1,62 @@
+package pb
+
+import "strings"
+
+// Profile types, deciding how a profile is analyzed.
+const (
+	TypeCPU       = "cpu"
+	TypeWall      = "wall"
+	TypeHeap      = "heap"
+	TypeGoroutine = "goroutine"
+	TypeBlock     = "block"
+	TypeMutex     = "mutex"
+)
+
+// typeSampleTypes are the sample types analyzed for the types analyzed like
+// cpu profiles, by preference, see DetectTypes.
+var typeSampleTypes = []struct {
+	typ         string
+	sampleTypes []string
+}{
+	{TypeWall, []string{"wall"}},
+	{TypeHeap, []string{"inuse_space", "alloc_space", "inuse_objects", "alloc_objects"}},
+	{TypeGoroutine, []string{"goroutine", "goroutines"}},
+}
+
+// DetectTypes returns the types the profile can be analyzed as, judging by its
+// sample types, most likely first. Block and mutex profiles can't be told
+// apart and are detected as TypeBlock, they are analyzed alike.
+func DetectTypes(p *Profile) []string {
+	var types []string
+	if CPUSampleIndex(p) != -1 {
+		types = append(types, TypeCPU)
+	}
+	for _, t := range typeSampleTypes {
+		if TypeSampleType(p, t.typ) != "" {
+			types = append(types, t.typ)
+		}
+	}
+	if IsContentionProfile(p) {
+		types = append(types, TypeBlock)
+	}
+	return types
+}
+
+// TypeSampleType returns the name of the sample type of the profile analyzed
+// for wall, heap and goroutine profiles, or "" if there is none or the type
+// is analyzed otherwise.
+func TypeSampleType(p *Profile, typ string) string {
+	for _, t := range typeSampleTypes {
+		if t.typ != typ {
+			continue
+		}
+		for _, name := range t.sampleTypes {
+			for _, st := range p.SampleType {
+				if st.Type >= 0 && st.Type < int64(len(p.StringTable)) && strings.EqualFold(p.StringTable[st.Type], name) {
+					return p.StringTable[st.Type]
+				}
+			}
+		}
+	}
+	return ""
+}
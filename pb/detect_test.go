@@ -0,0 +1,34 @@
+package pb
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDetectTypes(t *testing.T) {
+	tests := []struct {
+		sampleTypes [][2]string
+		want        []string
+		sampleType  string
+	}{
+		{[][2]string{{"samples", "count"}, {"cpu", "nanoseconds"}}, []string{TypeCPU}, ""},
+		{[][2]string{{"alloc_objects", "count"}, {"alloc_space", "bytes"}, {"inuse_objects", "count"}, {"inuse_space", "bytes"}}, []string{TypeHeap}, "inuse_space"},
+		{[][2]string{{"goroutine", "count"}}, []string{TypeGoroutine}, "goroutine"},
+		{[][2]string{{"contentions", "count"}, {"delay", "nanoseconds"}}, []string{TypeBlock}, ""},
+		{[][2]string{{"cpu-time", "nanoseconds"}, {"wall-time", "nanoseconds"}}, []string{TypeCPU}, ""},
+		{[][2]string{{"cpu", "nanoseconds"}, {"wall", "nanoseconds"}, {"alloc_space", "bytes"}}, []string{TypeCPU, TypeWall, TypeHeap}, ""},
+		{[][2]string{{"unknown", "count"}}, nil, ""},
+	}
+	for _, tt := range tests {
+		p := NewBuilder(tt.sampleTypes...).Profile()
+		got := DetectTypes(p)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Expected types %v for %v, got %v", tt.want, tt.sampleTypes, got)
+		}
+		if len(got) > 0 {
+			if st := TypeSampleType(p, got[0]); st != tt.sampleType {
+				t.Errorf("Expected sample type %q for %v, got %q", tt.sampleType, tt.sampleTypes, st)
+			}
+		}
+	}
+}
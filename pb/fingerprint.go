@@ -0,0 +1,122 @@
+package pb
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+)
+
+// Fingerprint returns a stable hash of the contents of a profile: its sample
+// and period types, its time and duration, and its samples with their values,
+// labels and the functions, files and lines of their stacks. It does not
+// depend on how the profile is encoded, e.g. its compression, the order of its
+// string table or the ids of its functions and locations, so that reports and
+// stored profiles with the same fingerprint are of the same profile.
+func Fingerprint(p *Profile) string {
+	sum := sha256.New()
+	h := &fingerprint{strings: p.StringTable}
+
+	h.int(int64(len(p.SampleType)))
+	for _, st := range p.SampleType {
+		h.valueType(st)
+	}
+	h.valueType(p.PeriodType)
+	h.int(p.Period)
+	h.int(p.TimeNanos)
+	h.int(p.DurationNanos)
+	h.int(int64(len(p.Sample)))
+	h.flush(sum)
+
+	functions := make(map[uint64]*Function, len(p.Function))
+	for _, fn := range p.Function {
+		functions[fn.Id] = fn
+	}
+	locations := make(map[uint64][]byte, len(p.Location))
+	for _, loc := range p.Location {
+		locations[loc.Id] = locationKey(loc, functions, p.StringTable)
+	}
+
+	for _, sample := range p.Sample {
+		h.int(int64(len(sample.LocationId)))
+		for _, id := range sample.LocationId {
+			h.bytes(locations[id])
+		}
+		h.int(int64(len(sample.Value)))
+		for _, v := range sample.Value {
+			h.int(v)
+		}
+		h.int(int64(len(sample.Label)))
+		for _, label := range sample.Label {
+			h.str(label.Key)
+			h.str(label.Str)
+			h.int(label.Num)
+			h.str(label.NumUnit)
+		}
+		h.flush(sum)
+	}
+
+	return hex.EncodeToString(sum.Sum(nil)[:16])
+}
+
+// locationKey returns the encoding of a location hashed by Fingerprint, its
+// address if it has no lines.
+func locationKey(loc *Location, functions map[uint64]*Function, strings []string) []byte {
+	h := &fingerprint{strings: strings}
+	if len(loc.Line) == 0 {
+		h.int(int64(loc.Address))
+	}
+	for _, line := range loc.Line {
+		fn := functions[line.FunctionId]
+		if fn == nil {
+			fn = &Function{}
+		}
+		h.str(fn.Name)
+		h.str(fn.SystemName)
+		h.str(fn.Filename)
+		h.int(line.Line)
+	}
+	return h.buf
+}
+
+// fingerprint encodes the fields of a profile hashed by Fingerprint
+// unambiguously, with the length of every variable sized field first.
+type fingerprint struct {
+	strings []string
+	buf     []byte
+}
+
+// flush writes the fields encoded so far to the hash.
+func (f *fingerprint) flush(h hash.Hash) {
+	h.Write(f.buf)
+	f.buf = f.buf[:0]
+}
+
+func (f *fingerprint) bytes(b []byte) {
+	f.int(int64(len(b)))
+	f.buf = append(f.buf, b...)
+}
+
+func (f *fingerprint) int(v int64) {
+	f.buf = binary.LittleEndian.AppendUint64(f.buf, uint64(v))
+}
+
+// str encodes the string at an index of the string table, empty if it is out
+// of range.
+func (f *fingerprint) str(idx int64) {
+	var s string
+	if idx >= 0 && idx < int64(len(f.strings)) {
+		s = f.strings[idx]
+	}
+	f.int(int64(len(s)))
+	f.buf = append(f.buf, s...)
+}
+
+func (f *fingerprint) valueType(vt *ValueType) {
+	if vt == nil {
+		f.int(-1)
+		return
+	}
+	f.str(vt.Type)
+	f.str(vt.Unit)
+}
@@ -0,0 +1,38 @@
+package pb
+
+import "testing"
+
+func TestFingerprint(t *testing.T) {
+	p := analyzerTestProfile()
+	want := Fingerprint(p)
+	if len(want) != 32 {
+		t.Fatalf("Expected 32 hex digits, got %q", want)
+	}
+
+	// The same profile with other ids and another order of the string table.
+	other := analyzerTestProfile()
+	other.StringTable = []string{"", "bar", "foo", "main", "cpu", "nanoseconds", "foo.go", "main.go"}
+	other.SampleType = []*ValueType{{Type: 4, Unit: 5}}
+	other.Function = []*Function{
+		{Id: 7, Name: 3, Filename: 7}, // main
+		{Id: 8, Name: 2, Filename: 6}, // foo
+		{Id: 9, Name: 1, Filename: 6}, // bar
+	}
+	for _, loc := range other.Location {
+		loc.Id += 10
+		loc.Line[0].FunctionId += 6
+	}
+	for _, sample := range other.Sample {
+		for i := range sample.LocationId {
+			sample.LocationId[i] += 10
+		}
+	}
+	if got := Fingerprint(other); got != want {
+		t.Errorf("Expected the fingerprint of the renumbered profile to be %s, got %s", want, got)
+	}
+
+	other.Sample[0].Value[0]++
+	if got := Fingerprint(other); got == want {
+		t.Errorf("Expected another fingerprint for other values, got %s", got)
+	}
+}
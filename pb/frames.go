@@ -0,0 +1,50 @@
+package pb
+
+// Frames returns the function names of every sample of the profile, from the
+// root to the leaf, including the functions inlined at each location.
+func Frames(p *Profile) [][]string {
+	names := make(map[uint64]string, len(p.Function))
+	for _, fn := range p.Function {
+		names[fn.Id] = p.StringTable[fn.Name]
+	}
+	locations := make(map[uint64][]string, len(p.Location))
+	for _, loc := range p.Location {
+		frames := make([]string, 0, len(loc.Line))
+		for j := len(loc.Line) - 1; j >= 0; j-- {
+			frames = append(frames, names[loc.Line[j].FunctionId])
+		}
+		locations[loc.Id] = frames
+	}
+
+	stacks := make([][]string, len(p.Sample))
+	for i, sample := range p.Sample {
+		for j := len(sample.LocationId) - 1; j >= 0; j-- {
+			stacks[i] = append(stacks[i], locations[sample.LocationId[j]]...)
+		}
+	}
+	return stacks
+}
+
+// KeepFrames reports whether a sample with the frames, as returned by Frames,
+// passes the focus and ignore filters of the options.
+func KeepFrames(frames []string, opts AnalyzeOptions) bool {
+	focused := opts.Focus == nil
+	for _, name := range frames {
+		if opts.Ignore != nil && opts.Ignore.MatchString(name) {
+			return false
+		}
+		if opts.Focus != nil && opts.Focus.MatchString(name) {
+			focused = true
+		}
+	}
+	return focused
+}
+
+// TrimFrames returns the frames of a sample, as returned by Frames, truncated
+// to the MaxDepth of the options.
+func TrimFrames(frames []string, opts AnalyzeOptions) []string {
+	if opts.MaxDepth > 0 && len(frames) > opts.MaxDepth {
+		return frames[:opts.MaxDepth]
+	}
+	return frames
+}
@@ -0,0 +1,40 @@
+package pb
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func FuzzParse(f *testing.F) {
+	for _, p := range []*Profile{analyzerTestProfile(), contentionTestProfile()} {
+		data, err := proto.Marshal(p)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p, err := Parse(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if err := Validate(p); err != nil {
+			// The analyzers must reject what Validate rejects instead of
+			// panicking.
+			if _, err := AnalyzeCPUProfile(p, AnalyzeOptions{}); err == nil {
+				t.Error("AnalyzeCPUProfile accepted an invalid profile")
+			}
+			return
+		}
+
+		Normalize(p)
+		opts := AnalyzeOptions{AttrCPU: true, ShouldAttr: func(name string) bool { return len(name)%2 == 0 }}
+		AnalyzeCPUProfile(p, opts)
+		AnalyzeCPUProfile(p, AnalyzeOptions{Granularity: GranularityLine})
+		AnalyzeContentionProfile(p)
+		AnalyzeCPUByLabel(p, opts, "key")
+	})
+}
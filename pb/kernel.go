@@ -0,0 +1,177 @@
+package pb
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// KernelFrame names the frames of kernel code that isn't symbolized, see
+// SymbolizeKernel.
+const KernelFrame = "[kernel]"
+
+// userPseudoFiles are the bracketed mappings of /proc/<pid>/maps that hold
+// user space code or data rather than kernel modules.
+var userPseudoFiles = map[string]bool{
+	"[vdso]":     true,
+	"[vvar]":     true,
+	"[vsyscall]": true,
+	"[heap]":     true,
+	"[stack]":    true,
+	"[uprobes]":  true,
+	"[unknown]":  true,
+}
+
+// IsKernelFile reports whether a mapping or file name of a frame is the kernel
+// or one of its modules, as named by perf ([kernel.kallsyms], [nf_conntrack])
+// and eBPF agents ([kernel], vmlinux).
+func IsKernelFile(name string) bool {
+	if strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]") {
+		return !userPseudoFiles[name] && !strings.HasPrefix(name, "[anon")
+	}
+	base := filepath.Base(name)
+	return base == "vmlinux" || strings.HasPrefix(base, "vmlinux-")
+}
+
+// isKernelAddress reports whether addr is in the upper half of the address
+// space, where 64-bit kernels are mapped on x86-64, arm64, riscv64 and ppc64
+// while user space is in the lower half. Kernels of 32-bit systems are only
+// recognized by their mapping.
+func isKernelAddress(addr uint64) bool {
+	return addr>>63 == 1
+}
+
+// kernelLocations returns whether a location of the profile is kernel code,
+// by its mapping, its address or the name and file of its functions.
+func kernelLocations(p *Profile) func(loc *Location) bool {
+	mappings := make(map[uint64]bool)
+	for _, m := range p.Mapping {
+		if IsKernelFile(p.StringTable[m.Filename]) {
+			mappings[m.Id] = true
+		}
+	}
+	functions := make(map[uint64]bool)
+	for _, fn := range p.Function {
+		if p.StringTable[fn.Name] == KernelFrame || IsKernelFile(p.StringTable[fn.Filename]) {
+			functions[fn.Id] = true
+		}
+	}
+
+	return func(loc *Location) bool {
+		if mappings[loc.MappingId] || isKernelAddress(loc.Address) {
+			return true
+		}
+		for _, line := range loc.Line {
+			if functions[line.FunctionId] {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SymbolizeKernel names the [kernel] frames of the profile after the kernel
+// symbol containing their address, as looked up by symbol, e.g. in the
+// symbols of /proc/kallsyms. Frames of modules are filed under the module,
+// others under [kernel.kallsyms]. It returns the number of frames named.
+func SymbolizeKernel(p *Profile, symbol func(addr uint64) (name, module string, ok bool)) int {
+	names := make(map[uint64]string, len(p.Function))
+	var nextFuncID uint64
+	for _, fn := range p.Function {
+		names[fn.Id] = p.StringTable[fn.Name]
+		nextFuncID = max(nextFuncID, fn.Id)
+	}
+
+	intern := stringInterner(p)
+	functions := make(map[[2]string]uint64)
+	symbolized := 0
+	for _, loc := range p.Location {
+		if loc.Address == 0 || len(loc.Line) != 1 || names[loc.Line[0].FunctionId] != KernelFrame {
+			continue
+		}
+		name, module, ok := symbol(loc.Address)
+		if !ok {
+			continue
+		}
+		file := "[kernel.kallsyms]"
+		if module != "" {
+			file = "[" + module + "]"
+		}
+
+		key := [2]string{name, file}
+		id, exists := functions[key]
+		if !exists {
+			nextFuncID++
+			id = nextFuncID
+			p.Function = append(p.Function, &Function{
+				Id:         id,
+				Name:       intern(name),
+				SystemName: intern(name),
+				Filename:   intern(file),
+			})
+			functions[key] = id
+		}
+		loc.Line = []*Line{{FunctionId: id}}
+		symbolized++
+	}
+	return symbolized
+}
+
+// FoldKernel removes the kernel frames at the leaf of every sample so that the
+// time spent in the kernel is attributed to the user frame calling into it,
+// such as the syscall wrapper. Samples entirely in the kernel, such as those
+// of kernel threads, are left with a single [kernel] frame. It returns the
+// number of samples folded.
+func FoldKernel(p *Profile) int {
+	isKernel := kernelLocations(p)
+	locations := make(map[uint64]*Location, len(p.Location))
+	for _, loc := range p.Location {
+		locations[loc.Id] = loc
+	}
+
+	var kernelLoc uint64
+	folded := 0
+	for _, sample := range p.Sample {
+		n := 0
+		for n < len(sample.LocationId) && locations[sample.LocationId[n]] != nil && isKernel(locations[sample.LocationId[n]]) {
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		folded++
+		if n < len(sample.LocationId) {
+			sample.LocationId = sample.LocationId[n:]
+			continue
+		}
+		if kernelLoc == 0 {
+			kernelLoc = addKernelLocation(p)
+		}
+		sample.LocationId = []uint64{kernelLoc}
+	}
+	return folded
+}
+
+// addKernelLocation adds a location of an unsymbolized [kernel] frame to the
+// profile and returns its id.
+func addKernelLocation(p *Profile) uint64 {
+	var funcID, locID uint64
+	for _, fn := range p.Function {
+		funcID = max(funcID, fn.Id)
+	}
+	for _, loc := range p.Location {
+		locID = max(locID, loc.Id)
+	}
+
+	intern := stringInterner(p)
+	p.Function = append(p.Function, &Function{
+		Id:         funcID + 1,
+		Name:       intern(KernelFrame),
+		SystemName: intern(KernelFrame),
+		Filename:   intern("[kernel.kallsyms]"),
+	})
+	p.Location = append(p.Location, &Location{
+		Id:   locID + 1,
+		Line: []*Line{{FunctionId: funcID + 1}},
+	})
+	return locID + 1
+}
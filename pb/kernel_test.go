@@ -0,0 +1,94 @@
+package pb
+
+import "testing"
+
+// kernelProfile has a syscall sample entering the kernel at an unsymbolized
+// address, a sample of a perf symbolized kernel frame and a kernel-only sample.
+func kernelProfile() *Profile {
+	p := &Profile{
+		StringTable: []string{"", "cpu", "nanoseconds", "syscall.Syscall", "main.main", "[kernel.kallsyms]", "tcp_sendmsg"},
+		SampleType:  []*ValueType{{Type: 1, Unit: 2}},
+		Mapping:     []*Mapping{{Id: 1, MemoryStart: 0xffffffff81000000, MemoryLimit: 0xffffffff82000000, Filename: 5}},
+		Function: []*Function{
+			{Id: 1, Name: 3},
+			{Id: 2, Name: 4},
+			{Id: 3, Name: 6, Filename: 5},
+		},
+		Location: []*Location{
+			{Id: 1, Line: []*Line{{FunctionId: 1}}},
+			{Id: 2, Line: []*Line{{FunctionId: 2}}},
+			{Id: 3, MappingId: 1, Address: 0xffffffff81a2b010},
+			{Id: 4, Address: 0xffffffff81c00010},
+			{Id: 5, Line: []*Line{{FunctionId: 3}}},
+		},
+		Sample: []*Sample{
+			{LocationId: []uint64{3, 4, 1, 2}, Value: []int64{50}},
+			{LocationId: []uint64{5, 1, 2}, Value: []int64{25}},
+			{LocationId: []uint64{3}, Value: []int64{25}},
+		},
+	}
+	Normalize(p)
+	return p
+}
+
+func TestKernelFrames(t *testing.T) {
+	p := kernelProfile()
+	nodes, err := AnalyzeCPUProfile(p, AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kernel := nodes[KernelFrame]; kernel == nil || !almostEqual(kernel.SelfCPU, 75, 0.01) {
+		t.Errorf("Expected unsymbolized kernel code as %s with 75%%, got %+v", KernelFrame, kernel)
+	}
+
+	symbols := map[uint64]string{0xffffffff81a2b010: "do_syscall_64", 0xffffffff81c00010: "entry_SYSCALL_64"}
+	symbolized := SymbolizeKernel(p, func(addr uint64) (string, string, bool) {
+		name, ok := symbols[addr]
+		return name, "", ok
+	})
+	if symbolized != 2 {
+		t.Errorf("Expected 2 frames symbolized, got %d", symbolized)
+	}
+	nodes, _ = AnalyzeCPUProfile(p, AnalyzeOptions{})
+	if fn := nodes["do_syscall_64"]; fn == nil || fn.FileName != "[kernel.kallsyms]" || !almostEqual(fn.SelfCPU, 75, 0.01) {
+		t.Errorf("Expected do_syscall_64 in [kernel.kallsyms] with 75%%, got %+v", fn)
+	}
+	if nodes[KernelFrame] != nil {
+		t.Errorf("Expected no %s frames left, got %+v", KernelFrame, nodes[KernelFrame])
+	}
+}
+
+func TestFoldKernel(t *testing.T) {
+	p := kernelProfile()
+	if folded := FoldKernel(p); folded != 3 {
+		t.Errorf("Expected 3 samples folded, got %d", folded)
+	}
+	nodes, err := AnalyzeCPUProfile(p, AnalyzeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fn := nodes["syscall.Syscall"]; fn == nil || !almostEqual(fn.SelfCPU, 75, 0.01) {
+		t.Errorf("Expected the kernel time of syscalls attributed to syscall.Syscall, got %+v", fn)
+	}
+	if nodes["tcp_sendmsg"] != nil {
+		t.Errorf("Expected symbolized kernel frames folded too, got %+v", nodes["tcp_sendmsg"])
+	}
+	if kernel := nodes[KernelFrame]; kernel == nil || !almostEqual(kernel.SelfCPU, 25, 0.01) {
+		t.Errorf("Expected the kernel-only sample as %s with 25%%, got %+v", KernelFrame, kernel)
+	}
+}
+
+func TestIsKernelFile(t *testing.T) {
+	for name, want := range map[string]bool{
+		"[kernel.kallsyms]":   true,
+		"[nf_conntrack]":      true,
+		"/boot/vmlinux-6.8.0": true,
+		"[vdso]":              false,
+		"[anon:go]":           false,
+		"/usr/lib/libc.so.6":  false,
+	} {
+		if got := IsKernelFile(name); got != want {
+			t.Errorf("Expected IsKernelFile(%q) %v, got %v", name, want, got)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package pb
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// NoLabelValue is the label value reported for samples without the label.
+const NoLabelValue = "(none)"
+
+// SampleLabel returns the value of the label key on the sample. Numeric labels
+// are formatted in decimal.
+func SampleLabel(p *Profile, sample *Sample, key string) (string, bool) {
+	for _, label := range sample.Label {
+		if label.Key >= int64(len(p.StringTable)) || p.StringTable[label.Key] != key {
+			continue
+		}
+		if label.Str != 0 && label.Str < int64(len(p.StringTable)) {
+			return p.StringTable[label.Str], true
+		}
+		return strconv.FormatInt(label.Num, 10), true
+	}
+	return "", false
+}
+
+// LabelPivot is the attributed cpu of every function broken down by the values
+// of one sample label.
+type LabelPivot struct {
+	Key       string
+	Values    []string // Label values, by descending cpu
+	Functions []string // Function names, by descending cpu
+	FileNames map[string]string
+	// CPU maps function name and label value to the function's attributed cpu
+	// in samples with that value, as a percentage of the whole profile.
+	CPU map[string]map[string]float64
+	// ValueCPU is the share of the profile's cpu of each label value.
+	ValueCPU map[string]float64
+}
+
+// AnalyzeCPUByLabel analyzes the cpu profile separately for each value of the
+// label key, so that the cost of functions can be attributed to e.g. the
+// http.route that drove it.
+func AnalyzeCPUByLabel(p *Profile, opts AnalyzeOptions, key string) (*LabelPivot, error) {
+	if p == nil {
+		return nil, fmt.Errorf("nil profile")
+	}
+
+	analyzer, err := NewAnalyzer(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	totalCPU := TotalCPU(p)
+	if totalCPU == 0 {
+		return nil, fmt.Errorf("no CPU time recorded in profile")
+	}
+
+	groups := make(map[string][]*Sample)
+	for _, sample := range p.Sample {
+		value, ok := SampleLabel(p, sample, key)
+		if !ok {
+			value = NoLabelValue
+		}
+		groups[value] = append(groups[value], sample)
+	}
+
+	pivot := &LabelPivot{
+		Key:       key,
+		FileNames: make(map[string]string),
+		CPU:       make(map[string]map[string]float64),
+		ValueCPU:  make(map[string]float64),
+	}
+	functionCPU := make(map[string]float64)
+
+	for value, samples := range groups {
+		group := withSamples(p, samples)
+		groupCPU := TotalCPU(group)
+		if groupCPU == 0 {
+			continue
+		}
+		share := float64(groupCPU) / float64(totalCPU)
+
+		nodes, err := analyzer.AnalyzeCPU(group)
+		if err != nil {
+			return nil, fmt.Errorf("label %s=%s: %w", key, value, err)
+		}
+
+		pivot.Values = append(pivot.Values, value)
+		pivot.ValueCPU[value] = share * 100
+		for name, node := range nodes {
+			if node.SelfAttrCPU == 0 {
+				continue
+			}
+			if pivot.CPU[name] == nil {
+				pivot.CPU[name] = make(map[string]float64)
+				pivot.FileNames[name] = node.FileName
+			}
+			pivot.CPU[name][value] = node.SelfAttrCPU * share
+			functionCPU[name] += node.SelfAttrCPU * share
+		}
+	}
+
+	for name := range pivot.CPU {
+		pivot.Functions = append(pivot.Functions, name)
+	}
+	sort.Slice(pivot.Values, func(i, j int) bool {
+		a, b := pivot.Values[i], pivot.Values[j]
+		if x, y := roundPercent(pivot.ValueCPU[a]), roundPercent(pivot.ValueCPU[b]); x != y {
+			return x > y
+		}
+		return a < b
+	})
+	sort.Slice(pivot.Functions, func(i, j int) bool {
+		a, b := pivot.Functions[i], pivot.Functions[j]
+		if x, y := roundPercent(functionCPU[a]), roundPercent(functionCPU[b]); x != y {
+			return x > y
+		}
+		return a < b
+	})
+
+	return pivot, nil
+}
+
+// roundPercent rounds away the floating point error of summing shares, so that
+// functions with the same cpu are ordered by name.
+func roundPercent(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
@@ -0,0 +1,46 @@
+package pb
+
+import "testing"
+
+func TestAnalyzeCPUByLabel(t *testing.T) {
+	profile := &Profile{
+		StringTable: []string{"", "cpu", "nanoseconds", "main", "render", "query", "http.route", "/users", "/orders"},
+		SampleType: []*ValueType{
+			{Type: 1, Unit: 2}, // cpu, nanoseconds
+		},
+		Function: []*Function{
+			{Id: 1, Name: 3}, // main
+			{Id: 2, Name: 4}, // render
+			{Id: 3, Name: 5}, // query
+		},
+		Location: []*Location{
+			{Id: 1, Line: []*Line{{FunctionId: 1}}},
+			{Id: 2, Line: []*Line{{FunctionId: 2}}},
+			{Id: 3, Line: []*Line{{FunctionId: 3}}},
+		},
+		Sample: []*Sample{
+			{LocationId: []uint64{2, 1}, Value: []int64{50}, Label: []*Label{{Key: 6, Str: 7}}}, // /users: render
+			{LocationId: []uint64{3, 1}, Value: []int64{10}, Label: []*Label{{Key: 6, Str: 7}}}, // /users: query
+			{LocationId: []uint64{3, 1}, Value: []int64{30}, Label: []*Label{{Key: 6, Str: 8}}}, // /orders: query
+			{LocationId: []uint64{1}, Value: []int64{10}},                                       // unlabeled: main
+		},
+	}
+
+	pivot, err := AnalyzeCPUByLabel(profile, AnalyzeOptions{}, "http.route")
+	if err != nil {
+		t.Fatalf("AnalyzeCPUByLabel failed: %v", err)
+	}
+
+	if want := []string{"/users", "/orders", NoLabelValue}; len(pivot.Values) != 3 || pivot.Values[0] != want[0] || pivot.Values[1] != want[1] {
+		t.Errorf("Expected values %v, got %v", want, pivot.Values)
+	}
+	if pivot.Functions[0] != "render" {
+		t.Errorf("Expected render to be the top function, got %s", pivot.Functions[0])
+	}
+	if cpu := pivot.CPU["query"]["/orders"]; !almostEqual(cpu, 30, 0.01) {
+		t.Errorf("Expected query cpu for /orders 30%%, got %.2f%%", cpu)
+	}
+	if cpu := pivot.CPU["query"]["/users"]; !almostEqual(cpu, 10, 0.01) {
+		t.Errorf("Expected query cpu for /users 10%%, got %.2f%%", cpu)
+	}
+}
@@ -0,0 +1,216 @@
+package pb
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Merge combines profiles with the same sample types into one, scaling the
+// values of each profile's samples by its weight. A nil weights slice weighs
+// every profile 1. Identical mappings, functions, locations and samples are
+// merged, so merging a profile with itself doubles its values.
+func Merge(profiles []*Profile, weights []float64) (*Profile, error) {
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no profiles to merge")
+	}
+	if weights != nil && len(weights) != len(profiles) {
+		return nil, fmt.Errorf("got %d weights for %d profiles", len(weights), len(profiles))
+	}
+
+	first := profiles[0]
+	if err := Validate(first); err != nil {
+		return nil, err
+	}
+	m := &merger{
+		b:         NewBuilder(),
+		mappings:  make(map[string]uint64),
+		functions: make(map[string]uint64),
+		locations: make(map[string]uint64),
+		samples:   make(map[string]*Sample),
+	}
+	out := m.b.profile
+	for _, st := range first.SampleType {
+		out.SampleType = append(out.SampleType, m.valueType(first, st))
+	}
+	if first.PeriodType != nil {
+		out.PeriodType = m.valueType(first, first.PeriodType)
+	}
+	out.Period = first.Period
+	out.DefaultSampleType = m.b.String(first.StringTable[first.DefaultSampleType])
+
+	for i, p := range profiles {
+		if err := Validate(p); err != nil {
+			return nil, fmt.Errorf("profile %d: %w", i, err)
+		}
+		if err := checkSampleTypes(first, p); err != nil {
+			return nil, fmt.Errorf("profile %d: %w", i, err)
+		}
+
+		weight := 1.0
+		if weights != nil {
+			weight = weights[i]
+		}
+		m.add(p, weight)
+
+		if p.TimeNanos != 0 && (out.TimeNanos == 0 || p.TimeNanos < out.TimeNanos) {
+			out.TimeNanos = p.TimeNanos
+		}
+		out.DurationNanos += p.DurationNanos
+	}
+
+	return out, nil
+}
+
+// checkSampleTypes returns an error unless p has the same sample types as want.
+func checkSampleTypes(want, p *Profile) error {
+	if len(want.SampleType) != len(p.SampleType) {
+		return fmt.Errorf("got %d sample types, want %d", len(p.SampleType), len(want.SampleType))
+	}
+	for i, st := range p.SampleType {
+		got := p.StringTable[st.Type] + "/" + p.StringTable[st.Unit]
+		exp := want.StringTable[want.SampleType[i].Type] + "/" + want.StringTable[want.SampleType[i].Unit]
+		if got != exp {
+			return fmt.Errorf("sample type %d is %s, want %s", i, got, exp)
+		}
+	}
+	return nil
+}
+
+// merger accumulates profiles into the profile of a Builder, keying every entry
+// by its contents so that entries shared between profiles are merged.
+type merger struct {
+	b         *Builder
+	mappings  map[string]uint64
+	functions map[string]uint64
+	locations map[string]uint64
+	samples   map[string]*Sample
+}
+
+func (m *merger) valueType(p *Profile, vt *ValueType) *ValueType {
+	return &ValueType{
+		Type: m.b.String(p.StringTable[vt.Type]),
+		Unit: m.b.String(p.StringTable[vt.Unit]),
+	}
+}
+
+// add merges the samples of a validated profile with their values scaled by
+// weight.
+func (m *merger) add(p *Profile, weight float64) {
+	out := m.b.profile
+
+	mappingIDs := make(map[uint64]uint64, len(p.Mapping))
+	for _, mapping := range p.Mapping {
+		mm := &Mapping{
+			MemoryStart:     mapping.MemoryStart,
+			MemoryLimit:     mapping.MemoryLimit,
+			FileOffset:      mapping.FileOffset,
+			Filename:        m.b.String(p.StringTable[mapping.Filename]),
+			BuildId:         m.b.String(p.StringTable[mapping.BuildId]),
+			HasFunctions:    mapping.HasFunctions,
+			HasFilenames:    mapping.HasFilenames,
+			HasLineNumbers:  mapping.HasLineNumbers,
+			HasInlineFrames: mapping.HasInlineFrames,
+		}
+		key := fmt.Sprintf("%d|%d|%d|%d|%d", mm.MemoryStart, mm.MemoryLimit, mm.FileOffset, mm.Filename, mm.BuildId)
+		id, exists := m.mappings[key]
+		if !exists {
+			id = uint64(len(out.Mapping) + 1)
+			mm.Id = id
+			out.Mapping = append(out.Mapping, mm)
+			m.mappings[key] = id
+		}
+		mappingIDs[mapping.Id] = id
+	}
+
+	functionIDs := make(map[uint64]uint64, len(p.Function))
+	for _, fn := range p.Function {
+		mf := &Function{
+			Name:       m.b.String(p.StringTable[fn.Name]),
+			SystemName: m.b.String(p.StringTable[fn.SystemName]),
+			Filename:   m.b.String(p.StringTable[fn.Filename]),
+			StartLine:  fn.StartLine,
+		}
+		key := fmt.Sprintf("%d|%d|%d|%d", mf.Name, mf.SystemName, mf.Filename, mf.StartLine)
+		id, exists := m.functions[key]
+		if !exists {
+			id = uint64(len(out.Function) + 1)
+			mf.Id = id
+			out.Function = append(out.Function, mf)
+			m.functions[key] = id
+		}
+		functionIDs[fn.Id] = id
+	}
+
+	locationIDs := make(map[uint64]uint64, len(p.Location))
+	for _, loc := range p.Location {
+		ml := &Location{
+			MappingId: mappingIDs[loc.MappingId],
+			Address:   loc.Address,
+			IsFolded:  loc.IsFolded,
+		}
+		var key strings.Builder
+		fmt.Fprintf(&key, "%d|%d|%t", ml.MappingId, ml.Address, ml.IsFolded)
+		for _, line := range loc.Line {
+			ml.Line = append(ml.Line, &Line{FunctionId: functionIDs[line.FunctionId], Line: line.Line, Column: line.Column})
+			fmt.Fprintf(&key, "|%d:%d:%d", functionIDs[line.FunctionId], line.Line, line.Column)
+		}
+		id, exists := m.locations[key.String()]
+		if !exists {
+			id = uint64(len(out.Location) + 1)
+			ml.Id = id
+			out.Location = append(out.Location, ml)
+			m.locations[key.String()] = id
+		}
+		locationIDs[loc.Id] = id
+	}
+
+	for _, sample := range p.Sample {
+		ms := &Sample{LocationId: make([]uint64, len(sample.LocationId))}
+		var key strings.Builder
+		for i, id := range sample.LocationId {
+			ms.LocationId[i] = locationIDs[id]
+			fmt.Fprintf(&key, "%d,", ms.LocationId[i])
+		}
+		for _, label := range sample.Label {
+			ml := &Label{
+				Key:     m.b.String(p.StringTable[label.Key]),
+				Str:     m.b.String(p.StringTable[label.Str]),
+				Num:     label.Num,
+				NumUnit: m.b.String(p.StringTable[label.NumUnit]),
+			}
+			ms.Label = append(ms.Label, ml)
+			fmt.Fprintf(&key, "|%d=%d/%d/%d", ml.Key, ml.Str, ml.Num, ml.NumUnit)
+		}
+
+		merged, exists := m.samples[key.String()]
+		if !exists {
+			merged = ms
+			merged.Value = make([]int64, len(out.SampleType))
+			out.Sample = append(out.Sample, merged)
+			m.samples[key.String()] = merged
+		}
+		for i, v := range sample.Value {
+			merged.Value[i] += int64(math.Round(float64(v) * weight))
+		}
+	}
+}
+
+// Write encodes the profile gzip compressed, as written by runtime/pprof and
+// expected by the go toolchain for default.pgo.
+func Write(w io.Writer, p *Profile) error {
+	data, err := proto.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(data); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,70 @@
+package pb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	a := analyzerTestProfile()
+	a.DurationNanos = 10
+	b := analyzerTestProfile()
+	b.DurationNanos = 20
+	// Shuffle the ids and string table of b, merging must go by contents.
+	b.StringTable = append(b.StringTable, "baz")
+	b.Function = append(b.Function, &Function{Id: 9, Name: 8, Filename: 7})
+	b.Location = append(b.Location, &Location{Id: 7, Line: []*Line{{FunctionId: 9, Line: 40}}})
+	b.Sample = append(b.Sample, &Sample{LocationId: []uint64{7, 1}, Value: []int64{100}})
+
+	merged, err := Merge([]*Profile{a, b}, []float64{1, 0.5})
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if err := Validate(merged); err != nil {
+		t.Fatalf("Merged profile is invalid: %v", err)
+	}
+	if len(merged.Function) != 4 || len(merged.Location) != 5 || len(merged.Sample) != 4 {
+		t.Errorf("Expected 4 functions, 5 locations and 4 samples, got %d, %d and %d",
+			len(merged.Function), len(merged.Location), len(merged.Sample))
+	}
+	if merged.DurationNanos != 30 {
+		t.Errorf("Expected duration 30, got %d", merged.DurationNanos)
+	}
+	if total := TotalCPU(merged); total != 200 {
+		t.Errorf("Expected total cpu 200, got %d", total)
+	}
+
+	nodes, err := AnalyzeCPUProfile(merged, AnalyzeOptions{})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+	if node := nodes["baz"]; node == nil || !almostEqual(node.SelfCPU, 25, 0.01) {
+		t.Errorf("Expected baz self CPU 25%%, got %+v", node)
+	}
+	if node := nodes["bar"]; node == nil || !almostEqual(node.SelfCPU, 37.5, 0.01) {
+		t.Errorf("Expected bar self CPU 37.5%%, got %+v", node)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, merged); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	parsed, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(parsed.Sample) != len(merged.Sample) {
+		t.Errorf("Expected %d samples after round trip, got %d", len(merged.Sample), len(parsed.Sample))
+	}
+}
+
+func TestMergeSampleTypeMismatch(t *testing.T) {
+	b := analyzerTestProfile()
+	b.StringTable[1] = "alloc_space"
+	if _, err := Merge([]*Profile{analyzerTestProfile(), b}, nil); err == nil {
+		t.Error("Expected error for mismatched sample types, got nil")
+	}
+	if _, err := Merge(nil, nil); err == nil {
+		t.Error("Expected error for no profiles, got nil")
+	}
+}
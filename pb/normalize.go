@@ -0,0 +1,124 @@
+package pb
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Normalize rewrites profiles exported by other profilers (Parca, Polar Signals,
+// eBPF agents) into the conventions the analyzers expect:
+//
+//   - profiles that only record sample counts with a cpu period type get a
+//     derived cpu sample type of count × period
+//   - unsymbolized locations get a synthetic function named after their
+//     mapping and address, so they are not silently dropped, or the [kernel]
+//     pseudo-frame for kernel code, see SymbolizeKernel; the analyzers still
+//     count the former as unsymbolized, see IsSynthesized
+//   - Windows file names use forward slashes, see TrimPaths to also trim
+//     their directories
+//
+// Go runtime profiles recorded on other systems are left untouched.
+func Normalize(p *Profile) {
+	if p == nil {
+		return
+	}
+
+	normalizeCPUSampleType(p)
+	normalizeUnsymbolizedLocations(p)
+	normalizeSeparators(p)
+}
+
+// normalizeCPUSampleType derives a cpu sample type from the period type when
+// the profile only carries sample counts.
+func normalizeCPUSampleType(p *Profile) {
+	for _, st := range p.SampleType {
+		if strings.Contains(strings.ToLower(p.StringTable[st.Type]), "cpu") {
+			return
+		}
+	}
+	if p.PeriodType == nil || p.Period <= 0 {
+		return
+	}
+	if !strings.Contains(strings.ToLower(p.StringTable[p.PeriodType.Type]), "cpu") {
+		return
+	}
+
+	countIdx := -1
+	for i, st := range p.SampleType {
+		if p.StringTable[st.Type] == "samples" {
+			countIdx = i
+			break
+		}
+	}
+	if countIdx == -1 {
+		return
+	}
+
+	p.SampleType = append(p.SampleType, &ValueType{Type: p.PeriodType.Type, Unit: p.PeriodType.Unit})
+	for _, sample := range p.Sample {
+		var cpu int64
+		if len(sample.Value) > countIdx {
+			cpu = sample.Value[countIdx] * p.Period
+		}
+		for len(sample.Value) < len(p.SampleType)-1 {
+			sample.Value = append(sample.Value, 0)
+		}
+		sample.Value = append(sample.Value, cpu)
+	}
+}
+
+// synthesizedSystemName is the system name of the functions Normalize
+// synthesizes for unsymbolized locations. It is kept in the profile so that
+// profiles written after normalizing are still known to be unsymbolized.
+const synthesizedSystemName = "[unsymbolized]"
+
+// IsSynthesized reports whether the function was synthesized by Normalize for
+// an unsymbolized location outside the kernel.
+func IsSynthesized(p *Profile, fn *Function) bool {
+	return fn.SystemName > 0 && fn.SystemName < int64(len(p.StringTable)) &&
+		p.StringTable[fn.SystemName] == synthesizedSystemName
+}
+
+// normalizeUnsymbolizedLocations gives every location without line information
+// a synthetic function.
+func normalizeUnsymbolizedLocations(p *Profile) {
+	mappings := make(map[uint64]*Mapping, len(p.Mapping))
+	for _, m := range p.Mapping {
+		mappings[m.Id] = m
+	}
+
+	intern := stringInterner(p)
+
+	var nextFuncID uint64
+	for _, fn := range p.Function {
+		nextFuncID = max(nextFuncID, fn.Id)
+	}
+
+	for _, loc := range p.Location {
+		if len(loc.Line) > 0 {
+			continue
+		}
+
+		name, systemName := "[unknown]", synthesizedSystemName
+		var fileName string
+		if m, exists := mappings[loc.MappingId]; exists && m.Filename < int64(len(p.StringTable)) {
+			fileName = p.StringTable[m.Filename]
+			if fileName != "" {
+				name = fmt.Sprintf("%s+0x%x", filepath.Base(fileName), loc.Address-m.MemoryStart+m.FileOffset)
+			}
+		}
+		if IsKernelFile(fileName) || isKernelAddress(loc.Address) {
+			name, systemName = KernelFrame, KernelFrame
+		}
+
+		nextFuncID++
+		p.Function = append(p.Function, &Function{
+			Id:         nextFuncID,
+			Name:       intern(name),
+			SystemName: intern(systemName),
+			Filename:   intern(fileName),
+		})
+		loc.Line = []*Line{{FunctionId: nextFuncID}}
+	}
+}
@@ -0,0 +1,55 @@
+package pb
+
+import "testing"
+
+func TestNormalizeParcaProfile(t *testing.T) {
+	// Parca exports only record sample counts, with cpu as the period type,
+	// and leave locations in shared libraries unsymbolized.
+	profile := &Profile{
+		StringTable: []string{"", "samples", "count", "cpu", "nanoseconds", "main", "/usr/lib/libc.so.6"},
+		SampleType: []*ValueType{
+			{Type: 1, Unit: 2}, // samples, count
+		},
+		PeriodType: &ValueType{Type: 3, Unit: 4}, // cpu, nanoseconds
+		Period:     10000000,
+		Mapping: []*Mapping{
+			{Id: 1, MemoryStart: 0x1000, Filename: 6},
+		},
+		Function: []*Function{
+			{Id: 1, Name: 5}, // main
+		},
+		Location: []*Location{
+			{Id: 1, Line: []*Line{{FunctionId: 1}}},
+			{Id: 2, MappingId: 1, Address: 0x1234},
+		},
+		Sample: []*Sample{
+			{LocationId: []uint64{2, 1}, Value: []int64{3}},
+			{LocationId: []uint64{1}, Value: []int64{1}},
+		},
+	}
+
+	Normalize(profile)
+
+	if fn := profile.Function[len(profile.Function)-1]; !IsSynthesized(profile, fn) {
+		t.Errorf("Expected the function of the libc frame to be marked as synthesized")
+	}
+	if IsSynthesized(profile, profile.Function[0]) {
+		t.Errorf("Expected main not to be marked as synthesized")
+	}
+
+	nodes, err := AnalyzeCPUProfile(profile, AnalyzeOptions{})
+	if err != nil {
+		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
+	}
+
+	libc := nodes["libc.so.6+0x234"]
+	if libc == nil {
+		t.Fatal("unsymbolized libc frame not found")
+	}
+	if !almostEqual(libc.SelfCPU, 75, 0.01) {
+		t.Errorf("Expected libc self CPU 75%%, got %.2f%%", libc.SelfCPU)
+	}
+	if main := nodes["main"]; main == nil || !almostEqual(main.TotalCPU, 100, 0.01) {
+		t.Errorf("Expected main total CPU 100%%, got %+v", main)
+	}
+}
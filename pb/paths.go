@@ -0,0 +1,168 @@
+package pb
+
+import (
+	"path"
+	"strings"
+	"unicode"
+)
+
+// TrimPaths rewrites the file names of the functions of p into the form the
+// go build -trimpath flag records, so that profiles built in different
+// directories, on different machines or operating systems name the same files
+// alike:
+//
+//   - files of Go packages are named after the import path of the package,
+//     e.g. /usr/local/go/src/runtime/proc.go becomes runtime/proc.go and
+//     /home/runner/work/app/internal/db/db.go becomes
+//     github.com/org/app/internal/db/db.go
+//   - files in the module cache are named after their module and version, e.g.
+//     C:/Users/me/go/pkg/mod/github.com/!burnt!sushi/toml@v1.3.2/decode.go
+//     becomes github.com/BurntSushi/toml@v1.3.2/decode.go
+//
+// Files of package main, of code that is not Go and of functions whose package
+// does not match their directory, e.g. generated code with line directives,
+// keep their name.
+func TrimPaths(p *Profile) {
+	intern := stringInterner(p)
+	for _, fn := range p.Function {
+		if fn.Name >= int64(len(p.StringTable)) || fn.Filename >= int64(len(p.StringTable)) {
+			continue
+		}
+		file := p.StringTable[fn.Filename]
+		if trimmed := trimPath(p.StringTable[fn.Name], file); trimmed != file {
+			fn.Filename = intern(trimmed)
+		}
+	}
+}
+
+// trimPath returns the -trimpath form of the file of the function.
+func trimPath(funcName, file string) string {
+	pkg := FuncPackage(funcName)
+	std := pkg != "" && !strings.Contains(strings.SplitN(pkg, "/", 2)[0], ".")
+	dir, base := path.Split(file)
+	dir = strings.TrimSuffix(dir, "/")
+
+	// The module cache holds dependencies, but also the standard library of
+	// toolchains downloaded by GOTOOLCHAIN, which is matched by package.
+	if _, module, ok := strings.Cut(file, "/pkg/mod/"); ok && !std {
+		return unescapeModulePath(module)
+	}
+	// Functions of the standard library may be implemented in the files of
+	// other packages with go:linkname or in assembly, e.g. runtime.cmpstring
+	// in internal/bytealg, so these are only matched by the GOROOT.
+	if std && pkg != "main" {
+		if i := strings.LastIndex(file, "/src/"); i >= 0 {
+			return file[i+len("/src/"):]
+		}
+		return file
+	}
+	if pkg == "" || pkg == "main" || path.Base(dir) != path.Base(strings.TrimSuffix(pkg, "_test")) {
+		return file
+	}
+	return strings.TrimSuffix(pkg, "_test") + "/" + base
+}
+
+// FuncPackage returns the import path of the package of a Go function, e.g.
+// github.com/org/app/internal/db for "github.com/org/app/internal/db.(*DB).Query",
+// or "" if the name is not one of a Go function.
+func FuncPackage(name string) string {
+	// Type arguments may hold import paths, e.g. "slices.Sort[[]net/netip.Addr]".
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+	slash := strings.LastIndexByte(name, '/')
+	dot := strings.IndexByte(name[slash+1:], '.')
+	if dot <= 0 {
+		return ""
+	}
+	return name[:slash+1+dot]
+}
+
+// ModuleVersion returns the module and version of a file of a dependency, as
+// recorded in the module cache, e.g.
+// /root/go/pkg/mod/github.com/!burnt!sushi/toml@v1.3.2/decode.go, or trimmed
+// by TrimPaths or -trimpath, e.g. github.com/BurntSushi/toml@v1.3.2/decode.go.
+// ok is false for other files, including the standard library of toolchains
+// in the module cache.
+func ModuleVersion(file string) (module, version string, ok bool) {
+	if _, cached, found := strings.Cut(file, "/pkg/mod/"); found {
+		file = cached
+	}
+	module, rest, found := strings.Cut(file, "@")
+	if !found || module == "" || module[0] == '/' || !strings.Contains(strings.SplitN(module, "/", 2)[0], ".") {
+		return "", "", false
+	}
+	module = unescapeModulePath(module)
+	if module == "golang.org/toolchain" {
+		return "", "", false
+	}
+	version, _, _ = strings.Cut(rest, "/")
+	return module, unescapeModulePath(version), true
+}
+
+// unescapeModulePath reverts the escaping of upper case letters of the module
+// cache, e.g. github.com/!burnt!sushi becomes github.com/BurntSushi.
+func unescapeModulePath(p string) string {
+	if !strings.Contains(p, "!") {
+		return p
+	}
+	var b strings.Builder
+	upper := false
+	for _, r := range p {
+		switch {
+		case r == '!':
+			upper = true
+		case upper:
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// windowsPath reports whether a file name is a Windows path, e.g.
+// C:\Users\me\app\main.go or \\server\share\main.go.
+func windowsPath(file string) bool {
+	if strings.HasPrefix(file, `\\`) {
+		return true
+	}
+	return len(file) >= 3 && file[1] == ':' && file[2] == '\\' && unicode.IsLetter(rune(file[0]))
+}
+
+// normalizeSeparators converts the file names of functions of profiles
+// recorded on Windows to forward slashes, like the ones of Go tools.
+func normalizeSeparators(p *Profile) {
+	intern := stringInterner(p)
+	for _, fn := range p.Function {
+		if fn.Filename >= int64(len(p.StringTable)) {
+			continue
+		}
+		if file := p.StringTable[fn.Filename]; windowsPath(file) {
+			fn.Filename = intern(strings.ReplaceAll(file, `\`, "/"))
+		}
+	}
+}
+
+// stringInterner returns a function returning the index of a string in the
+// string table of p, appending it if needed.
+func stringInterner(p *Profile) func(s string) int64 {
+	var index map[string]int64
+	return func(s string) int64 {
+		if index == nil {
+			index = make(map[string]int64, len(p.StringTable))
+			for i, s := range p.StringTable {
+				if _, exists := index[s]; !exists {
+					index[s] = int64(i)
+				}
+			}
+		}
+		if idx, exists := index[s]; exists {
+			return idx
+		}
+		p.StringTable = append(p.StringTable, s)
+		index[s] = int64(len(p.StringTable) - 1)
+		return index[s]
+	}
+}
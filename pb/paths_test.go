@@ -0,0 +1,55 @@
+package pb
+
+import "testing"
+
+func TestTrimPath(t *testing.T) {
+	tests := []struct {
+		funcName, file, want string
+	}{
+		{"runtime.mallocgc", "/usr/local/go/src/runtime/malloc.go", "runtime/malloc.go"},
+		{"internal/runtime/maps.(*Map).getWithKey", "C:/Program Files/Go/src/internal/runtime/maps/map.go", "internal/runtime/maps/map.go"},
+		{"runtime.mallocgc", "/home/me/go/pkg/mod/golang.org/toolchain@v0.0.1-go1.23.0.linux-amd64/src/runtime/malloc.go", "runtime/malloc.go"},
+		{"slices.SortFunc[[]net/netip.Addr]", "/usr/local/go/src/slices/sort.go", "slices/sort.go"},
+		{"github.com/BurntSushi/toml.(*decoder).unify", "/root/go/pkg/mod/github.com/!burnt!sushi/toml@v1.3.2/decode.go", "github.com/BurntSushi/toml@v1.3.2/decode.go"},
+		{"github.com/org/app/internal/db.(*DB).Query.func1", "/home/runner/work/app/internal/db/db.go", "github.com/org/app/internal/db/db.go"},
+		{"github.com/org/app/internal/db_test.TestQuery", "/src/internal/db/db_test.go", "github.com/org/app/internal/db/db_test.go"},
+		{"github.com/org/app/internal/db.Query", "github.com/org/app/internal/db/db.go", "github.com/org/app/internal/db/db.go"},
+		{"main.main", "/home/me/app/main.go", "/home/me/app/main.go"},
+		{"github.com/org/app/parser.yyParse", "parser.y", "parser.y"},
+		{"github.com/org/app/parser.yyParse", "/build/gen/y.go", "/build/gen/y.go"},
+		{"runtime.cmpstring", "/usr/local/go/src/internal/bytealg/compare_amd64.s", "internal/bytealg/compare_amd64.s"},
+		{"runtime.main", "/home/me/src/go/src/runtime/proc.go", "runtime/proc.go"},
+		{"[unknown]", "/usr/lib/libc.so.6", "/usr/lib/libc.so.6"},
+	}
+	for _, tt := range tests {
+		if got := trimPath(tt.funcName, tt.file); got != tt.want {
+			t.Errorf("trimPath(%q, %q): expected %q, got %q", tt.funcName, tt.file, tt.want, got)
+		}
+	}
+}
+
+func TestTrimPaths(t *testing.T) {
+	profile := &Profile{
+		StringTable: []string{"", "runtime.main", "/usr/local/go/src/runtime/proc.go", "runtime.goexit", `C:\Go\src\runtime\asm_amd64.s`},
+		Function: []*Function{
+			{Id: 1, Name: 1, Filename: 2},
+			{Id: 2, Name: 3, Filename: 4},
+		},
+	}
+
+	Normalize(profile)
+	if file := profile.StringTable[profile.Function[1].Filename]; file != "C:/Go/src/runtime/asm_amd64.s" {
+		t.Errorf("Expected Normalize to convert separators, got %q", file)
+	}
+
+	TrimPaths(profile)
+	if file := profile.StringTable[profile.Function[0].Filename]; file != "runtime/proc.go" {
+		t.Errorf("Expected runtime/proc.go, got %q", file)
+	}
+	if file := profile.StringTable[profile.Function[1].Filename]; file != "runtime/asm_amd64.s" {
+		t.Errorf("Expected runtime/asm_amd64.s, got %q", file)
+	}
+	if profile.StringTable[2] != "/usr/local/go/src/runtime/proc.go" {
+		t.Errorf("Expected the string table to keep the original file name, got %q", profile.StringTable[2])
+	}
+}
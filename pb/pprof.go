@@ -1,18 +1,23 @@
 package pb
 
 import (
-	"fmt"
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"hash/fnv"
 	"io"
-	"os"
 	"strings"
+	"sync"
+	"time"
 
-	"golang.org/x/tools/go/packages"
 	"google.golang.org/protobuf/proto"
 )
 
 type Stack struct {
 	Name     string
 	FileName string
+	Line     int64
+	Address  uint64 // instruction address of unsymbolized frames, such as [kernel] ones
 }
 
 // AnalyzeCPUProfile analyzes a pprof profile and returns CPU usage percentage per function
@@ -22,79 +27,67 @@ type Stack struct {
 // Example:
 //
 //	profile := &pb.Profile{...}
-//	cpuData, err := AnalyzeCPUProfile(profile)
+//	cpuData, err := AnalyzeCPUProfile(profile, pb.AnalyzeOptions{AttrCPU: true})
 //	if err != nil {
 //	    log.Fatal(err)
 //	}
 //	for name, node := range cpuData {
 //	    fmt.Printf("%s: %.2f%% (self), %.2f%% (total)\n", name, node.SelfCPU, node.TotalCPU)
 //	}
-func AnalyzeCPUProfile(p *Profile, attrCPU bool) (map[string]*FunctionNode, error) {
-	if p == nil {
-		return nil, fmt.Errorf("nil profile")
+func AnalyzeCPUProfile(p *Profile, opts AnalyzeOptions) (map[string]*FunctionNode, error) {
+	a, err := NewAnalyzer(opts)
+	if err != nil {
+		return nil, err
 	}
+	return a.AnalyzeCPU(p)
+}
 
-	// Build function info map first
-	funcInfoMap := buildFunctionInfoMap(p)
-
-	// Find CPU sample type index
-	cpuIdx := -1
+// CPUSampleIndex returns the index of the cpu sample type, or -1 if the profile
+// has none.
+func CPUSampleIndex(p *Profile) int {
 	for i, st := range p.SampleType {
 		typeName := p.StringTable[st.Type]
 		if strings.Contains(strings.ToLower(typeName), "cpu") {
-			cpuIdx = i
-			break
+			return i
 		}
 	}
+	return -1
+}
+
+// TotalCPU returns the sum of the cpu sample values of the profile.
+func TotalCPU(p *Profile) int64 {
+	cpuIdx := CPUSampleIndex(p)
 	if cpuIdx == -1 {
-		return nil, fmt.Errorf("no CPU samples found in profile")
+		return 0
 	}
 
-	// Calculate total CPU time
 	var totalCPU int64
 	for _, sample := range p.Sample {
 		if len(sample.Value) > cpuIdx {
 			totalCPU += sample.Value[cpuIdx]
 		}
 	}
-	if totalCPU == 0 {
-		return nil, fmt.Errorf("no CPU time recorded in profile")
-	}
-
-	// Create function call tree
-	functionNodes := make(map[string]*FunctionNode)
+	return totalCPU
+}
 
-	// Process each sample
-	for _, sample := range p.Sample {
-		if len(sample.Value) <= cpuIdx {
+// Period returns the period covered by the profiles, from the earliest start
+// to the latest end. ok is false if none of them records its start time.
+func Period(profiles []*Profile) (start, end time.Time, ok bool) {
+	for _, p := range profiles {
+		if p.TimeNanos == 0 {
 			continue
 		}
-
-		cpuTime := float64(sample.Value[cpuIdx]) / float64(totalCPU) * 100
-		stack := make([]Stack, 0, len(sample.LocationId))
-
-		// Build stack trace
-		for i := len(sample.LocationId) - 1; i >= 0; i-- {
-			loc := findLocation(p, sample.LocationId[i])
-			if loc == nil || len(loc.Line) == 0 {
-				continue
-			}
-
-			if info, exists := funcInfoMap[loc.Line[0].FunctionId]; exists {
-				stack = append(stack, Stack{
-					Name:     info.Name,
-					FileName: info.FileName,
-				})
-			}
+		pstart := time.Unix(0, p.TimeNanos)
+		pend := pstart.Add(time.Duration(p.DurationNanos))
+		if !ok || pstart.Before(start) {
+			start = pstart
 		}
-
-		// Update function nodes with this sample
-		if len(stack) > 0 {
-			updateFunctionNodes(functionNodes, stack, cpuTime, attrCPU)
+		if !ok || pend.After(end) {
+			end = pend
 		}
+		ok = true
 	}
-
-	return functionNodes, nil
+	return start, end, ok
 }
 
 // FunctionNode represents a node in the call tree with CPU usage information
@@ -105,7 +98,20 @@ type FunctionNode struct {
 	SelfCPU     float64 // CPU time spent in this function only
 	TotalCPU    float64 // CPU time including children
 	Children    map[string]*FunctionNode
-	ParentCount int // Number of times this function appears in different call stacks
+	ParentCount int     // Number of times this function appears in different call stacks
+	Samples     int     // Number of samples this function appears in, recursive calls count once
+	Stacks      int     // Number of distinct call stacks this function appears in
+	Callers     int     // Number of distinct functions calling this function
+	Depth       float64 // Mean depth of the function in its samples, 1 for entry points
+	Module      string  // Module of the function if it is a dependency, see ModuleVersion
+	Version     string  // Version of Module
+
+	// stacks and callers are the sets counted by Stacks and Callers, kept
+	// until a report converts the nodes for output
+	stacks  map[uint64]struct{}
+	callers map[string]struct{}
+	// depths is the sum of the depths of the function in its samples
+	depths int
 }
 
 // FunctionInfo stores the mapping of function details
@@ -131,23 +137,30 @@ func buildFunctionInfoMap(p *Profile) map[uint64]FunctionInfo {
 	return funcMap
 }
 
-// Helper function to find location by ID
-func findLocation(p *Profile, id uint64) *Location {
+// buildLocationMap creates a map of location IDs to locations
+func buildLocationMap(p *Profile) map[uint64]*Location {
+	locations := make(map[uint64]*Location, len(p.Location))
 	for _, loc := range p.Location {
-		if loc.Id == id {
-			return loc
-		}
+		locations[loc.Id] = loc
 	}
-	return nil
+	return locations
 }
 
-// Helper function to update function nodes with a stack sample
+// Helper function to update function nodes with the samples of a stack, summing
+// to cpuTime, attributable reports for each stack entry whether its cpu is
+// attributed to its caller, unless blamed is the index of the entry the
+// attributed cpu goes to instead, see BlameLibraries
 func updateFunctionNodes(
 	nodes map[string]*FunctionNode,
 	stack []Stack,
+	attributable []bool,
+	blamed int,
 	cpuTime float64,
-	attrCPU bool,
+	samples int,
 ) {
+	key := stackHash(stack)
+	seen := make(map[*FunctionNode]bool, len(stack))
+
 	// Process each function in the stack
 	for i := len(stack) - 1; i >= 0; i-- {
 		entry := stack[i]
@@ -157,25 +170,38 @@ func updateFunctionNodes(
 				Name:     entry.Name,
 				FileName: entry.FileName,
 				Children: make(map[string]*FunctionNode),
+				stacks:   make(map[uint64]struct{}),
+				callers:  make(map[string]struct{}),
 			}
+			node.Module, node.Version, _ = ModuleVersion(entry.FileName)
 			nodes[entry.Name] = node
 		}
 
+		// Update the counts, recursive calls only count once per sample
+		if !seen[node] {
+			seen[node] = true
+			node.Samples += samples
+			node.depths += (i + 1) * samples
+			node.stacks[key] = struct{}{}
+		}
+		if i > 0 {
+			node.callers[stack[i-1].Name] = struct{}{}
+		}
+
 		// Update CPU times
-		node.ParentCount++
+		node.ParentCount += samples
 		node.TotalCPU += cpuTime
 		if i == len(stack)-1 { // Leaf function gets the self time
 			node.SelfCPU += cpuTime
-			node.SelfAttrCPU += cpuTime
-		}
-
-		if i == len(stack)-2 {
-			childFuncName := stack[i+1].Name
-			if attrCPU && shouldAttrFn(childFuncName) {
+			if blamed < 0 {
 				node.SelfAttrCPU += cpuTime
 			}
 		}
 
+		if blamed < 0 && i == len(stack)-2 && attributable[i+1] || i == blamed {
+			node.SelfAttrCPU += cpuTime
+		}
+
 		// Add child relationship - the caller (at i) is the parent of the callee (at i+1)
 		if i < len(stack)-1 {
 			childEntry := stack[i+1]
@@ -186,33 +212,61 @@ func updateFunctionNodes(
 	}
 }
 
+// stackHash returns a hash identifying the frames of a stack.
+func stackHash(stack []Stack) uint64 {
+	h := fnv.New64a()
+	for _, entry := range stack {
+		h.Write([]byte(entry.Name))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// Parse decodes a pprof profile, which may be gzip compressed as written by
+// runtime/pprof.
 func Parse(r io.Reader) (*Profile, error) {
-	bytes, err := io.ReadAll(r)
+	data, err := io.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
 
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(gz); err != nil {
+			return nil, err
+		}
+	}
+
 	profile := &Profile{}
-	err = proto.Unmarshal(bytes, profile)
+	err = proto.Unmarshal(data, profile)
 	return profile, err
 }
 
+// stdList holds the import paths of the stdlib packages, one per line. It is
+// embedded so that binaries tell stdlib functions apart without a Go
+// installation on the host. Regenerate it with `go generate ./pb` after
+// upgrading Go.
+//
+//go:generate sh -c "go list std > std.txt"
+//go:embed std.txt
+var stdList string
+
+// stdPackages returns the import paths of the stdlib packages.
+var stdPackages = sync.OnceValue(func() []string {
+	return strings.Fields(stdList)
+})
+
 // shouldAttrFn checks if a function name is a core function (not a user-defined function)
 // e.g. runtime mallocs, mapaccess, concat string, etc.
-var shouldAttrFn = func() func(string) bool {
-	pkgs, err := packages.Load(nil, "std")
-	if err != nil {
-		fmt.Printf("error loading std packages: %v\n", err)
-		os.Exit(1)
-	}
-
-	return func(funcName string) bool {
-		for _, pkg := range pkgs {
-			if strings.HasPrefix(funcName, pkg.PkgPath+".") {
-				return true
-			}
+func shouldAttrFn(funcName string) bool {
+	for _, pkg := range stdPackages() {
+		if strings.HasPrefix(funcName, pkg+".") {
+			return true
 		}
-
-		return false
 	}
-}()
+
+	return false
+}
@@ -3,6 +3,7 @@ package pb
 import (
 	"math"
 	"testing"
+	"time"
 )
 
 func TestAnalyzeCPUProfile(t *testing.T) {
@@ -35,7 +36,7 @@ func TestAnalyzeCPUProfile(t *testing.T) {
 		},
 	}
 
-	nodes, err := AnalyzeCPUProfile(profile, false)
+	nodes, err := AnalyzeCPUProfile(profile, AnalyzeOptions{})
 	if err != nil {
 		t.Fatalf("AnalyzeCPUProfile failed: %v", err)
 	}
@@ -83,14 +84,14 @@ func TestAnalyzeCPUProfileWithEmptySamples(t *testing.T) {
 		Sample: []*Sample{},
 	}
 
-	_, err := AnalyzeCPUProfile(profile, false)
+	_, err := AnalyzeCPUProfile(profile, AnalyzeOptions{})
 	if err == nil {
 		t.Error("Expected error for empty samples, got nil")
 	}
 }
 
 func TestAnalyzeCPUProfileWithNilProfile(t *testing.T) {
-	_, err := AnalyzeCPUProfile(nil, false)
+	_, err := AnalyzeCPUProfile(nil, AnalyzeOptions{})
 	if err == nil {
 		t.Error("Expected error for nil profile, got nil")
 	}
@@ -104,8 +105,136 @@ func TestAnalyzeCPUProfileWithInvalidSampleType(t *testing.T) {
 		},
 	}
 
-	_, err := AnalyzeCPUProfile(profile, false)
+	_, err := AnalyzeCPUProfile(profile, AnalyzeOptions{})
 	if err == nil {
 		t.Error("Expected error for non-CPU profile, got nil")
 	}
 }
+
+func TestSliceProfile(t *testing.T) {
+	profile := &Profile{
+		StringTable: []string{"", "cpu", "nanoseconds", "main", "end_timestamp_ns"},
+		SampleType: []*ValueType{
+			{Type: 1, Unit: 2}, // cpu, nanoseconds
+		},
+		Function: []*Function{{Id: 1, Name: 3}},
+		Location: []*Location{{Id: 1, Line: []*Line{{FunctionId: 1}}}},
+		Sample: []*Sample{
+			{LocationId: []uint64{1}, Value: []int64{10}, Label: []*Label{{Key: 4, Num: int64(12 * time.Second)}}},
+			{LocationId: []uint64{1}, Value: []int64{20}, Label: []*Label{{Key: 4, Num: int64(3 * time.Second)}}},
+			{LocationId: []uint64{1}, Value: []int64{30}, Label: []*Label{{Key: 4, Num: int64(19 * time.Second)}}},
+			{LocationId: []uint64{1}, Value: []int64{40}}, // no timestamp
+		},
+	}
+
+	slices, err := SliceProfile(profile, 10*time.Second)
+	if err != nil {
+		t.Fatalf("SliceProfile failed: %v", err)
+	}
+	if len(slices) != 2 {
+		t.Fatalf("Expected 2 slices, got %d", len(slices))
+	}
+	if !slices[0].Start.Equal(time.Unix(0, 0)) || len(slices[0].Profile.Sample) != 1 {
+		t.Errorf("Expected first slice at 0s with 1 sample, got %s with %d", slices[0].Start, len(slices[0].Profile.Sample))
+	}
+	if !slices[1].Start.Equal(time.Unix(10, 0)) || len(slices[1].Profile.Sample) != 2 {
+		t.Errorf("Expected second slice at 10s with 2 samples, got %s with %d", slices[1].Start, len(slices[1].Profile.Sample))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	profile := &Profile{
+		StringTable: []string{"", "cpu", "nanoseconds"},
+		SampleType: []*ValueType{
+			{Type: 1, Unit: 9}, // cpu, out of range unit
+		},
+		Function: []*Function{{Id: 1, Name: -1}},
+		Location: []*Location{{Id: 1, Line: []*Line{{FunctionId: 2}}}},
+		Sample: []*Sample{
+			{LocationId: []uint64{3}, Value: []int64{1, 2}},
+		},
+	}
+
+	err := Validate(profile)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Expected *ValidationError, got %v", err)
+	}
+	if len(verr.Issues) != 5 {
+		t.Errorf("Expected 5 issues, got %d: %v", len(verr.Issues), verr.Issues)
+	}
+
+	if _, err := AnalyzeCPUProfile(profile, AnalyzeOptions{}); err == nil {
+		t.Error("Expected error for invalid profile, got nil")
+	}
+}
+
+func TestShouldAttrFn(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"runtime.mallocgc", true},
+		{"net/http.(*conn).serve", true},
+		{"encoding/json.Marshal", true},
+		{"main.main", false},
+		{"github.com/org/app/net/http.Get", false},
+		{"runtimex.Foo", false},
+	}
+	for _, tt := range tests {
+		if got := shouldAttrFn(tt.name); got != tt.want {
+			t.Errorf("Expected shouldAttrFn(%q) %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestRuntimeFn(t *testing.T) {
+	if RuntimeFn("go") != nil {
+		t.Error("Expected the default runtime functions of go")
+	}
+	tests := []struct {
+		language, name string
+		want           bool
+	}{
+		{"jvm", "java.util.HashMap.get", true},
+		{"java", "jdk.internal.misc.Unsafe.park", true},
+		{"jvm", "com.example.Handler.hash", false},
+		{"dotnet", "System.Text.Json.JsonSerializer.Serialize", true},
+		{"node", "(garbage collector)", true},
+		{"node", "handler", false},
+		{"python", "dumps", false},
+	}
+	for _, tt := range tests {
+		if got := RuntimeFn(tt.language)(tt.name); got != tt.want {
+			t.Errorf("Expected RuntimeFn(%q)(%q) %v, got %v", tt.language, tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestAttrAlso(t *testing.T) {
+	shouldAttr, err := AttrAlso(nil, []string{"github.com/org/pkg/loggingwrapper.*", "main.(*metrics).wrap"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"runtime.mallocgc", true},
+		{"github.com/org/pkg/loggingwrapper.Infof", true},
+		{"github.com/org/pkg/loggingwrapper.(*Logger).Log", true},
+		{"github.com/org/pkg/loggingwrapperx.Infof", false},
+		{"main.(*metrics).wrap", true},
+		{"main.(*metrics).wrapper", false},
+		{"main.main", false},
+	}
+	for _, tt := range tests {
+		if got := shouldAttr(tt.name); got != tt.want {
+			t.Errorf("Expected %q attributed %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	if _, err := AttrAlso(nil, []string{""}); err == nil {
+		t.Error("Expected error for an empty pattern")
+	}
+}
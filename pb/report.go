@@ -0,0 +1,203 @@
+package pb
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Report accumulates the analysis of any number of profiles, see
+// Analyzer.Ingest. It is safe for concurrent use by multiple goroutines.
+type Report struct {
+	mu       sync.Mutex
+	nodes    map[string]*FunctionNode // valued in the unit of the sample type
+	total    int64
+	profiles int
+	warnings []string
+}
+
+// NewReport creates an empty report for profiles ingested by the analyzer.
+func (a *Analyzer) NewReport() *Report {
+	return &Report{nodes: make(map[string]*FunctionNode)}
+}
+
+// merge adds the nodes of one profile, valued in the unit of its sample type,
+// to the report.
+func (r *Report) merge(nodes map[string]*FunctionNode, total int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.total += total
+	r.profiles++
+	for name, node := range nodes {
+		merged, exists := r.nodes[name]
+		if !exists {
+			merged = &FunctionNode{
+				Name:     node.Name,
+				FileName: node.FileName,
+				Module:   node.Module,
+				Version:  node.Version,
+				Children: make(map[string]*FunctionNode),
+				stacks:   make(map[uint64]struct{}),
+				callers:  make(map[string]struct{}),
+			}
+			r.nodes[name] = merged
+		}
+		merged.SelfAttrCPU += node.SelfAttrCPU
+		merged.SelfCPU += node.SelfCPU
+		merged.TotalCPU += node.TotalCPU
+		merged.ParentCount += node.ParentCount
+		merged.Samples += node.Samples
+		merged.depths += node.depths
+		for key := range node.stacks {
+			merged.stacks[key] = struct{}{}
+		}
+		for caller := range node.callers {
+			merged.callers[caller] = struct{}{}
+		}
+	}
+	for name, node := range nodes {
+		for child := range node.Children {
+			r.nodes[name].Children[child] = r.nodes[child]
+		}
+	}
+}
+
+// maxWarnings is the number of distinct warnings a report keeps, bounding
+// the ones of long running reports of many profiles.
+const maxWarnings = 20
+
+// warn adds the warnings of a profile to the report, once each.
+func (r *Report) warn(warnings []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, w := range warnings {
+		if len(r.warnings) < maxWarnings && !slices.Contains(r.warnings, w) {
+			r.warnings = append(r.warnings, w)
+		}
+	}
+}
+
+// Warnings returns the data quality issues of the ingested profiles, which
+// were analyzed as well as they could be, e.g. samples without function
+// information, so that reports can show how far they can be trusted.
+func (r *Report) Warnings() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.warnings)
+}
+
+// Merge adds the profiles ingested into other so far to the report, e.g. to
+// combine the reports of several services.
+func (r *Report) Merge(other *Report) {
+	other.mu.Lock()
+	nodes, total, profiles, warnings := make(map[string]*FunctionNode, len(other.nodes)), other.total, other.profiles, slices.Clone(other.warnings)
+	for name, node := range other.nodes {
+		copied := *node
+		copied.Children = maps.Clone(node.Children)
+		copied.stacks = maps.Clone(node.stacks)
+		copied.callers = maps.Clone(node.callers)
+		nodes[name] = &copied
+	}
+	other.mu.Unlock()
+
+	r.merge(nodes, total)
+	r.warn(warnings)
+	r.mu.Lock()
+	r.profiles += profiles - 1
+	r.mu.Unlock()
+}
+
+// Total returns the sum of the analyzed sample values of the ingested profiles.
+func (r *Report) Total() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.total
+}
+
+// Profiles returns the number of ingested profiles.
+func (r *Report) Profiles() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.profiles
+}
+
+// Nodes returns a snapshot of the call tree of all ingested profiles, with the
+// usage of every node as a percentage of the total of all of them.
+func (r *Report) Nodes() map[string]*FunctionNode {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	scale := r.scale()
+	nodes := make(map[string]*FunctionNode, len(r.nodes))
+	for name, node := range r.nodes {
+		nodes[name] = snapshot(node, scale)
+		nodes[name].Children = make(map[string]*FunctionNode, len(node.Children))
+	}
+	for name, node := range r.nodes {
+		for child := range node.Children {
+			nodes[name].Children[child] = nodes[child]
+		}
+	}
+	return nodes
+}
+
+// Each calls fn with a snapshot of every node of the ingested profiles like
+// Nodes, but without children, by descending attributed usage and then name,
+// taking one node at a time rather than the whole call tree so that reports
+// of huge profiles can be written as they go. It stops at the first error of
+// fn.
+func (r *Report) Each(fn func(*FunctionNode) error) error {
+	r.mu.Lock()
+	names := slices.Collect(maps.Keys(r.nodes))
+	slices.SortFunc(names, func(a, b string) int {
+		if x, y := r.nodes[a].SelfAttrCPU, r.nodes[b].SelfAttrCPU; x != y {
+			return cmp.Compare(y, x)
+		}
+		return cmp.Compare(a, b)
+	})
+	r.mu.Unlock()
+
+	for _, name := range names {
+		r.mu.Lock()
+		node := snapshot(r.nodes[name], r.scale())
+		r.mu.Unlock()
+		if err := fn(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scale returns the factor turning the values of the nodes into percentages
+// of the total. The caller holds r.mu.
+func (r *Report) scale() float64 {
+	if r.total == 0 {
+		return 0
+	}
+	return 100 / float64(r.total)
+}
+
+// snapshot returns a copy of the node without children, its usage scaled into
+// a percentage.
+func snapshot(node *FunctionNode, scale float64) *FunctionNode {
+	depth := 0.0
+	if node.Samples > 0 {
+		depth = float64(node.depths) / float64(node.Samples)
+	}
+	return &FunctionNode{
+		Name:        node.Name,
+		FileName:    node.FileName,
+		SelfAttrCPU: node.SelfAttrCPU * scale,
+		SelfCPU:     node.SelfCPU * scale,
+		TotalCPU:    node.TotalCPU * scale,
+		ParentCount: node.ParentCount,
+		Samples:     node.Samples,
+		Stacks:      len(node.stacks),
+		Callers:     len(node.callers),
+		Depth:       depth,
+		Module:      node.Module,
+		Version:     node.Version,
+	}
+}
@@ -0,0 +1,36 @@
+package pb
+
+import "strings"
+
+// runtimePrefixes are the prefixes of the function names of the runtime and
+// standard library of languages whose profiles qualify names by package.
+var runtimePrefixes = map[string][]string{
+	"jvm":    {"java.", "javax.", "jdk.", "sun.", "com.sun.", "kotlin.", "scala."},
+	"dotnet": {"System.", "Microsoft."},
+}
+
+// RuntimeFn returns the function telling the functions of the runtime and
+// standard library of a language, by its Datadog language tag, for the
+// ShouldAttr and IsRuntime options of its analyzer. Go's is the default, nil.
+// Node's runtime functions are V8's parenthesized ones, e.g. "(garbage
+// collector)", while python, ruby and php profiles name functions without
+// their module, so none of theirs are told apart.
+func RuntimeFn(language string) func(funcName string) bool {
+	switch language {
+	case "go", "":
+		return nil
+	case "java":
+		language = "jvm"
+	case "node", "nodejs":
+		return func(funcName string) bool { return strings.HasPrefix(funcName, "(") }
+	}
+	prefixes := runtimePrefixes[language]
+	return func(funcName string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(funcName, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
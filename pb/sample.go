@@ -0,0 +1,42 @@
+package pb
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// SampleFraction returns a profile of a random fraction of the samples of p,
+// chosen by a generator seeded with seed so that the same seed keeps the same
+// samples. The values of the kept samples are scaled by 1/fraction, so that
+// totals remain estimates of the totals of p. The returned profile shares the
+// location, function and string tables of p.
+func SampleFraction(p *Profile, fraction float64, seed int64) (*Profile, error) {
+	if p == nil {
+		return nil, fmt.Errorf("nil profile")
+	}
+	if !(fraction > 0 && fraction <= 1) {
+		return nil, fmt.Errorf("sample fraction %v is not within (0, 1]", fraction)
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	samples := make([]*Sample, 0, int(float64(len(p.Sample))*fraction)+1)
+	for _, sample := range p.Sample {
+		if rng.Float64() >= fraction {
+			continue
+		}
+		scaled := &Sample{
+			LocationId: sample.LocationId,
+			Value:      make([]int64, len(sample.Value)),
+			Label:      sample.Label,
+		}
+		for i, v := range sample.Value {
+			scaled.Value[i] = int64(math.Round(float64(v) / fraction))
+		}
+		samples = append(samples, scaled)
+	}
+	if len(samples) == 0 && len(p.Sample) > 0 {
+		return nil, fmt.Errorf("sample fraction %v kept none of %d samples", fraction, len(p.Sample))
+	}
+	return withSamples(p, samples), nil
+}
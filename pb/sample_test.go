@@ -0,0 +1,41 @@
+package pb
+
+import "testing"
+
+func TestSampleFraction(t *testing.T) {
+	profile := &Profile{
+		StringTable: []string{"", "cpu", "nanoseconds"},
+		SampleType:  []*ValueType{{Type: 1, Unit: 2}},
+	}
+	for i := 0; i < 10000; i++ {
+		profile.Sample = append(profile.Sample, &Sample{Value: []int64{10}})
+	}
+
+	sampled, err := SampleFraction(profile, 0.1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(sampled.Sample); n < 900 || n > 1100 {
+		t.Errorf("Expected about 1000 samples, got %d", n)
+	}
+	if v := sampled.Sample[0].Value[0]; v != 100 {
+		t.Errorf("Expected values scaled to 100, got %d", v)
+	}
+	if profile.Sample[0].Value[0] != 10 {
+		t.Errorf("Expected the original profile to be unchanged, got %d", profile.Sample[0].Value[0])
+	}
+
+	again, err := SampleFraction(profile, 0.1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Sample) != len(sampled.Sample) {
+		t.Errorf("Expected the same seed to keep %d samples, got %d", len(sampled.Sample), len(again.Sample))
+	}
+
+	for _, fraction := range []float64{0, -1, 1.5} {
+		if _, err := SampleFraction(profile, fraction, 1); err == nil {
+			t.Errorf("Expected error for fraction %v", fraction)
+		}
+	}
+}
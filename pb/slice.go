@@ -0,0 +1,91 @@
+package pb
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// EndTimestampLabel is the numeric sample label Datadog profilers attach with
+// the wall clock time, in nanoseconds, at which a sample was taken.
+const EndTimestampLabel = "end_timestamp_ns"
+
+// TimeSlice is the subset of a profile's samples taken within one time bucket.
+type TimeSlice struct {
+	Start   time.Time
+	End     time.Time
+	Profile *Profile
+}
+
+// SliceProfile buckets the samples of p into consecutive windows of the given
+// width using their end timestamp labels. The returned profiles share the
+// location, function and string tables of p. Empty buckets are omitted.
+func SliceProfile(p *Profile, width time.Duration) ([]TimeSlice, error) {
+	if p == nil {
+		return nil, fmt.Errorf("nil profile")
+	}
+	if width <= 0 {
+		return nil, fmt.Errorf("slice width must be positive")
+	}
+
+	buckets := make(map[int64][]*Sample)
+	for _, sample := range p.Sample {
+		ts, ok := sampleTimestamp(p, sample)
+		if !ok {
+			continue
+		}
+		bucket := ts - ts%int64(width)
+		buckets[bucket] = append(buckets[bucket], sample)
+	}
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("no samples with a %s label found in profile", EndTimestampLabel)
+	}
+
+	starts := make([]int64, 0, len(buckets))
+	for start := range buckets {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	slices := make([]TimeSlice, 0, len(starts))
+	for _, start := range starts {
+		slices = append(slices, TimeSlice{
+			Start:   time.Unix(0, start).UTC(),
+			End:     time.Unix(0, start+int64(width)).UTC(),
+			Profile: withSamples(p, buckets[start]),
+		})
+	}
+	return slices, nil
+}
+
+// sampleTimestamp returns the end timestamp label of the sample.
+func sampleTimestamp(p *Profile, sample *Sample) (int64, bool) {
+	for _, label := range sample.Label {
+		if label.Key < int64(len(p.StringTable)) && p.StringTable[label.Key] == EndTimestampLabel {
+			return label.Num, true
+		}
+	}
+	return 0, false
+}
+
+// withSamples returns a profile with the metadata and tables of p but only the
+// given samples.
+func withSamples(p *Profile, samples []*Sample) *Profile {
+	return &Profile{
+		SampleType:        p.SampleType,
+		Sample:            samples,
+		Mapping:           p.Mapping,
+		Location:          p.Location,
+		Function:          p.Function,
+		StringTable:       p.StringTable,
+		DropFrames:        p.DropFrames,
+		KeepFrames:        p.KeepFrames,
+		TimeNanos:         p.TimeNanos,
+		DurationNanos:     p.DurationNanos,
+		PeriodType:        p.PeriodType,
+		Period:            p.Period,
+		Comment:           p.Comment,
+		DefaultSampleType: p.DefaultSampleType,
+		DocUrl:            p.DocUrl,
+	}
+}
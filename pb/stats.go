@@ -0,0 +1,54 @@
+package pb
+
+import "encoding/binary"
+
+// Stats describes the size and structure of a profile, which tells why it is
+// slow to analyze or why merging it with others blows up.
+type Stats struct {
+	Samples     int
+	Stacks      int // distinct sequences of locations of the samples
+	Functions   int // distinct functions in the stacks of the samples
+	Locations   int // entries of the location table
+	Strings     int // entries of the string table
+	StringBytes int // total length of the strings of the string table
+	MaxDepth    int // number of locations of the deepest stack
+	AvgDepth    float64
+}
+
+// ProfileStats returns the stats of the profile.
+func ProfileStats(p *Profile) Stats {
+	stats := Stats{
+		Samples:   len(p.Sample),
+		Locations: len(p.Location),
+		Strings:   len(p.StringTable),
+	}
+	for _, s := range p.StringTable {
+		stats.StringBytes += len(s)
+	}
+
+	locations := buildLocationMap(p)
+	stacks := make(map[string]struct{})
+	functions := make(map[uint64]struct{})
+	depth := 0
+	key := make([]byte, 0, 256)
+	for _, sample := range p.Sample {
+		key = key[:0]
+		for _, id := range sample.LocationId {
+			key = binary.LittleEndian.AppendUint64(key, id)
+			if loc := locations[id]; loc != nil {
+				for _, line := range loc.Line {
+					functions[line.FunctionId] = struct{}{}
+				}
+			}
+		}
+		stacks[string(key)] = struct{}{}
+		depth += len(sample.LocationId)
+		stats.MaxDepth = max(stats.MaxDepth, len(sample.LocationId))
+	}
+	stats.Stacks = len(stacks)
+	stats.Functions = len(functions)
+	if stats.Samples > 0 {
+		stats.AvgDepth = float64(depth) / float64(stats.Samples)
+	}
+	return stats
+}
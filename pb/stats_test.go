@@ -0,0 +1,29 @@
+package pb
+
+import "testing"
+
+func TestProfileStats(t *testing.T) {
+	profile := &Profile{
+		StringTable: []string{"", "cpu", "nanoseconds", "main", "work"},
+		SampleType:  []*ValueType{{Type: 1, Unit: 2}},
+		Function: []*Function{
+			{Id: 1, Name: 3},
+			{Id: 2, Name: 4},
+		},
+		Location: []*Location{
+			{Id: 1, Line: []*Line{{FunctionId: 1}}},
+			{Id: 2, Line: []*Line{{FunctionId: 2}}},
+		},
+		Sample: []*Sample{
+			{LocationId: []uint64{2, 1}, Value: []int64{10}},
+			{LocationId: []uint64{2, 1}, Value: []int64{20}},
+			{LocationId: []uint64{1}, Value: []int64{30}},
+		},
+	}
+
+	stats := ProfileStats(profile)
+	want := Stats{Samples: 3, Stacks: 2, Functions: 2, Locations: 2, Strings: 5, StringBytes: 22, MaxDepth: 2, AvgDepth: 5.0 / 3}
+	if stats != want {
+		t.Errorf("Expected %+v, got %+v", want, stats)
+	}
+}
@@ -0,0 +1,93 @@
+package pb
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// WeightedStack is a call path drawn by SynthesizeStacks.
+type WeightedStack struct {
+	Frames []string // function names, root first
+	Draws  int      // number of times the stack was drawn
+}
+
+// SynthesizeStacks draws n call paths of p at random, each with a probability
+// proportional to its value of the sample type at index idx, e.g. its cpu,
+// from a generator seeded with seed so that the same seed draws the same
+// stacks. The stacks are returned most drawn first, so that the draws of each
+// are the representative weight of the path, e.g. to build microbenchmarks
+// or load tests mirroring the hotspots of the profile.
+func SynthesizeStacks(p *Profile, idx, n int, seed int64) ([]WeightedStack, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("number of stacks %d is not positive", n)
+	}
+	locations := buildLocationMap(p)
+	funcInfoMap := buildFunctionInfoMap(p)
+
+	// Sum the values of the samples of each path, as distinct locations can
+	// have the same functions.
+	var stacks []WeightedStack
+	var weights []int64
+	index := make(map[string]int)
+	for _, sample := range p.Sample {
+		if idx >= len(sample.Value) || sample.Value[idx] <= 0 {
+			continue
+		}
+		var frames []string
+		for i := len(sample.LocationId) - 1; i >= 0; i-- {
+			loc := locations[sample.LocationId[i]]
+			if loc == nil {
+				continue
+			}
+			for j := len(loc.Line) - 1; j >= 0; j-- {
+				if info, exists := funcInfoMap[loc.Line[j].FunctionId]; exists {
+					frames = append(frames, info.Name)
+				}
+			}
+		}
+		if len(frames) == 0 {
+			continue
+		}
+		key := strings.Join(frames, "\x00")
+		i, exists := index[key]
+		if !exists {
+			i = len(stacks)
+			index[key] = i
+			stacks = append(stacks, WeightedStack{Frames: frames})
+			weights = append(weights, 0)
+		}
+		weights[i] += sample.Value[idx]
+	}
+	if len(stacks) == 0 {
+		return nil, fmt.Errorf("no samples to draw stacks from")
+	}
+
+	cumulative := make([]int64, len(weights))
+	var total int64
+	for i, w := range weights {
+		total += w
+		cumulative[i] = total
+	}
+	rng := rand.New(rand.NewSource(seed))
+	for range n {
+		r := rng.Int63n(total)
+		i := sort.Search(len(cumulative), func(i int) bool { return cumulative[i] > r })
+		stacks[i].Draws++
+	}
+
+	drawn := stacks[:0]
+	for _, s := range stacks {
+		if s.Draws > 0 {
+			drawn = append(drawn, s)
+		}
+	}
+	sort.Slice(drawn, func(i, j int) bool {
+		if drawn[i].Draws != drawn[j].Draws {
+			return drawn[i].Draws > drawn[j].Draws
+		}
+		return strings.Join(drawn[i].Frames, ";") < strings.Join(drawn[j].Frames, ";")
+	})
+	return drawn, nil
+}
@@ -0,0 +1,65 @@
+package pb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSynthesizeStacks(t *testing.T) {
+	b := NewBuilder([2]string{"cpu", "nanoseconds"})
+	b.AddSample([]Stack{{Name: "main.parse"}, {Name: "main.main"}}, []int64{9e9}, nil)
+	b.AddSample([]Stack{{Name: "main.render"}, {Name: "main.main"}}, []int64{1e9}, nil)
+	b.AddSample([]Stack{{Name: "main.idle"}, {Name: "main.main"}}, []int64{0}, nil)
+	profile := b.Profile()
+
+	stacks, err := SynthesizeStacks(profile, 0, 1000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stacks) != 2 {
+		t.Fatalf("Expected the 2 stacks with cpu, got %+v", stacks)
+	}
+	if got := strings.Join(stacks[0].Frames, ";"); got != "main.main;main.parse" {
+		t.Errorf("Expected main.main;main.parse drawn most, got %s", got)
+	}
+	if n := stacks[0].Draws; n < 850 || n > 950 {
+		t.Errorf("Expected about 900 draws of main.parse, got %d", n)
+	}
+	if stacks[0].Draws+stacks[1].Draws != 1000 {
+		t.Errorf("Expected 1000 draws, got %d", stacks[0].Draws+stacks[1].Draws)
+	}
+
+	again, err := SynthesizeStacks(profile, 0, 1000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again[0].Draws != stacks[0].Draws {
+		t.Errorf("Expected the same seed to draw main.parse %d times, got %d", stacks[0].Draws, again[0].Draws)
+	}
+
+	if _, err := SynthesizeStacks(profile, 0, 0, 1); err == nil {
+		t.Error("Expected error for 0 stacks")
+	}
+}
+
+func TestSynthesizeStacksInlined(t *testing.T) {
+	// parse inlined into main at location 1
+	profile := &Profile{
+		StringTable: []string{"", "cpu", "nanoseconds", "main.main", "main.parse"},
+		SampleType:  []*ValueType{{Type: 1, Unit: 2}},
+		Function:    []*Function{{Id: 1, Name: 3}, {Id: 2, Name: 4}},
+		Location:    []*Location{{Id: 1, Line: []*Line{{FunctionId: 2}, {FunctionId: 1}}}},
+		Sample:      []*Sample{{LocationId: []uint64{1}, Value: []int64{1e9}}},
+	}
+
+	stacks, err := SynthesizeStacks(profile, 0, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stacks) != 1 {
+		t.Fatalf("Expected 1 stack, got %+v", stacks)
+	}
+	if got := strings.Join(stacks[0].Frames, ";"); got != "main.main;main.parse" {
+		t.Errorf("Expected main.main;main.parse, got %s", got)
+	}
+}
@@ -0,0 +1,151 @@
+package pb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxValidationIssues is the number of issues reported by Validate before it
+// gives up on a profile.
+const maxValidationIssues = 10
+
+// ValidationError lists the structural problems found in a profile.
+type ValidationError struct {
+	Issues []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid profile: " + strings.Join(e.Issues, "; ")
+}
+
+// Validate checks that every index and id in the profile refers to an existing
+// entry, so that the analyzers can index the profile's tables without bounds
+// checks. It returns a *ValidationError describing the first problems found.
+func Validate(p *Profile) error {
+	if p == nil {
+		return errors.New("nil profile")
+	}
+
+	v := &validator{p: p}
+	v.check()
+	if len(v.issues) > 0 {
+		return &ValidationError{Issues: v.issues}
+	}
+	return nil
+}
+
+type validator struct {
+	p      *Profile
+	issues []string
+}
+
+func (v *validator) addf(format string, args ...any) {
+	if len(v.issues) < maxValidationIssues {
+		v.issues = append(v.issues, fmt.Sprintf(format, args...))
+	}
+}
+
+// str checks that idx is a valid string table index.
+func (v *validator) str(idx int64, what string) {
+	if idx < 0 || idx >= int64(len(v.p.StringTable)) {
+		v.addf("%s: string index %d out of range", what, idx)
+	}
+}
+
+func (v *validator) check() {
+	p := v.p
+
+	if len(p.StringTable) == 0 || p.StringTable[0] != "" {
+		v.addf("string table must start with the empty string")
+		return
+	}
+
+	for i, st := range p.SampleType {
+		if st == nil {
+			v.addf("sample type %d: nil", i)
+			continue
+		}
+		v.str(st.Type, fmt.Sprintf("sample type %d", i))
+		v.str(st.Unit, fmt.Sprintf("sample type %d unit", i))
+	}
+	if p.PeriodType != nil {
+		v.str(p.PeriodType.Type, "period type")
+		v.str(p.PeriodType.Unit, "period type unit")
+	}
+	v.str(p.DefaultSampleType, "default sample type")
+	v.str(p.DropFrames, "drop frames")
+	v.str(p.KeepFrames, "keep frames")
+	v.str(p.DocUrl, "doc url")
+	for _, idx := range p.Comment {
+		v.str(idx, "comment")
+	}
+
+	mappings := make(map[uint64]bool, len(p.Mapping))
+	for _, m := range p.Mapping {
+		if m == nil || m.Id == 0 {
+			v.addf("mapping with id 0")
+			continue
+		}
+		mappings[m.Id] = true
+		v.str(m.Filename, fmt.Sprintf("mapping %d filename", m.Id))
+		v.str(m.BuildId, fmt.Sprintf("mapping %d build id", m.Id))
+	}
+
+	functions := make(map[uint64]bool, len(p.Function))
+	for _, fn := range p.Function {
+		if fn == nil || fn.Id == 0 {
+			v.addf("function with id 0")
+			continue
+		}
+		functions[fn.Id] = true
+		v.str(fn.Name, fmt.Sprintf("function %d name", fn.Id))
+		v.str(fn.SystemName, fmt.Sprintf("function %d system name", fn.Id))
+		v.str(fn.Filename, fmt.Sprintf("function %d filename", fn.Id))
+	}
+
+	locations := make(map[uint64]bool, len(p.Location))
+	for _, loc := range p.Location {
+		if loc == nil || loc.Id == 0 {
+			v.addf("location with id 0")
+			continue
+		}
+		locations[loc.Id] = true
+		if loc.MappingId != 0 && !mappings[loc.MappingId] {
+			v.addf("location %d: unknown mapping id %d", loc.Id, loc.MappingId)
+		}
+		for _, line := range loc.Line {
+			if line == nil || !functions[line.FunctionId] {
+				v.addf("location %d: unknown function id", loc.Id)
+			}
+		}
+	}
+
+	for i, sample := range p.Sample {
+		if sample == nil {
+			v.addf("sample %d: nil", i)
+			continue
+		}
+		if len(sample.Value) != len(p.SampleType) {
+			v.addf("sample %d: %d values for %d sample types", i, len(sample.Value), len(p.SampleType))
+		}
+		for _, id := range sample.LocationId {
+			if !locations[id] {
+				v.addf("sample %d: unknown location id %d", i, id)
+				break
+			}
+		}
+		for _, label := range sample.Label {
+			if label == nil {
+				v.addf("sample %d: nil label", i)
+				continue
+			}
+			v.str(label.Key, fmt.Sprintf("sample %d label key", i))
+			v.str(label.Str, fmt.Sprintf("sample %d label value", i))
+			v.str(label.NumUnit, fmt.Sprintf("sample %d label unit", i))
+		}
+		if len(v.issues) >= maxValidationIssues {
+			return
+		}
+	}
+}
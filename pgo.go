@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/kmrgirish/pprof-adv/internal/exe"
+	"github.com/kmrgirish/pprof-adv/internal/input"
+	"github.com/kmrgirish/pprof-adv/internal/pgo"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+type PgoCmd struct {
+	Config string `arg:"--config" help:"pgo.yaml describing the services, environments and time windows to merge" default:"pgo.yaml"`
+	Output string `arg:"--output" help:"path to write the merged profile to, overrides the output of the config"`
+	Binary string `arg:"--binary" help:"executable to check the symbols of the merged profile against"`
+	Top    int    `arg:"--top"    help:"number of hot functions of the inputs the merged profile must cover" default:"20"`
+
+	Verify *PgoVerifyCmd `arg:"subcommand:verify" help:"check a generated pgo profile against its inputs and binary"`
+	Inline *PgoInlineCmd `arg:"subcommand:inline" help:"report hot small functions that are not inlined, the ones pgo is likely to inline"`
+}
+
+type PgoVerifyCmd struct {
+	Profile string   `arg:"--profile"  help:"pgo profile to verify" default:"default.pgo"`
+	Inputs  []string `arg:"positional" help:"profiles the pgo profile was generated from"`
+	Binary  string   `arg:"--binary"   help:"executable to check the symbols of the profile against"`
+	Top     int      `arg:"--top"      help:"number of hot functions of the inputs the profile must cover" default:"20"`
+}
+
+type PgoInlineCmd struct {
+	Profile string `arg:"positional,required" help:"cpu profile of the service, e.g. the default.pgo it is built with"`
+	Binary  string `arg:"--binary"            help:"executable the profile was recorded from, to measure functions in bytes of machine code rather than sampled source lines"`
+	MaxSize int    `arg:"--max-size"          help:"size of the largest reported function, in bytes with --binary and in lines without (default: 1024 bytes or 30 lines)"`
+	Top     int    `arg:"--top"               help:"number of functions to report" default:"20"`
+}
+
+func (cmd *PgoCmd) run(root *Cmd) {
+	if cmd.Verify != nil {
+		cmd.Verify.run()
+		return
+	}
+	if cmd.Inline != nil {
+		cmd.Inline.run()
+		return
+	}
+
+	f, err := os.Open(cmd.Config)
+	if err != nil {
+		fail("Error opening config: %s", err)
+	}
+	cfg, err := pgo.ParseConfig(f)
+	f.Close()
+	if err != nil {
+		fail("Error parsing %s: %s", cmd.Config, err)
+	}
+	if cmd.Output != "" {
+		cfg.Output = cmd.Output
+	}
+
+	client := root.newClient()
+
+	profile, sources, err := pgo.Generate(context.Background(), client, cfg)
+	if err != nil {
+		fail("Error generating pgo profile: %s", err)
+	}
+
+	out, err := os.Create(cfg.Output)
+	if err != nil {
+		fail("Error creating %s: %s", cfg.Output, err)
+	}
+	if err := pb.Write(out, profile); err != nil {
+		fail("Error writing %s: %s", cfg.Output, err)
+	}
+	if err := out.Close(); err != nil {
+		fail("Error writing %s: %s", cfg.Output, err)
+	}
+	fmt.Printf("Wrote %s from %d samples of %d queries\n", cfg.Output, len(profile.Sample), len(cfg.Sources))
+
+	verify(cfg.Output, sources, cmd.Binary, cmd.Top)
+}
+
+func (cmd *PgoVerifyCmd) run() {
+	var inputs []*pb.Profile
+	for _, path := range cmd.Inputs {
+		inputs = append(inputs, readProfile(path))
+	}
+	verify(cmd.Profile, inputs, cmd.Binary, cmd.Top)
+}
+
+// run reports the hot small functions of the profile that are called rather
+// than inlined, so the effect of building with -pgo can be measured by
+// comparing the report of profiles recorded before and after.
+func (cmd *PgoInlineCmd) run() {
+	profile := readProfile(cmd.Profile)
+
+	opts := pgo.InlineOptions{MaxSize: cmd.MaxSize, Top: cmd.Top}
+	if cmd.Binary != "" {
+		file, err := exe.Open(cmd.Binary)
+		if err != nil {
+			fail("Error reading binary: %s", err)
+		}
+		if err := file.Match(profile); err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: the profile does not match %s: %s\n", cmd.Binary, err)
+		}
+		opts.Sizes = file.Sizes
+	}
+
+	report, err := pgo.Inlining(profile, opts)
+	if err != nil {
+		fail("Error analyzing %s: %s", cmd.Profile, err)
+	}
+	report.Write(os.Stdout)
+}
+
+// verify re-reads the pgo profile at path and reports how well it covers the
+// inputs and binary, failing if hot functions of the inputs are missing.
+func verify(path string, inputs []*pb.Profile, binary string, top int) {
+	profile := readProfile(path)
+
+	var symbols map[string]bool
+	if binary != "" {
+		file, err := exe.Open(binary)
+		if err != nil {
+			fail("Error reading binary: %s", err)
+		}
+		symbols = file.Symbols
+	}
+
+	report, err := pgo.Verify(profile, inputs, top, symbols)
+	if err != nil {
+		fail("Error verifying %s: %s", path, err)
+	}
+	report.Write(os.Stdout)
+
+	if missing := report.Missing(); len(missing) > 0 {
+		fail("%s misses %d of the top %d hot functions\n", path, len(missing), len(report.Hot))
+	}
+}
+
+// readProfile parses the pprof file at path.
+func readProfile(path string) *pb.Profile {
+	f, err := os.Open(path)
+	if err != nil {
+		fail("Error opening file: %s", err)
+	}
+	defer f.Close()
+
+	profile, err := input.Parse(f, "pprof")
+	if err != nil {
+		fail("Error parsing %s: %s", path, err)
+	}
+	return profile
+}
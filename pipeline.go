@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/cgroup"
+	"github.com/kmrgirish/pprof-adv/internal/contention"
+	"github.com/kmrgirish/pprof-adv/internal/cpu"
+	"github.com/kmrgirish/pprof-adv/internal/input"
+	"github.com/kmrgirish/pprof-adv/internal/k8s"
+	"github.com/kmrgirish/pprof-adv/internal/pipeline"
+	"github.com/kmrgirish/pprof-adv/internal/remote"
+	"github.com/kmrgirish/pprof-adv/pb"
+	"github.com/kmrgirish/pprof-adv/profiler"
+)
+
+// The stages of the pipelines of the flags build the stage they ask for, nil
+// when they don't.
+type (
+	sourceStage    func(cmd *Cmd) pipeline.Source
+	transformStage func(cmd *Cmd) pipeline.Transform
+	sinkStage      func(cmd *Cmd) pipeline.Sink
+)
+
+// The stages of the pipeline reporting on a profile, by name in the order
+// they are built: the first source the flags ask for reads the profile, then
+// every transform and sink they ask for applies. --focus, --ignore and the
+// cpu attribution flags are options of the analysis of the sinks rather than
+// transforms, as the samples they drop still count in the totals. The
+// subcommands, e.g. diff comparing two profiles, run on their own.
+var (
+	sources    pipeline.Registry[sourceStage]
+	transforms pipeline.Registry[transformStage]
+	sinks      pipeline.Registry[sinkStage]
+)
+
+func init() {
+	sources.Register("ssh", sshSource)
+	sources.Register("stdin", stdinSource)
+	sources.Register("url", urlSource)
+	sources.Register("file", fileSource)
+	sources.Register("k8s", k8sSource)
+	sources.Register("datadog-id", datadogIDSource)
+	sources.Register("datadog", datadogSource)
+
+	transforms.Register("duration", durationTransform)
+	transforms.Register("binary", binaryTransform)
+	transforms.Register("sample", sampleTransform)
+	transforms.Register("type", typeTransform)
+
+	sinks.Register("archive", archiveSink)
+	sinks.Register("report", reportSink)
+	sinks.Register("contention", contentionSink)
+	sinks.Register("dd-event", ddEventSink)
+}
+
+// buildPipeline returns the pipeline of the flags out of the registered
+// stages, exiting when they ask for no source.
+func (cmd *Cmd) buildPipeline() *pipeline.Pipeline {
+	p := &pipeline.Pipeline{
+		Parse: func(r io.Reader) (*pb.Profile, error) { return cmd.parseProfile(r, cmd.Input), nil },
+	}
+	if cmd.Type == "all" {
+		// Every profile of the archive is reported in turn, those that fail
+		// in their section rather than failing the others.
+		p.Split = cmd.splitArchive
+		p.Parse = cmd.parsePart
+		p.PartFailed = func(ctx context.Context, err error) error {
+			part, _ := pipeline.PartOf(ctx)
+			fmt.Printf("== %s\n\t%s\n", part.Name, err)
+			return nil
+		}
+	}
+	for _, name := range sources.Names() {
+		stage, _ := sources.Get(name)
+		if p.Source = stage(cmd); p.Source != nil {
+			break
+		}
+	}
+	if p.Source == nil {
+		fail("Either --profile, --apm, --profile-id, --k8s, --ssh or a profile on stdin must be provided")
+	}
+	for _, name := range transforms.Names() {
+		stage, _ := transforms.Get(name)
+		if t := stage(cmd); t != nil {
+			p.Transforms = append(p.Transforms, t)
+		}
+	}
+	for _, name := range sinks.Names() {
+		stage, _ := sinks.Get(name)
+		if s := stage(cmd); s != nil {
+			p.Sinks = append(p.Sinks, s)
+		}
+	}
+	return p
+}
+
+// splitArchive returns the profiles of a zip archive, such as a Datadog
+// download, sorted by name, or the single profile of other data. It sets the
+// metrics of the archive for the reports of its profiles.
+func (cmd *Cmd) splitArchive(data []byte) ([]pipeline.Part, error) {
+	files, err := input.Profiles(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := input.ArchiveFile(data, "metrics.json")
+	if err != nil {
+		return nil, fmt.Errorf("reading metrics: %w", err)
+	}
+	if metrics != nil {
+		if cmd.metrics, err = profiler.ParseMetrics(metrics); err != nil {
+			fmt.Fprintf(os.Stderr, "WARNING: ignoring metrics.json: %s\n", err)
+		}
+	}
+
+	parts := make([]pipeline.Part, 0, len(files))
+	for name, data := range files {
+		parts = append(parts, pipeline.Part{Name: name, Data: data})
+	}
+	slices.SortFunc(parts, func(a, b pipeline.Part) int { return strings.Compare(a.Name, b.Name) })
+	return parts, nil
+}
+
+// parsePart parses a profile of an archive, returning the error rather than
+// exiting so that the other profiles are still reported.
+func (cmd *Cmd) parsePart(r io.Reader) (*pb.Profile, error) {
+	profile, err := input.Parse(r, cmd.Input)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.TrimPaths {
+		pb.TrimPaths(profile)
+	}
+	return profile, nil
+}
+
+// sourceOf returns the source of the data of open.
+func sourceOf(open func(ctx context.Context) ([]byte, error)) pipeline.Source {
+	return pipeline.SourceFunc(func(ctx context.Context) (io.ReadCloser, error) {
+		data, err := open(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+}
+
+// sshSource collects the --type profile of the --ssh host, or copies the
+// --profile file from it.
+func sshSource(cmd *Cmd) pipeline.Source {
+	if cmd.SSH == "" {
+		return nil
+	}
+	return sourceOf(func(ctx context.Context) ([]byte, error) {
+		var data []byte
+		var err error
+		if cmd.Profile != "" {
+			data, err = remote.CopySSH(ctx, cmd.SSH, cmd.Profile)
+		} else {
+			if cmd.Type == "" || cmd.Type == "cpu" {
+				fmt.Fprintf(os.Stderr, "Collecting a %ds cpu profile from %s\n", cmd.Seconds, cmd.SSH)
+			}
+			data, err = remote.FetchSSH(ctx, cmd.SSH, cmd.PprofPort, cmd.Type, cmd.Seconds)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("collecting profile: %w", err)
+		}
+		return data, nil
+	})
+}
+
+// stdinSource reads the profile from stdin with --profile - or when it is
+// piped without other sources.
+func stdinSource(cmd *Cmd) pipeline.Source {
+	if cmd.Profile != "-" && (cmd.Profile != "" || cmd.Service != "" || cmd.ProfileID != "" || cmd.K8s != "" || !stdinIsPipe()) {
+		return nil
+	}
+	return pipeline.SourceFunc(func(ctx context.Context) (io.ReadCloser, error) {
+		return io.NopCloser(os.Stdin), nil
+	})
+}
+
+// urlSource downloads the --profile when it is an http or https URL, e.g. of
+// a net/http/pprof endpoint or an artifact of a CI run.
+func urlSource(cmd *Cmd) pipeline.Source {
+	if !strings.HasPrefix(cmd.Profile, "http://") && !strings.HasPrefix(cmd.Profile, "https://") {
+		return nil
+	}
+	return pipeline.SourceFunc(func(ctx context.Context) (io.ReadCloser, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, cmd.Profile, nil)
+		if err != nil {
+			return nil, fmt.Errorf("downloading profile: %w", err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("downloading profile: %w", err)
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("downloading profile: %s returned %s", cmd.Profile, res.Status)
+		}
+		return res.Body, nil
+	})
+}
+
+// fileSource opens the --profile file.
+func fileSource(cmd *Cmd) pipeline.Source {
+	if cmd.Profile == "" {
+		return nil
+	}
+	return pipeline.SourceFunc(func(ctx context.Context) (io.ReadCloser, error) {
+		f, err := os.Open(cmd.Profile)
+		if err != nil {
+			return nil, fmt.Errorf("opening file: %w", err)
+		}
+		return f, nil
+	})
+}
+
+// k8sSource collects the --type profile of the --k8s pod.
+func k8sSource(cmd *Cmd) pipeline.Source {
+	if cmd.K8s == "" {
+		return nil
+	}
+	target, err := k8s.ParseTarget(cmd.K8s, cmd.Namespace, cmd.PprofPort)
+	if err != nil {
+		fail("Invalid --k8s: %s", err)
+	}
+	return sourceOf(func(ctx context.Context) ([]byte, error) {
+		if cmd.Type == "" || cmd.Type == "cpu" {
+			fmt.Fprintf(os.Stderr, "Collecting a %ds cpu profile from %s\n", cmd.Seconds, target.Pod)
+		}
+		data, err := k8s.Fetch(ctx, target, cmd.Type, cmd.Seconds)
+		if err != nil {
+			return nil, fmt.Errorf("collecting profile: %w", err)
+		}
+		return data, nil
+	})
+}
+
+// datadogIDSource downloads the Datadog profile of the --profile-id, its
+// archive of every profile with --type all.
+func datadogIDSource(cmd *Cmd) pipeline.Source {
+	if cmd.ProfileID == "" {
+		return nil
+	}
+	return pipeline.SourceFunc(func(ctx context.Context) (io.ReadCloser, error) {
+		client := cmd.newClient()
+		if cmd.Type == "all" {
+			archive, err := client.GetProfileArchiveByID(ctx, cmd.ProfileID, cmd.EventID)
+			if err != nil {
+				return nil, fmt.Errorf("getting profiles: %w", err)
+			}
+			return archive, nil
+		}
+		info, f, err := client.FetchCPUProfileByID(ctx, cmd.ProfileID, cmd.EventID, cmd.Runtime)
+		if err != nil {
+			return nil, fmt.Errorf("getting CPU profile: %w", err)
+		}
+		cmd.Input = cmd.detectRuntime(info)
+		cmd.analyzing(info)
+		return io.NopCloser(f), nil
+	})
+}
+
+// datadogSource downloads the top profile of the --apm service, its archive
+// of every profile with --type all.
+func datadogSource(cmd *Cmd) pipeline.Source {
+	if cmd.Service == "" {
+		return nil
+	}
+	return pipeline.SourceFunc(func(ctx context.Context) (io.ReadCloser, error) {
+		if cmd.Type != "all" {
+			var info *profiler.SearchProfile
+			var f io.Reader
+			info, f, cmd.Input = cmd.download(cmd.Environment)
+			cmd.analyzing(info)
+			return io.NopCloser(f), nil
+		}
+		info, archive, err := cmd.newClient().FetchProfileArchive(ctx, cmd.Service, cmd.Environment, time.Hour)
+		if err != nil {
+			return nil, fmt.Errorf("getting profiles: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Analyzing %s\n", info)
+		return archive, nil
+	})
+}
+
+// durationTransform sets the duration of profiles that record none to the
+// one Datadog tells in the event of the download, e.g. of JFR recordings.
+func durationTransform(cmd *Cmd) pipeline.Transform {
+	return pipeline.TransformFunc(func(ctx context.Context, p *pb.Profile) (*pb.Profile, error) {
+		if p.DurationNanos == 0 {
+			p.DurationNanos = cmd.duration.Nanoseconds()
+		}
+		return p, nil
+	})
+}
+
+// binaryTransform checks that the profile was recorded from the --binary.
+func binaryTransform(cmd *Cmd) pipeline.Transform {
+	if cmd.Binary == "" {
+		return nil
+	}
+	return pipeline.TransformFunc(func(ctx context.Context, p *pb.Profile) (*pb.Profile, error) {
+		checkBinary(p, cmd.Binary, cmd.Strict)
+		return p, nil
+	})
+}
+
+// sampleTransform keeps the --sample-fraction of the samples.
+func sampleTransform(cmd *Cmd) pipeline.Transform {
+	return pipeline.TransformFunc(func(ctx context.Context, p *pb.Profile) (*pb.Profile, error) {
+		return cmd.sample(p), nil
+	})
+}
+
+// typeTransform sets the --type and --sample-type the sinks report, detected
+// from the profile when unset.
+func typeTransform(cmd *Cmd) pipeline.Transform {
+	if cmd.Type == "all" {
+		// archiveSink detects the type of each profile
+		return nil
+	}
+	return pipeline.TransformFunc(func(ctx context.Context, p *pb.Profile) (*pb.Profile, error) {
+		if cmd.Type == "" {
+			cmd.Type = detectType(p)
+		}
+		if !cpuLike(cmd.Type) && !slices.Contains(contentionTypes, cmd.Type) {
+			return nil, fmt.Errorf("unsupported type: %s", cmd.Type)
+		}
+		if cmd.SampleType == "" {
+			cmd.SampleType = pb.TypeSampleType(p, cmd.Type)
+		}
+		return p, nil
+	})
+}
+
+// contentionTypes are the types of profiles of the time goroutines waited.
+var contentionTypes = []string{"block", "mutex"}
+
+// cpuLike reports whether profiles of the type are reported like cpu
+// profiles, by the usage of their functions.
+func cpuLike(typ string) bool {
+	return slices.Contains([]string{"cpu", "wall", "heap", "goroutine"}, typ)
+}
+
+// archiveSink writes the section of a profile of the archive of --type all,
+// reported as its detected type.
+func archiveSink(cmd *Cmd) pipeline.Sink {
+	if cmd.Type != "all" {
+		return nil
+	}
+	return pipeline.SinkFunc(func(ctx context.Context, p *pb.Profile) error {
+		part, _ := pipeline.PartOf(ctx)
+		types := pb.DetectTypes(p)
+		if len(types) == 0 {
+			fmt.Printf("== %s\n\tunknown profile type\n", part.Name)
+			return nil
+		}
+		typ := types[0]
+		if typ == pb.TypeBlock && strings.Contains(part.Name, "mutex") {
+			typ = pb.TypeMutex // the file name tells what the sample types can't
+		}
+
+		fmt.Printf("== %s (%s)\n", typ, part.Name)
+		var err error
+		if typ == pb.TypeBlock || typ == pb.TypeMutex {
+			err = contention.Transform(p, os.Stdout, cmd.Top, cmd.style())
+		} else {
+			opts := cmd.analyzeOptions()
+			if opts.SampleType == "" {
+				opts.SampleType = pb.TypeSampleType(p, typ)
+			}
+			style := cmd.style()
+			if typ == pb.TypeCPU {
+				limits := cgroup.FromMetrics(cmd.metrics)
+				style.UsedCores = cgroup.Usage(p)
+				style.HostCores = cmd.hostCores(limits)
+				limits.Write(os.Stdout, style.UsedCores)
+			}
+			err = cpu.Transform(p, os.Stdout, opts, style)
+		}
+		if err != nil {
+			fmt.Printf("\t%s\n", err)
+		}
+		return nil
+	})
+}
+
+// reportSink writes the report of the --format of cpu-like profiles, each
+// analyzed once whatever the number of formats, or their --pivot or
+// warehouse SQL.
+func reportSink(cmd *Cmd) pipeline.Sink {
+	return pipeline.SinkFunc(func(ctx context.Context, p *pb.Profile) error {
+		if !cpuLike(cmd.Type) {
+			return nil
+		}
+		if cmd.Pivot != "" || cmd.Format == "clickhouse" || cmd.Format == "bq" {
+			if cmd.Slice > 0 || cmd.Query != "" {
+				fail("--slice and --query can't be combined with --pivot or --format %s", cmd.Format)
+			}
+			w, done := cmd.output(cmd.Format, false)
+			defer done()
+			if cmd.Pivot == "" {
+				cmd.writeWarehouse(p, w)
+			} else if err := cpu.TransformPivot(p, w, cmd.analyzeOptions(), cmd.Pivot, cmd.Format, cmd.style(), cmd.theme()); err != nil {
+				return fmt.Errorf("transforming profile: %w", err)
+			}
+			return nil
+		}
+
+		analysis, err := cpu.Analyze(p, cmd.analyzeOptions())
+		if err != nil {
+			return fmt.Errorf("transforming profile: %w", err)
+		}
+		if cmd.Query != "" {
+			if analysis.Query, err = cpu.ParseQuery(cmd.Query); err != nil {
+				fail("Invalid --query: %s", err)
+			}
+		}
+		// Every format is checked before any is written, so that an invalid
+		// one does not leave the others half written.
+		formats := strings.Split(cmd.Format, ",")
+		cmd.checkOutputs(formats)
+		formatters := make([]cpu.Formatter, len(formats))
+		for i, format := range formats {
+			formatters[i] = cmd.formatter(p, format)
+		}
+		for i, format := range formats {
+			w, done := cmd.output(format, len(formats) > 1)
+			err := formatters[i].Format(analysis, w)
+			done()
+			if err != nil {
+				return fmt.Errorf("transforming profile: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// contentionSink writes the report of block and mutex profiles.
+func contentionSink(cmd *Cmd) pipeline.Sink {
+	return pipeline.SinkFunc(func(ctx context.Context, p *pb.Profile) error {
+		if !slices.Contains(contentionTypes, cmd.Type) {
+			return nil
+		}
+		w, done := cmd.output(cmd.Format, false)
+		defer done()
+		if err := contention.Transform(p, w, cmd.Top, cmd.style()); err != nil {
+			return fmt.Errorf("transforming profile: %w", err)
+		}
+		return nil
+	})
+}
+
+// ddEventSink posts the Datadog event of --post-dd-event summarizing the text
+// report of cpu-like profiles.
+func ddEventSink(cmd *Cmd) pipeline.Sink {
+	if !cmd.PostDdEvent {
+		return nil
+	}
+	return pipeline.SinkFunc(func(ctx context.Context, p *pb.Profile) error {
+		formats := strings.Split(cmd.Format, ",")
+		text := slices.Contains(formats, "csv") || slices.Contains(formats, "text")
+		if cpuLike(cmd.Type) && text && cmd.Pivot == "" && cmd.Slice == 0 {
+			cmd.postEvent(p)
+		}
+		return nil
+	})
+}
@@ -8,12 +8,19 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/version"
 )
 
-// maxConcurrency is the maximum number of concurrent requests to make to the
-// Datadog API.
+// ErrNoProfiles is returned when a search matches no profiles.
+var ErrNoProfiles = errors.New("no profiles found")
+
+// maxConcurrency is the default maximum number of concurrent requests to make
+// to the Datadog API, see SetLimits.
 const maxConcurrency = 5
 
 // Client is a client for the Datadog API.
@@ -21,7 +28,18 @@ type Client struct {
 	site        string
 	apiKey      string
 	appKey      string
+	app         string // base url of the api
+	intake      string // base url of the profiling intake
 	concurrency chan struct{}
+	bandwidth   *bandwidth // nil if unlimited
+
+	// Progress, if set, is called as the body of a profile download is
+	// received, with the bytes received so far and the size of the download,
+	// -1 if unknown, and a last time with both equal once it is complete,
+	// e.g. to show the progress of large downloads.
+	Progress func(received, size int64)
+	// Hooks, if set, observe the requests of the client, see MetricsHooks.
+	Hooks Hooks
 }
 
 // NewClient creates a new Datadog API client.
@@ -45,6 +63,8 @@ func NewClient(apiKey, appKey, site string) (*Client, error) {
 		apiKey:      apiKey,
 		appKey:      appKey,
 		site:        site,
+		app:         appURL(site),
+		intake:      "https://intake.profile." + site,
 		concurrency: make(chan struct{}, maxConcurrency),
 	}, nil
 }
@@ -60,6 +80,7 @@ func ClientFromEnv() (*Client, error) {
 // It automatically adds the "service" and "env" tags to the query.
 // It uses the PGO endpoint if runtime is go
 // It handles profile merging and returns an io.Reader for the resulting pprof file.
+// For the jvm runtime the reader holds the JFR recording instead.
 //
 // Example:
 //
@@ -71,66 +92,152 @@ func ClientFromEnv() (*Client, error) {
 //
 // // Use profileReader to read the pprof data...
 func (c *Client) GetCPUProfile(ctx context.Context, service, environment, runtime string, window time.Duration, limit int) (io.Reader, error) {
-	query := fmt.Sprintf("service:%s env:%s", service, environment)
-	// if runtime != "" && !strings.Contains(query, "runtime:") && !strings.Contains(query, "language:") {
-	// 	query += fmt.Sprintf(" runtime:%s", runtime)
-	// }
-
-	queries := []SearchQuery{
-		{
-			Filter: SearchFilter{
-				From:  JSONTime{time.Now().Add(-window)},
-				To:    JSONTime{time.Now()},
-				Query: query,
-			},
-			Sort: SearchSort{
-				Order: "desc",
-				// TODO(fg) or use @metrics.core_cpu_time_total?
-				Field: "@metrics.core_cpu_cores",
-			},
-			Limit: limit,
-		},
-	}
+	_, r, err := c.FetchCPUProfile(ctx, service, environment, runtime, window, limit)
+	return r, err
+}
 
-	// Set limit to 1 to get only top profile
-	queries[0].Limit = 1
+// FetchCPUProfile is GetCPUProfile, also returning the search result of the
+// downloaded profile, which describes its host, version and profiler.
+func (c *Client) FetchCPUProfile(ctx context.Context, service, environment, runtime string, window time.Duration, limit int) (*SearchProfile, io.Reader, error) {
+	now := time.Now()
+	return c.FetchCPUProfileBetween(ctx, service, environment, runtime, now.Add(-window), now)
+}
 
-	// Search for the top profile
-	profiles, err := c.SearchProfiles(ctx, queries[0])
+// FetchCPUProfileBetween is FetchCPUProfile for the profiles recorded between
+// from and to, e.g. before or after a deploy.
+func (c *Client) FetchCPUProfileBetween(ctx context.Context, service, environment, runtime string, from, to time.Time) (*SearchProfile, io.Reader, error) {
+	return c.fetchCPUProfile(ctx, service, environment, "", runtime, from, to)
+}
+
+// FetchLanguageCPUProfile is FetchCPUProfileBetween for the profiles of one
+// language of a polyglot service, e.g. the python workers deployed under the
+// service of a go API, told apart by their language tag.
+func (c *Client) FetchLanguageCPUProfile(ctx context.Context, service, environment, language string, from, to time.Time) (*SearchProfile, io.Reader, error) {
+	return c.fetchCPUProfile(ctx, service, environment, language, RuntimeOf(language), from, to)
+}
+
+// fetchCPUProfile downloads the top profile of the service, of the language
+// unless empty, and extracts its cpu profile as recorded by the runtime, which
+// is detected from the language of the profile when empty.
+func (c *Client) fetchCPUProfile(ctx context.Context, service, environment, language, runtime string, from, to time.Time) (*SearchProfile, io.Reader, error) {
+	profile, download, err := c.fetchTop(ctx, service, environment, language, from, to)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	defer download.Close()
+	if err := download.describe(profile); err != nil {
+		return nil, nil, err
+	}
+	if runtime == "" {
+		runtime = profile.Runtime()
 	}
 
-	// Download the profile
-	download, err := c.DownloadProfile(ctx, profiles[0])
+	// Extract CPU profile data
+	cpuData, err := download.cpuProfile(runtime)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	// Extract CPU profile data
-	cpuData, err := download.ExtractCPUProfile()
+	return profile, bytes.NewBuffer(cpuData), nil
+}
+
+// FetchProfileArchive downloads the top profile of the service like
+// FetchCPUProfile, returning the zip archive of all its profiles, e.g. the
+// cpu, heap, goroutine and mutex profiles of go services. Closing the archive
+// removes the temporary file it was downloaded to.
+func (c *Client) FetchProfileArchive(ctx context.Context, service, environment string, window time.Duration) (*SearchProfile, io.ReadCloser, error) {
+	now := time.Now()
+	profile, download, err := c.fetchTop(ctx, service, environment, "", now.Add(-window), now)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	return profile, download.Archive(), nil
+}
 
-	return bytes.NewBuffer(cpuData), nil
+// fetchTop searches the profile of the service using the most cpu between
+// from and to, of the language unless empty, and downloads it.
+func (c *Client) fetchTop(ctx context.Context, service, environment, language string, from, to time.Time) (*SearchProfile, ProfileDownload, error) {
+	if err := validateTags(service, environment); err != nil {
+		return nil, ProfileDownload{}, err
+	}
+	filter := fmt.Sprintf("service:%s env:%s", service, environment)
+	if language != "" {
+		filter += " language:" + language
+	}
+	query := SearchQuery{
+		Filter: SearchFilter{
+			From:  JSONTime{from},
+			To:    JSONTime{to},
+			Query: filter,
+		},
+		Sort: SearchSort{
+			Order: "desc",
+			// TODO(fg) or use @metrics.core_cpu_time_total?
+			Field: "@metrics.core_cpu_cores",
+		},
+		// Only the top profile is downloaded
+		Limit: 1,
+	}
 
-	// // if err := ApplyNoInlineHack(prof); err != nil {
-	// // 	return nil, err
-	// // }
+	// Search for the top profile
+	profiles, err := c.SearchProfiles(ctx, query)
+	if errors.Is(err, ErrNoProfiles) && language != "" {
+		return nil, ProfileDownload{}, fmt.Errorf("%w for %s: the service has no %s profiles in it", ErrNoProfiles, filter, language)
+	} else if errors.Is(err, ErrNoProfiles) {
+		return nil, ProfileDownload{}, c.diagnose(ctx, service, environment, to.Sub(from))
+	} else if err != nil {
+		return nil, ProfileDownload{}, err
+	}
 
-	// // Create pipe to write profile data
-	// pr, pw := io.Pipe()
-	// go func() {
-	// 	defer pw.Close()
-	// 	err := prof.Write(pw)
-	// 	if err != nil {
-	// 		pw.CloseWithError(err)
-	// 		return
-	// 	}
-	// }()
+	// Download the profile
+	download, err := c.DownloadProfile(ctx, profiles[0])
+	if err != nil {
+		return nil, ProfileDownload{}, err
+	}
+	return profiles[0], download, nil
+}
 
-	// return pr, nil
+// GetCPUProfileByID downloads the profile with the ids shown in the Datadog
+// UI, skipping the search, and returns its cpu profile like GetCPUProfile. The
+// event id may be empty.
+func (c *Client) GetCPUProfileByID(ctx context.Context, profileID, eventID, runtime string) (io.Reader, error) {
+	_, r, err := c.FetchCPUProfileByID(ctx, profileID, eventID, runtime)
+	return r, err
+}
+
+// FetchCPUProfileByID is GetCPUProfileByID, also returning the profile as
+// described by the event.json of the download, whose language tells the
+// runtime when empty.
+func (c *Client) FetchCPUProfileByID(ctx context.Context, profileID, eventID, runtime string) (*SearchProfile, io.Reader, error) {
+	profile := &SearchProfile{ProfileID: profileID, EventID: eventID}
+	download, err := c.DownloadProfile(ctx, profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer download.Close()
+	if err := download.describe(profile); err != nil {
+		return nil, nil, err
+	}
+	if runtime == "" {
+		runtime = profile.Runtime()
+	}
+	cpuData, err := download.cpuProfile(runtime)
+	if err != nil {
+		return nil, nil, err
+	}
+	return profile, bytes.NewBuffer(cpuData), nil
+}
+
+// GetProfileArchiveByID downloads the profile with the ids shown in the
+// Datadog UI like GetCPUProfileByID, returning the zip archive of all its
+// profiles, which removes the temporary file it was downloaded to when
+// closed.
+func (c *Client) GetProfileArchiveByID(ctx context.Context, profileID, eventID string) (io.ReadCloser, error) {
+	download, err := c.DownloadProfile(ctx, &SearchProfile{ProfileID: profileID, EventID: eventID})
+	if err != nil {
+		return nil, err
+	}
+	return download.Archive(), nil
 }
 
 // SearchAndDownloadProfiles searches for profiles using the given queries and
@@ -163,6 +270,10 @@ func (c *Client) SearchProfiles(ctx context.Context, query SearchQuery) (profile
 				Service       string   `json:"service"`
 				DurationNanos float64  `json:"duration_nanos"`
 				Timestamp     JSONTime `json:"timestamp"`
+				Host          string   `json:"host"`
+				Version       string   `json:"version"`
+				RuntimeID     string   `json:"runtime-id"`
+				Tags          []string `json:"tags"`
 				Custom        struct {
 					Metrics struct {
 						CoreCPUCores float64 `json:"core_cpu_cores"`
@@ -179,7 +290,7 @@ func (c *Client) SearchProfiles(ctx context.Context, query SearchQuery) (profile
 	}
 
 	if len(response.Data) == 0 {
-		return nil, errors.New("no profiles found")
+		return nil, ErrNoProfiles
 	}
 
 	for _, item := range response.Data {
@@ -190,62 +301,232 @@ func (c *Client) SearchProfiles(ctx context.Context, query SearchQuery) (profile
 			CPUCores:  item.Attributes.Custom.Metrics.CoreCPUCores,
 			Timestamp: item.Attributes.Timestamp.Time,
 			Duration:  time.Duration(item.Attributes.DurationNanos),
+
+			Version:   item.Attributes.Version,
+			Host:      item.Attributes.Host,
+			RuntimeID: item.Attributes.RuntimeID,
 		}
+		p.setTags(item.Attributes.Tags)
 		profiles = append(profiles, p)
 	}
 	return
 }
 
+// maxDownloadAttempts is the number of times a download is attempted, each
+// resuming where the previous one failed.
+const maxDownloadAttempts = 5
+
+// downloadRetryDelay is the delay before resuming a failed download, times
+// the number of the attempt.
+var downloadRetryDelay = time.Second
+
 // DownloadProfile downloads the profile identified by the given SearchProfile.
+// The download is streamed to a temporary file and resumed with a Range
+// request where it stopped when the connection fails, up to
+// maxDownloadAttempts times, so that large downloads survive flaky networks.
+// Closing the download removes the temporary file.
 func (c *Client) DownloadProfile(ctx context.Context, p *SearchProfile) (d ProfileDownload, err error) {
 	defer wrapErr(&err, "download profile")
 	defer c.limitConcurrency()()
-	req, err := c.request(ctx, "GET", fmt.Sprintf("/api/ui/profiling/profiles/%s/download?eventId=%s", p.ProfileID, p.EventID), nil)
+	path := "/api/ui/profiling/profiles/" + url.PathEscape(p.ProfileID) + "/download"
+	if p.EventID != "" {
+		path += "?eventId=" + url.QueryEscape(p.EventID)
+	}
+
+	f, err := os.CreateTemp("", "pprof-adv-download-*.zip")
 	if err != nil {
 		return ProfileDownload{}, err
 	}
-	res, err := http.DefaultClient.Do(req)
+	file := &tempFile{f}
+	defer func() {
+		if err != nil {
+			file.Close()
+		}
+	}()
+
+	for attempt := 1; ; attempt++ {
+		done, err := c.downloadPart(ctx, path, p.ProfileID, f)
+		if done {
+			break
+		}
+		var status *downloadStatusError
+		if errors.As(err, &status) || ctx.Err() != nil || attempt == maxDownloadAttempts {
+			return ProfileDownload{}, err
+		}
+		select {
+		case <-ctx.Done():
+			return ProfileDownload{}, ctx.Err()
+		case <-time.After(time.Duration(attempt) * downloadRetryDelay):
+		}
+	}
+
+	size, err := f.Seek(0, io.SeekEnd)
 	if err != nil {
 		return ProfileDownload{}, err
 	}
+	return ProfileDownload{r: f, size: size, closer: file}, nil
+}
+
+// tempFile is a temporary file removed when closed.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	if rmErr := os.Remove(f.Name()); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// downloadStatusError is a download failing with an HTTP status, which is not
+// retried.
+type downloadStatusError struct {
+	profileID string
+	status    string
+}
+
+func (e *downloadStatusError) Error() string {
+	return fmt.Sprintf("profile %s: %s", e.profileID, e.status)
+}
+
+// downloadPart appends the part of the download at path that is not yet in f
+// to it, and reports whether the download is complete.
+func (c *Client) downloadPart(ctx context.Context, path, profileID string, f *os.File) (bool, error) {
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, err
+	}
+	req, err := c.request(ctx, "GET", path, nil)
+	if err != nil {
+		return false, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return false, err
+	}
 	defer res.Body.Close()
 
-	data, err := io.ReadAll(res.Body)
+	size := int64(-1)
+	switch {
+	case res.StatusCode == http.StatusPartialContent && offset > 0:
+		var start, end int64
+		if _, err := fmt.Sscanf(res.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size); err != nil || start != offset {
+			return false, fmt.Errorf("profile %s: unexpected content range %q resuming at %d", profileID, res.Header.Get("Content-Range"), offset)
+		}
+	case res.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The previous attempt received the whole body but failed after it
+		return true, nil
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		// The server sent the whole body, ignoring the range
+		if err := f.Truncate(0); err != nil {
+			return false, err
+		}
+		if offset, err = f.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		size = res.ContentLength
+	default:
+		return false, &downloadStatusError{profileID: profileID, status: res.Status}
+	}
+
+	var w io.Writer = f
+	if c.Progress != nil {
+		w = &progressWriter{w: f, received: offset, size: size, progress: c.Progress}
+	}
+	n, err := io.Copy(w, res.Body)
 	if err != nil {
-		return ProfileDownload{}, err
+		return false, err
+	}
+	if size >= 0 && offset+n < size {
+		return false, fmt.Errorf("profile %s: download ended after %d of %d bytes", profileID, offset+n, size)
+	}
+	if size < 0 && c.Progress != nil {
+		c.Progress(offset+n, offset+n)
 	}
-	return ProfileDownload{data: data}, nil
+	return true, nil
+}
+
+// progressWriter reports the bytes written through it to a Progress callback.
+type progressWriter struct {
+	w        io.Writer
+	received int64
+	size     int64
+	progress func(received, size int64)
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.received += int64(n)
+	w.progress(w.received, w.size)
+	return n, err
 }
 
 // request creates a new HTTP request with the given method and path and sets
 // the required headers.
 func (c *Client) request(ctx context.Context, method, path string, body []byte) (*http.Request, error) {
-	url := fmt.Sprintf("https://app.%s%s", c.site, path)
+	url := c.app + path
 
 	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "datadog-pgo/"+version)
+	req.Header.Set("User-Agent", version.UserAgent())
 	req.Header.Set("DD-APPLICATION-KEY", c.appKey)
 	req.Header.Set("DD-API-KEY", c.apiKey)
 	return req, nil
 }
 
+// do sends a request with the default HTTP client, calling the hooks of the
+// client around it, and throttles the read of the response to the bandwidth
+// of the client.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	var res *http.Response
+	var err error
+	if c.Hooks == nil {
+		res, err = http.DefaultClient.Do(req)
+	} else {
+		c.Hooks.OnRequest(req)
+		start := time.Now()
+		res, err = http.DefaultClient.Do(req)
+		c.Hooks.OnResponse(req, res, err, time.Since(start))
+	}
+	if err == nil && c.bandwidth != nil {
+		res.Body = &throttledBody{ReadCloser: res.Body, ctx: req.Context(), bandwidth: c.bandwidth}
+	}
+	return res, err
+}
+
 // post sends a POST request to the given path with the given payload and decodes
 // the response.
 func (c *Client) post(ctx context.Context, path string, payload any) ([]byte, error) {
+	return c.send(ctx, http.MethodPost, path, payload)
+}
+
+// put sends a PUT request to the given path with the given payload and returns
+// the response body.
+func (c *Client) put(ctx context.Context, path string, payload any) ([]byte, error) {
+	return c.send(ctx, http.MethodPut, path, payload)
+}
+
+// send sends a request with the given method to the given path with the given
+// payload encoded as JSON and returns the response body.
+func (c *Client) send(ctx context.Context, method, path string, payload any) ([]byte, error) {
 	reqBody, err := json.Marshal(payload)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := c.request(ctx, "POST", path, reqBody)
+	req, err := c.request(ctx, method, path, reqBody)
 	if err != nil {
 		return nil, err
 	}
-	res, err := http.DefaultClient.Do(req)
+	res, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -262,6 +543,28 @@ func (c *Client) post(ctx context.Context, path string, payload any) ([]byte, er
 	return resBody, nil
 }
 
+// get sends a GET request to the given path and returns the response body.
+func (c *Client) get(ctx context.Context, path string) ([]byte, error) {
+	req, err := c.request(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("(path:%s) %s", strings.SplitN(path, "?", 2)[0], res.Status)
+	}
+	return resBody, nil
+}
+
 // limitConcurrency blocks until a slot is available in the concurrency channel.
 // It returns a function that should be called to release the slot.
 func (c *Client) limitConcurrency() func() {
@@ -1,24 +1,37 @@
 package profiler
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
 
 func TestClient(t *testing.T) {
-	client, err := NewClient("xxxxxxxxxxxxxxxxxxx", "xxxxxxxxxxxxxxxx", "")
+	apiKey, appKey := os.Getenv("DD_API_KEY"), os.Getenv("DD_APP_KEY")
+	if apiKey == "" || appKey == "" {
+		t.Skip("DD_API_KEY and DD_APP_KEY are needed to download profiles from Datadog")
+	}
+	client, err := NewClient(apiKey, appKey, "")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	r, err := client.GetCPUProfile(t.Context(), "prod-server", "production", "go", 3*time.Hour, 5)
+	r, err := client.GetCPUProfile(context.Background(), "prod-server", "production", "go", 3*time.Hour, 5)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	f, err := os.Create("cpu.pprof")
+	f, err := os.Create(filepath.Join(t.TempDir(), "cpu.pprof"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -26,3 +39,237 @@ func TestClient(t *testing.T) {
 
 	io.Copy(f, r)
 }
+
+func TestSearchProfiles(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data": [{"id": "event-1", "attributes": {
+			"id": "profile-1",
+			"service": "api",
+			"duration_nanos": 60000000000,
+			"timestamp": "2025-01-01T12:00:00Z",
+			"host": "host-a",
+			"tags": ["version:1.2.3", "host:host-b", "runtime-id:abc", "profiler_version:v1.70.0"],
+			"custom": {"metrics": {"core_cpu_cores": 1.5}}
+		}}]}`)
+	}))
+	defer srv.Close()
+
+	client, err := NewClient("api-key", "app-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.app = srv.URL
+
+	profiles, err := client.SearchProfiles(context.Background(), SearchQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 1 {
+		t.Fatalf("Expected 1 profile, got %d", len(profiles))
+	}
+	want := "profile profile-1 service:api version:1.2.3 host:host-a runtime-id:abc profiler_version:v1.70.0 at 2025-01-01T12:00:00Z (1m0s, 1.50 cores)"
+	if got := profiles[0].String(); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestGetCPUProfileByID(t *testing.T) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	f, _ := zw.Create("cpu.pprof")
+	f.Write([]byte("cpu profile"))
+	zw.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/ui/profiling/profiles/profile-1/download" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("eventId") != "event-1" {
+			t.Errorf("Expected eventId event-1, got %q", r.URL.RawQuery)
+		}
+		w.Write(archive.Bytes())
+	}))
+	defer srv.Close()
+
+	client, err := NewClient("api-key", "app-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.app = srv.URL
+
+	r, err := client.GetCPUProfileByID(context.Background(), "profile-1", "event-1", "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(r); string(data) != "cpu profile" {
+		t.Errorf("Expected cpu.pprof of the download, got %q", data)
+	}
+
+	if _, err := client.GetCPUProfileByID(context.Background(), "missing", "", "go"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected 404 error, got %v", err)
+	}
+}
+
+func TestFetchCPUProfileByIDRuntime(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		files    map[string]string
+		language string
+		want     string
+	}{
+		{"event family", map[string]string{"event.json": `{"family":"java"}`, "main.jfr": "recording", "cpu.pprof": "cpu profile"}, "java", "recording"},
+		{"jfr only", map[string]string{"main.jfr": "recording"}, "java", "recording"},
+		{"python", map[string]string{"event.json": `{"family":"python"}`, "cpu.pprof": "cpu profile"}, "python", "cpu profile"},
+		{"unknown", map[string]string{"cpu.pprof": "cpu profile"}, "", "cpu profile"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var archive bytes.Buffer
+			zw := zip.NewWriter(&archive)
+			for name, content := range tc.files {
+				f, _ := zw.Create(name)
+				f.Write([]byte(content))
+			}
+			zw.Close()
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(archive.Bytes())
+			}))
+			defer srv.Close()
+
+			client, err := NewClient("api-key", "app-key", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.app = srv.URL
+
+			profile, r, err := client.FetchCPUProfileByID(context.Background(), "profile-1", "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if profile.Language != tc.language {
+				t.Errorf("Expected language %q, got %q", tc.language, profile.Language)
+			}
+			if data, _ := io.ReadAll(r); string(data) != tc.want {
+				t.Errorf("Expected %q, got %q", tc.want, data)
+			}
+		})
+	}
+}
+
+func TestDownloadProfileResume(t *testing.T) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	f, _ := zw.Create("cpu.pprof")
+	f.Write(bytes.Repeat([]byte("cpu profile "), 1000))
+	zw.Close()
+	data := archive.Bytes()
+
+	defer func(delay time.Duration) { downloadRetryDelay = delay }(downloadRetryDelay)
+	downloadRetryDelay = 0
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			// Fail midway through the body
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.Write(data[:len(data)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		want := fmt.Sprintf("bytes=%d-", len(data)/2)
+		if got := r.Header.Get("Range"); got != want {
+			t.Errorf("Expected range %q, got %q", want, got)
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", len(data)/2, len(data)-1, len(data)))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(data[len(data)/2:])
+	}))
+	defer srv.Close()
+
+	client, err := NewClient("api-key", "app-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.app = srv.URL
+	var received, size int64
+	client.Progress = func(r, s int64) { received, size = r, s }
+
+	download, err := client.DownloadProfile(context.Background(), &SearchProfile{ProfileID: "profile-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := download.Archive()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) || requests != 2 {
+		t.Errorf("Expected the download to be resumed once, got %d of %d bytes in %d requests", len(got), len(data), requests)
+	}
+	file := download.closer.(*tempFile).Name()
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("Expected closing the archive to remove %s, got %v", file, err)
+	}
+	if received != int64(len(data)) || size != int64(len(data)) {
+		t.Errorf("Expected progress of %d bytes, got %d of %d", len(data), received, size)
+	}
+}
+
+func TestParseProfileEvent(t *testing.T) {
+	e, err := ParseProfileEvent([]byte(`{
+		"attachments": ["cpu.pprof", "delta-heap.pprof"],
+		"tags_profiler": "service:api,env:prod,profiler_version:v1.60.0, host:web-1",
+		"start": "2025-01-01T12:00:00Z",
+		"end": "2025-01-01T12:01:00.5Z",
+		"family": "go",
+		"version": "4"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Family != "go" || e.Version != "4" || len(e.Attachments) != 2 || len(e.Tags) != 4 {
+		t.Errorf("Expected the go event of 2 attachments and 4 tags, got %+v", e)
+	}
+	if e.Tag("host") != "web-1" || e.Tag("profiler_version") != "v1.60.0" || e.Tag("version") != "" {
+		t.Errorf("Expected the host and profiler version tags, got %q", e.Tags)
+	}
+	if e.Duration() != 60500*time.Millisecond {
+		t.Errorf("Expected a duration of 1m0.5s, got %s", e.Duration())
+	}
+
+	if _, err := ParseProfileEvent([]byte(`{"start": "yesterday"}`)); err == nil {
+		t.Error("Expected an error for an invalid start")
+	}
+
+	profile := &SearchProfile{ProfileID: "p1", Version: "v2"}
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	f, _ := zw.Create("event.json")
+	f.Write([]byte(`{"tags_profiler":"service:api,version:v1,language:go","start":"2025-01-01T12:00:00Z","end":"2025-01-01T12:01:00Z","family":"go"}`))
+	zw.Close()
+	if err := (ProfileDownload{r: bytes.NewReader(archive.Bytes()), size: int64(archive.Len())}).describe(profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.Service != "api" || profile.Version != "v2" || profile.Language != "go" || profile.Duration != time.Minute || !profile.Timestamp.Equal(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the unset fields described by the event, got %+v", profile)
+	}
+}
+
+func TestParseMetrics(t *testing.T) {
+	for _, data := range []string{
+		`[["go_gcs_per_sec", 2], ["cgroup_nr_throttled", 12], ["note", "text"]]`,
+		`{"go_gcs_per_sec": 2, "cgroup_nr_throttled": 12}`,
+	} {
+		metrics, err := ParseMetrics([]byte(data))
+		if err != nil || len(metrics) != 2 || metrics["cgroup_nr_throttled"] != 12 {
+			t.Errorf("ParseMetrics(%s): expected 2 metrics, got %v: %v", data, metrics, err)
+		}
+	}
+	if _, err := ParseMetrics([]byte(`"metrics"`)); err == nil {
+		t.Error("Expected error for a string, got nil")
+	}
+}
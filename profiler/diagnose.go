@@ -0,0 +1,120 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// retention is how far back profiles are searched when diagnosing an empty
+// search, profiles are kept for about a week.
+const retention = 7 * 24 * time.Hour
+
+// diagnoseLimit is the number of profiles searched to find the environments of
+// a service.
+const diagnoseLimit = 100
+
+// validateTags returns an error if the service or environment cannot be used
+// as tag values of a search query.
+func validateTags(service, environment string) error {
+	for _, tag := range []struct{ key, value string }{{"service", service}, {"env", environment}} {
+		switch {
+		case tag.value == "":
+			return fmt.Errorf("%s is required to search profiles", tag.key)
+		case strings.ContainsAny(tag.value, " \t\n\"'()"):
+			return fmt.Errorf("invalid %s %q: tag values cannot contain spaces, quotes or parentheses", tag.key, tag.value)
+		}
+	}
+	return nil
+}
+
+// diagnose finds out why a search of the service in the environment within the
+// window found no profiles, by relaxing its filters one at a time, and returns
+// an ErrNoProfiles error telling which constraint eliminated them.
+func (c *Client) diagnose(ctx context.Context, service, environment string, window time.Duration) error {
+	search := fmt.Sprintf("service:%s env:%s in the last %s", service, environment, window)
+	noProfiles := func(format string, args ...any) error {
+		return fmt.Errorf("%w for %s: %s", ErrNoProfiles, search, fmt.Sprintf(format, args...))
+	}
+
+	// Drop the environment.
+	envs, err := c.environments(ctx, service, window)
+	if err != nil {
+		return noProfiles("%s", err)
+	}
+	if len(envs) > 0 {
+		return noProfiles("the service has profiles in %s, check --environment", strings.Join(envs, ", "))
+	}
+
+	// Widen the window.
+	latest, err := c.latest(ctx, fmt.Sprintf("service:%s env:%s", service, environment))
+	if err != nil {
+		return noProfiles("%s", err)
+	}
+	if latest != nil {
+		return noProfiles("the latest profile was uploaded at %s, %s ago, is the service still running?", latest.Timestamp.UTC().Format(time.RFC3339), time.Since(latest.Timestamp).Round(time.Minute))
+	}
+
+	// Drop both.
+	envs, err = c.environments(ctx, service, retention)
+	if err != nil {
+		return noProfiles("%s", err)
+	}
+	if len(envs) > 0 {
+		return noProfiles("the service only has profiles in %s in the last %s, check --environment", strings.Join(envs, ", "), retention)
+	}
+	return noProfiles("the service has no profiles at all in the last %s, check the --apm name, which is case sensitive, and that DD_SITE is %s", retention, c.site)
+}
+
+// environments returns the env tags of the profiles of the service within the
+// window, sorted.
+func (c *Client) environments(ctx context.Context, service string, window time.Duration) ([]string, error) {
+	profiles, err := c.SearchProfiles(ctx, SearchQuery{
+		Filter: SearchFilter{
+			From:  JSONTime{time.Now().Add(-window)},
+			To:    JSONTime{time.Now()},
+			Query: "service:" + service,
+		},
+		Sort:  SearchSort{Order: "desc", Field: "timestamp"},
+		Limit: diagnoseLimit,
+	})
+	if errors.Is(err, ErrNoProfiles) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var envs []string
+	for _, p := range profiles {
+		if env := "env:" + p.Env; p.Env != "" && !seen[env] {
+			seen[env] = true
+			envs = append(envs, env)
+		}
+	}
+	sort.Strings(envs)
+	return envs, nil
+}
+
+// latest returns the most recent profile matching the query within the
+// retention, or nil if there is none.
+func (c *Client) latest(ctx context.Context, query string) (*SearchProfile, error) {
+	profiles, err := c.SearchProfiles(ctx, SearchQuery{
+		Filter: SearchFilter{
+			From:  JSONTime{time.Now().Add(-retention)},
+			To:    JSONTime{time.Now()},
+			Query: query,
+		},
+		Sort:  SearchSort{Order: "desc", Field: "timestamp"},
+		Limit: 1,
+	})
+	if errors.Is(err, ErrNoProfiles) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return profiles[0], nil
+}
@@ -0,0 +1,86 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiagnose(t *testing.T) {
+	recent := time.Now().Add(-10 * time.Minute).UTC().Format(timeFormat)
+	old := time.Now().Add(-50 * time.Hour).UTC().Format(timeFormat)
+
+	tests := []struct {
+		name     string
+		profiles map[string][]string // profiles by query, given as env and timestamp
+		want     string
+	}{
+		{
+			name:     "other env",
+			profiles: map[string][]string{"service:api": {"staging", recent, "canary", recent}},
+			want:     "the service has profiles in env:canary, env:staging",
+		},
+		{
+			name:     "old profiles",
+			profiles: map[string][]string{"service:api env:prod": {"prod", old}},
+			want:     "the latest profile was uploaded at " + old[:19],
+		},
+		{
+			name:     "nothing",
+			profiles: map[string][]string{},
+			want:     "the service has no profiles at all",
+		},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var query SearchQuery
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &query)
+
+			var data []map[string]any
+			profiles := tt.profiles[query.Filter.Query]
+			for i := 0; i < len(profiles); i += 2 {
+				timestamp, _ := time.Parse(timeFormat, profiles[i+1])
+				if timestamp.Before(query.Filter.From.Time) {
+					continue
+				}
+				data = append(data, map[string]any{"id": "event", "attributes": map[string]any{
+					"id":        "profile",
+					"service":   "api",
+					"timestamp": profiles[i+1],
+					"tags":      []string{"env:" + profiles[i]},
+				}})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"data": data})
+		}))
+
+		client, err := NewClient("api-key", "app-key", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.app = srv.URL
+
+		_, _, err = client.FetchCPUProfile(context.Background(), "api", "prod", "go", time.Hour, 1)
+		if !errors.Is(err, ErrNoProfiles) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Expected ErrNoProfiles saying %q, got %v", tt.name, tt.want, err)
+		}
+		srv.Close()
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	if err := validateTags("api", "prod"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	for _, tags := range [][2]string{{"", "prod"}, {"my api", "prod"}, {"api", `prod"`}} {
+		if err := validateTags(tags[0], tags[1]); err == nil {
+			t.Errorf("Expected error for service %q env %q", tags[0], tags[1])
+		}
+	}
+}
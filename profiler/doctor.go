@@ -0,0 +1,171 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// Sites are the Datadog sites, see
+// https://docs.datadoghq.com/getting_started/site/.
+var Sites = []string{
+	"datadoghq.com",
+	"us3.datadoghq.com",
+	"us5.datadoghq.com",
+	"datadoghq.eu",
+	"ap1.datadoghq.com",
+	"ap2.datadoghq.com",
+	"ddog-gov.com",
+}
+
+// ProfileScopes are the scopes a scoped application key needs to search and
+// download profiles and to download pgo profiles.
+var ProfileScopes = []string{"apm_read", "continuous_profiler_pgo_read"}
+
+// appURL returns the base url of the api of a site, tests replace it.
+var appURL = func(site string) string {
+	return "https://app." + site
+}
+
+// ValidateAPIKey reports whether the API key of the client is valid on its
+// site.
+func (c *Client) ValidateAPIKey(ctx context.Context) (valid bool, err error) {
+	defer wrapErr(&err, "validate api key")
+	defer c.limitConcurrency()()
+
+	req, err := c.request(ctx, http.MethodGet, "/api/v1/validate", nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Del("DD-APPLICATION-KEY")
+	res, err := c.do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		var response struct {
+			Valid bool `json:"valid"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+			return false, err
+		}
+		return response.Valid, nil
+	case http.StatusForbidden, http.StatusUnauthorized:
+		return false, nil
+	default:
+		return false, fmt.Errorf("%s", res.Status)
+	}
+}
+
+// DetectSites returns the sites, in the order of Sites, on which the API key
+// is valid. API keys belong to a single site, so there is at most one unless
+// the key is checked against a test server. Sites that cannot be reached are
+// reported as errors only if the key is valid on none of them.
+func DetectSites(ctx context.Context, apiKey string) ([]string, error) {
+	var (
+		wg    sync.WaitGroup
+		valid = make([]bool, len(Sites))
+		errs  = make([]error, len(Sites))
+	)
+	for i, site := range Sites {
+		client, err := NewIntakeClient(apiKey, site)
+		if err != nil {
+			return nil, err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			valid[i], errs[i] = client.ValidateAPIKey(ctx)
+		}()
+	}
+	wg.Wait()
+
+	var sites []string
+	for i, site := range Sites {
+		if valid[i] {
+			sites = append(sites, site)
+		}
+	}
+	if len(sites) == 0 {
+		for i, err := range errs {
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", Sites[i], err)
+			}
+		}
+	}
+	return sites, nil
+}
+
+// ApplicationKey describes an application key of the current user.
+type ApplicationKey struct {
+	Name   string
+	Scopes []string // nil if the key is not scoped, which grants all permissions of the user
+}
+
+// MissingScopes returns the ProfileScopes the key lacks.
+func (k *ApplicationKey) MissingScopes() []string {
+	if k.Scopes == nil {
+		return nil
+	}
+	var missing []string
+	for _, scope := range ProfileScopes {
+		if !slices.Contains(k.Scopes, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// ApplicationKey returns the application key of the client, found among the
+// keys of the current user by its last 4 characters, or nil if it is not one
+// of them, e.g. because it is a service account key.
+func (c *Client) ApplicationKey(ctx context.Context) (key *ApplicationKey, err error) {
+	defer wrapErr(&err, "get application key")
+	defer c.limitConcurrency()()
+
+	req, err := c.request(ctx, http.MethodGet, "/api/v2/current_user/application_keys?page%5Bsize%5D=100", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: the application key is invalid or lacks the scope to read itself", res.Status)
+	}
+
+	var response struct {
+		Data []struct {
+			Attributes struct {
+				Name   string   `json:"name"`
+				Last4  string   `json:"last4"`
+				Scopes []string `json:"scopes"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	if len(c.appKey) < 4 {
+		return nil, nil
+	}
+	for _, item := range response.Data {
+		if item.Attributes.Last4 == c.appKey[len(c.appKey)-4:] {
+			return &ApplicationKey{Name: item.Attributes.Name, Scopes: item.Attributes.Scopes}, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,81 @@
+package profiler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetectSites(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/datadoghq.eu/api/v1/validate" && r.Header.Get("DD-API-KEY") == "eu-key" {
+			io.WriteString(w, `{"valid": true}`)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"errors": ["Forbidden"]}`)
+	}))
+	defer srv.Close()
+	defer func(old func(string) string) { appURL = old }(appURL)
+	appURL = func(site string) string { return srv.URL + "/" + site }
+
+	sites, err := DetectSites(context.Background(), "eu-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sites, []string{"datadoghq.eu"}) {
+		t.Errorf("Expected sites [datadoghq.eu], got %v", sites)
+	}
+
+	if sites, err := DetectSites(context.Background(), "invalid"); err != nil || len(sites) != 0 {
+		t.Errorf("Expected no sites, got %v: %v", sites, err)
+	}
+}
+
+func TestApplicationKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/v2/current_user/application_keys") {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, `{"data": [
+			{"attributes": {"name": "ci", "last4": "abcd", "scopes": ["apm_read"]}},
+			{"attributes": {"name": "laptop", "last4": "wxyz", "scopes": null}}
+		]}`)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		appKey  string
+		name    string
+		missing []string
+	}{
+		{"0000abcd", "ci", []string{"continuous_profiler_pgo_read"}},
+		{"0000wxyz", "laptop", nil},
+	}
+	for _, tt := range tests {
+		client, err := NewClient("api-key", tt.appKey, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.app = srv.URL
+
+		key, err := client.ApplicationKey(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key == nil || key.Name != tt.name || !reflect.DeepEqual(key.MissingScopes(), tt.missing) {
+			t.Errorf("Expected key %s missing %v, got %+v", tt.name, tt.missing, key)
+		}
+	}
+
+	client, _ := NewClient("api-key", "00001234", "")
+	client.app = srv.URL
+	if key, err := client.ApplicationKey(context.Background()); err != nil || key != nil {
+		t.Errorf("Expected no key, got %+v: %v", key, err)
+	}
+}
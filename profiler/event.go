@@ -0,0 +1,85 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a Datadog event, see
+// https://docs.datadoghq.com/api/latest/events/#post-an-event.
+type Event struct {
+	Title          string   `json:"title"`
+	Text           string   `json:"text"`
+	Tags           []string `json:"tags,omitempty"`
+	AlertType      string   `json:"alert_type,omitempty"` // error, warning, info or success
+	SourceTypeName string   `json:"source_type_name,omitempty"`
+	DateHappened   int64    `json:"date_happened,omitempty"` // unix seconds
+}
+
+// Time returns the time the event happened.
+func (e *Event) Time() time.Time {
+	return time.Unix(e.DateHappened, 0)
+}
+
+// IsDeploy reports whether the event marks a deploy, which is told by a
+// deployment tag, its source or its title.
+func (e *Event) IsDeploy() bool {
+	for _, tag := range e.Tags {
+		if strings.HasPrefix(tag, "deployment:") || tag == "deployment" {
+			return true
+		}
+	}
+	return strings.Contains(strings.ToLower(e.SourceTypeName), "deploy") ||
+		strings.Contains(strings.ToLower(e.Title), "deploy")
+}
+
+// PostEvent posts the event to the event stream of the account.
+func (c *Client) PostEvent(ctx context.Context, event *Event) (err error) {
+	defer wrapErr(&err, "post event")
+	defer c.limitConcurrency()()
+	_, err = c.post(ctx, "/api/v1/events", event)
+	return err
+}
+
+// DeployEvents returns the deploy events of the service between from and to,
+// most recent first, see
+// https://docs.datadoghq.com/api/latest/events/#get-a-list-of-events.
+func (c *Client) DeployEvents(ctx context.Context, service, environment string, from, to time.Time) (_ []*Event, err error) {
+	defer wrapErr(&err, "deploy events")
+	if err := validateTags(service, environment); err != nil {
+		return nil, err
+	}
+	defer c.limitConcurrency()()
+
+	values := url.Values{
+		"start": {strconv.FormatInt(from.Unix(), 10)},
+		"end":   {strconv.FormatInt(to.Unix(), 10)},
+		"tags":  {"service:" + service + ",env:" + environment},
+	}
+	data, err := c.get(ctx, "/api/v1/events?"+values.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Events []*Event `json:"events"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	var deploys []*Event
+	for _, event := range response.Events {
+		if event.IsDeploy() {
+			deploys = append(deploys, event)
+		}
+	}
+	sort.SliceStable(deploys, func(i, j int) bool {
+		return deploys[i].DateHappened > deploys[j].DateHappened
+	})
+	return deploys, nil
+}
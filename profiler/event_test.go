@@ -0,0 +1,65 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPostEvent(t *testing.T) {
+	var got Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/events" || r.Header.Get("DD-API-KEY") != "api-key" {
+			t.Errorf("Expected event posted to /api/v1/events with the api key, got %s", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	client, err := NewClient("api-key", "app-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.app = srv.URL
+
+	if err := client.PostEvent(context.Background(), &Event{Title: "deploy", Text: "text", AlertType: "info"}); err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "deploy" || got.AlertType != "info" {
+		t.Errorf("Expected event deploy, got %+v", got)
+	}
+}
+
+func TestDeployEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/events" || r.URL.Query().Get("tags") != "service:api,env:prod" {
+			t.Errorf("Expected events of service:api,env:prod, got %s", r.URL)
+		}
+		w.Write([]byte(`{"events": [
+			{"title": "Deployed api v1", "date_happened": 100},
+			{"title": "High latency", "date_happened": 150},
+			{"title": "api rollout", "tags": ["deployment:v2"], "date_happened": 200}
+		]}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient("api-key", "app-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.app = srv.URL
+
+	deploys, err := client.DeployEvents(context.Background(), "api", "prod", time.Unix(0, 0), time.Unix(300, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deploys) != 2 || deploys[0].Title != "api rollout" || !deploys[1].Time().Equal(time.Unix(100, 0)) {
+		t.Errorf("Expected the rollout and the v1 deploy, got %+v", deploys)
+	}
+}
@@ -0,0 +1,61 @@
+package profiler
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Hooks observe the requests of a Client to Datadog, e.g. to record the
+// latency and error rate of the calls in the telemetry of an embedding
+// application. Their methods may be called concurrently.
+type Hooks interface {
+	// OnRequest is called before a request is sent.
+	OnRequest(req *http.Request)
+	// OnResponse is called once the response headers of a request are
+	// received, or with the error it failed with and a nil response, along
+	// with its latency since OnRequest.
+	OnResponse(req *http.Request, res *http.Response, err error, latency time.Duration)
+}
+
+// RequestMetrics describe a completed request for MetricsHooks.
+type RequestMetrics struct {
+	Method string
+	// Endpoint is the path of the request with the ids of profiles replaced
+	// by :id, e.g. /api/ui/profiling/profiles/:id/download, so that it can
+	// tag metrics.
+	Endpoint string
+	Status   int   // status code of the response, 0 if the request failed
+	Err      error // error the request failed with, nil for any response
+	Latency  time.Duration
+}
+
+// MetricsHooks returns Hooks calling record with the RequestMetrics of every
+// completed request.
+func MetricsHooks(record func(RequestMetrics)) Hooks {
+	return metricsHooks(record)
+}
+
+type metricsHooks func(RequestMetrics)
+
+func (metricsHooks) OnRequest(*http.Request) {}
+
+func (h metricsHooks) OnResponse(req *http.Request, res *http.Response, err error, latency time.Duration) {
+	m := RequestMetrics{Method: req.Method, Endpoint: endpoint(req.URL.Path), Err: err, Latency: latency}
+	if res != nil {
+		m.Status = res.StatusCode
+	}
+	h(m)
+}
+
+// endpoint returns the path of a request with the id of a profile replaced by
+// :id.
+func endpoint(path string) string {
+	const profiles = "/api/ui/profiling/profiles/"
+	if rest, ok := strings.CutPrefix(path, profiles); ok {
+		if _, action, ok := strings.Cut(rest, "/"); ok {
+			return profiles + ":id/" + action
+		}
+	}
+	return path
+}
@@ -0,0 +1,47 @@
+package profiler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestMetricsHooks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	client, err := NewClient("api-key", "app-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.app = srv.URL
+	var mu sync.Mutex
+	var got []RequestMetrics
+	client.Hooks = MetricsHooks(func(m RequestMetrics) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, m)
+	})
+
+	if _, err := client.DownloadProfile(context.Background(), &SearchProfile{ProfileID: "profile-1", EventID: "event-1"}); err == nil {
+		t.Fatal("Expected 404 error, got nil")
+	}
+	srv.Close()
+	if _, err := client.SearchProfiles(context.Background(), SearchQuery{}); err == nil {
+		t.Fatal("Expected error of the closed server, got nil")
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("Expected metrics of 2 requests, got %+v", got)
+	}
+	if m := got[0]; m.Method != "GET" || m.Endpoint != "/api/ui/profiling/profiles/:id/download" || m.Status != http.StatusNotFound || m.Err != nil || m.Latency <= 0 {
+		t.Errorf("Expected a 404 of the download endpoint, got %+v", m)
+	}
+	if m := got[1]; m.Method != "POST" || m.Endpoint != "/api/unstable/profiles/list" || m.Status != 0 || m.Err == nil {
+		t.Errorf("Expected a failed search, got %+v", m)
+	}
+}
@@ -0,0 +1,150 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/version"
+)
+
+// intakePath is the path of the profiling intake, relative to the intake host
+// of the site.
+const intakePath = "/api/v2/profile"
+
+// Upload is a set of profiles covering the same period, uploaded to the
+// profiling intake as one event, like the Datadog profilers do.
+type Upload struct {
+	Start, End time.Time
+	Family     string            // runtime of the profiles, e.g. go, java or python
+	Tags       map[string]string // e.g. service, env and version
+	Files      map[string][]byte // profiles by attachment name, e.g. cpu.pprof or delta-heap.pprof
+}
+
+// NewIntakeClient creates a client that only uploads profiles, which does not
+// require an application key.
+func NewIntakeClient(apiKey, site string) (*Client, error) {
+	if apiKey == "" {
+		return nil, errors.New("DataDog API key is required")
+	}
+	if site == "" {
+		site = "datadoghq.com"
+	}
+	return &Client{
+		apiKey:      apiKey,
+		site:        site,
+		app:         appURL(site),
+		intake:      "https://intake.profile." + site,
+		concurrency: make(chan struct{}, maxConcurrency),
+	}, nil
+}
+
+// Upload sends the profiles to the profiling intake as a multipart form with
+// an event.json describing them, the format of the Datadog profilers.
+func (c *Client) Upload(ctx context.Context, u *Upload) (err error) {
+	defer wrapErr(&err, "upload profile")
+	defer c.limitConcurrency()()
+
+	body, contentType, err := u.encode()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.intake+intakePath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", version.UserAgent())
+	req.Header.Set("DD-API-KEY", c.apiKey)
+	req.Header.Set("DD-EVP-ORIGIN", "pprof-adv")
+	req.Header.Set("DD-EVP-ORIGIN-VERSION", version.Get().Version)
+
+	res, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("%s: please check that your DD_API_KEY and DD_SITE env vars are set correctly", res.Status)
+	}
+	return nil
+}
+
+// event is the event.json of an upload.
+type event struct {
+	Attachments []string `json:"attachments"`
+	Start       string   `json:"start"`
+	End         string   `json:"end"`
+	Family      string   `json:"family"`
+	Version     string   `json:"version"`
+	Tags        string   `json:"tags_profiler"`
+}
+
+// encode returns the multipart body of the upload and its content type.
+func (u *Upload) encode() ([]byte, string, error) {
+	if len(u.Files) == 0 {
+		return nil, "", errors.New("no profiles to upload")
+	}
+
+	names := make([]string, 0, len(u.Files))
+	for name := range u.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	keys := make([]string, 0, len(u.Tags))
+	for key := range u.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	tags := make([]string, len(keys))
+	for i, key := range keys {
+		tags[i] = key + ":" + u.Tags[key]
+	}
+
+	meta, err := json.Marshal(event{
+		Attachments: names,
+		Start:       u.Start.UTC().Format(time.RFC3339Nano),
+		End:         u.End.UTC().Format(time.RFC3339Nano),
+		Family:      u.Family,
+		Version:     "4",
+		Tags:        strings.Join(tags, ","),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="event"; filename="event.json"`)
+	header.Set("Content-Type", "application/json")
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return nil, "", err
+	}
+	part.Write(meta)
+
+	for _, name := range names {
+		part, err := mw.CreateFormFile(name, name)
+		if err != nil {
+			return nil, "", err
+		}
+		part.Write(u.Files[name])
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return body.Bytes(), mw.FormDataContentType(), nil
+}
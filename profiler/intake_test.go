@@ -0,0 +1,98 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUpload(t *testing.T) {
+	var (
+		apiKey string
+		ev     event
+		files  = make(map[string]string)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != intakePath {
+			t.Errorf("Expected path %s, got %s", intakePath, r.URL.Path)
+		}
+		apiKey = r.Header.Get("DD-API-KEY")
+		mr, err := r.MultipartReader()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Error(err)
+				return
+			}
+			data, _ := io.ReadAll(part)
+			if part.FileName() == "event.json" {
+				if err := json.Unmarshal(data, &ev); err != nil {
+					t.Error(err)
+				}
+			} else {
+				files[part.FileName()] = string(data)
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	client, err := NewIntakeClient("api-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.intake = srv.URL
+
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	err = client.Upload(context.Background(), &Upload{
+		Start:  start,
+		End:    start.Add(time.Minute),
+		Family: "go",
+		Tags:   map[string]string{"service": "api", "env": "prod"},
+		Files:  map[string][]byte{"cpu.pprof": []byte("cpu"), "delta-heap.pprof": []byte("heap")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if apiKey != "api-key" {
+		t.Errorf("Expected api key api-key, got %q", apiKey)
+	}
+	want := event{
+		Attachments: []string{"cpu.pprof", "delta-heap.pprof"},
+		Start:       "2025-01-01T12:00:00Z",
+		End:         "2025-01-01T12:01:00Z",
+		Family:      "go",
+		Version:     "4",
+		Tags:        "env:prod,service:api",
+	}
+	if got, _ := json.Marshal(ev); string(got) != mustJSON(t, want) {
+		t.Errorf("Expected event %s, got %s", mustJSON(t, want), got)
+	}
+	if files["cpu.pprof"] != "cpu" || files["delta-heap.pprof"] != "heap" {
+		t.Errorf("Expected cpu.pprof and delta-heap.pprof attachments, got %v", files)
+	}
+
+	if err := client.Upload(context.Background(), &Upload{}); err == nil {
+		t.Error("Expected error uploading no profiles")
+	}
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,81 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// SetLimits sets the number of concurrent requests of the client, which
+// defaults to 5, and the bytes per second all its responses are read at in
+// total, 0 for no limit, e.g. to download many profiles from CI without
+// saturating the runner. It must be called before the client is used.
+func (c *Client) SetLimits(concurrency int, bytesPerSecond int64) error {
+	if concurrency < 1 {
+		return errors.New("concurrency must be at least 1")
+	}
+	if bytesPerSecond < 0 {
+		return errors.New("negative bandwidth limit")
+	}
+	c.concurrency = make(chan struct{}, concurrency)
+	c.bandwidth = nil
+	if bytesPerSecond > 0 {
+		c.bandwidth = &bandwidth{rate: float64(bytesPerSecond)}
+	}
+	return nil
+}
+
+// bandwidth paces the reads of the responses of a client to a rate.
+type bandwidth struct {
+	rate float64 // bytes per second
+
+	mu   sync.Mutex
+	next time.Time // when the bytes read so far are paid for at the rate
+}
+
+// wait blocks until n more bytes can be read at the rate.
+func (b *bandwidth) wait(ctx context.Context, n int) error {
+	b.mu.Lock()
+	now := time.Now()
+	if b.next.Before(now) {
+		b.next = now
+	}
+	b.next = b.next.Add(time.Duration(float64(n) / b.rate * float64(time.Second)))
+	delay := b.next.Sub(now)
+	b.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// maxThrottledRead is the most bytes a throttled body reads at once, so that
+// reads are paced smoothly rather than in large bursts.
+const maxThrottledRead = 16 << 10
+
+// throttledBody is a response body read at the rate of a bandwidth.
+type throttledBody struct {
+	io.ReadCloser
+	ctx       context.Context
+	bandwidth *bandwidth
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if len(p) > maxThrottledRead {
+		p = p[:maxThrottledRead]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if werr := b.bandwidth.wait(b.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,46 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetLimits(t *testing.T) {
+	body := bytes.Repeat([]byte("x"), 32<<10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	client, err := NewClient("api-key", "app-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.app = srv.URL
+	if err := client.SetLimits(0, 0); err == nil {
+		t.Error("Expected error for no concurrency, got nil")
+	}
+	if err := client.SetLimits(1, 128<<10); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	data, err := client.get(context.Background(), "/api/v1/query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, body) {
+		t.Errorf("Expected the body of %d bytes, got %d", len(body), len(data))
+	}
+	// 32KiB at 128KiB/s take 250ms
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected the body to be read in at least 200ms, got %s", elapsed)
+	}
+	if cap(client.concurrency) != 1 {
+		t.Errorf("Expected a concurrency of 1, got %d", cap(client.concurrency))
+	}
+}
@@ -0,0 +1,158 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+)
+
+// Monitor is a Datadog monitor, see
+// https://docs.datadoghq.com/api/latest/monitors/.
+type Monitor struct {
+	ID      int64          `json:"id,omitempty"`
+	Name    string         `json:"name"`
+	Type    string         `json:"type"` // e.g. "query alert"
+	Query   string         `json:"query"`
+	Message string         `json:"message"`
+	Tags    []string       `json:"tags"`
+	Options MonitorOptions `json:"options"`
+}
+
+// MonitorOptions are the options of a monitor that pprof-adv sets.
+type MonitorOptions struct {
+	Thresholds MonitorThresholds `json:"thresholds"`
+}
+
+// MonitorThresholds are the values a monitor alerts at, the critical one being
+// the one of its query.
+type MonitorThresholds struct {
+	Critical float64 `json:"critical"`
+}
+
+// Monitors returns the monitors with the tag, or all the monitors of the
+// account if the tag is empty.
+func (c *Client) Monitors(ctx context.Context, tag string) (_ []*Monitor, err error) {
+	defer wrapErr(&err, "monitors")
+	values := url.Values{}
+	if tag != "" {
+		values.Set("monitor_tags", tag)
+	}
+	return c.monitors(ctx, values)
+}
+
+// monitors returns the monitors matching the filters of the values.
+func (c *Client) monitors(ctx context.Context, values url.Values) ([]*Monitor, error) {
+	defer c.limitConcurrency()()
+	data, err := c.get(ctx, "/api/v1/monitor?"+values.Encode())
+	if err != nil {
+		return nil, err
+	}
+	var monitors []*Monitor
+	if err := json.Unmarshal(data, &monitors); err != nil {
+		return nil, err
+	}
+	return monitors, nil
+}
+
+// CreateMonitor creates the monitor and sets its ID.
+func (c *Client) CreateMonitor(ctx context.Context, m *Monitor) (err error) {
+	defer wrapErr(&err, "create monitor")
+	defer c.limitConcurrency()()
+	data, err := c.post(ctx, "/api/v1/monitor", m)
+	if err != nil {
+		return err
+	}
+	var created Monitor
+	if err := json.Unmarshal(data, &created); err != nil {
+		return err
+	}
+	m.ID = created.ID
+	return nil
+}
+
+// UpdateMonitor replaces the monitor of the ID of m with m.
+func (c *Client) UpdateMonitor(ctx context.Context, m *Monitor) (err error) {
+	defer wrapErr(&err, "update monitor")
+	defer c.limitConcurrency()()
+	_, err = c.put(ctx, fmt.Sprintf("/api/v1/monitor/%d", m.ID), m)
+	return err
+}
+
+// MonitorChange is what SyncMonitors did, or would do, to a monitor.
+type MonitorChange struct {
+	Monitor *Monitor
+	Action  string // "create", "update" or "unchanged"
+}
+
+// SyncMonitors creates the monitors that do not exist and updates the ones
+// that differ, so that running it again changes nothing. A monitor exists if
+// one with the tag, or without it, has the same name, so that monitors
+// created by hand are adopted rather than duplicated. Every monitor must carry
+// the tag. With dryRun, the changes are returned without being made. On error,
+// the changes made so far are returned.
+func (c *Client) SyncMonitors(ctx context.Context, monitors []*Monitor, tag string, dryRun bool) (changes []MonitorChange, err error) {
+	defer wrapErr(&err, "sync monitors")
+	tagged, err := c.monitors(ctx, url.Values{"monitor_tags": {tag}})
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*Monitor, len(tagged))
+	for _, m := range tagged {
+		byName[m.Name] = m
+	}
+
+	for _, m := range monitors {
+		if !slices.Contains(m.Tags, tag) {
+			return nil, fmt.Errorf("monitor %q is not tagged %s", m.Name, tag)
+		}
+		existing := byName[m.Name]
+		if existing == nil {
+			named, err := c.monitors(ctx, url.Values{"name": {m.Name}})
+			if err != nil {
+				return nil, err
+			}
+			// The name filter matches substrings
+			for _, n := range named {
+				if n.Name == m.Name {
+					existing = n
+					break
+				}
+			}
+		}
+
+		change := MonitorChange{Monitor: m, Action: "create"}
+		if existing != nil {
+			m.ID = existing.ID
+			change.Action = "update"
+			if sameMonitor(existing, m) {
+				change.Action = "unchanged"
+			}
+		}
+		switch {
+		case dryRun:
+		case change.Action == "create":
+			err = c.CreateMonitor(ctx, m)
+		case change.Action == "update":
+			err = c.UpdateMonitor(ctx, m)
+		}
+		if err != nil {
+			return changes, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// sameMonitor reports whether the monitors have the same fields pprof-adv
+// sets, tags in any order.
+func sameMonitor(a, b *Monitor) bool {
+	if a.Name != b.Name || a.Type != b.Type || a.Query != b.Query || a.Message != b.Message || a.Options != b.Options {
+		return false
+	}
+	tagsA, tagsB := slices.Clone(a.Tags), slices.Clone(b.Tags)
+	slices.Sort(tagsA)
+	slices.Sort(tagsB)
+	return slices.Equal(tagsA, tagsB)
+}
@@ -0,0 +1,183 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeMonitors is a Datadog monitor API keeping its monitors in memory.
+type fakeMonitors struct {
+	mu       sync.Mutex
+	monitors map[int64]*Monitor
+	nextID   int64
+	writes   []string // "POST" or "PUT <id>" of every write
+}
+
+func (f *fakeMonitors) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/monitor":
+		tag, name := r.URL.Query().Get("monitor_tags"), r.URL.Query().Get("name")
+		matches := []*Monitor{}
+		for id := int64(1); id <= f.nextID; id++ {
+			m := f.monitors[id]
+			if m != nil && (tag == "" || slices.Contains(m.Tags, tag)) && strings.Contains(m.Name, name) {
+				matches = append(matches, m)
+			}
+		}
+		json.NewEncoder(w).Encode(matches)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/monitor":
+		var m Monitor
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.nextID++
+		m.ID = f.nextID
+		f.monitors[m.ID] = &m
+		f.writes = append(f.writes, "POST")
+		json.NewEncoder(w).Encode(&m)
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/api/v1/monitor/"):
+		id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/v1/monitor/"), 10, 64)
+		if f.monitors[id] == nil {
+			http.NotFound(w, r)
+			return
+		}
+		var m Monitor
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m.ID = id
+		f.monitors[id] = &m
+		f.writes = append(f.writes, "PUT "+strconv.FormatInt(id, 10))
+		json.NewEncoder(w).Encode(&m)
+	default:
+		http.Error(w, "unexpected "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+	}
+}
+
+func budgetMonitor(name, query string, critical float64) *Monitor {
+	return &Monitor{
+		Name:    name,
+		Type:    "query alert",
+		Query:   query,
+		Message: name + " is over budget",
+		Tags:    []string{"managed-by:test", "service:api"},
+		Options: MonitorOptions{Thresholds: MonitorThresholds{Critical: critical}},
+	}
+}
+
+func TestSyncMonitors(t *testing.T) {
+	// A monitor created by hand before the budgets were synced, without the
+	// tag, and one of another tool.
+	fake := &fakeMonitors{monitors: map[int64]*Monitor{
+		1: {ID: 1, Name: "json budget", Type: "query alert", Query: "old", Tags: []string{"team:perf"}},
+		2: {ID: 2, Name: "json budget of another service", Type: "metric alert", Query: "other"},
+	}, nextID: 2}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	client, err := NewClient("api-key", "app-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.app = srv.URL
+
+	desired := func(jsonMax float64) []*Monitor {
+		return []*Monitor{
+			budgetMonitor("json budget", "avg(last_60m):sum:cores{function:json} > 0.5", jsonMax),
+			budgetMonitor("flate budget", "avg(last_60m):sum:cores{function:flate} > 0.2", 0.2),
+		}
+	}
+	actions := func(changes []MonitorChange) []string {
+		var out []string
+		for _, c := range changes {
+			out = append(out, c.Monitor.Name+": "+c.Action)
+		}
+		return out
+	}
+
+	// Dry run changes nothing
+	changes, err := client.SyncMonitors(context.Background(), desired(0.5), "managed-by:test", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"json budget: update", "flate budget: create"}; !slices.Equal(actions(changes), want) {
+		t.Errorf("Expected dry run changes %q, got %q", want, actions(changes))
+	}
+	if len(fake.writes) != 0 {
+		t.Fatalf("Expected no writes with dry run, got %q", fake.writes)
+	}
+
+	// The monitor created by hand is adopted by name, the other is created
+	if _, err := client.SyncMonitors(context.Background(), desired(0.5), "managed-by:test", false); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"PUT 1", "POST"}; !slices.Equal(fake.writes, want) {
+		t.Errorf("Expected writes %q, got %q", want, fake.writes)
+	}
+	if len(fake.monitors) != 3 {
+		t.Errorf("Expected 3 monitors, got %d", len(fake.monitors))
+	}
+	if m := fake.monitors[1]; !slices.Contains(m.Tags, "managed-by:test") || m.Options.Thresholds.Critical != 0.5 {
+		t.Errorf("Expected the adopted monitor tagged with the budget threshold, got %+v", m)
+	}
+	if m := fake.monitors[2]; m.Query != "other" {
+		t.Errorf("Expected the monitor of the other tool untouched, got %+v", m)
+	}
+
+	// Syncing again is idempotent, even with the tags in another order
+	fake.writes = nil
+	again := desired(0.5)
+	slices.Reverse(again[0].Tags)
+	changes, err = client.SyncMonitors(context.Background(), again, "managed-by:test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"json budget: unchanged", "flate budget: unchanged"}; !slices.Equal(actions(changes), want) {
+		t.Errorf("Expected changes %q, got %q", want, actions(changes))
+	}
+	if len(fake.writes) != 0 {
+		t.Errorf("Expected no writes when in sync, got %q", fake.writes)
+	}
+
+	// A changed budget updates its monitor in place
+	changes, err = client.SyncMonitors(context.Background(), desired(0.8), "managed-by:test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"json budget: update", "flate budget: unchanged"}; !slices.Equal(actions(changes), want) {
+		t.Errorf("Expected changes %q, got %q", want, actions(changes))
+	}
+	if want := []string{"PUT 1"}; !slices.Equal(fake.writes, want) {
+		t.Errorf("Expected writes %q, got %q", want, fake.writes)
+	}
+	if got := fake.monitors[1].Options.Thresholds.Critical; got != 0.8 {
+		t.Errorf("Expected critical threshold 0.8, got %v", got)
+	}
+}
+
+func TestSyncMonitorsRequiresTag(t *testing.T) {
+	srv := httptest.NewServer(&fakeMonitors{monitors: map[int64]*Monitor{}})
+	defer srv.Close()
+
+	client, err := NewClient("api-key", "app-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.app = srv.URL
+
+	m := budgetMonitor("json budget", "query", 0.5)
+	if _, err := client.SyncMonitors(context.Background(), []*Monitor{m}, "managed-by:other", false); err == nil {
+		t.Error("Expected error for a monitor without the tag, got nil")
+	}
+}
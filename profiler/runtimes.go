@@ -0,0 +1,75 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// runtimesLimit is the number of profiles searched to find the cores used by
+// each language of a service.
+const runtimesLimit = 1000
+
+// RuntimeCores is the cpu used by the processes of one language of a service.
+type RuntimeCores struct {
+	Language string
+	// Cores is the average number of cores used by all the processes of the
+	// language over the window, e.g. 12 for 24 hosts using half a core.
+	Cores    float64
+	Profiles int // number of profiles the cores are summed over
+}
+
+// RuntimesCores returns the cores used by each language of a polyglot
+// service, e.g. a go API and its python workers, between from and to, the
+// most first. Every profile of the window is summed, the cpu of a profile
+// being its cores by its duration, so that the cores are the ones of the
+// service rather than of its busiest process. Truncated tells whether there
+// were more profiles than searched, underestimating the cores.
+func (c *Client) RuntimesCores(ctx context.Context, service, environment string, from, to time.Time) (cores []RuntimeCores, truncated bool, err error) {
+	if err := validateTags(service, environment); err != nil {
+		return nil, false, err
+	}
+	filter := fmt.Sprintf("service:%s env:%s", service, environment)
+	profiles, err := c.SearchProfiles(ctx, SearchQuery{
+		Filter: SearchFilter{
+			From:  JSONTime{from},
+			To:    JSONTime{to},
+			Query: filter,
+		},
+		Sort:  SearchSort{Order: "desc", Field: "timestamp"},
+		Limit: runtimesLimit,
+	})
+	if errors.Is(err, ErrNoProfiles) {
+		return nil, false, c.diagnose(ctx, service, environment, to.Sub(from))
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	window := to.Sub(from).Seconds()
+	byLanguage := make(map[string]*RuntimeCores)
+	for _, p := range profiles {
+		language := p.Language
+		if language == "" {
+			language = "unknown"
+		}
+		rc := byLanguage[language]
+		if rc == nil {
+			rc = &RuntimeCores{Language: language}
+			byLanguage[language] = rc
+		}
+		rc.Cores += p.CPUCores * p.Duration.Seconds() / window
+		rc.Profiles++
+	}
+	for _, rc := range byLanguage {
+		cores = append(cores, *rc)
+	}
+	sort.Slice(cores, func(i, j int) bool {
+		if cores[i].Cores != cores[j].Cores {
+			return cores[i].Cores > cores[j].Cores
+		}
+		return cores[i].Language < cores[j].Language
+	})
+	return cores, len(profiles) == runtimesLimit, nil
+}
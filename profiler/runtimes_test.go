@@ -0,0 +1,45 @@
+package profiler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRuntimesCores(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data": [
+			{"id": "e1", "attributes": {"id": "p1", "duration_nanos": 60000000000, "tags": ["language:go"], "custom": {"metrics": {"core_cpu_cores": 2}}}},
+			{"id": "e2", "attributes": {"id": "p2", "duration_nanos": 60000000000, "tags": ["language:go"], "custom": {"metrics": {"core_cpu_cores": 1}}}},
+			{"id": "e3", "attributes": {"id": "p3", "duration_nanos": 60000000000, "tags": ["language:python"], "custom": {"metrics": {"core_cpu_cores": 6}}}}
+		]}`)
+	}))
+	defer srv.Close()
+
+	client, err := NewClient("api-key", "app-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.app = srv.URL
+
+	to := time.Now()
+	cores, truncated, err := client.RuntimesCores(context.Background(), "api", "prod", to.Add(-2*time.Minute), to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if truncated {
+		t.Errorf("Expected the search not to be truncated")
+	}
+	want := []RuntimeCores{{"python", 3, 1}, {"go", 1.5, 2}}
+	if len(cores) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, cores)
+	}
+	for i := range want {
+		if cores[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want[i], cores[i])
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+// servicesLimit is the number of profiles searched to discover the services
+// with profiles.
+const servicesLimit = 1000
+
+// Service is a service profiled in one environment and language.
+type Service struct {
+	Service  string
+	Env      string
+	Language string // language tag of the profiler, "" if unknown
+	Profiles int    // number of its profiles among the ones searched
+	Latest   time.Time
+}
+
+// Services returns the services, environments and languages of the profiles
+// uploaded between from and to and matching the query, e.g. "env:prod" or ""
+// for all, sorted by service, env and language. The most recent profiles are
+// searched, truncated tells whether there were more, in which case services
+// only profiled earlier in the window may be missing.
+func (c *Client) Services(ctx context.Context, query string, from, to time.Time) (services []Service, truncated bool, err error) {
+	profiles, err := c.SearchProfiles(ctx, SearchQuery{
+		Filter: SearchFilter{
+			From:  JSONTime{from},
+			To:    JSONTime{to},
+			Query: query,
+		},
+		Sort:  SearchSort{Order: "desc", Field: "timestamp"},
+		Limit: servicesLimit,
+	})
+	if errors.Is(err, ErrNoProfiles) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	type key struct{ service, env, language string }
+	byKey := make(map[key]*Service)
+	for _, p := range profiles {
+		k := key{p.Service, p.Env, p.Language}
+		s := byKey[k]
+		if s == nil {
+			s = &Service{Service: p.Service, Env: p.Env, Language: p.Language}
+			byKey[k] = s
+		}
+		s.Profiles++
+		if p.Timestamp.After(s.Latest) {
+			s.Latest = p.Timestamp
+		}
+	}
+	for _, s := range byKey {
+		services = append(services, *s)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		a, b := services[i], services[j]
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		if a.Env != b.Env {
+			return a.Env < b.Env
+		}
+		return a.Language < b.Language
+	})
+	return services, len(profiles) == servicesLimit, nil
+}
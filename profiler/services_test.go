@@ -0,0 +1,50 @@
+package profiler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServices(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data": [
+			{"id": "e1", "attributes": {"id": "p1", "service": "web", "timestamp": "2025-01-01T12:02:00Z", "tags": ["env:prod", "language:python"]}},
+			{"id": "e2", "attributes": {"id": "p2", "service": "api", "timestamp": "2025-01-01T12:01:00Z", "tags": ["env:prod", "language:go"]}},
+			{"id": "e3", "attributes": {"id": "p3", "service": "api", "timestamp": "2025-01-01T12:00:00Z", "tags": ["env:prod", "language:go"]}},
+			{"id": "e4", "attributes": {"id": "p4", "service": "api", "timestamp": "2025-01-01T11:00:00Z", "tags": ["env:staging", "language:go"]}}
+		]}`)
+	}))
+	defer srv.Close()
+
+	client, err := NewClient("api-key", "app-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.app = srv.URL
+
+	to := time.Date(2025, 1, 1, 13, 0, 0, 0, time.UTC)
+	services, truncated, err := client.Services(context.Background(), "", to.Add(-time.Hour), to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if truncated {
+		t.Errorf("Expected the search not to be truncated")
+	}
+	want := []Service{
+		{"api", "prod", "go", 2, time.Date(2025, 1, 1, 12, 1, 0, 0, time.UTC)},
+		{"api", "staging", "go", 1, time.Date(2025, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"web", "prod", "python", 1, time.Date(2025, 1, 1, 12, 2, 0, 0, time.UTC)},
+	}
+	if len(services) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, services)
+	}
+	for i := range want {
+		if services[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want[i], services[i])
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EndpointStats are the APM trace metrics of an endpoint, a resource of the
+// spans of an operation, over a time window.
+type EndpointStats struct {
+	Resource string
+	Hits     float64       // requests in the window
+	Duration time.Duration // total time spent serving them
+}
+
+// Latency returns the mean latency of the requests, 0 without requests.
+func (s *EndpointStats) Latency() time.Duration {
+	if s.Hits <= 0 {
+		return 0
+	}
+	return time.Duration(float64(s.Duration) / s.Hits)
+}
+
+// TraceStats returns the trace metrics of the operation of the service, e.g.
+// http.request, by resource, from the trace.<operation>.hits and
+// trace.<operation>.duration metrics between from and to. The host, if not
+// empty, restricts them to the requests served by one host, e.g. the one a
+// profile was recorded on. Endpoints are sorted by descending hits.
+func (c *Client) TraceStats(ctx context.Context, service, environment, host, operation string, from, to time.Time) (stats []*EndpointStats, err error) {
+	defer wrapErr(&err, "trace stats")
+	if err := validateTags(service, environment); err != nil {
+		return nil, err
+	}
+	scope := fmt.Sprintf("service:%s,env:%s", service, environment)
+	if host != "" {
+		scope += ",host:" + host
+	}
+
+	hits, err := c.queryByResource(ctx, fmt.Sprintf("sum:trace.%s.hits{%s} by {resource_name}.as_count()", operation, scope), from, to)
+	if err != nil {
+		return nil, err
+	}
+	durations, err := c.queryByResource(ctx, fmt.Sprintf("sum:trace.%s.duration{%s} by {resource_name}.as_count()", operation, scope), from, to)
+	if err != nil {
+		return nil, err
+	}
+	for resource, n := range hits {
+		stats = append(stats, &EndpointStats{
+			Resource: resource,
+			Hits:     n,
+			Duration: time.Duration(durations[resource] * float64(time.Second)),
+		})
+	}
+	if len(stats) == 0 {
+		return nil, fmt.Errorf("no trace.%s.hits for %s, check the --operation", operation, scope)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Hits != stats[j].Hits {
+			return stats[i].Hits > stats[j].Hits
+		}
+		return stats[i].Resource < stats[j].Resource
+	})
+	return stats, nil
+}
+
+// queryByResource runs a metrics query grouped by resource_name and returns
+// the sum of the points of every resource.
+func (c *Client) queryByResource(ctx context.Context, query string, from, to time.Time) (map[string]float64, error) {
+	defer c.limitConcurrency()()
+	values := url.Values{
+		"query": {query},
+		"from":  {strconv.FormatInt(from.Unix(), 10)},
+		"to":    {strconv.FormatInt(to.Unix(), 10)},
+	}
+	data, err := c.get(ctx, "/api/v1/query?"+values.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Series []struct {
+			TagSet    []string      `json:"tag_set"`
+			Pointlist [][2]*float64 `json:"pointlist"`
+		} `json:"series"`
+	}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	sums := make(map[string]float64)
+	for _, series := range response.Series {
+		var resource string
+		for _, tag := range series.TagSet {
+			if value, ok := strings.CutPrefix(tag, "resource_name:"); ok {
+				resource = value
+			}
+		}
+		for _, point := range series.Pointlist {
+			if point[1] != nil {
+				sums[resource] += *point[1]
+			}
+		}
+	}
+	return sums, nil
+}
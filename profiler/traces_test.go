@@ -0,0 +1,46 @@
+package profiler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTraceStats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		if r.URL.Path != "/api/v1/query" || !strings.Contains(query, "{service:api,env:prod,host:web-1}") {
+			t.Errorf("Expected a metrics query of api on web-1, got %s %s", r.URL.Path, query)
+		}
+		if strings.Contains(query, ".hits{") {
+			w.Write([]byte(`{"series": [
+				{"tag_set": ["resource_name:get_/users"], "pointlist": [[1, 40], [2, null], [3, 60]]},
+				{"tag_set": ["resource_name:post_/upload"], "pointlist": [[1, 10]]}
+			]}`))
+			return
+		}
+		w.Write([]byte(`{"series": [{"tag_set": ["resource_name:get_/users"], "pointlist": [[1, 1.5], [3, 0.5]]}]}`))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient("api-key", "app-key", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.app = srv.URL
+
+	now := time.Now()
+	stats, err := client.TraceStats(context.Background(), "api", "prod", "web-1", "http.request", now.Add(-time.Minute), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats[0].Resource != "get_/users" || stats[0].Hits != 100 || stats[0].Latency() != 20*time.Millisecond {
+		t.Errorf("Expected get_/users with 100 hits of 20ms first, got %+v", stats)
+	}
+	if stats[1].Resource != "post_/upload" || stats[1].Latency() != 0 {
+		t.Errorf("Expected post_/upload without duration, got %+v", stats[1])
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -66,7 +67,8 @@ func (t JSONTime) String() string {
 
 // SearchProfile holds information about a profile search result. ProfileID and
 // EventID are used to identify the SearchProfile for downloading. The other
-// fields are just logged for debugging.
+// fields are shown in report headers, as they are needed to interpret merges
+// of profiles of different hosts and versions.
 type SearchProfile struct {
 	Service   string
 	CPUCores  float64
@@ -74,21 +76,288 @@ type SearchProfile struct {
 	EventID   string
 	Timestamp time.Time
 	Duration  time.Duration
+
+	Env             string // env tag of the service
+	Version         string // version tag of the service
+	Host            string
+	RuntimeID       string // id of the process the profile was recorded in
+	Language        string // language tag of the profiler, e.g. go or python
+	ProfilerVersion string
+
+	// Metrics are the runtime metrics of the metrics.json of the download,
+	// by name, nil if it has none.
+	Metrics map[string]float64
+}
+
+// String describes the profile in one line, e.g. for report headers.
+func (p *SearchProfile) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "profile %s service:%s", p.ProfileID, p.Service)
+	for _, tag := range []struct{ key, value string }{
+		{"version", p.Version},
+		{"host", p.Host},
+		{"runtime-id", p.RuntimeID},
+		{"language", p.Language},
+		{"profiler_version", p.ProfilerVersion},
+	} {
+		if tag.value != "" {
+			fmt.Fprintf(&b, " %s:%s", tag.key, tag.value)
+		}
+	}
+	fmt.Fprintf(&b, " at %s (%s, %.2f cores)", p.Timestamp.UTC().Format(time.RFC3339), p.Duration, p.CPUCores)
+	return b.String()
+}
+
+// Runtime returns the runtime the profile was recorded by, which tells how its
+// cpu profile is extracted and analyzed: jvm for java profiles, go when the
+// language is unknown, and the language otherwise.
+func (p *SearchProfile) Runtime() string {
+	return RuntimeOf(p.Language)
+}
+
+// RuntimeOf returns the runtime of a Datadog language tag, like
+// SearchProfile.Runtime.
+func RuntimeOf(language string) string {
+	switch language {
+	case "java":
+		return "jvm"
+	case "":
+		return "go"
+	}
+	return language
+}
+
+// setTags sets the fields of the profile that are unset from its key:value
+// tags.
+func (p *SearchProfile) setTags(tags []string) {
+	for _, tag := range tags {
+		key, value, _ := strings.Cut(tag, ":")
+		var field *string
+		switch key {
+		case "service":
+			field = &p.Service
+		case "env":
+			field = &p.Env
+		case "version":
+			field = &p.Version
+		case "host":
+			field = &p.Host
+		case "runtime-id":
+			field = &p.RuntimeID
+		case "language":
+			field = &p.Language
+		case "profiler_version", "profiler-version":
+			field = &p.ProfilerVersion
+		default:
+			continue
+		}
+		if *field == "" {
+			*field = value
+		}
+	}
 }
 
-// ProfileDownload is the result of downloading a profile.
+// ProfileDownload is the result of downloading a profile, a zip archive read
+// from the temporary file it was downloaded to.
 type ProfileDownload struct {
-	data []byte
+	r      io.ReaderAt
+	size   int64
+	closer io.Closer // removes the temporary file, nil if there is none
+}
+
+// Close removes the temporary file of the download.
+func (d ProfileDownload) Close() error {
+	if d.closer == nil {
+		return nil
+	}
+	return d.closer.Close()
+}
+
+// Archive returns the zip archive of the download, which closes the download
+// when closed.
+func (d ProfileDownload) Archive() io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(d.r, 0, d.size), d}
 }
 
 // ExtractCPUProfile extracts the CPU profile from the download.
 func (d ProfileDownload) ExtractCPUProfile() ([]byte, error) {
-	zr, err := zip.NewReader(bytes.NewReader(d.data), int64(len(d.data)))
+	data, err := d.extract(func(name string) bool { return name == "cpu.pprof" })
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, errors.New("no cpu.pprof found in download")
+	}
+	return data, nil
+}
+
+// cpuProfile extracts the cpu profile of the runtime from the download, the
+// JFR recording for jvm services.
+func (d ProfileDownload) cpuProfile(runtime string) ([]byte, error) {
+	if runtime == "jvm" {
+		return d.ExtractJFR()
+	}
+	return d.ExtractCPUProfile()
+}
+
+// ExtractJFR extracts the Java Flight Recorder recording uploaded by JVM
+// services from the download.
+func (d ProfileDownload) ExtractJFR() ([]byte, error) {
+	data, err := d.extract(func(name string) bool { return filepath.Ext(name) == ".jfr" })
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, errors.New("no .jfr recording found in download")
+	}
+	return data, nil
+}
+
+// Event returns the event.json of the download, which describes the upload
+// of its profiles, or nil if it has none.
+func (d ProfileDownload) Event() (*ProfileEvent, error) {
+	data, err := d.extract(func(name string) bool { return name == "event.json" })
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return ParseProfileEvent(data)
+}
+
+// describe sets the fields of the profile that are unset, e.g. of profiles
+// downloaded by id, from the event.json of the download, and its metrics.
+func (d ProfileDownload) describe(p *SearchProfile) error {
+	event, err := d.Event()
+	if err != nil {
+		return err
+	}
+	if event != nil {
+		p.setTags(event.Tags)
+		if p.Language == "" {
+			p.Language = event.Family
+		}
+		if p.Timestamp.IsZero() {
+			p.Timestamp = event.Start
+		}
+		if p.Duration == 0 {
+			p.Duration = event.Duration()
+		}
+	}
+	if p.Language == "" {
+		// Only the JVM profiler uploads JFR recordings
+		jfr, err := d.extract(func(name string) bool { return filepath.Ext(name) == ".jfr" })
+		if err != nil {
+			return err
+		}
+		if jfr != nil {
+			p.Language = "java"
+		}
+	}
+	p.Metrics, err = d.metrics()
+	return err
+}
+
+// ProfileEvent is the event.json Datadog profilers upload along with their
+// profiles.
+type ProfileEvent struct {
+	Family      string // language of the profiler, e.g. go or java
+	Version     string // version of the event format
+	Start, End  time.Time
+	Tags        []string // key:value tags of the profiler, e.g. service:api
+	Attachments []string // names of the profiles of the upload
+}
+
+// ParseProfileEvent parses the event.json of a Datadog upload.
+func ParseProfileEvent(data []byte) (*ProfileEvent, error) {
+	var raw event
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("event.json: %w", err)
+	}
+	e := &ProfileEvent{Family: raw.Family, Version: raw.Version, Attachments: raw.Attachments}
+	for _, tag := range strings.Split(raw.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			e.Tags = append(e.Tags, tag)
+		}
+	}
+	for _, t := range []struct {
+		value string
+		field *time.Time
+	}{{raw.Start, &e.Start}, {raw.End, &e.End}} {
+		if t.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339Nano, t.value)
+		if err != nil {
+			return nil, fmt.Errorf("event.json: %w", err)
+		}
+		*t.field = parsed
+	}
+	return e, nil
+}
+
+// Tag returns the value of the key:value tag of the event, empty if it has
+// none.
+func (e *ProfileEvent) Tag(key string) string {
+	for _, tag := range e.Tags {
+		if k, value, ok := strings.Cut(tag, ":"); ok && k == key {
+			return value
+		}
+	}
+	return ""
+}
+
+// Duration returns how long the profiles of the event were recorded for, 0
+// if the event does not tell.
+func (e *ProfileEvent) Duration() time.Duration {
+	if e.Start.IsZero() || !e.End.After(e.Start) {
+		return 0
+	}
+	return e.End.Sub(e.Start)
+}
+
+// metrics returns the metrics of the metrics.json of the download, nil if it
+// has none.
+func (d ProfileDownload) metrics() (map[string]float64, error) {
+	data, err := d.extract(func(name string) bool { return name == "metrics.json" })
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return ParseMetrics(data)
+}
+
+// ParseMetrics parses the metrics.json of a Datadog download, a list of
+// [name, value] pairs, or an object of values by name.
+func ParseMetrics(data []byte) (map[string]float64, error) {
+	var pairs [][2]any
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		var values map[string]float64
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("metrics.json: expected [name, value] pairs or an object of values")
+		}
+		return values, nil
+	}
+	metrics := make(map[string]float64, len(pairs))
+	for _, pair := range pairs {
+		name, ok := pair[0].(string)
+		value, isNumber := pair[1].(float64)
+		if ok && isNumber {
+			metrics[name] = value
+		}
+	}
+	return metrics, nil
+}
+
+// extract returns the contents of the first file in the download zip whose base
+// name matches, or nil if there is none.
+func (d ProfileDownload) extract(match func(name string) bool) ([]byte, error) {
+	zr, err := zip.NewReader(d.r, d.size)
 	if err != nil {
 		return nil, err
 	}
 	for _, f := range zr.File {
-		if filepath.Base(f.Name) == "cpu.pprof" {
+		if match(filepath.Base(f.Name)) {
 			rc, err := f.Open()
 			if err != nil {
 				return nil, err
@@ -98,7 +367,7 @@ func (d ProfileDownload) ExtractCPUProfile() ([]byte, error) {
 		}
 	}
 
-	return nil, errors.New("no cpu.pprof found in download")
+	return nil, nil
 }
 
 // ProfilesDownload is the result of downloading several profiles from the pgo
@@ -107,11 +376,42 @@ type ProfilesDownload struct {
 	data []byte
 }
 
+// ExtractCPUProfiles extracts every CPU profile from the download, which is
+// either a zip archive holding a cpu.pprof per profile or a single pprof.
+func (d ProfilesDownload) ExtractCPUProfiles() ([][]byte, error) {
+	if !bytes.HasPrefix(d.data, []byte("PK\x03\x04")) {
+		return [][]byte{d.data}, nil
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(d.data), int64(len(d.data)))
+	if err != nil {
+		return nil, err
+	}
+	var profiles [][]byte
+	for _, f := range zr.File {
+		if filepath.Base(f.Name) != "cpu.pprof" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, data)
+	}
+	if len(profiles) == 0 {
+		return nil, errors.New("no cpu.pprof found in download")
+	}
+	return profiles, nil
+}
+
 // wrapErr wraps the error with name if it is not nil.
 func wrapErr(err *error, name string) {
 	if *err != nil {
 		*err = fmt.Errorf("%s: %w", name, *err)
 	}
 }
-
-const version = "0.0.1"
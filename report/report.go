@@ -0,0 +1,120 @@
+// Package report defines the machine-readable report written by
+// pprof-adv --format json, for dashboards and other tools parsing it, and its
+// Rows written by --format ndjson.
+//
+// Reports carry the SchemaVersion they were written with. Within a schema
+// version fields are only ever added, never removed, renamed or changed in
+// meaning, so parsers should ignore the fields they don't know. Any other
+// change increments SchemaVersion, which Decode rejects until the parser is
+// upgraded rather than misreading the report.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// SchemaVersion is the version of the schema of the reports written by this
+// version of pprof-adv.
+const SchemaVersion = 1
+
+// Report is the usage of every function of a profile.
+type Report struct {
+	SchemaVersion int        `json:"schema_version"`
+	Type          string     `json:"type"`                  // type of the profile: cpu, wall, heap or goroutine
+	SampleType    string     `json:"sample_type"`           // name of the sample type analyzed, e.g. cpu or alloc_space
+	Unit          string     `json:"unit"`                  // unit of the sample type, e.g. nanoseconds or bytes
+	Total         int64      `json:"total"`                 // sum of the sample type over the samples analyzed
+	DurationNanos int64      `json:"duration_nanos"`        // duration of the profile, 0 if unknown
+	Fingerprint   string     `json:"fingerprint,omitempty"` // hash of the contents of the profile, the same for reports of the same profile
+	Functions     []Function `json:"functions"`             // by descending attributed percentage, ties broken by name
+	Warnings      []string   `json:"warnings,omitempty"`    // data quality issues of the profile, e.g. samples without function information
+}
+
+// Function is the usage of a function, in percent of the report's total.
+type Function struct {
+	Name         string  `json:"name"`
+	File         string  `json:"file,omitempty"`
+	Module       string  `json:"module,omitempty"`  // module of the function if it is a dependency
+	Version      string  `json:"version,omitempty"` // version of the module
+	AttrPercent  float64 `json:"attr_percent"`      // self usage plus the usage of attributed callees, such as the stdlib
+	SelfPercent  float64 `json:"self_percent"`
+	TotalPercent float64 `json:"total_percent"` // usage including all callees
+	Samples      int     `json:"samples"`       // number of samples the function appears in
+	Stacks       int     `json:"stacks"`        // number of distinct call stacks the function appears in
+	Callers      int     `json:"callers"`       // number of distinct functions calling it
+}
+
+// Encode writes the report as indented JSON, with the current SchemaVersion.
+func (r *Report) Encode(w io.Writer) error {
+	r.SchemaVersion = SchemaVersion
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Row is a line of the NDJSON form of a report, one per function with the
+// fields of the report it is from, so that the rows of many profiles can be
+// loaded into one table.
+type Row struct {
+	SchemaVersion int    `json:"schema_version"`
+	Type          string `json:"type"`
+	SampleType    string `json:"sample_type"`
+	Unit          string `json:"unit"`
+	Total         int64  `json:"total"`
+	DurationNanos int64  `json:"duration_nanos"`
+	Rank          int    `json:"rank"` // 1-based position of the function in the report
+	Function
+}
+
+// RowEncoder writes the functions of a report as Rows, one JSON object per
+// line.
+type RowEncoder struct {
+	enc *json.Encoder
+	row Row
+}
+
+// NewRow returns the row of the function at the 1-based rank of the report,
+// whose own Functions are ignored.
+func NewRow(r *Report, rank int, fn Function) Row {
+	return Row{
+		SchemaVersion: SchemaVersion,
+		Type:          r.Type,
+		SampleType:    r.SampleType,
+		Unit:          r.Unit,
+		Total:         r.Total,
+		DurationNanos: r.DurationNanos,
+		Rank:          rank,
+		Function:      fn,
+	}
+}
+
+// NewRowEncoder returns an encoder of the functions of the report, whose own
+// Functions are ignored.
+func NewRowEncoder(w io.Writer, r *Report) *RowEncoder {
+	return &RowEncoder{enc: json.NewEncoder(w), row: NewRow(r, 0, Function{})}
+}
+
+// Encode writes the row of the next function of the report.
+func (e *RowEncoder) Encode(fn Function) error {
+	e.row.Rank++
+	e.row.Function = fn
+	return e.enc.Encode(&e.row)
+}
+
+// Decode reads a report, failing if it has no schema version or a newer one
+// than SchemaVersion, whose fields may have changed meaning.
+func Decode(r io.Reader) (*Report, error) {
+	var report Report
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return nil, err
+	}
+	if report.SchemaVersion <= 0 {
+		return nil, fmt.Errorf("not a pprof-adv report: missing schema_version")
+	}
+	if report.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("report schema version %d is newer than the supported version %d, upgrade to parse it", report.SchemaVersion, SchemaVersion)
+	}
+	return &report, nil
+}
@@ -0,0 +1,79 @@
+package report
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var v1 = &Report{
+	SchemaVersion: 1,
+	Type:          "cpu",
+	SampleType:    "cpu",
+	Unit:          "nanoseconds",
+	Total:         100,
+	DurationNanos: 1e9,
+	Functions: []Function{
+		{Name: "github.com/org/repo/store.Get", File: "store.go", Module: "github.com/org/repo", Version: "v1.2.3", AttrPercent: 75, SelfPercent: 75, TotalPercent: 75, Samples: 1, Stacks: 1, Callers: 1},
+		{Name: "main.main", File: "main.go", AttrPercent: 25, SelfPercent: 25, TotalPercent: 100, Samples: 2, Stacks: 2},
+	},
+}
+
+// TestSchemaV1 guards the compatibility of version 1 of the schema: the
+// golden file must keep decoding to the same report, and while SchemaVersion
+// is 1 the report must keep encoding to it. Only fields may be added, to both.
+func TestSchemaV1(t *testing.T) {
+	golden, err := os.ReadFile("testdata/v1.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(bytes.NewReader(golden))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, v1) {
+		t.Errorf("Expected %+v, got %+v", v1, decoded)
+	}
+
+	if SchemaVersion != 1 {
+		return
+	}
+	var buf bytes.Buffer
+	if err := v1.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != string(golden) {
+		t.Errorf("Expected the report to encode to testdata/v1.json, got\n%s", buf.String())
+	}
+}
+
+func TestDecode(t *testing.T) {
+	report, err := Decode(strings.NewReader(`{"schema_version": 1, "type": "heap", "added_later": true}`))
+	if err != nil || report.Type != "heap" {
+		t.Errorf("Expected unknown fields to be ignored, got %+v: %v", report, err)
+	}
+	if _, err := Decode(strings.NewReader(`{"type": "cpu"}`)); err == nil {
+		t.Error("Expected error for a report without schema_version")
+	}
+	if _, err := Decode(strings.NewReader(`{"schema_version": 2}`)); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("Expected error for a newer schema version, got %v", err)
+	}
+}
+
+func TestRowEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewRowEncoder(&buf, v1)
+	for _, fn := range v1.Functions {
+		if err := enc.Encode(fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := `{"schema_version":1,"type":"cpu","sample_type":"cpu","unit":"nanoseconds","total":100,"duration_nanos":1000000000,"rank":1,"name":"github.com/org/repo/store.Get","file":"store.go","module":"github.com/org/repo","version":"v1.2.3","attr_percent":75,"self_percent":75,"total_percent":75,"samples":1,"stacks":1,"callers":1}
+{"schema_version":1,"type":"cpu","sample_type":"cpu","unit":"nanoseconds","total":100,"duration_nanos":1000000000,"rank":2,"name":"main.main","file":"main.go","attr_percent":25,"self_percent":25,"total_percent":100,"samples":2,"stacks":2,"callers":0}
+`
+	if buf.String() != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, buf.String())
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/polyglot"
+)
+
+type RuntimesCmd struct {
+	Languages string        `arg:"--languages" help:"comma separated language tags of the --apm service to report (e.g. go,python), all the ones it is profiled in by default"`
+	Window    time.Duration `arg:"--window"    help:"window the cores of each runtime are averaged over" default:"1h"`
+}
+
+// run sums the cores of the profiles of every language of the --apm service,
+// then downloads the top profile of each language and shares its cores among
+// its functions, each analyzed with the runtime functions of its language.
+func (cmd *RuntimesCmd) run(root *Cmd) {
+	if root.Service == "" {
+		fail("runtimes needs the service to fetch profiles of with --apm")
+	}
+	client := root.newClient()
+	ctx := context.Background()
+	to := time.Now()
+	from := to.Add(-cmd.Window)
+
+	cores, truncated, err := client.RuntimesCores(ctx, root.Service, root.Environment, from, to)
+	if err != nil {
+		fail("Error searching profiles: %s", err)
+	}
+	if truncated {
+		fmt.Fprintf(os.Stderr, "warning: the service has more profiles than searched in the last %s, the cores are underestimated, use a shorter --window\n", cmd.Window)
+	}
+	var languages []string
+	for _, language := range strings.Split(cmd.Languages, ",") {
+		if language = strings.TrimSpace(language); language != "" {
+			languages = append(languages, language)
+		}
+	}
+
+	var runtimes []*polyglot.Runtime
+	for _, rc := range cores {
+		if len(languages) > 0 && !slices.Contains(languages, rc.Language) {
+			continue
+		}
+		runtime := &polyglot.Runtime{Language: rc.Language, Cores: rc.Cores}
+		runtimes = append(runtimes, runtime)
+		if rc.Language == "unknown" {
+			continue
+		}
+		info, r, err := client.FetchLanguageCPUProfile(ctx, root.Service, root.Environment, rc.Language, from, to)
+		if err != nil {
+			fail("Error getting the %s CPU profile: %s", rc.Language, err)
+		}
+		format := "pprof"
+		if rc.Language == "jvm" || rc.Language == "java" {
+			format = "jfr"
+		}
+		runtime.Profile = info.String()
+		if err := runtime.Analyze(root.parseProfile(r, format), root.analyzeOptions()); err != nil {
+			fail("Error analyzing profile: %s", err)
+		}
+	}
+	if len(runtimes) == 0 {
+		fail("the service has no profiles of --languages %s in the last %s", cmd.Languages, cmd.Window)
+	}
+	polyglot.Write(os.Stdout, runtimes, root.Top, root.style())
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/kmrgirish/pprof-adv/internal/selftest"
+)
+
+type SelftestCmd struct{}
+
+func (cmd *SelftestCmd) run() {
+	failed := 0
+	for _, result := range selftest.Run() {
+		if result.Err != nil {
+			failed++
+			fmt.Printf("FAIL\t%s: %s\n", result.Name, result.Err)
+			continue
+		}
+		fmt.Printf("ok\t%s\n", result.Name)
+	}
+
+	if failed > 0 {
+		fail("%d fixtures failed\n", failed)
+	}
+}
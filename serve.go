@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/input"
+	"github.com/kmrgirish/pprof-adv/internal/schedule"
+	"github.com/kmrgirish/pprof-adv/internal/server"
+	"github.com/kmrgirish/pprof-adv/internal/store"
+	"github.com/kmrgirish/pprof-adv/pb"
+	"github.com/kmrgirish/pprof-adv/profiler"
+)
+
+type ServeCmd struct {
+	Addr         string        `arg:"--addr"                      help:"address to listen on" default:"localhost:8080"`
+	Store        string        `arg:"--store"                     help:"directory or s3://bucket/prefix uploaded profiles are kept in, encrypted if PPROF_ADV_KEY or the keyring has a key" default:"pprof-adv-store"`
+	Forward      bool          `arg:"--forward"                   help:"also forward every upload to the Datadog profiling intake, using DD_API_KEY and DD_SITE"`
+	Tokens       []string      `arg:"--token,env:PPROF_ADV_TOKEN" help:"API tokens clients must send as Authorization: Bearer or DD-API-KEY"`
+	OIDCIssuer   string        `arg:"--oidc-issuer"               help:"also accept ID tokens of this OpenID Connect issuer, e.g. https://accounts.google.com"`
+	OIDCAudience string        `arg:"--oidc-audience"             help:"audience, usually the client id, ID tokens must be issued for"`
+	Scopes       []string      `arg:"--scope,separate"            help:"restrict a credential to the profiles of some services, envs or teams, as the credential followed by tag:value pairs with values separated by |, e.g. 'TOKEN team:payments env:prod|staging', or 'email:alice@example.com team:payments' and 'group:perf service:checkout' for ID tokens, which are then denied without a scope; repeat for several scopes, the tokens of which need not be repeated in --token"`
+	MaxAge       time.Duration `arg:"--max-age"                   help:"delete stored profiles older than this, e.g. 720h, checked hourly"`
+	MaxSize      string        `arg:"--max-size"                  help:"delete the oldest stored profiles when they take more than this, e.g. 10GB, checked hourly"`
+	Schedule     string        `arg:"--schedule"                  help:"cron expression, e.g. '0 9 * * MON', to fetch the top profile of the --apm service on, storing it with a report of the changes since the previous one, and posting it as a Datadog event with --post-dd-event"`
+}
+
+func (cmd *ServeCmd) run(root *Cmd) {
+	opts, apiKey := root.analyzeOptions(), root.DdApiKey
+	st, err := store.Open(cmd.Store)
+	if err != nil {
+		fail("Error opening store: %s", err)
+	}
+	st.Encrypt(root.loadCipher())
+	r := retention(cmd.MaxAge, cmd.MaxSize)
+	if r != (store.Retention{}) {
+		if _, err := st.Prune(r, time.Now(), false); err != nil {
+			fail("Error pruning store: %s", err)
+		}
+	}
+	analyzer, err := pb.NewAnalyzer(opts)
+	if err != nil {
+		fail("Error creating analyzer: %s", err)
+	}
+	srv, err := server.New(st, analyzer)
+	if err != nil {
+		fail("Error loading store: %s", err)
+	}
+	srv.Theme = root.theme()
+	if r != (store.Retention{}) {
+		go prune(st, srv, r)
+	}
+	if len(cmd.Tokens) > 0 || len(cmd.Scopes) > 0 || cmd.OIDCIssuer != "" {
+		srv.Auth = &server.Auth{Tokens: cmd.Tokens, Scopes: cmd.scopes()}
+		for credential := range srv.Auth.Scopes {
+			if !strings.HasPrefix(credential, "email:") && !strings.HasPrefix(credential, "group:") && !slices.Contains(srv.Auth.Tokens, credential) {
+				srv.Auth.Tokens = append(srv.Auth.Tokens, credential)
+			}
+		}
+	}
+	if cmd.OIDCIssuer != "" {
+		if cmd.OIDCAudience == "" {
+			fail("--oidc-audience is required with --oidc-issuer")
+		}
+		if srv.Auth.OIDC, err = server.NewOIDCVerifier(context.Background(), cmd.OIDCIssuer, cmd.OIDCAudience); err != nil {
+			fail("Error configuring OIDC: %s", err)
+		}
+	}
+	if srv.Auth == nil {
+		fmt.Fprintln(os.Stderr, "Warning: serving without authentication, use --token or --oidc-issuer")
+	}
+	if cmd.Forward {
+		if srv.Forward, err = profiler.NewIntakeClient(apiKey, root.site); err != nil {
+			fail("Error creating profiler client: %s", err)
+		}
+	}
+
+	if cmd.Schedule != "" {
+		go srv.RunPeriodic(context.Background(), cmd.periodic(root))
+	}
+
+	fmt.Printf("Listening on http://%s, upload profiles to /ingest\n", cmd.Addr)
+	if err := http.ListenAndServe(cmd.Addr, srv); err != nil {
+		fail("Error serving: %s", err)
+	}
+}
+
+// scopes returns the scopes of the --scope flags by credential, exiting on
+// invalid ones.
+func (cmd *ServeCmd) scopes() map[string][]server.Scope {
+	scopes := make(map[string][]server.Scope)
+	for _, s := range cmd.Scopes {
+		credential, scope, err := server.ParseScope(s)
+		if err != nil {
+			fail("Invalid --scope: %s", err)
+		}
+		scopes[credential] = append(scopes[credential], scope)
+	}
+	return scopes
+}
+
+// pruneInterval is how often serve deletes the profiles past the retention.
+const pruneInterval = time.Hour
+
+// prune deletes the stored profiles past the retention every pruneInterval,
+// then reloads the reports of the server so that they drop them too.
+func prune(st *store.Store, srv *server.Server, r store.Retention) {
+	for {
+		time.Sleep(pruneInterval)
+		pruned, err := st.Prune(r, time.Now(), false)
+		if err != nil {
+			log.Printf("pruning store: %s", err)
+		}
+		if len(pruned) == 0 {
+			continue
+		}
+		log.Printf("pruned %d profiles past the retention", len(pruned))
+		if err := srv.Reload(); err != nil {
+			log.Printf("reloading reports: %s", err)
+		}
+	}
+}
+
+// periodic returns the periodic report of the --schedule flag, exiting on
+// invalid flags.
+func (cmd *ServeCmd) periodic(root *Cmd) *server.Periodic {
+	sched, err := schedule.Parse(cmd.Schedule)
+	if err != nil {
+		fail("Invalid --schedule: %s", err)
+	}
+	if root.Service == "" {
+		fail("--schedule needs the --apm service to fetch profiles of")
+	}
+	client := root.newClient()
+
+	p := &server.Periodic{
+		Schedule: sched,
+		Source:   fmt.Sprintf("service:%s env:%s", root.Service, root.Environment),
+		Tags:     map[string]string{"service": root.Service, "env": root.Environment},
+		Top:      root.Top,
+		Fetch: func(ctx context.Context) ([]byte, error) {
+			info, r, err := client.FetchCPUProfile(ctx, root.Service, root.Environment, root.Runtime, time.Hour, 1)
+			if err != nil {
+				return nil, err
+			}
+			runtime := root.Runtime
+			if runtime == "" {
+				runtime = info.Runtime()
+			}
+			if runtime != "jvm" {
+				return io.ReadAll(r)
+			}
+			// Store the recording as pprof, which the server reads
+			profile, err := input.Parse(r, "jfr")
+			if err != nil {
+				return nil, err
+			}
+			var buf bytes.Buffer
+			err = pb.Write(&buf, profile)
+			return buf.Bytes(), err
+		},
+	}
+	if root.PostDdEvent {
+		p.PostEvent = client.PostEvent
+	}
+	fmt.Printf("Reporting on %s at %s, next at %s\n", p.Source, sched, sched.Next(time.Now()).Format(time.RFC1123))
+	return p
+}
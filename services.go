@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type ServicesCmd struct {
+	Env    string        `arg:"--env"    help:"only list the services profiled in this environment, all of them by default"`
+	Query  string        `arg:"--query"  help:"only list the services of the profiles matching this Datadog query, e.g. team:payments"`
+	Window time.Duration `arg:"--window" help:"window the profiles are searched in" default:"1h"`
+}
+
+// run lists the services, environments and languages with profiles in the
+// window, to find the --apm, --environment and --runtime to fetch.
+func (cmd *ServicesCmd) run(root *Cmd) {
+	query := cmd.Query
+	if cmd.Env != "" {
+		query = strings.TrimSpace("env:" + cmd.Env + " " + query)
+	}
+	to := time.Now()
+	services, truncated, err := root.newClient().Services(context.Background(), query, to.Add(-cmd.Window), to)
+	if err != nil {
+		fail("Error searching profiles: %s", err)
+	}
+	if len(services) == 0 {
+		fail("no profiles in the last %s, check DD_SITE and the --dd-profile", cmd.Window)
+	}
+	if truncated {
+		fmt.Fprintf(os.Stderr, "warning: more profiles than searched in the last %s, services only profiled earlier may be missing, use a shorter --window or --env\n", cmd.Window)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "service\tenv\tlanguage\tprofiles\tlatest")
+	for _, s := range services {
+		language := s.Language
+		if language == "" {
+			language = "unknown"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s ago\n", s.Service, s.Env, language, s.Profiles, time.Since(s.Latest).Round(time.Second))
+	}
+	w.Flush()
+}
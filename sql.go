@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+
+	"github.com/kmrgirish/pprof-adv/internal/cpu"
+	"github.com/kmrgirish/pprof-adv/internal/sqlite"
+)
+
+type SqlCmd struct {
+	Query   string `arg:"positional" help:"SQL query over the tables functions (name, package, file, module, version, self_attr, self, total, samples, stacks, callers, depth), edges (caller, callee, total) and samples (id, value, leaf, stack), percentages of the total, e.g. 'SELECT package, sum(self_attr) FROM functions GROUP BY package ORDER BY 2 DESC'"`
+	Profile string `arg:"--profile"  help:"profile to query, defaults to --profile, the top profile of the --apm service or stdin"`
+	Dump    bool   `arg:"--dump"     help:"print the SQL creating and filling the tables instead of querying them, e.g. to load them into a sqlite3 database file"`
+}
+
+// run loads the analysis of the profile into SQLite tables and runs the query
+// over them in an embedded in-memory SQLite database.
+func (cmd *SqlCmd) run(root *Cmd) {
+	if cmd.Query == "" && !cmd.Dump {
+		fail("sql needs a query, or --dump")
+	}
+	profile, _ := root.loadProfile(cmd.Profile, "sql")
+	analysis, err := cpu.Analyze(profile, root.analyzeOptions())
+	if err != nil {
+		fail("Error analyzing profile: %s", err)
+	}
+
+	var script bytes.Buffer
+	if err := sqlite.Script(&script, analysis); err != nil {
+		fail("Error loading tables: %s", err)
+	}
+	if cmd.Dump {
+		os.Stdout.Write(script.Bytes())
+		return
+	}
+	if err := sqlite.Query(context.Background(), script.Bytes(), cmd.Query, os.Stdout); err != nil {
+		fail("Error running query: %s\n", err)
+	}
+}
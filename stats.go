@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kmrgirish/pprof-adv/internal/input"
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+type StatsCmd struct {
+	Profiles []string `arg:"positional,required" help:"profiles to report the size and structure of"`
+}
+
+// run prints the stats of every profile, to tell why analyzing or merging
+// them is slow.
+func (cmd *StatsCmd) run(format string) {
+	for i, path := range cmd.Profiles {
+		if len(cmd.Profiles) > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("== %s\n", path)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fail("Error opening file: %s", err)
+		}
+		r, err := input.Decompress(bytes.NewReader(data))
+		if err != nil {
+			fail("Error reading %s: %s", path, err)
+		}
+		raw, err := io.ReadAll(r)
+		if err != nil {
+			fail("Error reading %s: %s", path, err)
+		}
+		profile, err := input.Parse(bytes.NewReader(raw), format)
+		if err != nil {
+			fail("Error parsing %s: %s", path, err)
+		}
+
+		stats := pb.ProfileStats(profile)
+		fmt.Printf("samples\t%d\n", stats.Samples)
+		fmt.Printf("stacks\t%d distinct\n", stats.Stacks)
+		fmt.Printf("functions\t%d distinct in stacks, %d in the function table\n", stats.Functions, len(profile.Function))
+		fmt.Printf("locations\t%d\n", stats.Locations)
+		fmt.Printf("strings\t%d, %d bytes\n", stats.Strings, stats.StringBytes)
+		fmt.Printf("stack depth\t%.1f average, %d max\n", stats.AvgDepth, stats.MaxDepth)
+		fmt.Printf("size\t%d bytes, %d uncompressed (%.1fx compression)\n", len(data), len(raw), float64(len(raw))/float64(max(len(data), 1)))
+	}
+}
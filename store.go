@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/bundle"
+	"github.com/kmrgirish/pprof-adv/internal/store"
+)
+
+type StoreCmd struct {
+	GC     *StoreGCCmd     `arg:"subcommand:gc"     help:"delete the profiles of the store and the cached runs past the retention"`
+	Export *StoreExportCmd `arg:"subcommand:export" help:"write the profiles and reports of the store and the cached runs to a bundle, e.g. for a colleague or a shared serve instance"`
+	Import *StoreImportCmd `arg:"subcommand:import" help:"add the profiles, reports and cached runs of a bundle to the store and the cache"`
+}
+
+type StoreGCCmd struct {
+	Store   string        `arg:"--store"    help:"directory or s3://bucket/prefix of the store of serve" default:"pprof-adv-store"`
+	MaxAge  time.Duration `arg:"--max-age"  help:"delete profiles and cached runs older than this, e.g. 720h" default:"720h"`
+	MaxSize string        `arg:"--max-size" help:"then delete the oldest profiles until the rest take at most this much, e.g. 1GB"`
+	DryRun  bool          `arg:"--dry-run"  help:"print what would be deleted without deleting it"`
+}
+
+type StoreExportCmd struct {
+	Bundle string `arg:"positional,required" help:"bundle to write, a .tar.zst, .tar.gz or .tar"`
+	Store  string `arg:"--store"             help:"directory or s3://bucket/prefix of the store of serve" default:"pprof-adv-store"`
+}
+
+type StoreImportCmd struct {
+	Bundle string `arg:"positional,required" help:"bundle written by store export"`
+	Store  string `arg:"--store"             help:"directory or s3://bucket/prefix of the store to import into, e.g. of a shared serve instance" default:"pprof-adv-store"`
+}
+
+func (cmd *StoreCmd) run(root *Cmd) {
+	switch {
+	case cmd.GC != nil:
+		cmd.GC.run(root)
+	case cmd.Export != nil:
+		cmd.Export.run(root)
+	case cmd.Import != nil:
+		cmd.Import.run(root)
+	default:
+		fail("Missing store subcommand, e.g. pprof-adv store gc")
+	}
+}
+
+func (cmd *StoreGCCmd) run(root *Cmd) {
+	r := retention(cmd.MaxAge, cmd.MaxSize)
+	now := time.Now()
+
+	// A missing local store has nothing to delete, and is not created.
+	if _, err := os.Stat(cmd.Store); err == nil || strings.HasPrefix(cmd.Store, "s3://") {
+		st, err := store.Open(cmd.Store)
+		if err != nil {
+			fail("Error opening store: %s", err)
+		}
+		st.Encrypt(root.loadCipher())
+		pruned, err := st.Prune(r, now, cmd.DryRun)
+		var size int
+		for _, entry := range pruned {
+			fmt.Printf("%s\t%d\t%s\n", entry.ID, entry.Size, entry.Received.Format(time.RFC3339))
+			size += entry.Size
+		}
+		if err != nil {
+			fail("Error pruning store: %s", err)
+		}
+		fmt.Fprintf(os.Stderr, "%s %d profiles, %d bytes, of %s\n", cmd.verb(), len(pruned), size, cmd.Store)
+	}
+
+	dir := cacheRoot()
+	pruned, err := store.PruneDir(dir, store.Retention{MaxAge: cmd.MaxAge}, now, cmd.DryRun)
+	for _, path := range pruned {
+		fmt.Println(path)
+	}
+	if err != nil {
+		fail("Error pruning cache: %s", err)
+	}
+	fmt.Fprintf(os.Stderr, "%s %d cached runs of %s\n", cmd.verb(), len(pruned), dir)
+}
+
+// retention returns the retention of the --max-age and --max-size flags,
+// exiting on invalid sizes.
+func retention(maxAge time.Duration, maxSize string) store.Retention {
+	r := store.Retention{MaxAge: maxAge}
+	if maxSize != "" {
+		var err error
+		if r.MaxSize, err = store.ParseSize(maxSize); err != nil {
+			fail("Invalid --max-size: %s", err)
+		}
+	}
+	return r
+}
+
+func (cmd *StoreGCCmd) verb() string {
+	if cmd.DryRun {
+		return "Would delete"
+	}
+	return "Deleted"
+}
+
+func (cmd *StoreExportCmd) run(root *Cmd) {
+	st, err := store.Open(cmd.Store)
+	if err != nil {
+		fail("Error opening store: %s", err)
+	}
+	c := root.loadCipher()
+	st.Encrypt(c)
+
+	w, err := bundle.Create(cmd.Bundle)
+	if err != nil {
+		fail("Error creating bundle: %s", err)
+	}
+	stats, err := bundle.Export(w, st, cacheRoot(), c)
+	if err != nil {
+		w.Close()
+		os.Remove(cmd.Bundle)
+		fail("Error exporting: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		fail("Error writing bundle: %s", err)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d profiles, %d reports and %d cached runs to %s\n", stats.Profiles, stats.Reports, stats.Cached, cmd.Bundle)
+}
+
+func (cmd *StoreImportCmd) run(root *Cmd) {
+	r, err := bundle.Open(cmd.Bundle)
+	if err != nil {
+		fail("Error opening bundle: %s", err)
+	}
+	defer r.Close()
+	st, err := store.Open(cmd.Store)
+	if err != nil {
+		fail("Error opening store: %s", err)
+	}
+	c := root.loadCipher()
+	st.Encrypt(c)
+
+	stats, err := bundle.Import(r, st, cacheRoot(), c)
+	if err != nil {
+		fail("Error importing %s: %s", cmd.Bundle, err)
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d profiles, %d reports and %d cached runs into %s, skipped %d already there\n", stats.Profiles, stats.Reports, stats.Cached, cmd.Store, stats.Skipped)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kmrgirish/pprof-adv/pb"
+)
+
+type SynthesizeCmd struct {
+	Profile string `arg:"positional" help:"profile to draw stacks from, defaults to --profile, --apm or stdin"`
+	Out     string `arg:"--out"      help:"file to write the stacks to, - for stdout" default:"bench_stacks.txt"`
+	Count   int    `arg:"--count"    help:"number of stacks to draw" default:"1000"`
+	Seed    int64  `arg:"--seed"     help:"seed of the draws, the same seed draws the same stacks" default:"1"`
+}
+
+// run draws stacks of the profile of the positional argument, --profile, the
+// --apm service or stdin at random, weighted by their cpu, and writes them in
+// the folded format of flame graph tools, "root;...;leaf draws", most drawn
+// first, to build microbenchmarks or load tests mirroring its hotspots.
+func (cmd *SynthesizeCmd) run(root *Cmd) {
+	profile, _ := root.loadProfile(cmd.Profile, "synthesize")
+	idx, err := pb.SampleTypeIndex(profile, root.SampleType)
+	if err != nil {
+		fail("Error reading profile: %s", err)
+	}
+	stacks, err := pb.SynthesizeStacks(profile, idx, cmd.Count, cmd.Seed)
+	if err != nil {
+		fail("Error synthesizing stacks: %s", err)
+	}
+
+	out := os.Stdout
+	if cmd.Out != "-" {
+		if out, err = os.Create(cmd.Out); err != nil {
+			fail("Error creating output file: %s", err)
+		}
+		defer out.Close()
+	}
+	w := bufio.NewWriter(out)
+	st := profile.SampleType[idx]
+	fmt.Fprintf(w, "# %d stacks drawn weighted by %s/%s with --seed %d, root first\n", cmd.Count, profile.StringTable[st.Type], profile.StringTable[st.Unit], cmd.Seed)
+	for _, s := range stacks {
+		fmt.Fprintf(w, "%s %d\n", strings.Join(s.Frames, ";"), s.Draws)
+	}
+	if err := w.Flush(); err != nil {
+		fail("Error writing stacks: %s", err)
+	}
+	if cmd.Out != "-" {
+		fmt.Fprintf(os.Stderr, "Wrote %d distinct stacks to %s\n", len(stacks), cmd.Out)
+	}
+}
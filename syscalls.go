@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+
+	"github.com/kmrgirish/pprof-adv/internal/syscalls"
+)
+
+type SyscallsCmd struct {
+	Profile string `arg:"positional" help:"profile to analyze, defaults to --profile, --apm or stdin"`
+}
+
+// run breaks the user functions of the profile of the positional argument,
+// --profile, the --apm service or stdin down into syscall, cgo, netpoll and
+// compute time.
+func (cmd *SyscallsCmd) run(root *Cmd) {
+	profile, _ := root.loadProfile(cmd.Profile, "syscalls")
+	profile = root.sample(profile)
+	if err := syscalls.Transform(profile, os.Stdout, root.analyzeOptions(), root.Top, root.style()); err != nil {
+		fail("Error transforming profile: %s", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/kmrgirish/pprof-adv/internal/update"
+	"github.com/kmrgirish/pprof-adv/internal/version"
+)
+
+type UpdateCmd struct {
+	Check bool `arg:"--check" help:"only report whether a newer release is available"`
+	Force bool `arg:"--force" help:"install the latest release even if it is not newer, e.g. over a dev build or to downgrade from a prerelease"`
+}
+
+func (cmd *UpdateCmd) run() {
+	ctx := context.Background()
+
+	release, err := update.Latest(ctx)
+	if err != nil {
+		fail("Error checking for updates: %s", err)
+	}
+
+	current := version.Version()
+	if current == "dev" {
+		if cmd.Check {
+			fmt.Printf("pprof-adv %s is the latest release (current dev build)\n", release.TagName)
+			return
+		}
+		if !cmd.Force {
+			fail("Refusing to replace a dev build, use --force to install %s", release.TagName)
+		}
+	} else {
+		newer, err := update.CompareVersions(release.TagName, current)
+		if err != nil {
+			fail("Error comparing the latest release with pprof-adv %s: %s", current, err)
+		}
+		switch {
+		case newer == 0 && !cmd.Force:
+			fmt.Printf("pprof-adv %s is up to date\n", current)
+			return
+		case newer < 0 && cmd.Check:
+			fmt.Printf("pprof-adv %s is newer than the latest release %s\n", current, release.TagName)
+			return
+		case newer < 0 && !cmd.Force:
+			fail("Refusing to downgrade pprof-adv %s to the latest release %s, use --force to install it", current, release.TagName)
+		case newer > 0 && cmd.Check:
+			fmt.Printf("pprof-adv %s is available (current %s)\n", release.TagName, current)
+			return
+		}
+	}
+	if cmd.Check {
+		fmt.Printf("pprof-adv %s is up to date\n", current)
+		return
+	}
+
+	if !update.Signed() {
+		fmt.Fprintln(os.Stderr, "Warning: this build has no release signing key, the checksum of the release only guards the download against corruption")
+	}
+	if err := update.Apply(ctx, release); err != nil {
+		fail("Error updating: %s", err)
+	}
+	fmt.Printf("Updated pprof-adv %s -> %s\n", current, release.TagName)
+}
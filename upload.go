@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/input"
+	"github.com/kmrgirish/pprof-adv/pb"
+	"github.com/kmrgirish/pprof-adv/profiler"
+)
+
+type UploadCmd struct {
+	Files   []string `arg:"positional,required" help:"profiles to upload, named by the attachment they are uploaded as (e.g. cpu.pprof, delta-heap.pprof)"`
+	Service string   `arg:"--service,required"  help:"service the profiles are tagged with"`
+	Env     string   `arg:"--env"               help:"environment the profiles are tagged with"`
+	Version string   `arg:"--service-version"   help:"version the profiles are tagged with"`
+	Tags    []string `arg:"--tag"               help:"additional key:value tags"`
+	Family  string   `arg:"--family"            help:"runtime the profiles were recorded from (go, java, python, ruby, node, dotnet)" default:"go"`
+}
+
+// uploadTags returns the tags of an upload of the service, env, version and
+// additional key:value tags, skipping empty values.
+func uploadTags(service, env, version string, extra []string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, tag := range extra {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag %q, expected key:value", tag)
+		}
+		tags[key] = value
+	}
+	for key, value := range map[string]string{"service": service, "env": env, "version": version} {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+	return tags, nil
+}
+
+func (cmd *UploadCmd) run(apiKey, site string) {
+	tags, err := uploadTags(cmd.Service, cmd.Env, cmd.Version, cmd.Tags)
+	if err != nil {
+		fail("Error: %s", err)
+	}
+
+	upload := &profiler.Upload{Family: cmd.Family, Tags: tags, Files: make(map[string][]byte)}
+	profiles := make([]*pb.Profile, 0, len(cmd.Files))
+	for _, path := range cmd.Files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fail("Error reading profile: %s", err)
+		}
+		name := filepath.Base(path)
+		if _, exists := upload.Files[name]; exists {
+			fail("Error: more than one profile named %s", name)
+		}
+		if cmd.Family == "go" {
+			profile, err := input.Parse(bytes.NewReader(data), "pprof")
+			if err != nil {
+				fail("Error parsing %s: %s", path, err)
+			}
+			profiles = append(profiles, profile)
+		}
+		upload.Files[name] = data
+	}
+
+	var ok bool
+	if upload.Start, upload.End, ok = pb.Period(profiles); !ok {
+		upload.End = time.Now()
+		upload.Start = upload.End.Add(-time.Minute)
+	}
+
+	client, err := profiler.NewIntakeClient(apiKey, site)
+	if err != nil {
+		fail("Error creating profiler client: %s", err)
+	}
+	if err := client.Upload(context.Background(), upload); err != nil {
+		fail("Error: %s", err)
+	}
+	fmt.Printf("Uploaded %d profiles for service:%s", len(upload.Files), cmd.Service)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/kmrgirish/pprof-adv/internal/version"
+)
+
+type VersionCmd struct {
+	JSON bool `arg:"--json" help:"print the build metadata as JSON"`
+}
+
+func (cmd *VersionCmd) run() {
+	if !cmd.JSON {
+		fmt.Println(version.String())
+		return
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(version.Get()); err != nil {
+		fail("Error encoding version: %s", err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/kmrgirish/pprof-adv/internal/cpu"
+	"github.com/kmrgirish/pprof-adv/internal/warehouse"
+	"github.com/kmrgirish/pprof-adv/pb"
+	"github.com/kmrgirish/pprof-adv/report"
+)
+
+// recordWriter is a warehouse.Writer or warehouse.Inserter.
+type recordWriter interface {
+	Write(r *warehouse.Record) error
+	Close() error
+}
+
+// writeWarehouse writes the SQL loading the functions of the profile into the
+// --table of the warehouse of the --format, or inserts them into the
+// ClickHouse server of the --dsn. The SQL is written to out. Rows are stamped with the time the profile
+// was recorded, or now if it doesn't tell, and the profile or service it is
+// from.
+func (cmd *Cmd) writeWarehouse(profile *pb.Profile, out io.Writer) {
+	dialect, err := warehouse.ParseDialect(cmd.Format)
+	if err != nil {
+		fail("Invalid --format: %s", err)
+	}
+
+	var w recordWriter
+	switch {
+	case cmd.DSN == "":
+		if w, err = warehouse.NewWriter(out, dialect, cmd.Table); err != nil {
+			fail("Error writing SQL: %s", err)
+		}
+	case dialect.Name != warehouse.ClickHouse.Name:
+		fail("--dsn inserts into ClickHouse, load the SQL of --format %s with its own client instead", cmd.Format)
+	default:
+		if w, err = warehouse.NewInserter(context.Background(), cmd.DSN, cmd.Table); err != nil {
+			fail("Error connecting to ClickHouse: %s", err)
+		}
+	}
+
+	recorded := time.Now()
+	if profile.TimeNanos > 0 {
+		recorded = time.Unix(0, profile.TimeNanos)
+	}
+	source := cmd.Profile
+	if cmd.Service != "" {
+		source = "service:" + cmd.Service + " env:" + cmd.Environment
+	}
+	err = cpu.TransformRows(profile, cmd.analyzeOptions(), cmd.Type, func(row report.Row) error {
+		return w.Write(&warehouse.Record{Recorded: recorded, Source: source, Row: row})
+	})
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fail("Error writing functions to %s: %s", cmd.Format, err)
+	}
+}